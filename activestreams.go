@@ -0,0 +1,91 @@
+package connectrpc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/metrics"
+)
+
+// Scopes of connectrpc_active_streams
+const (
+	activeStreamsVU         = "vu"
+	activeStreamsConnection = "connection"
+)
+
+// activeStreams counts the streams open on a VU, by URL and by HTTP client. An HTTP client
+// holds a single HTTP/2 connection to the URL.
+type activeStreams struct {
+	mu      sync.Mutex
+	urls    map[string]int64
+	clients map[*http.Client]int64
+}
+
+// add adds delta to the streams open to the URL and on the HTTP client, returning both counts
+func (a *activeStreams) add(url string, httpClient *http.Client, delta int64) (vu, connection int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.urls == nil {
+		a.urls = make(map[string]int64)
+		a.clients = make(map[*http.Client]int64)
+	}
+	return addCount(a.urls, url, delta), addCount(a.clients, httpClient, delta)
+}
+
+// addCount adds delta to the count of a key, forgetting the keys counting no stream
+func addCount[K comparable](counts map[K]int64, key K, delta int64) int64 {
+	count := counts[key] + delta
+	if count <= 0 {
+		delete(counts, key)
+	} else {
+		counts[key] = count
+	}
+	return count
+}
+
+// recordActiveStreams records a stream opened (delta 1) or ended (delta -1) on an HTTP
+// client: the streams then open to the URL on the VU, and on the connection of the stream,
+// against which the server enforces its MAX_CONCURRENT_STREAMS setting
+func (m *instanceMetrics) recordActiveStreams(ctx context.Context, vu modules.VU,
+	url string, httpClient *http.Client, delta int64) {
+
+	vuCount, connectionCount := m.activeStreams.add(url, httpClient, delta)
+
+	state := vu.State()
+	if state == nil {
+		return
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags := ctm.Tags.With("url", url)
+	now := time.Now()
+	samples := []metrics.Sample{
+		{
+			TimeSeries: metrics.TimeSeries{
+				Metric: m.ConnectRPCActiveStreams,
+				Tags:   tags.With("scope", activeStreamsVU),
+			},
+			Time:     now,
+			Metadata: ctm.Metadata,
+			Value:    float64(vuCount),
+		},
+		{
+			TimeSeries: metrics.TimeSeries{
+				Metric: m.ConnectRPCActiveStreams,
+				Tags:   tags.With("scope", activeStreamsConnection),
+			},
+			Time:     now,
+			Metadata: ctm.Metadata,
+			Value:    float64(connectionCount),
+		},
+	}
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.ConnectedSamples{
+		Samples: samples,
+		Tags:    tags,
+		Time:    now,
+	})
+}
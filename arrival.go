@@ -0,0 +1,326 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"github.com/mstoykov/k6-taskqueue-lib/taskqueue"
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib/types"
+)
+
+const (
+	// defaultArrivalMaxActive is the most streams streamArrivalRate keeps open by default
+	defaultArrivalMaxActive = 100
+	// defaultArrivalGracefulStop is how long streamArrivalRate waits for the open streams by default
+	defaultArrivalGracefulStop = 30 * time.Second
+)
+
+// arrivalRate is the options of streamArrivalRate: streams open at rate per timeUnit for
+// duration, like the constant-arrival-rate executor of k6 starts iterations
+type arrivalRate struct {
+	rate         int64
+	timeUnit     time.Duration
+	duration     time.Duration
+	maxActive    int64         // Arrivals are dropped while maxActive streams are open
+	gracefulStop time.Duration // How long the streams still open at the end may run
+}
+
+// newArrivalRate creates the options of streamArrivalRate from the JS options object
+func newArrivalRate(options map[string]interface{}) (*arrivalRate, error) {
+	a := &arrivalRate{
+		timeUnit:     time.Second,
+		maxActive:    defaultArrivalMaxActive,
+		gracefulStop: defaultArrivalGracefulStop,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "rate", "maxActive":
+			var n int64
+			switch v := v.(type) {
+			case int64:
+				n = v
+			case float64:
+				n = int64(v)
+			default:
+				return nil, fmt.Errorf("invalid %s: must be a number", k)
+			}
+			if n < 1 {
+				return nil, fmt.Errorf("invalid %s: must be at least 1, got %d", k, n)
+			}
+			if k == "rate" {
+				a.rate = n
+			} else {
+				a.maxActive = n
+			}
+		case "timeUnit", "duration", "gracefulStop":
+			d, err := types.GetDurationValue(v)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid %s: %q is not a duration, like '30s' or milliseconds", k, fmt.Sprint(v))
+			}
+			switch k {
+			case "timeUnit":
+				a.timeUnit = d
+			case "duration":
+				a.duration = d
+			default:
+				a.gracefulStop = d
+			}
+		case "params":
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+
+	if a.rate == 0 {
+		return nil, errors.New("rate is required")
+	}
+	if a.duration == 0 {
+		return nil, errors.New("duration is required")
+	}
+	if a.timeUnit == 0 || a.timeUnit/time.Duration(a.rate) == 0 {
+		return nil, fmt.Errorf("rate %d per %s is too high", a.rate, a.timeUnit)
+	}
+	return a, nil
+}
+
+// arrivals is a run of streamArrivalRate
+type arrivals struct {
+	mi       *ModuleInstance
+	client   *Client
+	method   string
+	params   sobek.Value
+	exchange sobek.Callable
+	options  *arrivalRate
+	tq       *taskqueue.TaskQueue
+
+	wg     sync.WaitGroup // Arrivals not ended yet, opened or waiting to be
+	active atomic.Int64
+
+	mu          sync.Mutex
+	streams     map[*stream]struct{} // Streams still open
+	stopping    bool                 // Whether the streams still open are being closed after gracefulStop
+	opened      int64
+	completed   int64
+	failed      int64 // Streams which failed to open, whose exchange threw, or which ended by an error
+	interrupted int64 // Streams closed after gracefulStop
+	dropped     int64
+}
+
+// streamArrivalRate opens streams on a method at a constant rate, whatever the number of VUs
+// and how long the streams last, for tests of stream setup and connection churn. Each stream
+// is passed to the exchange function with its index, which writes to it and ends it. The
+// returned promise resolves with the number of streams opened, completed, failed, interrupted
+// after gracefulStop and dropped, once the streams opened during the duration ended.
+func (mi *ModuleInstance) streamArrivalRate(
+	clientVal sobek.Value, method string, optionsVal sobek.Value, exchangeVal sobek.Value,
+) (*sobek.Promise, error) {
+	if mi.vu.State() == nil {
+		return nil, common.NewInitContextError("streamArrivalRate can't be called in the init context")
+	}
+	rt := mi.vu.Runtime()
+
+	client, err := extractClient(clientVal, rt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid streamArrivalRate client: %w", err)
+	}
+	method = dynamic.MethodPath(method)
+	methodDesc, err := client.getMethodDescriptor(method)
+	if err != nil {
+		return nil, fmt.Errorf("invalid streamArrivalRate method: %w", err)
+	}
+	if err := client.checkMethodType(method, methodDesc, true); err != nil {
+		return nil, fmt.Errorf("invalid streamArrivalRate method: %w", err)
+	}
+
+	exchange, ok := sobek.AssertFunction(exchangeVal)
+	if !ok {
+		return nil, errors.New("invalid streamArrivalRate exchange: must be a function")
+	}
+
+	if common.IsNullish(optionsVal) {
+		return nil, errors.New("invalid streamArrivalRate options: rate and duration are required")
+	}
+	optionsObj := optionsVal.ToObject(rt)
+	opts, ok := optionsObj.Export().(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid streamArrivalRate options: must be an object")
+	}
+	options, err := newArrivalRate(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid streamArrivalRate options: %w", err)
+	}
+
+	a := &arrivals{
+		mi:       mi,
+		client:   client,
+		method:   method,
+		params:   optionsObj.Get("params"),
+		exchange: exchange,
+		options:  options,
+		tq:       taskqueue.New(mi.vu.RegisterCallback),
+		streams:  make(map[*stream]struct{}),
+	}
+
+	promise, resolve, _ := rt.NewPromise()
+	go a.run(resolve)
+	return promise, nil
+}
+
+// run starts the arrivals for the duration, then waits for the streams to end
+func (a *arrivals) run(resolve func(interface{}) error) {
+	ctx := a.mi.vu.Context()
+	ticker := time.NewTicker(a.options.timeUnit / time.Duration(a.options.rate))
+	defer ticker.Stop()
+	end := time.NewTimer(a.options.duration)
+	defer end.Stop()
+
+	var index int64
+arrive:
+	for {
+		select {
+		case <-ctx.Done():
+			break arrive
+		case <-end.C:
+			break arrive
+		case <-ticker.C:
+			if a.active.Load() >= a.options.maxActive {
+				a.drop()
+				continue
+			}
+			a.active.Add(1)
+			a.wg.Add(1)
+			i := index
+			index++
+			a.tq.Queue(func() error {
+				a.open(i)
+				return nil
+			})
+		}
+	}
+
+	if ctx.Err() == nil {
+		a.wait()
+	}
+
+	a.tq.Queue(func() error {
+		a.mu.Lock()
+		summary := map[string]int64{
+			"opened":      a.opened,
+			"completed":   a.completed,
+			"failed":      a.failed,
+			"interrupted": a.interrupted,
+			"dropped":     a.dropped,
+		}
+		a.mu.Unlock()
+		return resolve(summary)
+	})
+	a.tq.Close()
+}
+
+// wait waits for the streams to end, closing the ones still open after gracefulStop
+func (a *arrivals) wait() {
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(a.options.gracefulStop):
+	}
+
+	a.tq.Queue(func() error {
+		a.mu.Lock()
+		a.stopping = true
+		streams := make([]*stream, 0, len(a.streams))
+		for s := range a.streams {
+			streams = append(streams, s)
+		}
+		a.mu.Unlock()
+		for _, s := range streams {
+			s.close()
+		}
+		return nil
+	})
+	<-done
+}
+
+// open opens a stream on the event loop and runs the exchange on it
+func (a *arrivals) open(index int64) {
+	s, err := a.mi.newStream(a.client, a.method, a.params)
+	if err != nil {
+		a.logError(err, "streamArrivalRate failed to open a stream")
+		a.end(nil, true)
+		return
+	}
+
+	a.mu.Lock()
+	a.opened++
+	a.streams[s] = struct{}{}
+	a.mu.Unlock()
+
+	go func() {
+		<-s.done
+		a.end(s, s.failed.Load())
+	}()
+
+	if _, err := a.exchange(sobek.Undefined(), s.obj, a.mi.vu.Runtime().ToValue(index)); err != nil {
+		a.logError(err, "streamArrivalRate exchange failed")
+		s.failed.Store(true)
+		s.close()
+	}
+}
+
+// end records the end of an arrival, with its stream if it was opened
+func (a *arrivals) end(s *stream, failed bool) {
+	a.mu.Lock()
+	if s != nil {
+		delete(a.streams, s)
+	}
+	switch {
+	case s != nil && a.stopping:
+		a.interrupted++
+	case failed:
+		a.failed++
+	default:
+		a.completed++
+	}
+	a.mu.Unlock()
+
+	a.active.Add(-1)
+	a.wg.Done()
+}
+
+// logError logs an error of an arrival, if the `logLevel` connect parameter enables errors
+func (a *arrivals) logError(err error, msg string) {
+	if a.client.logLevel() >= logrus.ErrorLevel {
+		a.mi.vu.State().Logger.WithField("method", a.method).WithError(err).Error(msg)
+	}
+}
+
+// drop records an arrival dropped for lack of room under maxActive
+func (a *arrivals) drop() {
+	a.mu.Lock()
+	a.dropped++
+	a.mu.Unlock()
+
+	if a.client.metrics != nil {
+		protocol, contentType := "connect", "application/json"
+		if a.client.connectParams != nil {
+			protocol, contentType = a.client.connectParams.Protocol, a.client.connectParams.ContentType
+		}
+		tags := a.client.createMetricTags(a.method, protocol, contentType)
+		tags.Type = "stream"
+		a.client.metrics.recordDroppedArrival(a.mi.vu.Context(), a.mi.vu, tags)
+	}
+}
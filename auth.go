@@ -0,0 +1,207 @@
+package connectrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib/types"
+	"golang.org/x/net/http/httpguts"
+)
+
+// authSession is the login of authenticate(): the auth call, sent again to refresh the
+// token, and where its response has the token and its lifetime
+type authSession struct {
+	method        string
+	request       []byte   // Credentials request, in JSON
+	tokenField    string   // Path of the token in the response, like `accessToken`
+	tokenPath     []string // Field names and indexes of tokenField, see parseMessagePath
+	expiresInPath []string // Path of the lifetime of the token in the response
+	header        string
+	scheme        string        // Prefix of the token in the header, like `Bearer`, empty for none
+	refreshBefore time.Duration // How long before its expiry the token is refreshed
+
+	expiry     time.Time // When the token expires, zero for a token without lifetime
+	refreshing bool      // Whether the auth call is in progress, which doesn't refresh itself
+}
+
+// Authenticate calls an auth method with credentials, like
+// `client.authenticate('/auth.v1.AuthService/Login', { user, password }, { tokenField: 'accessToken' })`,
+// and sends the token of its response in a default header of the later calls and streams
+// of the client. The token is refreshed with the same call once it expires, from its
+// `expiresIn` field or its JWT `exp` claim. It returns the response of the auth call.
+func (c *Client) Authenticate(method string, reqJS sobek.Value, optionsVal sobek.Value) (*sobek.Object, error) {
+	if c.vu.State() == nil {
+		return nil, common.NewInitContextError("authenticating in the init context is not supported")
+	}
+
+	session, err := parseAuthOptions(optionsVal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authenticate() options: %w", err)
+	}
+	session.method = method
+	if session.request, err = marshalRequest(c.vu.Runtime(), reqJS); err != nil {
+		return nil, err
+	}
+
+	// The new login replaces the previous one, which isn't refreshed anymore
+	c.auth = nil
+	response, err := c.login(session)
+	if err != nil {
+		return nil, err
+	}
+	c.auth = session
+	return response, nil
+}
+
+// parseAuthOptions parses the options of authenticate()
+func parseAuthOptions(v sobek.Value) (*authSession, error) {
+	session := &authSession{tokenField: "accessToken", header: "Authorization", scheme: "Bearer"}
+	options := map[string]interface{}{}
+	if !common.IsNullish(v) {
+		var ok bool
+		if options, ok = v.Export().(map[string]interface{}); !ok {
+			return nil, errors.New("must be an object like { tokenField, header, scheme, refreshBeforeExpiry }")
+		}
+	}
+
+	expiresInField := "expiresIn"
+	for k, value := range options {
+		switch k {
+		case "tokenField":
+			session.tokenField, _ = value.(string)
+		case "expiresInField":
+			expiresInField, _ = value.(string)
+		case "header":
+			session.header, _ = value.(string)
+			if !httpguts.ValidHeaderFieldName(session.header) {
+				return nil, fmt.Errorf("header must be a header name, got %v", value)
+			}
+		case "scheme":
+			scheme, ok := value.(string)
+			if !ok {
+				return nil, errors.New("scheme must be a string, '' for none")
+			}
+			session.scheme = scheme
+		case "refreshBeforeExpiry":
+			d, err := types.GetDurationValue(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("refreshBeforeExpiry must be a duration like '30s', got %v", value)
+			}
+			session.refreshBefore = d
+		default:
+			return nil, fmt.Errorf("unknown option %q, must be tokenField, expiresInField, header, scheme or refreshBeforeExpiry", k)
+		}
+	}
+
+	var err error
+	if session.tokenPath, err = parseMessagePath(session.tokenField); err != nil {
+		return nil, fmt.Errorf("invalid tokenField: %w", err)
+	}
+	if session.expiresInPath, err = parseMessagePath(expiresInField); err != nil {
+		return nil, fmt.Errorf("invalid expiresInField: %w", err)
+	}
+	return session, nil
+}
+
+// login makes the auth call and sets the token of its response in the default header
+func (c *Client) login(session *authSession) (*sobek.Object, error) {
+	session.refreshing = true
+	defer func() { session.refreshing = false }()
+
+	response, err := c.invoke(session.method, sobek.Undefined(), func() ([]byte, error) {
+		return session.request, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message := response.Get("message").Export()
+	if status := response.Get("status").ToInteger(); status != 200 {
+		var reason interface{} = message
+		if errorMessage, ok := lookupPath(message, []string{"message"}); ok {
+			reason = errorMessage
+		}
+		return nil, fmt.Errorf("authentication failed with status %d: %v", status, reason)
+	}
+
+	value, _ := lookupPath(message, session.tokenPath)
+	token, ok := value.(string)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("authentication failed: the response has no token at %s", session.tokenField)
+	}
+
+	session.expiry = time.Time{}
+	if value, ok := lookupPath(message, session.expiresInPath); ok {
+		if expiresIn, ok := parseExpiresIn(value); ok {
+			session.expiry = time.Now().Add(expiresIn)
+		}
+	} else if exp, ok := jwtExpiry(token); ok {
+		session.expiry = exp
+	}
+
+	if session.scheme != "" {
+		token = session.scheme + " " + token
+	}
+	c.setDefaultHeader(session.header, token)
+	return response, nil
+}
+
+// refreshAuth makes the auth call again once its token expires, before a call or stream
+func (c *Client) refreshAuth() error {
+	session := c.auth
+	if session == nil || session.refreshing || session.expiry.IsZero() {
+		return nil
+	}
+	if time.Now().Before(session.expiry.Add(-session.refreshBefore)) {
+		return nil
+	}
+	if _, err := c.login(session); err != nil {
+		return fmt.Errorf("failed to refresh the authentication: %w", err)
+	}
+	return nil
+}
+
+// parseExpiresIn parses the lifetime of a token: seconds, as a number or the string of a
+// 64-bit integer, or the JSON of a google.protobuf.Duration like "3600s"
+func parseExpiresIn(v interface{}) (time.Duration, bool) {
+	switch n := v.(type) {
+	case int64:
+		return time.Duration(n) * time.Second, true
+	case float64:
+		return time.Duration(n * float64(time.Second)), true
+	case string:
+		if seconds, err := strconv.ParseFloat(n, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		if d, err := time.ParseDuration(n); err == nil {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// jwtExpiry returns the expiry of a JWT from its `exp` claim, without verifying it
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(*claims.Exp), 0), true
+}
@@ -0,0 +1,94 @@
+package connectrpc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	// Ping logs in with a text, returning a token and its lifetime in number, and otherwise
+	// echoes the token it got
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var logins = 0;
+			var handlers = {
+				'/k6.connectrpc.ping.v1.PingService/Ping': function(request, call) {
+					if (request.text === 'mallory') {
+						throw { code: 'unauthenticated', message: 'wrong password' };
+					}
+					if (request.text === 'jwt') {
+						logins++;
+						// A JWT whose exp claim is past
+						return { text: 'eyJhbGciOiJub25lIn0.eyJleHAiOjF9.' };
+					}
+					if (request.text) {
+						logins++;
+						return { text: 'token-' + logins, number: 3600 };
+					}
+					return { text: call.headers['authorization'] || call.headers['x-token'] };
+				},
+			};
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var client = new connectrpc.Client();
+			client.connect('mock://', { handlers: handlers });
+
+			var login = client.authenticate(method, { text: 'ann' }, { tokenField: 'text', expiresInField: 'number' });
+			var tokens = [login.message.text, client.invoke(method, {}).message.text];
+			tokens.push((await client.asyncInvoke(method, {})).message.text);
+
+			// A token expiring within refreshBeforeExpiry is refreshed before each call
+			client.authenticate(method, { text: 'ann' }, {
+				tokenField: 'text', expiresInField: 'number', refreshBeforeExpiry: '2h',
+				header: 'x-token', scheme: '',
+			});
+			client.setDefaultHeaders({ authorization: null });
+			tokens.push(client.invoke(method, {}).message.text, client.invoke(method, {}).message.text);
+
+			// The lifetime of a JWT is its exp claim
+			client.authenticate(method, { text: 'jwt' }, { tokenField: 'text' });
+			client.invoke(method, {});
+
+			var failed = '';
+			try {
+				client.authenticate(method, { text: 'mallory' });
+			} catch (e) {
+				failed = e.message;
+			}
+			client.close();
+			call(JSON.stringify({ tokens: tokens, logins: logins, failed: failed }));
+		})();
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"tokens": ["token-1", "Bearer token-1", "Bearer token-1", "token-3", "token-4"],
+		"logins": 6,
+		"failed": "authentication failed with status 401: unauthenticated: wrong password"
+	}`, ts.callRecorder.Recorded()[0])
+
+	testCases := []struct {
+		Name        string
+		Options     string
+		ErrContains string
+	}{
+		{"NotAnObject", `'accessToken'`, "invalid authenticate() options: must be an object like { tokenField, header, scheme, refreshBeforeExpiry }"},
+		{"TokenField", `{ tokenField: 'items[' }`, "invalid authenticate() options: invalid tokenField"},
+		{"Header", `{ header: 'bad header' }`, "invalid authenticate() options: header must be a header name, got bad header"},
+		{"Refresh", `{ refreshBeforeExpiry: 'soon' }`, "invalid authenticate() options: refreshBeforeExpiry must be a duration like '30s', got soon"},
+		{"UnknownOption", `{ token: 'accessToken' }`, `invalid authenticate() options: unknown option "token"`},
+	}
+	for _, tc := range testCases {
+		_, err := ts.Run(`new connectrpc.Client().authenticate('/k6.connectrpc.ping.v1.PingService/Ping', {}, ` + tc.Options + `);`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
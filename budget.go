@@ -0,0 +1,130 @@
+package connectrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// totalConnections counts the connections open by all the VUs of the process, against
+// the maxTotalConnections option
+var totalConnections = newConnectionLimit()
+
+// connectionLimit counts open connections against a limit
+type connectionLimit struct {
+	mu    sync.Mutex
+	open  int
+	freed chan struct{} // Closed when a connection closes, waking up the queued dials
+}
+
+func newConnectionLimit() *connectionLimit {
+	return &connectionLimit{freed: make(chan struct{})}
+}
+
+// acquire counts a new connection, failing when limit connections are open already, or
+// waiting for one of them to close when queueing
+func (l *connectionLimit) acquire(ctx context.Context, limit int, queue bool, option string) error {
+	for {
+		l.mu.Lock()
+		if l.open < limit {
+			l.open++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		if !queue {
+			return fmt.Errorf("connection budget exceeded: %d connections open, the %s limit", limit, option)
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for a connection under the %s limit of %d: %w", option, limit, ctx.Err())
+		}
+	}
+}
+
+func (l *connectionLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.open--
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// connectionBudget limits the connections dialed by the transports of a VU, see the
+// maxConnectionsPerVU and maxTotalConnections options
+type connectionBudget struct {
+	vu       *connectionLimit
+	perVU    int // Connections open by the VU at most, 0 for no limit
+	maxTotal int // Connections open by the process at most, 0 for no limit
+	queue    bool
+}
+
+// shared returns the budget of the transports shared by all the VUs, which only
+// count towards the total
+func (b *connectionBudget) shared() *connectionBudget {
+	if b == nil || b.maxTotal == 0 {
+		return nil
+	}
+	return &connectionBudget{maxTotal: b.maxTotal, queue: b.queue}
+}
+
+// wrapDialer returns a dialer of connections counted against the budget until closed
+func (b *connectionBudget) wrapDialer(
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		release, err := b.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		return &budgetedConn{Conn: conn, release: release}, nil
+	}
+}
+
+// acquire counts a new connection against the limits, returning the function releasing it
+func (b *connectionBudget) acquire(ctx context.Context) (func(), error) {
+	if b.perVU > 0 {
+		if err := b.vu.acquire(ctx, b.perVU, b.queue, "maxConnectionsPerVU"); err != nil {
+			return nil, err
+		}
+	}
+	if b.maxTotal > 0 {
+		if err := totalConnections.acquire(ctx, b.maxTotal, b.queue, "maxTotalConnections"); err != nil {
+			if b.perVU > 0 {
+				b.vu.release()
+			}
+			return nil, err
+		}
+	}
+
+	return func() {
+		if b.perVU > 0 {
+			b.vu.release()
+		}
+		if b.maxTotal > 0 {
+			totalConnections.release()
+		}
+	}, nil
+}
+
+// budgetedConn is a net.Conn releasing its place in the budget once closed
+type budgetedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *budgetedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,83 @@
+package connectrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pipeDialer(context.Context, string, string) (net.Conn, error) {
+	client, server := net.Pipe()
+	_ = server.Close()
+	return client, nil
+}
+
+func TestConnectionBudgetError(t *testing.T) {
+	t.Parallel()
+
+	d := &moduleDefaults{vuConnections: newConnectionLimit()}
+	assert.Nil(t, d.connectionBudget())
+	require.NoError(t, d.applyOptions(map[string]interface{}{"maxConnectionsPerVU": "2"}))
+	dial := d.connectionBudget().wrapDialer(pipeDialer)
+
+	first, err := dial(context.Background(), "tcp", "pipe")
+	require.NoError(t, err)
+	second, err := dial(context.Background(), "tcp", "pipe")
+	require.NoError(t, err)
+	_, err = dial(context.Background(), "tcp", "pipe")
+	require.EqualError(t, err, "connection budget exceeded: 2 connections open, the maxConnectionsPerVU limit")
+
+	// Closing a connection twice only frees one place
+	require.NoError(t, first.Close())
+	_ = first.Close()
+	third, err := dial(context.Background(), "tcp", "pipe")
+	require.NoError(t, err)
+	_, err = dial(context.Background(), "tcp", "pipe")
+	require.Error(t, err)
+
+	require.NoError(t, second.Close())
+	require.NoError(t, third.Close())
+	assert.Equal(t, 0, d.vuConnections.open)
+}
+
+func TestConnectionBudgetQueue(t *testing.T) {
+	t.Parallel()
+
+	d := &moduleDefaults{vuConnections: newConnectionLimit()}
+	require.NoError(t, d.applyOptions(map[string]interface{}{"maxConnectionsPerVU": "1", "connectionBudget": "queue"}))
+	dial := d.connectionBudget().wrapDialer(pipeDialer)
+
+	first, err := dial(context.Background(), "tcp", "pipe")
+	require.NoError(t, err)
+
+	// The dial over budget waits for the first connection to close
+	dialed := make(chan error, 1)
+	go func() {
+		conn, err := dial(context.Background(), "tcp", "pipe")
+		if err == nil {
+			_ = conn.Close()
+		}
+		dialed <- err
+	}()
+	select {
+	case <-dialed:
+		t.Fatal("dialed over the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, first.Close())
+	require.NoError(t, <-dialed)
+
+	// Queued dials give up with their context
+	first, err = dial(context.Background(), "tcp", "pipe")
+	require.NoError(t, err)
+	defer func() { _ = first.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = dial(ctx, "tcp", "pipe")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "waiting for a connection under the maxConnectionsPerVU limit of 1")
+}
@@ -0,0 +1,224 @@
+package connectrpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultCaptureDir is the directory of the captures when `captureWire` sets none
+	defaultCaptureDir = "captures"
+	// captureMaxBody is the most bytes captured of each body, so long streams don't fill the disk
+	captureMaxBody = 1 << 20
+)
+
+// captureSeq numbers the captures of the process, so concurrent VUs never share a file name
+var captureSeq atomic.Uint64
+
+// wireCapture is the `captureWire` connect parameter: the share of calls whose headers and
+// bodies are dumped to disk, as sent and received by the transport
+type wireCapture struct {
+	sampleRate float64 // Share of the calls captured, from 0 to 1
+	dir        string  // Directory of the capture files
+}
+
+// newWireCapture creates a wire capture from the `captureWire` connect parameter
+func newWireCapture(config map[string]interface{}) (*wireCapture, error) {
+	c := &wireCapture{dir: defaultCaptureDir}
+
+	switch rate := config["sampleRate"].(type) {
+	case int64:
+		c.sampleRate = float64(rate)
+	case float64:
+		c.sampleRate = rate
+	case nil:
+		return nil, errors.New("sampleRate is required")
+	default:
+		return nil, fmt.Errorf("sampleRate must be a number, got %T", rate)
+	}
+	if c.sampleRate < 0 || c.sampleRate > 1 {
+		return nil, fmt.Errorf("sampleRate must be between 0 and 1, got %v", c.sampleRate)
+	}
+
+	if dirVal, ok := config["dir"]; ok && dirVal != nil {
+		dir, ok := dirVal.(string)
+		if !ok || dir == "" {
+			return nil, errors.New("dir must be a non-empty string")
+		}
+		c.dir = dir
+	}
+
+	return c, nil
+}
+
+// captureTransport dumps the sampled calls to files of c.dir once their response is read or closed
+type captureTransport struct {
+	base    http.RoundTripper
+	client  *Client
+	capture *wireCapture
+}
+
+// RoundTrip sends the request, capturing it and its response if it's sampled
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rand.Float64() >= t.capture.sampleRate { //nolint:gosec
+		return t.base.RoundTrip(req)
+	}
+
+	rec := &wireRecord{transport: t, request: req, start: time.Now()}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &captureBody{ReadCloser: req.Body, rec: rec, buf: &rec.requestBody}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		rec.err = err
+		rec.write()
+		return nil, err
+	}
+
+	rec.response = resp
+	resp.Body = &captureBody{ReadCloser: resp.Body, rec: rec, buf: &rec.responseBody, onClose: rec.write}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *captureTransport) CloseIdleConnections() {
+	closeIdleConnections(t.base)
+}
+
+// wireRecord holds a captured call until its response is read or closed
+type wireRecord struct {
+	transport *captureTransport
+	request   *http.Request
+	response  *http.Response
+	start     time.Time
+	err       error
+
+	mu           sync.Mutex // The request body is written while the response is read
+	requestBody  bytes.Buffer
+	responseBody bytes.Buffer
+	once         sync.Once
+}
+
+// captureBody copies the bytes read from a body to a buffer of the record
+type captureBody struct {
+	io.ReadCloser
+	rec     *wireRecord
+	buf     *bytes.Buffer
+	onClose func()
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.rec.mu.Lock()
+		if room := captureMaxBody - b.buf.Len(); room > 0 {
+			b.buf.Write(p[:min(n, room)])
+		}
+		b.rec.mu.Unlock()
+	}
+	// Streams may never close their response, but the trailers are known once it's read
+	if errors.Is(err, io.EOF) && b.onClose != nil {
+		b.onClose()
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.onClose != nil {
+		b.onClose()
+	}
+	return err
+}
+
+// write dumps the record to a new file of the capture directory, once
+func (r *wireRecord) write() {
+	r.once.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		path := filepath.Join(r.transport.capture.dir, r.fileName())
+		err := os.MkdirAll(r.transport.capture.dir, 0o750)
+		if err == nil {
+			err = os.WriteFile(path, r.dump(), 0o600)
+		}
+		if err == nil || r.transport.client.logLevel() < logrus.ErrorLevel {
+			return
+		}
+		if state := r.transport.client.vu.State(); state != nil {
+			state.Logger.WithError(err).WithField("path", path).Error("Failed to write wire capture")
+		}
+	})
+}
+
+// fileName returns a unique name sorting the captures by time, like 20260102T150405.000-000001-Ping.txt
+func (r *wireRecord) fileName() string {
+	procedure := r.request.URL.Path[strings.LastIndex(r.request.URL.Path, "/")+1:]
+	return fmt.Sprintf("%s-%06d-%s.txt", r.start.Format("20060102T150405.000"), captureSeq.Add(1), procedure)
+}
+
+// dump formats the record: the request and response headers, hex dumps of the bodies and
+// the trailers, prefixed with > for the request and < for the response like curl
+func (r *wireRecord) dump() []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "> %s %s\n", r.request.Method, r.request.URL)
+	dumpHeader(&b, "> ", r.request.Header)
+	b.WriteString(">\n")
+	dumpBody(&b, &r.requestBody)
+
+	if r.err != nil {
+		fmt.Fprintf(&b, "! %v\n", r.err)
+		return b.Bytes()
+	}
+
+	fmt.Fprintf(&b, "< %s %s\n", r.response.Proto, r.response.Status)
+	dumpHeader(&b, "< ", r.response.Header)
+	b.WriteString("<\n")
+	dumpBody(&b, &r.responseBody)
+	if len(r.response.Trailer) > 0 {
+		dumpHeader(&b, "< ", r.response.Trailer)
+	}
+
+	fmt.Fprintf(&b, "# %s\n", time.Since(r.start))
+	return b.Bytes()
+}
+
+func dumpHeader(b *bytes.Buffer, prefix string, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, key, value)
+		}
+	}
+}
+
+func dumpBody(b *bytes.Buffer, body *bytes.Buffer) {
+	b.WriteString(hex.Dump(body.Bytes()))
+	if body.Len() >= captureMaxBody {
+		fmt.Fprintf(b, "(truncated to %d bytes)\n", captureMaxBody)
+	}
+}
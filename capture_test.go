@@ -0,0 +1,94 @@
+package connectrpc_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureWire(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(true)
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "captures")
+	skipped := filepath.Join(t.TempDir(), "skipped")
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				plaintext: true,
+				protocol: 'grpc',
+				headers: { 'client-header': 'some-value' },
+				captureWire: { sampleRate: 1, dir: ` + "`" + dir + "`" + ` }
+			});
+
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 42, text: 'captured' });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum', {
+				headers: { 'client-header': 'some-value' }
+			});
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			stream.write({ number: 7 });
+			stream.end();
+			await ended;
+			client.close();
+
+			var unsampled = new connectrpc.Client();
+			unsampled.connect('` + srv.URL + `', {
+				plaintext: true,
+				headers: { 'client-header': 'some-value' },
+				captureWire: { sampleRate: 0, dir: ` + "`" + skipped + "`" + ` }
+			});
+			unsampled.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			unsampled.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), "-Ping.txt"), entries[0].Name())
+	assert.True(t, strings.HasSuffix(entries[1].Name(), "-CumSum.txt"), entries[1].Name())
+
+	ping, err := os.ReadFile(filepath.Join(dir, entries[0].Name())) //nolint:forbidigo
+	require.NoError(t, err)
+	assert.Contains(t, string(ping), "> POST "+srv.URL+"/k6.connectrpc.ping.v1.PingService/Ping\n")
+	assert.Contains(t, string(ping), "> Client-Header: some-value\n")
+	assert.Contains(t, string(ping), "> Content-Type: application/grpc+json\n")
+	// An uncompressed request message and a compressed response one. protojson randomly adds
+	// spaces to its output, so the message lengths vary.
+	assert.Contains(t, string(ping), ">\n00000000  00 00 00 00 ")
+	assert.Contains(t, string(ping), "<\n00000000  01 00 00 00 ")
+	assert.Contains(t, string(ping), "< HTTP/2.0 200 OK\n")
+	assert.Contains(t, string(ping), "< Handler-Header: some-value\n")
+	assert.Contains(t, string(ping), "< Grpc-Status: 0\n")
+
+	cumSum, err := os.ReadFile(filepath.Join(dir, entries[1].Name())) //nolint:forbidigo
+	require.NoError(t, err)
+	assert.Contains(t, string(cumSum), ">\n00000000  00 00 00 00 ")
+	assert.Contains(t, string(cumSum), "< Grpc-Encoding: gzip\n")
+	assert.Contains(t, string(cumSum), "< Grpc-Status: 0\n")
+	assert.Contains(t, string(cumSum), "< Handler-Trailer: some-trailer-value\n")
+
+	_, err = os.Stat(skipped)
+	assert.True(t, os.IsNotExist(err))
+}
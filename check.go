@@ -0,0 +1,239 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/metrics"
+)
+
+// responseCheck is an assertion of connectrpc.check() on a response
+type responseCheck struct {
+	name  string
+	check func(r checkedResponse) bool
+}
+
+// checkedResponse is the part of a response the checks look at
+type checkedResponse struct {
+	status   int64
+	message  interface{}
+	duration float64 // In milliseconds, -1 when unknown
+}
+
+// code returns the code of the response, ok for the successful ones
+func (r checkedResponse) code() string {
+	if r.status == 200 {
+		return "ok"
+	}
+	if m, ok := r.message.(map[string]interface{}); ok {
+		if code, ok := m["code"].(string); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// check evaluates the common assertions of a spec on a response in Go, sparing the JS
+// closures of k6's check(). Like it, each assertion adds a sample to the checks metric,
+// and the result is whether they all passed.
+func (mi *ModuleInstance) check(res sobek.Value, spec sobek.Value, tags sobek.Value) (bool, error) {
+	state := mi.vu.State()
+	if state == nil {
+		return false, common.NewInitContextError("checking responses in the init context is not supported")
+	}
+	rt := mi.vu.Runtime()
+
+	if common.IsNullish(res) {
+		return false, errors.New("invalid response: must be a response object")
+	}
+	if common.IsNullish(spec) {
+		return false, errors.New("invalid check spec: must be an object")
+	}
+	checks, err := parseChecks(rt, spec.ToObject(rt))
+	if err != nil {
+		return false, fmt.Errorf("invalid check spec: %w", err)
+	}
+
+	tagsAndMeta := state.Tags.GetCurrentValues()
+	if !common.IsNullish(tags) {
+		if err := common.ApplyCustomUserTags(rt, &tagsAndMeta, tags); err != nil {
+			return false, fmt.Errorf("invalid check tags: %w", err)
+		}
+	}
+
+	response := newCheckedResponse(res.ToObject(rt))
+	now := time.Now()
+	passed := true
+	for _, c := range checks {
+		sample := metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: state.BuiltinMetrics.Checks,
+				Tags:   tagsAndMeta.Tags,
+			},
+			Time:     now,
+			Metadata: tagsAndMeta.Metadata,
+		}
+		if state.Options.SystemTags.Has(metrics.TagCheck) {
+			sample.Tags = sample.Tags.With("check", c.name)
+		}
+		if c.check(response) {
+			sample.Value = 1
+		} else {
+			passed = false
+		}
+		metrics.PushIfNotDone(mi.vu.Context(), state.Samples, sample)
+	}
+	return passed, nil
+}
+
+func newCheckedResponse(obj *sobek.Object) checkedResponse {
+	r := checkedResponse{duration: -1}
+	if status := obj.Get("status"); status != nil {
+		r.status = status.ToInteger()
+	}
+	if message := obj.Get("message"); !common.IsNullish(message) {
+		r.message = message.Export()
+	}
+	if duration := obj.Get("duration"); !common.IsNullish(duration) {
+		r.duration = duration.ToFloat()
+	}
+	return r
+}
+
+// parseChecks parses the spec of connectrpc.check(), in the order of its properties
+func parseChecks(rt *sobek.Runtime, spec *sobek.Object) ([]responseCheck, error) {
+	var checks []responseCheck
+	for _, key := range spec.Keys() {
+		v := spec.Get(key)
+		switch key {
+		case "ok":
+			want := v.ToBoolean()
+			name := "status is ok"
+			if !want {
+				name = "status is not ok"
+			}
+			checks = append(checks, responseCheck{name, func(r checkedResponse) bool { return (r.status == 200) == want }})
+		case "status":
+			status, ok := v.Export().(int64)
+			if !ok {
+				return nil, fmt.Errorf("status must be an integer, got %v", v)
+			}
+			checks = append(checks, responseCheck{
+				fmt.Sprintf("status is %d", status),
+				func(r checkedResponse) bool { return r.status == status },
+			})
+		case "code":
+			code := v.String()
+			checks = append(checks, responseCheck{
+				"code is " + code,
+				func(r checkedResponse) bool { return r.code() == code },
+			})
+		case "maxDuration":
+			limit, err := time.ParseDuration(v.String())
+			if err != nil || limit <= 0 {
+				return nil, fmt.Errorf("maxDuration must be a positive duration, like '200ms', got %v", v)
+			}
+			limitMs := metrics.D(limit)
+			checks = append(checks, responseCheck{
+				"duration < " + limit.String(),
+				func(r checkedResponse) bool { return r.duration >= 0 && r.duration < limitMs },
+			})
+		case "json":
+			if common.IsNullish(v) {
+				return nil, errors.New("json must be an object of paths to values")
+			}
+			paths := v.ToObject(rt)
+			for _, path := range paths.Keys() {
+				segments, err := parseMessagePath(path)
+				if err != nil {
+					return nil, err
+				}
+				expected := paths.Get(path).Export()
+				expectedJSON, err := json.Marshal(expected)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value of %s: %w", path, err)
+				}
+				checks = append(checks, responseCheck{
+					fmt.Sprintf("%s is %s", path, expectedJSON),
+					func(r checkedResponse) bool {
+						actual, ok := lookupPath(r.message, segments)
+						return ok && jsonValuesEqual(actual, expected)
+					},
+				})
+			}
+		default:
+			return nil, fmt.Errorf("unknown check %q, must be ok, status, code, maxDuration or json", key)
+		}
+	}
+	return checks, nil
+}
+
+// parseMessagePath splits a path into the message, like `items[0].id`, `items.0.id` or
+// `$.items[0].id`, into its field names and indexes
+func parseMessagePath(path string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	p = strings.ReplaceAll(strings.ReplaceAll(p, "[", "."), "]", "")
+	segments := strings.Split(p, ".")
+	for _, s := range segments {
+		if s == "" {
+			return nil, fmt.Errorf("invalid json path %q", path)
+		}
+	}
+	return segments, nil
+}
+
+// lookupPath returns the value at the path of an exported message
+func lookupPath(v interface{}, segments []string) (interface{}, bool) {
+	for _, s := range segments {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[s]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonValuesEqual compares two values as JSON. The 64-bit integers of the messages are JSON
+// strings, so a number equals the string of its digits.
+func jsonValuesEqual(actual, expected interface{}) bool {
+	a, errA := normalizeJSON(actual)
+	e, errE := normalizeJSON(expected)
+	if errA != nil || errE != nil {
+		return false
+	}
+	if reflect.DeepEqual(a, e) {
+		return true
+	}
+
+	s, isString := a.(string)
+	n, isNumber := e.(float64)
+	return isString && isNumber && s == strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func normalizeJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	err = json.Unmarshal(b, &normalized)
+	return normalized, err
+}
@@ -0,0 +1,51 @@
+package connectrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupPath(t *testing.T) {
+	t.Parallel()
+
+	message := map[string]interface{}{
+		"id":    "12345678901234567890",
+		"items": []interface{}{map[string]interface{}{"sku": "A1", "count": float64(2)}},
+	}
+
+	testCases := []struct {
+		Path     string
+		Expected interface{}
+		Found    bool
+	}{
+		{"id", "12345678901234567890", true},
+		{"$.items[0].sku", "A1", true},
+		{"items.0.count", float64(2), true},
+		{"items[1].sku", nil, false},
+		{"id.value", nil, false},
+		{"missing", nil, false},
+	}
+	for _, tc := range testCases {
+		segments, err := parseMessagePath(tc.Path)
+		require.NoError(t, err, tc.Path)
+		actual, ok := lookupPath(message, segments)
+		assert.Equal(t, tc.Found, ok, tc.Path)
+		assert.Equal(t, tc.Expected, actual, tc.Path)
+	}
+
+	_, err := parseMessagePath("items..sku")
+	assert.ErrorContains(t, err, "invalid json path")
+}
+
+func TestJSONValuesEqual(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, jsonValuesEqual("12345", int64(12345)))
+	assert.True(t, jsonValuesEqual(float64(2), int64(2)))
+	assert.True(t, jsonValuesEqual([]interface{}{"a"}, []string{"a"}))
+	assert.True(t, jsonValuesEqual(map[string]interface{}{"a": true}, map[string]interface{}{"a": true}))
+	assert.False(t, jsonValuesEqual(float64(2), "2"))
+	assert.False(t, jsonValuesEqual("a", "b"))
+}
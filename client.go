@@ -4,23 +4,29 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptrace"
-	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/metrics"
 	"golang.org/x/net/http2"
 
 	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
@@ -33,49 +39,108 @@ type Client struct {
 	baseURL            string
 	metrics            *instanceMetrics
 	connectionStrategy string
-	connectParams      *connectParams // Store connection params for per-call strategy
+	connectParams      *connectParams  // Store connection params for per-call strategy
+	defaults           *moduleDefaults // Per-VU defaults such as the response callback
+	uploads            *uploadRegistry // Files loaded by loadFile() for uploadStream()
+
+	// Addresses of a client connected to several, nil for one, and the region tag of the current one
+	targets *targetSet
+	region  string
+
+	// In-memory server answering the calls with JS handlers, for a mock:// address
+	mock *mockServer
 
 	// Connection tracking
 	lastIterationID int64 // Track iteration for per-iteration strategy
+
+	// Dynamic clients cached per method, valid for clientsHTTP only
+	clientsMu       sync.Mutex
+	clients         map[string]*connect.Client[dynamicpb.Message, dynamicpb.Message]
+	preparedClients map[string]*connect.Client[preparedMessage, dynamicpb.Message]
+	staticClients   map[string]*connect.Client[staticMessage, staticMessage]
+	clientsHTTP     *http.Client
+
+	// asyncInvoke() calls in flight and queued under maxInFlight
+	inFlight inFlightLimiter
+
+	// Headers of setDefaultHeaders(), nil for none, and the login of authenticate()
+	defaultHeaders atomic.Pointer[defaultHeaders]
+	auth           *authSession
+
+	// Payload templates of invokeTemplate() parsed once, by template JSON
+	templates map[string]*payloadTemplate
+
+	// Resources torn down by Close(): the HTTP clients created for the connection
+	// strategy, by creation time, and the streams not ended yet
+	resourcesMu sync.Mutex
+	httpClients map[*http.Client]trackedHTTPClient
+	streams     map[*stream]struct{}
+
+	// Recycling of the HTTP client of the per-vu and per-iteration strategies, see maxConnectionAge
+	recycleMu        sync.Mutex
+	httpClientExpiry time.Time
 }
 
-// Connect establishes a connection to the ConnectRPC server at the given address
-func (c *Client) Connect(addr string, params sobek.Value) (bool, error) {
+// Connect establishes a connection to the ConnectRPC server at the given address. Given an
+// array of addresses, each call goes to the one selected for its iteration or VU, see targetSet.
+func (c *Client) Connect(addrVal sobek.Value, params sobek.Value) (bool, error) {
 	state := c.vu.State()
 	if state == nil {
 		return false, common.NewInitContextError("connecting to a ConnectRPC server in the init context is not supported")
 	}
 
-	p, err := newConnectParams(c.vu, params)
+	if err := c.checkConnectIdle(); err != nil {
+		return false, err
+	}
+
+	p, err := newConnectParams(c.vu, params, c.defaults)
 	if err != nil {
 		return false, fmt.Errorf("invalid connectrpc.connect() parameters: %w", err)
 	}
 
-	// Parse address first to get hostname for TLS ServerName
-	var hostname string
-	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
-		parsedURL, err := url.Parse(addr)
+	// Store connection strategy for use in connection management
+	c.connectionStrategy = p.ConnectionStrategy
+
+	// Store connection parameters for potential per-call use
+	c.connectParams = p
+
+	if addrs, ok := addrVal.(*sobek.Object); ok && addrs.ClassName() == "Array" {
+		targets, err := parseTargets(addrs)
 		if err != nil {
-			return false, fmt.Errorf("invalid URL: %w", err)
+			return false, fmt.Errorf("invalid connectrpc.connect() addresses: %w", err)
 		}
-		hostname = parsedURL.Host
-		c.baseURL = strings.TrimRight(addr, "/")
-	} else {
-		// This case is for when only a hostname is provided
-		hostname = addr
-		scheme := "https"
-		if p.IsPlaintext {
-			scheme = "http"
+		c.targets = &targetSet{targets: targets, perVU: p.Select == "perVU", current: -1}
+		if err := c.selectTarget(); err != nil {
+			return false, err
 		}
-		c.baseURL = fmt.Sprintf("%s://%s", scheme, addr)
+		return true, nil
+	}
+	if p.Select != "" {
+		return false, errors.New("invalid connectrpc.connect() parameters: select requires an array of addresses")
 	}
-	c.addr = hostname
+	c.targets = nil
+	c.region = ""
 
-	// Store connection strategy for use in connection management
-	c.connectionStrategy = p.ConnectionStrategy
+	c.mock = nil
+	addr := addrVal.String()
+	if strings.HasPrefix(addr, mockScheme) {
+		if c.mock, err = newMockServer(c.vu, p.Handlers); err != nil {
+			return false, fmt.Errorf("invalid connectrpc.connect() parameters: invalid handlers: %w", err)
+		}
+		// The in-memory server is reached over h2c
+		addr = "http://" + strings.TrimPrefix(addr, mockScheme)
+		if addr == "http://" {
+			addr += "mock"
+		}
+	} else if p.Handlers != nil {
+		return false, errors.New("invalid connectrpc.connect() parameters: handlers require a mock:// address")
+	}
 
-	// Store connection parameters for potential per-call use
-	c.connectParams = p
+	// Parse address first to get hostname for TLS ServerName
+	hostname, err := c.setAddress(addr, p.IsPlaintext)
+	if err != nil {
+		return false, err
+	}
 
 	// For per-call strategy, we don't create the HTTP client here
 	if c.connectionStrategy == "per-call" {
@@ -87,15 +152,66 @@ func (c *Client) Connect(addr string, params sobek.Value) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	c.httpClient = httpClient
+	c.setHTTPClient(httpClient)
 
 	return true, nil
 }
 
 // createHTTPClient creates an HTTP client with the specified parameters
 func (c *Client) createHTTPClient(p *connectParams, hostname string) (*http.Client, error) {
-	// Create HTTP transport with configurable HTTP version
-	transport := &http.Transport{}
+	var base http.RoundTripper
+	var err error
+	if c.mock != nil {
+		base = c.mock.transport
+	} else if p.Transport != "" {
+		// A transport registered by another extension replaces the built-in ones
+		base, err = c.newRegisteredTransport(p, hostname)
+		if err == nil && p.Throttle != nil {
+			base = &throttledTransport{base: base, throttle: p.Throttle}
+		}
+	} else if p.ConnectionStrategy == "global" {
+		// All VUs of the process share the transports, and so their connections
+		base, err = globalTransports.get(p, hostname, c.defaults.connectionBudget().shared())
+		if err == nil && p.Throttle != nil {
+			base = &throttledTransport{base: base, throttle: p.Throttle}
+		}
+	} else {
+		var inspector *http2FrameInspector
+		if p.HTTP2Frames {
+			inspector = c.http2FrameInspector()
+		}
+		base, err = newBaseTransport(p, hostname, c.defaults.connectionBudget(), inspector)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Create HTTP client with configurable timeout
+	timeout := time.Duration(0) // No timeout by default
+	if p.Timeout != nil {
+		timeout = *p.Timeout
+	}
+
+	httpClient := &http.Client{
+		Transport: c.wrapTransport(base, p),
+		Timeout:   timeout,
+	}
+
+	// The global transports outlive the client, so there is nothing to tear down
+	if p.ConnectionStrategy != "global" {
+		c.trackHTTPClient(httpClient)
+	}
+
+	return httpClient, nil
+}
+
+// newBaseTransport creates the HTTP transport for the specified parameters. Its connections
+// count against the budget and have their frames inspected, when given.
+func newBaseTransport(p *connectParams, hostname string, budget *connectionBudget,
+	inspector *http2FrameInspector) (http.RoundTripper, error) {
+	// Create HTTP transport with configurable HTTP version. connect-go negotiates the
+	// compression of the responses, see acceptCompression, so the transports don't add theirs.
+	transport := &http.Transport{DisableCompression: true}
 
 	// Configure HTTP version based on user preference
 	switch p.HTTPVersion {
@@ -109,80 +225,129 @@ func (c *Client) createHTTPClient(p *connectParams, hostname string) (*http.Clie
 	}
 
 	if !p.IsPlaintext {
-		// Configure TLS with proper security defaults
-		tlsCfg := &tls.Config{
-			InsecureSkipVerify: false, // Default to secure verification
-			ServerName:         hostname,
+		tlsCfg, err := newTLSConfig(p, hostname)
+		if err != nil {
+			return nil, err
 		}
+		transport.TLSClientConfig = tlsCfg
 
-		// Allow user to override TLS settings
-		if len(p.TLS) > 0 {
-			var err error
-			if tlsCfg, err = buildTLSConfigFromMap(tlsCfg, p.TLS); err != nil {
-				return nil, err
-			}
-			if tlsCfg.ServerName == "" {
-				tlsCfg.ServerName = hostname
-			}
+		if budget != nil || p.Throttle != nil {
+			transport.DialContext = newDialer(p, budget)
+		}
+		if inspector != nil {
+			return newInspectedTLSTransport(tlsCfg, newDialer(p, budget), inspector), nil
 		}
-		transport.TLSClientConfig = tlsCfg
 	} else {
 		// For plaintext connections
 		transport.TLSClientConfig = nil
-		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			var d net.Dialer
-			return d.DialContext(ctx, network, addr)
-		}
+		transport.DialContext = newDialer(p, budget)
 
 		// For HTTP/2 over plaintext (h2c), we need to use http2.Transport directly
 		// The standard http.Transport with ForceAttemptHTTP2 only works with TLS
 		if p.HTTPVersion == "2" || p.HTTPVersion == "auto" {
 			// Create an http2.Transport for h2c (HTTP/2 Cleartext / Prior Knowledge)
 			h2cTransport := &http2.Transport{
-				AllowHTTP: true,
+				AllowHTTP:          true,
+				DisableCompression: true,
 				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
 					// For h2c, we dial without TLS
 					var d net.Dialer
 					return d.DialContext(ctx, network, addr)
 				},
 			}
-
-			// Create HTTP client with h2c transport wrapped in connection tracking
-			timeout := time.Duration(0)
-			if p.Timeout != nil {
-				timeout = *p.Timeout
+			if budget != nil || p.Throttle != nil || inspector != nil {
+				dial := transport.DialContext
+				if inspector != nil {
+					dial = inspector.wrapDialer(dial)
+				}
+				h2cTransport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return dial(ctx, network, addr)
+				}
 			}
 
-			trackingTransport := &connectionTrackingTransport{
-				base:    h2cTransport,
-				client:  c,
-				baseURL: c.baseURL,
-			}
+			return h2cTransport, nil
+		}
+	}
+
+	return transport, nil
+}
 
-			return &http.Client{
-				Transport: trackingTransport,
-				Timeout:   timeout,
-			}, nil
+// newTLSConfig returns the TLS configuration of the connections to hostname, with the
+// `tls` connect parameter applied
+func newTLSConfig(p *connectParams, hostname string) (*tls.Config, error) {
+	// Configure TLS with proper security defaults
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: false, // Default to secure verification
+		ServerName:         hostname,
+	}
+
+	// Allow user to override TLS settings
+	if len(p.TLS) > 0 {
+		var err error
+		if tlsCfg, err = buildTLSConfigFromMap(tlsCfg, p.TLS); err != nil {
+			return nil, err
+		}
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName = hostname
 		}
 	}
+	return tlsCfg, nil
+}
 
-	// Create HTTP client with configurable timeout
-	timeout := time.Duration(0) // No timeout by default
-	if p.Timeout != nil {
-		timeout = *p.Timeout
+// newDialer returns the dialer of the raw connections, counted against the budget and
+// throttled as configured
+func newDialer(p *connectParams, budget *connectionBudget) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	dial := d.DialContext
+	if budget != nil {
+		dial = budget.wrapDialer(dial)
+	}
+	if p.Throttle != nil {
+		dial = p.Throttle.wrapDialer(dial)
+	}
+	return dial
+}
+
+// wrapTransport wraps the base transport with wire capture, request signing, strict
+// protocol validation and connection tracking
+func (c *Client) wrapTransport(base http.RoundTripper, p *connectParams) http.RoundTripper {
+	rt := base
+
+	// Capture next to the base transport, to see the requests as signed and sent
+	if p.CaptureWire != nil {
+		rt = &captureTransport{
+			base:    rt,
+			client:  c,
+			capture: p.CaptureWire,
+		}
+	}
+
+	// Below the conformance checks, which validate the decoded gRPC-Web frames
+	if p.GRPCWebText {
+		rt = &grpcWebTextTransport{base: rt}
+	}
+
+	if p.Strict {
+		rt = &conformanceTransport{
+			base:     rt,
+			client:   c,
+			protocol: p.Protocol,
+		}
+	}
+
+	if p.Signer != nil {
+		rt = &signingTransport{
+			base:   rt,
+			signer: p.Signer,
+		}
 	}
 
 	// Wrap transport with connection tracking
-	trackingTransport := &connectionTrackingTransport{
-		base:    transport,
+	return &connectionTrackingTransport{
+		base:    rt,
 		client:  c,
 		baseURL: c.baseURL,
 	}
-
-	return &http.Client{
-		Transport: trackingTransport,
-		Timeout:   timeout,
-	}, nil
 }
 
 // Invoke creates and calls a unary RPC by fully qualified method name
@@ -190,6 +355,27 @@ func (c *Client) Invoke(
 	method string,
 	reqJS sobek.Value,
 	params sobek.Value,
+) (*sobek.Object, error) {
+	return c.invoke(method, params, func() ([]byte, error) {
+		return marshalRequest(c.vu.Runtime(), reqJS)
+	})
+}
+
+// marshalRequest marshals a request object to JSON. A missing or null request is the
+// message with all its fields unset, so that methods taking a google.protobuf.Empty or
+// an all-default request can be called without one.
+func marshalRequest(rt *sobek.Runtime, req sobek.Value) ([]byte, error) {
+	if common.IsNullish(req) {
+		return []byte("{}"), nil
+	}
+	return req.ToObject(rt).MarshalJSON()
+}
+
+// invoke calls a unary RPC with the request marshaled to JSON by marshalRequest
+func (c *Client) invoke(
+	method string,
+	params sobek.Value,
+	marshalRequest func() ([]byte, error),
 ) (*sobek.Object, error) {
 	state := c.vu.State()
 	if state == nil {
@@ -198,7 +384,16 @@ func (c *Client) Invoke(
 
 	// Check if Connect() was called successfully
 	if c.httpClient == nil && c.connectParams == nil {
-		return nil, errors.New("client not connected: call connect() first")
+		return nil, errNotConnected
+	}
+	if err := c.checkRampDown(); err != nil {
+		return nil, err
+	}
+	if err := c.refreshAuth(); err != nil {
+		return nil, err
+	}
+	if err := c.selectTarget(); err != nil {
+		return nil, err
 	}
 
 	// Get or create HTTP client based on connection strategy
@@ -211,38 +406,27 @@ func (c *Client) Invoke(
 		if err != nil {
 			return nil, fmt.Errorf("failed to create HTTP client for per-call strategy: %w", err)
 		}
-	} else if c.connectionStrategy == "per-iteration" {
-		// Check if we're in a new iteration
-		currentIterationID := state.Iteration
-		if c.httpClient == nil || c.lastIterationID != currentIterationID {
-			// Close the existing connection if any
-			if c.httpClient != nil {
-				c.httpClient.CloseIdleConnections()
-			}
-			// Create a fresh HTTP client for this iteration
-			httpClient, err = c.createHTTPClient(c.connectParams, c.addr)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create HTTP client for per-iteration strategy: %w", err)
-			}
-			c.httpClient = httpClient
-			c.lastIterationID = currentIterationID
-		} else {
-			// Reuse existing client for same iteration
-			httpClient = c.httpClient
-		}
+		defer c.releaseHTTPClient(httpClient)
 	} else {
-		// Use the existing HTTP client for per-vu strategy
-		httpClient = c.httpClient
+		// The HTTP client of the VU, or of the iteration with per-iteration
+		httpClient, err = c.vuHTTPClient()
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	methodDesc, err := c.getMethodDescriptor(method)
 	if err != nil {
-		// Debug logging
-		c.vu.State().Logger.WithField("method", method).WithError(err).Error("Failed to get method descriptor")
+		if c.logLevel() >= logrus.ErrorLevel {
+			c.vu.State().Logger.WithField("method", method).WithError(err).Error("Failed to get method descriptor")
+		}
+		return nil, err
+	}
+	if err := c.checkMethodType(method, methodDesc, false); err != nil {
 		return nil, err
 	}
 
-	p, err := newCallParams(c.vu, params)
+	p, err := newCallParams(c.vu, params, c.defaults)
 	if err != nil {
 		return nil, err
 	}
@@ -253,80 +437,41 @@ func (c *Client) Invoke(
 		callTimeout = *p.Timeout
 	}
 
-	// Create the dynamic client just-in-time
-	// The full procedure string is just the method path
-	procedureString := method // e.g., "/clown.v1.ClownService/TellJoke"
-	url := c.baseURL + procedureString
-
 	// Prepare the dynamic request message from JavaScript object
-	reqJSON, err := reqJS.ToObject(c.vu.Runtime()).MarshalJSON()
+	reqJSON, err := marshalRequest()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request object: %w", err)
 	}
+	if err := c.applyRouting(reqJSON, p); err != nil {
+		return nil, err
+	}
+	if isStatic(methodDesc) {
+		return c.invokeStatic(httpClient, method, methodDesc, reqJSON, p)
+	}
 
 	requestMessage := dynamicpb.NewMessage(methodDesc.Input())
-	if err := protojson.Unmarshal(reqJSON, requestMessage); err != nil {
+	if err := c.requestUnmarshaler(p).unmarshal(reqJSON, requestMessage); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON into dynamic protobuf message: %w", err)
 	}
 
-	// Prepare client options based on connection parameters
-	clientOptions := []connect.ClientOption{
-		connect.WithSchema(methodDesc),
-		connect.WithResponseInitializer(func(spec connect.Spec, msg any) error {
-			dynamic, ok := msg.(*dynamicpb.Message)
-			if !ok {
-				return nil
-			}
-			desc, ok := spec.Schema.(protoreflect.MethodDescriptor)
-			if !ok {
-				return fmt.Errorf("invalid schema type %T for %T message", spec.Schema, dynamic)
-			}
-			if spec.IsClient {
-				*dynamic = *dynamicpb.NewMessage(desc.Output())
-			} else {
-				*dynamic = *dynamicpb.NewMessage(desc.Input())
-			}
-			return nil
-		}),
-	}
-
-	// Add protocol-specific options based on connection parameters
 	connParams := c.connectParams
 
-	switch connParams.Protocol {
-	case "grpc":
-		clientOptions = append(clientOptions, connect.WithGRPC())
-	case "grpc-web":
-		clientOptions = append(clientOptions, connect.WithGRPCWeb())
-	case "connect":
-		// "connect" protocol is the default, no additional option needed
-	}
-
-	// Add JSON codec if JSON content type is specified
-	if connParams.ContentType == "application/json" {
-		clientOptions = append(clientOptions, connect.WithProtoJSON())
-	}
-
-	// Create the client with the baseURL and the full procedure string
-	dynamicClient := connect.NewClient[dynamicpb.Message, dynamicpb.Message](
-		httpClient,
-		url,
-		clientOptions...,
-	)
+	// Reuse the dynamic client for this method, unless the connection is per call
+	dynamicClient := c.dynamicClient(httpClient, method, methodDesc)
 
 	connectReq := connect.NewRequest(requestMessage)
 
 	// First, set connection-level headers from connectParams
-	if connParams.Headers != nil {
-		for key, value := range connParams.Headers {
-			connectReq.Header().Set(key, value)
-		}
-	}
+	connParams.setHeaders(connectReq.Header())
 
-	// Then, set call-level headers from p.Metadata (these can override connection-level headers)
+	// Then, set the default headers and the call-level headers from p.Metadata (these can
+	// override connection-level headers)
+	c.defaultHeaders.Load().apply(connectReq.Header())
 	for key, value := range p.Metadata {
 		connectReq.Header().Set(key, value)
 	}
+	c.setIdempotencyKey(connectReq.Header(), p)
+	c.setRequestID(connectReq.Header(), p)
 
 	// Make the call with configurable timeout
 	var ctx context.Context
@@ -338,11 +483,16 @@ func (c *Client) Invoke(
 		// No timeout - use base context
 		ctx = c.vu.Context()
 	}
+	ctx, peer := withPeerInfo(ctx)
+	ctx = withRPCTags(ctx, c.createCallMetricTags(method, p))
 
 	// Record request start time for metrics
 	requestStart := time.Now()
 
-	resp, err := dynamicClient.CallUnary(ctx, connectReq)
+	var resp *connect.Response[dynamicpb.Message]
+	c.awaitMock(func() {
+		resp, err = dynamicClient.CallUnary(ctx, connectReq)
+	})
 
 	// Calculate duration and payload sizes for metrics
 	requestDuration := time.Since(requestStart)
@@ -354,16 +504,20 @@ func (c *Client) Invoke(
 	// Create response object for k6
 	rt := c.vu.Runtime()
 	responseObject := rt.NewObject()
+	p.setIdempotencyKey(rt, responseObject)
+	p.setRequestID(rt, responseObject)
+	must(rt, responseObject.Set("duration", metrics.D(requestDuration)))
 
 	if err != nil {
 		// Handle Connect RPC errors by converting them to HTTP-like status codes
 		var connectErr *connect.Error
 		var httpStatus int
 		var message string
+		var server *serverMetadata
 
 		if errors.As(err, &connectErr) {
 			// Convert Connect error codes to HTTP status codes
-			httpStatus = connectCodeToHTTPStatus(connectErr.Code())
+			httpStatus = dynamic.HTTPStatus(connectErr.Code())
 			message = connectErr.Error() // Use full error message like streaming code
 
 			// Create error response object
@@ -387,11 +541,15 @@ func (c *Client) Invoke(
 				serializedDetails[i] = serializedDetail
 			}
 			must(rt, errorObj.Set("details", rt.ToValue(serializedDetails)))
+			must(rt, errorObj.Set("raw", rt.ToValue(peer.rawError(connectErr))))
 
 			must(rt, responseObject.Set("message", errorObj))
 			must(rt, responseObject.Set("status", rt.ToValue(httpStatus)))
-			must(rt, responseObject.Set("headers", rt.ToValue(connectErr.Meta())))
-			must(rt, responseObject.Set("trailers", rt.ToValue(connectErr.Meta()))) // Connect errors use Meta for both
+			headers, trailers := peer.errorMetadata(connectErr)
+			c.setHeaders(rt, responseObject, p.filterHeaders(headers), p.filterHeaders(trailers))
+
+			server = parseServerMetadata(connectErr.Meta(), nil)
+			server.set(rt, responseObject)
 		} else {
 			// Non-Connect errors (network, timeout, etc.)
 			httpStatus = 500 // Internal Server Error
@@ -403,17 +561,20 @@ func (c *Client) Invoke(
 
 			must(rt, responseObject.Set("message", errorObj))
 			must(rt, responseObject.Set("status", rt.ToValue(httpStatus)))
-			must(rt, responseObject.Set("headers", rt.ToValue(map[string]string{})))
-			must(rt, responseObject.Set("trailers", rt.ToValue(map[string]string{})))
+			c.setHeaders(rt, responseObject, nil, nil)
 		}
+		peer.set(rt, responseObject)
 
 		// Record error metrics
 		if c.metrics != nil {
-			tags := c.createMetricTags(method, connParams.Protocol, connParams.ContentType)
-			tags.Type = "unary"
+			tags := c.createUnaryMetricTags(method, p, httpStatus, err)
 			c.metrics.recordUnaryRequest(c.vu.Context(), c.vu, requestDuration, reqSize, 0, tags, err)
+			c.recordServerTiming(tags, server)
 		}
 
+		if err := c.deriveSamples(method, p, responseObject, nil); err != nil {
+			return nil, err
+		}
 		return responseObject, nil // Return response object instead of error for k6
 	}
 
@@ -428,38 +589,49 @@ func (c *Client) Invoke(
 		respSize = int64(len(responseJSON))
 	}
 
-	// Create a message object from the JSON response
-	messageVal, err := rt.RunString("(" + string(responseJSON) + ")")
-	if err != nil {
-		return nil, err
+	// The message object is only created when the script accesses it
+	if p.DiscardResponseMessage {
+		must(rt, responseObject.Set("message", sobek.Null()))
+	} else {
+		must(rt, defineLazyMessage(rt, responseObject, responseJSON, c.responseConversion(methodDesc.Output())))
 	}
-
-	must(rt, responseObject.Set("message", messageVal))
 	must(rt, responseObject.Set("status", rt.ToValue(200))) // HTTP OK status for successful RPC
-	must(rt, responseObject.Set("headers", rt.ToValue(resp.Header())))
-	must(rt, responseObject.Set("trailers", rt.ToValue(resp.Trailer())))
+	c.setHeaders(rt, responseObject, p.filterHeaders(resp.Header()), p.filterHeaders(resp.Trailer()))
+
+	server := parseServerMetadata(resp.Header(), resp.Trailer())
+	server.set(rt, responseObject)
+	peer.set(rt, responseObject)
 
 	// Record successful unary request metrics
 	if c.metrics != nil {
-		tags := c.createMetricTags(method, connParams.Protocol, connParams.ContentType)
-		tags.Type = "unary"
+		tags := c.createUnaryMetricTags(method, p, 200, nil)
 		c.metrics.recordUnaryRequest(c.vu.Context(), c.vu, requestDuration, reqSize, respSize, tags, nil)
+		c.recordServerTiming(tags, server)
+		c.recordResponseCompression(tags, peer, c.decompressedSize(resp.Msg, responseJSON))
 	}
 
+	if err := c.deriveSamples(method, p, responseObject, responseJSON); err != nil {
+		return nil, err
+	}
 	return responseObject, nil
 }
 
 // rpcResult holds the raw result of an RPC call without sobek objects
 type rpcResult struct {
-	responseJSON []byte
-	httpStatus   int
-	headers      map[string][]string
-	trailers     map[string][]string
-	err          error
-	connectErr   *connect.Error
-	reqSize      int64
-	respSize     int64
-	duration     time.Duration
+	responseJSON   []byte
+	conversion     *responseConversion // Conversion of the response message, nil for none
+	discardMessage bool
+	httpStatus     int
+	headers        map[string][]string
+	trailers       map[string][]string
+	err            error
+	connectErr     *connect.Error
+	server         *serverMetadata // Server-Timing and status details, nil if not sent
+	peer           *peerInfo       // Connection the call was sent on
+	reqSize        int64
+	respSize       int64
+	decompressed   int64 // Size of the response message without compression, see recordResponseCompression
+	duration       time.Duration
 }
 
 // AsyncInvoke creates and calls a unary RPC by fully qualified method name asynchronously
@@ -479,46 +651,87 @@ func (c *Client) AsyncInvoke(
 	if state == nil {
 		return nil, common.NewInitContextError("invoking a ConnectRPC method in the init context is not supported")
 	}
+	if err := c.checkRampDown(); err != nil {
+		return nil, err
+	}
+	if err := c.refreshAuth(); err != nil {
+		return nil, err
+	}
+	if err := c.selectTarget(); err != nil {
+		return nil, err
+	}
 
-	method = sanitizeMethodName(method)
+	method = dynamic.MethodPath(method)
 
 	methodDesc, err := c.getMethodDescriptor(method)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.checkMethodType(method, methodDesc, false); err != nil {
+		return nil, err
+	}
 
-	p, err := newCallParams(c.vu, params)
+	p, err := newCallParams(c.vu, params, c.defaults)
 	if err != nil {
 		return nil, fmt.Errorf("invalid connectrpc.invoke() parameters: %w", err)
 	}
 
 	// Marshal the request to JSON in the main goroutine
-	reqJSON, err := req.ToObject(rt).MarshalJSON()
+	reqJSON, err := marshalRequest(rt, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request object: %w", err)
 	}
+	if err := c.applyRouting(reqJSON, p); err != nil {
+		return nil, err
+	}
 
 	// Set tags for metrics
 	p.SetSystemTags(state, c.addr, method)
 
-	// Store connection params protocol and content type for metrics (accessed in goroutine)
-	connParams := c.connectParams
+	// The HTTP client shared by the calls of the VU is resolved here rather than in the
+	// goroutine of the call, as the per-vu and per-iteration strategies replace it
+	pending := &rpcResult{reqSize: int64(len(reqJSON))}
+	var httpClient *http.Client
+	if c.connectionStrategy != "per-call" {
+		httpClient = c.rpcHTTPClient(pending)
+	}
 
+	endMock := c.beginMock()
 	callback := c.vu.RegisterCallback()
-	go func() {
+	limit := c.maxInFlight(p)
+	c.inFlight.start(limit, func(waited time.Duration) {
 		// Do the RPC call in the goroutine without touching the runtime
-		result := c.doUnaryRPC(method, methodDesc, reqJSON, p)
+		result := c.doUnaryRPC(pending, httpClient, method, methodDesc, reqJSON, p)
 
 		// Record metrics in the goroutine (doesn't touch runtime)
+		tags := c.createUnaryMetricTags(method, p, result.httpStatus, result.err)
 		if c.metrics != nil {
-			tags := c.createMetricTags(method, connParams.Protocol, connParams.ContentType)
-			tags.Type = "unary"
 			c.metrics.recordUnaryRequest(c.vu.Context(), c.vu, result.duration, result.reqSize, result.respSize, tags, result.err)
+			c.recordServerTiming(tags, result.server)
+			if result.err == nil {
+				c.recordResponseCompression(tags, result.peer, result.decompressed)
+			}
+			if limit > 0 {
+				c.metrics.recordQueued(c.vu.Context(), c.vu, tags, waited)
+			}
 		}
+		// The call no longer reads the client, which connect() may now replace
+		c.inFlight.done()
 
 		// Convert the raw result to a sobek object in the callback (main goroutine)
+		queued := time.Now()
 		callback(func() error {
+			endMock()
+			if c.metrics != nil {
+				c.metrics.recordSaturation(c.vu.Context(), c.vu, tags, saturationEventLoop, time.Since(queued))
+			}
+
 			responseObj := c.convertRPCResultToObject(result)
+			p.setIdempotencyKey(rt, responseObj)
+			p.setRequestID(rt, responseObj)
+			if err := c.deriveSamples(method, p, responseObj, result.responseJSON); err != nil {
+				return err
+			}
 
 			if result.err != nil && result.connectErr == nil {
 				// For non-Connect errors, we still return the response object (k6 pattern)
@@ -528,137 +741,324 @@ func (c *Client) AsyncInvoke(
 
 			return resolve(responseObj)
 		})
-	}()
+	})
 
 	return promise, nil
 }
 
-// Close will close the client HTTP connection
+// Close tears down the client: it closes the streams still open, waiting for them to end,
+// then the connections of every HTTP client created for the connection strategy, recording
+// how long each of them lived
 func (c *Client) Close() error {
-	if c.httpClient == nil {
-		return nil
+	c.resourcesMu.Lock()
+	streams := make([]*stream, 0, len(c.streams))
+	for s := range c.streams {
+		streams = append(streams, s)
+	}
+	httpClients := make([]*http.Client, 0, len(c.httpClients))
+	for httpClient := range c.httpClients {
+		httpClients = append(httpClients, httpClient)
+	}
+	c.resourcesMu.Unlock()
+
+	for _, s := range streams {
+		s.close()
+		if s.readLoopStarted.Load() {
+			<-s.readLoopDone
+		}
 	}
 
-	// Close idle connections
-	c.httpClient.CloseIdleConnections()
+	for _, httpClient := range httpClients {
+		c.releaseHTTPClient(httpClient)
+	}
 	c.httpClient = nil
+	if c.targets != nil {
+		c.targets.clients = nil
+	}
 
 	return nil
 }
 
-// doUnaryRPC performs the actual RPC call without touching the sobek runtime
-// This method is safe to call from a goroutine
-func (c *Client) doUnaryRPC(
-	method string,
-	methodDesc protoreflect.MethodDescriptor,
-	reqJSON []byte,
-	p *callParams,
-) *rpcResult {
-	result := &rpcResult{
-		reqSize: int64(len(reqJSON)),
+// trackedHTTPClient is an HTTP client to release on Close(), with when and for which base
+// URL it was created, as the streams release theirs after connect() may have changed it
+type trackedHTTPClient struct {
+	created time.Time
+	baseURL string
+}
+
+// trackHTTPClient records an HTTP client to release on Close()
+func (c *Client) trackHTTPClient(httpClient *http.Client) {
+	c.resourcesMu.Lock()
+	if c.httpClients == nil {
+		c.httpClients = make(map[*http.Client]trackedHTTPClient)
 	}
+	c.httpClients[httpClient] = trackedHTTPClient{created: time.Now(), baseURL: c.baseURL}
+	c.resourcesMu.Unlock()
 
-	// Get or create HTTP client based on connection strategy
-	var httpClient *http.Client
-	var err error
+	if c.metrics != nil {
+		c.metrics.recordConnection(c.vu.Context(), c.vu, c.baseURL)
+	}
+}
 
-	if c.connectionStrategy == "per-call" {
-		httpClient, err = c.createHTTPClient(c.connectParams, c.addr)
-		if err != nil {
-			result.err = fmt.Errorf("failed to create HTTP client for per-call strategy: %w", err)
-			result.httpStatus = 500
-			return result
-		}
-		defer httpClient.CloseIdleConnections()
-	} else if c.connectionStrategy == "per-iteration" {
-		state := c.vu.State()
-		currentIterationID := state.Iteration
-		if c.lastIterationID != currentIterationID {
-			if c.httpClient != nil {
-				c.httpClient.CloseIdleConnections()
-			}
-			httpClient, err = c.createHTTPClient(c.connectParams, c.addr)
-			if err != nil {
-				result.err = fmt.Errorf("failed to create HTTP client for per-iteration strategy: %w", err)
-				result.httpStatus = 500
-				return result
-			}
-			c.httpClient = httpClient
-			c.lastIterationID = currentIterationID
-		} else {
-			httpClient = c.httpClient
-		}
-	} else {
-		httpClient = c.httpClient
+// releaseHTTPClient closes the connections of a tracked HTTP client and records its duration.
+// It does nothing if the client was already released.
+func (c *Client) releaseHTTPClient(httpClient *http.Client) {
+	c.resourcesMu.Lock()
+	tracked, ok := c.httpClients[httpClient]
+	delete(c.httpClients, httpClient)
+	c.resourcesMu.Unlock()
+
+	if !ok {
+		return
 	}
 
-	// Prepare the dynamic request message from JSON
-	requestMessage := dynamicpb.NewMessage(methodDesc.Input())
-	if err := protojson.Unmarshal(reqJSON, requestMessage); err != nil {
-		result.err = fmt.Errorf("failed to unmarshal JSON into dynamic protobuf message: %w", err)
-		result.httpStatus = 500
-		return result
+	httpClient.CloseIdleConnections()
+	if c.metrics != nil {
+		c.metrics.recordConnectionEnd(c.vu.Context(), c.vu, tracked.baseURL, time.Since(tracked.created))
 	}
+}
+
+// trackStream records an open stream to close on Close()
+func (c *Client) trackStream(s *stream) {
+	c.resourcesMu.Lock()
+	defer c.resourcesMu.Unlock()
+
+	if c.streams == nil {
+		c.streams = make(map[*stream]struct{})
+	}
+	c.streams[s] = struct{}{}
+}
+
+// untrackStream forgets a stream once it ended
+func (c *Client) untrackStream(s *stream) {
+	c.resourcesMu.Lock()
+	defer c.resourcesMu.Unlock()
 
-	// Prepare client options
+	delete(c.streams, s)
+}
+
+// clientOptions returns the connect client options for a method, based on the connection parameters
+func (c *Client) clientOptions(methodDesc protoreflect.MethodDescriptor) []connect.ClientOption {
 	clientOptions := []connect.ClientOption{
 		connect.WithSchema(methodDesc),
 		connect.WithResponseInitializer(func(spec connect.Spec, msg any) error {
-			dynamic, ok := msg.(*dynamicpb.Message)
-			if !ok {
-				return nil
-			}
 			desc, ok := spec.Schema.(protoreflect.MethodDescriptor)
 			if !ok {
-				return fmt.Errorf("invalid schema type %T for %T message", spec.Schema, dynamic)
+				return fmt.Errorf("invalid schema type %T for %T message", spec.Schema, msg)
 			}
+			messageDesc := desc.Input()
 			if spec.IsClient {
-				*dynamic = *dynamicpb.NewMessage(desc.Output())
-			} else {
-				*dynamic = *dynamicpb.NewMessage(desc.Input())
+				messageDesc = desc.Output()
+			}
+
+			switch msg := msg.(type) {
+			case *dynamicpb.Message:
+				*msg = *dynamicpb.NewMessage(messageDesc)
+			case *staticMessage:
+				mt, ok := staticMessageType(messageDesc)
+				if !ok {
+					return fmt.Errorf("%s has no generated Go type", messageDesc.FullName())
+				}
+				msg.Message = mt.New().Interface()
 			}
 			return nil
 		}),
 	}
 
-	// Add protocol-specific options
 	connParams := c.connectParams
+	if connParams == nil {
+		return clientOptions
+	}
+
+	// Add protocol-specific options based on connection parameters
 	switch connParams.Protocol {
 	case "grpc":
 		clientOptions = append(clientOptions, connect.WithGRPC())
 	case "grpc-web":
 		clientOptions = append(clientOptions, connect.WithGRPCWeb())
 	case "connect":
-		// Default, no additional option needed
+		// "connect" protocol is the default, no additional option needed
 	}
 
-	// Add JSON codec if needed
+	// Add JSON codec if JSON content type is specified
 	if connParams.ContentType == "application/json" {
 		clientOptions = append(clientOptions, connect.WithProtoJSON())
 	}
+	if codec := registeredCodec(connParams.ContentType); codec != nil {
+		clientOptions = append(clientOptions, connect.WithCodec(codec))
+	}
 
-	// Create client
-	procedureString := method
-	url := c.baseURL + procedureString
-	dynamicClient := connect.NewClient[dynamicpb.Message, dynamicpb.Message](
-		httpClient,
-		url,
-		clientOptions...,
-	)
+	clientOptions = append(clientOptions, connParams.compressionOptions()...)
 
-	connectReq := connect.NewRequest(requestMessage)
+	if interceptors := connParams.interceptors(); len(interceptors) > 0 {
+		clientOptions = append(clientOptions, connect.WithInterceptors(interceptors...))
+	}
 
-	// Set connection-level headers
-	if connParams.Headers != nil {
-		for key, value := range connParams.Headers {
-			connectReq.Header().Set(key, value)
+	return clientOptions
+}
+
+// streamConnections returns whether each stream opens its own HTTP client, released once
+// it ends: with the per-call strategy, and with per-stream whose unary calls share the
+// HTTP client of the VU
+func (c *Client) streamConnections() bool {
+	return c.connectionStrategy == "per-call" || c.connectionStrategy == "per-stream"
+}
+
+// dynamicClient returns the connect client for a method. Clients are cached per
+// method for as long as the HTTP client is reused, so that the per-call overhead is
+// just the request marshaling and the round trip.
+func (c *Client) dynamicClient(
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+) *connect.Client[dynamicpb.Message, dynamicpb.Message] {
+	perStream := c.connectionStrategy == "per-stream" && (methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer())
+	if c.connectionStrategy == "per-call" || perStream {
+		return connect.NewClient[dynamicpb.Message, dynamicpb.Message](
+			httpClient, c.baseURL+method, c.clientOptions(methodDesc)...)
+	}
+
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	c.resetClientsLocked(httpClient)
+
+	dynamicClient, ok := c.clients[method]
+	if !ok {
+		dynamicClient = connect.NewClient[dynamicpb.Message, dynamicpb.Message](
+			httpClient, c.baseURL+method, c.clientOptions(methodDesc)...)
+		c.clients[method] = dynamicClient
+	}
+	return dynamicClient
+}
+
+// preparedClient returns the connect client sending payloads pre-marshaled by precompile().
+// It is cached like dynamicClient.
+func (c *Client) preparedClient(
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+) *connect.Client[preparedMessage, dynamicpb.Message] {
+	newClient := func() *connect.Client[preparedMessage, dynamicpb.Message] {
+		options := append(c.clientOptions(methodDesc), connect.WithCodec(newPreparedCodec(c.connectParams)))
+		return connect.NewClient[preparedMessage, dynamicpb.Message](httpClient, c.baseURL+method, options...)
+	}
+
+	if c.connectionStrategy == "per-call" {
+		return newClient()
+	}
+
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	c.resetClientsLocked(httpClient)
+
+	preparedClient, ok := c.preparedClients[method]
+	if !ok {
+		preparedClient = newClient()
+		c.preparedClients[method] = preparedClient
+	}
+	return preparedClient
+}
+
+// resetClientsLocked drops the cached clients if they were created for another HTTP client,
+// which changes on reconnect and for every iteration with per-iteration
+func (c *Client) resetClientsLocked(httpClient *http.Client) {
+	if c.clientsHTTP == httpClient {
+		return
+	}
+
+	c.clients = make(map[string]*connect.Client[dynamicpb.Message, dynamicpb.Message])
+	c.preparedClients = make(map[string]*connect.Client[preparedMessage, dynamicpb.Message])
+	c.staticClients = make(map[string]*connect.Client[staticMessage, staticMessage])
+	c.clientsHTTP = httpClient
+}
+
+// doUnaryRPC performs the actual RPC call without touching the sobek runtime, filling the
+// result of asyncInvoke(). It is called from a goroutine, with the HTTP client the VU
+// resolved, nil for the per-call strategy which creates one for the call.
+func (c *Client) doUnaryRPC(
+	result *rpcResult,
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+	reqJSON []byte,
+	p *callParams,
+) *rpcResult {
+	if result.err != nil {
+		return result // No HTTP client
+	}
+	if httpClient == nil {
+		if httpClient = c.rpcHTTPClient(result); httpClient == nil {
+			return result
 		}
 	}
+	if c.connectionStrategy == "per-call" {
+		defer c.releaseHTTPClient(httpClient)
+	}
+	if isStatic(methodDesc) {
+		return c.doStaticRPC(result, httpClient, method, methodDesc, reqJSON, p)
+	}
+
+	// Prepare the dynamic request message from JSON
+	requestMessage := dynamicpb.NewMessage(methodDesc.Input())
+	if err := c.requestUnmarshaler(p).unmarshal(reqJSON, requestMessage); err != nil {
+		result.err = fmt.Errorf("failed to unmarshal JSON into dynamic protobuf message: %w", err)
+		result.httpStatus = 500
+		return result
+	}
+
+	dynamicClient := c.dynamicClient(httpClient, method, methodDesc)
+
+	return completeUnaryRPC(c, result, dynamicClient.CallUnary, connect.NewRequest(requestMessage), method, p)
+}
+
+// rpcHTTPClient returns the HTTP client for an RPC based on the connection strategy.
+// On failure it sets the error in the result and returns nil.
+func (c *Client) rpcHTTPClient(result *rpcResult) *http.Client {
+	var httpClient *http.Client
+	var err error
 
-	// Set call-level headers (can override connection-level)
+	if c.connectionStrategy == "per-call" {
+		httpClient, err = c.createHTTPClient(c.connectParams, c.addr)
+		if err != nil {
+			result.err = fmt.Errorf("failed to create HTTP client for per-call strategy: %w", err)
+			result.httpStatus = 500
+			return nil
+		}
+	} else {
+		httpClient, err = c.vuHTTPClient()
+	}
+	if err != nil {
+		result.err = err
+		result.httpStatus = 500
+		return nil
+	}
+
+	return httpClient
+}
+
+// completeUnaryRPC sends a prepared request and fills the result without touching the sobek runtime
+func completeUnaryRPC[Req, Resp any](
+	c *Client,
+	result *rpcResult,
+	call func(context.Context, *connect.Request[Req]) (*connect.Response[Resp], error),
+	connectReq *connect.Request[Req],
+	method string,
+	p *callParams,
+) *rpcResult {
+	connParams := c.connectParams
+
+	// Set connection-level headers
+	connParams.setHeaders(connectReq.Header())
+
+	// Set the default headers and the call-level headers (can override connection-level)
+	c.defaultHeaders.Load().apply(connectReq.Header())
 	for key, value := range p.Metadata {
 		connectReq.Header().Set(key, value)
 	}
+	c.setIdempotencyKey(connectReq.Header(), p)
+	c.setRequestID(connectReq.Header(), p)
 
 	// Make the call with timeout
 	var ctx context.Context
@@ -674,10 +1074,12 @@ func (c *Client) doUnaryRPC(
 	} else {
 		ctx = c.vu.Context()
 	}
+	ctx, result.peer = withPeerInfo(ctx)
+	ctx = withRPCTags(ctx, c.createCallMetricTags(method, p))
 
 	// Record start time
 	requestStart := time.Now()
-	resp, err := dynamicClient.CallUnary(ctx, connectReq)
+	resp, err := call(ctx, connectReq)
 	result.duration = time.Since(requestStart)
 
 	if err != nil {
@@ -686,9 +1088,11 @@ func (c *Client) doUnaryRPC(
 		var connectErr *connect.Error
 		if errors.As(err, &connectErr) {
 			result.connectErr = connectErr
-			result.httpStatus = connectCodeToHTTPStatus(connectErr.Code())
-			result.headers = connectErr.Meta()
-			result.trailers = connectErr.Meta()
+			result.httpStatus = dynamic.HTTPStatus(connectErr.Code())
+			headers, trailers := result.peer.errorMetadata(connectErr)
+			result.headers = p.filterHeaders(headers)
+			result.trailers = p.filterHeaders(trailers)
+			result.server = parseServerMetadata(connectErr.Meta(), nil)
 		} else {
 			// Non-Connect error (network, timeout, etc.)
 			result.httpStatus = 500
@@ -698,8 +1102,9 @@ func (c *Client) doUnaryRPC(
 		return result
 	}
 
-	// Marshal successful response
-	responseJSON, err := protojson.Marshal(resp.Msg)
+	// Marshal successful response, a dynamic message or one of a generated type
+	msg := any(resp.Msg).(proto.Message)
+	responseJSON, err := protojson.Marshal(msg)
 	if err != nil {
 		result.err = fmt.Errorf("failed to marshal dynamic response to JSON: %w", err)
 		result.httpStatus = 500
@@ -707,10 +1112,14 @@ func (c *Client) doUnaryRPC(
 	}
 
 	result.responseJSON = responseJSON
+	result.conversion = c.responseConversion(msg.ProtoReflect().Descriptor())
 	result.respSize = int64(len(responseJSON))
+	result.decompressed = c.decompressedSize(msg, responseJSON)
 	result.httpStatus = 200
-	result.headers = resp.Header()
-	result.trailers = resp.Trailer()
+	result.headers = p.filterHeaders(resp.Header())
+	result.trailers = p.filterHeaders(resp.Trailer())
+	result.server = parseServerMetadata(resp.Header(), resp.Trailer())
+	result.discardMessage = p.DiscardResponseMessage
 
 	return result
 }
@@ -720,6 +1129,7 @@ func (c *Client) doUnaryRPC(
 func (c *Client) convertRPCResultToObject(result *rpcResult) *sobek.Object {
 	rt := c.vu.Runtime()
 	responseObject := rt.NewObject()
+	must(rt, responseObject.Set("duration", metrics.D(result.duration)))
 
 	if result.err != nil {
 		// Handle error case
@@ -747,6 +1157,7 @@ func (c *Client) convertRPCResultToObject(result *rpcResult) *sobek.Object {
 				serializedDetails[i] = serializedDetail
 			}
 			must(rt, errorObj.Set("details", rt.ToValue(serializedDetails)))
+			must(rt, errorObj.Set("raw", rt.ToValue(result.peer.rawError(result.connectErr))))
 
 			must(rt, responseObject.Set("message", errorObj))
 		} else {
@@ -760,47 +1171,63 @@ func (c *Client) convertRPCResultToObject(result *rpcResult) *sobek.Object {
 		}
 
 		must(rt, responseObject.Set("status", rt.ToValue(result.httpStatus)))
-		must(rt, responseObject.Set("headers", rt.ToValue(result.headers)))
-		must(rt, responseObject.Set("trailers", rt.ToValue(result.trailers)))
+		c.setHeaders(rt, responseObject, result.headers, result.trailers)
+		result.server.set(rt, responseObject)
+		result.peer.set(rt, responseObject)
 
 		return responseObject
 	}
 
-	// Success case
-	messageVal, err := rt.RunString("(" + string(result.responseJSON) + ")")
-	if err != nil {
-		// If we can't parse the JSON, create an error response
-		errorObj := rt.NewObject()
-		must(rt, errorObj.Set("message", rt.ToValue(fmt.Sprintf("Failed to parse response JSON: %v", err))))
-
-		must(rt, responseObject.Set("message", errorObj))
-		must(rt, responseObject.Set("status", rt.ToValue(500)))
-		must(rt, responseObject.Set("headers", rt.ToValue(result.headers)))
-		must(rt, responseObject.Set("trailers", rt.ToValue(result.trailers)))
-
-		return responseObject
+	// Success case, the message object is only created when the script accesses it
+	if result.discardMessage {
+		must(rt, responseObject.Set("message", sobek.Null()))
+	} else {
+		must(rt, defineLazyMessage(rt, responseObject, result.responseJSON, result.conversion))
 	}
-
-	must(rt, responseObject.Set("message", messageVal))
 	must(rt, responseObject.Set("status", rt.ToValue(result.httpStatus)))
-	must(rt, responseObject.Set("headers", rt.ToValue(result.headers)))
-	must(rt, responseObject.Set("trailers", rt.ToValue(result.trailers)))
+	c.setHeaders(rt, responseObject, result.headers, result.trailers)
+	result.server.set(rt, responseObject)
+	result.peer.set(rt, responseObject)
 
 	return responseObject
 }
 
-// MethodInfo holds information on any parsed method descriptors that can be used by the Sobek VM
-type MethodInfo struct {
-	Package        string
-	Service        string
-	FullMethod     string
-	IsClientStream bool `json:"isClientStream"`
-	IsServerStream bool `json:"isServerStream"`
+// defineLazyMessage defines the `message` property of a response object, converting
+// the protojson response to a JS value on first access. Most load test scripts only
+// check the status, so skipping the conversion saves event loop time per request.
+// The message is converted following the timeFields and jsonOptions connect parameters.
+func defineLazyMessage(
+	rt *sobek.Runtime, responseObject *sobek.Object, responseJSON []byte, conversion *responseConversion,
+) error {
+	var message sobek.Value
+
+	getter := rt.ToValue(func() sobek.Value {
+		if message != nil {
+			return message
+		}
+
+		var parsed interface{}
+		if err := json.Unmarshal(responseJSON, &parsed); err != nil {
+			common.Throw(rt, fmt.Errorf("failed to parse response JSON: %w", err))
+		}
+		message = rt.ToValue(conversion.apply(rt, parsed))
+		responseJSON = nil
+		return message
+	})
+	setter := rt.ToValue(func(v sobek.Value) {
+		message = v
+		responseJSON = nil
+	})
+
+	return responseObject.DefineAccessorProperty("message", getter, setter, sobek.FLAG_TRUE, sobek.FLAG_TRUE)
 }
 
+// MethodInfo holds information on any parsed method descriptors that can be used by the Sobek VM
+type MethodInfo = dynamic.MethodInfo
+
 // getMethodDescriptor sanitizes and gets ConnectRPC method descriptor or an error if not found
 func (c *Client) getMethodDescriptor(method string) (protoreflect.MethodDescriptor, error) {
-	method = sanitizeMethodName(method)
+	method = dynamic.MethodPath(method)
 
 	if method == "" {
 		return nil, errors.New("method to invoke cannot be empty")
@@ -809,71 +1236,62 @@ func (c *Client) getMethodDescriptor(method string) (protoreflect.MethodDescript
 	return globalProtoRegistry.getMethodDescriptor(method)
 }
 
-// extractMethodInfo extracts service and procedure names from a method path
-func extractMethodInfo(method string) (service, procedure string) {
-	// Method format: "/package.service/procedure" or "/service/procedure"
-	method = strings.TrimPrefix(method, "/")
-	parts := strings.Split(method, "/")
-	if len(parts) >= 2 {
-		service = parts[0]
-		procedure = parts[1]
-	}
-	return service, procedure
-}
-
 // createMetricTags creates standardized tags for metrics
 func (c *Client) createMetricTags(method, protocol, contentType string) MetricTags {
-	service, procedure := extractMethodInfo(method)
-	return MetricTags{
+	service, procedure := dynamic.SplitMethod(method)
+	tags := MetricTags{
 		Method:      method,
 		Service:     service,
 		Procedure:   procedure,
 		Protocol:    protocol,
 		ContentType: contentType,
 	}
+	if c.connectParams != nil {
+		tags.Custom = c.connectParams.Tags
+	}
+	if c.region != "" {
+		custom := make(map[string]string, len(tags.Custom)+1)
+		for k, v := range tags.Custom {
+			custom[k] = v
+		}
+		custom["region"] = c.region
+		tags.Custom = custom
+	}
+	if state := c.vu.State(); state != nil {
+		tags.Origin = originTags(state.Tags.GetCurrentValues().Tags)
+	}
+	return tags
 }
 
-// connectCodeToHTTPStatus converts Connect error codes to HTTP status codes
-// Based on the Connect protocol specification
-func connectCodeToHTTPStatus(code connect.Code) int {
-	switch code {
-	case 0: // OK
-		return 200
-	case connect.CodeCanceled:
-		return 408 // Request Timeout
-	case connect.CodeUnknown:
-		return 500 // Internal Server Error
-	case connect.CodeInvalidArgument:
-		return 400 // Bad Request
-	case connect.CodeDeadlineExceeded:
-		return 504 // Gateway Timeout
-	case connect.CodeNotFound:
-		return 404 // Not Found
-	case connect.CodeAlreadyExists:
-		return 409 // Conflict
-	case connect.CodePermissionDenied:
-		return 403 // Forbidden
-	case connect.CodeResourceExhausted:
-		return 429 // Too Many Requests
-	case connect.CodeFailedPrecondition:
-		return 412 // Precondition Failed
-	case connect.CodeAborted:
-		return 409 // Conflict
-	case connect.CodeOutOfRange:
-		return 400 // Bad Request
-	case connect.CodeUnimplemented:
-		return 501 // Not Implemented
-	case connect.CodeInternal:
-		return 500 // Internal Server Error
-	case connect.CodeUnavailable:
-		return 503 // Service Unavailable
-	case connect.CodeDataLoss:
-		return 500 // Internal Server Error
-	case connect.CodeUnauthenticated:
-		return 401 // Unauthorized
-	default:
-		return 500 // Internal Server Error
+// createUnaryMetricTags creates the tags for a unary call, including the call-level
+// user tags and whether the response callback expects the response
+func (c *Client) createUnaryMetricTags(method string, p *callParams, status int, err error) MetricTags {
+	tags := c.createCallMetricTags(method, p)
+	tags.ExpectedResponse = c.responseCallback(p).expects(status, err)
+	tags.SLO = p.SLO
+	return tags
+}
+
+// createCallMetricTags creates the tags for a unary call, including the call-level user
+// tags and the scenario and group the call was made from, even when it completes later
+func (c *Client) createCallMetricTags(method string, p *callParams) MetricTags {
+	connParams := c.connectParams
+	tags := c.createMetricTags(method, connParams.Protocol, connParams.ContentType)
+	tags.Type = "unary"
+	tags.Origin = originTags(p.TagsAndMeta.Tags)
+	tags.RequestID = p.RequestID
+
+	if len(p.Tags) > 0 {
+		custom := make(map[string]string, len(tags.Custom)+len(p.Tags))
+		for k, v := range tags.Custom {
+			custom[k] = v
+		}
+		for k, v := range p.Tags {
+			custom[k] = v
+		}
+		tags.Custom = custom
 	}
+	return tags
 }
 
 // TLS helper functions (adapted from gRPC extension)
@@ -981,13 +1399,37 @@ type connectionTrackingTransport struct {
 func (t *connectionTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	var handshakeStart time.Time
 	var connectionRecorded bool
+	peer := peerInfoFrom(req.Context())
+	rpcTags := rpcTagsFrom(req.Context())
+
+	// The phase a dial failed in, as traced. The dials can run in their own goroutines.
+	var phaseMu sync.Mutex
+	var failedPhase string
+	failed := func(phase string, err error) {
+		if err == nil {
+			return
+		}
+		phaseMu.Lock()
+		defer phaseMu.Unlock()
+		failedPhase = phase
+	}
 
 	// Add httptrace to detect new connections
 	trace := &httptrace.ClientTrace{
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			failed(connectionPhaseDNS, info.Err)
+		},
 		ConnectStart: func(network, addr string) {
 			handshakeStart = time.Now()
 		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			failed(connectionPhaseTLS, err)
+		},
 		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				failed(connectionPhaseDial, err)
+				return
+			}
 			if !connectionRecorded && t.client.metrics != nil {
 				handshakeDuration := time.Since(handshakeStart)
 				t.client.metrics.recordHTTPConnection(
@@ -996,11 +1438,15 @@ func (t *connectionTrackingTransport) RoundTrip(req *http.Request) (*http.Respon
 					t.baseURL,
 					true, // new connection
 					handshakeDuration,
+					rpcTags,
 				)
 				connectionRecorded = true
 			}
 		},
 		GotConn: func(info httptrace.GotConnInfo) {
+			if peer != nil && info.Conn != nil {
+				peer.setRemoteAddr(info.Conn.RemoteAddr().String())
+			}
 			if !connectionRecorded && t.client.metrics != nil {
 				if info.Reused {
 					// Connection was reused
@@ -1010,6 +1456,7 @@ func (t *connectionTrackingTransport) RoundTrip(req *http.Request) (*http.Respon
 						t.baseURL,
 						false, // reused connection
 						0,
+						rpcTags,
 					)
 					connectionRecorded = true
 				}
@@ -1024,5 +1471,33 @@ func (t *connectionTrackingTransport) RoundTrip(req *http.Request) (*http.Respon
 	ctx := httptrace.WithClientTrace(req.Context(), trace)
 	req = req.WithContext(ctx)
 
-	return t.base.RoundTrip(req)
+	resp, err := t.base.RoundTrip(req)
+	if peer != nil && resp != nil {
+		peer.setResponse(resp)
+	}
+	if err != nil && t.client.metrics != nil {
+		phaseMu.Lock()
+		phase := failedPhase
+		phaseMu.Unlock()
+		if phase == "" {
+			phase = connectionErrorPhase(err)
+		}
+		if phase != "" {
+			t.client.metrics.recordConnectionError(t.client.vu.Context(), t.client.vu, t.baseURL, phase, rpcTags)
+		}
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *connectionTrackingTransport) CloseIdleConnections() {
+	closeIdleConnections(t.base)
+}
+
+// closeIdleConnections closes the idle connections of a transport that supports it, like
+// http.Client does. The shared transports of the global strategy don't.
+func closeIdleConnections(rt http.RoundTripper) {
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
 }
@@ -0,0 +1,112 @@
+package connectrpc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"connectrpc.com/connect"
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const benchPingMethod = "/k6.connectrpc.ping.v1.PingService/Ping"
+
+func benchPingDescriptor(b *testing.B) protoreflect.MethodDescriptor {
+	b.Helper()
+
+	methodDesc := pingv1.File_ping_v1_ping_proto.Services().ByName("PingService").Methods().ByName("Ping")
+	if methodDesc == nil {
+		b.Fatal("PingService/Ping descriptor not found")
+	}
+	return methodDesc
+}
+
+// BenchmarkDynamicClient compares creating the dynamic client on every call,
+// as done before clients were cached, to reusing the cached client
+func BenchmarkDynamicClient(b *testing.B) {
+	server := newTestServer(false)
+	defer server.Close()
+
+	methodDesc := benchPingDescriptor(b)
+	newClient := func() *Client {
+		return &Client{
+			baseURL:            server.URL,
+			httpClient:         server.Client(),
+			connectionStrategy: "per-vu",
+			connectParams:      &connectParams{Protocol: "connect", ContentType: "application/proto"},
+		}
+	}
+
+	b.Run("construct/uncached", func(b *testing.B) {
+		c := newClient()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = connect.NewClient[dynamicpb.Message, dynamicpb.Message](
+				c.httpClient, c.baseURL+benchPingMethod, c.clientOptions(methodDesc)...)
+		}
+	})
+
+	b.Run("construct/cached", func(b *testing.B) {
+		c := newClient()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = c.dynamicClient(c.httpClient, benchPingMethod, methodDesc)
+		}
+	})
+
+	call := func(b *testing.B, dynamicClient *connect.Client[dynamicpb.Message, dynamicpb.Message]) {
+		b.Helper()
+
+		req := dynamicpb.NewMessage(methodDesc.Input())
+		req.Set(methodDesc.Input().Fields().ByName("number"), protoreflect.ValueOfInt64(42))
+		if _, err := dynamicClient.CallUnary(context.Background(), connect.NewRequest(req)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("call/uncached", func(b *testing.B) {
+		c := newClient()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			call(b, connect.NewClient[dynamicpb.Message, dynamicpb.Message](
+				c.httpClient, c.baseURL+benchPingMethod, c.clientOptions(methodDesc)...))
+		}
+	})
+
+	b.Run("call/cached", func(b *testing.B) {
+		c := newClient()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			call(b, c.dynamicClient(c.httpClient, benchPingMethod, methodDesc))
+		}
+	})
+}
+
+func TestDynamicClientCache(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(false)
+	defer server.Close()
+
+	methodDesc := pingv1.File_ping_v1_ping_proto.Services().ByName("PingService").Methods().ByName("Ping")
+	c := &Client{
+		baseURL:            server.URL,
+		httpClient:         server.Client(),
+		connectionStrategy: "per-vu",
+		connectParams:      &connectParams{Protocol: "connect", ContentType: "application/proto"},
+	}
+
+	first := c.dynamicClient(c.httpClient, benchPingMethod, methodDesc)
+	assert.Same(t, first, c.dynamicClient(c.httpClient, benchPingMethod, methodDesc))
+
+	// A new HTTP client, e.g. on reconnect or per-iteration, invalidates the cache
+	assert.NotSame(t, first, c.dynamicClient(&http.Client{}, benchPingMethod, methodDesc))
+
+	c.connectionStrategy = "per-call"
+	assert.NotSame(t,
+		c.dynamicClient(c.httpClient, benchPingMethod, methodDesc),
+		c.dynamicClient(c.httpClient, benchPingMethod, methodDesc))
+}
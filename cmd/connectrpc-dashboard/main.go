@@ -0,0 +1,218 @@
+// Command connectrpc-dashboard generates the Grafana dashboard of the xk6-connectrpc metrics,
+// as the k6 Prometheus remote write output exports them, from the metric definitions of the
+// extension. The generated dashboard is dashboards/connectrpc.json:
+//
+//	go run ./cmd/connectrpc-dashboard -o dashboards/connectrpc.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/bumberboy/xk6-connectrpc"
+)
+
+// dashboardConfig sets the names of the exported metrics
+type dashboardConfig struct {
+	metricPrefix string // metricPrefix global option of the extension
+	outputPrefix string // Prefix of the metric names added by the output, k6_ for Prometheus remote write
+	trendStat    string // Trend stat of the trend panels, p99 for the default K6_PROMETHEUS_RW_TREND_STATS
+}
+
+func main() {
+	var config dashboardConfig
+	output := flag.String("o", "", "file to write the dashboard to, the standard output if not set")
+	flag.StringVar(&config.metricPrefix, "prefix", "", "metricPrefix of the extension")
+	flag.StringVar(&config.outputPrefix, "output-prefix", "k6_", "prefix of the metric names added by the k6 output")
+	flag.StringVar(&config.trendStat, "trend-stat", "p99", "trend stat to chart, as exported by K6_PROMETHEUS_RW_TREND_STATS")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	if err := writeDashboard(&buf, config); err != nil {
+		log.Fatal(err)
+	}
+
+	if *output == "" {
+		_, _ = os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil { //nolint:gosec
+		log.Fatal(err)
+	}
+}
+
+// writeDashboard writes the dashboard as indented JSON
+func writeDashboard(w io.Writer, config dashboardConfig) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newDashboard(config, connectrpc.MetricDefinitions(config.metricPrefix)))
+}
+
+type panel struct {
+	ID          int               `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title"`
+	Description string            `json:"description,omitempty"`
+	Datasource  map[string]string `json:"datasource,omitempty"`
+	GridPos     map[string]int    `json:"gridPos"`
+	FieldConfig map[string]any    `json:"fieldConfig,omitempty"`
+	Targets     []map[string]any  `json:"targets,omitempty"`
+	Collapsed   *bool             `json:"collapsed,omitempty"`
+}
+
+// datasource is the Prometheus datasource chosen in the dashboard variables
+var datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+
+// newDashboard returns a dashboard with a row of panels per group of metrics
+func newDashboard(config dashboardConfig, definitions []connectrpc.MetricDefinition) map[string]any {
+	var panels []panel
+	id, y := 1, 0
+	row := ""
+	col := 0
+
+	for _, d := range definitions {
+		if group := metricGroup(d); group != row {
+			row = group
+			if col != 0 {
+				y += 8
+			}
+			collapsed := false
+			panels = append(panels, panel{
+				ID: id, Type: "row", Title: row, Collapsed: &collapsed,
+				GridPos: map[string]int{"h": 1, "w": 24, "x": 0, "y": y},
+			})
+			id++
+			y++
+			col = 0
+		}
+
+		panels = append(panels, newPanel(id, config, d, map[string]int{"h": 8, "w": 12, "x": col * 12, "y": y}))
+		id++
+		if col == 1 {
+			y += 8
+		}
+		col = (col + 1) % 2
+	}
+
+	return map[string]any{
+		"title":         "xk6-connectrpc",
+		"uid":           "xk6-connectrpc",
+		"description":   "ConnectRPC calls of k6 tests, exported with the Prometheus remote write output",
+		"tags":          []string{"k6", "connectrpc"},
+		"editable":      true,
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": "now-1h", "to": "now"},
+		"refresh":       "10s",
+		"panels":        panels,
+		"templating": map[string]any{
+			"list": []map[string]any{
+				{
+					"name":  "datasource",
+					"label": "Data source",
+					"type":  "datasource",
+					"query": "prometheus",
+				},
+				{
+					"name":       "method",
+					"label":      "Method",
+					"type":       "query",
+					"datasource": datasource,
+					"query":      fmt.Sprintf("label_values(%s, method)", seriesName(config, definitions[0], "total")),
+					"refresh":    2,
+					"multi":      true,
+					"includeAll": true,
+					"allValue":   ".*",
+					"current":    map[string]any{"text": "All", "value": "$__all"},
+				},
+				{
+					"name":       "scenario",
+					"label":      "Scenario",
+					"type":       "query",
+					"datasource": datasource,
+					"query":      fmt.Sprintf("label_values(%s, scenario)", seriesName(config, definitions[0], "total")),
+					"refresh":    2,
+					"multi":      true,
+					"includeAll": true,
+					"allValue":   ".*",
+					"current":    map[string]any{"text": "All", "value": "$__all"},
+				},
+			},
+		},
+	}
+}
+
+// metricGroup returns the row of a metric: calls, connections or the rest
+func metricGroup(d connectrpc.MetricDefinition) string {
+	switch {
+	case slices.Contains(d.Tags, "method"):
+		return "Calls"
+	case slices.Contains(d.Tags, "url"):
+		return "Connections"
+	default:
+		return "Other"
+	}
+}
+
+// newPanel returns the time series panel of a metric: rates for counters, the values of gauges,
+// the trend stat for trends
+func newPanel(id int, config dashboardConfig, d connectrpc.MetricDefinition, gridPos map[string]int) panel {
+	by := d.Tags[0]
+	// Series without a scenario tag, when its system tag is disabled, match the "All" value
+	selector := `{scenario=~"$scenario"}`
+	if slices.Contains(d.Tags, "method") {
+		selector = `{method=~"$method", scenario=~"$scenario"}`
+	}
+
+	var expr, unit, title string
+	switch d.Type {
+	case "counter":
+		expr = fmt.Sprintf("sum by (%s) (rate(%s%s[$__rate_interval]))", by, seriesName(config, d, "total"), selector)
+		unit = "ops"
+		title = d.Name + " (rate)"
+	case "gauge":
+		expr = fmt.Sprintf("max by (%s) (%s%s)", by, seriesName(config, d, ""), selector)
+		unit = "none"
+		title = d.Name
+	default:
+		expr = fmt.Sprintf("max by (%s) (%s%s)", by, seriesName(config, d, config.trendStat), selector)
+		unit = map[string]string{"time": "s", "data": "bytes"}[d.Contains]
+		if unit == "" {
+			unit = "none"
+		}
+		title = d.Name + " (" + config.trendStat + ")"
+	}
+
+	return panel{
+		ID:          id,
+		Type:        "timeseries",
+		Title:       title,
+		Description: d.Description,
+		Datasource:  datasource,
+		GridPos:     gridPos,
+		FieldConfig: map[string]any{
+			"defaults":  map[string]any{"unit": unit},
+			"overrides": []any{},
+		},
+		Targets: []map[string]any{{
+			"refId":        "A",
+			"datasource":   datasource,
+			"expr":         expr,
+			"legendFormat": "{{" + by + "}}",
+		}},
+	}
+}
+
+// seriesName returns the name of the Prometheus series of a metric, with the suffix of the output.
+// Gauges have no suffix.
+func seriesName(config dashboardConfig, d connectrpc.MetricDefinition, suffix string) string {
+	if suffix == "" {
+		return config.outputPrefix + d.Name
+	}
+	return config.outputPrefix + d.Name + "_" + suffix
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDashboardUpToDate tests that dashboards/connectrpc.json was regenerated with go generate
+func TestDashboardUpToDate(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, writeDashboard(&buf, dashboardConfig{outputPrefix: "k6_", trendStat: "p99"}))
+
+	committed, err := os.ReadFile("../../dashboards/connectrpc.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(committed), buf.String(), "run go generate to update dashboards/connectrpc.json")
+}
+
+func TestDashboardPrefixes(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, writeDashboard(&buf, dashboardConfig{metricPrefix: "payments_", outputPrefix: "k6_", trendStat: "p95"}))
+
+	assert.Contains(t, buf.String(), `rate(k6_payments_connectrpc_reqs_total{method=~\"$method\", scenario=~\"$scenario\"}[$__rate_interval])`)
+	assert.Contains(t, buf.String(), `max by (method) (k6_payments_connectrpc_req_duration_p95{method=~\"$method\", scenario=~\"$scenario\"})`)
+	assert.Contains(t, buf.String(), `max by (url) (k6_payments_connectrpc_connection_duration_p95{scenario=~\"$scenario\"})`)
+	assert.Contains(t, buf.String(), `max by (scope) (k6_payments_connectrpc_active_streams{scenario=~\"$scenario\"})`)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// echoProto is the path of the EchoService proto, relative to the protos directory
+const echoProto = "echo/v1/echo.proto"
+
+//go:embed protos
+var protos embed.FS
+
+// echoService serves the EchoService with dynamic messages, so it needs no generated code
+type echoService struct {
+	service  protoreflect.ServiceDescriptor
+	request  protoreflect.MessageDescriptor
+	response protoreflect.MessageDescriptor
+}
+
+// newEchoService compiles the embedded EchoService proto
+func newEchoService(ctx context.Context) (*echoService, error) {
+	root, err := fs.Sub(protos, "protos")
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := &protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: func(path string) (io.ReadCloser, error) {
+				return root.Open(path)
+			},
+		},
+	}
+	files, err := compiler.Compile(ctx, echoProto)
+	if err != nil {
+		return nil, err
+	}
+
+	service := files[0].Services().Get(0)
+	method := service.Methods().ByName("Echo")
+	return &echoService{
+		service:  service,
+		request:  method.Input(),
+		response: method.Output(),
+	}, nil
+}
+
+// register adds the EchoService handlers to a mux
+func (e *echoService) register(mux *http.ServeMux) {
+	mux.Handle(e.procedure("Echo"), connect.NewUnaryHandler(e.procedure("Echo"), e.echo, e.options("Echo")...))
+	mux.Handle(e.procedure("EchoClientStream"), connect.NewClientStreamHandler(
+		e.procedure("EchoClientStream"), e.echoClientStream, e.options("EchoClientStream")...))
+	mux.Handle(e.procedure("EchoServerStream"), connect.NewServerStreamHandler(
+		e.procedure("EchoServerStream"), e.echoServerStream, e.options("EchoServerStream")...))
+	mux.Handle(e.procedure("EchoBidi"), connect.NewBidiStreamHandler(
+		e.procedure("EchoBidi"), e.echoBidi, e.options("EchoBidi")...))
+}
+
+func (e *echoService) procedure(method string) string {
+	return "/" + string(e.service.FullName()) + "/" + method
+}
+
+// options sets the schema of a method, and initializes its requests as dynamic messages
+func (e *echoService) options(method string) []connect.HandlerOption {
+	return []connect.HandlerOption{
+		connect.WithSchema(e.service.Methods().ByName(protoreflect.Name(method))),
+		connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(e.request)
+			return nil
+		}),
+	}
+}
+
+// echoCounter counts the requests of a call, and builds its responses
+type echoCounter struct {
+	e        *echoService
+	bytes    int64
+	messages int64
+}
+
+// receive counts a request, and returns the response to it
+func (c *echoCounter) receive(req *dynamicpb.Message) *dynamicpb.Message {
+	fields := c.e.request.Fields()
+	payload := req.Get(fields.ByName("payload")).Bytes()
+	c.bytes += int64(len(payload))
+	c.messages++
+
+	if size := req.Get(fields.ByName("response_size")).Int(); size > 0 {
+		payload = bytes.Repeat([]byte{'x'}, int(size))
+	}
+
+	fields = c.e.response.Fields()
+	resp := dynamicpb.NewMessage(c.e.response)
+	resp.Set(fields.ByName("payload"), protoreflect.ValueOfBytes(payload))
+	resp.Set(fields.ByName("received_bytes"), protoreflect.ValueOfInt64(c.bytes))
+	resp.Set(fields.ByName("received_messages"), protoreflect.ValueOfInt64(c.messages))
+	return resp
+}
+
+func (e *echoService) echo(
+	_ context.Context,
+	req *connect.Request[dynamicpb.Message],
+) (*connect.Response[dynamicpb.Message], error) {
+	counter := &echoCounter{e: e}
+	return connect.NewResponse(counter.receive(req.Msg)), nil
+}
+
+func (e *echoService) echoClientStream(
+	_ context.Context,
+	stream *connect.ClientStream[dynamicpb.Message],
+) (*connect.Response[dynamicpb.Message], error) {
+	counter := &echoCounter{e: e}
+	resp := dynamicpb.NewMessage(e.response)
+	for stream.Receive() {
+		resp = counter.receive(stream.Msg())
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(resp), nil
+}
+
+func (e *echoService) echoServerStream(
+	_ context.Context,
+	req *connect.Request[dynamicpb.Message],
+	stream *connect.ServerStream[dynamicpb.Message],
+) error {
+	count := req.Msg.Get(e.request.Fields().ByName("count")).Int()
+	if count < 0 {
+		return connect.NewError(connect.CodeInvalidArgument, errors.New("count must not be negative"))
+	}
+
+	counter := &echoCounter{e: e}
+	resp := counter.receive(req.Msg)
+	for i := int64(0); i < max(count, 1); i++ {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *echoService) echoBidi(
+	_ context.Context,
+	stream *connect.BidiStream[dynamicpb.Message, dynamicpb.Message],
+) error {
+	counter := &echoCounter{e: e}
+	for {
+		req, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := stream.Send(counter.receive(req)); err != nil {
+			return err
+		}
+	}
+}
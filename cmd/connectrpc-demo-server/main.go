@@ -0,0 +1,147 @@
+// Command connectrpc-demo-server serves the PingService of the xk6-connectrpc tests and an
+// EchoService with bytes payloads, over the connect, grpc and grpc-web protocols, both in
+// plaintext (HTTP/1.1 and h2c) and with TLS (HTTP/1.1 and HTTP/2). It gives the examples
+// and smoke tests a real target without writing Go.
+//
+// Scripts load testdata/ping/v1/ping.proto, or echo/v1/echo.proto with the
+// cmd/connectrpc-demo-server/protos import path.
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"flag"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// pingPath is the path of the PingService handlers
+const pingPath = "/k6.connectrpc.ping.v1.PingService/"
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "plaintext address to listen on, empty to disable")
+	tlsAddr := flag.String("tls-addr", "localhost:8443", "TLS address to listen on, empty to disable")
+	certFile := flag.String("cert", "", "TLS certificate file, a self-signed certificate if not set")
+	keyFile := flag.String("key", "", "TLS key file")
+	checkMetadata := flag.Bool("check-metadata", false, "require the client-header: some-value header on the PingService")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	handler, err := newHandler(ctx, *checkMetadata)
+	if err != nil {
+		log.Fatalf("failed to create the handlers: %v", err)
+	}
+
+	var servers []*http.Server
+	errs := make(chan error, 2)
+
+	if *addr != "" {
+		server := &http.Server{
+			Addr:              *addr,
+			Handler:           h2c.NewHandler(handler, &http2.Server{}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, server)
+
+		log.Printf("serving plaintext on http://%s", *addr)
+		go func() { errs <- server.ListenAndServe() }()
+	}
+
+	if *tlsAddr != "" {
+		tlsConfig, err := newTLSConfig(*certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("failed to load the TLS certificate: %v", err)
+		}
+		server := &http.Server{
+			Addr:              *tlsAddr,
+			Handler:           handler,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, server)
+
+		log.Printf("serving TLS on https://%s", *tlsAddr)
+		go func() { errs <- server.ListenAndServeTLS("", "") }()
+	}
+
+	if len(servers) == 0 {
+		log.Fatal("nothing to serve: both -addr and -tls-addr are empty")
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.Shutdown(shutdownCtx)
+	}
+}
+
+// newHandler returns the handler of the PingService and EchoService
+func newHandler(ctx context.Context, checkMetadata bool) (http.Handler, error) {
+	echo, err := newEchoService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(pingPath, connectrpc.NewTestHandler(checkMetadata))
+	echo.register(mux)
+	return mux, nil
+}
+
+// newTLSConfig loads a certificate, or generates a self-signed one for localhost
+func newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"xk6-connectrpc demo server"}},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
+	"github.com/bumberboy/xk6-connectrpc/testdata/ping/v1/pingv1connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestEchoService(t *testing.T) {
+	t.Parallel()
+
+	handler, err := newHandler(context.Background(), false)
+	require.NoError(t, err)
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
+
+	echo, err := newEchoService(context.Background())
+	require.NoError(t, err)
+
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP:      true,
+		DialTLSContext: h2cDial,
+	}}
+
+	protocols := map[string]connect.ClientOption{
+		"connect":  connect.WithProtoJSON(),
+		"grpc":     connect.WithGRPC(),
+		"grpc-web": connect.WithGRPCWeb(),
+	}
+	for name, protocol := range protocols {
+		protocol := protocol
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			bidi := newEchoClient(echo, h2cClient, srv.URL, "EchoBidi", protocol).CallBidiStream(context.Background())
+			for _, size := range []int64{3, 1024} {
+				req := echo.newRequest("abc", size)
+				require.NoError(t, bidi.Send(req))
+
+				resp, err := bidi.Receive()
+				require.NoError(t, err)
+				assert.Len(t, resp.Get(echo.response.Fields().ByName("payload")).Bytes(), int(size))
+			}
+			require.NoError(t, bidi.CloseRequest())
+
+			resp, err := bidi.Receive()
+			assert.Nil(t, resp)
+			assert.Error(t, err)
+			require.NoError(t, bidi.CloseResponse())
+
+			serverStream, err := newEchoClient(echo, h2cClient, srv.URL, "EchoServerStream", protocol).
+				CallServerStream(context.Background(), connect.NewRequest(echo.newRequest("abc", 0)))
+			require.NoError(t, err)
+			var received int
+			for serverStream.Receive() {
+				received++
+				assert.Equal(t, "abc", string(serverStream.Msg().Get(echo.response.Fields().ByName("payload")).Bytes()))
+			}
+			require.NoError(t, serverStream.Err())
+			assert.Equal(t, 1, received)
+		})
+	}
+}
+
+func TestPingServiceTLS(t *testing.T) {
+	t.Parallel()
+
+	handler, err := newHandler(context.Background(), false)
+	require.NoError(t, err)
+
+	tlsConfig, err := newTLSConfig("", "")
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := pingv1connect.NewPingServiceClient(&http.Client{Transport: &http2.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+	}}, srv.URL, connect.WithGRPC())
+
+	resp, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), resp.Msg.GetNumber())
+}
+
+// newRequest returns an EchoRequest, with a response size if size is positive
+func (e *echoService) newRequest(payload string, size int64) *dynamicpb.Message {
+	fields := e.request.Fields()
+	req := dynamicpb.NewMessage(e.request)
+	req.Set(fields.ByName("payload"), protoreflect.ValueOfBytes([]byte(payload)))
+	req.Set(fields.ByName("response_size"), protoreflect.ValueOfInt32(int32(size)))
+	return req
+}
+
+func newEchoClient(
+	e *echoService, httpClient *http.Client, url, method string, protocol connect.ClientOption,
+) *connect.Client[dynamicpb.Message, dynamicpb.Message] {
+	return connect.NewClient[dynamicpb.Message, dynamicpb.Message](httpClient, url+e.procedure(method),
+		protocol,
+		connect.WithSchema(e.service.Methods().ByName(protoreflect.Name(method))),
+		connect.WithResponseInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(e.response)
+			return nil
+		}),
+	)
+}
+
+// h2cDial dials in plaintext, for HTTP/2 with prior knowledge
+func h2cDial(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,98 @@
+// Command connectrpc-record is a proxy recording the Connect, gRPC and gRPC-Web calls of a
+// manual session against a server, and writing them as a starter k6 script of
+// xk6-connectrpc when it is interrupted:
+//
+//	connectrpc-record -target https://api.example.com -reflection -out recorded
+//
+// The application under test is pointed at the proxy address, over HTTP/1.1 or h2c. The
+// request messages are decoded with the -proto files, or the server reflection of the
+// target with -reflection, and the script replays them with their descriptors.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	target := flag.String("target", "", "URL of the server to record the calls of, like https://api.example.com")
+	out := flag.String("out", "recorded", "directory to write the script, payloads and descriptors to")
+	importPaths := flag.String("import-path", ".", "comma-separated import paths of the -proto files")
+	protos := flag.String("proto", "", "comma-separated proto files defining the methods")
+	protoset := flag.String("protoset", "", "protoset file defining the methods")
+	reflection := flag.Bool("reflection", false, "request the missing descriptors from the server reflection of the target")
+	insecure := flag.Bool("insecure", false, "skip the TLS verification of an https target")
+	flag.Parse()
+
+	if *target == "" {
+		log.Fatal("-target is required")
+	}
+
+	registry := dynamic.NewRegistry()
+	if *protos != "" {
+		if _, err := registry.LoadProtos(context.Background(), strings.Split(*importPaths, ","), nil, strings.Split(*protos, ",")...); err != nil {
+			log.Fatalf("failed to load the protos: %v", err)
+		}
+	}
+	if *protoset != "" {
+		data, err := os.ReadFile(*protoset)
+		if err != nil {
+			log.Fatalf("failed to read the protoset: %v", err)
+		}
+		if _, err := registry.LoadProtoset(data); err != nil {
+			log.Fatalf("failed to load the protoset: %v", err)
+		}
+	}
+
+	opts := []connectrpc.RecorderOption{connectrpc.WithRecorderRegistry(registry)}
+	if *reflection {
+		opts = append(opts, connectrpc.WithReflection())
+	}
+	if *insecure {
+		opts = append(opts, connectrpc.WithRecorderTLSConfig(&tls.Config{InsecureSkipVerify: true})) //nolint:gosec
+	}
+	recorder, err := connectrpc.NewRecorder(*target, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           h2c.NewHandler(recorder, &http2.Server{}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("recording the calls to %s on http://%s, interrupt to write the script", *target, *addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = server.Shutdown(ctx)
+
+	if err := recorder.WriteScript(*out); err != nil {
+		log.Fatalf("failed to write the script: %v", err)
+	}
+	log.Printf("wrote %d calls to %s/script.js", len(recorder.Calls()), *out)
+}
@@ -0,0 +1,67 @@
+// Command connectrpc-server runs the PingService test server of xk6-connectrpc on a chosen
+// address, with optional latency, error and connection failure injection, to develop
+// scenarios offline.
+//
+// Scripts load testdata/ping/v1/ping.proto and connect with plaintext: true.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	checkMetadata := flag.Bool("check-metadata", false, "require the client-header: some-value header")
+	latency := flag.Duration("latency", 0, "delay of each call, or its minimum with -latency-max")
+	latencyMax := flag.Duration("latency-max", 0, "maximum delay of each call, drawn uniformly from -latency")
+	errorRate := flag.Float64("error-rate", 0, "percentage of the calls failing, from 0 to 100")
+	errorCode := flag.String("error-code", "unavailable", "code of the failing calls, like unavailable or internal")
+	responseSize := flag.Int("response-size", 0, "minimum size of the Ping response text, in bytes")
+	goAwayAfter := flag.Int("goaway-after", 0, "requests of each connection before draining it with a GOAWAY")
+	closeAfter := flag.Int("close-after", 0, "requests of each connection before closing it abruptly")
+	flag.Parse()
+
+	var code connect.Code
+	if err := code.UnmarshalText([]byte(*errorCode)); err != nil {
+		log.Fatalf("invalid -error-code: %v", err)
+	}
+
+	var opts []connectrpc.TestServerOption
+	switch {
+	case *latencyMax > 0:
+		opts = append(opts, connectrpc.WithLatency(connectrpc.UniformLatency(*latency, *latencyMax)))
+	case *latency > 0:
+		opts = append(opts, connectrpc.WithLatency(connectrpc.FixedLatency(*latency)))
+	}
+	if *errorRate > 0 {
+		opts = append(opts, connectrpc.WithErrorRate(*errorRate, code))
+	}
+	if *responseSize > 0 {
+		opts = append(opts, connectrpc.WithResponseSize(*responseSize))
+	}
+	if *goAwayAfter > 0 {
+		opts = append(opts, connectrpc.WithGoAwayAfter(*goAwayAfter))
+	}
+	if *closeAfter > 0 {
+		opts = append(opts, connectrpc.WithCloseAfter(*closeAfter))
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           connectrpc.NewTestHandler(*checkMetadata, opts...),
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext:       connectrpc.TestConnContext,
+	}
+
+	log.Printf("serving k6.connectrpc.ping.v1.PingService on http://%s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,86 @@
+package connectrpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"connectrpc.com/connect"
+)
+
+// builtinCodecs are the names of the codecs of connect-go, which can't be replaced
+var builtinCodecs = map[string]bool{"proto": true, "protobuf": true, "json": true}
+
+// codecs holds the codecs registered by other extensions and custom builds, by name
+var codecs = struct {
+	sync.RWMutex
+	codecs map[string]connect.Codec
+}{codecs: make(map[string]connect.Codec)}
+
+// RegisterCodec registers a connect.Codec that scripts select with the `contentType`
+// connect parameter, application/ followed by the name of the codec: application/vtproto
+// for a codec named vtproto. It enables faster marshaling paths, like vtprotobuf for the
+// messages generated into the binary, or the proprietary codecs of internal services. It
+// is meant to be called from the init function of an extension, and panics if the name is
+// empty, already registered or one of the codecs of connect-go, like modules.Register.
+//
+// The codec marshals the requests and unmarshals the responses of the calls and streams,
+// which are *dynamicpb.Message built from the loaded protos. The mock servers and mock://
+// addresses accept the registered codecs too.
+func RegisterCodec(codec connect.Codec) {
+	if codec == nil || codec.Name() == "" {
+		panic("connectrpc: RegisterCodec requires a codec with a name")
+	}
+	name := codec.Name()
+	if builtinCodecs[name] {
+		panic(fmt.Sprintf("connectrpc: codec %q is built in", name))
+	}
+
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	if _, ok := codecs.codecs[name]; ok {
+		panic(fmt.Sprintf("connectrpc: codec %q is already registered", name))
+	}
+	codecs.codecs[name] = codec
+}
+
+// registeredCodec returns the registered codec of a content type, nil for the built-in ones
+func registeredCodec(contentType string) connect.Codec {
+	name, ok := strings.CutPrefix(contentType, "application/")
+	if !ok {
+		return nil
+	}
+
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	return codecs.codecs[name]
+}
+
+// registeredContentTypes returns the content types of the registered codecs, sorted
+func registeredContentTypes() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	contentTypes := make([]string, 0, len(codecs.codecs))
+	for name := range codecs.codecs {
+		contentTypes = append(contentTypes, "application/"+name)
+	}
+	sort.Strings(contentTypes)
+	return contentTypes
+}
+
+// codecHandlerOptions returns the handler options accepting the registered codecs, for the
+// mock servers
+func codecHandlerOptions() []connect.HandlerOption {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	options := make([]connect.HandlerOption, 0, len(codecs.codecs))
+	for _, codec := range codecs.codecs {
+		options = append(options, connect.WithCodec(codec))
+	}
+	return options
+}
@@ -0,0 +1,93 @@
+package connectrpc_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// countingCodec is the protobuf codec of the 'x-counting-proto' content type, counting the
+// messages it marshals and unmarshals
+type countingCodec struct {
+	marshaled, unmarshaled atomic.Int64
+}
+
+var testCodec = &countingCodec{}
+
+func (c *countingCodec) Name() string {
+	return "x-counting-proto"
+}
+
+func (c *countingCodec) Marshal(msg any) ([]byte, error) {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", msg)
+	}
+	c.marshaled.Add(1)
+	return proto.Marshal(protoMsg)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, msg any) error {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", msg)
+	}
+	c.unmarshaled.Add(1)
+	return proto.Unmarshal(data, protoMsg)
+}
+
+func init() {
+	connectrpc.RegisterCodec(testCodec)
+}
+
+func TestRegisteredCodec(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var server = connectrpc.mockServer(0, {
+			rules: { '/k6.connectrpc.ping.v1.PingService/Ping': { response: { text: 'pong' } } },
+		});
+		var client = new connectrpc.Client();
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	marshaled, unmarshaled := testCodec.marshaled.Load(), testCodec.unmarshaled.Load()
+	val, err := ts.Run(`
+		client.connect(server.url, { plaintext: true, contentType: 'application/x-counting-proto' });
+		var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { text: 'ping' });
+		client.close();
+		server.close();
+		response.status + ' ' + response.message.text;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "200 pong", val.String())
+
+	// Both the client and the mock server use the codec
+	assert.Equal(t, int64(2), testCodec.marshaled.Load()-marshaled)
+	assert.Equal(t, int64(2), testCodec.unmarshaled.Load()-unmarshaled)
+
+	_, err = ts.Run(`new connectrpc.Client().connect(server.url, { plaintext: true, contentType: 'application/xml' })`)
+	require.ErrorContains(t, err, "invalid contentType: application/xml. Must be 'application/json', "+
+		"'application/proto', 'application/protobuf', or the one of a registered codec: 'application/x-counting-proto'")
+}
+
+func TestRegisterCodecInvalid(t *testing.T) {
+	t.Parallel()
+
+	assert.PanicsWithValue(t, `connectrpc: codec "x-counting-proto" is already registered`, func() {
+		connectrpc.RegisterCodec(testCodec)
+	})
+	assert.PanicsWithValue(t, "connectrpc: RegisterCodec requires a codec with a name", func() {
+		connectrpc.RegisterCodec(nil)
+	})
+}
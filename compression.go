@@ -0,0 +1,237 @@
+package connectrpc
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/sobek"
+	"github.com/klauspost/compress/zstd"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/metrics"
+	"google.golang.org/protobuf/proto"
+)
+
+// Compressions of the responses, see `acceptCompression`
+const (
+	compressionGzip     = "gzip"
+	compressionZstd     = "zstd"
+	compressionIdentity = "identity"
+)
+
+// decompressors create the decompressors of the supported response compressions
+var decompressors = map[string]func() connect.Decompressor{
+	compressionGzip: func() connect.Decompressor { return &gzip.Reader{} },
+	compressionZstd: newZstdDecompressor,
+}
+
+// compressors create the compressors paired with the decompressors, which connect-go
+// registers together
+var compressors = map[string]func() connect.Compressor{
+	compressionGzip: func() connect.Compressor { return gzip.NewWriter(nil) },
+	compressionZstd: newZstdCompressor,
+}
+
+// zstdDecompressor is a zstd decoder reused by the pool of connect-go: Close leaves the
+// decoder usable, as Reset gives it its next source
+type zstdDecompressor struct {
+	*zstd.Decoder
+}
+
+func newZstdDecompressor() connect.Decompressor {
+	// Decode synchronously as the calls read the responses, without goroutines of its own
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		panic(err) // Only invalid options fail
+	}
+	return &zstdDecompressor{Decoder: decoder}
+}
+
+func (d *zstdDecompressor) Close() error {
+	return nil
+}
+
+func newZstdCompressor() connect.Compressor {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err) // Only invalid options fail
+	}
+	return encoder
+}
+
+// parseAcceptCompression parses the `acceptCompression` connect parameter, the compressions
+// the server may use for its responses, most preferred first
+func parseAcceptCompression(v sobek.Value) ([]string, error) {
+	if common.IsNullish(v) {
+		return nil, nil
+	}
+	values, ok := v.Export().([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an array like ['%s', '%s']", compressionZstd, compressionGzip)
+	}
+
+	accepted := make([]string, 0, len(values))
+	for _, value := range values {
+		name, _ := value.(string)
+		if decompressors[name] == nil {
+			return nil, fmt.Errorf("unknown compression %v, must be '%s' or '%s'", value, compressionGzip, compressionZstd)
+		}
+		accepted = append(accepted, name)
+	}
+	return accepted, nil
+}
+
+// compressionOptions returns the connect client options accepting the compressions of
+// acceptCompression, nil for the gzip accepted by default. connect-go prefers the last
+// compression registered, so they are registered in reverse.
+func (p *connectParams) compressionOptions() []connect.ClientOption {
+	if p.AcceptCompression == nil {
+		return nil
+	}
+
+	// Unregister the gzip accepted by default, whether it is accepted or not
+	options := []connect.ClientOption{connect.WithAcceptCompression(compressionGzip, nil, nil)}
+	for i := len(p.AcceptCompression) - 1; i >= 0; i-- {
+		name := p.AcceptCompression[i]
+		options = append(options, connect.WithAcceptCompression(name, decompressors[name], compressors[name]))
+	}
+	return options
+}
+
+// responseEncoding returns the compression of a response: the Content-Encoding of Connect
+// unary responses, or the per-message encoding of the streaming and gRPC protocols
+func responseEncoding(header http.Header) string {
+	for _, key := range []string{"Grpc-Encoding", "Connect-Content-Encoding", "Content-Encoding"} {
+		if encoding := header.Get(key); encoding != "" {
+			return encoding
+		}
+	}
+	return compressionIdentity
+}
+
+// wireCounter counts the bytes of the response messages as received, compressed or not:
+// the whole body of a Connect unary response, or the payloads of the message envelopes
+type wireCounter struct {
+	io.ReadCloser
+	size      *atomic.Int64
+	enveloped bool
+	endFlag   byte // Flag of the envelopes ending the stream, which are not messages
+	envelopeScanner
+}
+
+func (w *wireCounter) Read(p []byte) (int, error) {
+	n, err := w.ReadCloser.Read(p)
+	if !w.enveloped {
+		w.size.Add(int64(n))
+		return n, err
+	}
+
+	w.scan(p[:n], func(flags byte, payload []byte) {
+		if flags&w.endFlag == 0 {
+			w.size.Add(int64(len(payload)))
+		}
+	})
+	return n, err
+}
+
+// countWireSize wraps the body of a successful response to count the size of its messages
+// on the wire. The base64 bodies of gRPC-Web text responses are not counted.
+func (p *peerInfo) countWireSize(resp *http.Response) {
+	if resp.Body == nil || resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	counter := &wireCounter{ReadCloser: resp.Body, size: &p.wireSize}
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web-text"):
+		return
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		counter.enveloped, counter.endFlag = true, grpcWebFlagTrailer
+	case strings.HasPrefix(contentType, "application/grpc"):
+		counter.enveloped = true
+	case strings.HasPrefix(contentType, "application/connect+"):
+		counter.enveloped, counter.endFlag = true, connectFlagEndStream
+	}
+	resp.Body = counter
+	p.wireCounted = true
+}
+
+// responseWireSize returns the compression of the response and the size of its messages on the
+// wire, or false if they were not counted
+func (p *peerInfo) responseWireSize() (string, int64, bool) {
+	if p == nil {
+		return "", 0, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.wireCounted {
+		return "", 0, false
+	}
+	return responseEncoding(p.resp.Header), p.wireSize.Load(), true
+}
+
+// decompressedSize returns the size of a response message without compression, in the
+// content type of the connection
+func (c *Client) decompressedSize(msg proto.Message, responseJSON []byte) int64 {
+	if c.connectParams != nil && c.connectParams.ContentType == "application/json" {
+		return int64(len(responseJSON))
+	}
+	return int64(proto.Size(msg))
+}
+
+// recordResponseCompression records the sizes of a unary response on the wire and
+// decompressed, to see what the compression of the server saves
+func (c *Client) recordResponseCompression(tags MetricTags, peer *peerInfo, decompressedSize int64) {
+	if c.metrics == nil {
+		return
+	}
+	encoding, wireSize, ok := peer.responseWireSize()
+	if !ok {
+		return
+	}
+	c.metrics.recordResponseCompression(c.vu.Context(), c.vu, tags, encoding, wireSize, decompressedSize)
+}
+
+func (m *instanceMetrics) recordResponseCompression(ctx context.Context, vu modules.VU,
+	tags MetricTags, encoding string, wireSize, decompressedSize int64) {
+
+	state := vu.State()
+	if state == nil {
+		return
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("encoding", encoding)
+
+	now := time.Now()
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.ConnectedSamples{
+		Samples: []metrics.Sample{
+			{
+				TimeSeries: metrics.TimeSeries{Metric: m.ConnectRPCRespWireSize, Tags: ctm.Tags},
+				Time:       now,
+				Metadata:   ctm.Metadata,
+				Value:      float64(wireSize),
+			},
+			{
+				TimeSeries: metrics.TimeSeries{Metric: m.ConnectRPCRespDecompressedSize, Tags: ctm.Tags},
+				Time:       now,
+				Metadata:   ctm.Metadata,
+				Value:      float64(decompressedSize),
+			},
+		},
+		Tags: ctm.Tags,
+		Time: now,
+	})
+}
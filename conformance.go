@@ -0,0 +1,255 @@
+package connectrpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Protocol violation rules reported by strict mode
+const (
+	violationHTTPStatus       = "http_status"
+	violationContentType      = "content_type"
+	violationMissingStatus    = "missing_grpc_status"
+	violationTrailersOnlyBody = "trailers_only_body"
+	violationMissingEndStream = "missing_end_stream"
+	violationDataAfterEnd     = "data_after_end_stream"
+	violationTruncatedFrame   = "truncated_envelope"
+)
+
+const (
+	connectEndStreamFlag = 0x02
+	grpcWebTrailerFlag   = 0x80
+)
+
+// conformanceTransport wraps http.RoundTripper to validate responses against the
+// Connect, gRPC and gRPC-Web protocol specifications when `strict: true` is set
+type conformanceTransport struct {
+	base     http.RoundTripper
+	client   *Client
+	protocol string
+}
+
+func (t *conformanceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	requestContentType := req.Header.Get("Content-Type")
+	report := func(rule, detail string) {
+		t.reportViolation(req, requestContentType, rule, detail)
+	}
+
+	switch t.protocol {
+	case "grpc":
+		t.checkGRPC(resp, report)
+	case "grpc-web":
+		t.checkGRPCWeb(resp, report)
+	default:
+		if strings.HasPrefix(requestContentType, "application/connect+") {
+			t.checkConnectStreaming(resp, requestContentType, report)
+		} else {
+			t.checkConnectUnary(resp, requestContentType, report)
+		}
+	}
+
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *conformanceTransport) CloseIdleConnections() {
+	closeIdleConnections(t.base)
+}
+
+// checkConnectUnary validates a Connect unary response
+func (t *conformanceTransport) checkConnectUnary(resp *http.Response, requestContentType string, report func(string, string)) {
+	contentType := resp.Header.Get("Content-Type")
+
+	if resp.StatusCode != http.StatusOK {
+		// Connect unary errors are always JSON encoded
+		if !strings.HasPrefix(contentType, "application/json") {
+			report(violationContentType, fmt.Sprintf("error response has content type %q, expected application/json", contentType))
+		}
+		return
+	}
+
+	if !strings.HasPrefix(contentType, requestContentType) {
+		report(violationContentType, fmt.Sprintf("response content type %q does not match request %q", contentType, requestContentType))
+	}
+}
+
+// checkConnectStreaming validates a Connect streaming response, including its EndStreamResponse
+func (t *conformanceTransport) checkConnectStreaming(resp *http.Response, requestContentType string, report func(string, string)) {
+	if resp.StatusCode != http.StatusOK {
+		report(violationHTTPStatus, fmt.Sprintf("streaming response has HTTP status %d, expected 200", resp.StatusCode))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, requestContentType) {
+		report(violationContentType, fmt.Sprintf("response content type %q does not match request %q", contentType, requestContentType))
+	}
+
+	resp.Body = newEnvelopeInspector(resp.Body, connectEndStreamFlag, func(e *envelopeInspector) {
+		if e.truncated() {
+			report(violationTruncatedFrame, "response body ended in the middle of an envelope")
+		}
+		if !e.sawEnd {
+			report(violationMissingEndStream, "response body ended without an EndStreamResponse envelope")
+		}
+		if e.dataAfterEnd {
+			report(violationDataAfterEnd, "envelopes received after the EndStreamResponse")
+		}
+	})
+}
+
+// checkGRPC validates a gRPC response, including trailers-only responses
+func (t *conformanceTransport) checkGRPC(resp *http.Response, report func(string, string)) {
+	if resp.StatusCode != http.StatusOK {
+		report(violationHTTPStatus, fmt.Sprintf("gRPC response has HTTP status %d, expected 200", resp.StatusCode))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/grpc") || strings.HasPrefix(contentType, "application/grpc-web") {
+		report(violationContentType, fmt.Sprintf("response content type %q, expected application/grpc", contentType))
+	}
+
+	trailersOnly := resp.Header.Get("Grpc-Status") != ""
+	resp.Body = newEnvelopeInspector(resp.Body, 0, func(e *envelopeInspector) {
+		if e.truncated() {
+			report(violationTruncatedFrame, "response body ended in the middle of an envelope")
+		}
+		if trailersOnly {
+			if e.bytes > 0 {
+				report(violationTrailersOnlyBody, "trailers-only response has a non-empty body")
+			}
+			return
+		}
+		// Trailers are populated once the body has been fully read
+		if resp.Trailer.Get("Grpc-Status") == "" {
+			report(violationMissingStatus, "response has no grpc-status header or trailer")
+		}
+	})
+}
+
+// checkGRPCWeb validates a gRPC-Web response and its trailer frame
+func (t *conformanceTransport) checkGRPCWeb(resp *http.Response, report func(string, string)) {
+	if resp.StatusCode != http.StatusOK {
+		report(violationHTTPStatus, fmt.Sprintf("gRPC-Web response has HTTP status %d, expected 200", resp.StatusCode))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/grpc-web") {
+		report(violationContentType, fmt.Sprintf("response content type %q, expected application/grpc-web", contentType))
+	}
+
+	trailersOnly := resp.Header.Get("Grpc-Status") != ""
+	resp.Body = newEnvelopeInspector(resp.Body, grpcWebTrailerFlag, func(e *envelopeInspector) {
+		if e.truncated() {
+			report(violationTruncatedFrame, "response body ended in the middle of an envelope")
+		}
+		if trailersOnly {
+			if e.bytes > 0 {
+				report(violationTrailersOnlyBody, "trailers-only response has a non-empty body")
+			}
+			return
+		}
+		if !e.sawEnd {
+			report(violationMissingStatus, "response body ended without a trailer frame")
+		}
+		if e.dataAfterEnd {
+			report(violationDataAfterEnd, "frames received after the trailer frame")
+		}
+	})
+}
+
+// reportViolation logs a protocol violation and records it as a metric
+func (t *conformanceTransport) reportViolation(req *http.Request, contentType, rule, detail string) {
+	method := req.URL.Path
+
+	if state := t.client.vu.State(); state != nil {
+		state.Logger.WithField("method", method).
+			WithField("rule", rule).
+			Warnf("ConnectRPC protocol violation: %s", detail)
+	}
+
+	if t.client.metrics != nil {
+		tags := t.client.createMetricTags(method, t.protocol, contentType)
+		t.client.metrics.recordProtocolViolation(t.client.vu.Context(), t.client.vu, tags, rule)
+	}
+}
+
+// envelopeInspector wraps a response body and tracks the length-prefixed
+// envelopes (1 byte flags + 4 bytes length) passing through it
+type envelopeInspector struct {
+	body    io.ReadCloser
+	endFlag byte
+	onEOF   func(*envelopeInspector)
+	once    sync.Once
+
+	prefix     [5]byte
+	prefixRead int
+	remaining  uint32
+
+	bytes        int64
+	sawEnd       bool
+	dataAfterEnd bool
+}
+
+func newEnvelopeInspector(body io.ReadCloser, endFlag byte, onEOF func(*envelopeInspector)) *envelopeInspector {
+	return &envelopeInspector{
+		body:    body,
+		endFlag: endFlag,
+		onEOF:   onEOF,
+	}
+}
+
+func (e *envelopeInspector) Read(p []byte) (int, error) {
+	n, err := e.body.Read(p)
+	e.inspect(p[:n])
+	if err == io.EOF {
+		e.once.Do(func() { e.onEOF(e) })
+	}
+	return n, err
+}
+
+func (e *envelopeInspector) Close() error {
+	return e.body.Close()
+}
+
+func (e *envelopeInspector) inspect(b []byte) {
+	e.bytes += int64(len(b))
+
+	for len(b) > 0 {
+		if e.remaining > 0 {
+			n := min(uint32(len(b)), e.remaining)
+			e.remaining -= n
+			b = b[n:]
+			continue
+		}
+
+		n := copy(e.prefix[e.prefixRead:], b)
+		e.prefixRead += n
+		b = b[n:]
+		if e.prefixRead < len(e.prefix) {
+			return
+		}
+
+		if e.sawEnd {
+			e.dataAfterEnd = true
+		}
+		if e.endFlag != 0 && e.prefix[0]&e.endFlag != 0 {
+			e.sawEnd = true
+		}
+		e.remaining = binary.BigEndian.Uint32(e.prefix[1:])
+		e.prefixRead = 0
+	}
+}
+
+// truncated reports whether the body ended in the middle of an envelope
+func (e *envelopeInspector) truncated() bool {
+	return e.prefixRead > 0 || e.remaining > 0
+}
@@ -0,0 +1,102 @@
+package connectrpc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	connectrpc "github.com/bumberboy/xk6-connectrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictModeConformingServer(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
+
+	for _, protocol := range []string{"connect", "grpc", "grpc-web"} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			_, err = ts.Run(`
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', {
+					protocol: '` + protocol + `',
+					contentType: 'application/proto',
+					plaintext: true,
+					strict: true
+				});
+
+				var ok = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+				if (ok.status !== 200) {
+					throw new Error('Expected status 200, got ' + ok.status);
+				}
+
+				var failed = client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+				if (failed.status !== 404) {
+					throw new Error('Expected status 404, got ' + failed.status);
+				}
+
+				client.close();
+			`)
+			require.NoError(t, err)
+
+			violations := findSamples(drainSamples(ts.samples), "connectrpc_protocol_violations")
+			assert.Empty(t, violations, "conforming server should not produce violations")
+		})
+	}
+}
+
+func TestStrictModeReportsViolations(t *testing.T) {
+	t.Parallel()
+
+	// A server answering every call with a non-Connect content type
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("not a connect response"))
+	}))
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', {
+			protocol: 'connect',
+			contentType: 'application/json',
+			httpVersion: '1.1',
+			plaintext: true,
+			strict: true
+		});
+
+		var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+		if (res.status === 200) {
+			throw new Error('Expected the call to fail');
+		}
+		client.close();
+	`)
+	require.NoError(t, err)
+
+	violations := findSamples(drainSamples(ts.samples), "connectrpc_protocol_violations")
+	require.NotEmpty(t, violations)
+
+	rule, ok := violations[0].Tags.Get("rule")
+	require.True(t, ok)
+	assert.Equal(t, "content_type", rule)
+}
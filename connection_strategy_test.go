@@ -1,8 +1,14 @@
 package connectrpc_test
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/bumberboy/xk6-connectrpc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,17 +35,27 @@ func TestConnectionStrategyValidation(t *testing.T) {
 			strategy:    "per-call",
 			expectError: false,
 		},
+		{
+			name:        "Valid per-stream strategy",
+			strategy:    "per-stream",
+			expectError: false,
+		},
+		{
+			name:        "Valid global strategy",
+			strategy:    "global",
+			expectError: false,
+		},
 		{
 			name:         "Invalid strategy",
 			strategy:     "invalid-strategy",
 			expectError:  true,
-			errorMessage: "invalid connectionStrategy: invalid-strategy. Must be 'per-vu', 'per-iteration', or 'per-call'",
+			errorMessage: "invalid connectionStrategy: invalid-strategy. Must be 'per-vu', 'per-iteration', 'per-call', 'per-stream', or 'global'",
 		},
 		{
 			name:         "Empty strategy",
 			strategy:     "",
 			expectError:  true,
-			errorMessage: "invalid connectionStrategy: . Must be 'per-vu', 'per-iteration', or 'per-call'",
+			errorMessage: "invalid connectionStrategy: . Must be 'per-vu', 'per-iteration', 'per-call', 'per-stream', or 'global'",
 		},
 	}
 
@@ -123,6 +139,58 @@ func TestConnectionStrategyPerCall(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestConnectionStrategyPerStream(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	// The unary calls share the connection of the VU, while each stream opens its own one,
+	// closed once the stream ended
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				connectionStrategy: 'per-stream',
+				plaintext: true
+			});
+
+			for (var i = 1; i <= 2; i++) {
+				var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i });
+				if (response.status !== 200) {
+					throw new Error('unexpected status ' + response.status);
+				}
+			}
+
+			var ended = [];
+			for (var j = 1; j <= 2; j++) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+				ended.push(new Promise(function(resolve, reject) {
+					stream.on('end', resolve);
+					stream.on('error', function(e) { reject(new Error(e.message)); });
+				}));
+				stream.write({ number: j });
+				stream.end();
+			}
+			await Promise.all(ended);
+			call('ended');
+		})();
+	`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ended"}, ts.callRecorder.Recorded())
+
+	containers := drainSamples(ts.samples)
+	assert.Len(t, findSamples(containers, "connectrpc_connections"), 3)
+	assert.Len(t, findSamples(containers, "connectrpc_connection_duration"), 2)
+}
+
 func TestConnectionStrategyPerVuPerIteration(t *testing.T) {
 	t.Parallel()
 
@@ -145,6 +213,77 @@ func TestConnectionStrategyPerVuPerIteration(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestConnectionStrategyPerIterationConnections(t *testing.T) {
+	t.Parallel()
+
+	// The parallel subtests run after the test returns
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	for _, tc := range []struct {
+		strategy    string
+		connections int // Connections opened
+		ended       int // Connections closed before the client
+	}{
+		{"per-iteration", 3, 2},
+		{"per-vu", 1, 0},
+	} {
+		tc := tc
+		t.Run(tc.strategy, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`
+				connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+				var client = new connectrpc.Client();
+			`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			_, err = ts.Run(`
+				client.connect('` + srv.URL + `', { connectionStrategy: '` + tc.strategy + `', plaintext: true });
+
+				function ping() {
+					var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+					if (response.status !== 200) {
+						throw new Error('unexpected status ' + response.status);
+					}
+				}
+
+				function cumSum() {
+					var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+					var ended = new Promise(function(resolve, reject) {
+						stream.on('end', resolve);
+						stream.on('error', function(e) { reject(new Error(e.message)); });
+					});
+					stream.write({ number: 1 });
+					stream.end();
+					return ended;
+				}
+			`)
+			require.NoError(t, err)
+
+			// A stream opened first in an iteration gets the connection of the iteration too
+			for iteration, script := range []string{
+				`ping(); await cumSum();`,
+				`await cumSum();`,
+				`await cumSum(); ping();`,
+			} {
+				ts.VU.StateField.Iteration = int64(iteration)
+				_, err = ts.RunOnEventLoop(`(async function() { ` + script + ` call('done'); })();`)
+				require.NoError(t, err)
+			}
+			require.Len(t, ts.callRecorder.Recorded(), 3)
+
+			containers := drainSamples(ts.samples)
+			assert.Len(t, findSamples(containers, "connectrpc_connections"), tc.connections)
+			assert.Len(t, findSamples(containers, "connectrpc_connection_duration"), tc.ended)
+		})
+	}
+}
+
 func TestConnectionStrategyPerVu(t *testing.T) {
 	t.Parallel()
 
@@ -166,3 +305,358 @@ func TestConnectionStrategyPerVu(t *testing.T) {
 	`)
 	require.NoError(t, err)
 }
+
+func TestConnectionStrategyGlobal(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	// Two VUs of the same process share the transport
+	for i := 0; i < 2; i++ {
+		ts := newTestState(t)
+
+		_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+		require.NoError(t, err)
+
+		ts.ToVUContext()
+
+		_, err = ts.Run(`
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				connectionStrategy: 'global',
+				poolSize: 2,
+				plaintext: true
+			});
+
+			for (var i = 0; i < 3; i++) {
+				var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i });
+				if (response.status !== 200) {
+					throw new Error('unexpected status: ' + response.status);
+				}
+			}
+		`)
+		require.NoError(t, err)
+	}
+}
+
+func TestConnectionStrategyGlobalInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		params       string
+		errorMessage string
+	}{
+		{
+			name:         "poolSize without global",
+			params:       `{ poolSize: 2 }`,
+			errorMessage: "poolSize requires the 'global' connectionStrategy",
+		},
+		{
+			name:         "Invalid poolSize",
+			params:       `{ connectionStrategy: 'global', poolSize: 0 }`,
+			errorMessage: "invalid poolSize: 0. Must be at least 1",
+		},
+		{
+			name:         "http2Frames with global",
+			params:       `{ connectionStrategy: 'global', http2Frames: true }`,
+			errorMessage: "http2Frames is not supported with the 'global' connectionStrategy",
+		},
+		{
+			name:         "maxConnectionAge with global",
+			params:       `{ connectionStrategy: 'global', maxConnectionAge: '5m' }`,
+			errorMessage: "maxConnectionAge requires the 'per-vu' or 'per-iteration' connectionStrategy",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`var client = new connectrpc.Client();`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			_, err = ts.Run(`client.connect('test.example.com', ` + tc.params + `);`)
+			require.ErrorContains(t, err, tc.errorMessage)
+		})
+	}
+}
+
+func TestClientCloseTearsDown(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	// close() ends the open stream, and the per-call HTTP clients are released with a metric each
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				connectionStrategy: 'per-call',
+				plaintext: true
+			});
+
+			var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			if (response.status !== 200) {
+				throw new Error('unexpected status ' + response.status);
+			}
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			var received = new Promise(function(resolve) {
+				stream.on('data', resolve);
+			});
+
+			stream.write({ number: 1 });
+			await received;
+
+			client.close();
+			await ended;
+		})();
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	assert.Len(t, findSamples(containers, "connectrpc_connections"), 2)
+	assert.Len(t, findSamples(containers, "connectrpc_connection_duration"), 2)
+}
+
+func TestConnectionBudget(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	for _, budget := range []string{"error", "queue"} {
+		t.Run(budget, func(t *testing.T) {
+			ts := newTestState(t)
+
+			_, err := ts.Run(`
+				connectrpc.setGlobalOptions({ maxConnectionsPerVU: 1, connectionBudget: '` + budget + `' });
+				connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+			`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			// Each per-call call dials its own connection, three at once being over budget
+			_, err = ts.RunOnEventLoop(`
+				(async function() {
+					var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+					var client = new connectrpc.Client();
+					client.connect('` + srv.URL + `', { connectionStrategy: 'per-call', plaintext: true });
+
+					var sequential = [1, 2, 3].map(function(n) { return client.invoke(method, { number: n }).status; });
+					var concurrent = await Promise.all([1, 2, 3].map(function(n) {
+						return client.asyncInvoke(method, { number: n });
+					}));
+					client.close();
+
+					call(JSON.stringify({
+						sequential: sequential,
+						ok: concurrent.filter(function(r) { return r.status === 200; }).length,
+						errors: concurrent.filter(function(r) { return r.status !== 200; }).map(function(r) { return r.message.message; }),
+					}));
+				})();
+			`)
+			require.NoError(t, err)
+
+			recorded := ts.callRecorder.Recorded()
+			require.Len(t, recorded, 1)
+			if budget == "queue" {
+				assert.JSONEq(t, `{"sequential": [200, 200, 200], "ok": 3, "errors": []}`, recorded[0])
+				return
+			}
+			assert.Contains(t, recorded[0], `"sequential":[200,200,200]`)
+			assert.Contains(t, recorded[0], `"ok":1`)
+			assert.Contains(t, recorded[0], "connection budget exceeded: 1 connections open, the maxConnectionsPerVU limit")
+		})
+	}
+}
+
+func TestMaxConnectionAge(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var client = new connectrpc.Client();
+		var ping = function() {
+			var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			if (response.status !== 200) {
+				throw new Error('unexpected status ' + response.status);
+			}
+		};
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		client.connect('` + srv.URL + `', { plaintext: true, maxConnectionAge: '50ms' });
+		ping();
+		ping();
+	`)
+	require.NoError(t, err)
+
+	// Past the age and its jitter, the next call recycles the connection
+	time.Sleep(100 * time.Millisecond)
+	_, err = ts.Run(`ping(); client.close();`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	assert.Len(t, findSamples(containers, "connectrpc_connections"), 2)
+	assert.Len(t, findSamples(containers, "connectrpc_connection_duration"), 2)
+	assert.Len(t, findSamples(containers, "connectrpc_http_connections_new"), 2)
+	assert.Len(t, findSamples(containers, "connectrpc_http_connections_reused"), 1)
+}
+
+func TestConnectTargets(t *testing.T) {
+	t.Parallel()
+
+	// The parallel subtests run after the test returns
+	eu := connectrpc.NewTestServer(false)
+	t.Cleanup(eu.Close)
+	us := connectrpc.NewTestServer(false)
+	t.Cleanup(us.Close)
+
+	for _, tc := range []struct {
+		name    string
+		params  string
+		regions []string
+	}{
+		{"PerIteration", `{ plaintext: true }`, []string{"eu", "us", "eu"}},
+		{"PerVU", `{ plaintext: true, select: 'perVU' }`, []string{"eu", "eu", "eu"}},
+		{"PerIterationPerCall", `{ plaintext: true, connectionStrategy: 'per-call' }`, []string{"eu", "us", "eu"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`
+				connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+				var client = new connectrpc.Client();
+			`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+			ts.VU.StateField.VUID = 1
+
+			_, err = ts.Run(`
+				client.connect([
+					{ url: '` + eu.URL + `', region: 'eu' },
+					{ url: '` + us.URL + `', region: 'us' },
+				], ` + tc.params + `);
+			`)
+			require.NoError(t, err)
+
+			for iteration := int64(0); iteration < 3; iteration++ {
+				ts.VU.StateField.Iteration = iteration
+				val, err := ts.Run(`client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 }).status`)
+				require.NoError(t, err)
+				assert.Equal(t, int64(200), val.ToInteger())
+			}
+
+			var regions []string
+			for _, sample := range findSamples(drainSamples(ts.samples), "connectrpc_reqs") {
+				region, _ := sample.Tags.Get("region")
+				regions = append(regions, region)
+			}
+			assert.Equal(t, tc.regions, regions)
+		})
+	}
+}
+
+func TestConnectTargetsInvalid(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+	ts.ToVUContext()
+
+	for _, tc := range []struct {
+		script string
+		err    string
+	}{
+		{`client.connect([], { plaintext: true })`, "must have at least one address"},
+		{`client.connect([{ region: 'eu' }], { plaintext: true })`, "address 0 must be a URL or an object like { url, region }"},
+		{`client.connect('localhost:8080', { select: 'perVU' })`, "select requires an array of addresses"},
+		{`client.connect(['localhost:8080'], { select: 'random' })`, "invalid select: random. Must be 'perIteration' or 'perVU'"},
+	} {
+		_, err := ts.Run(`var client = new connectrpc.Client(); ` + tc.script)
+		require.Error(t, err, tc.script)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
+
+func TestConnectionErrors(t *testing.T) {
+	t.Parallel()
+
+	// A port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refused := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	// An HTTP/1.1 server, which neither speaks TLS nor h2c
+	http1 := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(http1.Close)
+
+	tests := []struct {
+		Name  string
+		URL   string
+		Phase string
+	}{
+		{"Dial", "http://" + refused, "dial"},
+		{"TLS", "https://" + http1.Listener.Addr().String(), "tls"},
+		{"HTTP2", http1.URL, "http2"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			val, err := ts.Run(`
+				var client = new connectrpc.Client();
+				client.connect('` + tt.URL + `', { plaintext: ` + strconv.FormatBool(tt.Phase != "tls") + ` });
+				var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+				client.close();
+				response.message.code;
+			`)
+			require.NoError(t, err)
+			assert.Equal(t, "unavailable", val.String())
+
+			samples := findSamples(drainSamples(ts.samples), "connectrpc_connection_errors")
+			require.Len(t, samples, 1)
+			assert.Equal(t, map[string]string{"url": tt.URL, "phase": tt.Phase}, samples[0].Tags.Map())
+		})
+	}
+}
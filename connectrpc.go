@@ -7,15 +7,13 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"sync"
 
-	"github.com/bufbuild/protocompile"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
 	"github.com/grafana/sobek"
 	"github.com/mstoykov/k6-taskqueue-lib/taskqueue"
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
@@ -27,21 +25,34 @@ func init() {
 type (
 	// RootModule is the global module instance that will create module
 	// instances for each VU.
-	RootModule struct{}
+	RootModule struct {
+		// prepared holds the payloads of precompile(), shared across all VUs
+		prepared *preparedRegistry
+		// uploads holds the files of loadFile(), shared across all VUs
+		uploads *uploadRegistry
+		// latencies holds the HDR histograms of latencyHistograms(), shared across all VUs
+		latencies *latencyRecorder
+	}
 
 	// ModuleInstance represents an instance of the ConnectRPC module for every VU.
 	ModuleInstance struct {
-		vu      modules.VU
-		exports map[string]interface{}
-		metrics *instanceMetrics
+		vu       modules.VU
+		exports  map[string]interface{}
+		metrics  *instanceMetrics
+		defaults *moduleDefaults
+
+		prepared *preparedRegistry
+		uploads  *uploadRegistry
+		// reaper closes the streams of the VU left open at the end of an iteration
+		reaper *streamReaper
+		// preparedCount is the number of precompile() calls of the VU
+		preparedCount int
 	}
 
-	// ProtoRegistry holds the global proto definitions that can be shared across all clients
+	// ProtoRegistry holds the global proto definitions that can be shared across all clients.
+	// It is the registry of the dynamic package, loading the files from the k6 file systems.
 	ProtoRegistry struct {
-		mu                sync.RWMutex
-		methodDescriptors map[string]protoreflect.MethodDescriptor
-		methodInfos       []MethodInfo
-		loaded            bool
+		*dynamic.Registry
 	}
 )
 
@@ -50,37 +61,74 @@ var (
 	_ modules.Instance = &ModuleInstance{}
 
 	// Global proto registry shared across all VUs
-	globalProtoRegistry = &ProtoRegistry{
-		methodDescriptors: make(map[string]protoreflect.MethodDescriptor),
-		methodInfos:       []MethodInfo{},
-	}
+	globalProtoRegistry = newProtoRegistry()
 )
 
 // New returns a pointer to a new RootModule instance.
 func New() *RootModule {
-	return &RootModule{}
+	return &RootModule{
+		prepared:  &preparedRegistry{},
+		uploads:   &uploadRegistry{files: make(map[string][]byte)},
+		latencies: newLatencyRecorder(),
+	}
 }
 
 // NewModuleInstance implements the modules.Module interface to return
 // a new instance for each VU.
 func (r *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
-	metrics, err := registerMetrics(vu.InitEnv().Registry)
+	defaults := &moduleDefaults{vuConnections: newConnectionLimit(), lookupEnv: vu.InitEnv().LookupEnv}
+	if err := defaults.applyEnv(defaults.lookupEnv); err != nil {
+		common.Throw(vu.Runtime(), err)
+	}
+
+	metrics, err := registerMetrics(vu.InitEnv().Registry, defaults.metricPrefix, defaults.histogramBuckets())
 	if err != nil {
 		common.Throw(vu.Runtime(), fmt.Errorf("failed to register ConnectRPC module metrics: %w", err))
 	}
+	metrics.latencies = r.latencies
+	if defaults.hdrHistograms {
+		r.latencies.enabled.Store(true)
+	}
 
 	mi := &ModuleInstance{
-		vu:      vu,
-		exports: make(map[string]interface{}),
-		metrics: metrics,
+		vu:       vu,
+		exports:  make(map[string]interface{}),
+		metrics:  metrics,
+		defaults: defaults,
+		prepared: r.prepared,
+		uploads:  r.uploads,
+		reaper:   &streamReaper{},
 	}
 
 	mi.exports["Client"] = mi.NewClient
 	mi.exports["loadProtos"] = mi.loadProtos
 	mi.exports["loadProtoset"] = mi.loadProtoset
+	mi.exports["loadProtoDir"] = mi.loadProtoDir
 	mi.exports["loadEmbeddedProtoset"] = mi.loadEmbeddedProtoset
+	mi.exports["autoRegister"] = mi.autoRegister
+	mi.exports["registry"] = map[string]interface{}{"stats": globalProtoRegistry.stats}
+	mi.exports["expectedStatuses"] = mi.expectedStatuses
+	mi.exports["setResponseCallback"] = mi.setResponseCallback
+	mi.exports["setGlobalOptions"] = mi.setGlobalOptions
+	mi.exports["textSummary"] = mi.textSummary
+	mi.exports["jsonSummary"] = mi.jsonSummary
+	mi.exports["summaryThresholds"] = mi.summaryThresholds
+	mi.exports["latencyHistograms"] = mi.latencyHistograms
+	mi.exports["rampingDown"] = mi.rampingDown
+	mi.exports["metricDefinitions"] = mi.metricDefinitions
+	mi.exports["precompile"] = mi.precompile
+	mi.exports["feeder"] = mi.feeder
+	mi.exports["fuzz"] = mi.fuzz
+	mi.exports["loadFile"] = mi.loadFile
+	mi.exports["debugPrint"] = mi.debugPrint
+	mi.exports["check"] = mi.check
+	mi.exports["onSample"] = mi.onSample
 	mi.defineConstants()
 	mi.exports["Stream"] = mi.stream
+	mi.exports["streamArrivalRate"] = mi.streamArrivalRate
+	mi.exports["session"] = mi.session
+	mi.exports["mockServer"] = mi.mockServer
+	mi.exports["recorder"] = mi.recorder
 
 	return mi
 }
@@ -88,7 +136,7 @@ func (r *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
 // NewClient is the JS constructor for the ConnectRPC Client.
 func (mi *ModuleInstance) NewClient(_ sobek.ConstructorCall) *sobek.Object {
 	rt := mi.vu.Runtime()
-	return rt.ToValue(&Client{vu: mi.vu, metrics: mi.metrics}).ToObject(rt)
+	return rt.ToValue(&Client{vu: mi.vu, metrics: mi.metrics, defaults: mi.defaults, uploads: mi.uploads}).ToObject(rt)
 }
 
 // loadProtos loads protocol buffer definitions from proto files into the global registry
@@ -144,6 +192,33 @@ func (mi *ModuleInstance) loadEmbeddedProtoset(protosetData sobek.Value) ([]Meth
 	return globalProtoRegistry.loadEmbeddedProtoset(protosetData.String())
 }
 
+// autoRegister registers the proto definitions embedded in generated client modules, read
+// from their `protoset` export. Files already registered, by another client or another VU,
+// are skipped, so the generated clients can all register themselves on import.
+func (mi *ModuleInstance) autoRegister(clientModules ...sobek.Value) ([]MethodInfo, error) {
+	rt := mi.vu.Runtime()
+
+	methods := []MethodInfo{}
+	for i, clientModule := range clientModules {
+		if common.IsNullish(clientModule) {
+			return nil, fmt.Errorf("client module %d cannot be null or undefined", i)
+		}
+
+		protoset := clientModule.ToObject(rt).Get("protoset")
+		if protoset == nil || common.IsNullish(protoset) {
+			return nil, fmt.Errorf("client module %d has no protoset export: regenerate it with protoc-gen-k6-connectrpc", i)
+		}
+
+		loaded, err := globalProtoRegistry.loadEmbeddedProtoset(protoset.String())
+		if err != nil {
+			return nil, fmt.Errorf("client module %d: %w", i, err)
+		}
+		methods = append(methods, loaded...)
+	}
+
+	return methods, nil
+}
+
 // defineConstants defines the constant variables of the module.
 func (mi *ModuleInstance) defineConstants() {
 	rt := mi.vu.Runtime()
@@ -186,15 +261,41 @@ func (mi *ModuleInstance) stream(c sobek.ConstructorCall) *sobek.Object {
 		common.Throw(rt, fmt.Errorf("invalid ConnectRPC Stream's client: %w", err))
 	}
 
-	methodName := sanitizeMethodName(c.Argument(1).String())
+	s, err := mi.newStream(client, c.Argument(1).String(), c.Argument(2))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	return s.obj
+}
+
+// newStream opens a stream on a method of a client, with the call parameters of a
+// connectrpc.Stream. It must be called on the event loop.
+func (mi *ModuleInstance) newStream(client *Client, method string, params sobek.Value) (*stream, error) {
+	rt := mi.vu.Runtime()
+
+	if err := client.checkRampDown(); err != nil {
+		return nil, err
+	}
+	if err := client.refreshAuth(); err != nil {
+		return nil, err
+	}
+	if err := client.selectTarget(); err != nil {
+		return nil, err
+	}
+
+	methodName := dynamic.MethodPath(method)
 	methodDescriptor, err := client.getMethodDescriptor(methodName)
 	if err != nil {
-		common.Throw(rt, fmt.Errorf("invalid ConnectRPC Stream's method: %w", err))
+		return nil, fmt.Errorf("invalid ConnectRPC Stream's method: %w", err)
+	}
+	if err := client.checkMethodType(methodName, methodDescriptor, true); err != nil {
+		return nil, fmt.Errorf("invalid ConnectRPC Stream's method: %w", err)
 	}
 
-	p, err := newCallParams(mi.vu, c.Argument(2))
+	p, err := newCallParams(mi.vu, params, mi.defaults)
 	if err != nil {
-		common.Throw(rt, fmt.Errorf("invalid ConnectRPC Stream's parameters: %w", err))
+		return nil, fmt.Errorf("invalid ConnectRPC Stream's parameters: %w", err)
 	}
 
 	p.SetSystemTags(mi.vu.State(), client.addr, methodName)
@@ -240,17 +341,18 @@ func (mi *ModuleInstance) stream(c sobek.ConstructorCall) *sobek.Object {
 		eventListeners: newEventListeners(),
 		obj:            rt.NewObject(),
 		tagsAndMeta:    &p.TagsAndMeta,
+		reaper:         mi.reaper,
 	}
 
 	defineStream(rt, s)
 
 	err = s.beginStream(p)
 	if err != nil {
-		s.tq.Close()
-		common.Throw(rt, err)
+		s.closeTaskQueue()
+		return nil, err
 	}
 
-	return s.obj
+	return s, nil
 }
 
 // extractClient extracts & validates a connectrpc.Client from a sobek.Value.
@@ -279,25 +381,13 @@ func extractClient(v sobek.Value, rt *sobek.Runtime) (*Client, error) {
 	return client, nil
 }
 
-// sanitizeMethodName ensures the method name has the correct format
-func sanitizeMethodName(name string) string {
-	if name == "" {
-		return name
-	}
-
-	if name[0] != '/' {
-		name = "/" + name
-	}
-
-	return name
+// newProtoRegistry creates an empty registry
+func newProtoRegistry() *ProtoRegistry {
+	return &ProtoRegistry{Registry: dynamic.NewRegistry()}
 }
 
 // loadProtos loads protocol buffer definitions from proto files into the global registry
 func (registry *ProtoRegistry) loadProtos(vu modules.VU, importPaths []string, filenames ...string) ([]MethodInfo, error) {
-	registry.mu.Lock()
-	defer registry.mu.Unlock()
-
-	// Use the same loading logic as Client.Load but store in global registry
 	initEnv := vu.InitEnv()
 	if initEnv == nil {
 		return nil, errors.New("missing init environment")
@@ -313,68 +403,15 @@ func (registry *ProtoRegistry) loadProtos(vu modules.VU, importPaths []string, f
 		importPaths[i] = strings.TrimPrefix(s, "file://")
 	}
 
-	// Create a custom resolver that uses k6's file system
-	resolver := protocompile.WithStandardImports(&protocompile.SourceResolver{
-		Accessor: func(filename string) (io.ReadCloser, error) {
-			absFilePath := initEnv.GetAbsFilePath(filename)
-			return initEnv.FileSystems["file"].Open(absFilePath)
-		},
-		ImportPaths: importPaths,
-	})
-
-	compiler := &protocompile.Compiler{
-		Resolver: resolver,
-	}
-
-	// Compile the proto files
-	fds, err := compiler.Compile(vu.Context(), filenames...)
-	if err != nil {
-		return nil, err
-	}
-
-	// Build FileDescriptorSet from compiled files
-	fdset := &descriptorpb.FileDescriptorSet{}
-	seen := make(map[string]struct{})
-
-	// Walk through all compiled files and their dependencies
-	var walkFiles func(protoreflect.FileDescriptor)
-	walkFiles = func(fd protoreflect.FileDescriptor) {
-		name := fd.Path()
-		if _, ok := seen[name]; ok {
-			return
-		}
-		seen[name] = struct{}{}
-
-		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(fd))
-
-		// Process dependencies
-		imports := fd.Imports()
-		for i := 0; i < imports.Len(); i++ {
-			walkFiles(imports.Get(i).FileDescriptor)
-		}
-	}
-
-	for _, fd := range fds {
-		walkFiles(fd)
-	}
-
-	methods, err := registry.convertToMethodInfo(fdset)
-	if err != nil {
-		return nil, err
-	}
-
-	registry.methodInfos = append(registry.methodInfos, methods...)
-	registry.loaded = true
-
-	return methods, nil
+	// Open the files with k6's file system
+	return registry.LoadProtos(vu.Context(), importPaths, func(filename string) (io.ReadCloser, error) {
+		absFilePath := initEnv.GetAbsFilePath(filename)
+		return initEnv.FileSystems["file"].Open(absFilePath)
+	}, filenames...)
 }
 
 // loadProtoset loads protocol buffer definitions from a protoset file into the global registry
 func (registry *ProtoRegistry) loadProtoset(vu modules.VU, protosetPath string) ([]MethodInfo, error) {
-	registry.mu.Lock()
-	defer registry.mu.Unlock()
-
-	// Use the same loading logic as Client.LoadProtoset but store in global registry
 	initEnv := vu.InitEnv()
 	if initEnv == nil {
 		return nil, errors.New("missing init environment")
@@ -397,22 +434,11 @@ func (registry *ProtoRegistry) loadProtoset(vu modules.VU, protosetPath string)
 		return nil, fmt.Errorf("couldn't unmarshal protoset file %s: %w", protosetPath, err)
 	}
 
-	methods, err := registry.convertToMethodInfo(fdset)
-	if err != nil {
-		return nil, err
-	}
-
-	registry.methodInfos = append(registry.methodInfos, methods...)
-	registry.loaded = true
-
-	return methods, nil
+	return registry.Register(fdset)
 }
 
 // loadEmbeddedProtoset loads protocol buffer definitions from base64-encoded protoset data into the global registry
 func (registry *ProtoRegistry) loadEmbeddedProtoset(base64Data string) ([]MethodInfo, error) {
-	registry.mu.Lock()
-	defer registry.mu.Unlock()
-
 	// Decode base64 data
 	fdsetBytes, err := base64.StdEncoding.DecodeString(base64Data)
 	if err != nil {
@@ -424,71 +450,41 @@ func (registry *ProtoRegistry) loadEmbeddedProtoset(base64Data string) ([]Method
 		return nil, fmt.Errorf("couldn't unmarshal embedded protoset: %w", err)
 	}
 
-	methods, err := registry.convertToMethodInfo(fdset)
-	if err != nil {
-		return nil, err
-	}
-
-	registry.methodInfos = append(registry.methodInfos, methods...)
-	registry.loaded = true
-
-	return methods, nil
+	return registry.Register(fdset)
 }
 
-// convertToMethodInfo converts a FileDescriptorSet to MethodInfo and stores descriptors in the registry
-func (registry *ProtoRegistry) convertToMethodInfo(fdset *descriptorpb.FileDescriptorSet) ([]MethodInfo, error) {
-	files, err := protodesc.NewFiles(fdset)
-	if err != nil {
-		return nil, err
-	}
-	var rtn []MethodInfo
-
-	appendMethodInfo := func(
-		fd protoreflect.FileDescriptor,
-		sd protoreflect.ServiceDescriptor,
-		md protoreflect.MethodDescriptor,
-	) {
-		name := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
-		registry.methodDescriptors[name] = md
-		rtn = append(rtn, MethodInfo{
-			Package:        string(fd.Package()),
-			Service:        string(sd.Name()),
-			FullMethod:     name,
-			IsClientStream: md.IsStreamingClient(),
-			IsServerStream: md.IsStreamingServer(),
-		})
-	}
-
-	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
-		services := fd.Services()
-		for i := 0; i < services.Len(); i++ {
-			sd := services.Get(i)
-			methods := sd.Methods()
-			for j := 0; j < methods.Len(); j++ {
-				md := methods.Get(j)
-				appendMethodInfo(fd, sd, md)
-			}
-		}
-		return true
-	})
+// registryStats describes the contents of the registry, see registry.stats()
+type registryStats struct {
+	Files      int `js:"files"`
+	Types      int `js:"types"`
+	Methods    int `js:"methods"`
+	Duplicates int `js:"duplicates"` // Files loaded again and skipped
+}
 
-	return rtn, nil
+// stats returns the number of files, types and methods in the registry, for debugging
+func (registry *ProtoRegistry) stats() registryStats {
+	return registryStats(registry.Stats())
 }
 
 // getMethodDescriptor gets a method descriptor from the global registry
 func (registry *ProtoRegistry) getMethodDescriptor(method string) (protoreflect.MethodDescriptor, error) {
-	registry.mu.RLock()
-	defer registry.mu.RUnlock()
-
-	if !registry.loaded {
-		return nil, errors.New("no proto files loaded: call loadProtos() or loadProtoset() first")
+	methodDesc, err := registry.MethodDescriptor(method)
+	if errors.Is(err, dynamic.ErrNoProtos) {
+		return nil, fmt.Errorf("%w: call loadProtos() or loadProtoset() first", err)
 	}
+	return methodDesc, err
+}
 
-	method = sanitizeMethodName(method)
-	methodDesc := registry.methodDescriptors[method]
-	if methodDesc == nil {
-		return nil, fmt.Errorf("method %q not found in loaded proto files", method)
-	}
+// allMethodDescriptors returns the method descriptors of the global registry, by method
+func (registry *ProtoRegistry) allMethodDescriptors() map[string]protoreflect.MethodDescriptor {
+	return registry.MethodDescriptors()
+}
 
-	return methodDesc, nil
+// getMessageDescriptor gets a message descriptor by its full name from the global registry
+func (registry *ProtoRegistry) getMessageDescriptor(name string) (protoreflect.MessageDescriptor, error) {
+	md, err := registry.MessageDescriptor(name)
+	if errors.Is(err, dynamic.ErrNoProtos) {
+		return nil, fmt.Errorf("%w: call loadProtos() or loadProtoset() first", err)
+	}
+	return md, err
 }
@@ -1,11 +1,17 @@
 package connectrpc_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"testing"
 
 	connectrpc "github.com/bumberboy/xk6-connectrpc"
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func TestModuleCreation(t *testing.T) {
@@ -121,6 +127,139 @@ func TestModuleExports(t *testing.T) {
 	}
 }
 
+func TestAutoRegister(t *testing.T) {
+	t.Parallel()
+
+	fdset := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(pingv1.File_ping_v1_ping_proto.Imports().Get(0).FileDescriptor),
+		protodesc.ToFileDescriptorProto(pingv1.File_ping_v1_ping_proto),
+	}}
+	data, err := proto.Marshal(fdset)
+	require.NoError(t, err)
+
+	ts := newTestState(t)
+	require.NoError(t, ts.VU.Runtime().Set("protoset", base64.StdEncoding.EncodeToString(data)))
+
+	// Both generated clients embed ping.proto, their methods are returned but registered once
+	val, err := ts.Run(`
+		const methods = connectrpc.autoRegister({ protoset }, { protoset });
+		methods.filter((m) => m.full_method === "/k6.connectrpc.ping.v1.PingService/Ping").length;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), val.Export())
+
+	_, err = ts.Run(`connectrpc.autoRegister({})`)
+	require.ErrorContains(t, err, "client module 0 has no protoset export")
+
+	val, err = ts.Run(`connectrpc.registry.stats().duplicates`)
+	require.NoError(t, err)
+	assert.Positive(t, val.ToInteger())
+}
+
+func TestLoadProtoDir(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		options  string
+		expected []string
+		err      string
+	}{
+		{
+			name:    "NotRecursive",
+			options: `{}`,
+			err:     "no .proto files found in ./testdata/protodir",
+		},
+		{
+			name:     "Recursive",
+			options:  `{ recursive: true }`,
+			expected: []string{"/k6.connectrpc.greet.v1.GreetService/Greet", "/k6.connectrpc.greet.v1.internal.AdminService/Reset"},
+		},
+		{
+			name:     "Exclude",
+			options:  `{ recursive: true, exclude: ['**/internal/**'] }`,
+			expected: []string{"/k6.connectrpc.greet.v1.GreetService/Greet"},
+		},
+		{
+			name:    "UnknownOption",
+			options: `{ recursve: true }`,
+			err:     `unknown option "recursve"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			val, err := ts.Run(`
+				JSON.stringify(connectrpc.loadProtoDir('./testdata/protodir', ` + tc.options + `).map((m) => m.full_method));
+			`)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			var methods []string
+			require.NoError(t, json.Unmarshal([]byte(val.String()), &methods))
+			assert.ElementsMatch(t, tc.expected, methods)
+		})
+	}
+
+	ts := newTestState(t)
+	ts.ToVUContext()
+	_, err := ts.Run(`connectrpc.loadProtoDir('./testdata/protodir', { recursive: true })`)
+	require.ErrorContains(t, err, "loadProtoDir must be called in the init context")
+}
+
+func TestLoadProtosBundledImports(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	// The google/api, google/rpc and google/protobuf imports aren't in testdata
+	val, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/bundled/v1/bundled.proto').map((m) => m.full_method).join();
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "/k6.connectrpc.bundled.v1.EventService/GetEvent", val.String())
+}
+
+func TestDebugPrint(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	val, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+
+		const byType = connectrpc.debugPrint('k6.connectrpc.ping.v1.PingRequest', { number: '7', txt: 'typo' });
+		const byMethod = connectrpc.debugPrint('/k6.connectrpc.ping.v1.PingService/Ping', { text: 'hi' });
+		JSON.stringify({
+			type: byType.type,
+			number: byType.message.number,
+			dropped: byType.dropped,
+			coerced: byType.coerced.length,
+			defaulted: byType.defaulted,
+			method: byMethod.type,
+		});
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "k6.connectrpc.ping.v1.PingRequest",
+		"number": "7",
+		"dropped": ["txt"],
+		"coerced": 0,
+		"defaulted": ["text"],
+		"method": "k6.connectrpc.ping.v1.PingRequest"
+	}`, val.String())
+
+	_, err = ts.Run(`connectrpc.debugPrint('k6.connectrpc.ping.v1.Missing', {})`)
+	require.ErrorContains(t, err, `message "k6.connectrpc.ping.v1.Missing" not found`)
+}
+
 func TestSanitizeMethodName(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,90 @@
+package connectrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/metrics"
+	"golang.org/x/net/http2"
+)
+
+// Phases of connectrpc_connection_errors
+const (
+	connectionPhaseDNS   = "dns"
+	connectionPhaseDial  = "dial"
+	connectionPhaseTLS   = "tls"
+	connectionPhaseHTTP2 = "http2"
+)
+
+// connectionErrorPhase returns the phase of the connection a request failed in, from the
+// error of its round trip, or "" when the error isn't a connection error
+func connectionErrorPhase(err error) string {
+	var (
+		dnsErr       *net.DNSError
+		opErr        *net.OpError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		goAwayErr    http2.GoAwayError
+		connErr      http2.ConnectionError
+		streamErr    http2.StreamError
+	)
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &dnsErr):
+		return connectionPhaseDNS
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return connectionPhaseTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return connectionPhaseDial
+	case errors.As(err, &goAwayErr), errors.As(err, &connErr), errors.As(err, &streamErr):
+		return connectionPhaseHTTP2
+	}
+
+	// The HTTP/2 transport returns most of its errors as plain errors
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if strings.HasPrefix(e.Error(), "http2: ") {
+			return connectionPhaseHTTP2
+		}
+	}
+	return ""
+}
+
+// recordConnectionError records a request that failed to get a connection, or lost it,
+// with the phase the connection failed in
+func (m *instanceMetrics) recordConnectionError(ctx context.Context, vu modules.VU,
+	url, phase string, tags MetricTags) {
+
+	state := vu.State()
+	if state == nil {
+		return
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setOriginTags(&ctm)
+	ctm.SetTag("url", url)
+	ctm.SetTag("phase", phase)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCConnectionErrors,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
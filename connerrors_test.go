@@ -0,0 +1,42 @@
+package connectrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+func TestConnectionErrorPhase(t *testing.T) {
+	t.Parallel()
+
+	lookup := &net.DNSError{Err: "no such host", Name: "nonexistent.invalid", IsNotFound: true}
+	tests := []struct {
+		Name  string
+		Err   error
+		Phase string
+	}{
+		{"DNS", &net.OpError{Op: "dial", Net: "tcp", Err: lookup}, "dns"},
+		{"Dial", &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, "dial"},
+		{"TLS", fmt.Errorf("handshake: %w", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), "tls"},
+		{"Certificate", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, "tls"},
+		{"GoAway", http2.GoAwayError{ErrCode: http2.ErrCodeEnhanceYourCalm}, "http2"},
+		{"HTTP2Message", &url.Error{Op: "Post", URL: "http://localhost", Err: errors.New("http2: client connection lost")}, "http2"},
+		{"Read", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, ""},
+		{"Application", errors.New("invalid content-type"), ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.Phase, connectionErrorPhase(tt.Err))
+		})
+	}
+}
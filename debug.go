@@ -0,0 +1,315 @@
+package connectrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/js/common"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// debugReport describes how a JS object maps to a protobuf message, see debugPrint()
+type debugReport struct {
+	Type string `js:"type"`
+	// Message is the message as the server sees it, with its default values
+	Message interface{} `js:"message"`
+	// Dropped are the fields unknown to the message, which aren't sent
+	Dropped []string `js:"dropped"`
+	// Coerced are the values converted to another value by the field type
+	Coerced []debugCoercion `js:"coerced"`
+	// Defaulted are the fields missing from the object, the server sees their default value
+	Defaulted []string `js:"defaulted"`
+}
+
+// debugCoercion is a value converted to another value by the field type
+type debugCoercion struct {
+	Field string      `js:"field"`
+	From  interface{} `js:"from"`
+	To    interface{} `js:"to"`
+}
+
+// newDebugReport round-trips the JSON of an object through a message descriptor
+func newDebugReport(desc protoreflect.MessageDescriptor, data []byte) (*debugReport, error) {
+	msg := dynamicpb.NewMessage(desc)
+	if err := (requestUnmarshaler{discardUnknown: true}).unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	sent, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	full, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &debugReport{
+		Type:      string(desc.FullName()),
+		Dropped:   []string{},
+		Coerced:   []debugCoercion{},
+		Defaulted: []string{},
+	}
+	if err := json.Unmarshal(full, &report.Message); err != nil {
+		return nil, err
+	}
+
+	input, _ := decodeJSON(data).(map[string]interface{})
+	output, _ := decodeJSON(sent).(map[string]interface{})
+	report.compareMessage(desc, input, output, "")
+
+	sort.Strings(report.Dropped)
+	sort.Strings(report.Defaulted)
+	sort.Slice(report.Coerced, func(i, j int) bool { return report.Coerced[i].Field < report.Coerced[j].Field })
+
+	return report, nil
+}
+
+// decodeJSON decodes JSON keeping the numbers as written
+func decodeJSON(data []byte) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	_ = decoder.Decode(&v)
+	return v
+}
+
+// compareMessage compares the JSON object given for a message with the JSON of the message
+func (r *debugReport) compareMessage(desc protoreflect.MessageDescriptor, in, out map[string]interface{}, path string) {
+	given := make(map[protoreflect.Name]bool)
+	for key, value := range in {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+
+		fd := desc.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = desc.Fields().ByTextName(key)
+		}
+		if fd == nil {
+			r.Dropped = append(r.Dropped, fieldPath)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+
+		given[fd.Name()] = true
+		r.compareField(fd, value, out[fd.JSONName()], fieldPath)
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if given[fd.Name()] || oneofGiven(fd.ContainingOneof(), given) {
+			continue
+		}
+		if path == "" {
+			r.Defaulted = append(r.Defaulted, fd.JSONName())
+		} else {
+			r.Defaulted = append(r.Defaulted, path+"."+fd.JSONName())
+		}
+	}
+}
+
+// oneofGiven returns whether another field of a oneof was given
+func oneofGiven(oneof protoreflect.OneofDescriptor, given map[protoreflect.Name]bool) bool {
+	if oneof == nil {
+		return false
+	}
+	for i := 0; i < oneof.Fields().Len(); i++ {
+		if given[oneof.Fields().Get(i).Name()] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *debugReport) compareField(fd protoreflect.FieldDescriptor, in, out interface{}, path string) {
+	switch {
+	case fd.IsMap():
+		inMap, _ := in.(map[string]interface{})
+		outMap, _ := out.(map[string]interface{})
+		for key, value := range inMap {
+			r.compareValue(fd.MapValue(), value, outMap[key], fmt.Sprintf("%s[%q]", path, key))
+		}
+	case fd.IsList():
+		inList, _ := in.([]interface{})
+		outList, _ := out.([]interface{})
+		for i, value := range inList {
+			var outValue interface{}
+			if i < len(outList) {
+				outValue = outList[i]
+			}
+			r.compareValue(fd, value, outValue, fmt.Sprintf("%s[%d]", path, i))
+		}
+	default:
+		r.compareValue(fd, in, out, path)
+	}
+}
+
+// compareValue compares a singular value, recording it as coerced if the server sees another value
+func (r *debugReport) compareValue(fd protoreflect.FieldDescriptor, in, out interface{}, path string) {
+	if in == nil {
+		return
+	}
+
+	if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		inObj, ok := in.(map[string]interface{})
+		// The well-known types have their own JSON mapping, like strings for timestamps
+		if !ok || strings.HasPrefix(string(fd.Message().FullName()), "google.protobuf.") {
+			if _, isString := in.(string); !isString {
+				return
+			}
+		} else {
+			outObj, _ := out.(map[string]interface{})
+			r.compareMessage(fd.Message(), inObj, outObj, path)
+			return
+		}
+	}
+
+	// Zero values aren't serialized without explicit presence
+	if out == nil {
+		out = defaultJSONValue(fd)
+	}
+	if !sameJSONValue(in, out) {
+		r.Coerced = append(r.Coerced, debugCoercion{Field: path, From: exportJSONValue(in), To: exportJSONValue(out)})
+	}
+}
+
+// defaultJSONValue returns the JSON of the default value of a field
+func defaultJSONValue(fd protoreflect.FieldDescriptor) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByNumber(fd.Default().Enum()); value != nil {
+			return string(value.Name())
+		}
+		return json.Number(strconv.Itoa(int(fd.Default().Enum())))
+	case protoreflect.BoolKind:
+		return fd.Default().Bool()
+	case protoreflect.StringKind:
+		return fd.Default().String()
+	case protoreflect.BytesKind:
+		return ""
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return nil
+	default:
+		return json.Number(fd.Default().String())
+	}
+}
+
+// sameJSONValue compares two JSON values, numbers also being equal to their string form
+func sameJSONValue(a, b interface{}) bool {
+	if x, ok := jsonNumber(a); ok {
+		if y, ok := jsonNumber(b); ok {
+			return x == y
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func jsonNumber(v interface{}) (float64, bool) {
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// exportJSONValue converts the decoded numbers for the report
+func exportJSONValue(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return n.String()
+	}
+	return v
+}
+
+// String formats the report for the logs
+func (r *debugReport) String() string {
+	var b strings.Builder
+	message, _ := json.Marshal(r.Message)
+	fmt.Fprintf(&b, "%s %s", r.Type, message)
+
+	if len(r.Dropped) > 0 {
+		fmt.Fprintf(&b, "\n  dropped: %s", strings.Join(r.Dropped, ", "))
+	}
+	if len(r.Coerced) > 0 {
+		coerced := make([]string, len(r.Coerced))
+		for i, c := range r.Coerced {
+			from, _ := json.Marshal(c.From)
+			to, _ := json.Marshal(c.To)
+			coerced[i] = fmt.Sprintf("%s (%s -> %s)", c.Field, from, to)
+		}
+		fmt.Fprintf(&b, "\n  coerced: %s", strings.Join(coerced, ", "))
+	}
+	if len(r.Defaulted) > 0 {
+		fmt.Fprintf(&b, "\n  defaulted: %s", strings.Join(r.Defaulted, ", "))
+	}
+	return b.String()
+}
+
+// debugPrint logs and returns how an object maps to a message: the fields dropped because
+// they are unknown, the values coerced by the field types, and the fields missing from the
+// object, which the server sees with their default value. The type is the full name of a
+// message, or a method whose request message is used.
+func (mi *ModuleInstance) debugPrint(typeName string, obj sobek.Value) (*debugReport, error) {
+	if common.IsNullish(obj) {
+		return nil, errors.New("the object cannot be null or undefined")
+	}
+
+	var desc protoreflect.MessageDescriptor
+	if strings.Contains(typeName, "/") {
+		methodDesc, err := globalProtoRegistry.getMethodDescriptor(dynamic.MethodPath(typeName))
+		if err != nil {
+			return nil, err
+		}
+		desc = methodDesc.Input()
+	} else {
+		var err error
+		if desc, err = globalProtoRegistry.getMessageDescriptor(typeName); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := obj.ToObject(mi.vu.Runtime()).MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the object: %w", err)
+	}
+
+	report, err := newDebugReport(desc, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var logger logrus.FieldLogger
+	if state := mi.vu.State(); state != nil {
+		logger = state.Logger
+	} else if initEnv := mi.vu.InitEnv(); initEnv != nil {
+		logger = initEnv.Logger
+	}
+	if logger != nil {
+		logger.Info(report.String())
+	}
+
+	return report, nil
+}
@@ -0,0 +1,63 @@
+package connectrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugReport(t *testing.T) {
+	t.Parallel()
+
+	desc := createUsersRequestDescriptor(t)
+
+	report, err := newDebugReport(desc, []byte(`{
+		"users": [
+			{"name": "ann", "role": "role_admin", "nickname": "a"},
+			{"name": "bob", "role": 2, "address": {"zip": "123", "street": "main"}}
+		],
+		"roles": {"ann": "1"},
+		"count": 5,
+		"team": "core",
+		"extra": true
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "k6.connectrpc.request.v1.CreateUsersRequest", report.Type)
+	assert.Equal(t, []string{"extra", "users[0].nickname", "users[1].address.street"}, report.Dropped)
+	assert.Equal(t, []debugCoercion{
+		{Field: `roles["ann"]`, From: "1", To: "ROLE_ADMIN"},
+		{Field: "users[0].role", From: "role_admin", To: "ROLE_ADMIN"},
+		{Field: "users[1].role", From: float64(2), To: "ROLE_USER"},
+	}, report.Coerced)
+	// The count given as a number isn't a coercion, nor the other members of the oneof defaulted
+	assert.Equal(t, []string{"createdAt", "users[0].address"}, report.Defaulted)
+
+	message, ok := report.Message.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "5", message["count"])
+	assert.Equal(t, "core", message["team"])
+	assert.Nil(t, message["createdAt"])
+
+	assert.Equal(t, `k6.connectrpc.request.v1.CreateUsersRequest {"count":"5"}`+
+		"\n  dropped: a"+
+		"\n  coerced: b (\"c\" -> \"D\")"+
+		"\n  defaulted: e",
+		(&debugReport{
+			Type:      report.Type,
+			Message:   map[string]interface{}{"count": "5"},
+			Dropped:   []string{"a"},
+			Coerced:   []debugCoercion{{Field: "b", From: "c", To: "D"}},
+			Defaulted: []string{"e"},
+		}).String())
+}
+
+func TestDebugReportInvalid(t *testing.T) {
+	t.Parallel()
+
+	desc := createUsersRequestDescriptor(t)
+
+	_, err := newDebugReport(desc, []byte(`{"users": [{"address": {"zip": 123}}]}`))
+	require.ErrorContains(t, err, "field users[0].address.zip: expected string, got number")
+}
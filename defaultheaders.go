@@ -0,0 +1,104 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"golang.org/x/net/http/httpguts"
+)
+
+// defaultHeaders are the headers of setDefaultHeaders(), applied to the calls and streams
+// of a client between its connection headers and the call headers. They are replaced as a
+// whole by each setDefaultHeaders(), as asyncInvoke() reads them from other goroutines.
+type defaultHeaders struct {
+	set     map[string]string   // Values by canonical header name
+	removed map[string]struct{} // Headers removed, the connection-level ones included
+}
+
+// SetDefaultHeaders merges headers into the default headers of the client, like
+// `client.setDefaultHeaders({ Authorization: 'Bearer ' + token })` after a login call. A
+// header set to null is removed, the connection-level one included, and a null object
+// removes all the default headers.
+func (c *Client) SetDefaultHeaders(headersVal sobek.Value) error {
+	if c.vu.State() == nil {
+		return common.NewInitContextError("setting default headers in the init context is not supported")
+	}
+
+	if common.IsNullish(headersVal) {
+		c.defaultHeaders.Store(nil)
+		return nil
+	}
+	rawHeaders, ok := headersVal.Export().(map[string]interface{})
+	if !ok {
+		return errors.New("invalid setDefaultHeaders() headers: must be an object with key-value pairs")
+	}
+
+	next := c.defaultHeaders.Load().clone()
+	canonical := make(map[string]string, len(rawHeaders))
+	for key, value := range rawHeaders {
+		if !httpguts.ValidHeaderFieldName(key) {
+			return fmt.Errorf("invalid setDefaultHeaders() headers: %q is not a valid header name", key)
+		}
+		name := http.CanonicalHeaderKey(key)
+		if other, ok := canonical[name]; ok {
+			return fmt.Errorf("invalid setDefaultHeaders() headers: %q and %q are the same header", other, key)
+		}
+		canonical[name] = key
+
+		if value == nil {
+			delete(next.set, name)
+			next.removed[name] = struct{}{}
+			continue
+		}
+		str, err := metadataValue(key, value)
+		if err != nil {
+			return fmt.Errorf("invalid setDefaultHeaders() headers: %w", err)
+		}
+		next.set[name] = str
+		delete(next.removed, name)
+	}
+
+	c.defaultHeaders.Store(next)
+	return nil
+}
+
+// setDefaultHeader sets one default header, like the token of authenticate()
+func (c *Client) setDefaultHeader(name, value string) {
+	next := c.defaultHeaders.Load().clone()
+	name = http.CanonicalHeaderKey(name)
+	next.set[name] = value
+	delete(next.removed, name)
+	c.defaultHeaders.Store(next)
+}
+
+// clone copies the default headers to change them, as the calls in flight may be reading
+// them. A nil one is copied as empty.
+func (h *defaultHeaders) clone() *defaultHeaders {
+	next := &defaultHeaders{set: make(map[string]string), removed: make(map[string]struct{})}
+	if h == nil {
+		return next
+	}
+	for name, value := range h.set {
+		next.set[name] = value
+	}
+	for name := range h.removed {
+		next.removed[name] = struct{}{}
+	}
+	return next
+}
+
+// apply sets the default headers in the headers of a request, a nil one leaving them as is
+func (h *defaultHeaders) apply(header http.Header) {
+	if h == nil {
+		return
+	}
+	for name := range h.removed {
+		header.Del(name)
+	}
+	for name, value := range h.set {
+		header.Set(name, value)
+	}
+}
@@ -0,0 +1,47 @@
+package dynamic
+
+import (
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	// The google/api and google/rpc protos bundled with the extension
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	_ "google.golang.org/genproto/googleapis/api/httpbody"
+	_ "google.golang.org/genproto/googleapis/rpc/code"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	_ "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// bundledProtoPrefixes are the directories of the protos bundled with the extension: the
+// well-known types, which protocompile provides, and the common google/api and google/rpc
+// protos, which the genproto packages register
+var bundledProtoPrefixes = []string{"google/protobuf/", "google/api/", "google/rpc/"}
+
+// isBundledProto returns whether a proto file is one of the bundled protos
+func isBundledProto(name string) bool {
+	for _, prefix := range bundledProtoPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withBundledImports returns a resolver that falls back to the bundled protos for the files
+// the given resolver can't find, so schemas importing them load without vendoring them
+func withBundledImports(r protocompile.Resolver) protocompile.Resolver {
+	return protocompile.ResolverFunc(func(name string) (protocompile.SearchResult, error) {
+		res, err := protocompile.WithStandardImports(r).FindFileByPath(name)
+		if err == nil || !isBundledProto(name) {
+			return res, err
+		}
+
+		fd, findErr := protoregistry.GlobalFiles.FindFileByPath(name)
+		if findErr != nil {
+			return res, err
+		}
+		return protocompile.SearchResult{Desc: fd}, nil
+	})
+}
@@ -0,0 +1,433 @@
+// Package dynamic loads proto definitions at run time, from proto sources, protosets and
+// generated packages, to invoke their methods with dynamic messages instead of generated
+// code. It is the proto registry of the k6/x/connectrpc extension without k6 and its
+// JavaScript runtime, for other Go load tools and custom k6 wrappers to reuse:
+//
+//	registry := dynamic.NewRegistry()
+//	_, err := registry.LoadProtos(ctx, []string{"protos"}, nil, "ping/v1/ping.proto")
+//	...
+//	methodDesc, err := registry.MethodDescriptor("/k6.connectrpc.ping.v1.PingService/Ping")
+package dynamic
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrNoProtos is the error of the lookups in a registry without proto files
+var ErrNoProtos = errors.New("no proto files loaded")
+
+// MethodInfo describes a method of the loaded proto files
+type MethodInfo struct {
+	Package        string
+	Service        string
+	FullMethod     string
+	IsClientStream bool `json:"isClientStream"`
+	IsServerStream bool `json:"isServerStream"`
+}
+
+// Stats describes the contents of a registry, see Registry.Stats
+type Stats struct {
+	Files      int
+	Types      int
+	Methods    int
+	Duplicates int // Files loaded again and skipped
+}
+
+// FileOpener opens a proto file to compile by its path, for Registry.LoadProtos
+type FileOpener func(filename string) (io.ReadCloser, error)
+
+// Registry holds proto definitions loaded at run time, and resolves their methods and
+// messages. It is safe for concurrent use.
+type Registry struct {
+	mu                sync.RWMutex
+	methodDescriptors map[string]protoreflect.MethodDescriptor
+	methodInfos       []MethodInfo
+	files             map[string][sha256.Size]byte                      // Hashes of the registered proto files
+	hashes            map[[sha256.Size]byte]string                      // Registered proto files by hash
+	types             map[protoreflect.FullName]protoreflect.Descriptor // Registered messages, enums and services
+	duplicates        int
+	loaded            bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		methodDescriptors: make(map[string]protoreflect.MethodDescriptor),
+		methodInfos:       []MethodInfo{},
+		files:             make(map[string][sha256.Size]byte),
+		hashes:            make(map[[sha256.Size]byte]string),
+		types:             make(map[protoreflect.FullName]protoreflect.Descriptor),
+	}
+}
+
+// MethodPath returns the path of a method name like `package.Service/Method`, which is
+// the name with a leading slash
+func MethodPath(name string) string {
+	if name == "" {
+		return name
+	}
+
+	if name[0] != '/' {
+		name = "/" + name
+	}
+
+	return name
+}
+
+// SplitMethod returns the service and procedure names of a method path
+func SplitMethod(method string) (service, procedure string) {
+	// Method format: "/package.service/procedure" or "/service/procedure"
+	method = strings.TrimPrefix(method, "/")
+	parts := strings.Split(method, "/")
+	if len(parts) >= 2 {
+		service = parts[0]
+		procedure = parts[1]
+	}
+	return service, procedure
+}
+
+// LoadProtos compiles proto files and registers them with their imports. The files and
+// their imports are searched in the import paths, and opened with open, os.Open if nil.
+// The well-known types and the common google/api and google/rpc protos are bundled.
+func (registry *Registry) LoadProtos(
+	ctx context.Context, importPaths []string, open FileOpener, filenames ...string,
+) ([]MethodInfo, error) {
+	if open == nil {
+		open = func(filename string) (io.ReadCloser, error) { return os.Open(filename) } //nolint:gosec
+	}
+
+	compiler := &protocompile.Compiler{
+		Resolver: withBundledImports(&protocompile.SourceResolver{
+			Accessor:    open,
+			ImportPaths: importPaths,
+		}),
+	}
+
+	// Compile the proto files
+	fds, err := compiler.Compile(ctx, filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build FileDescriptorSet from compiled files
+	fdset := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]struct{})
+
+	// Walk through all compiled files and their dependencies
+	var walkFiles func(protoreflect.FileDescriptor)
+	walkFiles = func(fd protoreflect.FileDescriptor) {
+		name := fd.Path()
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+
+		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(fd))
+
+		// Process dependencies
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			walkFiles(imports.Get(i).FileDescriptor)
+		}
+	}
+
+	for _, fd := range fds {
+		walkFiles(fd)
+	}
+
+	return registry.Register(fdset)
+}
+
+// LoadProtoset registers the files of a protoset, a serialized FileDescriptorSet like
+// `buf build -o` and `protoc --descriptor_set_out` write
+func (registry *Registry) LoadProtoset(data []byte) ([]MethodInfo, error) {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fdset); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal protoset: %w", err)
+	}
+
+	return registry.Register(fdset)
+}
+
+// Register stores the descriptors of a FileDescriptorSet in the registry and returns its
+// methods. The files are registered once by name and contents, so loading the same protos again,
+// or importing several generated clients sharing dependencies, doesn't duplicate them.
+// A file or type already registered with another definition is an error, and leaves the
+// registry unchanged.
+func (registry *Registry) Register(fdset *descriptorpb.FileDescriptorSet) ([]MethodInfo, error) {
+	files, err := protodesc.NewFiles(fdset)
+	if err != nil {
+		return nil, err
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	return registry.registerFiles(files)
+}
+
+// RegisterGenerated registers the descriptors of generated files, like
+// pingv1.File_ping_v1_ping_proto, and their imports as they are, so that their messages are
+// the ones of the generated Go types. The protos loaded later from their sources are
+// duplicates, and keep the generated descriptors.
+func (registry *Registry) RegisterGenerated(fds ...protoreflect.FileDescriptor) ([]MethodInfo, error) {
+	files := new(protoregistry.Files)
+
+	var add func(fd protoreflect.FileDescriptor) error
+	add = func(fd protoreflect.FileDescriptor) error {
+		if fd.IsPlaceholder() {
+			return fmt.Errorf("proto file %s is not linked into the binary", fd.Path())
+		}
+		if _, err := files.FindFileByPath(fd.Path()); err == nil {
+			return nil
+		}
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := add(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return files.RegisterFile(fd)
+	}
+
+	for _, fd := range fds {
+		if err := add(fd); err != nil {
+			return nil, err
+		}
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	return registry.registerFiles(files)
+}
+
+// registerFiles stores resolved files in the registry like Register, keeping their descriptors.
+// It must be called with the registry lock held.
+func (registry *Registry) registerFiles(files *protoregistry.Files) ([]MethodInfo, error) {
+	var err error
+	var added []protoreflect.FileDescriptor
+	hashes := make(map[string][sha256.Size]byte)
+	duplicates := 0
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		var hash [sha256.Size]byte
+		if hash, err = fileHash(fd); err != nil {
+			return false
+		}
+
+		// The same file may be loaded as `./a.proto` and `a.proto`
+		name := path.Clean(fd.Path())
+		if registered, ok := registry.files[name]; ok {
+			// Tools bundle different versions of the common protos, the first one is kept
+			if registered != hash && !isBundledProto(name) {
+				err = fmt.Errorf("conflicting definitions of proto file %s: it was already loaded with other contents", name)
+				return false
+			}
+			duplicates++
+			return true
+		}
+		// The same file may also be loaded with another import path
+		if _, ok := registry.hashes[hash]; ok {
+			duplicates++
+			return true
+		}
+
+		rangeTypes(fd, func(d protoreflect.Descriptor) {
+			if registered, ok := registry.types[d.FullName()]; ok && err == nil {
+				err = fmt.Errorf("conflicting definitions of %s in %s and %s",
+					d.FullName(), path.Clean(registered.ParentFile().Path()), name)
+			}
+		})
+		if err != nil {
+			return false
+		}
+
+		added = append(added, fd)
+		hashes[name] = hash
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fd := range added {
+		name := path.Clean(fd.Path())
+		registry.files[name] = hashes[name]
+		registry.hashes[hashes[name]] = name
+		rangeTypes(fd, func(d protoreflect.Descriptor) {
+			registry.types[d.FullName()] = d
+		})
+	}
+	registry.duplicates += duplicates
+	registry.loaded = true
+
+	return registry.convertToMethodInfo(files), nil
+}
+
+// convertToMethodInfo converts the files to MethodInfo and stores the descriptors of the
+// methods not yet in the registry
+func (registry *Registry) convertToMethodInfo(files *protoregistry.Files) []MethodInfo {
+	var rtn []MethodInfo
+
+	appendMethodInfo := func(
+		fd protoreflect.FileDescriptor,
+		sd protoreflect.ServiceDescriptor,
+		md protoreflect.MethodDescriptor,
+	) {
+		name := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
+		info := MethodInfo{
+			Package:        string(fd.Package()),
+			Service:        string(sd.Name()),
+			FullMethod:     name,
+			IsClientStream: md.IsStreamingClient(),
+			IsServerStream: md.IsStreamingServer(),
+		}
+		rtn = append(rtn, info)
+
+		if _, ok := registry.methodDescriptors[name]; !ok {
+			registry.methodDescriptors[name] = md
+			registry.methodInfos = append(registry.methodInfos, info)
+		}
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			sd := services.Get(i)
+			methods := sd.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				md := methods.Get(j)
+				appendMethodInfo(fd, sd, md)
+			}
+		}
+		return true
+	})
+
+	return rtn
+}
+
+// fileHash returns the hash of a file definition. The name, file options and source info
+// are left out, so the same file loaded from its sources or compiled by a tool setting the
+// language options, like buf managed mode, has the same hash.
+func fileHash(fd protoreflect.FileDescriptor) ([sha256.Size]byte, error) {
+	fdp := protodesc.ToFileDescriptorProto(fd)
+	fdp.Name = nil
+	fdp.Options = nil
+	fdp.SourceCodeInfo = nil
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdp)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("couldn't marshal proto file %s: %w", fd.Path(), err)
+	}
+	return sha256.Sum256(data), nil
+}
+
+// rangeTypes calls f with the messages, enums and services of a file
+func rangeTypes(fd protoreflect.FileDescriptor, f func(protoreflect.Descriptor)) {
+	rangeEnums := func(enums protoreflect.EnumDescriptors) {
+		for i := 0; i < enums.Len(); i++ {
+			f(enums.Get(i))
+		}
+	}
+
+	var rangeMessages func(protoreflect.MessageDescriptors)
+	rangeMessages = func(messages protoreflect.MessageDescriptors) {
+		for i := 0; i < messages.Len(); i++ {
+			md := messages.Get(i)
+			f(md)
+			rangeEnums(md.Enums())
+			rangeMessages(md.Messages())
+		}
+	}
+
+	rangeEnums(fd.Enums())
+	rangeMessages(fd.Messages())
+	for i := 0; i < fd.Services().Len(); i++ {
+		f(fd.Services().Get(i))
+	}
+}
+
+// Stats returns the number of files, types and methods in the registry, for debugging
+func (registry *Registry) Stats() Stats {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return Stats{
+		Files:      len(registry.files),
+		Types:      len(registry.types),
+		Methods:    len(registry.methodInfos),
+		Duplicates: registry.duplicates,
+	}
+}
+
+// Methods returns the methods of the registry, in their registration order
+func (registry *Registry) Methods() []MethodInfo {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return append([]MethodInfo(nil), registry.methodInfos...)
+}
+
+// MethodDescriptor returns the descriptor of a method, by its path or its name without
+// the leading slash
+func (registry *Registry) MethodDescriptor(method string) (protoreflect.MethodDescriptor, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	if !registry.loaded {
+		return nil, ErrNoProtos
+	}
+
+	method = MethodPath(method)
+	methodDesc := registry.methodDescriptors[method]
+	if methodDesc == nil {
+		return nil, fmt.Errorf("method %q not found in loaded proto files", method)
+	}
+
+	return methodDesc, nil
+}
+
+// MethodDescriptors returns the method descriptors of the registry, by method path
+func (registry *Registry) MethodDescriptors() map[string]protoreflect.MethodDescriptor {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	methods := make(map[string]protoreflect.MethodDescriptor, len(registry.methodDescriptors))
+	for method, desc := range registry.methodDescriptors {
+		methods[method] = desc
+	}
+	return methods
+}
+
+// MessageDescriptor returns the descriptor of a message by its full name
+func (registry *Registry) MessageDescriptor(name string) (protoreflect.MessageDescriptor, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	if !registry.loaded {
+		return nil, ErrNoProtos
+	}
+
+	md, ok := registry.types[protoreflect.FullName(strings.TrimPrefix(name, "."))].(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("message %q not found in loaded proto files", name)
+	}
+
+	return md, nil
+}
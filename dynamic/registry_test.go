@@ -0,0 +1,162 @@
+package dynamic
+
+import (
+	"context"
+	"testing"
+
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// pingFileDescriptorSet returns the FileDescriptorSet of ping.proto and its dependencies.
+// The ping.proto descriptor can be changed by edit before it is added.
+func pingFileDescriptorSet(edit func(*descriptorpb.FileDescriptorProto)) *descriptorpb.FileDescriptorSet {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	imports := pingv1.File_ping_v1_ping_proto.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(imports.Get(i).FileDescriptor))
+	}
+
+	ping := protodesc.ToFileDescriptorProto(pingv1.File_ping_v1_ping_proto)
+	if edit != nil {
+		edit(ping)
+	}
+	fdset.File = append(fdset.File, ping)
+	return fdset
+}
+
+// pingProtoset returns the protoset of ping.proto and its dependencies
+func pingProtoset(t *testing.T) []byte {
+	t.Helper()
+
+	data, err := proto.Marshal(pingFileDescriptorSet(nil))
+	require.NoError(t, err)
+	return data
+}
+
+func TestRegistryDedupesFiles(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	protoset := pingProtoset(t)
+
+	first, err := registry.LoadProtoset(protoset)
+	require.NoError(t, err)
+	require.NotEmpty(t, first)
+
+	// Loading the same files again, like a second generated client would, returns
+	// their methods without registering them twice
+	second, err := registry.LoadProtoset(protoset)
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Len(t, registry.methodInfos, len(first))
+	assert.Contains(t, registry.files, "ping/v1/ping.proto")
+
+	// The same file loaded with another import path is also a duplicate
+	_, err = registry.Register(pingFileDescriptorSet(func(fdp *descriptorpb.FileDescriptorProto) {
+		fdp.Name = proto.String("testdata/ping/v1/ping.proto")
+	}))
+	require.NoError(t, err)
+	assert.Len(t, registry.methodInfos, len(first))
+	assert.NotContains(t, registry.files, "testdata/ping/v1/ping.proto")
+
+	md, err := registry.MethodDescriptor("/k6.connectrpc.ping.v1.PingService/Ping")
+	require.NoError(t, err)
+	assert.Equal(t, protoreflect.Name("Ping"), md.Name())
+}
+
+func TestRegistryConflicts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("File", func(t *testing.T) {
+		t.Parallel()
+
+		registry := NewRegistry()
+		_, err := registry.Register(pingFileDescriptorSet(nil))
+		require.NoError(t, err)
+
+		_, err = registry.Register(pingFileDescriptorSet(func(fdp *descriptorpb.FileDescriptorProto) {
+			fdp.MessageType[0].Field = fdp.MessageType[0].Field[:1]
+		}))
+		require.ErrorContains(t, err, "conflicting definitions of proto file ping/v1/ping.proto")
+	})
+
+	t.Run("Type", func(t *testing.T) {
+		t.Parallel()
+
+		registry := NewRegistry()
+		_, err := registry.Register(pingFileDescriptorSet(nil))
+		require.NoError(t, err)
+
+		_, err = registry.Register(pingFileDescriptorSet(func(fdp *descriptorpb.FileDescriptorProto) {
+			fdp.Name = proto.String("ping/v2/ping.proto")
+			fdp.MessageType[0].Field = fdp.MessageType[0].Field[:1]
+		}))
+		require.ErrorContains(t, err, "conflicting definitions of k6.connectrpc.ping.v1.")
+		require.ErrorContains(t, err, "in ping/v1/ping.proto and ping/v2/ping.proto")
+
+		// The registry is unchanged by the failed registration
+		assert.NotContains(t, registry.files, "ping/v2/ping.proto")
+	})
+}
+
+func TestRegistryStats(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	assert.Equal(t, Stats{}, registry.Stats())
+
+	_, err := registry.Register(pingFileDescriptorSet(nil))
+	require.NoError(t, err)
+	_, err = registry.Register(pingFileDescriptorSet(nil))
+	require.NoError(t, err)
+
+	services := pingv1.File_ping_v1_ping_proto.Services()
+	stats := registry.Stats()
+	assert.Equal(t, 2, stats.Files)
+	assert.Equal(t, services.Get(0).Methods().Len(), stats.Methods)
+	assert.Equal(t, 2, stats.Duplicates)
+	assert.Positive(t, stats.Types)
+}
+
+func TestRegistryGenerated(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	_, err := registry.RegisterGenerated(pingv1.File_ping_v1_ping_proto)
+	require.NoError(t, err)
+
+	// The generated descriptors are kept when the sources are loaded again
+	_, err = registry.Register(pingFileDescriptorSet(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 2, registry.Stats().Duplicates)
+
+	md, err := registry.MethodDescriptor("k6.connectrpc.ping.v1.PingService/Ping")
+	require.NoError(t, err)
+	assert.Equal(t, (&pingv1.PingRequest{}).ProtoReflect().Descriptor(), md.Input())
+}
+
+func TestRegistryLoadProtos(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	_, err := registry.MethodDescriptor("/k6.connectrpc.ping.v1.PingService/Ping")
+	require.ErrorIs(t, err, ErrNoProtos)
+
+	methods, err := registry.LoadProtos(context.Background(), []string{"../testdata"}, nil, "ping/v1/ping.proto")
+	require.NoError(t, err)
+	assert.Equal(t, methods, registry.Methods())
+
+	md, err := registry.MessageDescriptor("k6.connectrpc.ping.v1.PingRequest")
+	require.NoError(t, err)
+	assert.Equal(t, protoreflect.Name("PingRequest"), md.Name())
+
+	_, err = registry.MethodDescriptor("/k6.connectrpc.ping.v1.PingService/Pong")
+	require.ErrorContains(t, err, `method "/k6.connectrpc.ping.v1.PingService/Pong" not found`)
+}
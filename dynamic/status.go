@@ -0,0 +1,46 @@
+package dynamic
+
+import "connectrpc.com/connect"
+
+// HTTPStatus converts a Connect error code to an HTTP status code, 200 for none, based on
+// the Connect protocol specification
+func HTTPStatus(code connect.Code) int {
+	switch code {
+	case 0: // OK
+		return 200
+	case connect.CodeCanceled:
+		return 408 // Request Timeout
+	case connect.CodeUnknown:
+		return 500 // Internal Server Error
+	case connect.CodeInvalidArgument:
+		return 400 // Bad Request
+	case connect.CodeDeadlineExceeded:
+		return 504 // Gateway Timeout
+	case connect.CodeNotFound:
+		return 404 // Not Found
+	case connect.CodeAlreadyExists:
+		return 409 // Conflict
+	case connect.CodePermissionDenied:
+		return 403 // Forbidden
+	case connect.CodeResourceExhausted:
+		return 429 // Too Many Requests
+	case connect.CodeFailedPrecondition:
+		return 412 // Precondition Failed
+	case connect.CodeAborted:
+		return 409 // Conflict
+	case connect.CodeOutOfRange:
+		return 400 // Bad Request
+	case connect.CodeUnimplemented:
+		return 501 // Not Implemented
+	case connect.CodeInternal:
+		return 500 // Internal Server Error
+	case connect.CodeUnavailable:
+		return 503 // Service Unavailable
+	case connect.CodeDataLoss:
+		return 500 // Internal Server Error
+	case connect.CodeUnauthenticated:
+		return 401 // Unauthorized
+	default:
+		return 500 // Internal Server Error
+	}
+}
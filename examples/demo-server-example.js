@@ -0,0 +1,64 @@
+import connectrpc from 'k6/x/connectrpc';
+import encoding from 'k6/encoding';
+import { check } from 'k6';
+
+// Start the demo server first: go run ./cmd/connectrpc-demo-server
+connectrpc.loadProtos(['../cmd/connectrpc-demo-server/protos', '../testdata'],
+    'echo/v1/echo.proto', 'ping/v1/ping.proto');
+
+const PLAINTEXT_URL = __ENV.DEMO_URL || 'http://localhost:8080';
+const TLS_URL = __ENV.DEMO_TLS_URL || 'https://localhost:8443';
+
+export const options = {
+    vus: 2,
+    duration: '10s',
+    thresholds: {
+        'connectrpc_req_errors': ['count==0'],
+        'connectrpc_stream_errors': ['count==0'],
+    },
+};
+
+export default async function () {
+    // Plaintext HTTP/2 (h2c) with gRPC
+    const client = new connectrpc.Client();
+    client.connect(PLAINTEXT_URL, { plaintext: true, protocol: 'grpc', contentType: 'application/proto' });
+
+    const ping = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 42 });
+    check(ping, { 'ping is echoed': (r) => r.status === 200 && r.message.number === '42' });
+
+    // 1 KiB responses from a small request
+    const echo = client.invoke('/k6.connectrpc.echo.v1.EchoService/Echo', {
+        payload: encoding.b64encode('hello'),
+        responseSize: 1024,
+    });
+    check(echo, { 'echo has 1 KiB': (r) => r.status === 200 && encoding.b64decode(r.message.payload).byteLength === 1024 });
+
+    await echoBidi(client, 5);
+    client.close();
+
+    // TLS with the self-signed certificate of the demo server, using the Connect protocol
+    const tlsClient = new connectrpc.Client();
+    tlsClient.connect(TLS_URL, { tls: { insecureSkipVerify: true } });
+    const tlsPing = tlsClient.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+    check(tlsPing, { 'TLS ping uses HTTP/2': (r) => r.status === 200 && r.proto === 'HTTP/2.0' });
+    tlsClient.close();
+}
+
+function echoBidi(client, count) {
+    return new Promise((resolve, reject) => {
+        const stream = new connectrpc.Stream(client, '/k6.connectrpc.echo.v1.EchoService/EchoBidi');
+        let received = 0;
+
+        stream.on('data', () => received++);
+        stream.on('error', (err) => reject(err));
+        stream.on('end', () => {
+            check(received, { 'bidi echoes every message': (n) => n === count });
+            resolve();
+        });
+
+        for (let i = 0; i < count; i++) {
+            stream.write({ payload: encoding.b64encode('message ' + i) });
+        }
+        stream.end();
+    });
+}
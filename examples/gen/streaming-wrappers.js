@@ -118,6 +118,7 @@ export class ClientStreamWrapper extends StreamWrapper {
     });
     this._responseCallbacks = [];
     this._errorCallbacks = [];
+    this._closed = false;
     this._setupResponseHandlers();
   }
 
@@ -132,7 +133,10 @@ export class ClientStreamWrapper extends StreamWrapper {
   }
 
   close() {
-    this.stream.end();
+    if (!this._closed) {
+      this._closed = true;
+      this.stream.end();
+    }
     return this;
   }
 
@@ -151,8 +155,9 @@ export class ClientStreamWrapper extends StreamWrapper {
     return this;
   }
 
-  // Promise-based response (for async/await when supported)
+  // Promise-based response (for async/await when supported), closing the stream if needed
   response() {
+    this.close();
     return this._responsePromise;
   }
 
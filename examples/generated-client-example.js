@@ -102,7 +102,7 @@ function testConverse(elizaClient) {
         group('bidirectional Converse stream', () => {
             try {
                 // Use the generated client method that returns BidiStreamWrapper
-                const streamWrapper = elizaClient.converseStream();
+                const streamWrapper = elizaClient.converse();
 
                 const messages = [
                     'Hello Eliza, how are you?',
@@ -0,0 +1,177 @@
+package connectrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// faultInjector is a connect.Interceptor that adds latency to, or aborts,
+// a percentage of calls before they are sent to the server
+type faultInjector struct {
+	delayPercent float64
+	delay        time.Duration
+
+	abortPercent float64
+	abortCode    connect.Code
+}
+
+var _ connect.Interceptor = &faultInjector{}
+
+// newFaultInjector creates a fault injector from the `faultInjection` connect parameter
+func newFaultInjector(config map[string]interface{}) (*faultInjector, error) {
+	f := &faultInjector{
+		abortCode: connect.CodeUnavailable,
+	}
+
+	if delayVal, ok := config["delay"]; ok && delayVal != nil {
+		delay, ok := delayVal.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("delay must be an object")
+		}
+
+		percent, err := parsePercent(delay["percent"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay percent: %w", err)
+		}
+		f.delayPercent = percent
+
+		durationStr, ok := delay["duration"].(string)
+		if !ok {
+			return nil, errors.New("delay duration must be a duration string")
+		}
+		if f.delay, err = time.ParseDuration(durationStr); err != nil {
+			return nil, fmt.Errorf("invalid delay duration: %w", err)
+		}
+	}
+
+	if abortVal, ok := config["abort"]; ok && abortVal != nil {
+		abort, ok := abortVal.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("abort must be an object")
+		}
+
+		percent, err := parsePercent(abort["percent"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid abort percent: %w", err)
+		}
+		f.abortPercent = percent
+
+		if codeStr, ok := abort["code"].(string); ok {
+			if err := f.abortCode.UnmarshalText([]byte(codeStr)); err != nil {
+				return nil, fmt.Errorf("invalid abort code: %w", err)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// parsePercent converts an exported JS number to a percentage between 0 and 100
+func parsePercent(v interface{}) (float64, error) {
+	var percent float64
+	switch n := v.(type) {
+	case int64:
+		percent = float64(n)
+	case float64:
+		percent = n
+	default:
+		return 0, fmt.Errorf("must be a number, got %T", v)
+	}
+
+	if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("must be between 0 and 100, got %v", percent)
+	}
+	return percent, nil
+}
+
+// inject applies the configured faults, returning an error if the call must be aborted
+func (f *faultInjector) inject(ctx context.Context) error {
+	if f.delay > 0 && rand.Float64()*100 < f.delayPercent { //nolint:gosec
+		timer := time.NewTimer(f.delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return connect.NewError(connect.CodeDeadlineExceeded, ctx.Err())
+			}
+			return connect.NewError(connect.CodeCanceled, ctx.Err())
+		}
+	}
+
+	if f.abortPercent > 0 && rand.Float64()*100 < f.abortPercent { //nolint:gosec
+		return connect.NewError(f.abortCode, errors.New("request aborted by fault injection"))
+	}
+
+	return nil
+}
+
+// WrapUnary implements connect.Interceptor
+func (f *faultInjector) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if err := f.inject(ctx); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements connect.Interceptor
+func (f *faultInjector) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		return &faultStreamConn{
+			StreamingClientConn: next(ctx, spec),
+			ctx:                 ctx,
+			injector:            f,
+		}
+	}
+}
+
+// WrapStreamingHandler implements connect.Interceptor
+func (f *faultInjector) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// faultStreamConn applies faults once per stream, before the first message or header is sent
+type faultStreamConn struct {
+	connect.StreamingClientConn
+
+	ctx      context.Context
+	injector *faultInjector
+	once     sync.Once
+	err      error
+}
+
+func (c *faultStreamConn) inject() error {
+	c.once.Do(func() {
+		c.err = c.injector.inject(c.ctx)
+	})
+	return c.err
+}
+
+func (c *faultStreamConn) Send(msg any) error {
+	if err := c.inject(); err != nil {
+		return err
+	}
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *faultStreamConn) CloseRequest() error {
+	if err := c.inject(); err != nil {
+		return err
+	}
+	return c.StreamingClientConn.CloseRequest()
+}
+
+func (c *faultStreamConn) Receive(msg any) error {
+	if err := c.inject(); err != nil {
+		return err
+	}
+	return c.StreamingClientConn.Receive(msg)
+}
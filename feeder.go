@@ -0,0 +1,250 @@
+package connectrpc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+)
+
+// maxFeederLineSize is the maximum size of a ndjson record
+const maxFeederLineSize = 16 * 1024 * 1024
+
+// feeder reads records lazily from a ndjson or CSV file, so large datasets can be
+// replayed without loading them in memory in every VU
+type feeder struct {
+	vu     modules.VU
+	open   func() (io.ReadCloser, error)
+	format string
+	loop   bool
+
+	mu      sync.Mutex
+	file    io.ReadCloser
+	lines   *bufio.Scanner
+	csv     *csv.Reader
+	header  []string
+	records int // records read since the file was opened
+	done    bool
+}
+
+// newFeeder creates a feeder from the `feeder()` options: format ('ndjson' or 'csv',
+// guessed from the file extension by default) and loop
+func newFeeder(vu modules.VU, open func() (io.ReadCloser, error), filename string, options map[string]interface{}) (*feeder, error) {
+	f := &feeder{vu: vu, open: open, format: "ndjson"}
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		f.format = "csv"
+	}
+
+	for k, v := range options {
+		switch k {
+		case "format":
+			format, ok := v.(string)
+			if !ok || (format != "ndjson" && format != "csv") {
+				return nil, fmt.Errorf("invalid format: %v. Must be 'ndjson' or 'csv'", v)
+			}
+			f.format = format
+		case "loop":
+			loop, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid loop: must be a boolean")
+			}
+			f.loop = loop
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+
+	return f, nil
+}
+
+// feeder creates a feeder for a ndjson or CSV file in the init context
+func (mi *ModuleInstance) feeder(filename string, options sobek.Value) (*feeder, error) {
+	if mi.vu.State() != nil {
+		return nil, errors.New("feeder must be called in the init context")
+	}
+
+	initEnv := mi.vu.InitEnv()
+	if initEnv == nil {
+		return nil, errors.New("missing init environment")
+	}
+
+	var opts map[string]interface{}
+	if !common.IsNullish(options) {
+		var ok bool
+		if opts, ok = options.Export().(map[string]interface{}); !ok {
+			return nil, errors.New("invalid feeder options: must be an object")
+		}
+	}
+
+	absFilePath := initEnv.GetAbsFilePath(filename)
+	fs := initEnv.FileSystems["file"]
+	open := func() (io.ReadCloser, error) {
+		return fs.Open(absFilePath)
+	}
+
+	// Fail early in the init context if the file can't be read
+	file, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open feeder file: %w", err)
+	}
+	_ = file.Close()
+
+	f, err := newFeeder(mi.vu, open, filename, opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feeder options: %w", err)
+	}
+	return f, nil
+}
+
+// Next returns the next record as a JS object, or null once all the records were read
+func (f *feeder) Next() (sobek.Value, error) {
+	rt := f.vu.Runtime()
+
+	record, err := f.nextRecord()
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return sobek.Null(), nil
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(record, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid feeder record: %w", err)
+	}
+	return rt.ToValue(parsed), nil
+}
+
+// Close closes the feeder file. Next returns null afterwards.
+func (f *feeder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.done = true
+	return f.closeFile()
+}
+
+// nextRecord returns the next record as JSON, or nil once all the records were read.
+// It doesn't touch the sobek runtime, so it is safe to call from a goroutine.
+func (f *feeder) nextRecord() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for !f.done {
+		if f.file == nil {
+			if err := f.openFile(); err != nil {
+				f.done = true
+				return nil, err
+			}
+		}
+
+		record, err := f.readRecord()
+		if err != nil {
+			f.done = true
+			_ = f.closeFile()
+			return nil, err
+		}
+		if record != nil {
+			f.records++
+			return record, nil
+		}
+
+		// End of file: start over when looping, unless the file has no records at all
+		empty := f.records == 0
+		if err := f.closeFile(); err != nil {
+			f.done = true
+			return nil, err
+		}
+		if !f.loop || empty {
+			f.done = true
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *feeder) openFile() error {
+	file, err := f.open()
+	if err != nil {
+		return fmt.Errorf("couldn't open feeder file: %w", err)
+	}
+
+	f.file = file
+	f.records = 0
+	f.header = nil
+	if f.format == "csv" {
+		f.csv = csv.NewReader(file)
+		f.csv.ReuseRecord = true
+		f.csv.FieldsPerRecord = -1
+		header, err := f.csv.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read feeder CSV header: %w", err)
+		}
+		f.header = append([]string(nil), header...)
+	} else {
+		f.lines = bufio.NewScanner(file)
+		f.lines.Buffer(make([]byte, 0, 64*1024), maxFeederLineSize)
+	}
+
+	return nil
+}
+
+func (f *feeder) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file, f.lines, f.csv = nil, nil, nil
+	return err
+}
+
+// readRecord reads the next record of the open file, returning nil at the end of the file
+func (f *feeder) readRecord() ([]byte, error) {
+	if f.format == "csv" {
+		if f.header == nil {
+			return nil, nil
+		}
+
+		fields, err := f.csv.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read feeder CSV record: %w", err)
+		}
+
+		// CSV values are strings, which protojson also accepts for numeric fields
+		record := make(map[string]string, len(f.header))
+		for i, name := range f.header {
+			if i < len(fields) {
+				record[name] = fields[i]
+			}
+		}
+		return json.Marshal(record)
+	}
+
+	for f.lines.Scan() {
+		line := strings.TrimSpace(f.lines.Text())
+		if line == "" {
+			continue
+		}
+		return []byte(line), nil
+	}
+	if err := f.lines.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read feeder record: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,83 @@
+package connectrpc
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStringFeeder(t *testing.T, filename, content string, options map[string]interface{}) *feeder {
+	t.Helper()
+
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(content)), nil
+	}
+	f, err := newFeeder(nil, open, filename, options)
+	require.NoError(t, err)
+	return f
+}
+
+func readRecords(t *testing.T, f *feeder, limit int) []string {
+	t.Helper()
+
+	var records []string
+	for len(records) < limit {
+		record, err := f.nextRecord()
+		require.NoError(t, err)
+		if record == nil {
+			break
+		}
+		records = append(records, string(record))
+	}
+	return records
+}
+
+func TestFeederNDJSON(t *testing.T) {
+	t.Parallel()
+
+	f := newStringFeeder(t, "data.ndjson", "{\"number\": 1}\n\n{\"number\": 2}\n", nil)
+	assert.Equal(t, []string{`{"number": 1}`, `{"number": 2}`}, readRecords(t, f, 10))
+
+	// Exhausted feeders keep returning nil
+	record, err := f.nextRecord()
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestFeederCSV(t *testing.T) {
+	t.Parallel()
+
+	f := newStringFeeder(t, "data.CSV", "number,text\n1,one\n2\n", nil)
+	assert.Equal(t, "csv", f.format)
+	assert.Equal(t, []string{`{"number":"1","text":"one"}`, `{"number":"2"}`}, readRecords(t, f, 10))
+}
+
+func TestFeederLoop(t *testing.T) {
+	t.Parallel()
+
+	f := newStringFeeder(t, "data.txt", "{\"number\": 1}\n{\"number\": 2}\n", map[string]interface{}{"loop": true})
+	assert.Equal(t, []string{`{"number": 1}`, `{"number": 2}`, `{"number": 1}`}, readRecords(t, f, 3))
+
+	// A looping feeder without records ends instead of spinning
+	empty := newStringFeeder(t, "data.csv", "number\n", map[string]interface{}{"loop": true})
+	assert.Empty(t, readRecords(t, empty, 3))
+
+	require.NoError(t, f.Close())
+	assert.Empty(t, readRecords(t, f, 3))
+}
+
+func TestNewFeederInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := newFeeder(nil, nil, "data.ndjson", map[string]interface{}{"format": "xml"})
+	require.ErrorContains(t, err, "invalid format: xml. Must be 'ndjson' or 'csv'")
+
+	_, err = newFeeder(nil, nil, "data.ndjson", map[string]interface{}{"loop": "yes"})
+	require.ErrorContains(t, err, "invalid loop: must be a boolean")
+
+	_, err = newFeeder(nil, nil, "data.ndjson", map[string]interface{}{"rate": 10})
+	require.ErrorContains(t, err, `unknown option "rate"`)
+}
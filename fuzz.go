@@ -0,0 +1,387 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// maxFuzzDepth is the depth up to which the nested messages of a payload are set, so
+	// that recursive messages end
+	maxFuzzDepth = 3
+	// fuzzAlphabet is the alphabet of the generated strings
+	fuzzAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// fuzzMutations are the mutation classes of fuzz(), applied to the generated payloads
+var fuzzMutations = []string{"boundaryInts", "longStrings", "missingRequired"}
+
+// fuzzStringLengths are the lengths of the strings and bytes of the longStrings mutation
+var fuzzStringLengths = []int{1 << 10, 1 << 14, 1 << 16}
+
+// fuzzer generates payloads of the input message of a method, with all their fields set
+// to plausible values, then mutated by one of its mutation classes. Each VU has its own,
+// created in the init context or in the VU code.
+type fuzzer struct {
+	vu        modules.VU
+	method    string
+	input     protoreflect.MessageDescriptor
+	mutations []string
+	rng       *rand.Rand
+}
+
+// newFuzzer creates a fuzzer from the `fuzz()` options: seed, for reproducible payloads,
+// and mutations, all the classes by default
+func newFuzzer(vu modules.VU, method string, input protoreflect.MessageDescriptor, options map[string]interface{}) (*fuzzer, error) {
+	f := &fuzzer{vu: vu, method: method, input: input, mutations: fuzzMutations}
+	seed := rand.Uint64() //nolint:gosec
+
+	for k, v := range options {
+		switch k {
+		case "seed":
+			n, ok := v.(int64)
+			if !ok {
+				return nil, fmt.Errorf("invalid seed: %v. Must be an integer", v)
+			}
+			seed = uint64(n) //nolint:gosec
+		case "mutations":
+			mutations, err := parseFuzzMutations(v)
+			if err != nil {
+				return nil, err
+			}
+			f.mutations = mutations
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+
+	f.rng = rand.New(rand.NewPCG(seed, seed)) //nolint:gosec
+	return f, nil
+}
+
+// parseFuzzMutations parses the `mutations` option, a non-empty array of mutation classes
+func parseFuzzMutations(v interface{}) ([]string, error) {
+	values, ok := v.([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, errors.New("invalid mutations: must be a non-empty array")
+	}
+
+	mutations := make([]string, 0, len(values))
+	for _, value := range values {
+		mutation, _ := value.(string)
+		if !isFuzzMutation(mutation) {
+			return nil, fmt.Errorf("invalid mutation: %v. Must be 'boundaryInts', 'longStrings', or 'missingRequired'", value)
+		}
+		mutations = append(mutations, mutation)
+	}
+	return mutations, nil
+}
+
+// isFuzzMutation returns whether a name is one of the mutation classes
+func isFuzzMutation(name string) bool {
+	for _, mutation := range fuzzMutations {
+		if name == mutation {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzz creates a fuzzer of the request payloads of a method
+func (mi *ModuleInstance) fuzz(method string, options sobek.Value) (*fuzzer, error) {
+	method = dynamic.MethodPath(method)
+	methodDesc, err := globalProtoRegistry.getMethodDescriptor(method)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts map[string]interface{}
+	if !common.IsNullish(options) {
+		var ok bool
+		if opts, ok = options.Export().(map[string]interface{}); !ok {
+			return nil, errors.New("invalid fuzz options: must be an object")
+		}
+	}
+
+	f, err := newFuzzer(mi.vu, method, methodDesc.Input(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fuzz options: %w", err)
+	}
+	return f, nil
+}
+
+// Next returns the next payload and its mutation class, as `{ message, mutation }`
+func (f *fuzzer) Next() (*sobek.Object, error) {
+	rt := f.vu.Runtime()
+
+	mutation, data, err := f.nextPayload()
+	if err != nil {
+		return nil, err
+	}
+	var message interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+
+	obj := rt.NewObject()
+	must(rt, obj.Set("message", message))
+	must(rt, obj.Set("mutation", mutation))
+	return obj, nil
+}
+
+// Invoke calls the unary method of the fuzzer with the next payload, tagging the metrics
+// of the call with its `mutation` class, which the response also has
+func (f *fuzzer) Invoke(c *Client, params sobek.Value) (*sobek.Object, error) {
+	if c == nil {
+		return nil, errors.New("invoke requires a Client")
+	}
+	rt := f.vu.Runtime()
+
+	mutation, data, err := f.nextPayload()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.invoke(f.method, withMutationTag(rt, params, mutation), func() ([]byte, error) {
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	must(rt, res.Set("mutation", mutation))
+	return res, nil
+}
+
+// withMutationTag returns a copy of the call parameters with the `mutation` tag
+func withMutationTag(rt *sobek.Runtime, params sobek.Value, mutation string) *sobek.Object {
+	merged, tags := rt.NewObject(), rt.NewObject()
+	if !common.IsNullish(params) {
+		paramsObj := params.ToObject(rt)
+		for _, k := range paramsObj.Keys() {
+			must(rt, merged.Set(k, paramsObj.Get(k)))
+		}
+		if tagsVal := paramsObj.Get("tags"); !common.IsNullish(tagsVal) {
+			tagsObj := tagsVal.ToObject(rt)
+			for _, k := range tagsObj.Keys() {
+				must(rt, tags.Set(k, tagsObj.Get(k)))
+			}
+		}
+	}
+	must(rt, tags.Set("mutation", mutation))
+	must(rt, merged.Set("tags", tags))
+	return merged
+}
+
+// nextPayload generates the next payload as JSON, with the mutation class applied to it
+func (f *fuzzer) nextPayload() (string, []byte, error) {
+	mutation := f.mutations[f.rng.IntN(len(f.mutations))]
+
+	msg := dynamicpb.NewMessage(f.input)
+	f.fill(msg, mutation, 0)
+	if mutation == "missingRequired" {
+		f.dropField(msg)
+	}
+
+	// Partial payloads are allowed, with required nested messages past maxFuzzDepth
+	data, err := protojson.MarshalOptions{AllowPartial: true}.Marshal(msg)
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't marshal the %s payload: %w", mutation, err)
+	}
+	return mutation, data, nil
+}
+
+// fill sets the fields of a message, a single one of each oneof
+func (f *fuzzer) fill(msg protoreflect.Message, mutation string, depth int) {
+	fields := msg.Descriptor().Fields()
+	chosen := make(map[protoreflect.FullName]protoreflect.FieldDescriptor)
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			if _, ok := chosen[oneof.FullName()]; !ok {
+				chosen[oneof.FullName()] = oneof.Fields().Get(f.rng.IntN(oneof.Fields().Len()))
+			}
+			if chosen[oneof.FullName()] != fd {
+				continue
+			}
+		}
+		f.fillField(msg, fd, mutation, depth)
+	}
+}
+
+// fillField sets a field of a message, with one entry for maps and one or two elements for lists
+func (f *fuzzer) fillField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, mutation string, depth int) {
+	switch {
+	case fd.IsMap():
+		key, ok := f.value(fd.MapKey(), mutation, depth)
+		if !ok {
+			return
+		}
+		value, ok := f.value(fd.MapValue(), mutation, depth)
+		if !ok {
+			return
+		}
+		msg.Mutable(fd).Map().Set(key.MapKey(), value)
+	case fd.IsList():
+		list := msg.NewField(fd).List()
+		for n := 1 + f.rng.IntN(2); n > 0; n-- {
+			value, ok := f.listValue(list, fd, mutation, depth)
+			if !ok {
+				return
+			}
+			list.Append(value)
+		}
+		msg.Set(fd, protoreflect.ValueOfList(list))
+	default:
+		if value, ok := f.value(fd, mutation, depth); ok {
+			msg.Set(fd, value)
+		}
+	}
+}
+
+// listValue returns an element of a list field
+func (f *fuzzer) listValue(list protoreflect.List, fd protoreflect.FieldDescriptor, mutation string, depth int) (protoreflect.Value, bool) {
+	if fd.Message() == nil {
+		return f.scalar(fd, mutation), true
+	}
+	if !f.fillable(fd.Message(), depth) {
+		return protoreflect.Value{}, false
+	}
+	value := list.NewElement()
+	f.fillMessage(value.Message(), mutation, depth+1)
+	return value, true
+}
+
+// value returns the value of a singular field, or of the key or value of a map field,
+// false for the messages left unset
+func (f *fuzzer) value(fd protoreflect.FieldDescriptor, mutation string, depth int) (protoreflect.Value, bool) {
+	if fd.Message() == nil {
+		return f.scalar(fd, mutation), true
+	}
+	if !f.fillable(fd.Message(), depth) {
+		return protoreflect.Value{}, false
+	}
+	sub := dynamicpb.NewMessage(fd.Message())
+	f.fillMessage(sub, mutation, depth+1)
+	return protoreflect.ValueOfMessage(sub), true
+}
+
+// fillable returns whether a nested message is set: up to maxFuzzDepth, and not the
+// well-known types whose JSON form has constraints of its own, except the ones fillMessage
+// sets valid values of
+func (f *fuzzer) fillable(md protoreflect.MessageDescriptor, depth int) bool {
+	if depth >= maxFuzzDepth {
+		return false
+	}
+	switch md.FullName() {
+	case "google.protobuf.Any", "google.protobuf.Value", "google.protobuf.Struct",
+		"google.protobuf.ListValue", "google.protobuf.FieldMask":
+		return false
+	}
+	return true
+}
+
+// fillMessage sets the fields of a nested message. Timestamps are the start of the current
+// day, so that the payloads of a seed are the same all day, and durations a second,
+// whatever the mutation, since their JSON form has a range.
+func (f *fuzzer) fillMessage(msg protoreflect.Message, mutation string, depth int) {
+	fields := msg.Descriptor().Fields()
+	switch msg.Descriptor().FullName() {
+	case "google.protobuf.Timestamp":
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(time.Now().UTC().Truncate(24*time.Hour).Unix()))
+	case "google.protobuf.Duration":
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(1))
+	default:
+		f.fill(msg, mutation, depth)
+	}
+}
+
+// scalar returns a scalar value of a field: a small number, a declared enum value, a
+// short string, or a boundary number or long string with these mutations
+func (f *fuzzer) scalar(fd protoreflect.FieldDescriptor, mutation string) protoreflect.Value {
+	rng := f.rng
+	boundary := mutation == "boundaryInts"
+	pick := func(values ...int64) int64 { return values[rng.IntN(len(values))] }
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(rng.IntN(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(rng.IntN(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if boundary {
+			return protoreflect.ValueOfInt32(int32(pick(math.MinInt32, -1, 0, math.MaxInt32))) //nolint:gosec
+		}
+		return protoreflect.ValueOfInt32(int32(1 + rng.IntN(1000))) //nolint:gosec
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if boundary {
+			return protoreflect.ValueOfInt64(pick(math.MinInt64, -1, 0, math.MaxInt64))
+		}
+		return protoreflect.ValueOfInt64(int64(1 + rng.IntN(1000)))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if boundary && rng.IntN(2) == 0 {
+			return protoreflect.ValueOfUint32(0)
+		} else if boundary {
+			return protoreflect.ValueOfUint32(math.MaxUint32)
+		}
+		return protoreflect.ValueOfUint32(uint32(1 + rng.IntN(1000))) //nolint:gosec
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if boundary && rng.IntN(2) == 0 {
+			return protoreflect.ValueOfUint64(0)
+		} else if boundary {
+			return protoreflect.ValueOfUint64(math.MaxUint64)
+		}
+		return protoreflect.ValueOfUint64(uint64(1 + rng.IntN(1000))) //nolint:gosec
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(rng.Float32() * 1000)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(rng.Float64() * 1000)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(f.randomString(mutation))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(f.randomString(mutation)))
+	default:
+		return fd.Default()
+	}
+}
+
+// randomString returns a string of 8 characters, or of one of fuzzStringLengths with the
+// longStrings mutation
+func (f *fuzzer) randomString(mutation string) string {
+	n := 8
+	if mutation == "longStrings" {
+		n = fuzzStringLengths[f.rng.IntN(len(fuzzStringLengths))]
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = fuzzAlphabet[f.rng.IntN(len(fuzzAlphabet))]
+	}
+	return string(b)
+}
+
+// dropField clears one of the set fields of a payload, for the missingRequired mutation.
+// proto2 required fields are kept, since the payload couldn't be encoded without them, so
+// it is the fields a server validates to be set which are missing.
+func (f *fuzzer) dropField(msg protoreflect.Message) {
+	var set []protoreflect.FieldDescriptor
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); msg.Has(fd) && fd.Cardinality() != protoreflect.Required {
+			set = append(set, fd)
+		}
+	}
+	if len(set) > 0 {
+		msg.Clear(set[f.rng.IntN(len(set))])
+	}
+}
@@ -0,0 +1,151 @@
+package connectrpc
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func compileMessage(t *testing.T, filename string, name protoreflect.FullName) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	compiler := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"testdata"}}),
+	}
+	fds, err := compiler.Compile(context.Background(), filename)
+	require.NoError(t, err)
+	md := fds[0].Messages().ByName(name.Name())
+	require.NotNil(t, md)
+	return md
+}
+
+func newTestFuzzer(t *testing.T, input protoreflect.MessageDescriptor, options map[string]interface{}) *fuzzer {
+	t.Helper()
+
+	f, err := newFuzzer(nil, "/test.Service/Method", input, options)
+	require.NoError(t, err)
+	return f
+}
+
+// nextPayloads generates n payloads, checking they are valid messages of the input
+func nextPayloads(t *testing.T, f *fuzzer, n int) (mutations []string, payloads []map[string]interface{}) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		mutation, data, err := f.nextPayload()
+		require.NoError(t, err)
+		require.NoError(t, protojson.Unmarshal(data, dynamicpb.NewMessage(f.input)), string(data))
+
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &payload))
+		mutations = append(mutations, mutation)
+		payloads = append(payloads, payload)
+	}
+	return mutations, payloads
+}
+
+func TestFuzzerMutations(t *testing.T) {
+	t.Parallel()
+
+	input := compileMessage(t, "ping/v1/ping.proto", "k6.connectrpc.ping.v1.PingRequest")
+
+	t.Run("BoundaryInts", func(t *testing.T) {
+		t.Parallel()
+
+		f := newTestFuzzer(t, input, map[string]interface{}{"mutations": []interface{}{"boundaryInts"}})
+		boundaries := []string{strconv.Itoa(math.MinInt64), "-1", strconv.Itoa(math.MaxInt64)}
+		_, payloads := nextPayloads(t, f, 20)
+		for _, payload := range payloads {
+			// 0 is the default value, left out of the JSON
+			if number, ok := payload["number"]; ok {
+				assert.Contains(t, boundaries, number)
+			}
+			assert.Len(t, payload["text"], 8)
+		}
+	})
+
+	t.Run("LongStrings", func(t *testing.T) {
+		t.Parallel()
+
+		f := newTestFuzzer(t, input, map[string]interface{}{"mutations": []interface{}{"longStrings"}})
+		_, payloads := nextPayloads(t, f, 20)
+		for _, payload := range payloads {
+			assert.GreaterOrEqual(t, len(payload["text"].(string)), 1024)
+		}
+	})
+
+	t.Run("MissingRequired", func(t *testing.T) {
+		t.Parallel()
+
+		f := newTestFuzzer(t, input, map[string]interface{}{"mutations": []interface{}{"missingRequired"}})
+		_, payloads := nextPayloads(t, f, 20)
+		for _, payload := range payloads {
+			assert.Len(t, payload, 1)
+		}
+	})
+}
+
+func TestFuzzerNestedMessages(t *testing.T) {
+	t.Parallel()
+
+	// Counters is recursive, with well-known types, lists and maps
+	f := newTestFuzzer(t, compileMessage(t, "request/v1/request.proto", "k6.connectrpc.request.v1.Counters"), nil)
+	mutations, payloads := nextPayloads(t, f, 50)
+	assert.Subset(t, mutations, fuzzMutations)
+
+	var depth int
+	for payload := payloads[0]; payload != nil; depth++ {
+		payload, _ = payload["previous"].(map[string]interface{})
+	}
+	assert.LessOrEqual(t, depth, maxFuzzDepth+1)
+
+	// CreateUsersRequest has a oneof, of which a single field is set
+	f = newTestFuzzer(t, compileMessage(t, "request/v1/request.proto", "k6.connectrpc.request.v1.CreateUsersRequest"), nil)
+	_, payloads = nextPayloads(t, f, 50)
+	for _, payload := range payloads {
+		_, team := payload["team"]
+		_, group := payload["group"]
+		assert.False(t, team && group)
+	}
+}
+
+func TestFuzzerSeed(t *testing.T) {
+	t.Parallel()
+
+	input := compileMessage(t, "request/v1/request.proto", "k6.connectrpc.request.v1.CreateUsersRequest")
+
+	mutations, payloads := nextPayloads(t, newTestFuzzer(t, input, map[string]interface{}{"seed": int64(42)}), 10)
+	sameMutations, samePayloads := nextPayloads(t, newTestFuzzer(t, input, map[string]interface{}{"seed": int64(42)}), 10)
+	assert.Equal(t, mutations, sameMutations)
+	assert.Equal(t, payloads, samePayloads)
+
+	_, otherPayloads := nextPayloads(t, newTestFuzzer(t, input, map[string]interface{}{"seed": int64(7)}), 10)
+	assert.NotEqual(t, payloads, otherPayloads)
+}
+
+func TestNewFuzzerInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	input := compileMessage(t, "ping/v1/ping.proto", "k6.connectrpc.ping.v1.PingRequest")
+
+	_, err := newFuzzer(nil, "", input, map[string]interface{}{"seed": "42"})
+	require.ErrorContains(t, err, "invalid seed: 42. Must be an integer")
+
+	_, err = newFuzzer(nil, "", input, map[string]interface{}{"mutations": []interface{}{}})
+	require.ErrorContains(t, err, "invalid mutations: must be a non-empty array")
+
+	_, err = newFuzzer(nil, "", input, map[string]interface{}{"mutations": []interface{}{"longStrings", "bitFlips"}})
+	require.ErrorContains(t, err, "invalid mutation: bitFlips. Must be 'boundaryInts', 'longStrings', or 'missingRequired'")
+
+	_, err = newFuzzer(nil, "", input, map[string]interface{}{"count": int64(1)})
+	require.ErrorContains(t, err, `unknown option "count"`)
+}
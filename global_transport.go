@@ -0,0 +1,81 @@
+package connectrpc
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+)
+
+// globalTransports holds the transports of the 'global' connection strategy,
+// shared by all VUs of the process
+var globalTransports = &transportRegistry{pools: make(map[string]*transportPool)}
+
+// transportRegistry holds one transport pool per target and transport configuration
+type transportRegistry struct {
+	mu    sync.Mutex
+	pools map[string]*transportPool
+}
+
+// get returns the shared transport pool for the parameters, creating it on first use. Its
+// connections count against the budget of the VU creating it, see connectionBudget.shared.
+func (r *transportRegistry) get(p *connectParams, hostname string, budget *connectionBudget) (*transportPool, error) {
+	size := p.PoolSize
+	if size < 1 {
+		size = 1
+	}
+
+	// Only the options used by newBaseTransport matter, since the rest is per client. The
+	// throttle is applied per client above the shared transports, see throttledTransport.
+	shared := *p
+	shared.Throttle = nil
+	var maxTotal int
+	var queue bool
+	if budget != nil {
+		maxTotal, queue = budget.maxTotal, budget.queue
+	}
+	key := fmt.Sprintf("%s|%t|%s|%v|%d|%t|%d|%t",
+		hostname, p.IsPlaintext, p.HTTPVersion, p.TLS, size, p.HTTP2Frames, maxTotal, queue)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pool, ok := r.pools[key]; ok {
+		return pool, nil
+	}
+
+	pool := &transportPool{transports: make([]http.RoundTripper, size)}
+	for i := range pool.transports {
+		transport, err := newBaseTransport(&shared, hostname, budget, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Each transport keeps a single connection, so the pool size is the connection count
+		switch t := transport.(type) {
+		case *http.Transport:
+			t.MaxConnsPerHost = 1
+		case *http2.Transport:
+			t.StrictMaxConcurrentStreams = true
+		}
+		pool.transports[i] = transport
+	}
+
+	r.pools[key] = pool
+	return pool, nil
+}
+
+// transportPool spreads the requests over a fixed number of transports in a round-robin
+// fashion. With HTTP/2 each transport multiplexes its requests over its connection.
+type transportPool struct {
+	transports []http.RoundTripper
+	next       atomic.Uint64
+}
+
+// RoundTrip implements http.RoundTripper
+func (p *transportPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := p.next.Add(1) % uint64(len(p.transports))
+	return p.transports[i].RoundTrip(req)
+}
@@ -0,0 +1,141 @@
+package connectrpc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportRegistryShares(t *testing.T) {
+	t.Parallel()
+
+	registry := &transportRegistry{pools: make(map[string]*transportPool)}
+	p := &connectParams{HTTPVersion: "2", ConnectionStrategy: "global", PoolSize: 3}
+
+	first, err := registry.get(p, "example.com", nil)
+	require.NoError(t, err)
+	second, err := registry.get(p, "example.com", nil)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Len(t, first.transports, 3)
+
+	for _, transport := range first.transports {
+		httpTransport, ok := transport.(*http.Transport)
+		require.True(t, ok)
+		assert.Equal(t, 1, httpTransport.MaxConnsPerHost)
+	}
+
+	// Another target or transport configuration gets its own pool
+	other, err := registry.get(p, "other.example.com", nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+
+	insecure := &connectParams{HTTPVersion: "2", ConnectionStrategy: "global", TLS: map[string]interface{}{"insecureSkipVerify": true}}
+	other, err = registry.get(insecure, "example.com", nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+	assert.Len(t, other.transports, 1)
+}
+
+type countingTransport struct {
+	calls int
+}
+
+func (t *countingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	t.calls++
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestTransportPoolRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	a, b := &countingTransport{}, &countingTransport{}
+	pool := &transportPool{transports: []http.RoundTripper{a, b}}
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		resp, err := pool.RoundTrip(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+
+	assert.Equal(t, 2, a.calls)
+	assert.Equal(t, 2, b.calls)
+}
+
+func TestTransportRegistryThrottlePerVU(t *testing.T) {
+	t.Parallel()
+
+	registry := &transportRegistry{pools: make(map[string]*transportPool)}
+
+	// Two VUs of the same process, each with its own buckets of 80 kbps = 10000 bytes per second
+	throttled := make([]http.RoundTripper, 2)
+	for i := range throttled {
+		throttle, err := newThrottleParams(map[string]interface{}{"downloadKbps": int64(80)})
+		require.NoError(t, err)
+		p := &connectParams{HTTPVersion: "2", ConnectionStrategy: "global", Throttle: throttle}
+
+		pool, err := registry.get(p, "example.com", nil)
+		require.NoError(t, err)
+		pool.transports = []http.RoundTripper{&bodyTransport{size: 4000}}
+		throttled[i] = &throttledTransport{base: pool, throttle: throttle}
+	}
+	assert.Same(t, throttled[0].(*throttledTransport).base, throttled[1].(*throttledTransport).base)
+
+	// 1000 bytes of initial burst, then 3000 bytes at 10000 bytes/s: around 300ms for each
+	// VU reading at the same time, where shared buckets would take twice as long
+	durations := make(chan time.Duration, len(throttled))
+	for _, transport := range throttled {
+		go func() {
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+			start := time.Now()
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+			durations <- time.Since(start)
+		}()
+	}
+	for range throttled {
+		d := <-durations
+		assert.GreaterOrEqual(t, d, 250*time.Millisecond)
+		assert.Less(t, d, 550*time.Millisecond)
+	}
+}
+
+func TestTransportRegistryKey(t *testing.T) {
+	t.Parallel()
+
+	registry := &transportRegistry{pools: make(map[string]*transportPool)}
+	p := &connectParams{HTTPVersion: "2", ConnectionStrategy: "global"}
+
+	first, err := registry.get(p, "example.com", nil)
+	require.NoError(t, err)
+
+	// The budget of the shared connections is part of the transport configuration
+	budgeted, err := registry.get(p, "example.com", &connectionBudget{maxTotal: 10})
+	require.NoError(t, err)
+	assert.NotSame(t, first, budgeted)
+
+	framed := &connectParams{HTTPVersion: "2", ConnectionStrategy: "global", HTTP2Frames: true}
+	other, err := registry.get(framed, "example.com", nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+}
+
+// bodyTransport answers every request with a body of size bytes
+type bodyTransport struct {
+	size int
+}
+
+func (t *bodyTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(make([]byte, t.size)))}, nil
+}
@@ -0,0 +1,184 @@
+package connectrpc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	// grpcWebTextChunk is the most bytes of the request body encoded as one padded base64 chunk
+	grpcWebTextChunk = 32 * 1024
+)
+
+// parseGRPCWeb parses the `grpcWeb` connect parameter, returning whether it enables the text mode
+func parseGRPCWeb(config map[string]interface{}) (bool, error) {
+	textMode := false
+	for key, value := range config {
+		switch key {
+		case "textMode":
+			b, ok := value.(bool)
+			if !ok {
+				return false, fmt.Errorf("textMode must be a boolean, got %T", value)
+			}
+			textMode = b
+		default:
+			return false, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return textMode, nil
+}
+
+// grpcWebTextTransport speaks the text mode of gRPC-Web, application/grpc-web-text, which
+// connect-go doesn't: the browsers' gRPC-Web clients use it, so some gateways only accept
+// it. The request body is sent as base64, and the response body decoded from it, so that
+// connect-go sees binary gRPC-Web frames, the trailer frame included.
+type grpcWebTextTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip encodes the request body and decodes the response body of gRPC-Web calls
+func (t *grpcWebTextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	contentType := req.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, grpcWebContentType) {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Content-Type", grpcWebTextContentType+strings.TrimPrefix(contentType, grpcWebContentType))
+	req.Header.Set("Accept", grpcWebTextContentType)
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &base64ChunkEncoder{body: req.Body}
+		req.ContentLength = -1
+		req.GetBody = nil
+		req.Header.Del("Content-Length")
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gateways answering an error may not use the text mode, its body is then passed as is
+	respContentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(respContentType, grpcWebTextContentType) {
+		resp.Header.Set("Content-Type", grpcWebContentType+strings.TrimPrefix(respContentType, grpcWebTextContentType))
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Body = &base64ChunkDecoder{body: resp.Body}
+	}
+	return resp, nil
+}
+
+// base64ChunkEncoder encodes a request body as padded base64 chunks, one per read of the
+// body, so that the messages of a stream are sent as soon as they are written rather than
+// once a base64 quantum is complete. The gateways decode the chunks one after the other.
+type base64ChunkEncoder struct {
+	body    io.ReadCloser
+	raw     []byte
+	encoded []byte
+	err     error
+}
+
+func (e *base64ChunkEncoder) Read(p []byte) (int, error) {
+	for len(e.encoded) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.raw == nil {
+			e.raw = make([]byte, grpcWebTextChunk)
+		}
+		n, err := e.body.Read(e.raw)
+		e.err = err
+		if n > 0 {
+			e.encoded = base64.StdEncoding.AppendEncode(e.encoded[:0], e.raw[:n])
+		}
+	}
+
+	n := copy(p, e.encoded)
+	e.encoded = e.encoded[n:]
+	return n, nil
+}
+
+func (e *base64ChunkEncoder) Close() error {
+	return e.body.Close()
+}
+
+// base64ChunkDecoder decodes a response body of padded base64 chunks, which the servers
+// write as they send each frame, so padding may be in the middle of the body. The body is
+// decoded one 4-byte quantum at a time, whatever the boundaries of the reads: a quantum
+// split over two reads is decoded once complete. A last quantum without padding is accepted.
+type base64ChunkDecoder struct {
+	body    io.ReadCloser
+	buf     []byte
+	pending []byte
+	decoded []byte
+	err     error
+}
+
+func (d *base64ChunkDecoder) Read(p []byte) (int, error) {
+	for len(d.decoded) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.buf == nil {
+			d.buf = make([]byte, grpcWebTextChunk)
+		}
+
+		n, err := d.body.Read(d.buf)
+		for _, c := range d.buf[:n] {
+			if c != '\r' && c != '\n' {
+				d.pending = append(d.pending, c)
+			}
+		}
+		if err := d.decodeQuanta(); err != nil {
+			d.err = err
+			continue
+		}
+		if err != nil {
+			d.err = err
+			if errors.Is(err, io.EOF) && len(d.pending) > 0 {
+				d.err = d.decodeUnpadded()
+			}
+		}
+	}
+
+	n := copy(p, d.decoded)
+	d.decoded = d.decoded[n:]
+	return n, nil
+}
+
+// decodeQuanta decodes the complete quanta of the pending characters
+func (d *base64ChunkDecoder) decodeQuanta() error {
+	var quantum [3]byte
+	i := 0
+	for ; i+4 <= len(d.pending); i += 4 {
+		n, err := base64.StdEncoding.Decode(quantum[:], d.pending[i:i+4])
+		if err != nil {
+			return fmt.Errorf("invalid grpc-web-text response body: %w", err)
+		}
+		d.decoded = append(d.decoded, quantum[:n]...)
+	}
+	d.pending = append(d.pending[:0], d.pending[i:]...)
+	return nil
+}
+
+// decodeUnpadded decodes the characters left at the end of the body, of an unpadded quantum
+func (d *base64ChunkDecoder) decodeUnpadded() error {
+	decoded, err := base64.RawStdEncoding.DecodeString(string(d.pending))
+	if err != nil {
+		return fmt.Errorf("invalid grpc-web-text response body: it ends in the middle of a base64 quantum: %w", err)
+	}
+	d.pending = d.pending[:0]
+	d.decoded = append(d.decoded, decoded...)
+	return io.EOF
+}
+
+func (d *base64ChunkDecoder) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,142 @@
+package connectrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"connectrpc.com/connect"
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
+	"github.com/bumberboy/xk6-connectrpc/testdata/ping/v1/pingv1connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase64ChunkDecoder(t *testing.T) {
+	t.Parallel()
+
+	// A data frame and a trailer frame, encoded as two padded chunks like gateways write them
+	data := []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01}
+	trailer := []byte("\x80\x00\x00\x00\x0egrpc-status:0\r\n")
+	chunked := base64.StdEncoding.EncodeToString(data) + base64.StdEncoding.EncodeToString(trailer)
+	require.Contains(t, chunked[:len(chunked)-4], "=", "the padding must be in the middle of the body")
+	want := append(append([]byte{}, data...), trailer...)
+
+	testCases := []struct {
+		Name string
+		Body io.Reader
+	}{
+		{"Whole", strings.NewReader(chunked)},
+		{"OneByteReads", iotest.OneByteReader(strings.NewReader(chunked))},
+		{"HalfReads", iotest.HalfReader(strings.NewReader(chunked))},
+		{"LineBreaks", strings.NewReader(chunked[:4] + "\r\n" + chunked[4:] + "\n")},
+		{"UnpaddedEnd", strings.NewReader(strings.TrimRight(base64.StdEncoding.EncodeToString(want), "="))},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			decoded, err := io.ReadAll(&base64ChunkDecoder{body: io.NopCloser(tc.Body)})
+			require.NoError(t, err)
+			assert.Equal(t, want, decoded)
+		})
+	}
+
+	_, err := io.ReadAll(&base64ChunkDecoder{body: io.NopCloser(strings.NewReader(chunked + "A"))})
+	assert.ErrorContains(t, err, "invalid grpc-web-text response body: it ends in the middle of a base64 quantum")
+
+	_, err = io.ReadAll(&base64ChunkDecoder{body: io.NopCloser(strings.NewReader("AA*A"))})
+	assert.ErrorContains(t, err, "invalid grpc-web-text response body")
+}
+
+func TestBase64ChunkEncoder(t *testing.T) {
+	t.Parallel()
+
+	body := io.NopCloser(iotest.OneByteReader(strings.NewReader("abcd")))
+	encoded, err := io.ReadAll(&base64ChunkEncoder{body: body})
+	require.NoError(t, err)
+
+	// Every read of the body is sent as soon as it's read, as its own padded chunk
+	assert.Equal(t, "YQ==Yg==Yw==ZA==", string(encoded))
+}
+
+// grpcWebTextGateway serves the gRPC-Web text mode in front of a handler of the binary one,
+// like the envoy gRPC-Web filter: it writes each response frame as its own base64 chunk
+func grpcWebTextGateway(t *testing.T, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/grpc-web-text+proto", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/grpc-web-text", r.Header.Get("Accept"))
+
+		encoded, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var body []byte
+		for i := 0; i < len(encoded); i += 4 {
+			quantum, err := base64.StdEncoding.DecodeString(string(encoded[i : i+4]))
+			require.NoError(t, err)
+			body = append(body, quantum...)
+		}
+
+		inner := r.Clone(r.Context())
+		inner.Header.Set("Content-Type", "application/grpc-web+proto")
+		inner.Body = io.NopCloser(bytes.NewReader(body))
+		inner.ContentLength = int64(len(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, inner)
+
+		for key, values := range rec.Header() {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Content-Type", "application/grpc-web-text+proto")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(rec.Code)
+
+		frames := rec.Body.Bytes()
+		for len(frames) >= 5 {
+			size := 5 + int(binary.BigEndian.Uint32(frames[1:5]))
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(frames[:size])))
+			w.(http.Flusher).Flush()
+			frames = frames[size:]
+		}
+	})
+}
+
+func TestGRPCWebTextTransport(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(grpcWebTextGateway(t, NewTestHandler(false)))
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: &grpcWebTextTransport{base: http.DefaultTransport}}
+	client := pingv1connect.NewPingServiceClient(httpClient, srv.URL, connect.WithGRPCWeb())
+	ctx := context.Background()
+
+	ping, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), ping.Msg.GetNumber())
+	assert.Equal(t, trailerValue, ping.Trailer().Get(handlerTrailer))
+
+	stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+	require.NoError(t, err)
+	var numbers []int64
+	for stream.Receive() {
+		numbers = append(numbers, stream.Msg().GetNumber())
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, []int64{1, 2, 3}, numbers)
+
+	// The error status is in the trailer frame, decoded like the data frames
+	stream, err = client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: -1}))
+	require.NoError(t, err)
+	assert.False(t, stream.Receive())
+	err = stream.Err()
+	assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+}
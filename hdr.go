@@ -0,0 +1,191 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// hdrSubBuckets is the number of values counted apart in each power of two range, for
+	// 3 significant digits: the values are recorded with an error of at most 1/1024
+	hdrSubBuckets = 2048
+	hdrHalf       = hdrSubBuckets / 2
+)
+
+// hdrPercentiles are the percentiles of the latency histograms export
+var hdrPercentiles = []struct {
+	name string
+	p    float64
+}{
+	{"p50", 50}, {"p75", 75}, {"p90", 90}, {"p95", 95}, {"p99", 99}, {"p99.9", 99.9}, {"p99.99", 99.99},
+}
+
+// hdrHistogram is a high dynamic range histogram of durations in microseconds, with 3
+// significant digits whatever the magnitude of the values, like HdrHistogram: the values
+// below hdrSubBuckets are counted exactly, and each further power of two range is split
+// into hdrHalf buckets. Its counts only grow with the largest value recorded.
+type hdrHistogram struct {
+	counts []int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+// hdrIndex returns the index of the bucket of a value
+func hdrIndex(v int64) int {
+	if v < hdrSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - bits.Len64(hdrSubBuckets-1)
+	return hdrSubBuckets + (shift-1)*hdrHalf + int(v>>shift) - hdrHalf
+}
+
+// hdrHighest returns the highest value counted in a bucket
+func hdrHighest(index int) int64 {
+	if index < hdrSubBuckets {
+		return int64(index)
+	}
+	shift := (index-hdrSubBuckets)/hdrHalf + 1
+	sub := int64((index-hdrSubBuckets)%hdrHalf + hdrHalf)
+	return (sub+1)<<shift - 1
+}
+
+func (h *hdrHistogram) add(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+
+	index := hdrIndex(v)
+	if index >= len(h.counts) {
+		counts := make([]int64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index]++
+
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+// percentile returns the highest value of the bucket holding the p-th percentile, p being
+// from 0 to 100, capped to the largest value recorded
+func (h *hdrHistogram) percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for index, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return min(hdrHighest(index), h.max)
+		}
+	}
+	return h.max
+}
+
+// hdrSummary is the exported latency histogram of a single method, in milliseconds
+type hdrSummary struct {
+	Method      string             `json:"method"`
+	Type        string             `json:"type"`
+	Count       int64              `json:"count"`
+	Min         float64            `json:"min"`
+	Mean        float64            `json:"mean"`
+	Max         float64            `json:"max"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+// latencyRecorder records the durations of the calls and streams of a run in an HDR
+// histogram per method, once enabled by the latencyHistograms global option. It is shared
+// by all the VUs, so any VU enables it.
+type latencyRecorder struct {
+	enabled atomic.Bool
+	mu      sync.Mutex
+	methods map[string]*methodLatencies
+}
+
+// methodLatencies is the HDR histogram of a single method
+type methodLatencies struct {
+	callType string
+	hdr      hdrHistogram
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{methods: make(map[string]*methodLatencies)}
+}
+
+// record records the duration of a unary call or a finished stream
+func (r *latencyRecorder) record(method, callType string, d time.Duration) {
+	if r == nil || !r.enabled.Load() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.methods[method]
+	if !ok {
+		l = &methodLatencies{callType: callType}
+		r.methods[method] = l
+	}
+	l.hdr.add(d)
+}
+
+// histograms returns the HDR latency histograms of the methods sorted by method
+func (r *latencyRecorder) histograms() []hdrSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ms := func(us int64) float64 { return float64(us) / 1000 }
+	summaries := make([]hdrSummary, 0, len(r.methods))
+	for method, l := range r.methods {
+		summary := hdrSummary{
+			Method:      method,
+			Type:        l.callType,
+			Count:       l.hdr.count,
+			Min:         ms(l.hdr.min),
+			Mean:        float64(l.hdr.sum) / float64(l.hdr.count) / 1000,
+			Max:         ms(l.hdr.max),
+			Percentiles: make(map[string]float64, len(hdrPercentiles)),
+		}
+		for _, p := range hdrPercentiles {
+			summary.Percentiles[p.name] = ms(l.hdr.percentile(p.p))
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Method < summaries[j].Method
+	})
+	return summaries
+}
+
+// latencyHistograms renders the HDR latency histograms as JSON for use in handleSummary,
+// once enabled with the `latencyHistograms: 'hdr'` global option
+func (mi *ModuleInstance) latencyHistograms() (string, error) {
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"unit":    "ms",
+		"methods": mi.metrics.latencies.histograms(),
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ConnectRPC latency histograms: %w", err)
+	}
+	return string(b), nil
+}
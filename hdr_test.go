@@ -0,0 +1,74 @@
+package connectrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHDRBuckets(t *testing.T) {
+	t.Parallel()
+
+	previous := -1
+	for v := int64(0); v < 1<<34; v += 1 + v/997 {
+		index := hdrIndex(v)
+		require.GreaterOrEqual(t, index, previous, "indexes grow with the values")
+		previous = index
+
+		highest := hdrHighest(index)
+		require.GreaterOrEqual(t, highest, v)
+		require.LessOrEqual(t, float64(highest-v), float64(v)/hdrHalf, "3 significant digits for %d", v)
+	}
+	assert.Equal(t, int64(hdrSubBuckets-1), hdrHighest(hdrIndex(hdrSubBuckets-1)), "small values are exact")
+}
+
+func TestHDRHistogramPercentile(t *testing.T) {
+	t.Parallel()
+
+	var h hdrHistogram
+	assert.Equal(t, int64(0), h.percentile(99))
+
+	// 1ms to 10s, so the tail percentiles fall in different buckets
+	for i := 1; i <= 10000; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, int64(1000), h.min)
+	assert.Equal(t, int64(10_000_000), h.max)
+	assert.InEpsilon(t, 5_000_000, h.percentile(50), 0.001)
+	assert.InEpsilon(t, 9_990_000, h.percentile(99.9), 0.001)
+	assert.InEpsilon(t, 9_999_000, h.percentile(99.99), 0.001)
+	assert.Equal(t, int64(10_000_000), h.percentile(100), "capped to the largest value")
+}
+
+func TestLatencyRecorderHistograms(t *testing.T) {
+	t.Parallel()
+
+	r := newLatencyRecorder()
+	r.record("/pkg.Service/Unary", "unary", time.Millisecond)
+	assert.Empty(t, r.histograms(), "the histograms are disabled by default")
+
+	r.enabled.Store(true)
+	for i := 1; i <= 100; i++ {
+		r.record("/pkg.Service/Unary", "unary", time.Duration(i)*time.Millisecond)
+		r.record("/pkg.Service/Stream", "stream", 2*time.Second)
+	}
+
+	histograms := r.histograms()
+	require.Len(t, histograms, 2)
+
+	stream, unary := histograms[0], histograms[1]
+	assert.Equal(t, "/pkg.Service/Stream", stream.Method)
+	assert.InDelta(t, 2000, stream.Percentiles["p99.99"], 2)
+
+	assert.Equal(t, "unary", unary.Type)
+	assert.Equal(t, int64(100), unary.Count)
+	assert.InDelta(t, 1, unary.Min, 0.001)
+	assert.InDelta(t, 50.5, unary.Mean, 0.001)
+	assert.InDelta(t, 100, unary.Max, 0.001)
+	assert.InDelta(t, 50, unary.Percentiles["p50"], 0.05)
+	assert.InDelta(t, 99, unary.Percentiles["p99"], 0.1)
+	assert.Len(t, unary.Percentiles, len(hdrPercentiles))
+}
@@ -0,0 +1,70 @@
+package connectrpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/sobek"
+)
+
+// Formats of the response headers and trailers given to the scripts, see `headerFormat`
+const (
+	// headerFormatMulti keeps the names of the response and the values in arrays:
+	// { 'Content-Type': ['application/json'] }
+	headerFormatMulti = "multi"
+	// headerFormatFlat lowercases the names and joins the values: { 'content-type': 'application/json' }
+	headerFormatFlat = "flat"
+)
+
+// parseHeaderFormat parses the `headerFormat` connect parameter, returning whether the
+// headers are flat
+func parseHeaderFormat(format string) (bool, error) {
+	switch format {
+	case headerFormatMulti:
+		return false, nil
+	case headerFormatFlat:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid headerFormat: %s. Must be '%s' or '%s'", format, headerFormatMulti, headerFormatFlat)
+	}
+}
+
+// newHeadersObject returns response headers or trailers as a plain JS object, flat or with
+// the values in arrays. Its non-enumerable getHeader(name) returns the values of a header
+// joined with commas whatever the case of its name, or undefined if it is missing.
+func newHeadersObject(rt *sobek.Runtime, headers map[string][]string, flat bool) *sobek.Object {
+	obj := rt.NewObject()
+	for name, values := range headers {
+		if flat {
+			name = strings.ToLower(name)
+			if previous := obj.Get(name); previous != nil {
+				values = append([]string{previous.String()}, values...)
+			}
+			must(rt, obj.Set(name, strings.Join(values, ", ")))
+		} else {
+			must(rt, obj.Set(name, values))
+		}
+	}
+
+	getHeader := func(name string) sobek.Value {
+		var found []string
+		for k, values := range headers {
+			if strings.EqualFold(k, name) {
+				found = append(found, values...)
+			}
+		}
+		if found == nil {
+			return sobek.Undefined()
+		}
+		return rt.ToValue(strings.Join(found, ", "))
+	}
+	must(rt, obj.DefineDataProperty("getHeader", rt.ToValue(getHeader), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_FALSE))
+	return obj
+}
+
+// setHeaders sets the headers and trailers of a unary response in the format of the connection
+func (c *Client) setHeaders(rt *sobek.Runtime, response *sobek.Object, headers, trailers map[string][]string) {
+	flat := c.connectParams != nil && c.connectParams.FlatHeaders
+	must(rt, response.Set("headers", newHeadersObject(rt, headers, flat)))
+	must(rt, response.Set("trailers", newHeadersObject(rt, trailers, flat)))
+}
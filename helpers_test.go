@@ -15,3 +15,16 @@ func drainSamples(samples chan metrics.SampleContainer) []metrics.SampleContaine
 		}
 	}
 }
+
+// findSamples returns all samples recorded for the named metric
+func findSamples(containers []metrics.SampleContainer, name string) []metrics.Sample {
+	var result []metrics.Sample
+	for _, container := range containers {
+		for _, sample := range container.GetSamples() {
+			if sample.Metric.Name == name {
+				result = append(result, sample)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package connectrpc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+)
+
+// defaultHistogramBuckets are the upper bounds of the buckets of the duration histograms,
+// the default ones of the Prometheus client libraries
+var defaultHistogramBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// durationHistogram records the samples of a duration trend as a Prometheus histogram,
+// with metricModel: 'histogram'. k6 has no histogram metric type, so it is made of
+// counters: the cumulative buckets tagged with their upper bound in seconds `le`, and the
+// sum in seconds and the count of the durations.
+type durationHistogram struct {
+	bounds []float64 // Upper bounds of the buckets, in milliseconds like the trend samples
+	les    []string  // `le` tags of the buckets
+	bucket *metrics.Metric
+	sum    *metrics.Metric
+	count  *metrics.Metric
+}
+
+// parseHistogramBuckets parses the histogramBuckets option, comma-separated increasing
+// durations like `10ms,50ms,250ms,1s`
+func parseHistogramBuckets(value string) ([]time.Duration, error) {
+	var buckets []time.Duration
+	for _, s := range strings.Split(value, ",") {
+		bucket, err := types.GetDurationValue(strings.TrimSpace(s))
+		if err != nil || bucket <= 0 {
+			return nil, fmt.Errorf("invalid histogramBuckets: %s. Must be increasing durations like '10ms,50ms,1s'", value)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("invalid histogramBuckets: %s. Must be increasing durations like '10ms,50ms,1s'", value)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// histogramBuckets returns the buckets of the duration histograms, nil with the trend model
+func (d *moduleDefaults) histogramBuckets() []time.Duration {
+	if d.metricModel != "histogram" {
+		return nil
+	}
+	if d.buckets != nil {
+		return d.buckets
+	}
+	return defaultHistogramBuckets
+}
+
+// registerHistograms registers the `_bucket`, `_sum` and `_count` counters of the duration
+// trends of metricDefinitions, recorded instead of the trends
+func (m *instanceMetrics) registerHistograms(registry *metrics.Registry, prefix string, buckets []time.Duration) error {
+	m.histograms = make(map[*metrics.Metric]*durationHistogram)
+	for _, d := range metricDefinitions {
+		if d.metricType != metrics.Trend || d.contains != metrics.Time {
+			continue
+		}
+
+		h := &durationHistogram{}
+		for _, bucket := range buckets {
+			h.bounds = append(h.bounds, metrics.D(bucket))
+			h.les = append(h.les, strconv.FormatFloat(bucket.Seconds(), 'g', -1, 64))
+		}
+		h.bounds = append(h.bounds, math.Inf(1))
+		h.les = append(h.les, "+Inf")
+
+		var err error
+		if h.bucket, err = registry.NewMetric(prefix+d.name+"_bucket", metrics.Counter); err != nil {
+			return err
+		}
+		if h.sum, err = registry.NewMetric(prefix+d.name+"_sum", metrics.Counter); err != nil {
+			return err
+		}
+		if h.count, err = registry.NewMetric(prefix+d.name+"_count", metrics.Counter); err != nil {
+			return err
+		}
+		m.histograms[*d.field(m)] = h
+	}
+	return nil
+}
+
+// durationSamples returns the samples recording a sample of a duration trend: the sample
+// itself, or the samples of its histogram with metricModel: 'histogram'
+func (m *instanceMetrics) durationSamples(sample metrics.Sample) metrics.Samples {
+	h := m.histograms[sample.Metric]
+	if h == nil {
+		return metrics.Samples{sample}
+	}
+
+	counter := func(metric *metrics.Metric, tags *metrics.TagSet, value float64) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: tags},
+			Time:       sample.Time,
+			Metadata:   sample.Metadata,
+			Value:      value,
+		}
+	}
+
+	samples := make(metrics.Samples, 0, len(h.bounds)+2)
+	for i, bound := range h.bounds {
+		if sample.Value <= bound {
+			samples = append(samples, counter(h.bucket, sample.Tags.With("le", h.les[i]), 1))
+		}
+	}
+	return append(samples,
+		counter(h.sum, sample.Tags, sample.Value/1000),
+		counter(h.count, sample.Tags, 1),
+	)
+}
@@ -0,0 +1,48 @@
+package connectrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestDurationSamples(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	m, err := registerMetrics(registry, "", defaultHistogramBuckets)
+	require.NoError(t, err)
+
+	tags := registry.RootTagSet().With("method", "/k6.connectrpc.ping.v1.PingService/Ping")
+	samples := m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: m.ConnectRPCReqDuration, Tags: tags},
+		Value:      metrics.D(30 * time.Millisecond),
+	})
+
+	// The cumulative buckets from 50ms, then the sum in seconds and the count
+	var les []string
+	for _, sample := range samples[:len(samples)-2] {
+		assert.Equal(t, "connectrpc_req_duration_bucket", sample.Metric.Name)
+		assert.Equal(t, 1.0, sample.Value)
+		le, _ := sample.Tags.Get("le")
+		les = append(les, le)
+	}
+	assert.Equal(t, []string{"0.05", "0.1", "0.25", "0.5", "1", "2.5", "5", "10", "+Inf"}, les)
+
+	sum, count := samples[len(samples)-2], samples[len(samples)-1]
+	assert.Equal(t, "connectrpc_req_duration_sum", sum.Metric.Name)
+	assert.InDelta(t, 0.03, sum.Value, 1e-9)
+	assert.Equal(t, "connectrpc_req_duration_count", count.Metric.Name)
+	assert.Equal(t, 1.0, count.Value)
+	assert.Equal(t, tags, count.Tags)
+
+	// Other samples and the trend model keep the samples as they are
+	sizes := m.durationSamples(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: m.ConnectRPCReqSize, Tags: tags}, Value: 10})
+	assert.Equal(t, m.ConnectRPCReqSize, sizes[0].Metric)
+	trends, err := registerMetrics(metrics.NewRegistry(), "", nil)
+	require.NoError(t, err)
+	assert.Len(t, trends.durationSamples(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: trends.ConnectRPCReqDuration}}), 1)
+}
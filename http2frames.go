@@ -0,0 +1,387 @@
+package connectrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP/2 frame types and flags used by the frame inspection, see RFC 9113 section 6
+const (
+	h2FrameData         = 0x0
+	h2FrameHeaders      = 0x1
+	h2FrameRSTStream    = 0x3
+	h2FrameSettings     = 0x4
+	h2FrameWindowUpdate = 0x8
+
+	h2FlagEndStream = 0x1
+	h2FlagAck       = 0x1
+
+	h2SettingInitialWindowSize = 0x4
+	h2DefaultWindowSize        = 65535
+	h2FrameHeaderLen           = 9
+	h2MaxKeptPayload           = 256 // Longest payload kept, enough for the SETTINGS of any client or server
+)
+
+// http2Event is an HTTP/2 event seen by the frame inspection, see http2Frames
+type http2Event struct {
+	stall     bool   // A flow-control stall rather than a stream reset
+	direction string // "sent" or "received"
+	code      string // Error code of the reset, like CANCEL
+	window    string // Window exhausted by the stall: "connection" or "stream"
+}
+
+// http2FrameInspector inspects the HTTP/2 frames of the connections of a client, to
+// report the stream resets and flow-control stalls
+type http2FrameInspector struct {
+	onEvent func(http2Event)
+}
+
+// connFrames follows the HTTP/2 frames of a connection. Reads and writes happen on
+// different goroutines.
+type connFrames struct {
+	mu       sync.Mutex
+	sent     frameScanner
+	received frameScanner
+
+	// Windows of the DATA the client sends, credited by the server, and of the DATA it receives
+	sendWindows flowWindows
+	recvWindows flowWindows
+
+	onEvent func(http2Event)
+}
+
+func newConnFrames(onEvent func(http2Event)) *connFrames {
+	f := &connFrames{
+		sendWindows: newFlowWindows(),
+		recvWindows: newFlowWindows(),
+		onEvent:     onEvent,
+	}
+	f.sent = frameScanner{preface: len(http2.ClientPreface), onFrame: f.sentFrame}
+	f.received = frameScanner{onFrame: f.receivedFrame}
+	return f
+}
+
+// wrapDialer returns a dialer of connections whose frames are inspected
+func (i *http2FrameInspector) wrapDialer(
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return i.wrap(conn), nil
+	}
+}
+
+// wrap returns the connection with its frames inspected. The windows are per connection.
+func (i *http2FrameInspector) wrap(conn net.Conn) net.Conn {
+	c := &inspectedConn{Conn: conn, frames: newConnFrames(i.onEvent)}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// http2.Transport fills the TLS state of the responses from connections having one
+		return &inspectedTLSConn{inspectedConn: c, tls: tlsConn}
+	}
+	return c
+}
+
+// observe follows the bytes written, when sent, or read from the connection
+func (f *connFrames) observe(sent bool, b []byte) {
+	f.mu.Lock()
+	var events []http2Event
+	if sent {
+		events = f.sent.scan(b, nil)
+	} else {
+		events = f.received.scan(b, nil)
+	}
+	f.mu.Unlock()
+
+	// Outside of the lock, recording the events doesn't hold the other direction back
+	for _, e := range events {
+		f.onEvent(e)
+	}
+}
+
+// sentFrame follows a frame sent by the client
+func (f *connFrames) sentFrame(h frameHeader, payload []byte, events []http2Event) []http2Event {
+	switch h.typ {
+	case h2FrameHeaders:
+		// The client opens the streams, the Go transport disables server push
+		f.sendWindows.open(h.stream)
+		f.recvWindows.open(h.stream)
+		if h.flags&h2FlagEndStream != 0 {
+			f.sendWindows.close(h.stream)
+		}
+	case h2FrameData:
+		events = f.sendWindows.consume(h, "sent", events)
+	default:
+		events = f.controlFrame(h, payload, "sent", &f.recvWindows, events)
+	}
+	return events
+}
+
+// receivedFrame follows a frame received from the server
+func (f *connFrames) receivedFrame(h frameHeader, payload []byte, events []http2Event) []http2Event {
+	switch h.typ {
+	case h2FrameHeaders:
+		if h.flags&h2FlagEndStream != 0 {
+			f.recvWindows.close(h.stream)
+		}
+	case h2FrameData:
+		events = f.recvWindows.consume(h, "received", events)
+	default:
+		events = f.controlFrame(h, payload, "received", &f.sendWindows, events)
+	}
+	return events
+}
+
+// controlFrame follows the resets, and the settings and window updates crediting the
+// windows of the peer
+func (f *connFrames) controlFrame(h frameHeader, payload []byte, direction string,
+	peerWindows *flowWindows, events []http2Event) []http2Event {
+	switch h.typ {
+	case h2FrameRSTStream:
+		if len(payload) < 4 {
+			return events
+		}
+		f.sendWindows.close(h.stream)
+		f.recvWindows.close(h.stream)
+		code := http2.ErrCode(binary.BigEndian.Uint32(payload))
+		events = append(events, http2Event{direction: direction, code: code.String()})
+	case h2FrameSettings:
+		if h.flags&h2FlagAck != 0 {
+			return events
+		}
+		for s := payload; len(s) >= 6; s = s[6:] {
+			if binary.BigEndian.Uint16(s) == h2SettingInitialWindowSize {
+				peerWindows.setInitial(int64(binary.BigEndian.Uint32(s[2:])))
+			}
+		}
+	case h2FrameWindowUpdate:
+		if len(payload) < 4 {
+			return events
+		}
+		peerWindows.credit(h.stream, int64(binary.BigEndian.Uint32(payload)&0x7fffffff))
+	}
+	return events
+}
+
+// frameHeader is the header of an HTTP/2 frame
+type frameHeader struct {
+	length int
+	typ    byte
+	flags  byte
+	stream uint32
+}
+
+// frameScanner splits the bytes of one direction of a connection into frames, keeping
+// only the start of their payloads
+type frameScanner struct {
+	preface int // Bytes of the client connection preface left to skip
+	header  [h2FrameHeaderLen]byte
+	n       int // Bytes of the current frame header read
+	current frameHeader
+	left    int    // Payload bytes of the current frame left
+	payload []byte // Kept payload of the current frame
+	onFrame func(h frameHeader, payload []byte, events []http2Event) []http2Event
+	broken  bool // Whether the bytes aren't HTTP/2 frames, like an HTTP/1.1 fallback
+}
+
+// scan consumes the bytes, appending the events of the complete frames
+func (s *frameScanner) scan(b []byte, events []http2Event) []http2Event {
+	if s.preface > 0 {
+		n := min(s.preface, len(b))
+		if !strings.HasPrefix(http2.ClientPreface[len(http2.ClientPreface)-s.preface:], string(b[:n])) {
+			s.broken = true
+		}
+		s.preface -= n
+		b = b[n:]
+	}
+
+	for len(b) > 0 && !s.broken {
+		if s.n < h2FrameHeaderLen {
+			n := copy(s.header[s.n:], b)
+			s.n += n
+			b = b[n:]
+			if s.n < h2FrameHeaderLen {
+				break
+			}
+			s.current = frameHeader{
+				length: int(s.header[0])<<16 | int(s.header[1])<<8 | int(s.header[2]),
+				typ:    s.header[3],
+				flags:  s.header[4],
+				stream: binary.BigEndian.Uint32(s.header[5:]) & 0x7fffffff,
+			}
+			s.left = s.current.length
+			s.payload = s.payload[:0]
+		}
+
+		n := min(s.left, len(b))
+		if keep := min(n, h2MaxKeptPayload-len(s.payload)); keep > 0 && s.current.typ != h2FrameData {
+			s.payload = append(s.payload, b[:keep]...)
+		}
+		s.left -= n
+		b = b[n:]
+
+		if s.left == 0 {
+			events = s.onFrame(s.current, s.payload, events)
+			s.n = 0
+		}
+	}
+	return events
+}
+
+// flowWindows are the flow-control windows of the DATA of one direction of a connection
+type flowWindows struct {
+	initial    int64 // SETTINGS_INITIAL_WINDOW_SIZE of the receiver
+	connection int64
+	streams    map[uint32]int64
+}
+
+func newFlowWindows() flowWindows {
+	return flowWindows{
+		initial:    h2DefaultWindowSize,
+		connection: h2DefaultWindowSize,
+		streams:    make(map[uint32]int64),
+	}
+}
+
+func (w *flowWindows) open(stream uint32) {
+	if _, ok := w.streams[stream]; !ok {
+		w.streams[stream] = w.initial
+	}
+}
+
+func (w *flowWindows) close(stream uint32) {
+	delete(w.streams, stream)
+}
+
+// setInitial changes the initial window of the streams, adjusting the open ones
+func (w *flowWindows) setInitial(initial int64) {
+	delta := initial - w.initial
+	w.initial = initial
+	for stream, window := range w.streams {
+		w.streams[stream] = window + delta
+	}
+}
+
+func (w *flowWindows) credit(stream uint32, increment int64) {
+	if stream == 0 {
+		w.connection += increment
+		return
+	}
+	if window, ok := w.streams[stream]; ok {
+		w.streams[stream] = window + increment
+	}
+}
+
+// consume debits a DATA frame, appending a stall for each window it exhausts
+func (w *flowWindows) consume(h frameHeader, direction string, events []http2Event) []http2Event {
+	size := int64(h.length)
+	if w.connection > 0 && w.connection-size <= 0 {
+		events = append(events, http2Event{stall: true, direction: direction, window: "connection"})
+	}
+	w.connection -= size
+
+	if window, ok := w.streams[h.stream]; ok {
+		if window > 0 && window-size <= 0 {
+			events = append(events, http2Event{stall: true, direction: direction, window: "stream"})
+		}
+		w.streams[h.stream] = window - size
+	}
+	if h.flags&h2FlagEndStream != 0 {
+		w.close(h.stream)
+	}
+	return events
+}
+
+// inspectedConn is a net.Conn whose HTTP/2 frames are inspected
+type inspectedConn struct {
+	net.Conn
+	frames *connFrames
+}
+
+func (c *inspectedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.frames.observe(false, p[:n])
+	}
+	return n, err
+}
+
+func (c *inspectedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.frames.observe(true, p[:n])
+	}
+	return n, err
+}
+
+// inspectedTLSConn is an inspectedConn over TLS, exposing the state of the TLS connection
+type inspectedTLSConn struct {
+	*inspectedConn
+	tls *tls.Conn
+}
+
+// ConnectionState returns the state of the TLS connection
+func (c *inspectedTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+// newInspectedTLSTransport creates the HTTP/2 transport over TLS of http2Frames. The
+// frames are only visible above TLS, which http.Transport doesn't let wrap.
+func newInspectedTLSTransport(tlsCfg *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	inspector *http2FrameInspector) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig:    tlsCfg,
+		DisableCompression: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, cfg)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			if p := tlsConn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+				_ = conn.Close()
+				return nil, fmt.Errorf("http2Frames requires HTTP/2, the server negotiated %q", p)
+			}
+			return inspector.wrap(tlsConn), nil
+		},
+	}
+}
+
+// validateHTTP2Frames checks that the connect parameters let the frames be inspected
+func validateHTTP2Frames(p *connectParams) error {
+	if p.HTTPVersion != "2" {
+		return errors.New("http2Frames requires httpVersion '2'")
+	}
+	if p.ConnectionStrategy == "global" {
+		return errors.New("http2Frames is not supported with the 'global' connectionStrategy: its metrics are per VU")
+	}
+	return nil
+}
+
+// http2FrameInspector returns the inspector recording the HTTP/2 events of the client
+func (c *Client) http2FrameInspector() *http2FrameInspector {
+	return &http2FrameInspector{onEvent: func(e http2Event) {
+		if c.metrics == nil {
+			return
+		}
+		if e.stall {
+			c.metrics.recordHTTP2Stall(c.vu.Context(), c.vu, c.baseURL, e.direction, e.window)
+		} else {
+			c.metrics.recordHTTP2Reset(c.vu.Context(), c.vu, c.baseURL, e.direction, e.code)
+		}
+	}}
+}
@@ -0,0 +1,63 @@
+package connectrpc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestConnFrames(t *testing.T) {
+	t.Parallel()
+
+	var events []http2Event
+	frames := newConnFrames(func(e http2Event) { events = append(events, e) })
+
+	var sent, received bytes.Buffer
+	client := http2.NewFramer(&sent, nil)
+	server := http2.NewFramer(&received, nil)
+
+	sent.WriteString(http2.ClientPreface)
+	require.NoError(t, client.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 1 << 20}))
+	require.NoError(t, server.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 1000}))
+	require.NoError(t, client.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: []byte{0x82}, EndHeaders: true}))
+
+	// Byte by byte, the frames are split at any point
+	for _, b := range received.Bytes() {
+		frames.observe(false, []byte{b})
+	}
+	frames.observe(true, sent.Bytes())
+	sent.Reset()
+	received.Reset()
+
+	// The 1000 bytes of the stream window are exhausted, then credited again
+	require.NoError(t, client.WriteData(1, false, make([]byte, 600)))
+	require.NoError(t, client.WriteData(1, false, make([]byte, 400)))
+	frames.observe(true, sent.Bytes())
+	assert.Equal(t, []http2Event{{stall: true, direction: "sent", window: "stream"}}, events)
+
+	require.NoError(t, server.WriteWindowUpdate(1, 500))
+	frames.observe(false, received.Bytes())
+	sent.Reset()
+	require.NoError(t, client.WriteData(1, false, make([]byte, 400)))
+	frames.observe(true, sent.Bytes())
+	assert.Len(t, events, 1)
+
+	// The server sends the whole 64KiB connection window of the client
+	events = nil
+	received.Reset()
+	for range 4 {
+		require.NoError(t, server.WriteData(1, false, make([]byte, 16384)))
+	}
+	frames.observe(false, received.Bytes())
+	assert.Equal(t, []http2Event{{stall: true, direction: "received", window: "connection"}}, events)
+
+	// Resets carry their error code
+	events = nil
+	received.Reset()
+	require.NoError(t, server.WriteRSTStream(1, http2.ErrCodeRefusedStream))
+	frames.observe(false, received.Bytes())
+	assert.Equal(t, []http2Event{{direction: "received", code: "REFUSED_STREAM"}}, events)
+}
@@ -0,0 +1,57 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+)
+
+const (
+	// defaultIdempotencyHeader is the header of the idempotency keys when `idempotencyHeader` sets none
+	defaultIdempotencyHeader = "Idempotency-Key"
+	// idempotencyKeyAuto is the `idempotencyKey` generating a new key for the call
+	idempotencyKeyAuto = "auto"
+)
+
+// parseIdempotencyKey parses the `idempotencyKey` call parameter: 'auto' generates a UUID
+// for a new logical operation, and a string reuses the key of a previous call, like a retry
+func parseIdempotencyKey(v sobek.Value) (string, error) {
+	if common.IsNullish(v) {
+		return "", nil
+	}
+	key, ok := v.Export().(string)
+	if !ok {
+		return "", fmt.Errorf("must be 'auto' or a string, got %s", v.ExportType())
+	}
+	switch key {
+	case "":
+		return "", errors.New("must not be empty")
+	case idempotencyKeyAuto:
+		return uuid.NewString(), nil
+	default:
+		return key, nil
+	}
+}
+
+// setIdempotencyKey sets the idempotency key of a call, if any, in the header of the connection
+func (c *Client) setIdempotencyKey(header http.Header, p *callParams) {
+	if p.IdempotencyKey == "" {
+		return
+	}
+	name := defaultIdempotencyHeader
+	if c.connectParams != nil && c.connectParams.IdempotencyHeader != "" {
+		name = c.connectParams.IdempotencyHeader
+	}
+	header.Set(name, p.IdempotencyKey)
+}
+
+// setIdempotencyKey returns the idempotency key of a call in its response, for retries to reuse it
+func (p *callParams) setIdempotencyKey(rt *sobek.Runtime, response *sobek.Object) {
+	if p.IdempotencyKey != "" {
+		must(rt, response.Set("idempotencyKey", p.IdempotencyKey))
+	}
+}
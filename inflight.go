@@ -0,0 +1,113 @@
+package connectrpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/metrics"
+)
+
+// parseMaxInFlight parses the `maxInFlight` connect and call parameters, the number of
+// asyncInvoke() calls a client sends at once
+func parseMaxInFlight(v sobek.Value) (int, error) {
+	if common.IsNullish(v) {
+		return 0, nil
+	}
+	limit, ok := v.Export().(int64)
+	if !ok || limit < 1 {
+		return 0, fmt.Errorf("must be a positive integer, got %v", v)
+	}
+	return int(limit), nil
+}
+
+// inFlightLimiter queues the asyncInvoke() calls of a client beyond maxInFlight, and starts
+// them in order as the calls in flight complete. Queued calls have no goroutine, so
+// Promise.all() over thousands of calls neither floods the target nor the load generator.
+type inFlightLimiter struct {
+	mu       sync.Mutex
+	inFlight int
+	queue    []queuedCall
+}
+
+// queuedCall is an asyncInvoke() call waiting for fewer than limit calls in flight
+type queuedCall struct {
+	limit  int
+	queued time.Time
+	run    func(queued time.Duration)
+}
+
+// start runs the call in a goroutine once fewer than limit calls are in flight, 0 for no
+// limit, passing it the time it was queued. The call must end with done().
+func (l *inFlightLimiter) start(limit int, run func(queued time.Duration)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit == 0 || (l.inFlight < limit && len(l.queue) == 0) {
+		l.inFlight++
+		go run(0)
+		return
+	}
+	l.queue = append(l.queue, queuedCall{limit: limit, queued: time.Now(), run: run})
+}
+
+// done ends a call started by start(), starting the queued calls its slot makes room for
+func (l *inFlightLimiter) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	for len(l.queue) > 0 && l.inFlight < l.queue[0].limit {
+		call := l.queue[0]
+		l.queue[0] = queuedCall{}
+		l.queue = l.queue[1:]
+		l.inFlight++
+		go call.run(time.Since(call.queued))
+	}
+}
+
+// pending returns the number of calls in flight or queued
+func (l *inFlightLimiter) pending() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inFlight + len(l.queue)
+}
+
+// maxInFlight returns the limit of in-flight asyncInvoke() calls of a call, which overrides
+// the one of the connection, 0 for none
+func (c *Client) maxInFlight(p *callParams) int {
+	if p.MaxInFlight > 0 {
+		return p.MaxInFlight
+	}
+	if c.connectParams != nil {
+		return c.connectParams.MaxInFlight
+	}
+	return 0
+}
+
+// recordQueued records the time an asyncInvoke() call waited for its slot under maxInFlight
+func (m *instanceMetrics) recordQueued(ctx context.Context, vu modules.VU, tags MetricTags, queued time.Duration) {
+	state := vu.State()
+	if state == nil {
+		return
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCReqQueuedDuration,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(queued),
+	}))
+}
@@ -1,10 +1,27 @@
 package connectrpc_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"connectrpc.com/connect"
 	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/metrics"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // TestIntegrationBasicPingWithServer tests basic functionality using our test server
@@ -60,16 +77,19 @@ func TestIntegrationHTTPVersionConfiguration(t *testing.T) {
 	t.Parallel()
 
 	srv := connectrpc.NewTestServer(false)
-	defer srv.Close()
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
 
+	// In plaintext, HTTP/2 uses h2c with prior knowledge
 	testCases := []struct {
 		Name        string
 		HTTPVersion string
+		Proto       string
 	}{
-		{"Default HTTP version", ""},
-		{"HTTP 1.1", "1.1"},
-		{"HTTP 2", "2"},
-		{"Auto HTTP version", "auto"},
+		{"Default HTTP version", "", "HTTP/2.0"},
+		{"HTTP 1.1", "1.1", "HTTP/1.1"},
+		{"HTTP 2", "2", "HTTP/2.0"},
+		{"Auto HTTP version", "auto", "HTTP/2.0"},
 	}
 
 	for _, tc := range testCases {
@@ -98,19 +118,66 @@ func TestIntegrationHTTPVersionConfiguration(t *testing.T) {
 			}
 			configJS += `}`
 
-			// Test connection with specific HTTP version
-			_, err = ts.Run(`
+			// The response tells the HTTP version actually used
+			val, err := ts.Run(`
 				var client = new connectrpc.Client();
-				// Test that the HTTP version configuration is accepted
 				client.connect('` + srv.URL + `', ` + configJS + `);
+				var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
 				client.close();
-				'http-version-config-accepted';
+				response.proto;
 			`)
 			require.NoError(t, err)
+			assert.Equal(t, tc.Proto, val.String())
 		})
 	}
 }
 
+// TestIntegrationH2CBidiStreaming tests gRPC bidi streaming over plaintext HTTP/2
+func TestIntegrationH2CBidiStreaming(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				protocol: 'grpc',
+				contentType: 'application/proto',
+				plaintext: true,
+				httpVersion: '2'
+			});
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var sums = [];
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('data', function(data) { sums.push(data.sum); });
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+
+			stream.write({ number: 1 });
+			stream.write({ number: 2 });
+			stream.end();
+			await ended;
+
+			call(JSON.stringify({ sums: sums, proto: stream.info().proto }));
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`{"sums":["1","3"],"proto":"HTTP/2.0"}`}, ts.callRecorder.Recorded())
+}
+
 // TestIntegrationTimeoutConfiguration tests timeout settings
 func TestIntegrationTimeoutConfiguration(t *testing.T) {
 	t.Parallel()
@@ -598,6 +665,195 @@ func TestAsyncInvokeParallelCalls(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestAsyncInvokeMaxInFlight tests that asyncInvoke() calls beyond maxInFlight are queued
+func TestAsyncInvokeMaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	handler := connectrpc.NewTestHandler(false)
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	maxReached := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return maxInFlight
+	}
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, maxInFlight: 2 });
+			var calls = [];
+			for (var i = 1; i <= 8; i++) {
+				calls.push(client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i }));
+			}
+			var responses = await Promise.all(calls);
+			call(responses.map(function(r) { return r.message.number; }).join(','));
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1,2,3,4,5,6,7,8"}, ts.callRecorder.Recorded())
+	assert.Equal(t, 2, maxReached())
+
+	queued := findSamples(drainSamples(ts.samples), "connectrpc_req_queued_duration")
+	require.Len(t, queued, 8)
+	var waited int
+	for _, sample := range queued {
+		if sample.Value > 0 {
+			waited++
+		}
+	}
+	assert.Equal(t, 6, waited)
+
+	// The call parameter overrides the connect one
+	mu.Lock()
+	maxInFlight = 0
+	mu.Unlock()
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, maxInFlight: 4 });
+			var calls = [];
+			for (var i = 0; i < 3; i++) {
+				calls.push(client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i }, { maxInFlight: 1 }));
+			}
+			await Promise.all(calls);
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, maxReached())
+
+	_, err = ts.Run(`new connectrpc.Client().connect('` + srv.URL + `', { plaintext: true, maxInFlight: 0 })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid maxInFlight: must be a positive integer, got 0")
+}
+
+// TestAsyncInvokeConcurrency tests that asyncInvoke() calls in flight together with invoke()
+// calls and streams share the connection of the client safely. CI runs it with -race.
+func TestAsyncInvokeConcurrency(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	for _, strategy := range []string{"per-vu", "per-iteration", "per-call"} {
+		strategy := strategy
+		t.Run(strategy, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			_, err = ts.RunOnEventLoop(`
+				(async function() {
+					var client = new connectrpc.Client();
+					client.connect('` + srv.URL + `', { plaintext: true, connectionStrategy: '` + strategy + `' });
+					var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+
+					var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+					var sums = [];
+					var streamEnded = new Promise(function(resolve) {
+						stream.on('data', function(msg) { sums.push(msg.sum); });
+						stream.on('end', resolve);
+					});
+
+					var calls = [];
+					for (var i = 1; i <= 20; i++) {
+						calls.push(client.asyncInvoke(method, { number: i }));
+						if (i % 5 === 0) {
+							stream.write({ number: i });
+							calls.push(Promise.resolve(client.invoke(method, { number: -i })));
+						}
+					}
+
+					var responses = await Promise.all(calls);
+					stream.end();
+					await streamEnded;
+					client.close();
+
+					// The connection can't be replaced while calls are in flight. The handlers
+					// of a mock:// address run once the event loop is free, so the call is.
+					var mocked = new connectrpc.Client();
+					mocked.connect('mock://', {
+						connectionStrategy: '` + strategy + `',
+						handlers: { '/k6.connectrpc.ping.v1.PingService/Ping': function(request) { return request; } },
+					});
+					var pending = mocked.asyncInvoke(method, { number: 1 });
+					var failed = '';
+					try {
+						mocked.connect('mock://');
+					} catch (e) {
+						failed = e.message;
+					}
+					await pending;
+					mocked.connect('mock://');
+					mocked.close();
+					call(JSON.stringify({
+						numbers: responses.map(function(r) { return r.message.number; }),
+						sums: sums,
+						failed: failed,
+					}));
+				})();
+			`)
+			require.NoError(t, err)
+
+			var result struct {
+				Numbers []string
+				Sums    []string
+				Failed  string
+			}
+			require.NoError(t, json.Unmarshal([]byte(ts.callRecorder.Recorded()[0]), &result))
+			want := []string{}
+			for i := 1; i <= 20; i++ {
+				want = append(want, strconv.Itoa(i))
+				if i%5 == 0 {
+					want = append(want, strconv.Itoa(-i))
+				}
+			}
+			assert.Equal(t, want, result.Numbers)
+			assert.Equal(t, []string{"5", "15", "30", "50"}, result.Sums)
+			assert.Equal(t, "connect() called while 1 asyncInvoke() calls of the client are in flight: "+
+				"await them before connecting again, or use another client", result.Failed)
+
+			containers := drainSamples(ts.samples)
+			misuses := findSamples(containers, "connectrpc_api_misuse")
+			require.Len(t, misuses, 1)
+			assert.Equal(t, "connect_in_flight", misuses[0].Tags.Map()["misuse"])
+			if strategy == "per-iteration" {
+				// The calls and the stream of the iteration share one connection, then each
+				// connect() of the mock one has its own
+				assert.Len(t, findSamples(containers, "connectrpc_connections"), 3)
+			}
+		})
+	}
+}
+
 // TestAsyncInvokeWithHeaders tests that asyncInvoke works with custom headers
 func TestAsyncInvokeWithHeaders(t *testing.T) {
 	t.Parallel()
@@ -651,3 +907,1631 @@ func TestAsyncInvokeWithHeaders(t *testing.T) {
 	`)
 	require.NoError(t, err)
 }
+
+// TestFaultInjection tests client-side latency and abort injection
+func TestInvokeWithoutRequest(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(true)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, headers: { 'client-header': 'some-value' } });
+
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var responses = [
+				client.invoke(method),
+				client.invoke(method, null),
+				client.invoke(method, undefined, { timeout: '10s' }),
+				await client.asyncInvoke(method),
+				await client.asyncInvoke(method, null),
+			];
+			responses.forEach(function(res, i) {
+				if (res.status !== 200) {
+					throw new Error('call ' + i + ' failed: ' + JSON.stringify(res.message));
+				}
+			});
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+}
+
+func TestSetDefaultHeaders(t *testing.T) {
+	t.Parallel()
+
+	// The server fails the calls without the client-header: some-value header
+	srv := connectrpc.NewTestServer(true)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, headers: { 'client-header': 'expired' } });
+
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var sent = function(res) {
+				return res.status === 200 ? 'ok' : res.message.message;
+			};
+			var stream = function() {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+				stream.write({ number: 1 });
+				stream.end();
+				return new Promise(function(resolve) {
+					stream.on('end', function() { resolve('ok'); });
+					stream.on('error', function(e) { resolve(e.message); });
+				});
+			};
+
+			var results = [sent(client.invoke(method))];
+			client.setDefaultHeaders({ 'Client-Header': 'some-value', 'x-session': 'abc' });
+			results.push(sent(client.invoke(method)));
+			results.push(sent(await client.asyncInvoke(method)));
+			results.push(await stream());
+			results.push(sent(client.invoke(method, null, { headers: { 'client-header': 'call' } })));
+
+			// Removing a default header removes the connection-level one too
+			client.setDefaultHeaders({ 'client-header': null });
+			results.push(sent(client.invoke(method)));
+
+			// Clearing the default headers restores the connection-level ones
+			client.setDefaultHeaders(null);
+			results.push(sent(client.invoke(method)));
+			client.close();
+			call(JSON.stringify(results));
+		})();
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		"invalid_argument: expected header \"some-value\": got \"expired\"",
+		"ok",
+		"ok",
+		"ok",
+		"invalid_argument: expected header \"some-value\": got \"call\"",
+		"invalid_argument: expected header \"some-value\": got \"\"",
+		"invalid_argument: expected header \"some-value\": got \"expired\""
+	]`, ts.callRecorder.Recorded()[0])
+
+	testCases := []struct {
+		Name        string
+		Headers     string
+		ErrContains string
+	}{
+		{"NotAnObject", `'Bearer token'`, "invalid setDefaultHeaders() headers: must be an object with key-value pairs"},
+		{"Name", `{ 'bad header': 'value' }`, `invalid setDefaultHeaders() headers: "bad header" is not a valid header name`},
+		{"Value", `{ 'x-session': 42 }`, `invalid setDefaultHeaders() headers: "x-session" value must be a string`},
+	}
+	for _, tc := range testCases {
+		_, err := ts.Run(`new connectrpc.Client().setDefaultHeaders(` + tc.Headers + `);`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
+
+	t.Run("Abort", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestState(t)
+
+		_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+		require.NoError(t, err)
+
+		ts.ToVUContext()
+
+		_, err = ts.Run(`
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				plaintext: true,
+				faultInjection: { abort: { percent: 100, code: 'resource_exhausted' } }
+			});
+
+			var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			if (res.status !== 429) {
+				throw new Error('Expected status 429, got ' + res.status);
+			}
+			if (res.message.code !== 'resource_exhausted') {
+				throw new Error('Expected code resource_exhausted, got ' + res.message.code);
+			}
+			client.close();
+		`)
+		require.NoError(t, err)
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestState(t)
+
+		_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+		require.NoError(t, err)
+
+		ts.ToVUContext()
+
+		_, err = ts.Run(`
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', {
+				plaintext: true,
+				faultInjection: { delay: { percent: 100, duration: '100ms' } }
+			});
+
+			var start = Date.now();
+			var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			var elapsed = Date.now() - start;
+			if (res.status !== 200) {
+				throw new Error('Expected status 200, got ' + res.status);
+			}
+			if (elapsed < 100) {
+				throw new Error('Expected at least 100ms of injected latency, got ' + elapsed + 'ms');
+			}
+			client.close();
+		`)
+		require.NoError(t, err)
+	})
+
+	t.Run("StreamAbort", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestState(t)
+
+		_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+		require.NoError(t, err)
+
+		ts.ToVUContext()
+
+		_, err = ts.RunOnEventLoop(`
+			(async function() {
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', {
+					plaintext: true,
+					faultInjection: { abort: { percent: 100 } }
+				});
+
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+				var failed = new Promise(function(resolve, reject) {
+					stream.on('error', function(err) {
+						resolve(err.code);
+					});
+					stream.on('end', function() {
+						reject(new Error('Expected the stream to be aborted'));
+					});
+				});
+
+				stream.write({ number: 1 });
+
+				var code = await failed;
+				if (code !== 'unavailable') {
+					throw new Error('Expected code unavailable, got ' + code);
+				}
+				client.close();
+			})();
+		`)
+		require.NoError(t, err)
+	})
+}
+
+func TestResponseCallback(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		connectrpc.setResponseCallback(connectrpc.expectedStatuses('ok', 'not_found'));
+
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true, tags: { team: 'payments' } });
+
+		// Expected by the module default
+		client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 }, { tags: { call: 'expected' } });
+
+		// The call-level callback overrides the module default
+		client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 }, {
+			responseCallback: connectrpc.expectedStatuses('ok'),
+			tags: { call: 'unexpected' },
+		});
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+
+	errs := findSamples(containers, "connectrpc_req_errors")
+	require.Len(t, errs, 1)
+	call, _ := errs[0].Tags.Get("call")
+	assert.Equal(t, "unexpected", call)
+
+	reqs := findSamples(containers, "connectrpc_reqs")
+	require.Len(t, reqs, 2)
+	for _, sample := range reqs {
+		team, _ := sample.Tags.Get("team")
+		assert.Equal(t, "payments", team)
+
+		call, _ := sample.Tags.Get("call")
+		expected, _ := sample.Tags.Get("expected_response")
+		assert.Equal(t, call == "expected", expected == "true")
+	}
+}
+
+func TestLazyResponseMessage(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true, contentType: 'application/json' });
+
+		var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 7, text: 'lazy' });
+
+		// The converted message is cached, so changes are kept
+		var message = response.message;
+		if (response.message !== message) {
+			throw new Error('expected the same message object on every access');
+		}
+		message.extra = true;
+
+		var replaced = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 8 });
+		replaced.message = 'replaced';
+
+		JSON.stringify([response.message, replaced.message]);
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"number":"7","text":"lazy","extra":true},"replaced"]`, val.String())
+}
+
+func TestInvokePrepared(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
+
+	for _, contentType := range []string{"application/json", "application/proto"} {
+		contentType := contentType
+		t.Run(contentType, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`
+				connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+				var prepared = connectrpc.precompile('/k6.connectrpc.ping.v1.PingService/Ping', function() {
+					return [{ number: 1 }, { number: 2, text: 'two' }];
+				});
+			`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			val, err := ts.Run(`
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', { plaintext: true, contentType: '` + contentType + `' });
+
+				var response = client.invokePrepared(prepared, 1);
+				if (response.status !== 200) {
+					throw new Error('unexpected status: ' + response.status);
+				}
+
+				try {
+					client.invokePrepared(prepared, 2);
+					throw new Error('expected an out of range error');
+				} catch (e) {
+					if (e.message.indexOf('out of range') < 0) {
+						throw e;
+					}
+				}
+
+				JSON.stringify({ length: prepared.length, message: response.message });
+			`)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"length":2,"message":{"number":"2","text":"two"}}`, val.String())
+
+			reqs := findSamples(drainSamples(ts.samples), "connectrpc_reqs")
+			require.Len(t, reqs, 1)
+			method, _ := reqs[0].Tags.Get("method")
+			assert.Equal(t, "/k6.connectrpc.ping.v1.PingService/Ping", method)
+		})
+	}
+}
+
+func TestReturnHeaders(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+		var allowed = client.invoke(method, { number: 1 }, { returnHeaders: ['handler-header'] });
+		var none = client.invoke(method, { number: 1 }, { returnHeaders: false });
+		var discarded = client.invoke(method, { number: 1 }, { discardResponse: true });
+
+		JSON.stringify({
+			allowed: Object.keys(allowed.headers),
+			none: Object.keys(none.headers).length,
+			discarded: [discarded.message, Object.keys(discarded.headers).length, Object.keys(discarded.trailers).length],
+		});
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"allowed":["Handler-Header"],"none":0,"discarded":[null,0,0]}`, val.String())
+}
+
+func TestHeaderFormat(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var headers = async function(format) {
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', { plaintext: true, headerFormat: format });
+
+				var sync = client.invoke(method, { number: 1 });
+				var async = await client.asyncInvoke(method, { number: 1 });
+				var failed = client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+				var meta = new Promise(function(resolve) { stream.on('endMeta', resolve); });
+				stream.write({ number: 1 });
+				stream.end();
+				var endMeta = await meta;
+				client.close();
+
+				call(JSON.stringify({
+					header: sync.headers['handler-header'] || sync.headers['Handler-Header'],
+					trailer: async.trailers.getHeader('HANDLER-TRAILER'),
+					missing: typeof sync.headers.getHeader('x-missing'),
+					keys: Object.keys(failed.headers).indexOf('getHeader'),
+					stream: [endMeta.headers.getHeader('handler-header'), endMeta.trailers.getHeader('Handler-Trailer')],
+					json: JSON.stringify(endMeta.headers).indexOf('getHeader'),
+				}));
+			};
+			await headers('multi');
+			await headers('flat');
+		})();
+	`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`{"header":["some-value"],"trailer":"some-trailer-value","missing":"undefined","keys":-1,"stream":["some-value","some-trailer-value"],"json":-1}`,
+		`{"header":"some-value","trailer":"some-trailer-value","missing":"undefined","keys":-1,"stream":["some-value","some-trailer-value"],"json":-1}`,
+	}, ts.callRecorder.Recorded())
+
+	_, err = ts.Run(`new connectrpc.Client().connect('` + srv.URL + `', { plaintext: true, headerFormat: 'lower' })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid headerFormat: lower. Must be 'multi' or 'flat'")
+}
+
+func TestResponseTrailers(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
+
+	for _, protocol := range []string{"connect", "grpc", "grpc-web"} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			_, err = ts.RunOnEventLoop(`
+				(async function() {
+					var client = new connectrpc.Client();
+					client.connect('` + srv.URL + `', { protocol: '` + protocol + `', plaintext: true });
+
+					var ping = '/k6.connectrpc.ping.v1.PingService/Ping';
+					var fail = '/k6.connectrpc.ping.v1.PingService/Fail';
+					var ok = client.invoke(ping, { number: 1 });
+					var asyncOk = await client.asyncInvoke(ping, { number: 1 });
+					var failed = client.invoke(fail, { code: 5 });
+					var asyncFailed = await client.asyncInvoke(fail, { code: 5 });
+					client.close();
+
+					call(JSON.stringify({
+						trailers: [ok, asyncOk, failed, asyncFailed].map(function(response) {
+							return response.trailers['Handler-Trailer'];
+						}),
+						headers: [ok, failed].map(function(response) {
+							return response.headers['Handler-Header'];
+						}),
+					}));
+				})();
+			`)
+			require.NoError(t, err)
+
+			// The trailers of the handler are returned as trailers in every protocol, even
+			// when connect-go merges them with the headers in the metadata of an error
+			failedHeader := `["some-value"]`
+			if protocol == "grpc" {
+				// gRPC sends the metadata of an error in the trailers, after the headers
+				failedHeader = `null`
+			}
+			require.Len(t, ts.callRecorder.Recorded(), 1)
+			assert.JSONEq(t, `{
+				"trailers": [["some-trailer-value"], ["some-trailer-value"], ["some-trailer-value"], ["some-trailer-value"]],
+				"headers": [["some-value"], `+failedHeader+`]
+			}`, ts.callRecorder.Recorded()[0])
+		})
+	}
+}
+
+func TestJSONOptions(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var numbers = async function(params) {
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', params);
+
+				var sync = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 21 });
+				var async = await client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 4 });
+
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+				var sums = [];
+				var ended = new Promise(function(resolve) { stream.on('end', resolve); });
+				stream.on('data', function(msg) { sums.push(msg.sum + 1); });
+				stream.write({ number: 1 });
+				stream.write({ number: 2 });
+				stream.end();
+				await ended;
+				client.close();
+
+				call(JSON.stringify([sync.message.number + 1, async.message.number + 1, sums]));
+			};
+			await numbers({ plaintext: true });
+			await numbers({ plaintext: true, jsonOptions: { int64AsNumber: true } });
+		})();
+	`)
+	require.NoError(t, err)
+
+	// The 64-bit integers are strings by default, which JS concatenates
+	assert.Equal(t, []string{`["211","41",["11","31"]]`, `[22,5,[2,4]]`}, ts.callRecorder.Recorded())
+}
+
+func TestUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var userAgents, clientVersions []string
+	handler := connectrpc.NewTestHandler(false)
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		clientVersions = append(clientVersions, r.Header.Get("X-Client-Version"))
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			client.close();
+
+			client.connect('` + srv.URL + `', {
+				plaintext: true,
+				userAgent: 'checkout-load-test/1.0',
+				headers: { 'x-client-version': '2.3.0' },
+			});
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			stream.write({ number: 1 });
+			stream.end();
+			await ended;
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, userAgents, 3)
+	assert.Regexp(t, `^k6-connectrpc/\S+ k6/\S+$`, userAgents[0])
+	assert.Equal(t, []string{"checkout-load-test/1.0", "checkout-load-test/1.0"}, userAgents[1:])
+	assert.Equal(t, []string{"", "2.3.0", "2.3.0"}, clientVersions)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var keys []string
+	handler := connectrpc.NewTestHandler(false)
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key")+"|"+r.Header.Get("X-Request-Key"))
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			var first = client.invoke(method, { number: 1 }, { idempotencyKey: 'auto' });
+			var retry = client.invoke(method, { number: 1 }, { idempotencyKey: first.idempotencyKey });
+			var other = client.invoke(method, { number: 1 }, { idempotencyKey: 'auto' });
+			var none = client.invoke(method, { number: 1 });
+			client.close();
+
+			client.connect('` + srv.URL + `', { plaintext: true, idempotencyHeader: 'x-request-key' });
+			var async = await client.asyncInvoke(method, { number: 1 }, { idempotencyKey: 'order-42' });
+			client.close();
+
+			call(JSON.stringify({
+				sameKey: first.idempotencyKey === retry.idempotencyKey,
+				newKey: first.idempotencyKey !== other.idempotencyKey,
+				none: none.idempotencyKey === undefined,
+				async: async.idempotencyKey,
+			}));
+		})();
+	`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`{"sameKey":true,"newKey":true,"none":true,"async":"order-42"}`}, ts.callRecorder.Recorded())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, keys, 5)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}\|$`, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.NotEqual(t, keys[0], keys[2])
+	assert.Equal(t, []string{"|", "|order-42"}, keys[3:])
+}
+
+func TestSLO(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false, connectrpc.WithLatency(connectrpc.FixedLatency(20*time.Millisecond)))
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+			client.invoke(method, { number: 1 }, { slo: '1ms' });
+			client.invoke(method, { number: 2 }, { slo: '10s' });
+			client.invoke(method, { number: 3 });
+			await client.asyncInvoke(method, { number: 4 }, { slo: '5ms' });
+			client.close();
+			call('done');
+		})();
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	var breaches []string
+	for _, sample := range findSamples(containers, "connectrpc_req_duration") {
+		breach, _ := sample.Tags.Get("slo_breach")
+		breaches = append(breaches, breach)
+	}
+	assert.Equal(t, []string{"true", "false", "", "true"}, breaches)
+	assert.Len(t, findSamples(containers, "connectrpc_slo_breaches"), 2)
+}
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var ids []string
+	handler := connectrpc.NewTestHandler(false)
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get("X-Request-Id")+"|"+r.Header.Get("X-Correlation-Id"))
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, requestId: true });
+			var ok = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			var failed = client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+			client.close();
+
+			client.connect('` + srv.URL + `', { plaintext: true, requestId: 'x-correlation-id' });
+			var async = await client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			client.close();
+
+			client.connect('` + srv.URL + `', { plaintext: true });
+			var none = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			client.close();
+
+			call(ok.requestId);
+			call(failed.requestId);
+			call(async.requestId);
+			call(String(none.requestId === undefined));
+		})();
+	`)
+	require.NoError(t, err)
+
+	returned := ts.callRecorder.Recorded()
+	require.Len(t, returned, 4)
+	assert.Equal(t, "true", returned[3])
+
+	mu.Lock()
+	assert.Equal(t, []string{
+		returned[0] + "|",
+		returned[1] + "|",
+		"|" + returned[2],
+		"|",
+	}, ids)
+	mu.Unlock()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`, returned[0])
+	assert.NotEqual(t, returned[0], returned[1])
+
+	containers := drainSamples(ts.samples)
+	errorSamples := findSamples(containers, "connectrpc_req_errors")
+	require.Len(t, errorSamples, 1)
+	assert.Equal(t, returned[1][:2], errorSamples[0].Tags.Map()["request_id_prefix"])
+	assert.Equal(t, returned[1], errorSamples[0].Metadata["request_id"])
+	for _, sample := range findSamples(containers, "connectrpc_reqs") {
+		assert.NotContains(t, sample.Tags.Map(), "request_id_prefix")
+	}
+
+	_, err = ts.Run(`new connectrpc.Client().connect('` + srv.URL + `', { plaintext: true, requestId: 'bad header' })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid requestId: invalid header name "bad header"`)
+}
+
+func TestSetGlobalOptions(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		connectrpc.setGlobalOptions({
+			defaultProtocol: 'grpc',
+			defaultContentType: 'application/proto',
+			defaultTimeout: '5s',
+			metricPrefix: 'team_',
+		});
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var resp = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+		if (resp.status !== 200) {
+			throw new Error('Expected status 200, got ' + resp.status);
+		}
+
+		try {
+			connectrpc.setGlobalOptions({ defaultProtocol: 'connect' });
+			throw new Error('setGlobalOptions should fail outside of the init context');
+		} catch (e) {
+			if (e.message.indexOf('init context') === -1) {
+				throw e;
+			}
+		}
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	assert.Empty(t, findSamples(containers, "connectrpc_reqs"))
+
+	reqs := findSamples(containers, "team_connectrpc_reqs")
+	require.Len(t, reqs, 1)
+	protocol, _ := reqs[0].Tags.Get("protocol")
+	assert.Equal(t, "grpc", protocol)
+	contentType, _ := reqs[0].Tags.Get("content_type")
+	assert.Equal(t, "application/proto", contentType)
+}
+
+func TestSummaryHelpers(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+
+		var thresholds = connectrpc.summaryThresholds('/k6.connectrpc.ping.v1.PingService/Ping');
+		if (!Array.isArray(thresholds['connectrpc_reqs{method:/k6.connectrpc.ping.v1.PingService/Ping}'])) {
+			throw new Error('Ping reqs missing from the thresholds: ' + JSON.stringify(thresholds));
+		}
+
+		// The submetrics of the thresholds, as k6 passes them to handleSummary
+		var data = { metrics: {
+			'connectrpc_reqs{method:/k6.connectrpc.ping.v1.PingService/Ping}': { values: { count: 1, rate: 1 } },
+			'connectrpc_req_duration{method:/k6.connectrpc.ping.v1.PingService/Ping}': { values: { 'p(95)': 1.5 } },
+		} };
+		var text = connectrpc.textSummary(data);
+		if (text.indexOf('/k6.connectrpc.ping.v1.PingService/Ping') === -1) {
+			throw new Error('Ping missing from text summary: ' + text);
+		}
+
+		var json = JSON.parse(connectrpc.jsonSummary(data));
+		var ping = json.methods.filter(function (m) {
+			return m.method === '/k6.connectrpc.ping.v1.PingService/Ping';
+		})[0];
+		if (!ping || ping.type !== 'unary' || ping.reqs < 1) {
+			throw new Error('unexpected Ping summary: ' + JSON.stringify(json));
+		}
+	`)
+	require.NoError(t, err)
+}
+
+func TestServerTiming(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true, serverTimingMetrics: true });
+
+		var response = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+		JSON.stringify(response.serverTiming);
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"name": "db", "duration": 1.5, "description": "Query"},
+		{"name": "cache", "description": "miss"},
+		{"name": "app", "duration": 3}
+	]`, val.String())
+
+	timings := findSamples(drainSamples(ts.samples), "connectrpc_server_timing")
+	require.Len(t, timings, 2)
+	for _, sample := range timings {
+		timing, _ := sample.Tags.Get("timing")
+		switch timing {
+		case "db":
+			assert.InDelta(t, 1.5, sample.Value, 0.001)
+		case "app":
+			assert.InDelta(t, 3.0, sample.Value, 0.001)
+		default:
+			t.Errorf("unexpected timing tag %q", timing)
+		}
+	}
+}
+
+func TestInvokeTemplate(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var template = '{"number": "${n}", "text": "user-${n}"}';
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+		var results = [];
+		for (var i = 1; i <= 2; i++) {
+			var response = client.invokeTemplate(method, template, { n: i });
+			results.push(response.message.number + ':' + response.message.text);
+		}
+
+		var fromObject = client.invokeTemplate(method, { number: '${n}' }, { n: 5 });
+		results.push(fromObject.message.number);
+
+		try {
+			client.invokeTemplate(method, template, {});
+		} catch (e) {
+			results.push(e.message);
+		}
+
+		results.join(',');
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, `1:user-1,2:user-2,5,failed to marshal request object: missing template variable "n"`, val.String())
+}
+
+func TestIgnoreUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+		var request = { number: 3, addedInV2: 'x' };
+
+		var strict = new connectrpc.Client();
+		strict.connect('` + srv.URL + `', { plaintext: true });
+		var results = [];
+		try {
+			strict.invoke(method, request);
+		} catch (e) {
+			results.push(e.message);
+		}
+		results.push(strict.invoke(method, request, { ignoreUnknownFields: true }).message.number);
+
+		var tolerant = new connectrpc.Client();
+		tolerant.connect('` + srv.URL + `', { plaintext: true, ignoreUnknownFields: true });
+		results.push(tolerant.invoke(method, request).message.number);
+		try {
+			tolerant.invoke(method, request, { ignoreUnknownFields: false });
+		} catch (e) {
+			results.push(e.message);
+		}
+
+		JSON.stringify(results);
+	`)
+	require.NoError(t, err)
+
+	unknown := "failed to unmarshal JSON into dynamic protobuf message: field addedInV2: unknown field of k6.connectrpc.ping.v1.PingRequest"
+	assert.JSONEq(t, `["`+unknown+`", "3", "3", "`+unknown+`"]`, val.String())
+}
+
+func TestPeerInfo(t *testing.T) {
+	t.Parallel()
+
+	h2c := connectrpc.NewTestServer(false)
+	defer h2c.Close()
+	// The TLS test server only offers HTTP/1.1, so the client falls back to it
+	tls := connectrpc.NewTLSTestServer(false)
+	defer tls.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var peer = function(r) { return { proto: r.proto, remoteAddr: r.remoteAddr, alpn: r.alpn }; };
+
+			var client = new connectrpc.Client();
+			client.connect('` + h2c.URL + `', { plaintext: true });
+			var results = {
+				invoke: peer(client.invoke(method, { number: 1 })),
+				asyncInvoke: peer(await client.asyncInvoke(method, { number: 1 })),
+			};
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			results.beforeResponse = stream.info();
+			var received = new Promise(function(resolve) {
+				stream.on('data', resolve);
+			});
+			stream.write({ number: 1 });
+			await received;
+			results.stream = stream.info();
+			client.close();
+
+			var fallback = new connectrpc.Client();
+			fallback.connect('` + tls.URL + `', { tls: { insecureSkipVerify: true } });
+			results.fallback = peer(fallback.invoke(method, { number: 1 }));
+			fallback.close();
+
+			call(JSON.stringify(results));
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 1)
+
+	h2cPeer := `{"proto": "HTTP/2.0", "remoteAddr": "` + h2c.Listener.Addr().String() + `", "alpn": ""}`
+	assert.JSONEq(t, `{
+		"invoke": `+h2cPeer+`,
+		"asyncInvoke": `+h2cPeer+`,
+		"beforeResponse": {"proto": "", "remoteAddr": "", "alpn": ""},
+		"stream": `+h2cPeer+`,
+		"fallback": {"proto": "HTTP/1.1", "remoteAddr": "`+tls.Listener.Addr().String()+`", "alpn": "http/1.1"}
+	}`, recorded[0])
+}
+
+func TestClientSaturation(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+	logger, ok := ts.logger.(*logrus.Logger)
+	require.True(t, ok)
+	hook := logtest.NewLocal(logger)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	// The script keeps the event loop busy while the responses are back
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			for (var i = 0; i < 2; i++) {
+				var pending = client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i });
+				var until = Date.now() + 300;
+				while (Date.now() < until) {}
+				await pending;
+			}
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	samples := findSamples(drainSamples(ts.samples), "connectrpc_client_saturation")
+	require.Len(t, samples, 2)
+	for _, sample := range samples {
+		source, _ := sample.Tags.Get("source")
+		assert.Equal(t, "event_loop", source)
+		assert.Greater(t, sample.Value, 50.0)
+	}
+
+	// The warning is logged once per VU
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "the JS event loop was busy, delaying /k6.connectrpc.ping.v1.PingService/Ping by")
+}
+
+// TestTestServerOptions tests the latency, errors, response size and connection failures
+// injected by the test server
+func TestTestServerOptions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name           string
+		Opts           []connectrpc.TestServerOption
+		Script         string
+		NewConnections int // HTTP connections opened by the script, 0 to not check them
+	}{
+		{
+			Name: "Latency",
+			Opts: []connectrpc.TestServerOption{connectrpc.WithLatency(connectrpc.FixedLatency(100 * time.Millisecond))},
+			Script: `
+				var start = Date.now();
+				var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+				var elapsed = Date.now() - start;
+				if (res.status !== 200) {
+					throw new Error('Expected status 200, got ' + res.status);
+				}
+				if (elapsed < 100) {
+					throw new Error('Expected at least 100ms of latency, got ' + elapsed + 'ms');
+				}
+			`,
+		},
+		{
+			Name: "ErrorRate",
+			Opts: []connectrpc.TestServerOption{connectrpc.WithErrorRate(100, connect.CodeUnavailable)},
+			Script: `
+				var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+				if (res.message.code !== 'unavailable') {
+					throw new Error('Expected code unavailable, got ' + res.message.code);
+				}
+				if (res.message.message !== 'unavailable: injected error') {
+					throw new Error('Expected the injected error, got ' + res.message.message);
+				}
+			`,
+		},
+		{
+			Name: "ResponseSize",
+			Opts: []connectrpc.TestServerOption{connectrpc.WithResponseSize(1024)},
+			Script: `
+				var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1, text: 'hi' });
+				if (res.message.text.length !== 1024 || res.message.text.indexOf('hi') !== 0) {
+					throw new Error('Expected a 1024 bytes text starting with hi, got ' + res.message.text.length + ' bytes');
+				}
+			`,
+		},
+		{
+			Name: "GoAwayAfter",
+			Opts: []connectrpc.TestServerOption{connectrpc.WithGoAwayAfter(2)},
+			Script: `
+				for (var i = 0; i < 5; i++) {
+					var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i });
+					if (res.status !== 200) {
+						throw new Error('Expected status 200 for call ' + i + ', got ' + res.status);
+					}
+				}
+			`,
+			NewConnections: 3,
+		},
+		{
+			Name: "CloseAfter",
+			Opts: []connectrpc.TestServerOption{connectrpc.WithCloseAfter(2)},
+			Script: `
+				var statuses = [];
+				for (var i = 0; i < 4; i++) {
+					var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: i });
+					statuses.push(res.status === 200 ? 'ok' : res.message.code);
+				}
+				// The third call loses its connection, and the next one opens another
+				if (JSON.stringify(statuses) !== '["ok","ok","unavailable","ok"]') {
+					throw new Error('Expected the third call to fail, got ' + JSON.stringify(statuses));
+				}
+			`,
+			NewConnections: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := connectrpc.NewTestServer(false, tc.Opts...)
+			defer srv.Close()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			_, err = ts.Run(`
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', { plaintext: true });
+			` + tc.Script + `
+				client.close();
+			`)
+			require.NoError(t, err)
+
+			if tc.NewConnections > 0 {
+				containers := drainSamples(ts.samples)
+				assert.Len(t, findSamples(containers, "connectrpc_http_connections_new"), tc.NewConnections)
+			}
+		})
+	}
+}
+
+func TestHTTP2Frames(t *testing.T) {
+	t.Parallel()
+
+	// The server doesn't read the requests right away, so large ones exhaust its windows
+	handler := connectrpc.NewTestHandler(false)
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/Ping") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		handler.ServeHTTP(w, r)
+	}), &http2.Server{}))
+	defer srv.Close()
+	tlsSrv := httptest.NewUnstartedServer(connectrpc.NewTestHandler(false))
+	tlsSrv.EnableHTTP2 = true
+	tlsSrv.StartTLS()
+	defer tlsSrv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, http2Frames: true });
+			var large = client.invoke(method, { number: 1, text: 'x'.repeat(1536 * 1024) });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var received = new Promise(function(resolve) {
+				stream.on('data', resolve);
+			});
+			stream.write({ number: 1 });
+			await received;
+			stream.close();
+			client.close();
+
+			var secure = new connectrpc.Client();
+			secure.connect('` + tlsSrv.URL + `', { tls: { insecureSkipVerify: true }, http2Frames: true });
+			var overTLS = secure.invoke(method, { number: 1 });
+			secure.close();
+
+			call(JSON.stringify({ large: large.status, tls: overTLS.status, proto: overTLS.proto, alpn: overTLS.alpn }));
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 1)
+	assert.JSONEq(t, `{"large": 200, "tls": 200, "proto": "HTTP/2.0", "alpn": "h2"}`, recorded[0])
+
+	// The reset of the closed stream is sent in the background
+	var samples []metrics.SampleContainer
+	require.Eventually(t, func() bool {
+		samples = append(samples, drainSamples(ts.samples)...)
+		return len(findSamples(samples, "connectrpc_http2_stream_resets")) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resets := findSamples(samples, "connectrpc_http2_stream_resets")
+	require.Len(t, resets, 1)
+	tags := resets[0].Tags.Map()
+	assert.Equal(t, srv.URL, tags["url"])
+	assert.Equal(t, "sent", tags["direction"])
+	assert.Equal(t, "CANCEL", tags["code"])
+
+	var stalled []string
+	for _, s := range findSamples(samples, "connectrpc_http2_flow_control_stalls") {
+		tags := s.Tags.Map()
+		stalled = append(stalled, tags["direction"]+"/"+tags["window"])
+	}
+	assert.Contains(t, stalled, "sent/stream")
+}
+
+func TestRampDown(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.setGlobalOptions({ rampDown: 'reject' });
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+	var progress atomic.Value
+	progress.Store(0.5)
+	ts.VU.CtxField = lib.WithScenarioState(ts.VU.CtxField, &lib.ScenarioState{
+		Name:       "soak",
+		ProgressFn: func() (float64, []string) { return progress.Load().(float64), nil },
+	})
+
+	_, err = ts.Run(`
+		var method = '/k6.connectrpc.ping.v1.PingService/Ping';
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+		var before = [connectrpc.rampingDown(), client.invoke(method, { number: 1 }).status];
+
+		var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+		var sums = [];
+		stream.on('data', function(r) { sums.push(r.sum); });
+	`)
+	require.NoError(t, err)
+
+	// The scenario reaches its duration, with the stream still open
+	progress.Store(1.0)
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var rejected = function(f) {
+				try {
+					f();
+					return 'started';
+				} catch (e) {
+					return String(e);
+				}
+			};
+
+			var ended = new Promise(function(resolve) { stream.on('end', resolve); });
+			stream.write({ number: 1 });
+			stream.write({ number: 2 });
+			stream.end();
+			await ended;
+
+			call(JSON.stringify({
+				before: before,
+				rampingDown: connectrpc.rampingDown(),
+				invoke: rejected(function() { client.invoke(method, { number: 1 }); }),
+				asyncInvoke: rejected(function() { client.asyncInvoke(method, { number: 1 }); }),
+				stream: rejected(function() { new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum'); }),
+				sums: sums,
+			}));
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 1)
+	rejection := `GoError: ramping down: scenario \"soak\" is past its duration, no new calls or streams are started`
+	assert.JSONEq(t, `{
+		"before": [false, 200],
+		"rampingDown": true,
+		"invoke": "`+rejection+`",
+		"asyncInvoke": "`+rejection+`",
+		"stream": "`+rejection+`",
+		"sums": ["1", "3"]
+	}`, recorded[0])
+}
+
+func TestRawWireError(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+	// A proxy answering with a bare HTTP error, which connect-go maps to a code
+	proxy := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}), &http2.Server{}))
+	defer proxy.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var results = {};
+			for (var protocol of ['connect', 'grpc', 'grpc-web']) {
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', { plaintext: true, protocol: protocol });
+
+				var failed = client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 14 });
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+				var streamError = new Promise(function(resolve) {
+					stream.on('error', function(e) { resolve(e.raw); });
+				});
+				stream.write({ number: 0 });
+				stream.end();
+
+				results[protocol] = { code: failed.message.code, unary: failed.message.raw, stream: await streamError };
+				client.close();
+			}
+
+			var client = new connectrpc.Client();
+			client.connect('` + proxy.URL + `', { plaintext: true });
+			var proxied = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			results.proxy = { code: proxied.message.code, unary: proxied.message.raw };
+			client.close();
+
+			call(JSON.stringify(results));
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 1)
+	streamError := `{"wire": true, "httpStatus": 200, "code": "%s", "message": "number must be positive: got 0"}`
+	assert.JSONEq(t, `{
+		"connect": {
+			"code": "unavailable",
+			"unary": {"wire": true, "httpStatus": 503, "code": "unavailable", "message": "oh no"},
+			"stream": `+fmt.Sprintf(streamError, "invalid_argument")+`
+		},
+		"grpc": {
+			"code": "unavailable",
+			"unary": {"wire": true, "httpStatus": 200, "code": "14", "message": "oh no"},
+			"stream": `+fmt.Sprintf(streamError, "3")+`
+		},
+		"grpc-web": {
+			"code": "unavailable",
+			"unary": {"wire": true, "httpStatus": 200, "code": "14", "message": "oh no"},
+			"stream": `+fmt.Sprintf(streamError, "3")+`
+		},
+		"proxy": {
+			"code": "unavailable",
+			"unary": {"wire": false, "httpStatus": 429, "code": "", "message": ""}
+		}
+	}`, recorded[0])
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var pinged = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 42, text: 'hi' });
+		var failed = client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+		var results = [
+			connectrpc.check(pinged, { ok: true, maxDuration: '10s', json: { number: 42, '$.text': 'hi' } }),
+			connectrpc.check(failed, { ok: false, status: 404, code: 'not_found' }),
+			connectrpc.check(failed, { ok: true }, { step: 'fail' }),
+		];
+		client.close();
+		JSON.stringify(results);
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[true, true, false]`, val.String())
+
+	checks := findSamples(drainSamples(ts.samples), "checks")
+	require.Len(t, checks, 8)
+	values := make([]float64, len(checks))
+	for i, sample := range checks {
+		values[i] = sample.Value
+	}
+	assert.Equal(t, []float64{1, 1, 1, 1, 1, 1, 1, 0}, values)
+	step, ok := checks[7].Tags.Get("step")
+	assert.True(t, ok)
+	assert.Equal(t, "fail", step)
+
+	_, err = ts.Run(`connectrpc.check({ status: 200 }, { latency: '1s' })`)
+	assert.ErrorContains(t, err, `unknown check "latency"`)
+}
+
+func TestStreamErrorRecordedOnce(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+		stream.on('error', function(e) { call(e.code); });
+		stream.write({ number: 0 });
+		stream.end();
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"invalid_argument"}, ts.callRecorder.Recorded())
+
+	containers := drainSamples(ts.samples)
+	durations := findSamples(containers, "connectrpc_stream_duration")
+	require.Len(t, durations, 1)
+	status, _ := durations[0].Tags.Get("status")
+	assert.Equal(t, "error", status)
+	assert.Len(t, findSamples(containers, "connectrpc_stream_errors"), 1)
+}
+
+func TestResponseCompression(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false, connectrpc.WithResponseSize(4096))
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			var ping = '/k6.connectrpc.ping.v1.PingService/Ping';
+			var connections = [
+				{},
+				{ acceptCompression: ['zstd', 'gzip'] },
+				{ acceptCompression: [] },
+			];
+			for (var i = 0; i < connections.length; i++) {
+				connections[i].plaintext = true;
+				connections[i].contentType = 'application/proto';
+				client.connect('` + srv.URL + `', connections[i]);
+				var sync = client.invoke(ping, { text: 'hi' });
+				var async = await client.asyncInvoke(ping, { text: 'hi' });
+				call(sync.message.text.length + ',' + async.message.text.length);
+				client.close();
+			}
+		})();
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4096,4096", "4096,4096", "4096,4096"}, ts.callRecorder.Recorded())
+
+	containers := drainSamples(ts.samples)
+	wire := findSamples(containers, "connectrpc_resp_wire_size")
+	decompressed := findSamples(containers, "connectrpc_resp_decompressed_size")
+	require.Len(t, wire, 6)
+	require.Len(t, decompressed, 6)
+	for i, encoding := range []string{"gzip", "gzip", "zstd", "zstd", "identity", "identity"} {
+		assert.Equal(t, encoding, wire[i].Tags.Map()["encoding"], i)
+		assert.Equal(t, encoding, decompressed[i].Tags.Map()["encoding"], i)
+		assert.Greater(t, decompressed[i].Value, float64(4096), i)
+		if encoding == "identity" {
+			assert.Equal(t, decompressed[i].Value, wire[i].Value, i)
+		} else {
+			assert.Less(t, wire[i].Value, float64(200), i)
+		}
+	}
+
+	_, err = ts.Run(`new connectrpc.Client().connect('` + srv.URL + `', { plaintext: true, acceptCompression: ['br'] })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid acceptCompression: unknown compression br, must be 'gzip' or 'zstd'")
+}
+
+func TestFuzz(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var fuzzer = connectrpc.fuzz('k6.connectrpc.ping.v1.PingService/Ping', { seed: 1, mutations: ['longStrings'] });
+	`)
+	require.NoError(t, err)
+
+	_, err = ts.Run(`connectrpc.fuzz('k6.connectrpc.ping.v1.PingService/Nope');`)
+	require.ErrorContains(t, err, `method "/k6.connectrpc.ping.v1.PingService/Nope" not found`)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var next = fuzzer.next();
+		var res = fuzzer.invoke(client, { tags: { team: 'payments' } });
+		({ mutation: next.mutation, length: next.message.text.length, status: res.status, resMutation: res.mutation,
+			echoed: res.message.text.length });
+	`)
+	require.NoError(t, err)
+
+	result := val.Export().(map[string]interface{})
+	assert.Equal(t, "longStrings", result["mutation"])
+	assert.GreaterOrEqual(t, result["length"], int64(1024))
+	assert.Equal(t, int64(200), result["status"])
+	assert.Equal(t, "longStrings", result["resMutation"])
+	assert.GreaterOrEqual(t, result["echoed"], int64(1024))
+
+	reqs := findSamples(drainSamples(ts.samples), "connectrpc_reqs")
+	require.Len(t, reqs, 1)
+	mutation, _ := reqs[0].Tags.Get("mutation")
+	assert.Equal(t, "longStrings", mutation)
+	team, _ := reqs[0].Tags.Get("team")
+	assert.Equal(t, "payments", team)
+}
@@ -0,0 +1,141 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/sobek"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	int64ValueName  protoreflect.FullName = "google.protobuf.Int64Value"
+	uint64ValueName protoreflect.FullName = "google.protobuf.UInt64Value"
+)
+
+// parseJSONOptions parses the `jsonOptions` connect parameter, like { int64AsNumber: true }
+func parseJSONOptions(v interface{}, params *connectParams) error {
+	options, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("must be an object like { int64AsNumber: true }")
+	}
+	for k, value := range options {
+		switch k {
+		case "int64AsNumber":
+			asNumber, ok := value.(bool)
+			if !ok {
+				return errors.New("int64AsNumber must be a boolean")
+			}
+			params.Int64AsNumber = asNumber
+		default:
+			return fmt.Errorf("unknown option %q, must be int64AsNumber", k)
+		}
+	}
+	return nil
+}
+
+// responseConversion converts the response messages decoded from their protojson, following
+// the timeFields and jsonOptions connect parameters
+type responseConversion struct {
+	desc          protoreflect.MessageDescriptor
+	times         bool // Timestamps to Dates and durations to milliseconds, with timeFields: 'date'
+	int64AsNumber bool // 64-bit integers to numbers, with jsonOptions: { int64AsNumber: true }
+}
+
+// responseConversion returns the conversion of the response messages of a type, or nil to
+// leave them as is
+func (c *Client) responseConversion(desc protoreflect.MessageDescriptor) *responseConversion {
+	if c.connectParams == nil {
+		return nil
+	}
+	rc := &responseConversion{
+		desc:          desc,
+		times:         c.connectParams.TimeFields == timeFieldsDate,
+		int64AsNumber: c.connectParams.Int64AsNumber,
+	}
+	if !rc.times && !rc.int64AsNumber {
+		return nil
+	}
+	return rc
+}
+
+// apply converts a decoded response message, a nil conversion returning it as is
+func (rc *responseConversion) apply(rt *sobek.Runtime, value interface{}) interface{} {
+	if rc == nil {
+		return value
+	}
+	if rc.times {
+		value = responseTimes(rt, value, rc.desc)
+	}
+	if rc.int64AsNumber {
+		value = responseInt64s(value, rc.desc)
+	}
+	return value
+}
+
+// responseInt64s converts the 64-bit integer fields of a response decoded from its protojson,
+// which are strings, to numbers. The integers beyond 2^53 lose their precision. The map keys
+// stay strings, like the keys of any JS object.
+func responseInt64s(value interface{}, desc protoreflect.MessageDescriptor) interface{} {
+	if name := desc.FullName(); name == int64ValueName || name == uint64ValueName {
+		return int64Number(value)
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, field := range obj {
+		fd := desc.Fields().ByJSONName(key)
+		if fd == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if entries, ok := field.(map[string]interface{}); ok {
+				for k, entry := range entries {
+					entries[k] = responseInt64(entry, fd.MapValue())
+				}
+			}
+		case fd.IsList():
+			if items, ok := field.([]interface{}); ok {
+				for i, item := range items {
+					items[i] = responseInt64(item, fd)
+				}
+			}
+		default:
+			obj[key] = responseInt64(field, fd)
+		}
+	}
+	return obj
+}
+
+// responseInt64 converts a value of a field of a response, see responseInt64s
+func responseInt64(value interface{}, fd protoreflect.FieldDescriptor) interface{} {
+	switch fd.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64Number(value)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		name := fd.Message().FullName()
+		if name != int64ValueName && name != uint64ValueName && strings.HasPrefix(string(name), "google.protobuf.") {
+			return value
+		}
+		return responseInt64s(value, fd.Message())
+	}
+	return value
+}
+
+// int64Number converts the protojson string of a 64-bit integer to a number
+func int64Number(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return value
+	}
+	return n
+}
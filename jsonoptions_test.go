@@ -0,0 +1,42 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseInt64s(t *testing.T) {
+	t.Parallel()
+
+	desc := requestTestDescriptor(t, "Counters")
+
+	var response interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"total": "42",
+		"peak": "18446744073709551615",
+		"samples": ["-1", "2"],
+		"byRegion": {"eu": "7"},
+		"limit": "100",
+		"small": 3,
+		"at": "2024-01-02T15:04:05Z",
+		"previous": {"total": "41", "previous": {"samples": ["9007199254740993"]}}
+	}`), &response))
+
+	converted, err := json.Marshal(responseInt64s(response, desc))
+	require.NoError(t, err)
+
+	// The integers beyond 2^53 are rounded to the nearest number
+	assert.JSONEq(t, `{
+		"total": 42,
+		"peak": 18446744073709551616,
+		"samples": [-1, 2],
+		"byRegion": {"eu": 7},
+		"limit": 100,
+		"small": 3,
+		"at": "2024-01-02T15:04:05Z",
+		"previous": {"total": 41, "previous": {"samples": [9007199254740992]}}
+	}`, string(converted))
+}
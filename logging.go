@@ -0,0 +1,44 @@
+package connectrpc
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logLevelOff disables the client logs: the client never logs at the panic level
+const logLevelOff = logrus.PanicLevel
+
+// logLevels are the values of the `logLevel` connect parameter
+var logLevels = map[string]logrus.Level{
+	"debug": logrus.DebugLevel,
+	"info":  logrus.InfoLevel,
+	"warn":  logrus.WarnLevel,
+	"error": logrus.ErrorLevel,
+	"off":   logLevelOff,
+}
+
+// parseLogLevel parses the `logLevel` connect parameter
+func parseLogLevel(level string) (logrus.Level, error) {
+	l, ok := logLevels[level]
+	if !ok {
+		return 0, fmt.Errorf("invalid logLevel: %s. Must be 'debug', 'info', 'warn', 'error' or 'off'", level)
+	}
+	return l, nil
+}
+
+// logLevel returns the most verbose level the client logs at, errors only by default
+func (c *Client) logLevel() logrus.Level {
+	if c.connectParams == nil {
+		return logrus.ErrorLevel
+	}
+	return c.connectParams.LogLevel
+}
+
+// log logs a stream message with its fields, if the `logLevel` connect parameter enables its level
+func (s *stream) log(level logrus.Level, fields logrus.Fields, msg string) {
+	if level > s.logLevel {
+		return
+	}
+	s.logger.WithFields(fields).Log(level, msg)
+}
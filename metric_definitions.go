@@ -0,0 +1,276 @@
+package connectrpc
+
+import (
+	"go.k6.io/k6/metrics"
+)
+
+//go:generate go run ./cmd/connectrpc-dashboard -o dashboards/connectrpc.json
+
+// callTagNames are the tags of every sample of an RPC, set by MetricTags.setCallTags
+var callTagNames = []string{"method", "service", "procedure", "type", "protocol", "content_type"}
+
+// metricDefinition describes a metric of the extension. registerMetrics registers them, and
+// the dashboards are generated from them, so the two can't drift apart.
+type metricDefinition struct {
+	name        string
+	metricType  metrics.MetricType
+	contains    metrics.ValueType
+	description string
+	tags        []string                                  // Tags of every sample, besides the k6 system and user tags
+	streamTags  []string                                  // Tags of the stream samples, when they differ from the unary ones
+	field       func(m *instanceMetrics) **metrics.Metric // Field of the registered metric
+}
+
+// withCallTags returns the call tags followed by the given tags
+func withCallTags(tags ...string) []string {
+	return append(append([]string{}, callTagNames...), tags...)
+}
+
+// metricDefinitions are the metrics of the extension, in the order of the dashboards
+var metricDefinitions = []metricDefinition{
+	// Unary request metrics
+	{
+		name: "connectrpc_reqs", metricType: metrics.Counter,
+		description: "Unary calls made",
+		tags:        withCallTags("status", "expected_response"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCReqs },
+	},
+	{
+		name: "connectrpc_req_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Duration of the unary calls, from the request to the end of the response",
+		tags:        withCallTags("status", "expected_response"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCReqDuration },
+	},
+	{
+		name: "connectrpc_req_errors", metricType: metrics.Counter,
+		description: "Unary calls with an unexpected response, see expectedStatuses()",
+		tags:        withCallTags("status", "expected_response"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCReqErrors },
+	},
+	{
+		name: "connectrpc_slo_breaches", metricType: metrics.Counter,
+		description: "Unary calls slower than the latency budget of their slo parameter",
+		tags:        withCallTags("status", "expected_response"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCSLOBreaches },
+	},
+	{
+		name: "connectrpc_req_queued_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Time the asyncInvoke() calls waited for fewer calls in flight, with maxInFlight",
+		tags:        withCallTags(),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCReqQueuedDuration },
+	},
+
+	// Stream metrics
+	{
+		name: "connectrpc_streams", metricType: metrics.Counter,
+		description: "Streams opened",
+		tags:        withCallTags("status"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreams },
+	},
+	{
+		name: "connectrpc_stream_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Duration of the streams, from their opening to their end",
+		tags:        withCallTags("status"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamDuration },
+	},
+	{
+		name: "connectrpc_stream_errors", metricType: metrics.Counter,
+		description: "Streams ended by an error",
+		tags:        withCallTags("status"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamErrors },
+	},
+	{
+		name: "connectrpc_stream_msgs_sent", metricType: metrics.Counter,
+		description: "Messages sent on streams",
+		tags:        withCallTags("direction"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamMsgsSent },
+	},
+	{
+		name: "connectrpc_stream_msgs_received", metricType: metrics.Counter,
+		description: "Messages received on streams",
+		tags:        withCallTags("direction"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamMsgsReceived },
+	},
+	{
+		name: "connectrpc_stream_paused_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Time the streams spent paused by stream.pause(), recorded when they end",
+		tags:        withCallTags(),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamPausedDuration },
+	},
+	{
+		name: "connectrpc_stream_arrivals_dropped", metricType: metrics.Counter,
+		description: "Stream arrivals of streamArrivalRate dropped, maxActive streams being open",
+		tags:        withCallTags(),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamArrivalsDropped },
+	},
+	{
+		name: "connectrpc_stream_assertion_violations", metricType: metrics.Counter,
+		description: "Received messages out of order, or streams ended before their expected count, with assert",
+		tags:        withCallTags("assertion"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamAssertionViolations },
+	},
+	{
+		name: "connectrpc_stream_cancel_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Time from the cancel of the streams by cancelAfter() or take() to their end",
+		tags:        withCallTags(),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCStreamCancelDuration },
+	},
+	{
+		name: "connectrpc_session_step_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Duration of the send, expect, wait and end steps of connectrpc.session()",
+		tags:        withCallTags("step", "action"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCSessionStepDuration },
+	},
+
+	// Payload size metrics
+	{
+		name: "connectrpc_req_size", metricType: metrics.Trend, contains: metrics.Data,
+		description: "Size of the request messages, unary or streamed",
+		tags:        withCallTags("status", "expected_response"),
+		streamTags:  withCallTags("direction"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCReqSize },
+	},
+	{
+		name: "connectrpc_resp_size", metricType: metrics.Trend, contains: metrics.Data,
+		description: "Size of the response messages, unary or streamed",
+		tags:        withCallTags("status", "expected_response"),
+		streamTags:  withCallTags("direction"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCRespSize },
+	},
+	{
+		name: "connectrpc_resp_wire_size", metricType: metrics.Trend, contains: metrics.Data,
+		description: "Size of the unary response messages as received, compressed with their encoding or not",
+		tags:        withCallTags("encoding"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCRespWireSize },
+	},
+	{
+		name: "connectrpc_resp_decompressed_size", metricType: metrics.Trend, contains: metrics.Data,
+		description: "Size of the unary response messages once decompressed, in the content type of the call",
+		tags:        withCallTags("encoding"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCRespDecompressedSize },
+	},
+
+	// Connection metrics
+	{
+		name: "connectrpc_connections", metricType: metrics.Counter,
+		description: "Transports created by the connection strategy",
+		tags:        []string{"url"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCConnections },
+	},
+	{
+		name: "connectrpc_connection_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Lifetime of the transports created by the connection strategy",
+		tags:        []string{"url"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCConnectionDuration },
+	},
+	{
+		name: "connectrpc_connection_errors", metricType: metrics.Counter,
+		description: "Requests that failed to connect, or lost their connection, by phase: dns, dial, tls or http2",
+		tags:        []string{"url", "phase"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCConnectionErrors },
+	},
+
+	// HTTP connection reuse metrics
+	{
+		name: "connectrpc_http_connections_new", metricType: metrics.Counter,
+		description: "HTTP connections dialed",
+		tags:        []string{"url", "connection_type"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCHTTPConnectionsNew },
+	},
+	{
+		name: "connectrpc_http_connections_reused", metricType: metrics.Counter,
+		description: "Requests sent on an HTTP connection already open",
+		tags:        []string{"url", "connection_type"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCHTTPConnectionsReused },
+	},
+	{
+		name: "connectrpc_http_handshake_duration", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Duration of the dial and TLS handshake of new HTTP connections",
+		tags:        []string{"url", "connection_type"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCHTTPHandshakeDuration },
+	},
+	{
+		name: "connectrpc_active_streams", metricType: metrics.Gauge,
+		description: "Streams open to the URL on the VU, and on the connection of the stream opened or ended last",
+		tags:        []string{"scope", "url"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCActiveStreams },
+	},
+
+	// HTTP/2 frame metrics
+	{
+		name: "connectrpc_http2_stream_resets", metricType: metrics.Counter,
+		description: "HTTP/2 streams reset with RST_STREAM, by the client or the server, with http2Frames: true",
+		tags:        []string{"url", "direction", "code"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCHTTP2StreamResets },
+	},
+	{
+		name: "connectrpc_http2_flow_control_stalls", metricType: metrics.Counter,
+		description: "HTTP/2 flow-control windows exhausted, the sender waiting for the receiver, with http2Frames: true",
+		tags:        []string{"url", "direction", "window"},
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCHTTP2FlowControlStalls },
+	},
+
+	// Strict mode metrics
+	{
+		name: "connectrpc_protocol_violations", metricType: metrics.Counter,
+		description: "Responses violating the protocol specification, with strict: true",
+		tags:        withCallTags("rule"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCProtocolViolations },
+	},
+
+	// API misuse metrics
+	{
+		name: "connectrpc_api_misuse", metricType: metrics.Counter,
+		description: "Misuses of the API, like a stream on a unary method or connect() with calls in flight",
+		tags:        withCallTags("misuse"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCAPIMisuse },
+	},
+
+	// Server timing metrics
+	{
+		name: "connectrpc_server_timing", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Server processing durations from the Server-Timing header, with serverTimingMetrics: true",
+		tags:        withCallTags("timing"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCServerTiming },
+	},
+
+	// Client saturation metrics
+	{
+		name: "connectrpc_client_saturation", metricType: metrics.Trend, contains: metrics.Time,
+		description: "Delays caused by the client itself rather than the server under test",
+		tags:        withCallTags("source"),
+		field:       func(m *instanceMetrics) **metrics.Metric { return &m.ConnectRPCClientSaturation },
+	},
+}
+
+// MetricDefinition describes a metric of the extension, for dashboards and documentation
+type MetricDefinition struct {
+	Name        string   `json:"name" js:"name"`
+	Type        string   `json:"type" js:"type"`         // counter, gauge or trend
+	Contains    string   `json:"contains" js:"contains"` // default, time or data
+	Description string   `json:"description" js:"description"`
+	Tags        []string `json:"tags" js:"tags"` // Tags of every sample, besides the k6 system and user tags
+	// Tags of the stream samples, when they differ from Tags
+	StreamTags []string `json:"streamTags,omitempty" js:"streamTags"`
+}
+
+// MetricDefinitions returns the metrics of the extension, with names prepended by prefix
+func MetricDefinitions(prefix string) []MetricDefinition {
+	definitions := make([]MetricDefinition, 0, len(metricDefinitions))
+	for _, d := range metricDefinitions {
+		definitions = append(definitions, MetricDefinition{
+			Name:        prefix + d.name,
+			Type:        d.metricType.String(),
+			Contains:    d.contains.String(),
+			Description: d.description,
+			Tags:        append([]string{}, d.tags...),
+			StreamTags:  append([]string(nil), d.streamTags...),
+		})
+	}
+	return definitions
+}
+
+// metricDefinitions returns the metrics of the extension, with the metric prefix of the global options
+func (mi *ModuleInstance) metricDefinitions() []MetricDefinition {
+	return MetricDefinitions(mi.defaults.metricPrefix)
+}
@@ -0,0 +1,200 @@
+package connectrpc_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+// TestMetricDefinitionTags tests that the samples of each metric carry exactly the tags of its definition
+func TestMetricDefinitionTags(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, strict: true });
+
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1, text: 'hi' });
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			stream.write({ number: 1 });
+			stream.end();
+			await ended;
+
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	checked := 0
+	for _, d := range connectrpc.MetricDefinitions("") {
+		expected := append([]string{}, d.Tags...)
+		sort.Strings(expected)
+		streamExpected := expected
+		if d.StreamTags != nil {
+			streamExpected = append([]string{}, d.StreamTags...)
+			sort.Strings(streamExpected)
+		}
+
+		for _, sample := range findSamples(containers, d.Name) {
+			var keys []string
+			for key := range sample.Tags.Map() {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if sample.Tags.Map()["type"] == "stream" {
+				assert.Equal(t, streamExpected, keys, d.Name)
+			} else {
+				assert.Equal(t, expected, keys, d.Name)
+			}
+			checked++
+		}
+	}
+	assert.Greater(t, checked, 10)
+}
+
+// TestMetricDefinitions tests that scripts get the definitions of the registered metrics
+func TestMetricDefinitions(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	val, err := ts.Run(`
+		connectrpc.setGlobalOptions({ metricPrefix: 'payments_' });
+		var definitions = connectrpc.metricDefinitions();
+		var reqs = definitions.filter(function(d) { return d.name === 'payments_connectrpc_reqs'; })[0];
+		JSON.stringify([definitions.length, reqs.type, reqs.contains, reqs.tags.indexOf('method') >= 0, !!reqs.description]);
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, `[32,"counter","default",true,true]`, val.String())
+
+	for _, d := range connectrpc.MetricDefinitions("payments_") {
+		metric := ts.VU.InitEnvField.Registry.Get(d.Name)
+		require.NotNil(t, metric, d.Name)
+		assert.Equal(t, d.Type, metric.Type.String(), d.Name)
+		assert.Equal(t, d.Contains, metric.Contains.String(), d.Name)
+	}
+}
+
+// TestMetricOriginTags tests that the samples of an RPC carry the scenario and group it was
+// started from, and that its connection samples carry its user tags
+func TestMetricOriginTags(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+	ts.VU.State().Tags.Modify(func(tm *metrics.TagsAndMeta) {
+		tm.SetTag("scenario", "checkout")
+	})
+	require.NoError(t, ts.VU.Runtime().Set("setGroup", func(group string) {
+		ts.VU.State().Tags.Modify(func(tm *metrics.TagsAndMeta) {
+			tm.SetTag("group", group)
+		})
+	}))
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, tags: { team: 'payments' } });
+
+			setGroup('::pay');
+			var pending = client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+			setGroup('::browse');
+			await pending;
+
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	for _, name := range []string{"connectrpc_reqs", "connectrpc_req_duration", "connectrpc_http_connections_new"} {
+		samples := findSamples(containers, name)
+		require.NotEmpty(t, samples, name)
+		for _, sample := range samples {
+			tags := sample.Tags.Map()
+			assert.Equal(t, "checkout", tags["scenario"], name)
+			assert.Equal(t, "::pay", tags["group"], name)
+			assert.Equal(t, "payments", tags["team"], name)
+		}
+	}
+}
+
+// TestHistogramMetricModel tests that metricModel: 'histogram' records the durations as
+// the bucket, sum and count counters of histograms instead of trends
+func TestHistogramMetricModel(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.setGlobalOptions({ metricModel: 'histogram', histogramBuckets: '10ms,1m' });
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+		var res = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+		if (res.status !== 200) {
+			throw new Error('Expected status 200, got ' + res.status);
+		}
+		client.close();
+	`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	assert.Empty(t, findSamples(containers, "connectrpc_req_duration"))
+
+	count := findSamples(containers, "connectrpc_req_duration_count")
+	require.Len(t, count, 1)
+	assert.Equal(t, "/k6.connectrpc.ping.v1.PingService/Ping", count[0].Tags.Map()["method"])
+	sum := findSamples(containers, "connectrpc_req_duration_sum")
+	require.Len(t, sum, 1)
+	assert.Less(t, sum[0].Value, 60.0)
+
+	les := make(map[string]bool)
+	for _, sample := range findSamples(containers, "connectrpc_req_duration_bucket") {
+		le, _ := sample.Tags.Get("le")
+		les[le] = true
+	}
+	expected := map[string]bool{"60": true, "+Inf": true}
+	if sum[0].Value <= 0.01 {
+		expected["0.01"] = true
+	}
+	assert.Equal(t, expected, les)
+}
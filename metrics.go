@@ -2,6 +2,8 @@ package connectrpc
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"time"
 
 	"go.k6.io/k6/js/modules"
@@ -15,15 +17,35 @@ type instanceMetrics struct {
 	ConnectRPCReqDuration *metrics.Metric
 	ConnectRPCReqErrors   *metrics.Metric
 
+	// Unary calls exceeding the latency budget of their `slo` parameter
+	ConnectRPCSLOBreaches *metrics.Metric
+
+	// Time the asyncInvoke() calls waited under maxInFlight, see inFlightLimiter
+	ConnectRPCReqQueuedDuration *metrics.Metric
+
 	// Stream metrics
 	ConnectRPCStreams        *metrics.Metric
 	ConnectRPCStreamDuration *metrics.Metric
 	ConnectRPCStreamErrors   *metrics.Metric
-
 	// Message metrics (granular)
 	ConnectRPCStreamMsgsSent     *metrics.Metric
 	ConnectRPCStreamMsgsReceived *metrics.Metric
 
+	// Time the streams spent paused by stream.pause()
+	ConnectRPCStreamPausedDuration *metrics.Metric
+
+	// Stream arrivals of streamArrivalRate dropped for lack of room under maxActive
+	ConnectRPCStreamArrivalsDropped *metrics.Metric
+
+	// Violations of the assertions of the `assert` stream parameter
+	ConnectRPCStreamAssertionViolations *metrics.Metric
+
+	// Time the streams canceled by cancelAfter() or take() took to end
+	ConnectRPCStreamCancelDuration *metrics.Metric
+
+	// Durations of the steps of connectrpc.session()
+	ConnectRPCSessionStepDuration *metrics.Metric
+
 	// Connection metrics
 	ConnectRPCConnections        *metrics.Metric
 	ConnectRPCConnectionDuration *metrics.Metric
@@ -34,9 +56,40 @@ type instanceMetrics struct {
 	ConnectRPCHTTPConnectionsReused *metrics.Metric
 	ConnectRPCHTTPHandshakeDuration *metrics.Metric
 
+	// Streams open on the VU and on each connection, see recordActiveStreams
+	ConnectRPCActiveStreams *metrics.Metric
+	activeStreams           *activeStreams
+
+	// HDR histograms of the run, see latencyHistograms()
+	latencies *latencyRecorder
+
+	// HTTP/2 frame metrics, with http2Frames: true
+	ConnectRPCHTTP2StreamResets      *metrics.Metric
+	ConnectRPCHTTP2FlowControlStalls *metrics.Metric
+
 	// Payload size metrics
 	ConnectRPCReqSize  *metrics.Metric
 	ConnectRPCRespSize *metrics.Metric
+
+	// Sizes of the unary responses on the wire and decompressed, see recordResponseCompression
+	ConnectRPCRespWireSize         *metrics.Metric
+	ConnectRPCRespDecompressedSize *metrics.Metric
+
+	// Strict mode metrics
+	ConnectRPCProtocolViolations *metrics.Metric
+
+	// Misuses of the API, see checkMethodType and checkConnectIdle
+	ConnectRPCAPIMisuse *metrics.Metric
+
+	// Server-reported processing time from the Server-Timing header
+	ConnectRPCServerTiming *metrics.Metric
+
+	// Delays caused by the client itself, see recordSaturation
+	ConnectRPCClientSaturation *metrics.Metric
+	saturationWarned           *sync.Map // Sources of the delays the VU already warned about
+
+	// Histograms recorded instead of the duration trends, by trend, with metricModel: 'histogram'
+	histograms map[*metrics.Metric]*durationHistogram
 }
 
 // MetricTags contains common tags for metrics
@@ -48,6 +101,79 @@ type MetricTags struct {
 	Protocol    string // "connect", "grpc", etc.
 	ContentType string // "application/json", "application/protobuf"
 	Status      string // "success", "error", "cancelled"
+
+	ExpectedResponse bool              // Whether the response callback expects the unary response
+	Custom           map[string]string // User tags from the connect and call parameters
+	Origin           map[string]string // k6 scenario and group tags of the VU when the RPC started
+	RequestID        string            // Request ID generated for the unary call, empty for none
+	SLO              time.Duration     // Latency budget of the unary call, 0 for none
+}
+
+// withCustomTag returns a copy of the tags with one more custom tag
+func (t MetricTags) withCustomTag(name, value string) MetricTags {
+	custom := make(map[string]string, len(t.Custom)+1)
+	for k, v := range t.Custom {
+		custom[k] = v
+	}
+	custom[name] = value
+	t.Custom = custom
+	return t
+}
+
+// originTagNames are the k6 system tags identifying where an RPC was started from, kept
+// on the samples recorded after the VU moved on to another group
+var originTagNames = []string{"scenario", "group"}
+
+// originTags returns the scenario and group tags of a tag set, the ones enabled by the
+// k6 system tags
+func originTags(set *metrics.TagSet) map[string]string {
+	origin := make(map[string]string, len(originTagNames))
+	for _, name := range originTagNames {
+		if value, ok := set.Get(name); ok {
+			origin[name] = value
+		}
+	}
+	return origin
+}
+
+type rpcTagsKey struct{}
+
+// withRPCTags returns a context in which the connection tracking transport tags the
+// connection metrics like the RPC sending the request
+func withRPCTags(ctx context.Context, tags MetricTags) context.Context {
+	return context.WithValue(ctx, rpcTagsKey{}, tags)
+}
+
+// rpcTagsFrom returns the tags of the RPC of a request context, empty if there are none
+func rpcTagsFrom(ctx context.Context) MetricTags {
+	tags, _ := ctx.Value(rpcTagsKey{}).(MetricTags)
+	return tags
+}
+
+// setCustomTags sets the user tags; built-in tags set afterwards take precedence
+func (t MetricTags) setCustomTags(ctm *metrics.TagsAndMeta) {
+	for k, v := range t.Custom {
+		ctm.SetTag(k, v)
+	}
+}
+
+// setOriginTags sets the scenario and group of the RPC, over the current ones of the VU
+func (t MetricTags) setOriginTags(ctm *metrics.TagsAndMeta) {
+	for k, v := range t.Origin {
+		ctm.SetTag(k, v)
+	}
+}
+
+// setCallTags sets the tags every sample of an RPC carries, listed in callTagNames, and
+// its origin tags
+func (t MetricTags) setCallTags(ctm *metrics.TagsAndMeta) {
+	t.setOriginTags(ctm)
+	ctm.SetTag("method", t.Method)
+	ctm.SetTag("service", t.Service)
+	ctm.SetTag("procedure", t.Procedure)
+	ctm.SetTag("type", t.Type)
+	ctm.SetTag("protocol", t.Protocol)
+	ctm.SetTag("content_type", t.ContentType)
 }
 
 // Helper functions for recording metrics with per-procedure tags
@@ -61,29 +187,33 @@ func (m *instanceMetrics) recordUnaryRequest(ctx context.Context, vu modules.VU,
 		return
 	}
 
+	m.latencies.record(tags.Method, "unary", duration)
+
 	// Get current tags and add our custom tags
 	ctm := state.Tags.GetCurrentValues()
-	ctm.SetTag("method", tags.Method)
-	ctm.SetTag("service", tags.Service)
-	ctm.SetTag("procedure", tags.Procedure)
-	ctm.SetTag("type", tags.Type)
-	ctm.SetTag("protocol", tags.Protocol)
-	ctm.SetTag("content_type", tags.ContentType)
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("expected_response", strconv.FormatBool(tags.ExpectedResponse))
+	tags.setRequestID(&ctm)
 
 	if err != nil {
 		ctm.SetTag("status", "error")
-		// Record error
+	} else {
+		ctm.SetTag("status", "success")
+	}
+	breach := tags.setSLOBreach(&ctm, duration)
+
+	if !tags.ExpectedResponse {
+		// Record unexpected response as an error
 		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
 			TimeSeries: metrics.TimeSeries{
 				Metric: m.ConnectRPCReqErrors,
-				Tags:   ctm.Tags,
+				Tags:   tags.requestIDPrefix(ctm.Tags),
 			},
 			Time:     time.Now(),
 			Metadata: ctm.Metadata,
 			Value:    1,
 		})
-	} else {
-		ctm.SetTag("status", "success")
 	}
 
 	// Record request count and duration
@@ -98,15 +228,26 @@ func (m *instanceMetrics) recordUnaryRequest(ctx context.Context, vu modules.VU,
 			Metadata: ctm.Metadata,
 			Value:    1,
 		},
-		{
+	}
+	samples = append(samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCReqDuration,
+			Tags:   ctm.Tags,
+		},
+		Time:     now,
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(duration),
+	})...)
+	if breach {
+		samples = append(samples, metrics.Sample{
 			TimeSeries: metrics.TimeSeries{
-				Metric: m.ConnectRPCReqDuration,
+				Metric: m.ConnectRPCSLOBreaches,
 				Tags:   ctm.Tags,
 			},
 			Time:     now,
 			Metadata: ctm.Metadata,
-			Value:    metrics.D(duration),
-		},
+			Value:    1,
+		})
 	}
 
 	// Record payload sizes if available
@@ -149,12 +290,8 @@ func (m *instanceMetrics) recordStreamStart(ctx context.Context, vu modules.VU,
 	}
 
 	ctm := state.Tags.GetCurrentValues()
-	ctm.SetTag("method", tags.Method)
-	ctm.SetTag("service", tags.Service)
-	ctm.SetTag("procedure", tags.Procedure)
-	ctm.SetTag("type", "stream")
-	ctm.SetTag("protocol", tags.Protocol)
-	ctm.SetTag("content_type", tags.ContentType)
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
 	ctm.SetTag("status", "opened")
 
 	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
@@ -177,13 +314,11 @@ func (m *instanceMetrics) recordStreamEnd(ctx context.Context, vu modules.VU,
 		return
 	}
 
+	m.latencies.record(tags.Method, "stream", duration)
+
 	ctm := state.Tags.GetCurrentValues()
-	ctm.SetTag("method", tags.Method)
-	ctm.SetTag("service", tags.Service)
-	ctm.SetTag("procedure", tags.Procedure)
-	ctm.SetTag("type", "stream")
-	ctm.SetTag("protocol", tags.Protocol)
-	ctm.SetTag("content_type", tags.ContentType)
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
 
 	if err != nil {
 		ctm.SetTag("status", "error")
@@ -202,7 +337,7 @@ func (m *instanceMetrics) recordStreamEnd(ctx context.Context, vu modules.VU,
 	}
 
 	// Record stream duration
-	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
 		TimeSeries: metrics.TimeSeries{
 			Metric: m.ConnectRPCStreamDuration,
 			Tags:   ctm.Tags,
@@ -210,9 +345,13 @@ func (m *instanceMetrics) recordStreamEnd(ctx context.Context, vu modules.VU,
 		Time:     time.Now(),
 		Metadata: ctm.Metadata,
 		Value:    metrics.D(duration),
-	})
+	}))
 }
 
+// unknownMessageSize is the size of the messages counted without being measured, like the
+// ones discarded by a stream sink, for which no size is recorded
+const unknownMessageSize = -1
+
 // recordStreamMessage records sent/received messages
 func (m *instanceMetrics) recordStreamMessage(ctx context.Context, vu modules.VU,
 	tags MetricTags, direction string, messageSize int64) {
@@ -223,12 +362,8 @@ func (m *instanceMetrics) recordStreamMessage(ctx context.Context, vu modules.VU
 	}
 
 	ctm := state.Tags.GetCurrentValues()
-	ctm.SetTag("method", tags.Method)
-	ctm.SetTag("service", tags.Service)
-	ctm.SetTag("procedure", tags.Procedure)
-	ctm.SetTag("type", "stream")
-	ctm.SetTag("protocol", tags.Protocol)
-	ctm.SetTag("content_type", tags.ContentType)
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
 	ctm.SetTag("direction", direction) // "sent" or "received"
 
 	var metric *metrics.Metric
@@ -254,7 +389,7 @@ func (m *instanceMetrics) recordStreamMessage(ctx context.Context, vu modules.VU
 		},
 	}
 
-	// Record message size if available
+	// Record message size if available, unknown sizes aren't recorded as 0
 	if messageSize > 0 {
 		var sizeMetric *metrics.Metric
 		if direction == "sent" {
@@ -281,9 +416,32 @@ func (m *instanceMetrics) recordStreamMessage(ctx context.Context, vu modules.VU
 	})
 }
 
-// recordHTTPConnection records metrics for HTTP connection establishment or reuse
+// recordStreamPaused records how long a stream was paused, once it ended
+func (m *instanceMetrics) recordStreamPaused(ctx context.Context, vu modules.VU, tags MetricTags, duration time.Duration) {
+	state := vu.State()
+	if state == nil {
+		return
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCStreamPausedDuration,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(duration),
+	}))
+}
+
+// recordHTTPConnection records metrics for HTTP connection establishment or reuse, with
+// the user and origin tags of the RPC sending the request
 func (m *instanceMetrics) recordHTTPConnection(ctx context.Context, vu modules.VU,
-	url string, isNewConnection bool, handshakeDuration time.Duration) {
+	url string, isNewConnection bool, handshakeDuration time.Duration, tags MetricTags) {
 
 	state := vu.State()
 	if state == nil {
@@ -291,6 +449,8 @@ func (m *instanceMetrics) recordHTTPConnection(ctx context.Context, vu modules.V
 	}
 
 	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setOriginTags(&ctm)
 	ctm.SetTag("url", url)
 
 	now := time.Now()
@@ -310,7 +470,7 @@ func (m *instanceMetrics) recordHTTPConnection(ctx context.Context, vu modules.V
 
 		// Record handshake duration for new connections
 		if handshakeDuration > 0 {
-			samples = append(samples, metrics.Sample{
+			samples = append(samples, m.durationSamples(metrics.Sample{
 				TimeSeries: metrics.TimeSeries{
 					Metric: m.ConnectRPCHTTPHandshakeDuration,
 					Tags:   ctm.Tags,
@@ -318,7 +478,7 @@ func (m *instanceMetrics) recordHTTPConnection(ctx context.Context, vu modules.V
 				Time:     now,
 				Metadata: ctm.Metadata,
 				Value:    metrics.D(handshakeDuration),
-			})
+			})...)
 		}
 	} else {
 		ctm.SetTag("connection_type", "reused")
@@ -342,96 +502,290 @@ func (m *instanceMetrics) recordHTTPConnection(ctx context.Context, vu modules.V
 	}
 }
 
-// registerMetrics registers the ConnectRPC module metrics
-func registerMetrics(registry *metrics.Registry) (*instanceMetrics, error) {
-	var err error
-	m := &instanceMetrics{}
-
-	// Unary request metrics
-	if m.ConnectRPCReqs, err = registry.NewMetric(
-		"connectrpc_reqs", metrics.Counter); err != nil {
-		return nil, err
+// recordConnection records an HTTP client created for the connection strategy
+func (m *instanceMetrics) recordConnection(ctx context.Context, vu modules.VU, url string) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCReqDuration, err = registry.NewMetric(
-		"connectrpc_req_duration", metrics.Trend, metrics.Time); err != nil {
-		return nil, err
-	}
+	ctm := state.Tags.GetCurrentValues()
+	ctm.SetTag("url", url)
 
-	if m.ConnectRPCReqErrors, err = registry.NewMetric(
-		"connectrpc_req_errors", metrics.Counter); err != nil {
-		return nil, err
-	}
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCConnections,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
 
-	// Stream metrics
-	if m.ConnectRPCStreams, err = registry.NewMetric(
-		"connectrpc_streams", metrics.Counter); err != nil {
-		return nil, err
+// recordConnectionEnd records how long an HTTP client created for the connection strategy
+// lived, once its connections are closed
+func (m *instanceMetrics) recordConnectionEnd(ctx context.Context, vu modules.VU, url string, duration time.Duration) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCStreamDuration, err = registry.NewMetric(
-		"connectrpc_stream_duration", metrics.Trend, metrics.Time); err != nil {
-		return nil, err
-	}
+	ctm := state.Tags.GetCurrentValues()
+	ctm.SetTag("url", url)
+
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCConnectionDuration,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(duration),
+	}))
+}
 
-	if m.ConnectRPCStreamErrors, err = registry.NewMetric(
-		"connectrpc_stream_errors", metrics.Counter); err != nil {
-		return nil, err
+// recordHTTP2Reset records an HTTP/2 stream reset, sent or received with the error code
+func (m *instanceMetrics) recordHTTP2Reset(ctx context.Context, vu modules.VU, url, direction, code string) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	// Message metrics (separated for better granularity)
-	if m.ConnectRPCStreamMsgsSent, err = registry.NewMetric(
-		"connectrpc_stream_msgs_sent", metrics.Counter); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	ctm.SetTag("url", url)
+	ctm.SetTag("direction", direction)
+	ctm.SetTag("code", code)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCHTTP2StreamResets,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
+
+// recordHTTP2Stall records a DATA frame exhausting an HTTP/2 flow-control window, the
+// sender having to wait for a window update of the receiver
+func (m *instanceMetrics) recordHTTP2Stall(ctx context.Context, vu modules.VU, url, direction, window string) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCStreamMsgsReceived, err = registry.NewMetric(
-		"connectrpc_stream_msgs_received", metrics.Counter); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	ctm.SetTag("url", url)
+	ctm.SetTag("direction", direction)
+	ctm.SetTag("window", window)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCHTTP2FlowControlStalls,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
+
+// recordProtocolViolation records a response that violated the protocol specification
+func (m *instanceMetrics) recordProtocolViolation(ctx context.Context, vu modules.VU, tags MetricTags, rule string) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	// Connection metrics
-	if m.ConnectRPCConnections, err = registry.NewMetric(
-		"connectrpc_connections", metrics.Counter); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("rule", rule)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCProtocolViolations,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
+
+// recordDroppedArrival records a stream arrival that streamArrivalRate couldn't open
+func (m *instanceMetrics) recordDroppedArrival(ctx context.Context, vu modules.VU, tags MetricTags) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCConnectionDuration, err = registry.NewMetric(
-		"connectrpc_connection_duration", metrics.Trend, metrics.Time); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCStreamArrivalsDropped,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
+
+// recordAssertionViolation records a received message or stream end violating a stream assertion
+func (m *instanceMetrics) recordAssertionViolation(ctx context.Context, vu modules.VU, tags MetricTags, assertion string) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCConnectionErrors, err = registry.NewMetric(
-		"connectrpc_connection_errors", metrics.Counter); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("assertion", assertion)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCStreamAssertionViolations,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
+
+// recordStreamCancel records how long a stream canceled by cancelAfter() or take() took to end
+func (m *instanceMetrics) recordStreamCancel(ctx context.Context, vu modules.VU, tags MetricTags, duration time.Duration) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	// HTTP connection reuse metrics
-	if m.ConnectRPCHTTPConnectionsNew, err = registry.NewMetric(
-		"connectrpc_http_connections_new", metrics.Counter); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCStreamCancelDuration,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(duration),
+	}))
+}
+
+// recordSessionStep records the duration of a step of connectrpc.session()
+func (m *instanceMetrics) recordSessionStep(ctx context.Context, vu modules.VU, tags MetricTags,
+	step int, action string, duration time.Duration) {
+
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCHTTPConnectionsReused, err = registry.NewMetric(
-		"connectrpc_http_connections_reused", metrics.Counter); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("step", strconv.Itoa(step))
+	ctm.SetTag("action", action)
+
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCSessionStepDuration,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(duration),
+	}))
+}
+
+// recordAPIMisuse records a misuse of the API, tagged with its kind
+func (m *instanceMetrics) recordAPIMisuse(ctx context.Context, vu modules.VU, tags MetricTags, misuse string) {
+	state := vu.State()
+	if state == nil {
+		return
 	}
 
-	if m.ConnectRPCHTTPHandshakeDuration, err = registry.NewMetric(
-		"connectrpc_http_handshake_duration", metrics.Trend, metrics.Time); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("misuse", misuse)
+
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCAPIMisuse,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    1,
+	})
+}
+
+// recordServerTiming records the durations of the Server-Timing header of a unary response,
+// tagged with the name of the server metric
+func (m *instanceMetrics) recordServerTiming(ctx context.Context, vu modules.VU,
+	tags MetricTags, timings []serverTiming) {
+
+	state := vu.State()
+	if state == nil || len(timings) == 0 {
+		return
 	}
 
-	// Payload size metrics
-	if m.ConnectRPCReqSize, err = registry.NewMetric(
-		"connectrpc_req_size", metrics.Trend, metrics.Data); err != nil {
-		return nil, err
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+
+	now := time.Now()
+	for _, timing := range timings {
+		if !timing.HasDuration {
+			continue
+		}
+
+		timingTags := ctm.Tags.With("timing", timing.Name)
+		metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: m.ConnectRPCServerTiming,
+				Tags:   timingTags,
+			},
+			Time:     now,
+			Metadata: ctm.Metadata,
+			Value:    timing.Duration,
+		}))
 	}
+}
+
+// registerMetrics registers the ConnectRPC module metrics of metricDefinitions, with names prepended by prefix,
+// and the histograms of the duration trends with buckets
+func registerMetrics(registry *metrics.Registry, prefix string, buckets []time.Duration) (*instanceMetrics, error) {
+	m := &instanceMetrics{saturationWarned: &sync.Map{}, activeStreams: &activeStreams{}}
+
+	for _, d := range metricDefinitions {
+		var contains []metrics.ValueType
+		if d.contains != metrics.Default {
+			contains = append(contains, d.contains)
+		}
 
-	if m.ConnectRPCRespSize, err = registry.NewMetric(
-		"connectrpc_resp_size", metrics.Trend, metrics.Data); err != nil {
-		return nil, err
+		metric, err := registry.NewMetric(prefix+d.name, d.metricType, contains...)
+		if err != nil {
+			return nil, err
+		}
+		*d.field(m) = metric
 	}
 
+	if len(buckets) > 0 {
+		if err := m.registerHistograms(registry, prefix, buckets); err != nil {
+			return nil, err
+		}
+	}
 	return m, nil
 }
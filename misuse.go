@@ -0,0 +1,70 @@
+package connectrpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Misuses of the API, the values of the misuse tag of connectrpc_api_misuse
+const (
+	// misuseStreamOnUnary is a connectrpc.Stream opened on a unary method
+	misuseStreamOnUnary = "stream_on_unary"
+	// misuseInvokeOnStream is invoke() or asyncInvoke() called on a streaming method
+	misuseInvokeOnStream = "invoke_on_stream"
+	// misuseConnectInFlight is connect() called while asyncInvoke() calls are in flight
+	misuseConnectInFlight = "connect_in_flight"
+)
+
+// checkMethodType returns an error if a method is called with the API of another stream
+// type: a stream for a unary method, or invoke() for a streaming one. The server would only
+// answer with a confusing error, or a unary response the stream doesn't expect.
+func (c *Client) checkMethodType(method string, methodDesc protoreflect.MethodDescriptor, stream bool) error {
+	unary := !methodDesc.IsStreamingClient() && !methodDesc.IsStreamingServer()
+
+	var misuse, callType string
+	var err error
+	switch {
+	case stream && unary:
+		misuse, callType = misuseStreamOnUnary, "stream"
+		err = fmt.Errorf("%s is a unary method, call it with client.invoke() or client.asyncInvoke()", method)
+	case !stream && !unary:
+		misuse, callType = misuseInvokeOnStream, "unary"
+		err = fmt.Errorf("%s is a streaming method, call it with new connectrpc.Stream()", method)
+	default:
+		return nil
+	}
+
+	c.recordMisuse(method, callType, misuse)
+	return err
+}
+
+// checkConnectIdle returns an error if connect() is called while asyncInvoke() calls of the
+// client are in flight. Their goroutines read the connection of the client without locks,
+// so it can't be replaced under them: a client is used from its VU alone, and its calls
+// must be awaited before connecting it again. The streams keep what they read of the
+// connection, and Close() may be called any time, as the calls keep their HTTP client.
+func (c *Client) checkConnectIdle() error {
+	calls := c.inFlight.pending()
+	if calls == 0 {
+		return nil
+	}
+
+	c.recordMisuse("", "", misuseConnectInFlight)
+	return fmt.Errorf("connect() called while %d asyncInvoke() calls of the client are in flight: "+
+		"await them before connecting again, or use another client", calls)
+}
+
+// recordMisuse counts a misuse in connectrpc_api_misuse, since scripts may catch the error
+func (c *Client) recordMisuse(method, callType, misuse string) {
+	if c.metrics == nil {
+		return
+	}
+	protocol, contentType := "connect", "application/json"
+	if c.connectParams != nil {
+		protocol, contentType = c.connectParams.Protocol, c.connectParams.ContentType
+	}
+	tags := c.createMetricTags(method, protocol, contentType)
+	tags.Type = callType
+	c.metrics.recordAPIMisuse(c.vu.Context(), c.vu, tags, misuse)
+}
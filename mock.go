@@ -0,0 +1,454 @@
+package connectrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"github.com/mstoykov/k6-taskqueue-lib/taskqueue"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// mockScheme is the scheme of the addresses answered in memory by the `handlers` of connect()
+const mockScheme = "mock://"
+
+// mockServer answers the calls of a client connected to a mock:// address with the JS
+// handlers of the `handlers` connect parameter, so that scripts can be tested without a
+// backend. The calls go through the whole client stack to an in-memory HTTP/2 server,
+// whose connect handlers run the JS handlers on the event loop of the VU.
+//
+// The event loop runs the handlers in two ways. The async calls and the streams keep a
+// task queue open while they are in flight, see begin. The sync calls block the event
+// loop instead, so they run the handlers themselves while waiting, see await.
+type mockServer struct {
+	vu        modules.VU
+	mux       *http.ServeMux
+	h2        *http2.Server
+	transport *http2.Transport
+
+	mu      sync.Mutex
+	tq      *taskqueue.TaskQueue // Open while async calls or streams are in flight
+	calls   int                  // Async calls and streams in flight
+	pending []func()             // Handlers waiting for the event loop
+	wake    chan struct{}        // Wakes the sync call waiting for a response
+}
+
+// mockHandler is the JS handler of a method
+type mockHandler struct {
+	procedure string
+	desc      protoreflect.MethodDescriptor
+	fn        sobek.Callable
+}
+
+// newMockServer creates the in-memory server answering the methods of handlers, an object
+// of JS functions by method name. The other methods are unimplemented.
+func newMockServer(vu modules.VU, handlers map[string]sobek.Value) (*mockServer, error) {
+	m := &mockServer{
+		vu:   vu,
+		mux:  http.NewServeMux(),
+		h2:   &http2.Server{},
+		wake: make(chan struct{}, 1),
+	}
+	m.transport = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(context.Context, string, string, *tls.Config) (net.Conn, error) {
+			conn, server := net.Pipe()
+			go m.h2.ServeConn(server, &http2.ServeConnOpts{Handler: m.mux})
+			return conn, nil
+		},
+	}
+
+	for method, value := range handlers {
+		procedure := dynamic.MethodPath(method)
+		desc, err := globalProtoRegistry.getMethodDescriptor(procedure)
+		if err != nil {
+			return nil, fmt.Errorf("handler of %s: %w", method, err)
+		}
+		fn, ok := sobek.AssertFunction(value)
+		if !ok {
+			return nil, fmt.Errorf("handler of %s must be a function", method)
+		}
+		m.mux.Handle(procedure, m.connectHandler(&mockHandler{procedure: procedure, desc: desc, fn: fn}))
+	}
+	return m, nil
+}
+
+// connectHandler returns the connect handler of a method answered by its JS handler
+func (m *mockServer) connectHandler(h *mockHandler) http.Handler {
+	return newDynamicHandler(h.desc, func(
+		ctx context.Context, header http.Header, requests []*dynamicpb.Message,
+	) ([]*dynamicpb.Message, time.Duration, error) {
+		responses, err := m.call(ctx, h, header, requests...)
+		return responses, 0, err
+	})
+}
+
+// dynamicResponder answers the calls of a dynamic handler. It gets the request of the
+// unary and server streaming calls, the array of requests of the client streaming ones,
+// and each request of the bidi streaming ones. It returns the responses, exactly one for
+// the unary and client streaming calls, and the interval between the streamed ones.
+type dynamicResponder func(
+	ctx context.Context, header http.Header, requests []*dynamicpb.Message,
+) ([]*dynamicpb.Message, time.Duration, error)
+
+// newDynamicHandler returns the connect handler of a method with dynamic messages, by its
+// stream type
+func newDynamicHandler(desc protoreflect.MethodDescriptor, respond dynamicResponder) http.Handler {
+	procedure := "/" + string(desc.Parent().FullName()) + "/" + string(desc.Name())
+	opts := []connect.HandlerOption{
+		connect.WithSchema(desc),
+		connect.WithRequestInitializer(func(_ connect.Spec, message any) error {
+			msg, ok := message.(*dynamicpb.Message)
+			if !ok {
+				return fmt.Errorf("unexpected request type %T", message)
+			}
+			*msg = *dynamicpb.NewMessage(desc.Input())
+			return nil
+		}),
+	}
+	opts = append(opts, codecHandlerOptions()...)
+
+	switch {
+	case desc.IsStreamingClient() && desc.IsStreamingServer():
+		return connect.NewBidiStreamHandler(procedure, func(
+			ctx context.Context, stream *connect.BidiStream[dynamicpb.Message, dynamicpb.Message],
+		) error {
+			for {
+				req, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				responses, interval, err := respond(ctx, stream.RequestHeader(), []*dynamicpb.Message{req})
+				if err != nil {
+					return err
+				}
+				if err := sendDynamic(ctx, stream.Send, responses, interval); err != nil {
+					return err
+				}
+			}
+		}, opts...)
+
+	case desc.IsStreamingClient():
+		return connect.NewClientStreamHandler(procedure, func(
+			ctx context.Context, stream *connect.ClientStream[dynamicpb.Message],
+		) (*connect.Response[dynamicpb.Message], error) {
+			var requests []*dynamicpb.Message
+			for stream.Receive() {
+				requests = append(requests, stream.Msg())
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+			responses, _, err := respond(ctx, stream.RequestHeader(), requests)
+			if err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(responses[0]), nil
+		}, opts...)
+
+	case desc.IsStreamingServer():
+		return connect.NewServerStreamHandler(procedure, func(
+			ctx context.Context, req *connect.Request[dynamicpb.Message], stream *connect.ServerStream[dynamicpb.Message],
+		) error {
+			responses, interval, err := respond(ctx, req.Header(), []*dynamicpb.Message{req.Msg})
+			if err != nil {
+				return err
+			}
+			return sendDynamic(ctx, stream.Send, responses, interval)
+		}, opts...)
+
+	default:
+		return connect.NewUnaryHandler(procedure, func(
+			ctx context.Context, req *connect.Request[dynamicpb.Message],
+		) (*connect.Response[dynamicpb.Message], error) {
+			responses, _, err := respond(ctx, req.Header(), []*dynamicpb.Message{req.Msg})
+			if err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(responses[0]), nil
+		}, opts...)
+	}
+}
+
+// sendDynamic sends the responses of a stream, waiting interval between them
+func sendDynamic(
+	ctx context.Context, send func(*dynamicpb.Message) error, responses []*dynamicpb.Message, interval time.Duration,
+) error {
+	for i, resp := range responses {
+		if i > 0 && interval > 0 {
+			if err := sleepContext(ctx, interval); err != nil {
+				return err
+			}
+		}
+		if err := send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for d, or returns the canceled error of the call once ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return connect.NewError(connect.CodeCanceled, ctx.Err())
+	}
+}
+
+// call runs the JS handler of a method on the event loop, and returns its responses. The
+// unary and client streaming methods always have one, the empty message if the handler
+// returned nothing.
+func (m *mockServer) call(
+	ctx context.Context, h *mockHandler, header http.Header, requests ...*dynamicpb.Message,
+) ([]*dynamicpb.Message, error) {
+	requestsJSON := make([][]byte, len(requests))
+	for i, req := range requests {
+		var err error
+		if requestsJSON[i], err = protojson.Marshal(req); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	type result struct {
+		responses [][]byte
+		err       error
+	}
+	results := make(chan result, 1)
+	m.onLoop(func() {
+		responses, err := m.runHandler(h, header, requestsJSON)
+		results <- result{responses: responses, err: err}
+	})
+
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return nil, connect.NewError(connect.CodeCanceled, ctx.Err())
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	if len(res.responses) == 0 && !h.desc.IsStreamingServer() {
+		res.responses = [][]byte{[]byte("{}")}
+	}
+	responses := make([]*dynamicpb.Message, len(res.responses))
+	for i, data := range res.responses {
+		responses[i] = dynamicpb.NewMessage(h.desc.Output())
+		if err := unmarshalRequest(data, responses[i]); err != nil {
+			return nil, connect.NewError(connect.CodeInternal,
+				fmt.Errorf("the handler of %s returned an invalid message: %w", h.procedure, err))
+		}
+	}
+	return responses, nil
+}
+
+// runHandler calls the JS handler with the requests, and returns the JSON of its
+// responses. It must be called on the event loop.
+func (m *mockServer) runHandler(h *mockHandler, header http.Header, requestsJSON [][]byte) ([][]byte, error) {
+	rt := m.vu.Runtime()
+
+	requests := make([]interface{}, len(requestsJSON))
+	for i, data := range requestsJSON {
+		if err := json.Unmarshal(data, &requests[i]); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+	var arg sobek.Value
+	if h.desc.IsStreamingClient() && !h.desc.IsStreamingServer() {
+		arg = rt.ToValue(requests)
+	} else {
+		arg = rt.ToValue(requests[0])
+	}
+
+	headers := make(map[string]string, len(header))
+	for key := range header {
+		headers[strings.ToLower(key)] = header.Get(key)
+	}
+	call := rt.NewObject()
+	must(rt, call.Set("method", h.procedure))
+	must(rt, call.Set("headers", headers))
+
+	value, err := h.fn(sobek.Undefined(), arg, call)
+	if err != nil {
+		return nil, mockError(rt, err)
+	}
+	if common.IsNullish(value) {
+		return nil, nil
+	}
+
+	// The streaming handlers may return an array of responses
+	values := []sobek.Value{value}
+	if obj, ok := value.(*sobek.Object); ok && obj.ClassName() == "Array" && h.desc.IsStreamingServer() {
+		values = values[:0]
+		length := int(obj.Get("length").ToInteger())
+		for i := 0; i < length; i++ {
+			values = append(values, obj.Get(fmt.Sprint(i)))
+		}
+	}
+
+	responses := make([][]byte, 0, len(values))
+	for _, v := range values {
+		data, err := marshalRequest(rt, v)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+		responses = append(responses, data)
+	}
+	return responses, nil
+}
+
+// mockError converts the exception thrown by a handler to the error of the call. An object
+// with a code, like { code: 'not_found', message: 'no such user' }, gives its status.
+func mockError(rt *sobek.Runtime, err error) error {
+	var exception *sobek.Exception
+	if !errors.As(err, &exception) {
+		return connect.NewError(connect.CodeUnknown, err)
+	}
+
+	code := connect.CodeUnknown
+	message := exception.Value().String()
+	if obj, ok := exception.Value().(*sobek.Object); ok {
+		if v := obj.Get("code"); !common.IsNullish(v) {
+			if err := code.UnmarshalText([]byte(v.String())); err != nil {
+				code = connect.CodeUnknown
+			}
+		}
+		if v := obj.Get("message"); !common.IsNullish(v) {
+			message = v.String()
+		}
+	}
+	return connect.NewError(code, errors.New(message))
+}
+
+// onLoop runs a handler on the event loop, through the task queue of the calls in flight
+// and the sync call waiting, whichever gets to it first
+func (m *mockServer) onLoop(run func()) {
+	m.mu.Lock()
+	m.pending = append(m.pending, run)
+	tq := m.tq
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	if tq != nil {
+		tq.Queue(func() error {
+			m.runPending()
+			return nil
+		})
+	}
+}
+
+// runPending runs the handlers waiting for the event loop. It must be called on the event loop.
+func (m *mockServer) runPending() {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	for _, run := range pending {
+		run()
+	}
+}
+
+// begin keeps the event loop running the handlers while an async call or a stream is in
+// flight. It must be called on the event loop, and the returned function once it's done.
+func (m *mockServer) begin() func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tq == nil {
+		m.tq = taskqueue.New(m.vu.RegisterCallback)
+	}
+	m.calls++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			m.calls--
+			if m.calls == 0 {
+				m.tq.Close()
+				m.tq = nil
+			}
+		})
+	}
+}
+
+// await runs a call blocking the event loop, running the handlers it needs meanwhile
+func (m *mockServer) await(call func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		call()
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-m.wake:
+			m.runPending()
+		}
+	}
+}
+
+// awaitMock runs a call blocking the event loop. With a mock:// address, the JS handlers
+// answering the call run meanwhile, see mockServer.
+func (c *Client) awaitMock(call func()) {
+	if c.mock == nil {
+		call()
+		return
+	}
+	c.mock.await(call)
+}
+
+// beginMock keeps the event loop running the JS handlers of a mock:// address while an
+// async call or a stream is in flight. The returned function must be called once it's done.
+func (c *Client) beginMock() func() {
+	if c.mock == nil {
+		return func() {}
+	}
+	return c.mock.begin()
+}
+
+// parseHandlers parses the `handlers` connect parameter, an object of functions by method
+func parseHandlers(value sobek.Value) (map[string]sobek.Value, error) {
+	obj, ok := value.(*sobek.Object)
+	if !ok {
+		return nil, errors.New("must be an object of functions by method")
+	}
+	handlers := make(map[string]sobek.Value)
+	for _, method := range obj.Keys() {
+		handlers[method] = obj.Get(method)
+	}
+	return handlers, nil
+}
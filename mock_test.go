@@ -0,0 +1,132 @@
+package connectrpc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockAddress(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var client = new connectrpc.Client();
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var total = 0;
+			client.connect('mock://', {
+				handlers: {
+					'/k6.connectrpc.ping.v1.PingService/Ping': function(request, call) {
+						return { number: request.number * 2, text: call.headers['x-user'] };
+					},
+					'k6.connectrpc.ping.v1.PingService/Fail': function() {
+						throw { code: 'not_found', message: 'no such user' };
+					},
+					'/k6.connectrpc.ping.v1.PingService/CountUp': function(request) {
+						var numbers = [];
+						for (var i = 1; i <= request.number; i++) {
+							numbers.push({ number: i });
+						}
+						return numbers;
+					},
+					'/k6.connectrpc.ping.v1.PingService/CumSum': function(request) {
+						total += Number(request.number);
+						return { sum: total };
+					},
+				},
+			});
+
+			var pinged = client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 21 }, {
+				headers: { 'x-user': 'ann' },
+			});
+			var failed = client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+			var empty = new connectrpc.Client();
+			empty.connect('mock://');
+			var unimplemented = empty.invoke('/k6.connectrpc.ping.v1.PingService/Ping', {});
+			var async = await client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 2 });
+
+			var counted = [];
+			var countUp = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+			countUp.write({ number: 3 });
+			countUp.end();
+			for (var msg = countUp.read(); msg !== null; msg = countUp.read()) {
+				counted.push(msg.number);
+			}
+
+			var sums = [];
+			var cumSum = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var ended = new Promise(function(resolve, reject) {
+				cumSum.on('data', function(data) { sums.push(data.sum); });
+				cumSum.on('end', resolve);
+				cumSum.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			cumSum.write({ number: 1 });
+			cumSum.write({ number: 2 });
+			cumSum.end();
+			await ended;
+
+			call(JSON.stringify({
+				pinged: pinged.message,
+				failed: [failed.message.code, failed.message.message],
+				unimplemented: unimplemented.message.code,
+				async: async.message.number,
+				counted: counted,
+				sums: sums,
+			}));
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	require.Len(t, ts.callRecorder.Recorded(), 1)
+	assert.JSONEq(t, `{
+		"pinged": {"number": "42", "text": "ann"},
+		"failed": ["not_found", "not_found: no such user"],
+		"unimplemented": "unimplemented",
+		"async": "4",
+		"counted": ["1", "2", "3"],
+		"sums": ["1", "3"]
+	}`, ts.callRecorder.Recorded()[0])
+}
+
+func TestMockAddressInvalid(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	for _, tc := range []struct {
+		script string
+		err    string
+	}{
+		{
+			`client.connect('mock://', { handlers: { '/k6.connectrpc.ping.v1.PingService/Missing': function() {} } })`,
+			"invalid handlers: handler of /k6.connectrpc.ping.v1.PingService/Missing",
+		},
+		{
+			`client.connect('mock://', { handlers: { '/k6.connectrpc.ping.v1.PingService/Ping': 42 } })`,
+			"handler of /k6.connectrpc.ping.v1.PingService/Ping must be a function",
+		},
+		{
+			`client.connect('localhost:8080', { handlers: {} })`,
+			"handlers require a mock:// address",
+		},
+	} {
+		_, err := ts.Run(`var client = new connectrpc.Client(); ` + tc.script)
+		require.Error(t, err, tc.script)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
@@ -0,0 +1,436 @@
+package connectrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxRecordedRequests is the number of requests a mock server keeps per method for recorded()
+const maxRecordedRequests = 1000
+
+// mockServers holds the servers started by connectrpc.mockServer(), by port. They are shared
+// by all the VUs, so that the init context of every VU can start the same one.
+var mockServers = struct {
+	sync.Mutex
+	servers map[int]*ruleServer
+}{servers: make(map[int]*ruleServer)}
+
+// ruleServer is a local Connect server answering every method loaded before it was started,
+// from its rules or with messages generated from the descriptors. Unlike the handlers of a
+// mock:// address, it outlives the VU that started it, so its rules are data rather than JS
+// functions.
+type ruleServer struct {
+	port   int
+	server *http.Server
+
+	recordedMu sync.Mutex
+	recorded   map[string][][]byte // protojson of the last requests received, by method
+}
+
+// mockRule is a rule of a method: the requests it applies to, its responses and its faults
+type mockRule struct {
+	when      map[string]string    // Request fields the rule applies to, by dotted JSON path
+	responses []*dynamicpb.Message // Played back in turn
+	next      atomic.Uint64
+
+	count    int           // Messages of the server streams, the number of responses by default
+	interval time.Duration // Between the messages of the streams
+
+	delayMin, delayMax time.Duration
+
+	errorPercent float64
+	errorCode    connect.Code
+	errorMessage string
+}
+
+// mockServer starts a local Connect server on port, or a random port with 0, answering the
+// methods loaded so far. It returns the server already started on the port if any.
+func (mi *ModuleInstance) mockServer(port int, options sobek.Value) (*sobek.Object, error) {
+	rt := mi.vu.Runtime()
+
+	mockServers.Lock()
+	defer mockServers.Unlock()
+
+	s, ok := mockServers.servers[port]
+	if !ok || port == 0 {
+		var rulesVal sobek.Value
+		if obj, isObj := options.(*sobek.Object); isObj {
+			rulesVal = obj.Get("rules")
+		}
+		rules, err := parseMockRules(rt, rulesVal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mockServer rules: %w", err)
+		}
+		if s, err = startRuleServer(port, rules); err != nil {
+			return nil, fmt.Errorf("failed to start the mock server: %w", err)
+		}
+		mockServers.servers[s.port] = s
+	}
+
+	obj := rt.NewObject()
+	must(rt, obj.Set("port", s.port))
+	must(rt, obj.Set("url", fmt.Sprintf("http://127.0.0.1:%d", s.port)))
+	must(rt, obj.Set("recorded", func(method string) interface{} {
+		return s.requests(dynamic.MethodPath(method))
+	}))
+	must(rt, obj.Set("close", func() error {
+		mockServers.Lock()
+		defer mockServers.Unlock()
+		if mockServers.servers[s.port] == s {
+			delete(mockServers.servers, s.port)
+		}
+		return s.server.Close()
+	}))
+	return obj, nil
+}
+
+// startRuleServer serves every loaded method on port, over HTTP/1.1 and h2c
+func startRuleServer(port int, rules map[string][]*mockRule) (*ruleServer, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ruleServer{
+		port:     listener.Addr().(*net.TCPAddr).Port,
+		recorded: make(map[string][][]byte),
+	}
+	mux := http.NewServeMux()
+	for procedure, desc := range globalProtoRegistry.allMethodDescriptors() {
+		methodRules := rules[procedure]
+		mux.Handle(procedure, newDynamicHandler(desc, func(
+			ctx context.Context, _ http.Header, requests []*dynamicpb.Message,
+		) ([]*dynamicpb.Message, time.Duration, error) {
+			return s.respond(ctx, procedure, desc, methodRules, requests)
+		}))
+	}
+	s.server = &http.Server{
+		Handler:           h2c.NewHandler(mux, &http2.Server{}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go s.server.Serve(listener) //nolint:errcheck
+
+	return s, nil
+}
+
+// respond answers a call with the first rule matching its last request
+func (s *ruleServer) respond(
+	ctx context.Context, procedure string, desc protoreflect.MethodDescriptor,
+	rules []*mockRule, requests []*dynamicpb.Message,
+) ([]*dynamicpb.Message, time.Duration, error) {
+	var request map[string]interface{}
+	for _, req := range requests {
+		data, err := protojson.Marshal(req)
+		if err != nil {
+			return nil, 0, connect.NewError(connect.CodeInternal, err)
+		}
+		s.record(procedure, data)
+		request = nil
+		if err := json.Unmarshal(data, &request); err != nil {
+			return nil, 0, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	var rule *mockRule
+	for _, r := range rules {
+		if r.matches(request) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		return []*dynamicpb.Message{sampleMessage(desc.Output(), 0)}, 0, nil
+	}
+
+	if delay := rule.delay(); delay > 0 {
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, 0, err
+		}
+	}
+	if rule.errorPercent > 0 && rand.Float64()*100 < rule.errorPercent { //nolint:gosec
+		return nil, 0, connect.NewError(rule.errorCode, errors.New(rule.errorMessage))
+	}
+
+	count := 1
+	if desc.IsStreamingServer() && !desc.IsStreamingClient() {
+		count = rule.count
+	}
+	responses := make([]*dynamicpb.Message, count)
+	for i := range responses {
+		if len(rule.responses) == 0 {
+			responses[i] = sampleMessage(desc.Output(), 0)
+			continue
+		}
+		next := rule.next.Add(1) - 1
+		responses[i] = proto.Clone(rule.responses[next%uint64(len(rule.responses))]).(*dynamicpb.Message)
+	}
+	return responses, rule.interval, nil
+}
+
+// record keeps the protojson of a request for recorded()
+func (s *ruleServer) record(procedure string, data []byte) {
+	s.recordedMu.Lock()
+	defer s.recordedMu.Unlock()
+
+	requests := append(s.recorded[procedure], data)
+	if len(requests) > maxRecordedRequests {
+		requests = requests[len(requests)-maxRecordedRequests:]
+	}
+	s.recorded[procedure] = requests
+}
+
+// requests returns the last requests received for a method, oldest first
+func (s *ruleServer) requests(procedure string) []interface{} {
+	s.recordedMu.Lock()
+	defer s.recordedMu.Unlock()
+
+	requests := make([]interface{}, 0, len(s.recorded[procedure]))
+	for _, data := range s.recorded[procedure] {
+		var request interface{}
+		if json.Unmarshal(data, &request) == nil {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// matches reports whether the rule applies to a request decoded from its protojson
+func (r *mockRule) matches(request map[string]interface{}) bool {
+	for path, want := range r.when {
+		var value interface{} = request
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			value = obj[key]
+		}
+		if value == nil || fmt.Sprint(value) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// delay returns the delay of a response, uniformly between the min and max delays
+func (r *mockRule) delay() time.Duration {
+	if r.delayMax <= r.delayMin {
+		return r.delayMin
+	}
+	return r.delayMin + rand.N(r.delayMax-r.delayMin) //nolint:gosec
+}
+
+// parseMockRules parses the rules of mockServer(): a rule or an array of rules by method,
+// the first matching one answering each call
+func parseMockRules(rt *sobek.Runtime, value sobek.Value) (map[string][]*mockRule, error) {
+	rules := make(map[string][]*mockRule)
+	obj, ok := value.(*sobek.Object)
+	if !ok {
+		return rules, nil
+	}
+
+	for _, method := range obj.Keys() {
+		procedure := dynamic.MethodPath(method)
+		desc, err := globalProtoRegistry.getMethodDescriptor(procedure)
+		if err != nil {
+			return nil, fmt.Errorf("rule of %s: %w", method, err)
+		}
+
+		var configs []interface{}
+		switch config := obj.Get(method).ToObject(rt).Export().(type) {
+		case []interface{}:
+			configs = config
+		case map[string]interface{}:
+			configs = []interface{}{config}
+		default:
+			return nil, fmt.Errorf("rule of %s must be an object or an array of objects", method)
+		}
+		for i, config := range configs {
+			ruleConfig, ok := config.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("rule %d of %s must be an object", i, method)
+			}
+			rule, err := newMockRule(desc, ruleConfig)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d of %s: %w", i, method, err)
+			}
+			rules[procedure] = append(rules[procedure], rule)
+		}
+	}
+	return rules, nil
+}
+
+// newMockRule creates a rule of a method from its JS object
+func newMockRule(desc protoreflect.MethodDescriptor, config map[string]interface{}) (*mockRule, error) {
+	r := &mockRule{errorCode: connect.CodeUnavailable, errorMessage: "mock server error"}
+
+	if when, ok := config["when"].(map[string]interface{}); ok {
+		r.when = make(map[string]string, len(when))
+		for path, value := range when {
+			r.when[path] = fmt.Sprint(value)
+		}
+	}
+
+	var responses []interface{}
+	if response, ok := config["response"]; ok && response != nil {
+		responses = append(responses, response)
+	}
+	if list, ok := config["responses"].([]interface{}); ok {
+		responses = append(responses, list...)
+	}
+	for i, response := range responses {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		msg := dynamicpb.NewMessage(desc.Output())
+		if err := unmarshalRequest(data, msg); err != nil {
+			return nil, fmt.Errorf("invalid response %d: %w", i, err)
+		}
+		r.responses = append(r.responses, msg)
+	}
+
+	r.count = max(len(r.responses), 1)
+	if count, ok := config["count"]; ok {
+		n, isInt := count.(int64)
+		if !isInt || n < 0 {
+			return nil, errors.New("count must be a positive integer")
+		}
+		r.count = int(n)
+	}
+
+	var err error
+	if interval, ok := config["interval"].(string); ok {
+		if r.interval, err = time.ParseDuration(interval); err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+	}
+
+	switch delay := config["delay"].(type) {
+	case string:
+		if r.delayMin, err = time.ParseDuration(delay); err != nil {
+			return nil, fmt.Errorf("invalid delay: %w", err)
+		}
+		r.delayMax = r.delayMin
+	case map[string]interface{}:
+		minDelay, _ := delay["min"].(string)
+		maxDelay, _ := delay["max"].(string)
+		if r.delayMin, err = time.ParseDuration(minDelay); err != nil {
+			return nil, fmt.Errorf("invalid delay min: %w", err)
+		}
+		if r.delayMax, err = time.ParseDuration(maxDelay); err != nil {
+			return nil, fmt.Errorf("invalid delay max: %w", err)
+		}
+	case nil:
+	default:
+		return nil, errors.New("delay must be a duration string or an object like { min, max }")
+	}
+
+	if errorVal, ok := config["error"]; ok && errorVal != nil {
+		errorConfig, ok := errorVal.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("error must be an object like { code, percent, message }")
+		}
+		r.errorPercent = 100
+		if percent, ok := errorConfig["percent"]; ok {
+			if r.errorPercent, err = parsePercent(percent); err != nil {
+				return nil, fmt.Errorf("invalid error percent: %w", err)
+			}
+		}
+		if code, ok := errorConfig["code"].(string); ok {
+			if err := r.errorCode.UnmarshalText([]byte(code)); err != nil {
+				return nil, fmt.Errorf("invalid error code: %w", err)
+			}
+		}
+		if message, ok := errorConfig["message"].(string); ok {
+			r.errorMessage = message
+		}
+	}
+
+	return r, nil
+}
+
+// sampleMessage generates a message with all its fields set, from their names and types,
+// for the methods without a response rule. The nested messages stop after a few levels.
+func sampleMessage(desc protoreflect.MessageDescriptor, depth int) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(desc)
+	if depth > 3 {
+		return msg
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && oneof.Fields().Get(0) != fd {
+			continue // Only the first member of a oneof is set
+		}
+
+		switch {
+		case fd.IsMap():
+			entries := msg.Mutable(fd).Map()
+			entries.Set(sampleValue(fd.MapKey(), depth).MapKey(), sampleValue(fd.MapValue(), depth))
+		case fd.IsList():
+			msg.Mutable(fd).List().Append(sampleValue(fd, depth))
+		default:
+			msg.Set(fd, sampleValue(fd, depth))
+		}
+	}
+	return msg
+}
+
+// sampleValue generates a value of a field, see sampleMessage
+func sampleValue(fd protoreflect.FieldDescriptor, depth int) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(true)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		value := values.Get(0)
+		if values.Len() > 1 {
+			value = values.Get(1)
+		}
+		return protoreflect.ValueOfEnum(value.Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(1)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(1)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(1)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(1)
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(1.5)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(1.5)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(string(fd.Name()))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(fd.Name()))
+	default:
+		// The well-known types keep their zero values, which are always valid
+		if strings.HasPrefix(string(fd.Message().FullName()), "google.protobuf.") {
+			return protoreflect.ValueOfMessage(dynamicpb.NewMessage(fd.Message()))
+		}
+		return protoreflect.ValueOfMessage(sampleMessage(fd.Message(), depth+1))
+	}
+}
@@ -0,0 +1,93 @@
+package connectrpc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockServer(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var server = connectrpc.mockServer(0, {
+			rules: {
+				'/k6.connectrpc.ping.v1.PingService/Ping': [
+					{ when: { text: 'slow' }, delay: '10ms', response: { text: 'late' } },
+					{ when: { text: 'down' }, error: { code: 'unavailable', message: 'maintenance' } },
+					{ responses: [{ number: 1 }, { number: 2 }] },
+				],
+				'/k6.connectrpc.ping.v1.PingService/CountUp': { count: 3, interval: '1ms' },
+			},
+		});
+		var client = new connectrpc.Client();
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		client.connect(server.url, { plaintext: true });
+		var ping = function(text) {
+			return client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { text: text });
+		};
+		var down = ping('down');
+		var results = {
+			slow: ping('slow').message.text,
+			down: [down.status, down.message.code, down.message.message],
+			playback: [ping('a').message.number, ping('b').message.number, ping('c').message.number],
+			generated: client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 1 }).status,
+			recorded: server.recorded('/k6.connectrpc.ping.v1.PingService/Ping').map(function(r) { return r.text; }),
+		};
+
+		var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+		stream.write({ number: 10 });
+		stream.end();
+		var counted = [];
+		for (var msg = stream.read(); msg !== null; msg = stream.read()) {
+			counted.push(msg.number);
+		}
+		results.counted = counted;
+
+		client.close();
+		server.close();
+		JSON.stringify(results);
+	`)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"slow": "late",
+		"down": [503, "unavailable", "unavailable: maintenance"],
+		"playback": ["1", "2", "1"],
+		"generated": 200,
+		"recorded": ["down", "slow", "a", "b", "c"],
+		"counted": ["1", "1", "1"]
+	}`, val.String())
+}
+
+func TestMockServerInvalidRules(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		rules string
+		err   string
+	}{
+		{`{ '/k6.connectrpc.ping.v1.PingService/Missing': {} }`, `rule of /k6.connectrpc.ping.v1.PingService/Missing`},
+		{`{ '/k6.connectrpc.ping.v1.PingService/Ping': { response: { number: 'many' } } }`, `rule 0 of /k6.connectrpc.ping.v1.PingService/Ping: invalid response 0: field number: expected number, got string "many"`},
+		{`{ '/k6.connectrpc.ping.v1.PingService/Ping': { error: { code: 'broken' } } }`, `invalid error code`},
+		{`{ '/k6.connectrpc.ping.v1.PingService/Ping': { delay: 5 } }`, `delay must be a duration string or an object like { min, max }`},
+	} {
+		_, err := ts.Run(`connectrpc.mockServer(0, { rules: ` + tc.rules + ` })`)
+		require.Error(t, err, tc.rules)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
@@ -0,0 +1,225 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/grafana/sobek"
+)
+
+// Environment variables overriding the options set with setGlobalOptions()
+const (
+	envDefaultProtocol    = "K6_CONNECTRPC_DEFAULT_PROTOCOL"
+	envDefaultContentType = "K6_CONNECTRPC_DEFAULT_CONTENT_TYPE"
+	envDefaultTimeout     = "K6_CONNECTRPC_DEFAULT_TIMEOUT"
+	envMetricPrefix       = "K6_CONNECTRPC_METRIC_PREFIX"
+	envUserAgent          = "K6_CONNECTRPC_USER_AGENT"
+	envLatencyHistograms  = "K6_CONNECTRPC_LATENCY_HISTOGRAMS"
+	envMetricModel        = "K6_CONNECTRPC_METRIC_MODEL"
+	envHistogramBuckets   = "K6_CONNECTRPC_HISTOGRAM_BUCKETS"
+	envMaxConnsPerVU      = "K6_CONNECTRPC_MAX_CONNECTIONS_PER_VU"
+	envMaxTotalConns      = "K6_CONNECTRPC_MAX_TOTAL_CONNECTIONS"
+	envConnectionBudget   = "K6_CONNECTRPC_CONNECTION_BUDGET"
+	envRampDown           = "K6_CONNECTRPC_RAMP_DOWN"
+)
+
+// moduleDefaults holds the per-VU defaults shared by all clients of a module instance
+type moduleDefaults struct {
+	protocol         string
+	contentType      string
+	timeout          *time.Duration
+	metricPrefix     string
+	userAgent        *string         // nil for the default User-Agent
+	hdrHistograms    bool            // Whether the latencies are recorded in HDR histograms, see latencyHistograms()
+	metricModel      string          // "histogram" to record the durations as histograms, see histogramBuckets()
+	buckets          []time.Duration // Buckets of histogramBuckets, nil for the default ones
+	rejectRampDown   bool            // Whether new calls fail while the scenario ramps down, see checkRampDown()
+	responseCallback *responseCallback
+	sampleHooks      *sampleHooks                // Hooks of onSample(), registered in the init context
+	lookupEnv        func(string) (string, bool) // Environment of the init context, as InitEnv() is nil in the VU context
+
+	// Connection budget, see connectionBudget()
+	maxConnsPerVU    int
+	maxTotalConns    int
+	queueConnections bool             // Whether the dials over budget wait rather than fail
+	vuConnections    *connectionLimit // Connections open by the VU
+}
+
+// applyOptions applies the options passed to setGlobalOptions(). Numbers and booleans are
+// set like their string, as for the environment variables.
+func (d *moduleDefaults) applyOptions(options map[string]interface{}) error {
+	for k, v := range options {
+		var str string
+		switch v := v.(type) {
+		case string:
+			str = v
+		case int64, float64, bool:
+			str = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("%s must be a string, number or boolean", k)
+		}
+
+		if err := d.set(k, str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnv applies the K6_CONNECTRPC_* environment variables, which take
+// precedence over the options set in the script
+func (d *moduleDefaults) applyEnv(lookupEnv func(string) (string, bool)) error {
+	if lookupEnv == nil {
+		return nil
+	}
+
+	envOptions := []struct {
+		env    string
+		option string
+	}{
+		{envDefaultProtocol, "defaultProtocol"},
+		{envDefaultContentType, "defaultContentType"},
+		{envDefaultTimeout, "defaultTimeout"},
+		{envMetricPrefix, "metricPrefix"},
+		{envUserAgent, "userAgent"},
+		{envLatencyHistograms, "latencyHistograms"},
+		{envMetricModel, "metricModel"},
+		{envHistogramBuckets, "histogramBuckets"},
+		{envMaxConnsPerVU, "maxConnectionsPerVU"},
+		{envMaxTotalConns, "maxTotalConnections"},
+		{envConnectionBudget, "connectionBudget"},
+		{envRampDown, "rampDown"},
+	}
+
+	for _, o := range envOptions {
+		v, ok := lookupEnv(o.env)
+		if !ok {
+			continue
+		}
+		if err := d.set(o.option, v); err != nil {
+			return fmt.Errorf("invalid %s: %w", o.env, err)
+		}
+	}
+	return nil
+}
+
+func (d *moduleDefaults) set(option, value string) error {
+	switch option {
+	case "defaultProtocol":
+		if err := validateProtocol(value); err != nil {
+			return err
+		}
+		d.protocol = value
+	case "defaultContentType":
+		if err := validateContentType(value); err != nil {
+			return err
+		}
+		d.contentType = value
+	case "defaultTimeout":
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			return err
+		}
+		d.timeout = timeout
+	case "metricPrefix":
+		d.metricPrefix = value
+	case "userAgent":
+		d.userAgent = &value
+	case "latencyHistograms":
+		if value != "hdr" && value != "off" {
+			return fmt.Errorf("invalid latencyHistograms: %s. Must be 'hdr' or 'off'", value)
+		}
+		d.hdrHistograms = value == "hdr"
+	case "metricModel":
+		if value != "trend" && value != "histogram" {
+			return fmt.Errorf("invalid metricModel: %s. Must be 'trend' or 'histogram'", value)
+		}
+		d.metricModel = value
+	case "histogramBuckets":
+		buckets, err := parseHistogramBuckets(value)
+		if err != nil {
+			return err
+		}
+		d.buckets = buckets
+	case "maxConnectionsPerVU", "maxTotalConnections":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid %s: %s. Must be a positive integer", option, value)
+		}
+		if option == "maxConnectionsPerVU" {
+			d.maxConnsPerVU = n
+		} else {
+			d.maxTotalConns = n
+		}
+	case "connectionBudget":
+		if value != "error" && value != "queue" {
+			return fmt.Errorf("invalid connectionBudget: %s. Must be 'error' or 'queue'", value)
+		}
+		d.queueConnections = value == "queue"
+	case "rampDown":
+		if value != "reject" && value != "continue" {
+			return fmt.Errorf("invalid rampDown: %s. Must be 'reject' or 'continue'", value)
+		}
+		d.rejectRampDown = value == "reject"
+	default:
+		return fmt.Errorf("unknown option %q", option)
+	}
+	return nil
+}
+
+// connectionBudget returns the budget of the connections dialed by the VU, nil when the
+// connections are unlimited
+func (d *moduleDefaults) connectionBudget() *connectionBudget {
+	if d.maxConnsPerVU == 0 && d.maxTotalConns == 0 {
+		return nil
+	}
+	return &connectionBudget{
+		vu:       d.vuConnections,
+		perVU:    d.maxConnsPerVU,
+		maxTotal: d.maxTotalConns,
+		queue:    d.queueConnections,
+	}
+}
+
+// setGlobalOptions sets the defaults used by all clients of the VU
+func (mi *ModuleInstance) setGlobalOptions(v sobek.Value) error {
+	if mi.vu.State() != nil {
+		return errors.New("setGlobalOptions must be called in the init context")
+	}
+	if v == nil || sobek.IsUndefined(v) || sobek.IsNull(v) {
+		return errors.New("options cannot be null or undefined")
+	}
+
+	options, ok := v.Export().(map[string]interface{})
+	if !ok {
+		return errors.New("options must be an object")
+	}
+
+	prefix, buckets := mi.defaults.metricPrefix, mi.defaults.histogramBuckets()
+	if err := mi.defaults.applyOptions(options); err != nil {
+		return fmt.Errorf("invalid global options: %w", err)
+	}
+	if err := mi.defaults.applyEnv(mi.defaults.lookupEnv); err != nil {
+		return err
+	}
+
+	// The histograms are shared by all the VUs, so any VU enables them
+	if mi.defaults.hdrHistograms {
+		mi.metrics.latencies.enabled.Store(true)
+	}
+
+	if mi.defaults.metricPrefix != prefix || !slices.Equal(mi.defaults.histogramBuckets(), buckets) {
+		// Clients and streams share the metrics pointer, so replace its contents
+		m, err := registerMetrics(mi.vu.InitEnv().Registry, mi.defaults.metricPrefix, mi.defaults.histogramBuckets())
+		if err != nil {
+			return fmt.Errorf("failed to register ConnectRPC module metrics: %w", err)
+		}
+		m.latencies = mi.metrics.latencies
+		*mi.metrics = *m
+	}
+
+	return nil
+}
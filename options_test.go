@@ -0,0 +1,100 @@
+package connectrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleDefaultsApplyOptions(t *testing.T) {
+	t.Parallel()
+
+	d := &moduleDefaults{}
+	require.NoError(t, d.applyOptions(map[string]interface{}{
+		"defaultProtocol":    "grpc",
+		"defaultContentType": "application/proto",
+		"defaultTimeout":     "5s",
+		"metricPrefix":       "payments_",
+		"userAgent":          "checkout-load-test/1.0",
+	}))
+
+	assert.Equal(t, "grpc", d.protocol)
+	assert.Equal(t, "application/proto", d.contentType)
+	assert.Equal(t, durationPtr(5*time.Second), d.timeout)
+	assert.Equal(t, "payments_", d.metricPrefix)
+	assert.Equal(t, "checkout-load-test/1.0", *d.userAgent)
+}
+
+func TestModuleDefaultsApplyNumberOptions(t *testing.T) {
+	t.Parallel()
+
+	// JS numbers are exported as int64 when integral, float64 otherwise
+	d := &moduleDefaults{}
+	require.NoError(t, d.applyOptions(map[string]interface{}{
+		"maxConnectionsPerVU": int64(4),
+		"maxTotalConnections": float64(500),
+	}))
+
+	assert.Equal(t, 4, d.maxConnsPerVU)
+	assert.Equal(t, 500, d.maxTotalConns)
+}
+
+func TestModuleDefaultsEnvOverridesOptions(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"K6_CONNECTRPC_DEFAULT_PROTOCOL": "grpc-web",
+		"K6_CONNECTRPC_DEFAULT_TIMEOUT":  "infinite",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	d := &moduleDefaults{}
+	require.NoError(t, d.applyOptions(map[string]interface{}{"defaultProtocol": "grpc", "defaultTimeout": "5s"}))
+	require.NoError(t, d.applyEnv(lookupEnv))
+
+	assert.Equal(t, "grpc-web", d.protocol)
+	assert.Nil(t, d.timeout)
+
+	env["K6_CONNECTRPC_DEFAULT_CONTENT_TYPE"] = "text/plain"
+	err := d.applyEnv(lookupEnv)
+	require.ErrorContains(t, err, "invalid K6_CONNECTRPC_DEFAULT_CONTENT_TYPE: invalid contentType: text/plain")
+}
+
+func TestModuleDefaultsInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name        string
+		Options     map[string]interface{}
+		ErrContains string
+	}{
+		{"UnknownOption", map[string]interface{}{"defaultCodec": "json"}, `unknown option "defaultCodec"`},
+		{"InvalidProtocol", map[string]interface{}{"defaultProtocol": "http"}, "invalid protocol: http"},
+		{"InvalidTimeout", map[string]interface{}{"defaultTimeout": "soon"}, "invalid timeout value"},
+		{"NotAString", map[string]interface{}{"defaultTimeout": []interface{}{"5s"}}, "defaultTimeout must be a string, number or boolean"},
+		{"NumberWithoutUnit", map[string]interface{}{"defaultTimeout": int64(5)}, "invalid timeout value"},
+		{"FractionalConnections", map[string]interface{}{"maxConnectionsPerVU": 2.5}, "invalid maxConnectionsPerVU: 2.5. Must be a positive integer"},
+		{"InvalidLatencyHistograms", map[string]interface{}{"latencyHistograms": "true"}, "invalid latencyHistograms: true. Must be 'hdr' or 'off'"},
+		{"InvalidMetricModel", map[string]interface{}{"metricModel": "summary"}, "invalid metricModel: summary. Must be 'trend' or 'histogram'"},
+		{"InvalidHistogramBuckets", map[string]interface{}{"histogramBuckets": "1s,500ms"}, "invalid histogramBuckets: 1s,500ms. Must be increasing durations"},
+		{"InvalidMaxConnectionsPerVU", map[string]interface{}{"maxConnectionsPerVU": "0"}, "invalid maxConnectionsPerVU: 0. Must be a positive integer"},
+		{"InvalidMaxTotalConnections", map[string]interface{}{"maxTotalConnections": "many"}, "invalid maxTotalConnections: many. Must be a positive integer"},
+		{"InvalidRampDown", map[string]interface{}{"rampDown": "drain"}, "invalid rampDown: drain. Must be 'reject' or 'continue'"},
+		{"InvalidConnectionBudget", map[string]interface{}{"connectionBudget": "wait"}, "invalid connectionBudget: wait. Must be 'error' or 'queue'"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			err := (&moduleDefaults{}).applyOptions(tc.Options)
+			require.ErrorContains(t, err, tc.ErrContains)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package connectrpc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// streamReaper closes the streams of a VU still open when its iteration context is done.
+//
+// An open stream keeps the iteration running, so k6 cancels the iteration context once it's
+// interrupted, at the end of the scenario for instance. The transport stops watching the
+// context once the request is sent though, so without the reaper the stream goroutines and
+// connection outlive the iteration, and k6 waits for them.
+type streamReaper struct {
+	mu      sync.Mutex
+	ctx     context.Context             // The iteration context being watched
+	streams map[*stream]context.Context // Open streams, by the iteration context they were opened in
+}
+
+// add records an open stream, watching the context of the current iteration
+func (r *streamReaper) add(s *stream) {
+	ctx := s.vu.Context()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.streams == nil {
+		r.streams = make(map[*stream]context.Context)
+	}
+	r.streams[s] = ctx
+
+	if r.ctx != ctx {
+		r.ctx = ctx
+		context.AfterFunc(ctx, func() { r.reap(ctx) })
+	}
+}
+
+// remove forgets a stream once it ended
+func (r *streamReaper) remove(s *stream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.streams, s)
+}
+
+// reap closes the streams opened in an iteration that is over, and warns about them
+func (r *streamReaper) reap(ctx context.Context) {
+	r.mu.Lock()
+	var orphans []*stream
+	for s, streamCtx := range r.streams {
+		if streamCtx == ctx {
+			orphans = append(orphans, s)
+			delete(r.streams, s)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(orphans) == 0 {
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, s := range orphans {
+		counts[s.method]++
+		s.close()
+	}
+
+	methods := make([]string, 0, len(counts))
+	for method, count := range counts {
+		methods = append(methods, fmt.Sprintf("%s (%d)", method, count))
+	}
+	sort.Strings(methods)
+
+	if state := orphans[0].vu.State(); state != nil {
+		state.Logger.Warnf("closed %d stream(s) left open at the end of the iteration: %s; "+
+			"call stream.end() or stream.close() once done with a stream", len(orphans), strings.Join(methods, ", "))
+	}
+}
@@ -1,15 +1,21 @@
 package connectrpc
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"connectrpc.com/connect"
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
 	"go.k6.io/k6/lib"
 	"go.k6.io/k6/metrics"
 
 	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpguts"
 )
 
 type connectParams struct {
@@ -21,9 +27,36 @@ type connectParams struct {
 	TLS                map[string]interface{}
 	Protocol           string
 	ContentType        string
-	HTTPVersion        string            // New field for HTTP version control
-	ConnectionStrategy string            // New field for connection reuse strategy
-	Headers            map[string]string // Connection-level headers
+	HTTPVersion        string                 // New field for HTTP version control
+	ConnectionStrategy string                 // New field for connection reuse strategy
+	MaxConnectionAge   time.Duration          // Age after which the per-vu or per-iteration connections are recycled, 0 for none
+	Headers            map[string]string      // Connection-level headers
+	UserAgent          string                 // User-Agent of the calls, empty for the one of connect-go
+	Shadow             map[string]string      // Headers marking the calls as shadow traffic, nil when not shadowing
+	GRPCWebText        bool                   // Whether gRPC-Web calls use the text mode, application/grpc-web-text
+	IdempotencyHeader  string                 // Header of the idempotency keys of the calls
+	RequestIDHeader    string                 // Header of the request IDs generated for the calls, empty for none
+	FlatHeaders        bool                   // Response headers have lowercase names and string values, see headerFormat
+	MaxInFlight        int                    // asyncInvoke() calls sent at once, the others being queued, 0 for no limit
+	AcceptCompression  []string               // Compressions of the responses, most preferred first, nil for gzip
+	Routing            *routing               // Optional routing header of the unary calls
+	Signer             requestSigner          // Optional request signer configured via `auth`
+	Strict             bool                   // Validate responses against the protocol specs
+	FaultInjection     *faultInjector         // Optional client-side latency/abort injection
+	Throttle           *throttleParams        // Optional per-VU bandwidth limits
+	HTTP2Frames        bool                   // Record the stream resets and flow-control stalls of the HTTP/2 frames
+	ResponseCallback   *responseCallback      // Optional expected statuses for all calls
+	Tags               map[string]string      // User tags added to all metrics of the client
+	PoolSize           int                    // Number of shared connections with the 'global' strategy
+	ServerTiming       bool                   // Record the Server-Timing durations as metrics
+	IgnoreUnknown      bool                   // Ignore the request fields unknown to the loaded protos
+	LogLevel           logrus.Level           // Most verbose level of the client logs
+	CaptureWire        *wireCapture           // Optional dump of sampled calls to disk
+	Select             string                 // How a target is selected among several addresses: 'perIteration' or 'perVU'
+	TimeFields         string                 // Conversion of the Timestamp and Duration fields: 'iso' or 'date', empty for none
+	Int64AsNumber      bool                   // The 64-bit integers of the responses are numbers rather than strings, see jsonOptions
+	Transport          string                 // Name of the registered transport of the calls, empty for the built-in ones
+	Handlers           map[string]sobek.Value // JS handlers of the methods answered in memory, for a mock:// address
 }
 
 type callParams struct {
@@ -31,10 +64,28 @@ type callParams struct {
 	DiscardResponseMessage bool
 	Metadata               map[string]string
 	TagsAndMeta            metrics.TagsAndMeta
+	Tags                   map[string]string // User tags added to the call metrics
+	ResponseCallback       *responseCallback // Overrides the connect and module response callback
+	Binary                 bool              // Streams exchange protobuf wire bytes instead of JSON objects
+	AwaitWrites            bool              // Stream writes return a promise resolved once the message is sent
+	ReturnHeaders          map[string]bool   // Canonical names of the headers returned to the script, nil for all
+	Sink                   string            // Streams drain the received messages in Go: 'discard', 'count' or 'sha256'
+	Assert                 *streamAssertions // Streams check the received messages against these assertions
+	IgnoreUnknown          *bool             // Overrides the connect parameter, nil to inherit it
+	IdempotencyKey         string            // Idempotency key of the call, empty for none
+	RequestID              string            // Request ID generated for the call, see setRequestID
+	MaxInFlight            int               // Overrides the connect parameter, 0 to inherit it
+	SLO                    time.Duration     // Latency budget of a unary call, 0 for none
+	AppKeepalive           *appKeepalive     // Heartbeat of a stream while it's idle, nil for none
+	SSE                    bool              // Server streams read their responses as server-sent events
+	Reconnect              *reconnectOptions // Re-establishment of a failed server stream, nil for none
+	RefreshHeaderFn        sobek.Callable    // Returns the headers of a stream, called again every RefreshInterval
+	RefreshInterval        time.Duration     // Interval of RefreshHeaderFn, 0 for the default
 }
 
-// newConnectParams creates connection parameters from a sobek.Value
-func newConnectParams(vu modules.VU, paramsVal sobek.Value) (*connectParams, error) {
+// newConnectParams creates connection parameters from a sobek.Value,
+// starting from the module defaults if any
+func newConnectParams(vu modules.VU, paramsVal sobek.Value, defaults *moduleDefaults) (*connectParams, error) {
 	params := &connectParams{
 		IsPlaintext:        false,
 		UseReflection:      false,
@@ -44,6 +95,21 @@ func newConnectParams(vu modules.VU, paramsVal sobek.Value) (*connectParams, err
 		HTTPVersion:        "2",                     // Default to HTTP/2 for best compatibility
 		ConnectionStrategy: "per-vu",                // Default to persistent connection per VU
 		Headers:            make(map[string]string), // Initialize empty headers map
+		LogLevel:           logrus.ErrorLevel,       // Default to logging the errors only
+		UserAgent:          defaultUserAgent(),
+		IdempotencyHeader:  defaultIdempotencyHeader,
+	}
+
+	if defaults != nil {
+		if defaults.userAgent != nil {
+			params.UserAgent = *defaults.userAgent
+		}
+		if defaults.protocol != "" {
+			params.Protocol = defaults.protocol
+		}
+		if defaults.contentType != "" {
+			params.ContentType = defaults.contentType
+		}
 	}
 
 	if paramsVal == nil || sobek.IsUndefined(paramsVal) || sobek.IsNull(paramsVal) {
@@ -59,21 +125,18 @@ func newConnectParams(vu modules.VU, paramsVal sobek.Value) (*connectParams, err
 			params.IsPlaintext = paramsObj.Get(k).ToBoolean()
 		case "reflect":
 			params.UseReflection = paramsObj.Get(k).ToBoolean()
+		case "strict":
+			params.Strict = paramsObj.Get(k).ToBoolean()
 		case "timeout":
 			timeoutVal := paramsObj.Get(k)
 			if sobek.IsNull(timeoutVal) || sobek.IsUndefined(timeoutVal) {
 				params.Timeout = nil // Infinite timeout
 			} else {
-				timeoutStr := timeoutVal.String()
-				if timeoutStr == "" || timeoutStr == "0" || timeoutStr == "infinite" {
-					params.Timeout = nil // Infinite timeout
-				} else {
-					timeout, err := time.ParseDuration(timeoutStr)
-					if err != nil {
-						return nil, fmt.Errorf("invalid timeout value: %w", err)
-					}
-					params.Timeout = &timeout
+				timeout, err := parseTimeout(timeoutVal.String())
+				if err != nil {
+					return nil, err
 				}
+				params.Timeout = timeout
 			}
 		case "maxReceiveSize":
 			params.MaxReceiveSize = paramsObj.Get(k).ToInteger()
@@ -83,16 +146,14 @@ func newConnectParams(vu modules.VU, paramsVal sobek.Value) (*connectParams, err
 			params.TLS = paramsObj.Get(k).Export().(map[string]interface{})
 		case "protocol":
 			protocol := paramsObj.Get(k).String()
-			// Validate protocol values
-			if protocol != "connect" && protocol != "grpc" && protocol != "grpc-web" {
-				return nil, fmt.Errorf("invalid protocol: %s. Must be 'connect', 'grpc', or 'grpc-web'", protocol)
+			if err := validateProtocol(protocol); err != nil {
+				return nil, err
 			}
 			params.Protocol = protocol
 		case "contentType":
 			contentType := paramsObj.Get(k).String()
-			// Validate contentType values
-			if contentType != "application/json" && contentType != "application/proto" && contentType != "application/protobuf" {
-				return nil, fmt.Errorf("invalid contentType: %s. Must be 'application/json', 'application/proto', or 'application/protobuf'", contentType)
+			if err := validateContentType(contentType); err != nil {
+				return nil, err
 			}
 			params.ContentType = contentType
 		case "httpVersion":
@@ -103,10 +164,16 @@ func newConnectParams(vu modules.VU, paramsVal sobek.Value) (*connectParams, err
 			params.HTTPVersion = httpVersion
 		case "connectionStrategy":
 			strategy := paramsObj.Get(k).String()
-			if strategy != "per-vu" && strategy != "per-iteration" && strategy != "per-call" {
-				return nil, fmt.Errorf("invalid connectionStrategy: %s. Must be 'per-vu', 'per-iteration', or 'per-call'", strategy)
+			if strategy != "per-vu" && strategy != "per-iteration" && strategy != "per-call" && strategy != "per-stream" && strategy != "global" {
+				return nil, fmt.Errorf("invalid connectionStrategy: %s. Must be 'per-vu', 'per-iteration', 'per-call', 'per-stream', or 'global'", strategy)
 			}
 			params.ConnectionStrategy = strategy
+		case "maxConnectionAge":
+			age, err := parseMaxConnectionAge(paramsObj.Get(k).String())
+			if err != nil {
+				return nil, err
+			}
+			params.MaxConnectionAge = age
 		case "headers":
 			headers := paramsObj.Get(k)
 			if !sobek.IsUndefined(headers) && !sobek.IsNull(headers) {
@@ -115,14 +182,259 @@ func newConnectParams(vu modules.VU, paramsVal sobek.Value) (*connectParams, err
 					return nil, fmt.Errorf("invalid headers object: %w", err)
 				}
 			}
+		case "userAgent":
+			userAgent := paramsObj.Get(k)
+			if common.IsNullish(userAgent) {
+				continue
+			}
+			if _, ok := userAgent.Export().(string); !ok {
+				return nil, fmt.Errorf("invalid userAgent: must be a string, got %s", userAgent.ExportType())
+			}
+			params.UserAgent = userAgent.String()
+		case "auth":
+			authVal := paramsObj.Get(k)
+			if sobek.IsUndefined(authVal) || sobek.IsNull(authVal) {
+				continue
+			}
+			auth, ok := authVal.Export().(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid auth object: must be an object")
+			}
+			var lookupEnv func(string) (string, bool)
+			if defaults != nil {
+				lookupEnv = defaults.lookupEnv
+			}
+			signer, err := newRequestSigner(auth, lookupEnv)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth object: %w", err)
+			}
+			params.Signer = signer
+		case "faultInjection":
+			fiVal := paramsObj.Get(k)
+			if sobek.IsUndefined(fiVal) || sobek.IsNull(fiVal) {
+				continue
+			}
+			fi, ok := fiVal.Export().(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid faultInjection object: must be an object")
+			}
+			injector, err := newFaultInjector(fi)
+			if err != nil {
+				return nil, fmt.Errorf("invalid faultInjection object: %w", err)
+			}
+			params.FaultInjection = injector
+		case "throttle":
+			throttleVal := paramsObj.Get(k)
+			if sobek.IsUndefined(throttleVal) || sobek.IsNull(throttleVal) {
+				continue
+			}
+			throttle, ok := throttleVal.Export().(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid throttle object: must be an object")
+			}
+			limits, err := newThrottleParams(throttle)
+			if err != nil {
+				return nil, fmt.Errorf("invalid throttle object: %w", err)
+			}
+			params.Throttle = limits
+		case "http2Frames":
+			params.HTTP2Frames = paramsObj.Get(k).ToBoolean()
+		case "responseCallback":
+			cb, err := parseResponseCallback(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid responseCallback: %w", err)
+			}
+			params.ResponseCallback = cb
+		case "tags":
+			tagsVal := paramsObj.Get(k)
+			if sobek.IsUndefined(tagsVal) || sobek.IsNull(tagsVal) {
+				continue
+			}
+			tags, err := exportTags(tagsVal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tags object: %w", err)
+			}
+			params.Tags = tags
+		case "poolSize":
+			poolSize := paramsObj.Get(k).ToInteger()
+			if poolSize < 1 {
+				return nil, fmt.Errorf("invalid poolSize: %d. Must be at least 1", poolSize)
+			}
+			params.PoolSize = int(poolSize)
+		case "serverTimingMetrics":
+			params.ServerTiming = paramsObj.Get(k).ToBoolean()
+		case "ignoreUnknownFields":
+			params.IgnoreUnknown = paramsObj.Get(k).ToBoolean()
+		case "logLevel":
+			level, err := parseLogLevel(paramsObj.Get(k).String())
+			if err != nil {
+				return nil, err
+			}
+			params.LogLevel = level
+		case "routing":
+			routingVal := paramsObj.Get(k)
+			if common.IsNullish(routingVal) {
+				continue
+			}
+			r, err := newRouting(routingVal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid routing object: %w", err)
+			}
+			params.Routing = r
+		case "idempotencyHeader":
+			header := paramsObj.Get(k)
+			if common.IsNullish(header) {
+				continue
+			}
+			if name, ok := header.Export().(string); !ok || name == "" {
+				return nil, fmt.Errorf("invalid idempotencyHeader: must be a non-empty string")
+			}
+			params.IdempotencyHeader = header.String()
+		case "headerFormat":
+			flat, err := parseHeaderFormat(paramsObj.Get(k).String())
+			if err != nil {
+				return nil, err
+			}
+			params.FlatHeaders = flat
+		case "requestId":
+			header, err := parseRequestID(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid requestId: %w", err)
+			}
+			params.RequestIDHeader = header
+		case "maxInFlight":
+			limit, err := parseMaxInFlight(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxInFlight: %w", err)
+			}
+			params.MaxInFlight = limit
+		case "acceptCompression":
+			accepted, err := parseAcceptCompression(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid acceptCompression: %w", err)
+			}
+			params.AcceptCompression = accepted
+		case "grpcWeb":
+			grpcWebVal := paramsObj.Get(k)
+			if sobek.IsUndefined(grpcWebVal) || sobek.IsNull(grpcWebVal) {
+				continue
+			}
+			grpcWeb, ok := grpcWebVal.Export().(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid grpcWeb object: must be an object")
+			}
+			textMode, err := parseGRPCWeb(grpcWeb)
+			if err != nil {
+				return nil, fmt.Errorf("invalid grpcWeb object: %w", err)
+			}
+			params.GRPCWebText = textMode
+		case "shadow":
+			shadow, err := parseShadow(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid shadow: %w", err)
+			}
+			params.Shadow = shadow
+		case "select":
+			selection := paramsObj.Get(k).String()
+			if selection != "perIteration" && selection != "perVU" {
+				return nil, fmt.Errorf("invalid select: %s. Must be 'perIteration' or 'perVU'", selection)
+			}
+			params.Select = selection
+		case "handlers":
+			handlersVal := paramsObj.Get(k)
+			if common.IsNullish(handlersVal) {
+				continue
+			}
+			handlers, err := parseHandlers(handlersVal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid handlers: %w", err)
+			}
+			params.Handlers = handlers
+		case "transport":
+			transportVal := paramsObj.Get(k)
+			if common.IsNullish(transportVal) {
+				continue
+			}
+			params.Transport = transportVal.String()
+		case "timeFields":
+			timeFieldsVal := paramsObj.Get(k)
+			if common.IsNullish(timeFieldsVal) {
+				continue
+			}
+			mode := timeFieldsVal.String()
+			if mode != timeFieldsISO && mode != timeFieldsDate {
+				return nil, fmt.Errorf("invalid timeFields: %s. Must be 'iso' or 'date'", mode)
+			}
+			params.TimeFields = mode
+		case "jsonOptions":
+			jsonOptionsVal := paramsObj.Get(k)
+			if common.IsNullish(jsonOptionsVal) {
+				continue
+			}
+			if err := parseJSONOptions(jsonOptionsVal.Export(), params); err != nil {
+				return nil, fmt.Errorf("invalid jsonOptions: %w", err)
+			}
+		case "captureWire":
+			captureVal := paramsObj.Get(k)
+			if sobek.IsUndefined(captureVal) || sobek.IsNull(captureVal) {
+				continue
+			}
+			capture, ok := captureVal.Export().(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid captureWire object: must be an object")
+			}
+			wireCapture, err := newWireCapture(capture)
+			if err != nil {
+				return nil, fmt.Errorf("invalid captureWire object: %w", err)
+			}
+			params.CaptureWire = wireCapture
+		}
+	}
+
+	if params.MaxConnectionAge > 0 {
+		if err := validateMaxConnectionAge(params); err != nil {
+			return nil, err
+		}
+	}
+	if params.HTTP2Frames {
+		if err := validateHTTP2Frames(params); err != nil {
+			return nil, err
+		}
+	}
+	if params.Transport != "" {
+		if err := validateTransport(params); err != nil {
+			return nil, err
+		}
+	}
+	if params.PoolSize > 0 && params.ConnectionStrategy != "global" {
+		return nil, errors.New("poolSize requires the 'global' connectionStrategy")
+	}
+	if params.GRPCWebText {
+		if params.Protocol != "grpc-web" {
+			return nil, errors.New("grpcWeb textMode requires the 'grpc-web' protocol")
+		}
+		switch params.Signer.(type) {
+		case *sigV4Signer, *hmacSigner:
+			return nil, errors.New("grpcWeb textMode is not supported with sigv4 or hmac auth: they would sign the body before its base64 encoding")
 		}
 	}
+	params.tagShadow()
 
 	return params, nil
 }
 
-// newCallParams creates call parameters from a sobek.Value
-func newCallParams(vu modules.VU, paramsVal sobek.Value) (*callParams, error) {
+// interceptors returns the connect interceptors configured by the connection parameters
+func (p *connectParams) interceptors() []connect.Interceptor {
+	var interceptors []connect.Interceptor
+	if p.FaultInjection != nil {
+		interceptors = append(interceptors, p.FaultInjection)
+	}
+	return interceptors
+}
+
+// newCallParams creates call parameters from a sobek.Value,
+// starting from the module defaults if any
+func newCallParams(vu modules.VU, paramsVal sobek.Value, defaults *moduleDefaults) (*callParams, error) {
 	state := vu.State()
 	if state == nil {
 		return nil, common.NewInitContextError("getting call parameters in the init context is not supported")
@@ -134,12 +446,17 @@ func newCallParams(vu modules.VU, paramsVal sobek.Value) (*callParams, error) {
 		TagsAndMeta: state.Tags.GetCurrentValues(),
 	}
 
+	if defaults != nil {
+		params.Timeout = defaults.timeout
+	}
+
 	if paramsVal == nil || sobek.IsUndefined(paramsVal) || sobek.IsNull(paramsVal) {
 		return params, nil
 	}
 
 	rt := vu.Runtime()
 	paramsObj := paramsVal.ToObject(rt)
+	returnHeadersSet := false
 
 	for _, k := range paramsObj.Keys() {
 		switch k {
@@ -156,30 +473,203 @@ func newCallParams(vu modules.VU, paramsVal sobek.Value) (*callParams, error) {
 			if sobek.IsNull(timeoutVal) || sobek.IsUndefined(timeoutVal) {
 				params.Timeout = nil // Infinite timeout
 			} else {
-				timeoutStr := timeoutVal.String()
-				if timeoutStr == "" || timeoutStr == "0" || timeoutStr == "infinite" {
-					params.Timeout = nil // Infinite timeout
-				} else {
-					timeout, err := time.ParseDuration(timeoutStr)
-					if err != nil {
-						return nil, fmt.Errorf("invalid timeout value: %w", err)
-					}
-					params.Timeout = &timeout
+				timeout, err := parseTimeout(timeoutVal.String())
+				if err != nil {
+					return nil, err
 				}
+				params.Timeout = timeout
 			}
 		case "discardResponse":
 			params.DiscardResponseMessage = paramsObj.Get(k).ToBoolean()
+		case "returnHeaders":
+			returnHeaders, err := parseReturnHeaders(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid returnHeaders: %w", err)
+			}
+			params.ReturnHeaders = returnHeaders
+			returnHeadersSet = true
+		case "binary":
+			params.Binary = paramsObj.Get(k).ToBoolean()
+		case "awaitWrites":
+			params.AwaitWrites = paramsObj.Get(k).ToBoolean()
+		case "sse":
+			params.SSE = paramsObj.Get(k).ToBoolean()
+		case "ignoreUnknownFields":
+			ignoreUnknown := paramsObj.Get(k).ToBoolean()
+			params.IgnoreUnknown = &ignoreUnknown
+		case "sink":
+			sinkVal := paramsObj.Get(k)
+			if common.IsNullish(sinkVal) {
+				continue
+			}
+			sink := sinkVal.String()
+			if sink != "discard" && sink != "count" && sink != "sha256" {
+				return nil, fmt.Errorf("invalid sink: %s. Must be 'discard', 'count', or 'sha256'", sink)
+			}
+			params.Sink = sink
+		case "assert":
+			assertions, err := parseStreamAssertions(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid assert: %w", err)
+			}
+			params.Assert = assertions
 		case "tags":
 			if err := common.ApplyCustomUserTags(rt, &params.TagsAndMeta, paramsObj.Get(k)); err != nil {
 				return nil, fmt.Errorf("invalid tags object: %w", err)
 			}
+			tags, err := exportTags(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid tags object: %w", err)
+			}
+			params.Tags = tags
+		case "responseCallback":
+			cb, err := parseResponseCallback(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid responseCallback: %w", err)
+			}
+			params.ResponseCallback = cb
+		case "idempotencyKey":
+			key, err := parseIdempotencyKey(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid idempotencyKey: %w", err)
+			}
+			params.IdempotencyKey = key
+		case "maxInFlight":
+			limit, err := parseMaxInFlight(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxInFlight: %w", err)
+			}
+			params.MaxInFlight = limit
+		case "slo":
+			slo, err := parseSLO(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid slo: %w", err)
+			}
+			params.SLO = slo
+		case "appKeepalive":
+			keepalive, err := parseAppKeepalive(rt, paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid appKeepalive: %w", err)
+			}
+			params.AppKeepalive = keepalive
+		case "reconnect":
+			reconnect, err := parseReconnect(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid reconnect: %w", err)
+			}
+			params.Reconnect = reconnect
+		case "refreshHeaderFn":
+			fn, ok := sobek.AssertFunction(paramsObj.Get(k))
+			if !ok {
+				return nil, errors.New("invalid refreshHeaderFn: must be a function returning headers")
+			}
+			params.RefreshHeaderFn = fn
+		case "refreshInterval":
+			interval, err := parseRefreshInterval(paramsObj.Get(k))
+			if err != nil {
+				return nil, fmt.Errorf("invalid refreshInterval: %w", err)
+			}
+			params.RefreshInterval = interval
 		}
 	}
 
+	// Headers are not returned either when the response is discarded, unless asked for
+	if params.DiscardResponseMessage && !returnHeadersSet {
+		params.ReturnHeaders = map[string]bool{}
+	}
+
 	return params, nil
 }
 
-// processMetadata processes metadata/headers from JavaScript object
+// parseReturnHeaders parses the `returnHeaders` call parameter: true or nullish returns
+// all the headers, false none, and an array of names only these headers
+func parseReturnHeaders(v sobek.Value) (map[string]bool, error) {
+	if common.IsNullish(v) {
+		return nil, nil
+	}
+
+	if b, ok := v.Export().(bool); ok {
+		if b {
+			return nil, nil
+		}
+		return map[string]bool{}, nil
+	}
+
+	obj, ok := v.(*sobek.Object)
+	if !ok || obj.ClassName() != "Array" {
+		return nil, errors.New("must be a boolean or an array of header names")
+	}
+
+	length := int(obj.Get("length").ToInteger())
+	returnHeaders := make(map[string]bool, length)
+	for i := 0; i < length; i++ {
+		name, ok := obj.Get(fmt.Sprintf("%d", i)).Export().(string)
+		if !ok {
+			return nil, fmt.Errorf("header name %d must be a string", i)
+		}
+		returnHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+	return returnHeaders, nil
+}
+
+// filterHeaders returns the headers to return to the script, following the `returnHeaders`
+// parameter. They are returned as a plain map, which sobek exposes with its keys rather
+// than the methods of http.Header.
+func (p *callParams) filterHeaders(headers http.Header) map[string][]string {
+	if p == nil || p.ReturnHeaders == nil {
+		return headers
+	}
+
+	filtered := make(map[string][]string, len(p.ReturnHeaders))
+	for name := range p.ReturnHeaders {
+		if values, ok := headers[name]; ok {
+			filtered[name] = values
+		}
+	}
+	return filtered
+}
+
+// parseTimeout parses a timeout string where "", "0" and "infinite" mean no timeout
+func parseTimeout(timeoutStr string) (*time.Duration, error) {
+	if timeoutStr == "" || timeoutStr == "0" || timeoutStr == "infinite" {
+		return nil, nil // Infinite timeout
+	}
+
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout value: %w", err)
+	}
+	return &timeout, nil
+}
+
+// validateProtocol checks that the protocol is supported
+func validateProtocol(protocol string) error {
+	if protocol != "connect" && protocol != "grpc" && protocol != "grpc-web" {
+		return fmt.Errorf("invalid protocol: %s. Must be 'connect', 'grpc', or 'grpc-web'", protocol)
+	}
+	return nil
+}
+
+// validateContentType checks that the content type is supported, by connect-go or a
+// registered codec
+func validateContentType(contentType string) error {
+	if contentType == "application/json" || contentType == "application/proto" || contentType == "application/protobuf" {
+		return nil
+	}
+	if registeredCodec(contentType) != nil {
+		return nil
+	}
+
+	if registered := registeredContentTypes(); len(registered) > 0 {
+		return fmt.Errorf("invalid contentType: %s. Must be 'application/json', 'application/proto', 'application/protobuf', "+
+			"or the one of a registered codec: '%s'", contentType, strings.Join(registered, "', '"))
+	}
+	return fmt.Errorf("invalid contentType: %s. Must be 'application/json', 'application/proto', or 'application/protobuf'", contentType)
+}
+
+// processMetadata processes metadata/headers from JavaScript object. The values of the
+// binary headers, whose names end with -bin as in gRPC, are base64-encoded ArrayBuffers or
+// typed arrays, or strings already encoded.
 func processMetadata(metadata sobek.Value, dest map[string]string, rt *sobek.Runtime) error {
 	v := metadata.Export()
 
@@ -188,10 +678,20 @@ func processMetadata(metadata sobek.Value, dest map[string]string, rt *sobek.Run
 		return fmt.Errorf("must be an object with key-value pairs")
 	}
 
+	canonical := make(map[string]string, len(rawHeaders))
 	for hk, kv := range rawHeaders {
-		var val string
-		if val, ok = kv.(string); !ok {
-			return fmt.Errorf("%q value must be a string", hk)
+		if !httpguts.ValidHeaderFieldName(hk) {
+			return fmt.Errorf("%q is not a valid header name", hk)
+		}
+		key := http.CanonicalHeaderKey(hk)
+		if other, ok := canonical[key]; ok {
+			return fmt.Errorf("%q and %q are the same header", other, hk)
+		}
+		canonical[key] = hk
+
+		val, err := metadataValue(hk, kv)
+		if err != nil {
+			return err
 		}
 		dest[hk] = val
 	}
@@ -199,6 +699,56 @@ func processMetadata(metadata sobek.Value, dest map[string]string, rt *sobek.Run
 	return nil
 }
 
+// metadataValue returns the value of a header, base64-encoding the binary ones
+func metadataValue(name string, value interface{}) (string, error) {
+	if !strings.HasSuffix(strings.ToLower(name), "-bin") {
+		val, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("%q value must be a string", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(val) {
+			return "", fmt.Errorf("%q value is not a valid header value, binary values need a -bin header", name)
+		}
+		return val, nil
+	}
+
+	if val, ok := value.(string); ok {
+		if _, err := connect.DecodeBinaryHeader(val); err != nil {
+			return "", fmt.Errorf("%q value must be base64-encoded: %w", name, err)
+		}
+		return val, nil
+	}
+	b, err := common.ToBytes(value)
+	if err != nil {
+		return "", fmt.Errorf("%q value must be an ArrayBuffer, a typed array or a base64 string", name)
+	}
+	return connect.EncodeBinaryHeader(b), nil
+}
+
+// exportTags converts a JS tags object to a map, stringifying number and boolean values
+func exportTags(tagsVal sobek.Value) (map[string]string, error) {
+	if sobek.IsUndefined(tagsVal) || sobek.IsNull(tagsVal) {
+		return nil, nil
+	}
+
+	rawTags, ok := tagsVal.Export().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an object with key-value pairs")
+	}
+
+	tags := make(map[string]string, len(rawTags))
+	for k, v := range rawTags {
+		switch v.(type) {
+		case string, int64, float64, bool:
+			tags[k] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("%q value must be a string, number or boolean", k)
+		}
+	}
+
+	return tags, nil
+}
+
 // SetSystemTags sets system tags for metrics
 func (p *callParams) SetSystemTags(state *lib.State, addr, method string) {
 	if state.Options.SystemTags.Has(metrics.TagURL) {
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"connectrpc.com/connect"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.k6.io/k6/js/modulestest"
@@ -123,7 +125,7 @@ func TestConnectParamsValidInput(t *testing.T) {
 			val, err := testRuntime.VU.Runtime().RunString("(" + tc.JSON + ")")
 			require.NoError(t, err)
 
-			params, err := newConnectParams(testRuntime.VU, val)
+			params, err := newConnectParams(testRuntime.VU, val, nil)
 			require.NoError(t, err)
 
 			assert.Equal(t, tc.Expected.IsPlaintext, params.IsPlaintext)
@@ -137,6 +139,143 @@ func TestConnectParamsValidInput(t *testing.T) {
 	}
 }
 
+func TestConnectParamsAuth(t *testing.T) {
+	t.Parallel()
+
+	testRuntime := modulestest.NewRuntime(t)
+
+	val, err := testRuntime.VU.Runtime().RunString(`({
+		auth: { type: "sigv4", region: "us-east-1", service: "execute-api", accessKeyId: "AKID", secretAccessKey: "secret" }
+	})`)
+	require.NoError(t, err)
+
+	params, err := newConnectParams(testRuntime.VU, val, nil)
+	require.NoError(t, err)
+	require.IsType(t, &sigV4Signer{}, params.Signer)
+
+	val, err = testRuntime.VU.Runtime().RunString(`({ auth: { type: "hmac", secret: "key" } })`)
+	require.NoError(t, err)
+
+	params, err = newConnectParams(testRuntime.VU, val, nil)
+	require.NoError(t, err)
+	require.IsType(t, &hmacSigner{}, params.Signer)
+}
+
+func TestConnectParamsFaultInjection(t *testing.T) {
+	t.Parallel()
+
+	testRuntime := modulestest.NewRuntime(t)
+
+	val, err := testRuntime.VU.Runtime().RunString(`({
+		faultInjection: {
+			delay: { percent: 10, duration: "200ms" },
+			abort: { percent: 0.5, code: "resource_exhausted" }
+		}
+	})`)
+	require.NoError(t, err)
+
+	params, err := newConnectParams(testRuntime.VU, val, nil)
+	require.NoError(t, err)
+	require.NotNil(t, params.FaultInjection)
+
+	assert.Equal(t, 10.0, params.FaultInjection.delayPercent)
+	assert.Equal(t, 200*time.Millisecond, params.FaultInjection.delay)
+	assert.Equal(t, 0.5, params.FaultInjection.abortPercent)
+	assert.Equal(t, connect.CodeResourceExhausted, params.FaultInjection.abortCode)
+	assert.Len(t, params.interceptors(), 1)
+}
+
+func TestConnectParamsThrottle(t *testing.T) {
+	t.Parallel()
+
+	testRuntime := modulestest.NewRuntime(t)
+
+	val, err := testRuntime.VU.Runtime().RunString(`({ throttle: { uploadKbps: 512, downloadKbps: 2048 } })`)
+	require.NoError(t, err)
+
+	params, err := newConnectParams(testRuntime.VU, val, nil)
+	require.NoError(t, err)
+	require.NotNil(t, params.Throttle)
+
+	assert.Equal(t, 64000.0, params.Throttle.upload.rate)
+	assert.Equal(t, 256000.0, params.Throttle.download.rate)
+}
+
+func TestConnectParamsResponseCallbackAndTags(t *testing.T) {
+	t.Parallel()
+
+	testRuntime := modulestest.NewRuntime(t)
+
+	cb, err := newResponseCallback("ok", "not_found")
+	require.NoError(t, err)
+	require.NoError(t, testRuntime.VU.Runtime().Set("cb", cb))
+
+	val, err := testRuntime.VU.Runtime().RunString(`({ responseCallback: cb, tags: { team: "payments", shard: 2 } })`)
+	require.NoError(t, err)
+
+	params, err := newConnectParams(testRuntime.VU, val, nil)
+	require.NoError(t, err)
+
+	assert.Same(t, cb, params.ResponseCallback)
+	assert.Equal(t, map[string]string{"team": "payments", "shard": "2"}, params.Tags)
+}
+
+func TestConnectParamsLogLevel(t *testing.T) {
+	t.Parallel()
+
+	testRuntime := modulestest.NewRuntime(t)
+
+	params, err := newConnectParams(testRuntime.VU, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, logrus.ErrorLevel, params.LogLevel)
+
+	for level, expected := range map[string]logrus.Level{"debug": logrus.DebugLevel, "off": logLevelOff} {
+		val, err := testRuntime.VU.Runtime().RunString(`({ logLevel: "` + level + `" })`)
+		require.NoError(t, err)
+
+		params, err := newConnectParams(testRuntime.VU, val, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, params.LogLevel)
+	}
+}
+
+func TestConnectParamsShadow(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name    string
+		JSON    string
+		Headers map[string]string
+		Tags    map[string]string
+	}{
+		{"Off", `{ shadow: false, tags: { team: "payments" } }`, nil, map[string]string{"team": "payments"}},
+		{"Default", `{ shadow: true }`, map[string]string{"x-shadow-request": "true"}, map[string]string{"shadow": "true"}},
+		{
+			"NamedHeaders",
+			`{ shadow: { headers: { "x-dark-traffic": "1" } }, tags: { shadow: "mirror" } }`,
+			map[string]string{"x-dark-traffic": "1"},
+			map[string]string{"shadow": "mirror"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			testRuntime := modulestest.NewRuntime(t)
+
+			val, err := testRuntime.VU.Runtime().RunString("(" + tc.JSON + ")")
+			require.NoError(t, err)
+
+			params, err := newConnectParams(testRuntime.VU, val, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Headers, params.Shadow)
+			assert.Equal(t, tc.Tags, params.Tags)
+		})
+	}
+}
+
 func TestConnectParamsInvalidInput(t *testing.T) {
 	t.Parallel()
 
@@ -155,6 +294,126 @@ func TestConnectParamsInvalidInput(t *testing.T) {
 			JSON:        `{ httpVersion: "invalid" }`,
 			ErrContains: "invalid httpVersion: invalid",
 		},
+		{
+			Name:        "GRPCWebTextModeWithoutGRPCWeb",
+			JSON:        `{ grpcWeb: { textMode: true } }`,
+			ErrContains: "grpcWeb textMode requires the 'grpc-web' protocol",
+		},
+		{
+			Name:        "GRPCWebTextModeWithHMAC",
+			JSON:        `{ protocol: "grpc-web", grpcWeb: { textMode: true }, auth: { type: "hmac", secret: "s" } }`,
+			ErrContains: "grpcWeb textMode is not supported with sigv4 or hmac auth",
+		},
+		{
+			Name:        "InvalidGRPCWebOption",
+			JSON:        `{ protocol: "grpc-web", grpcWeb: { base64: true } }`,
+			ErrContains: `invalid grpcWeb object: unknown option "base64"`,
+		},
+		{
+			Name:        "InvalidMaxConnectionAge",
+			JSON:        `{ maxConnectionAge: "-5m" }`,
+			ErrContains: `invalid maxConnectionAge: "-5m". Must be a positive duration, like '5m'`,
+		},
+		{
+			Name:        "MaxConnectionAgeWithPerCall",
+			JSON:        `{ connectionStrategy: "per-call", maxConnectionAge: "5m" }`,
+			ErrContains: "maxConnectionAge requires the 'per-vu' or 'per-iteration' connectionStrategy",
+		},
+		{
+			Name:        "HTTP2FramesWithHTTP1",
+			JSON:        `{ httpVersion: "1.1", http2Frames: true }`,
+			ErrContains: "http2Frames requires httpVersion '2'",
+		},
+		{
+			Name:        "InvalidIdempotencyHeader",
+			JSON:        `{ idempotencyHeader: "" }`,
+			ErrContains: "invalid idempotencyHeader: must be a non-empty string",
+		},
+		{
+			Name:        "InvalidShadow",
+			JSON:        `{ shadow: "yes" }`,
+			ErrContains: "invalid shadow: must be a boolean or an object, got string",
+		},
+		{
+			Name:        "InvalidShadowHeader",
+			JSON:        `{ shadow: { headers: { "x-dark-traffic": 1 } } }`,
+			ErrContains: `invalid shadow: header "x-dark-traffic" must be a string, got int64`,
+		},
+		{
+			Name:        "InvalidUserAgent",
+			JSON:        `{ userAgent: 42 }`,
+			ErrContains: "invalid userAgent: must be a string, got int64",
+		},
+		{
+			Name:        "InvalidAuthType",
+			JSON:        `{ auth: { type: "kerberos" } }`,
+			ErrContains: "invalid auth object: invalid auth type: kerberos",
+		},
+		{
+			Name:        "InvalidFaultInjectionPercent",
+			JSON:        `{ faultInjection: { abort: { percent: 150 } } }`,
+			ErrContains: "invalid abort percent: must be between 0 and 100",
+		},
+		{
+			Name:        "InvalidFaultInjectionCode",
+			JSON:        `{ faultInjection: { abort: { percent: 1, code: "exploded" } } }`,
+			ErrContains: "invalid abort code",
+		},
+		{
+			Name:        "InvalidFaultInjectionDelay",
+			JSON:        `{ faultInjection: { delay: { percent: 10, duration: "soon" } } }`,
+			ErrContains: "invalid delay duration",
+		},
+		{
+			Name:        "InvalidResponseCallback",
+			JSON:        `{ responseCallback: 404 }`,
+			ErrContains: "invalid responseCallback: must be created with connectrpc.expectedStatuses()",
+		},
+		{
+			Name:        "InvalidTags",
+			JSON:        `{ tags: { team: { name: "payments" } } }`,
+			ErrContains: `invalid tags object: "team" value must be a string, number or boolean`,
+		},
+		{
+			Name:        "InvalidThrottle",
+			JSON:        `{ throttle: { uploadKbps: -1 } }`,
+			ErrContains: "invalid throttle object: invalid uploadKbps: must not be negative",
+		},
+		{
+			Name:        "IncompleteSigV4Auth",
+			JSON:        `{ auth: { type: "sigv4", service: "execute-api" } }`,
+			ErrContains: "sigv4 auth requires a region",
+		},
+		{
+			Name:        "InvalidLogLevel",
+			JSON:        `{ logLevel: "verbose" }`,
+			ErrContains: "invalid logLevel: verbose",
+		},
+		{
+			Name:        "CaptureWireWithoutSampleRate",
+			JSON:        `{ captureWire: { dir: "captures/" } }`,
+			ErrContains: "invalid captureWire object: sampleRate is required",
+		},
+		{
+			Name:        "CaptureWireSampleRateOutOfRange",
+			JSON:        `{ captureWire: { sampleRate: 5 } }`,
+			ErrContains: "invalid captureWire object: sampleRate must be between 0 and 1, got 5",
+		},
+		{
+			Name:        "InvalidTimeFields",
+			JSON:        `{ timeFields: "unix" }`,
+			ErrContains: "invalid timeFields: unix. Must be 'iso' or 'date'",
+		},
+		{
+			Name:        "InvalidJSONOptions",
+			JSON:        `{ jsonOptions: { int64AsNumber: "yes" } }`,
+			ErrContains: "invalid jsonOptions: int64AsNumber must be a boolean",
+		},
+		{
+			Name:        "UnknownJSONOption",
+			JSON:        `{ jsonOptions: { enumAsNumber: true } }`,
+			ErrContains: `invalid jsonOptions: unknown option "enumAsNumber", must be int64AsNumber`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -167,7 +426,7 @@ func TestConnectParamsInvalidInput(t *testing.T) {
 			val, err := testRuntime.VU.Runtime().RunString("(" + tc.JSON + ")")
 			require.NoError(t, err)
 
-			_, err = newConnectParams(testRuntime.VU, val)
+			_, err = newConnectParams(testRuntime.VU, val, nil)
 			require.Error(t, err)
 			assert.Contains(t, err.Error(), tc.ErrContains)
 		})
@@ -219,6 +478,17 @@ func TestCallParamsValidInput(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "WithBinaryMetadata",
+			JSON: `{ metadata: { "ticket-bin": new Uint8Array([1, 2, 250]).buffer, "route-bin": "AQL6" } }`,
+			Expected: callParams{
+				Timeout: nil,
+				Metadata: map[string]string{
+					"ticket-bin": "AQL6",
+					"route-bin":  "AQL6",
+				},
+			},
+		},
 		{
 			Name: "WithDiscardResponse",
 			JSON: `{ discardResponse: true }`,
@@ -226,6 +496,34 @@ func TestCallParamsValidInput(t *testing.T) {
 				Timeout:                nil,
 				Metadata:               map[string]string{},
 				DiscardResponseMessage: true,
+				ReturnHeaders:          map[string]bool{},
+			},
+		},
+		{
+			Name: "WithDiscardResponseAndReturnHeaders",
+			JSON: `{ discardResponse: true, returnHeaders: ["x-ratelimit-remaining"] }`,
+			Expected: callParams{
+				Timeout:                nil,
+				Metadata:               map[string]string{},
+				DiscardResponseMessage: true,
+				ReturnHeaders:          map[string]bool{"X-Ratelimit-Remaining": true},
+			},
+		},
+		{
+			Name: "WithoutReturnHeaders",
+			JSON: `{ returnHeaders: false }`,
+			Expected: callParams{
+				Timeout:       nil,
+				Metadata:      map[string]string{},
+				ReturnHeaders: map[string]bool{},
+			},
+		},
+		{
+			Name: "WithAllReturnHeaders",
+			JSON: `{ returnHeaders: true }`,
+			Expected: callParams{
+				Timeout:  nil,
+				Metadata: map[string]string{},
 			},
 		},
 	}
@@ -255,12 +553,13 @@ func TestCallParamsValidInput(t *testing.T) {
 			val, err := testRuntime.VU.Runtime().RunString("(" + tc.JSON + ")")
 			require.NoError(t, err)
 
-			params, err := newCallParams(testRuntime.VU, val)
+			params, err := newCallParams(testRuntime.VU, val, nil)
 			require.NoError(t, err)
 
 			assert.Equal(t, tc.Expected.Timeout, params.Timeout)
 			assert.Equal(t, tc.Expected.Metadata, params.Metadata)
 			assert.Equal(t, tc.Expected.DiscardResponseMessage, params.DiscardResponseMessage)
+			assert.Equal(t, tc.Expected.ReturnHeaders, params.ReturnHeaders)
 		})
 	}
 }
@@ -283,6 +582,56 @@ func TestCallParamsInvalidInput(t *testing.T) {
 			JSON:        `{ metadata: "invalid" }`,
 			ErrContains: "invalid metadata object",
 		},
+		{
+			Name:        "InvalidHeaderName",
+			JSON:        `{ headers: { "x custom": "value" } }`,
+			ErrContains: `invalid headers object: "x custom" is not a valid header name`,
+		},
+		{
+			Name:        "InvalidHeaderValue",
+			JSON:        `{ headers: { "x-custom": "line\nbreak" } }`,
+			ErrContains: `invalid headers object: "x-custom" value is not a valid header value`,
+		},
+		{
+			Name:        "DuplicateHeader",
+			JSON:        `{ headers: { "x-custom": "a", "X-Custom": "b" } }`,
+			ErrContains: `are the same header`,
+		},
+		{
+			Name:        "InvalidBinaryHeader",
+			JSON:        `{ headers: { "ticket-bin": "not base64!" } }`,
+			ErrContains: `invalid headers object: "ticket-bin" value must be base64-encoded`,
+		},
+		{
+			Name:        "InvalidBinaryHeaderType",
+			JSON:        `{ headers: { "ticket-bin": 42 } }`,
+			ErrContains: `"ticket-bin" value must be an ArrayBuffer, a typed array or a base64 string`,
+		},
+		{
+			Name:        "InvalidReturnHeaders",
+			JSON:        `{ returnHeaders: "x-ratelimit-remaining" }`,
+			ErrContains: "invalid returnHeaders: must be a boolean or an array of header names",
+		},
+		{
+			Name:        "InvalidIdempotencyKey",
+			JSON:        `{ idempotencyKey: 42 }`,
+			ErrContains: "invalid idempotencyKey: must be 'auto' or a string, got int64",
+		},
+		{
+			Name:        "EmptyIdempotencyKey",
+			JSON:        `{ idempotencyKey: "" }`,
+			ErrContains: "invalid idempotencyKey: must not be empty",
+		},
+		{
+			Name:        "InvalidSLO",
+			JSON:        `{ slo: 150 }`,
+			ErrContains: "invalid slo: must be a duration string like '150ms', got int64",
+		},
+		{
+			Name:        "NegativeSLO",
+			JSON:        `{ slo: "-1s" }`,
+			ErrContains: "invalid slo: must be positive",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -310,7 +659,7 @@ func TestCallParamsInvalidInput(t *testing.T) {
 			val, err := testRuntime.VU.Runtime().RunString("(" + tc.JSON + ")")
 			require.NoError(t, err)
 
-			_, err = newCallParams(testRuntime.VU, val)
+			_, err = newCallParams(testRuntime.VU, val, nil)
 			require.Error(t, err)
 			assert.Contains(t, err.Error(), tc.ErrContains)
 		})
@@ -325,7 +674,7 @@ func TestCallParamsInInitContext(t *testing.T) {
 	val, err := testRuntime.VU.Runtime().RunString("({})")
 	require.NoError(t, err)
 
-	_, err = newCallParams(testRuntime.VU, val)
+	_, err = newCallParams(testRuntime.VU, val, nil)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "getting call parameters in the init context is not supported")
 }
@@ -0,0 +1,117 @@
+package connectrpc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/sobek"
+)
+
+// peerInfo describes the connection an RPC was sent on, as the transport saw it
+type peerInfo struct {
+	mu         sync.Mutex
+	proto      string // HTTP version of the response, like HTTP/2.0
+	remoteAddr string // Address of the server end of the connection
+	alpn       string // Protocol negotiated by TLS, empty in plaintext
+
+	resp                *http.Response // Response of the RPC, for its raw error
+	wireError           []byte         // Payload carrying the error of the response, see captureWireError
+	wireErrorCompressed bool           // Whether the payload is compressed, ending a compressed stream
+	wireCounted         bool           // Whether the size of the response messages is counted, see countWireSize
+	wireSize            atomic.Int64   // Size of the response messages on the wire, compressed or not
+}
+
+type peerInfoKey struct{}
+
+// withPeerInfo returns a context in which the connection tracking transport fills the peer info
+func withPeerInfo(ctx context.Context) (context.Context, *peerInfo) {
+	peer := &peerInfo{}
+	return context.WithValue(ctx, peerInfoKey{}, peer), peer
+}
+
+// peerInfoFrom returns the peer info of a request context, nil if there is none
+func peerInfoFrom(ctx context.Context) *peerInfo {
+	peer, _ := ctx.Value(peerInfoKey{}).(*peerInfo)
+	return peer
+}
+
+// setRemoteAddr records the address of the connection the request got
+func (p *peerInfo) setRemoteAddr(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.remoteAddr = addr
+}
+
+// setResponse records the protocols of a response, and captures its error as sent
+func (p *peerInfo) setResponse(resp *http.Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.proto = resp.Proto
+	if resp.TLS != nil {
+		p.alpn = resp.TLS.NegotiatedProtocol
+	}
+	p.resp = resp
+	p.captureWireError(resp)
+	p.countWireSize(resp)
+}
+
+// export returns the peer info as given to the scripts
+func (p *peerInfo) export() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return map[string]interface{}{
+		"proto":      p.proto,
+		"remoteAddr": p.remoteAddr,
+		"alpn":       p.alpn,
+	}
+}
+
+// set sets the proto, remoteAddr and alpn properties of a response object
+func (p *peerInfo) set(rt *sobek.Runtime, responseObject *sobek.Object) {
+	if p == nil {
+		return
+	}
+
+	info := p.export()
+	for _, key := range []string{"proto", "remoteAddr", "alpn"} {
+		must(rt, responseObject.Set(key, rt.ToValue(info[key])))
+	}
+}
+
+// errorMetadata splits the metadata of an error into the headers and trailers of its
+// response, which connect-go merges. The headers are the metadata the response carried as
+// HTTP headers, and the trailers the metadata ending the RPC: the gRPC trailers, or all of
+// it when the protocol sends the error in the headers, like the Connect unary errors and
+// the gRPC trailers-only responses do.
+func (p *peerInfo) errorMetadata(err *connect.Error) (headers, trailers http.Header) {
+	meta := err.Meta()
+	if p == nil {
+		return meta, meta
+	}
+
+	p.mu.Lock()
+	resp := p.resp
+	p.mu.Unlock()
+	if resp == nil {
+		return meta, meta
+	}
+
+	headers, trailers = make(http.Header), make(http.Header)
+	for name, values := range meta {
+		if _, ok := resp.Header[name]; ok {
+			headers[name] = values
+		} else {
+			trailers[name] = values
+		}
+	}
+	if len(trailers) == 0 {
+		trailers = meta
+	}
+	return headers, trailers
+}
@@ -0,0 +1,325 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// preparedPayloads holds the request payloads of a method pre-marshaled by precompile().
+// They are created once per test and shared by all VUs.
+type preparedPayloads struct {
+	Method string `js:"method"`
+	Length int    `js:"length"`
+
+	methodDesc protoreflect.MethodDescriptor
+	requests   [][]byte  // JSON payloads given to precompile()
+	encodings  *sync.Map // *preparedEncoding of the payloads by requestUnmarshaler
+}
+
+// preparedEncoding holds the payloads marshaled to both wire formats with the request
+// options of a client, ignoreUnknownFields and timeFields
+type preparedEncoding struct {
+	binary [][]byte
+	json   [][]byte
+	err    error
+}
+
+// encoding returns the payloads marshaled with an unmarshaler, marshaling them on first use.
+// The clients of every VU share the encodings, so each is marshaled about once per test.
+func (p *preparedPayloads) encoding(u requestUnmarshaler) (*preparedEncoding, error) {
+	if enc, ok := p.encodings.Load(u); ok {
+		return enc.(*preparedEncoding), enc.(*preparedEncoding).err
+	}
+	enc, _ := p.encodings.LoadOrStore(u, encodePayloads(p.methodDesc, p.requests, u))
+	return enc.(*preparedEncoding), enc.(*preparedEncoding).err
+}
+
+// preparedRegistry holds the prepared payloads of the test, in the order of the
+// precompile() calls. The init context is the same for every VU, so the n-th call
+// of every VU shares the payloads marshaled by the first one.
+type preparedRegistry struct {
+	mu       sync.Mutex
+	payloads []*preparedPayloads
+}
+
+// getOrPrepare returns the payloads of the index-th precompile() call, preparing them if needed
+func (r *preparedRegistry) getOrPrepare(
+	index int,
+	methodDesc protoreflect.MethodDescriptor,
+	method string,
+	payloads func() ([][]byte, error),
+) (*preparedPayloads, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if index < len(r.payloads) {
+		prepared := r.payloads[index]
+		if prepared.Method != method {
+			return nil, fmt.Errorf("precompile() call %d is for %q in another VU: calls must be the same in every VU", index, prepared.Method)
+		}
+		return prepared, nil
+	}
+
+	reqsJSON, err := payloads()
+	if err != nil {
+		return nil, err
+	}
+
+	prepared, err := preparePayloads(methodDesc, method, reqsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	r.payloads = append(r.payloads, prepared)
+	return prepared, nil
+}
+
+// preparePayloads checks JSON request payloads and marshals them with the default request
+// options. Payloads only valid with ignoreUnknownFields or timeFields are accepted, their
+// errors being reported by the calls of the clients without these options.
+func preparePayloads(methodDesc protoreflect.MethodDescriptor, method string, reqsJSON [][]byte) (*preparedPayloads, error) {
+	prepared := &preparedPayloads{
+		Method:     method,
+		Length:     len(reqsJSON),
+		methodDesc: methodDesc,
+		requests:   reqsJSON,
+		encodings:  &sync.Map{},
+	}
+
+	if _, err := prepared.encoding(requestUnmarshaler{}); err != nil {
+		if _, err := prepared.encoding(requestUnmarshaler{discardUnknown: true, convertTimes: true}); err != nil {
+			return nil, err
+		}
+	}
+	return prepared, nil
+}
+
+// encodePayloads marshals JSON request payloads to both the binary and the JSON wire formats
+func encodePayloads(methodDesc protoreflect.MethodDescriptor, reqsJSON [][]byte, u requestUnmarshaler) *preparedEncoding {
+	enc := &preparedEncoding{
+		binary: make([][]byte, len(reqsJSON)),
+		json:   make([][]byte, len(reqsJSON)),
+	}
+
+	for i, reqJSON := range reqsJSON {
+		msg := dynamicpb.NewMessage(methodDesc.Input())
+		if err := u.unmarshal(reqJSON, msg); err != nil {
+			enc.err = fmt.Errorf("payload %d: failed to unmarshal JSON into dynamic protobuf message: %w", i, err)
+			return enc
+		}
+
+		var err error
+		if enc.binary[i], err = proto.Marshal(msg); err != nil {
+			enc.err = fmt.Errorf("payload %d: failed to marshal to protobuf: %w", i, err)
+			return enc
+		}
+		if enc.json[i], err = protojson.Marshal(msg); err != nil {
+			enc.err = fmt.Errorf("payload %d: failed to marshal to JSON: %w", i, err)
+			return enc
+		}
+	}
+
+	return enc
+}
+
+// precompile pre-marshals an array of request payloads for a method in the init context.
+// The payloads can also be given as a function returning the array, like for a SharedArray,
+// so that only the first VU builds them.
+func (mi *ModuleInstance) precompile(method string, payloads sobek.Value) (*preparedPayloads, error) {
+	if mi.vu.State() != nil {
+		return nil, errors.New("precompile must be called in the init context")
+	}
+
+	method = dynamic.MethodPath(method)
+	methodDesc, err := globalProtoRegistry.getMethodDescriptor(method)
+	if err != nil {
+		return nil, err
+	}
+
+	if common.IsNullish(payloads) {
+		return nil, errors.New("payloads cannot be null or undefined")
+	}
+
+	rt := mi.vu.Runtime()
+	index := mi.preparedCount
+	mi.preparedCount++
+
+	prepared, err := mi.prepared.getOrPrepare(index, methodDesc, method, func() ([][]byte, error) {
+		if fn, ok := sobek.AssertFunction(payloads); ok {
+			v, err := fn(sobek.Undefined())
+			if err != nil {
+				return nil, err
+			}
+			payloads = v
+		}
+
+		obj, ok := payloads.(*sobek.Object)
+		if !ok || obj.ClassName() != "Array" {
+			return nil, errors.New("payloads must be an array or a function returning an array")
+		}
+
+		length := int(obj.Get("length").ToInteger())
+		reqsJSON := make([][]byte, length)
+		for i := 0; i < length; i++ {
+			reqJSON, err := obj.Get(fmt.Sprintf("%d", i)).ToObject(rt).MarshalJSON()
+			if err != nil {
+				return nil, fmt.Errorf("payload %d: failed to marshal request object: %w", i, err)
+			}
+			reqsJSON[i] = reqJSON
+		}
+		return reqsJSON, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each VU gets its own handle, the payloads themselves are shared
+	handle := *prepared
+	return &handle, nil
+}
+
+// InvokePrepared calls a unary RPC with the index-th payload pre-marshaled by precompile()
+func (c *Client) InvokePrepared(handle sobek.Value, index int, params sobek.Value) (*sobek.Object, error) {
+	state := c.vu.State()
+	if state == nil {
+		return nil, common.NewInitContextError("invoking RPC methods is not supported in the init context")
+	}
+
+	if c.httpClient == nil && c.connectParams == nil {
+		return nil, errNotConnected
+	}
+	if err := c.checkRampDown(); err != nil {
+		return nil, err
+	}
+	if err := c.refreshAuth(); err != nil {
+		return nil, err
+	}
+	if err := c.selectTarget(); err != nil {
+		return nil, err
+	}
+	if c.connectParams != nil && registeredCodec(c.connectParams.ContentType) != nil {
+		return nil, fmt.Errorf("invokePrepared() sends payloads precompiled to protobuf or JSON, not with the codec of %s",
+			c.connectParams.ContentType)
+	}
+
+	if common.IsNullish(handle) {
+		return nil, errors.New("invalid prepared payloads: must be created with connectrpc.precompile()")
+	}
+	prepared, ok := handle.Export().(*preparedPayloads)
+	if !ok {
+		return nil, errors.New("invalid prepared payloads: must be created with connectrpc.precompile()")
+	}
+	if index < 0 || index >= prepared.Length {
+		return nil, fmt.Errorf("prepared payload index %d out of range [0, %d)", index, prepared.Length)
+	}
+
+	p, err := newCallParams(c.vu, params, c.defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connectrpc.invokePrepared() parameters: %w", err)
+	}
+	enc, err := prepared.encoding(c.requestUnmarshaler(p))
+	if err != nil {
+		return nil, err
+	}
+
+	var result *rpcResult
+	c.awaitMock(func() {
+		result = c.doPreparedRPC(prepared, enc, index, p)
+	})
+
+	if c.metrics != nil {
+		tags := c.createUnaryMetricTags(prepared.Method, p, result.httpStatus, result.err)
+		c.metrics.recordUnaryRequest(c.vu.Context(), c.vu, result.duration, result.reqSize, result.respSize, tags, result.err)
+		c.recordServerTiming(tags, result.server)
+		if result.err == nil {
+			c.recordResponseCompression(tags, result.peer, result.decompressed)
+		}
+	}
+
+	response := c.convertRPCResultToObject(result)
+	p.setRequestID(c.vu.Runtime(), response)
+	if err := c.deriveSamples(prepared.Method, p, response, result.responseJSON); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// doPreparedRPC performs the RPC call with a prepared payload without touching the sobek runtime
+func (c *Client) doPreparedRPC(prepared *preparedPayloads, enc *preparedEncoding, index int, p *callParams) *rpcResult {
+	msg := preparedMessage{data: enc.binary[index]}
+	if c.connectParams != nil && c.connectParams.ContentType == "application/json" {
+		msg.data = enc.json[index]
+	}
+
+	result := &rpcResult{
+		reqSize: int64(len(msg.data)),
+	}
+
+	httpClient := c.rpcHTTPClient(result)
+	if httpClient == nil {
+		return result
+	}
+	if c.connectionStrategy == "per-call" {
+		defer c.releaseHTTPClient(httpClient)
+	}
+
+	preparedClient := c.preparedClient(httpClient, prepared.Method, prepared.methodDesc)
+
+	return completeUnaryRPC(c, result, preparedClient.CallUnary, connect.NewRequest(&msg), prepared.Method, p)
+}
+
+// preparedMessage is a request message already marshaled to the wire format
+type preparedMessage struct {
+	data []byte
+}
+
+// preparedCodec sends prepared messages as is and unmarshals responses like the default codecs
+type preparedCodec struct {
+	name string
+}
+
+func newPreparedCodec(p *connectParams) connect.Codec {
+	if p != nil && p.ContentType == "application/json" {
+		return preparedCodec{name: "json"}
+	}
+	return preparedCodec{name: "proto"}
+}
+
+func (c preparedCodec) Name() string {
+	return c.name
+}
+
+// Marshal returns a copy of the prepared data, since connect-go reuses the returned slice
+func (c preparedCodec) Marshal(msg any) ([]byte, error) {
+	return c.MarshalAppend(nil, msg)
+}
+
+// MarshalAppend lets connect-go copy the prepared data to a pooled buffer
+func (c preparedCodec) MarshalAppend(dst []byte, msg any) ([]byte, error) {
+	prepared, ok := msg.(*preparedMessage)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a prepared message", msg)
+	}
+	return append(dst, prepared.data...), nil
+}
+
+func (c preparedCodec) Unmarshal(data []byte, msg any) error {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T does not implement proto.Message", msg)
+	}
+	if c.name == "json" {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, protoMsg)
+	}
+	return proto.Unmarshal(data, protoMsg)
+}
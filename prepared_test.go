@@ -0,0 +1,98 @@
+package connectrpc
+
+import (
+	"testing"
+
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPreparedRegistrySharesPayloads(t *testing.T) {
+	t.Parallel()
+
+	methodDesc := pingv1.File_ping_v1_ping_proto.Services().ByName("PingService").Methods().ByName("Ping")
+	method := "/k6.connectrpc.ping.v1.PingService/Ping"
+
+	registry := &preparedRegistry{}
+	calls := 0
+	payloads := func() ([][]byte, error) {
+		calls++
+		return [][]byte{[]byte(`{"number": 1}`), []byte(`{"number": 2, "text": "two"}`)}, nil
+	}
+
+	first, err := registry.getOrPrepare(0, methodDesc, method, payloads)
+	require.NoError(t, err)
+	second, err := registry.getOrPrepare(0, methodDesc, method, payloads)
+	require.NoError(t, err)
+
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, first.Length)
+
+	enc, err := first.encoding(requestUnmarshaler{})
+	require.NoError(t, err)
+	same, err := second.encoding(requestUnmarshaler{})
+	require.NoError(t, err)
+	assert.Same(t, enc, same)
+
+	var msg pingv1.PingRequest
+	require.NoError(t, proto.Unmarshal(enc.binary[1], &msg))
+	assert.Equal(t, int64(2), msg.GetNumber())
+	assert.Equal(t, "two", msg.GetText())
+	assert.JSONEq(t, `{"number": "2", "text": "two"}`, string(enc.json[1]))
+
+	_, err = registry.getOrPrepare(0, methodDesc, "/k6.connectrpc.ping.v1.PingService/Sum", payloads)
+	require.ErrorContains(t, err, "calls must be the same in every VU")
+}
+
+func TestPreparePayloadsInvalid(t *testing.T) {
+	t.Parallel()
+
+	methodDesc := pingv1.File_ping_v1_ping_proto.Services().ByName("PingService").Methods().ByName("Ping")
+
+	_, err := preparePayloads(methodDesc, "/k6.connectrpc.ping.v1.PingService/Ping", [][]byte{[]byte(`{"number": "many"}`)})
+	require.ErrorContains(t, err, "payload 0: failed to unmarshal JSON into dynamic protobuf message")
+}
+
+func TestPreparedPayloadsIgnoreUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	methodDesc := pingv1.File_ping_v1_ping_proto.Services().ByName("PingService").Methods().ByName("Ping")
+
+	// Payloads for a newer proto are only rejected by the clients not ignoring unknown fields
+	prepared, err := preparePayloads(methodDesc, "/k6.connectrpc.ping.v1.PingService/Ping",
+		[][]byte{[]byte(`{"number": 1}`), []byte(`{"number": 2, "newField": true}`)})
+	require.NoError(t, err)
+
+	_, err = prepared.encoding(requestUnmarshaler{})
+	require.ErrorContains(t, err, "payload 1: failed to unmarshal JSON into dynamic protobuf message: field newField: unknown field")
+
+	enc, err := prepared.encoding(requestUnmarshaler{discardUnknown: true})
+	require.NoError(t, err)
+	var msg pingv1.PingRequest
+	require.NoError(t, proto.Unmarshal(enc.binary[1], &msg))
+	assert.Equal(t, int64(2), msg.GetNumber())
+	assert.JSONEq(t, `{"number": "2"}`, string(enc.json[1]))
+}
+
+func TestPreparedCodec(t *testing.T) {
+	t.Parallel()
+
+	codec := newPreparedCodec(&connectParams{ContentType: "application/json"})
+	assert.Equal(t, "json", codec.Name())
+	assert.Equal(t, "proto", newPreparedCodec(&connectParams{ContentType: "application/proto"}).Name())
+
+	msg := &preparedMessage{data: []byte{0x08, 0x01}}
+	data, err := codec.Marshal(msg)
+	require.NoError(t, err)
+	assert.Equal(t, msg.data, data)
+
+	// The returned slice must not alias the shared prepared data
+	data[0] = 0xff
+	assert.Equal(t, byte(0x08), msg.data[0])
+
+	_, err = codec.Marshal(&pingv1.PingRequest{})
+	require.ErrorContains(t, err, "is not a prepared message")
+}
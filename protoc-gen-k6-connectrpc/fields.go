@@ -0,0 +1,379 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// messageIndex finds the messages of a FileDescriptorSet by their fully-qualified name,
+// like .pkg.Message, as the method input and output types reference them.
+type messageIndex struct {
+	messages map[string]*descriptorpb.DescriptorProto
+	enums    map[string]*descriptorpb.EnumDescriptorProto
+	comments map[string]string // Leading comments of the messages, fields and methods by full name
+}
+
+// newMessageIndex indexes the messages and enums of all the files, nested ones included
+func newMessageIndex(fdSet *descriptorpb.FileDescriptorSet) *messageIndex {
+	idx := &messageIndex{
+		messages: make(map[string]*descriptorpb.DescriptorProto),
+		enums:    make(map[string]*descriptorpb.EnumDescriptorProto),
+		comments: make(map[string]string),
+	}
+	for _, file := range fdSet.GetFile() {
+		prefix := ""
+		if file.GetPackage() != "" {
+			prefix = "." + file.GetPackage()
+		}
+		for _, enum := range file.GetEnumType() {
+			idx.enums[prefix+"."+enum.GetName()] = enum
+		}
+		for _, msg := range file.GetMessageType() {
+			idx.addMessage(prefix, msg)
+		}
+		idx.addComments(file, prefix)
+	}
+	return idx
+}
+
+// addComments indexes the leading comments of the messages, fields and methods of a file,
+// which protoc passes in the source code info of the files to generate
+func (idx *messageIndex) addComments(file *descriptorpb.FileDescriptorProto, prefix string) {
+	for _, location := range file.GetSourceCodeInfo().GetLocation() {
+		comment := strings.Join(strings.Fields(location.GetLeadingComments()), " ")
+		if comment == "" {
+			continue
+		}
+		if name := sourcePathName(file, prefix, location.GetPath()); name != "" {
+			// A comment containing */ would end the JSDoc block
+			idx.comments[name] = strings.ReplaceAll(comment, "*/", "*\\/")
+		}
+	}
+}
+
+// sourcePathName returns the full name of the message, field or method at a source code
+// info path, like .pkg.Message.field, or empty for the other elements of the file
+func sourcePathName(file *descriptorpb.FileDescriptorProto, prefix string, path []int32) string {
+	const (
+		fileMessageType    = 4 // FileDescriptorProto.message_type
+		fileService        = 6 // FileDescriptorProto.service
+		messageField       = 2 // DescriptorProto.field
+		messageNestedType  = 3 // DescriptorProto.nested_type
+		serviceMethod      = 2 // ServiceDescriptorProto.method
+		serviceMethodDepth = 4
+	)
+
+	switch {
+	case len(path) >= 2 && path[0] == fileMessageType:
+		if int(path[1]) >= len(file.GetMessageType()) {
+			return ""
+		}
+		msg := file.GetMessageType()[path[1]]
+		name := prefix + "." + msg.GetName()
+		for path = path[2:]; len(path) >= 2; path = path[2:] {
+			switch {
+			case path[0] == messageNestedType && int(path[1]) < len(msg.GetNestedType()):
+				msg = msg.GetNestedType()[path[1]]
+				name += "." + msg.GetName()
+			case path[0] == messageField && len(path) == 2 && int(path[1]) < len(msg.GetField()):
+				return name + "." + msg.GetField()[path[1]].GetName()
+			default:
+				return ""
+			}
+		}
+		if len(path) != 0 {
+			return ""
+		}
+		return name
+	case len(path) == serviceMethodDepth && path[0] == fileService && path[2] == serviceMethod:
+		if int(path[1]) >= len(file.GetService()) {
+			return ""
+		}
+		service := file.GetService()[path[1]]
+		if int(path[3]) >= len(service.GetMethod()) {
+			return ""
+		}
+		return prefix + "." + service.GetName() + "." + service.GetMethod()[path[3]].GetName()
+	}
+	return ""
+}
+
+func (idx *messageIndex) addMessage(prefix string, msg *descriptorpb.DescriptorProto) {
+	name := prefix + "." + msg.GetName()
+	idx.messages[name] = msg
+	for _, enum := range msg.GetEnumType() {
+		idx.enums[name+"."+enum.GetName()] = enum
+	}
+	for _, nested := range msg.GetNestedType() {
+		idx.addMessage(name, nested)
+	}
+}
+
+// fields returns the fields of a message, named as the field_naming option sets
+func (idx *messageIndex) fields(typeName string, cfg *Config) []FieldInfo {
+	msg, ok := idx.messages[typeName]
+	if !ok {
+		return nil
+	}
+
+	fields := make([]FieldInfo, 0, len(msg.GetField()))
+	for _, field := range msg.GetField() {
+		fields = append(fields, FieldInfo{
+			Name:       fieldName(field, cfg),
+			Type:       idx.fieldType(field),
+			Required:   field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED,
+			IsOptional: field.GetProto3Optional(),
+			MockValue:  idx.mockValue(field),
+			JSDocType:  idx.jsDocType(field),
+			Comment:    idx.comments[typeName+"."+field.GetName()],
+		})
+	}
+	return fields
+}
+
+// fieldName returns the JSON name of a field, as Connect-ES names it, or its proto name
+func fieldName(field *descriptorpb.FieldDescriptorProto, cfg *Config) string {
+	if cfg.FieldNaming == "proto" {
+		return field.GetName()
+	}
+	if field.GetJsonName() != "" {
+		return field.GetJsonName()
+	}
+	return jsonName(field.GetName())
+}
+
+// jsonName returns the lowerCamel name protoc derives from a snake_case field name
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '_':
+			upper = true
+		case upper && isLetter(name[i]):
+			b.WriteString(strings.ToUpper(name[i : i+1]))
+			upper = false
+		default:
+			b.WriteByte(name[i])
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+// isMap reports whether a repeated message field is a map, whose entries are synthetic messages
+func (idx *messageIndex) isMap(field *descriptorpb.FieldDescriptorProto) bool {
+	msg, ok := idx.messages[field.GetTypeName()]
+	return ok && msg.GetOptions().GetMapEntry()
+}
+
+// fieldType returns the proto type of a field, lowercased like string, int64, message or enum
+func (idx *messageIndex) fieldType(field *descriptorpb.FieldDescriptorProto) string {
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		if idx.isMap(field) {
+			return "map"
+		}
+		return "repeated"
+	}
+	return strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_"))
+}
+
+// mockValue returns a JS literal of a valid value of a field, in the protojson mapping
+func (idx *messageIndex) mockValue(field *descriptorpb.FieldDescriptorProto) string {
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		if idx.isMap(field) {
+			return "{}"
+		}
+		return "[]"
+	}
+
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return fmt.Sprintf("'mock-%s'", field.GetName())
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "false"
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return "''"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		// protojson encodes 64-bit integers as strings, to keep their precision
+		return "'0'"
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if enum, ok := idx.enums[field.GetTypeName()]; ok && len(enum.GetValue()) > 0 {
+			return fmt.Sprintf("'%s'", enum.GetValue()[0].GetName())
+		}
+		return "0"
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return "{}"
+	default:
+		return "0"
+	}
+}
+
+// typeScriptType returns the TypeScript type of a field, in the protojson mapping
+func typeScriptType(field FieldInfo) string {
+	switch field.Type {
+	case "string", "bytes", "enum":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "int64", "uint64", "sint64", "fixed64", "sfixed64":
+		return "string | number"
+	case "double", "float", "int32", "uint32", "sint32", "fixed32", "sfixed32":
+		return "number"
+	case "repeated":
+		return "any[]"
+	default:
+		return "Record<string, any>"
+	}
+}
+
+// typeScriptInterface returns the declaration of the request shape of a message
+func typeScriptInterface(name string, fields []FieldInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nexport declare interface %s {\n", name)
+	for _, field := range fields {
+		optional := "?"
+		if field.Required {
+			optional = ""
+		}
+		fmt.Fprintf(&b, "    %s%s: %s;\n", field.Name, optional, typeScriptType(field))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// simpleName returns the last component of a fully-qualified type name
+func simpleName(typeName string) string {
+	return typeName[strings.LastIndex(typeName, ".")+1:]
+}
+
+// wellKnownJSDocTypes are the JSDoc types of the well-known types, in the protojson mapping
+var wellKnownJSDocTypes = map[string]string{
+	".google.protobuf.Any":         "Object",
+	".google.protobuf.BoolValue":   "boolean",
+	".google.protobuf.BytesValue":  "string",
+	".google.protobuf.DoubleValue": "number",
+	".google.protobuf.Duration":    "string",
+	".google.protobuf.Empty":       "Object",
+	".google.protobuf.FieldMask":   "string",
+	".google.protobuf.FloatValue":  "number",
+	".google.protobuf.Int32Value":  "number",
+	".google.protobuf.Int64Value":  "string|number",
+	".google.protobuf.ListValue":   "Array<*>",
+	".google.protobuf.StringValue": "string",
+	".google.protobuf.Struct":      "Object<string, *>",
+	".google.protobuf.Timestamp":   "string",
+	".google.protobuf.UInt32Value": "number",
+	".google.protobuf.UInt64Value": "string|number",
+	".google.protobuf.Value":       "*",
+}
+
+// jsDocType returns the JSDoc type of a field, in the protojson mapping. Messages are
+// named by their typedef, see typedefs.
+func (idx *messageIndex) jsDocType(field *descriptorpb.FieldDescriptorProto) string {
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		if idx.isMap(field) {
+			entry := idx.messages[field.GetTypeName()]
+			return fmt.Sprintf("Object<string, %s>", idx.jsDocSingularType(entry.GetField()[1]))
+		}
+		return fmt.Sprintf("Array<%s>", idx.jsDocSingularType(field))
+	}
+	return idx.jsDocSingularType(field)
+}
+
+// jsDocSingularType returns the JSDoc type of one value of a field
+func (idx *messageIndex) jsDocSingularType(field *descriptorpb.FieldDescriptorProto) string {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return "string"
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "boolean"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return "string|number"
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		enum, ok := idx.enums[field.GetTypeName()]
+		if !ok || len(enum.GetValue()) == 0 {
+			return "string"
+		}
+		names := make([]string, 0, len(enum.GetValue()))
+		for _, value := range enum.GetValue() {
+			names = append(names, "'"+value.GetName()+"'")
+		}
+		return "(" + strings.Join(names, "|") + ")"
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return idx.jsDocMessageType(field.GetTypeName())
+	default:
+		return "number"
+	}
+}
+
+// jsDocMessageType returns the JSDoc type of a message: its typedef, or the type of a
+// well-known type
+func (idx *messageIndex) jsDocMessageType(typeName string) string {
+	if wkt, ok := wellKnownJSDocTypes[typeName]; ok {
+		return wkt
+	}
+	if _, ok := idx.messages[typeName]; !ok {
+		return "Object"
+	}
+	return simpleName(typeName)
+}
+
+// typedefs returns the JSDoc typedefs of the requests and responses of the methods, and of
+// the messages of their fields. The requests name their fields with field_naming, and the
+// messages only found in responses with the JSON names protojson returns.
+func (idx *messageIndex) typedefs(inputs, outputs []string, cfg *Config) []TypedefInfo {
+	var typedefs []TypedefInfo
+	seen := make(map[string]bool)
+
+	var add func(typeName string, cfg *Config)
+	add = func(typeName string, cfg *Config) {
+		msg, ok := idx.messages[typeName]
+		if !ok || seen[simpleName(typeName)] || idx.jsDocMessageType(typeName) != simpleName(typeName) {
+			return
+		}
+		seen[simpleName(typeName)] = true
+		typedefs = append(typedefs, TypedefInfo{
+			Name:    simpleName(typeName),
+			Comment: idx.comments[typeName],
+			Fields:  idx.fields(typeName, cfg),
+		})
+
+		for _, field := range msg.GetField() {
+			if idx.isMap(field) {
+				field = idx.messages[field.GetTypeName()].GetField()[1]
+			}
+			if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+				add(field.GetTypeName(), cfg)
+			}
+		}
+	}
+
+	for _, typeName := range inputs {
+		add(typeName, cfg)
+	}
+	responseCfg := *cfg
+	responseCfg.FieldNaming = "json"
+	for _, typeName := range outputs {
+		add(typeName, &responseCfg)
+	}
+	return typedefs
+}
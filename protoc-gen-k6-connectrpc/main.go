@@ -46,7 +46,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"text/template"
 
 	connect "connectrpc.com/connect"
 	"google.golang.org/protobuf/proto"
@@ -68,6 +67,8 @@ type TemplateData struct {
 	Config                *Config
 	StreamingWrappersPath string
 	EmbeddedProtoset      string
+	// Typedefs are the JSDoc typedefs of the messages of the methods, for editor completion
+	Typedefs []TypedefInfo
 }
 
 type FileInfo struct {
@@ -87,11 +88,16 @@ type MethodInfo struct {
 	Comment          string
 	StreamType       string
 	ProcedurePath    string
+	InputType        string // JSDoc type of the request, see jsDocMessageType
+	OutputType       string // JSDoc type of the response messages
 	InputFields      []FieldInfo
 	OutputFields     []FieldInfo
 	HasIdempotency   bool
 	IdempotencyLevel string
 	SuggestedTimeout string
+	// HasStreamAlias is set when the deprecated <camelName>Stream alias of a client or
+	// bidirectional streaming method does not collide with another method of the service
+	HasStreamAlias bool
 }
 
 type FieldInfo struct {
@@ -102,6 +108,15 @@ type FieldInfo struct {
 	HasValidation  bool
 	ValidationCode string
 	MockValue      string
+	JSDocType      string // Type of the @property of the field, see jsDocType
+	Comment        string // Leading comment of the field in the proto file
+}
+
+// TypedefInfo is the JSDoc typedef of a message
+type TypedefInfo struct {
+	Name    string
+	Comment string
+	Fields  []FieldInfo
 }
 
 func main() {
@@ -138,13 +153,22 @@ func main() {
 
 	// Parse parameters from the request
 	if params := request.GetParameter(); params != "" {
+		lastKey := ""
 		for _, param := range strings.Split(params, ",") {
-			if kv := strings.SplitN(param, "=", 2); len(kv) == 2 {
-				if err := flagSet.Set(kv[0], kv[1]); err != nil {
-					fmt.Fprintf(os.Stderr, "Invalid parameter %s=%s: %v\n", kv[0], kv[1], err)
-					os.Exit(1)
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				// The next value of a list, like the OrderService of include_services=pkg.UserService,pkg.OrderService
+				if cfg.IsListFlag(lastKey) {
+					kv = []string{lastKey, param}
+				} else {
+					continue
 				}
 			}
+			if err := flagSet.Set(kv[0], kv[1]); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid parameter %s=%s: %v\n", kv[0], kv[1], err)
+				os.Exit(1)
+			}
+			lastKey = kv[0]
 		}
 	}
 
@@ -156,7 +180,13 @@ func main() {
 
 	// Create response
 	response := &pluginpb.CodeGeneratorResponse{
-		SupportedFeatures: proto.Uint64(uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)),
+		SupportedFeatures: proto.Uint64(uint64(
+			pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL |
+				pluginpb.CodeGeneratorResponse_FEATURE_SUPPORTS_EDITIONS,
+		)),
+		// The descriptors are embedded as is, the editions are only limited by the runtime
+		MinimumEdition: proto.Int32(int32(descriptorpb.Edition_EDITION_PROTO2)),
+		MaximumEdition: proto.Int32(int32(descriptorpb.Edition_EDITION_2023)),
 	}
 
 	// Check if any file to generate has services and needs external wrappers
@@ -171,7 +201,7 @@ func main() {
 					break
 				}
 			}
-			if fileDesc != nil && hasStreamingMethods(fileDesc) {
+			if fileDesc != nil && hasStreamingMethods(filterServices(fileDesc, cfg)) {
 				needsExternalWrappers = true
 				break
 			}
@@ -202,6 +232,9 @@ func main() {
 			continue
 		}
 
+		// Leave out the services and methods filtered by include_services and exclude_methods
+		fileDesc = filterServices(fileDesc, cfg)
+
 		// Check if file has services
 		if len(fileDesc.GetService()) == 0 {
 			continue
@@ -217,13 +250,21 @@ func main() {
 
 		// Generate TypeScript client if requested
 		if cfg.ShouldGenerateTS() {
-			if err := generateTypeScriptFile(fileDesc, cfg, response); err != nil {
+			if err := generateTypeScriptFile(fileDesc, cfg, &request, response); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to generate TypeScript for %s: %v\n", fileName, err)
 				os.Exit(1)
 			}
 		}
 	}
 
+	// Check the existing files instead of writing them
+	if cfg.Verify {
+		if err := verifyResponse(response, cfg.VerifyDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to verify the generated files: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Write response to stdout
 	output, err := proto.Marshal(response)
 	if err != nil {
@@ -264,7 +305,7 @@ func generateJavaScriptFile(fileDesc *descriptorpb.FileDescriptorProto, cfg *Con
 	return nil
 }
 
-func generateTypeScriptFile(fileDesc *descriptorpb.FileDescriptorProto, cfg *Config, response *pluginpb.CodeGeneratorResponse) error {
+func generateTypeScriptFile(fileDesc *descriptorpb.FileDescriptorProto, cfg *Config, request *pluginpb.CodeGeneratorRequest, response *pluginpb.CodeGeneratorResponse) error {
 	// Generate output filename
 	filename := strings.TrimSuffix(fileDesc.GetName(), ".proto") + ".k6.d.ts"
 
@@ -278,19 +319,59 @@ func generateTypeScriptFile(fileDesc *descriptorpb.FileDescriptorProto, cfg *Con
 
 `, fileDesc.GetName())
 
+	// Declare the wrappers the streaming methods return
+	if cfg.StreamingWrappers && hasStreamingMethods(fileDesc) {
+		content += `
+export declare interface ServerStreamWrapper {
+    on(event: 'data' | 'end' | 'error', callback: (value?: any) => void): ServerStreamWrapper;
+    forEach(callback: (message: any) => void): ServerStreamWrapper;
+    onEnd(callback: () => void): ServerStreamWrapper;
+    onError(callback: (err: any) => void): ServerStreamWrapper;
+    collect(): Promise<any[]>;
+}
+
+export declare interface ClientStreamWrapper {
+    write(message: any): ClientStreamWrapper;
+    close(): ClientStreamWrapper;
+    onResponse(callback: (response: any) => void): ClientStreamWrapper;
+    onError(callback: (err: any) => void): ClientStreamWrapper;
+    response(): Promise<any>;
+}
+
+export declare interface BidiStreamWrapper {
+    on(event: 'data' | 'end' | 'error', callback: (value?: any) => void): BidiStreamWrapper;
+    write(message: any): BidiStreamWrapper;
+    close(): BidiStreamWrapper;
+    onEnd(callback: () => void): BidiStreamWrapper;
+    onError(callback: (err: any) => void): BidiStreamWrapper;
+}
+`
+	}
+
+	// Declare the request shapes, with the field names of field_naming
+	idx := newMessageIndex(&descriptorpb.FileDescriptorSet{File: request.GetProtoFile()})
+	declared := make(map[string]bool)
+	for _, service := range fileDesc.GetService() {
+		for _, method := range service.GetMethod() {
+			name := simpleName(method.GetInputType())
+			if declared[name] {
+				continue
+			}
+			declared[name] = true
+			content += typeScriptInterface(name, idx.fields(method.GetInputType(), cfg))
+		}
+	}
+
 	// Add service interface definitions
 	for _, service := range fileDesc.GetService() {
 		content += fmt.Sprintf(`
 // Service: %s
-export declare class %sClient {
-    constructor(baseURL: string);
-`, service.GetName(), service.GetName())
+export declare class %s%s {
+    constructor(connectrpcClient: any, baseURL?: string);
+`, service.GetName(), service.GetName(), cfg.ClientSuffix)
 
 		for _, method := range service.GetMethod() {
-			content += fmt.Sprintf(`
-    // Method: %s
-    %s(request: any): any;
-`, method.GetName(), strings.ToLower(method.GetName()))
+			content += fmt.Sprintf("\n    // Method: %s\n    %s;\n", method.GetName(), typeScriptSignature(method, cfg))
 		}
 
 		content += "}\n"
@@ -343,6 +424,8 @@ func buildTemplateData(fileDesc *descriptorpb.FileDescriptorProto, cfg *Config,
 	}
 
 	// Build services
+	idx := newMessageIndex(fdSet)
+	var inputs, outputs []string
 	for _, serviceDesc := range fileDesc.GetService() {
 		service := ServiceInfo{
 			Name:     serviceDesc.GetName(),
@@ -358,16 +441,28 @@ func buildTemplateData(fileDesc *descriptorpb.FileDescriptorProto, cfg *Config,
 				Comment:       fmt.Sprintf("Method %s", methodDesc.GetName()),
 				StreamType:    getStreamType(methodDesc),
 				ProcedurePath: fmt.Sprintf("/%s.%s/%s", fileDesc.GetPackage(), serviceDesc.GetName(), methodDesc.GetName()),
+				InputType:     idx.jsDocMessageType(methodDesc.GetInputType()),
+				OutputType:    idx.jsDocMessageType(methodDesc.GetOutputType()),
+				InputFields:   idx.fields(methodDesc.GetInputType(), cfg),
+				OutputFields:  idx.fields(methodDesc.GetOutputType(), cfg),
+			}
+			if comment := idx.comments[methodFullName(fileDesc, serviceDesc, methodDesc)]; comment != "" {
+				method.Comment = comment
 			}
+			inputs = append(inputs, methodDesc.GetInputType())
+			outputs = append(outputs, methodDesc.GetOutputType())
 
 			service.Methods = append(service.Methods, method)
 		}
+		markStreamAliases(service.Methods)
 
 		data.Services = append(data.Services, service)
 	}
+	data.Typedefs = idx.typedefs(inputs, outputs, cfg)
 
-	// Serialize FileDescriptorSet to base64 for embedding
-	fdSetBytes, err := proto.Marshal(fdSet)
+	// Serialize FileDescriptorSet to base64 for embedding, deterministically so that the
+	// output is the same for the same protos
+	fdSetBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdSet)
 	if err != nil {
 		// If we can't marshal, just leave it empty - the client will work without auto-loading
 		data.EmbeddedProtoset = ""
@@ -378,6 +473,32 @@ func buildTemplateData(fileDesc *descriptorpb.FileDescriptorProto, cfg *Config,
 	return data
 }
 
+// markStreamAliases sets HasStreamAlias on the client and bidirectional streaming
+// methods, unless the service also has a method whose client name is the alias,
+// like a CountStream next to a Count
+func markStreamAliases(methods []MethodInfo) {
+	names := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		names[method.CamelName] = true
+	}
+	for i := range methods {
+		switch methods[i].StreamType {
+		case "client_stream", "bidi_stream":
+			methods[i].HasStreamAlias = !names[methods[i].CamelName+"Stream"]
+		}
+	}
+}
+
+// methodFullName returns the full name of a method, like .pkg.Service.Method, as the
+// comments are indexed
+func methodFullName(fileDesc *descriptorpb.FileDescriptorProto, service *descriptorpb.ServiceDescriptorProto, method *descriptorpb.MethodDescriptorProto) string {
+	prefix := ""
+	if fileDesc.GetPackage() != "" {
+		prefix = "." + fileDesc.GetPackage()
+	}
+	return prefix + "." + service.GetName() + "." + method.GetName()
+}
+
 func getStreamType(method *descriptorpb.MethodDescriptorProto) string {
 	if method.GetClientStreaming() && method.GetServerStreaming() {
 		return "bidi_stream"
@@ -389,6 +510,33 @@ func getStreamType(method *descriptorpb.MethodDescriptorProto) string {
 	return "unary"
 }
 
+// typeScriptSignature returns the declaration of the client method of a method, whose
+// return type depends on its stream type
+func typeScriptSignature(method *descriptorpb.MethodDescriptorProto, cfg *Config) string {
+	name := toCamelCase(method.GetName())
+	input := simpleName(method.GetInputType())
+	stream := "any"
+	switch getStreamType(method) {
+	case "server_stream":
+		if cfg.StreamingWrappers {
+			stream = "ServerStreamWrapper"
+		}
+		return fmt.Sprintf("%s(request: %s, options?: any): %s", name, input, stream)
+	case "client_stream":
+		if cfg.StreamingWrappers {
+			stream = "ClientStreamWrapper"
+		}
+		return fmt.Sprintf("%s(options?: any): %s", name, stream)
+	case "bidi_stream":
+		if cfg.StreamingWrappers {
+			stream = "BidiStreamWrapper"
+		}
+		return fmt.Sprintf("%s(options?: any): %s", name, stream)
+	default:
+		return fmt.Sprintf("%s(request: %s, options?: any): any", name, input)
+	}
+}
+
 // toCamelCase converts a PascalCase string to camelCase
 func toCamelCase(s string) string {
 	if len(s) == 0 {
@@ -398,6 +546,38 @@ func toCamelCase(s string) string {
 	return strings.ToLower(s[:1]) + s[1:]
 }
 
+// filterServices returns the file with only the services of include_services, without the
+// methods of exclude_methods. The services left without methods are dropped.
+func filterServices(fileDesc *descriptorpb.FileDescriptorProto, cfg *Config) *descriptorpb.FileDescriptorProto {
+	if len(cfg.IncludeServices) == 0 && len(cfg.ExcludeMethods) == 0 {
+		return fileDesc
+	}
+
+	filtered := proto.Clone(fileDesc).(*descriptorpb.FileDescriptorProto)
+	filtered.Service = nil
+	for _, service := range fileDesc.GetService() {
+		fullName := service.GetName()
+		if fileDesc.GetPackage() != "" {
+			fullName = fileDesc.GetPackage() + "." + fullName
+		}
+		if !cfg.IncludesService(fullName) {
+			continue
+		}
+
+		kept := proto.Clone(service).(*descriptorpb.ServiceDescriptorProto)
+		kept.Method = nil
+		for _, method := range service.GetMethod() {
+			if !cfg.ExcludesMethod(fullName, method.GetName()) {
+				kept.Method = append(kept.Method, method)
+			}
+		}
+		if len(kept.Method) > 0 {
+			filtered.Service = append(filtered.Service, kept)
+		}
+	}
+	return filtered
+}
+
 // hasStreamingMethods checks if any service in the file has streaming methods
 func hasStreamingMethods(fileDesc *descriptorpb.FileDescriptorProto) bool {
 	for _, service := range fileDesc.GetService() {
@@ -411,21 +591,15 @@ func hasStreamingMethods(fileDesc *descriptorpb.FileDescriptorProto) bool {
 }
 
 func executeJavaScriptTemplate(data *TemplateData) (string, error) {
-	// Load template from embedded file system
-	templateContent, err := jsTemplateFS.ReadFile("templates/client.js.tmpl")
+	// Load the embedded template, or the one of template_dir
+	tmpl, err := loadJavaScriptTemplate(data.Config)
 	if err != nil {
-		return "", fmt.Errorf("failed to read template: %w", err)
-	}
-
-	// Create and parse template
-	tmpl, err := template.New("client.js").Parse(string(templateContent))
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+		return "", err
 	}
 
 	// Execute template
 	var buf strings.Builder
-	if err := tmpl.Execute(&buf, data); err != nil {
+	if err := tmpl.ExecuteTemplate(&buf, clientTemplateName, data); err != nil {
 		return "", fmt.Errorf("failed to execute template: %w", err)
 	}
 
@@ -553,6 +727,7 @@ export class ClientStreamWrapper extends StreamWrapper {
     });
     this._responseCallbacks = [];
     this._errorCallbacks = [];
+    this._closed = false;
     this._setupResponseHandlers();
   }
 
@@ -567,7 +742,10 @@ export class ClientStreamWrapper extends StreamWrapper {
   }
 
   close() {
-    this.stream.end();
+    if (!this._closed) {
+      this._closed = true;
+      this.stream.end();
+    }
     return this;
   }
 
@@ -586,8 +764,9 @@ export class ClientStreamWrapper extends StreamWrapper {
     return this;
   }
 
-  // Promise-based response (for async/await when supported)
+  // Promise-based response (for async/await when supported), closing the stream if needed
   response() {
+    this.close();
     return this._responsePromise;
   }
 
@@ -0,0 +1,299 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestStreamAliasCollision(t *testing.T) {
+	t.Parallel()
+
+	message := &descriptorpb.DescriptorProto{Name: proto.String("Message")}
+	fileDesc := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("chat/v1/chat.proto"),
+		Package:     proto.String("chat.v1"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{message},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("ChatService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:            proto.String("Chat"),
+					InputType:       proto.String(".chat.v1.Message"),
+					OutputType:      proto.String(".chat.v1.Message"),
+					ClientStreaming: proto.Bool(true),
+					ServerStreaming: proto.Bool(true),
+				},
+				{
+					Name:       proto.String("ChatStream"),
+					InputType:  proto.String(".chat.v1.Message"),
+					OutputType: proto.String(".chat.v1.Message"),
+				},
+				{
+					Name:            proto.String("Upload"),
+					InputType:       proto.String(".chat.v1.Message"),
+					OutputType:      proto.String(".chat.v1.Message"),
+					ClientStreaming: proto.Bool(true),
+				},
+			},
+		}},
+	}
+
+	var flagSet flag.FlagSet
+	cfg := RegisterFlags(&flagSet)
+	data := buildTemplateData(fileDesc, cfg, &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{fileDesc},
+	})
+
+	aliases := make(map[string]bool)
+	for _, method := range data.Services[0].Methods {
+		aliases[method.Name] = method.HasStreamAlias
+	}
+	if aliases["Chat"] {
+		t.Error("Chat has the chatStream alias, which collides with the ChatStream method")
+	}
+	if aliases["ChatStream"] {
+		t.Error("the unary ChatStream method has a stream alias")
+	}
+	if !aliases["Upload"] {
+		t.Error("Upload is missing the uploadStream alias")
+	}
+
+	content, err := executeJavaScriptTemplate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for member, want := range map[string]int{
+		"\n  chatStream(":   1,
+		"\n  uploadStream(": 1,
+	} {
+		if got := strings.Count(content, member); got != want {
+			t.Errorf("%s is defined %d times, want %d", strings.TrimSpace(member), got, want)
+		}
+	}
+}
+
+func TestJSDocTypedefs(t *testing.T) {
+	t.Parallel()
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+			JsonName: proto.String(jsonName(name)),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	repeated := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return f
+	}
+
+	fileDesc := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("shop/v1/shop.proto"),
+		Package: proto.String("shop.v1"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATUS_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("STATUS_PAID"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("GetOrderRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("order_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+			{
+				Name: proto.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("total_cents", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+					field("status", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".shop.v1.Status"),
+					repeated(field("items", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".shop.v1.Order.Item")),
+					repeated(field("labels", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".shop.v1.Order.LabelsEntry")),
+					field("created_at", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{
+					{
+						Name:  proto.String("Item"),
+						Field: []*descriptorpb.FieldDescriptorProto{field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")},
+					},
+					{
+						Name:    proto.String("LabelsEntry"),
+						Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+						Field: []*descriptorpb.FieldDescriptorProto{
+							field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+							field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+						},
+					},
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("OrderService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("GetOrder"),
+				InputType:  proto.String(".shop.v1.GetOrderRequest"),
+				OutputType: proto.String(".shop.v1.Order"),
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{6, 0, 2, 0}, LeadingComments: proto.String(" Returns an order\n by its ID.\n")},
+				{Path: []int32{4, 1}, LeadingComments: proto.String(" An order of the shop */\n")},
+				{Path: []int32{4, 1, 2, 0}, LeadingComments: proto.String(" Total in cents\n")},
+				{Path: []int32{4, 1, 3, 0, 2, 0}, LeadingComments: proto.String(" Stock keeping unit\n")},
+			},
+		},
+	}
+
+	var flagSet flag.FlagSet
+	cfg := RegisterFlags(&flagSet)
+	if err := flagSet.Set("field_naming", "proto"); err != nil {
+		t.Fatal(err)
+	}
+	data := buildTemplateData(fileDesc, cfg, &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{fileDesc},
+	})
+	content, err := executeJavaScriptTemplate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		" * @typedef {Object} GetOrderRequest\n * @property {string} [order_id]\n */",
+		" * An order of the shop *\\/\n * @typedef {Object} Order\n" +
+			" * @property {string|number} [totalCents] - Total in cents\n" +
+			" * @property {('STATUS_UNSPECIFIED'|'STATUS_PAID')} [status]\n" +
+			" * @property {Array<Item>} [items]\n" +
+			" * @property {Object<string, boolean>} [labels]\n" +
+			" * @property {string} [createdAt]\n */",
+		" * @typedef {Object} Item\n * @property {string} [sku] - Stock keeping unit\n */",
+		"   * Returns an order by its ID.\n   * @param {GetOrderRequest} request",
+		"@returns {{status: number, message: Order, headers: Object<string, *>, trailers: Object<string, *>}}",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("missing %q in:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "@typedef {Object} LabelsEntry") {
+		t.Error("the map entry has a typedef")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "shop", "v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"shop/v1/shop.k6.js":   "current",
+		"shop/v1/shop.k6.d.ts": "stale",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generated := func(names ...string) *pluginpb.CodeGeneratorResponse {
+		response := &pluginpb.CodeGeneratorResponse{}
+		for _, name := range names {
+			response.File = append(response.File, &pluginpb.CodeGeneratorResponse_File{
+				Name:    proto.String(name),
+				Content: proto.String("current"),
+			})
+		}
+		return response
+	}
+
+	upToDate := generated("shop/v1/shop.k6.js")
+	if err := verifyResponse(upToDate, dir); err != nil {
+		t.Fatal(err)
+	}
+	if upToDate.Error != nil || len(upToDate.File) != 0 {
+		t.Errorf("up to date files: got error %q and %d files to write", upToDate.GetError(), len(upToDate.File))
+	}
+
+	drifted := generated("shop/v1/shop.k6.js", "shop/v1/shop.k6.d.ts", "streaming-wrappers.js")
+	if err := verifyResponse(drifted, dir); err != nil {
+		t.Fatal(err)
+	}
+	want := "generated k6 clients are out of date in " + dir + ", regenerate them: shop/v1/shop.k6.d.ts, streaming-wrappers.js (missing)"
+	if drifted.GetError() != want || len(drifted.File) != 0 {
+		t.Errorf("drifted files: got error %q and %d files to write, want %q", drifted.GetError(), len(drifted.File), want)
+	}
+}
+
+func TestTemplateDir(t *testing.T) {
+	t.Parallel()
+
+	writeTemplates := func(templates map[string]string) string {
+		dir := t.TempDir()
+		for name, content := range templates {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+	data := &TemplateData{
+		File:     FileInfo{Path: "shop/v1/shop.proto"},
+		Services: []ServiceInfo{{Name: "OrderService", Methods: []MethodInfo{{CamelName: "getOrder"}}}},
+	}
+
+	data.Config = &Config{TemplateDir: writeTemplates(map[string]string{
+		"client.js.tmpl": `{{template "auth.tmpl" .}}{{range $s := .Services}}{{range .Methods}}{{$s.Name}}.{{.CamelName}}{{end}}{{end}}`,
+		"auth.tmpl":      `// auth for {{.File.Path}}` + "\n",
+	})}
+	got, err := executeJavaScriptTemplate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "// auth for shop/v1/shop.proto\nOrderService.getOrder"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Unknown fields fail even in the branches the protos don't execute
+	data.Config = &Config{TemplateDir: writeTemplates(map[string]string{
+		"client.js.tmpl": "{{range .Services}}\n{{if .Methods}}{{else}}{{.Methds}}{{end}}{{end}}",
+	})}
+	_, err = executeJavaScriptTemplate(data)
+	if err == nil || !strings.Contains(err.Error(), "client.js.tmpl:2:") ||
+		!strings.Contains(err.Error(), "unknown field Methds, not in the TemplateData contract") {
+		t.Errorf("unknown field: got error %v", err)
+	}
+
+	data.Config = &Config{TemplateDir: writeTemplates(map[string]string{"auth.tmpl": ""})}
+	if _, err = executeJavaScriptTemplate(data); err == nil || !strings.Contains(err.Error(), "invalid template_dir") {
+		t.Errorf("missing client.js.tmpl: got error %v", err)
+	}
+}
@@ -26,6 +26,31 @@ type Config struct {
 	IncludeValidation bool
 	StreamingWrappers bool
 	ExternalWrappers  bool
+	IncludeChecks     bool
+	FieldNaming       string
+	IncludeServices   listFlag
+	ExcludeMethods    listFlag
+	Verify            bool
+	VerifyDir         string
+	TemplateDir       string
+}
+
+// listFlag is a flag of comma-separated values. Since protoc also separates the plugin
+// parameters with commas, the values after the first arrive as parameters of their own.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set appends the values, so that a list split into several parameters is joined back
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
 }
 
 // Default configuration values.
@@ -36,6 +61,11 @@ const (
 	DefaultIncludeValidation = true
 	DefaultStreamingWrappers = true
 	DefaultExternalWrappers  = false
+	DefaultIncludeChecks     = false
+	DefaultFieldNaming       = "json"
+	DefaultVerify            = false
+	DefaultVerifyDir         = "."
+	DefaultTemplateDir       = ""
 )
 
 // RegisterFlags registers all configuration flags and returns a Config pointer.
@@ -84,6 +114,53 @@ func RegisterFlags(flagSet *flag.FlagSet) *Config {
 		"Import wrapper classes from xk6-connectrpc instead of generating inline",
 	)
 
+	flagSet.BoolVar(
+		&cfg.IncludeChecks,
+		"include_checks",
+		DefaultIncludeChecks,
+		"Check the status of every call and generate a registerThresholds helper",
+	)
+
+	flagSet.StringVar(
+		&cfg.FieldNaming,
+		"field_naming",
+		DefaultFieldNaming,
+		"Field names of the generated helpers: 'json' for lowerCamel like Connect-ES, or 'proto'",
+	)
+
+	flagSet.Var(
+		&cfg.IncludeServices,
+		"include_services",
+		"Fully-qualified services to generate clients for, all if not set",
+	)
+
+	flagSet.Var(
+		&cfg.ExcludeMethods,
+		"exclude_methods",
+		"Methods to leave out of the clients, like pkg.Service/Method or pkg.Service.Method",
+	)
+
+	flagSet.BoolVar(
+		&cfg.Verify,
+		"verify",
+		DefaultVerify,
+		"Fail if the files in verify_dir differ from the generated ones, without writing them",
+	)
+
+	flagSet.StringVar(
+		&cfg.VerifyDir,
+		"verify_dir",
+		DefaultVerifyDir,
+		"Output directory of the files checked by verify, relative to the directory protoc or buf runs in",
+	)
+
+	flagSet.StringVar(
+		&cfg.TemplateDir,
+		"template_dir",
+		DefaultTemplateDir,
+		"Directory with a client.js.tmpl overriding the embedded template of the JavaScript clients",
+	)
+
 	return cfg
 }
 
@@ -96,6 +173,13 @@ func (c *Config) Validate() error {
 			c.OutputFormat, strings.Join(validFormats, ", "))
 	}
 
+	// Validate field naming
+	validNamings := []string{"json", "proto"}
+	if !contains(validNamings, c.FieldNaming) {
+		return fmt.Errorf("invalid field_naming %q, must be one of: %s",
+			c.FieldNaming, strings.Join(validNamings, ", "))
+	}
+
 	// Validate client suffix is a valid identifier
 	if !isValidIdentifier(c.ClientSuffix) {
 		return fmt.Errorf("client_suffix %q is not a valid identifier", c.ClientSuffix)
@@ -104,6 +188,21 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// IsListFlag reports whether a flag takes comma-separated values
+func (c *Config) IsListFlag(name string) bool {
+	return name == "include_services" || name == "exclude_methods"
+}
+
+// IncludesService reports whether clients are generated for a fully-qualified service
+func (c *Config) IncludesService(service string) bool {
+	return len(c.IncludeServices) == 0 || contains(c.IncludeServices, service)
+}
+
+// ExcludesMethod reports whether a method of a fully-qualified service is left out
+func (c *Config) ExcludesMethod(service, method string) bool {
+	return contains(c.ExcludeMethods, service+"/"+method) || contains(c.ExcludeMethods, service+"."+method)
+}
+
 // ShouldGenerateJS returns true if JavaScript output should be generated.
 func (c *Config) ShouldGenerateJS() bool {
 	return c.OutputFormat == "js" || c.OutputFormat == "both"
@@ -0,0 +1,147 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"text/template"
+	"text/template/parse"
+)
+
+// clientTemplateName is the template of the JavaScript clients, embedded or in template_dir
+const clientTemplateName = "client.js.tmpl"
+
+// templateContract are the types of the data the client templates are executed with: the
+// fields and methods the templates use must be one of theirs
+var templateContract = []reflect.Type{
+	reflect.TypeOf(&TemplateData{}),
+	reflect.TypeOf(&FileInfo{}),
+	reflect.TypeOf(&ServiceInfo{}),
+	reflect.TypeOf(&MethodInfo{}),
+	reflect.TypeOf(&FieldInfo{}),
+	reflect.TypeOf(&TypedefInfo{}),
+	reflect.TypeOf(&Config{}),
+}
+
+// loadJavaScriptTemplate returns the client template: the embedded one, or the
+// client.js.tmpl of template_dir along with the other templates of the directory, which
+// it can include with {{template "name.tmpl" .}}
+func loadJavaScriptTemplate(cfg *Config) (*template.Template, error) {
+	if cfg == nil || cfg.TemplateDir == "" {
+		templateContent, err := jsTemplateFS.ReadFile("templates/" + clientTemplateName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		tmpl, err := template.New(clientTemplateName).Parse(string(templateContent))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		return tmpl, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.TemplateDir, clientTemplateName)); err != nil {
+		return nil, fmt.Errorf("invalid template_dir: %w", err)
+	}
+	tmpl, err := template.ParseGlob(filepath.Join(cfg.TemplateDir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template_dir: %w", err)
+	}
+	if err := validateTemplate(tmpl); err != nil {
+		return nil, fmt.Errorf("invalid template_dir: %w", err)
+	}
+	return tmpl, nil
+}
+
+// validateTemplate checks that the templates only use the fields and methods of the
+// TemplateData contract, including in the branches the protos at hand don't execute
+func validateTemplate(tmpl *template.Template) error {
+	known := make(map[string]bool)
+	for _, typ := range templateContract {
+		for i := 0; i < typ.NumMethod(); i++ {
+			known[typ.Method(i).Name] = true
+		}
+		for i := 0; i < typ.Elem().NumField(); i++ {
+			known[typ.Elem().Field(i).Name] = true
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		var err error
+		walkTemplate(t.Tree.Root, func(node parse.Node, names []string) {
+			for _, name := range names {
+				if !known[name] && err == nil {
+					location, _ := t.ErrorContext(node)
+					err = fmt.Errorf("%s: unknown field %s, not in the TemplateData contract", location, name)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTemplate calls visit with the field names of every field, chain and variable of a
+// template tree, like Name and Methods for $service.Methods or (.Service).Name
+func walkTemplate(node parse.Node, visit func(node parse.Node, names []string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplate(child, visit)
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, visit)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplate(arg, visit)
+		}
+	case *parse.FieldNode:
+		visit(n, n.Ident)
+	case *parse.ChainNode:
+		walkTemplate(n.Node, visit)
+		visit(n, n.Field)
+	case *parse.VariableNode:
+		visit(n, n.Ident[1:])
+	}
+}
+
+func walkBranch(n *parse.BranchNode, visit func(node parse.Node, names []string)) {
+	walkTemplate(n.Pipe, visit)
+	walkTemplate(n.List, visit)
+	walkTemplate(n.ElseList, visit)
+}
@@ -0,0 +1,60 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// verifyResponse replaces the generated files of the response with an error listing the
+// ones that differ from the files in dir, so that protoc exits non-zero on drift and
+// nothing is written
+func verifyResponse(response *pluginpb.CodeGeneratorResponse, dir string) error {
+	drifted, err := driftedFiles(response.GetFile(), dir)
+	if err != nil {
+		return err
+	}
+
+	response.File = nil
+	if len(drifted) > 0 {
+		response.Error = proto.String(fmt.Sprintf(
+			"generated k6 clients are out of date in %s, regenerate them: %s", dir, strings.Join(drifted, ", ")))
+	}
+	return nil
+}
+
+// driftedFiles returns the names of the generated files missing from dir or with another
+// content, in the order of the response
+func driftedFiles(files []*pluginpb.CodeGeneratorResponse_File, dir string) ([]string, error) {
+	var drifted []string
+	for _, file := range files {
+		existing, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.GetName())))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			drifted = append(drifted, file.GetName()+" (missing)")
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", file.GetName(), err)
+		case string(existing) != file.GetContent():
+			drifted = append(drifted, file.GetName())
+		}
+	}
+	return drifted, nil
+}
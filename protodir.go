@@ -0,0 +1,180 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib/fsext"
+)
+
+// protoDirOptions are the `loadProtoDir()` options
+type protoDirOptions struct {
+	recursive   bool
+	exclude     []string // Glob patterns of the paths to skip, relative to the directory
+	importPaths []string // Additional import paths, after the directory itself
+}
+
+// newProtoDirOptions parses the `loadProtoDir()` options: recursive, exclude and importPaths
+func newProtoDirOptions(options map[string]interface{}) (*protoDirOptions, error) {
+	opts := &protoDirOptions{}
+
+	for k, v := range options {
+		switch k {
+		case "recursive":
+			recursive, ok := v.(bool)
+			if !ok {
+				return nil, errors.New("invalid recursive: must be a boolean")
+			}
+			opts.recursive = recursive
+		case "exclude":
+			patterns, err := toStrings(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude: %w", err)
+			}
+			for _, pattern := range patterns {
+				if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+					return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+				}
+			}
+			opts.exclude = patterns
+		case "importPaths":
+			importPaths, err := toStrings(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid importPaths: %w", err)
+			}
+			opts.importPaths = importPaths
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+
+	return opts, nil
+}
+
+// toStrings converts an exported JS array of strings
+func toStrings(v interface{}) ([]string, error) {
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("must be an array of strings")
+	}
+
+	rtn := make([]string, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("must be an array of strings")
+		}
+		rtn[i] = s
+	}
+	return rtn, nil
+}
+
+// excluded returns whether a path relative to the directory matches an exclude pattern
+func (o *protoDirOptions) excluded(name string) bool {
+	for _, pattern := range o.exclude {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a glob pattern, where `**` matches any
+// number of path segments, including none, and the other segments follow path.Match
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// loadProtoDir loads the .proto files of a directory into the global registry. The directory
+// is the first import path, so the files import each other by their path in the directory.
+func (mi *ModuleInstance) loadProtoDir(dir string, options sobek.Value) ([]MethodInfo, error) {
+	if mi.vu.State() != nil {
+		return nil, errors.New("loadProtoDir must be called in the init context")
+	}
+
+	initEnv := mi.vu.InitEnv()
+	if initEnv == nil {
+		return nil, errors.New("missing init environment")
+	}
+
+	var rawOpts map[string]interface{}
+	if !common.IsNullish(options) {
+		var ok bool
+		if rawOpts, ok = options.Export().(map[string]interface{}); !ok {
+			return nil, errors.New("invalid loadProtoDir options: must be an object")
+		}
+	}
+	opts, err := newProtoDirOptions(rawOpts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid loadProtoDir options: %w", err)
+	}
+
+	dir = strings.TrimPrefix(dir, "file://")
+	root := initEnv.GetAbsFilePath(dir)
+
+	var filenames []string
+	err = fsext.Walk(initEnv.FileSystems["file"], root, func(filePath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			if !opts.recursive || opts.excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if path.Ext(rel) == ".proto" && !opts.excluded(rel) {
+			filenames = append(filenames, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read proto directory %s: %w", dir, err)
+	}
+
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no .proto files found in %s", dir)
+	}
+
+	importPaths := append([]string{dir}, opts.importPaths...)
+	return globalProtoRegistry.loadProtos(mi.vu, importPaths, filenames...)
+}
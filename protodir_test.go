@@ -0,0 +1,32 @@
+package connectrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"**/internal/**", "greet/v1/internal/admin.proto", true},
+		{"**/internal/**", "internal/admin.proto", true},
+		{"**/internal/**", "greet/v1/internal", true},
+		{"**/internal/**", "greet/v1/internals/admin.proto", false},
+		{"*.proto", "greet.proto", true},
+		{"*.proto", "greet/v1/greet.proto", false},
+		{"**/*.proto", "greet/v1/greet.proto", true},
+		{"greet/**/greet.proto", "greet/greet.proto", true},
+		{"greet/v?/*_test.proto", "greet/v1/greet_test.proto", true},
+		{"greet/v?/*_test.proto", "greet/v10/greet_test.proto", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.match, matchGlob(tc.pattern, tc.name), "%s against %s", tc.name, tc.pattern)
+	}
+}
@@ -0,0 +1,41 @@
+package connectrpc
+
+import (
+	"fmt"
+
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib"
+)
+
+// rampingDownScenario returns the scenario of the VU when it is past its regular duration,
+// in its gracefulStop: the executors report a progress of 1 once the duration is over,
+// while the iterations still running get to finish. It returns "" otherwise.
+func rampingDownScenario(vu modules.VU) string {
+	ss := lib.GetScenarioState(vu.Context())
+	if ss == nil || ss.ProgressFn == nil {
+		return ""
+	}
+	if progress, _ := ss.ProgressFn(); progress < 1 {
+		return ""
+	}
+	return ss.Name
+}
+
+// rampingDown reports whether the scenario of the VU is ramping down, for scripts to
+// stop starting work during the gracefulStop
+func (mi *ModuleInstance) rampingDown() bool {
+	return rampingDownScenario(mi.vu) != ""
+}
+
+// checkRampDown fails the new calls and streams while the scenario is ramping down,
+// with the rampDown: 'reject' global option. The calls and streams already in flight
+// are left to finish.
+func (c *Client) checkRampDown() error {
+	if c.defaults == nil || !c.defaults.rejectRampDown {
+		return nil
+	}
+	if scenario := rampingDownScenario(c.vu); scenario != "" {
+		return fmt.Errorf("ramping down: scenario %q is past its duration, no new calls or streams are started", scenario)
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+package connectrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// maxRecordedBody is the size of the request body a Recorder keeps to decode its
+	// messages, beyond which the call is recorded without them
+	maxRecordedBody = 16 * 1024 * 1024
+	// maxRecorderCalls is the number of calls a Recorder keeps, the first ones
+	maxRecorderCalls = 10000
+	// reflectionTimeout bounds the server reflection requests of a Recorder
+	reflectionTimeout = 10 * time.Second
+)
+
+// unrecordedHeaders are the request headers left out of the recorded calls: the ones of
+// the protocols and transports, which the client sets itself, and the credentials, which
+// mustn't end up in the scripts
+var unrecordedHeaders = map[string]bool{
+	"Accept-Encoding":          true,
+	"Authorization":            true,
+	"Connect-Accept-Encoding":  true,
+	"Connect-Content-Encoding": true,
+	"Connect-Protocol-Version": true,
+	"Connect-Timeout-Ms":       true,
+	"Content-Encoding":         true,
+	"Content-Length":           true,
+	"Content-Type":             true,
+	"Cookie":                   true,
+	"Grpc-Accept-Encoding":     true,
+	"Grpc-Encoding":            true,
+	"Grpc-Timeout":             true,
+	"Proxy-Authorization":      true,
+	"Te":                       true,
+	"User-Agent":               true,
+	"X-Forwarded-For":          true,
+	"X-Forwarded-Host":         true,
+	"X-Forwarded-Proto":        true,
+	"X-Grpc-Web":               true,
+	"X-User-Agent":             true,
+}
+
+// RecordedCall is a call recorded by a Recorder
+type RecordedCall struct {
+	Method    string            // Path of the method, like /package.Service/Method
+	Protocol  string            // connect, grpc or grpc-web
+	Codec     string            // proto or json
+	Streaming bool              // Whether the method streams, or the call is a Connect stream when its method is unknown
+	Header    http.Header       // Headers of the application, without the protocol and credential ones
+	Requests  []json.RawMessage // Request messages in protojson, nil when DecodeErr is set
+	DecodeErr error             // Why the request messages couldn't be decoded
+	Code      connect.Code      // Code of the response, 0 for OK
+	Time      time.Time         // Start of the call
+}
+
+// Recorder is a reverse proxy to a server recording the Connect, gRPC and gRPC-Web calls
+// passing through it, to bootstrap a load test from a manual session: the application
+// under test is pointed at the proxy, and WriteScript turns the recorded calls into a k6
+// script. The request messages are decoded with the descriptors of its registry, and of
+// the server reflection of the target with WithReflection. Like any handler, it needs
+// h2c.NewHandler or TLS to serve the gRPC clients, which require HTTP/2.
+type Recorder struct {
+	target     *url.URL
+	registry   *dynamic.Registry
+	reflection bool
+	tlsConfig  *tls.Config
+	transport  http.RoundTripper
+	proxy      *httputil.ReverseProxy
+
+	reflectMu sync.Mutex
+	reflected map[string]error // Result of the reflection requests, by service
+
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+// RecorderOption configures a Recorder
+type RecorderOption func(*Recorder)
+
+// WithRecorderRegistry decodes the request messages with the descriptors of a registry,
+// an empty one by default
+func WithRecorderRegistry(registry *dynamic.Registry) RecorderOption {
+	return func(r *Recorder) {
+		r.registry = registry
+	}
+}
+
+// WithReflection requests the descriptors of the services missing from the registry from
+// the gRPC server reflection (v1) of the target, and adds them to the registry
+func WithReflection() RecorderOption {
+	return func(r *Recorder) {
+		r.reflection = true
+	}
+}
+
+// WithRecorderTLSConfig sets the TLS configuration of the connections to an https target
+func WithRecorderTLSConfig(config *tls.Config) RecorderOption {
+	return func(r *Recorder) {
+		r.tlsConfig = config
+	}
+}
+
+// NewRecorder creates a Recorder forwarding the calls to target, an http (h2c) or https
+// URL. The calls are forwarded over HTTP/2, which gRPC requires.
+func NewRecorder(target string, opts ...RecorderOption) (*Recorder, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid target %q: must be an http or https URL", target)
+	}
+
+	r := &Recorder{
+		target:    u,
+		registry:  dynamic.NewRegistry(),
+		reflected: make(map[string]error),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	transport := &http2.Transport{TLSClientConfig: r.tlsConfig}
+	if u.Scheme == "http" {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	r.transport = transport
+
+	r.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(r.target)
+		},
+		Transport:      r.transport,
+		FlushInterval:  -1, // Streams are forwarded as they go
+		ModifyResponse: r.recordResponse,
+	}
+	return r, nil
+}
+
+// ServeHTTP forwards a request to the target, recording it if it is a call
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if rec := newRecording(req); rec != nil {
+		req.Body = &recordedRequest{ReadCloser: req.Body, rec: rec}
+		req = req.WithContext(context.WithValue(req.Context(), recordingKey{}, rec))
+	}
+	r.proxy.ServeHTTP(w, req)
+}
+
+// Calls returns the calls recorded so far, up to the first maxRecorderCalls
+func (r *Recorder) Calls() []RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RecordedCall(nil), r.calls...)
+}
+
+// recordingKey is the context key of the recording of a forwarded request
+type recordingKey struct{}
+
+// recording is a call being recorded, from its request to the end of its response
+type recording struct {
+	call      RecordedCall
+	enveloped bool   // Whether the messages are enveloped, in streams and with gRPC
+	encoding  string // Compression of the request messages
+
+	mu       sync.Mutex // Guards request, which the transport may still read once the response ended
+	request  []byte
+	overflow bool // Whether the request is larger than maxRecordedBody
+
+	responseTail       []byte // Frame ending a stream, or body of a Connect unary error
+	responseCompressed bool
+	envelopeScanner
+}
+
+// newRecording starts recording a request, nil if it isn't a call of a supported protocol.
+// Connect GET requests and gRPC-Web text are forwarded without being recorded.
+func newRecording(req *http.Request) *recording {
+	if req.Method != http.MethodPost {
+		return nil
+	}
+	contentType, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";")
+	contentType = strings.TrimSpace(contentType)
+
+	rec := &recording{encoding: responseEncoding(req.Header)}
+	var codec string
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web-text"):
+		return nil
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		rec.call.Protocol, rec.enveloped = "grpc-web", true
+		codec = strings.TrimPrefix(strings.TrimPrefix(contentType, "application/grpc-web"), "+")
+	case strings.HasPrefix(contentType, "application/grpc"):
+		rec.call.Protocol, rec.enveloped = "grpc", true
+		codec = strings.TrimPrefix(strings.TrimPrefix(contentType, "application/grpc"), "+")
+	case strings.HasPrefix(contentType, "application/connect+"):
+		rec.call.Protocol, rec.enveloped = "connect", true
+		rec.call.Streaming = true
+		codec = strings.TrimPrefix(contentType, "application/connect+")
+	case contentType == "application/json" || contentType == "application/proto":
+		rec.call.Protocol = "connect"
+		codec = strings.TrimPrefix(contentType, "application/")
+	default:
+		return nil
+	}
+
+	rec.call.Codec = "proto"
+	if codec == "json" {
+		rec.call.Codec = "json"
+	}
+	rec.call.Method = req.URL.Path
+	rec.call.Time = time.Now()
+	rec.call.Header = make(http.Header)
+	for key, values := range req.Header {
+		if !unrecordedHeaders[key] {
+			rec.call.Header[key] = append([]string(nil), values...)
+		}
+	}
+	return rec
+}
+
+// recordedRequest is a request body keeping its bytes, up to maxRecordedBody
+type recordedRequest struct {
+	io.ReadCloser
+	rec *recording
+}
+
+func (b *recordedRequest) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.rec.mu.Lock()
+		if len(b.rec.request)+n > maxRecordedBody {
+			b.rec.overflow = true
+		} else {
+			b.rec.request = append(b.rec.request, p[:n]...)
+		}
+		b.rec.mu.Unlock()
+	}
+	return n, err
+}
+
+// recordResponse wraps the body of the response of a recorded call, which is recorded
+// once the body is closed
+func (r *Recorder) recordResponse(resp *http.Response) error {
+	rec, _ := resp.Request.Context().Value(recordingKey{}).(*recording)
+	if rec == nil {
+		return nil
+	}
+	resp.Body = &recordedResponse{ReadCloser: resp.Body, recorder: r, rec: rec, resp: resp}
+	return nil
+}
+
+// recordedResponse is a response body keeping the payload carrying the status of the
+// call, like captureWireError
+type recordedResponse struct {
+	io.ReadCloser
+	recorder *Recorder
+	rec      *recording
+	resp     *http.Response
+	once     sync.Once
+}
+
+func (b *recordedResponse) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	rec := b.rec
+	switch {
+	case rec.call.Protocol == "grpc":
+	case rec.enveloped:
+		endFlag := byte(connectFlagEndStream)
+		if rec.call.Protocol == "grpc-web" {
+			endFlag = grpcWebFlagTrailer
+		}
+		rec.scan(p[:n], func(flags byte, payload []byte) {
+			if flags&endFlag != 0 && len(rec.responseTail)+len(payload) <= maxWireErrorSize {
+				rec.responseTail = append(rec.responseTail, payload...)
+				rec.responseCompressed = flags&envelopeFlagCompress != 0
+			}
+		})
+	case b.resp.StatusCode != http.StatusOK:
+		if room := maxWireErrorSize - len(rec.responseTail); room > 0 {
+			rec.responseTail = append(rec.responseTail, p[:min(room, n)]...)
+		}
+	}
+	return n, err
+}
+
+func (b *recordedResponse) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.recorder.finish(b.rec, b.resp)
+	})
+	return err
+}
+
+// finish records a call once its response ended
+func (r *Recorder) finish(rec *recording, resp *http.Response) {
+	call := rec.call
+	call.Code = rec.responseCode(resp)
+
+	methodDesc, err := r.methodDescriptor(call.Method)
+	if methodDesc != nil {
+		call.Streaming = methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer()
+	}
+	call.Requests, call.DecodeErr = rec.decodeRequests(methodDesc, err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.calls) < maxRecorderCalls {
+		r.calls = append(r.calls, call)
+	}
+}
+
+// responseCode returns the code of the response of a call
+func (rec *recording) responseCode(resp *http.Response) connect.Code {
+	payload := rec.responseTail
+	if rec.responseCompressed || (!rec.enveloped && responseEncoding(resp.Header) != compressionIdentity) {
+		payload = decompressWireError(payload, resp.Header)
+	}
+
+	switch {
+	case rec.call.Protocol == "grpc":
+		code, _ := grpcStatus(resp.Trailer, resp.Header)
+		return parseGRPCCode(code)
+	case rec.call.Protocol == "grpc-web":
+		code, _ := grpcStatus(parseGRPCWebTrailers(payload), resp.Header)
+		return parseGRPCCode(code)
+	case rec.enveloped:
+		var end struct {
+			Error *connectWireError `json:"error"`
+		}
+		if err := json.Unmarshal(payload, &end); err != nil {
+			return connect.CodeUnknown
+		}
+		if end.Error == nil {
+			return 0
+		}
+		return parseConnectCode(end.Error.Code)
+	case resp.StatusCode == http.StatusOK:
+		return 0
+	default:
+		var unary connectWireError
+		if err := json.Unmarshal(payload, &unary); err != nil {
+			return connect.CodeUnknown
+		}
+		return parseConnectCode(unary.Code)
+	}
+}
+
+// parseGRPCCode parses a grpc-status, unknown if it is missing or invalid
+func parseGRPCCode(status string) connect.Code {
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 0 || code > int(connect.CodeUnauthenticated) {
+		return connect.CodeUnknown
+	}
+	return connect.Code(code)
+}
+
+// parseConnectCode parses the code of a Connect error, like not_found
+func parseConnectCode(name string) connect.Code {
+	var code connect.Code
+	if err := code.UnmarshalText([]byte(name)); err != nil {
+		return connect.CodeUnknown
+	}
+	return code
+}
+
+// decodeRequests returns the request messages of a call in protojson. Without the
+// descriptor of the method, the JSON messages are kept as they are.
+func (rec *recording) decodeRequests(methodDesc protoreflect.MethodDescriptor, descErr error) ([]json.RawMessage, error) {
+	rec.mu.Lock()
+	data, overflow := rec.request, rec.overflow
+	rec.mu.Unlock()
+	if overflow {
+		return nil, fmt.Errorf("the request is larger than %d bytes", maxRecordedBody)
+	}
+
+	var payloads [][]byte
+	if rec.enveloped {
+		// A last envelope cut short, when the call was canceled, is left out
+		for len(data) >= 5 {
+			flags, size := data[0], binary.BigEndian.Uint32(data[1:5])
+			if uint64(len(data)-5) < uint64(size) {
+				break
+			}
+			payload := data[5 : 5+size]
+			data = data[5+size:]
+			if flags&envelopeFlagCompress != 0 {
+				var err error
+				if payload, err = decompress(payload, rec.encoding, maxRecordedBody); err != nil {
+					return nil, err
+				}
+			}
+			payloads = append(payloads, payload)
+		}
+	} else {
+		if rec.encoding != compressionIdentity {
+			var err error
+			if data, err = decompress(data, rec.encoding, maxRecordedBody); err != nil {
+				return nil, err
+			}
+		}
+		payloads = append(payloads, data)
+	}
+
+	messages := make([]json.RawMessage, 0, len(payloads))
+	for _, payload := range payloads {
+		if methodDesc == nil {
+			if rec.call.Codec != "json" || !json.Valid(payload) {
+				return nil, descErr
+			}
+			messages = append(messages, payload)
+			continue
+		}
+
+		msg := dynamicpb.NewMessage(methodDesc.Input())
+		var err error
+		if rec.call.Codec == "json" {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(payload, msg)
+		} else {
+			err = proto.Unmarshal(payload, msg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode the request: %w", err)
+		}
+		message, err := protojson.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// methodDescriptor returns the descriptor of a method from the registry, requesting it
+// from the server reflection of the target the first time if it is missing
+func (r *Recorder) methodDescriptor(method string) (protoreflect.MethodDescriptor, error) {
+	methodDesc, err := r.registry.MethodDescriptor(method)
+	if err == nil || !r.reflection {
+		return methodDesc, err
+	}
+
+	service, _ := dynamic.SplitMethod(method)
+
+	r.reflectMu.Lock()
+	defer r.reflectMu.Unlock()
+
+	reflectErr, ok := r.reflected[service]
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), reflectionTimeout)
+		defer cancel()
+
+		fdset, fetchErr := fetchReflectedFiles(ctx, &http.Client{Transport: r.transport}, r.target.String(), service)
+		if fetchErr == nil {
+			_, fetchErr = r.registry.Register(fdset)
+		}
+		reflectErr = fetchErr
+		r.reflected[service] = reflectErr
+	}
+	if reflectErr != nil {
+		return nil, fmt.Errorf("%w, and server reflection failed: %w", err, reflectErr)
+	}
+	return r.registry.MethodDescriptor(method)
+}
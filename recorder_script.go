@@ -0,0 +1,232 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// recordedScript is the k6 script WriteScript writes
+var recordedScript = template.Must(template.New("script.js").Funcs(template.FuncMap{
+	"js": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}).Parse(`// Replays the calls recorded from {{.Target}}. Set TARGET to replay them against another
+// server. The credentials aren't recorded: set them with client.setDefaultHeaders().
+import { check } from 'k6';
+import connectrpc from 'k6/x/connectrpc';
+
+{{if .Protoset}}connectrpc.loadProtoset('./{{.Protoset}}');
+{{else}}// The methods are unknown: load their protos, like connectrpc.loadProtos(['protos'], 'service.proto')
+{{end}}
+const target = __ENV.TARGET || {{js .Target}};
+const payloads = [
+{{- range .Calls}}
+    {{if .Payload}}JSON.parse(open('./{{.Payload}}')){{else}}null{{end}},
+{{- end}}
+];
+
+const client = new connectrpc.Client();
+
+export const options = {
+    vus: 1,
+    iterations: 1,
+};
+{{if .Streams}}
+// replayStream writes the recorded messages of a stream and resolves with its code
+function replayStream(method, messages, params) {
+    return new Promise((resolve) => {
+        const stream = new connectrpc.Stream(client, method, params);
+        stream.on('end', () => resolve('ok'));
+        stream.on('error', (e) => resolve(e.code));
+        for (const message of messages) {
+            stream.write(message);
+        }
+        stream.end();
+    });
+}
+{{end}}
+export default {{if .Streams}}async {{end}}function () {
+    client.connect(target, {
+        protocol: {{js .Protocol}},
+        contentType: {{js .ContentType}},
+        plaintext: target.startsWith('http://'),
+{{- if .Headers}}
+        headers: {{js .Headers}},
+{{- end}}
+    });
+{{range $i, $call := .Calls}}
+    // {{$call.Number}}. {{$call.Method}}
+{{- if $call.DecodeErr}}
+    // Not replayed, its messages couldn't be decoded: {{$call.DecodeErr}}
+{{- else if $call.Streaming}}
+    const code{{$call.Number}} = await replayStream({{js $call.Method}}, payloads[{{$i}}]{{if $call.Headers}}, { headers: {{js $call.Headers}} }{{end}});
+    check(code{{$call.Number}}, { {{js $call.Check}}: (code) => code === {{js $call.Code}} });
+{{- else}}
+    const res{{$call.Number}} = client.invoke({{js $call.Method}}, payloads[{{$i}}]{{if $call.Headers}}, { headers: {{js $call.Headers}} }{{end}});
+    check(res{{$call.Number}}, { {{js $call.Check}}: (r) => r.status === {{$call.Status}} });
+{{- end}}
+{{end -}}
+}
+`))
+
+// scriptCall is a call of the recorded script
+type scriptCall struct {
+	Number    int
+	Method    string
+	Streaming bool
+	Headers   map[string]string // Headers of the call beyond the common ones
+	Payload   string            // Path of its payload file
+	DecodeErr error
+	Code      string
+	Status    int
+	Check     string
+}
+
+// WriteScript writes a k6 script replaying the recorded calls in order to dir, as
+// script.js, with their request messages in payloads/ and the descriptors of their
+// methods in protos.binpb. The headers shared by all the calls are set on connect(), and
+// the protocol and codec are the ones of the first call.
+func (r *Recorder) WriteScript(dir string) error {
+	calls := r.Calls()
+	if len(calls) == 0 {
+		return errors.New("no calls were recorded")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "payloads"), 0o755); err != nil { //nolint:gosec
+		return err
+	}
+
+	common := commonHeaders(calls)
+	data := struct {
+		Target      string
+		Protocol    string
+		ContentType string
+		Headers     map[string]string
+		Protoset    string
+		Calls       []scriptCall
+		Streams     bool
+	}{
+		Target:      r.target.String(),
+		Protocol:    calls[0].Protocol,
+		ContentType: "application/" + calls[0].Codec,
+		Headers:     common,
+	}
+
+	var methods []protoreflect.MethodDescriptor
+	for i, call := range calls {
+		_, procedure := dynamic.SplitMethod(call.Method)
+		sc := scriptCall{
+			Number:    i + 1,
+			Method:    call.Method,
+			Streaming: call.Streaming,
+			Headers:   make(map[string]string),
+			DecodeErr: call.DecodeErr,
+			Code:      codeName(call.Code),
+			Status:    dynamic.HTTPStatus(call.Code),
+		}
+		sc.Check = fmt.Sprintf("%d. %s is %s", sc.Number, procedure, sc.Code)
+		for key := range call.Header {
+			if _, ok := common[key]; !ok {
+				sc.Headers[key] = call.Header.Get(key)
+			}
+		}
+
+		if call.DecodeErr == nil {
+			var payload interface{} = call.Requests
+			if !call.Streaming && len(call.Requests) == 1 {
+				payload = call.Requests[0]
+			}
+			content, err := json.MarshalIndent(payload, "", "  ")
+			if err != nil {
+				return err
+			}
+			sc.Payload = path.Join("payloads", fmt.Sprintf("%03d-%s.json", sc.Number, procedure))
+			if err := os.WriteFile(filepath.Join(dir, sc.Payload), append(content, '\n'), 0o644); err != nil { //nolint:gosec
+				return err
+			}
+			data.Streams = data.Streams || call.Streaming
+			if methodDesc, err := r.registry.MethodDescriptor(call.Method); err == nil {
+				methods = append(methods, methodDesc)
+			}
+		}
+		data.Calls = append(data.Calls, sc)
+	}
+
+	if len(methods) > 0 {
+		protoset, err := proto.Marshal(methodsFileSet(methods))
+		if err != nil {
+			return err
+		}
+		data.Protoset = "protos.binpb"
+		if err := os.WriteFile(filepath.Join(dir, data.Protoset), protoset, 0o644); err != nil { //nolint:gosec
+			return err
+		}
+	}
+
+	var script strings.Builder
+	if err := recordedScript.Execute(&script, data); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "script.js"), []byte(script.String()), 0o644) //nolint:gosec
+}
+
+// commonHeaders returns the headers all the calls have with the same value
+func commonHeaders(calls []RecordedCall) map[string]string {
+	common := make(map[string]string)
+	for key := range calls[0].Header {
+		common[key] = calls[0].Header.Get(key)
+	}
+	for _, call := range calls[1:] {
+		for key, value := range common {
+			if call.Header.Get(key) != value {
+				delete(common, key)
+			}
+		}
+	}
+	return common
+}
+
+// methodsFileSet returns the files defining methods and their imports, imports first
+func methodsFileSet(methods []protoreflect.MethodDescriptor) *descriptorpb.FileDescriptorSet {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if added[fd.Path()] {
+			return
+		}
+		added[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	for _, methodDesc := range methods {
+		add(methodDesc.ParentFile())
+	}
+	return fdset
+}
+
+// codeName returns the name of a code, like not_found, and ok for 0
+func codeName(code connect.Code) string {
+	if code == 0 {
+		return "ok"
+	}
+	return code.String()
+}
@@ -0,0 +1,347 @@
+package connectrpc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bufbuild/protocompile"
+	connectrpc "github.com/bumberboy/xk6-connectrpc"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newPingRegistry returns a registry with ping.proto loaded
+func newPingRegistry(t *testing.T) *dynamic.Registry {
+	t.Helper()
+
+	registry := dynamic.NewRegistry()
+	_, err := registry.LoadProtos(context.Background(), []string{"testdata"}, nil, "ping/v1/ping.proto")
+	require.NoError(t, err)
+	return registry
+}
+
+// newRecorderProxy serves a recorder over HTTP/1.1 and h2c
+func newRecorderProxy(t *testing.T, recorder *connectrpc.Recorder) *httptest.Server {
+	t.Helper()
+
+	proxy := httptest.NewServer(h2c.NewHandler(recorder, &http2.Server{}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// pingClient calls the methods of ping.proto on a server over h2c, with dynamic messages
+type pingClient struct {
+	httpClient *http.Client
+	registry   *dynamic.Registry
+	url        string
+	options    []connect.ClientOption
+}
+
+// newH2CClient returns a client of the ping methods of a server, over h2c
+func newH2CClient(t *testing.T, url string, options ...connect.ClientOption) *pingClient {
+	t.Helper()
+
+	httpClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+	return &pingClient{httpClient: httpClient, registry: newPingRegistry(t), url: url, options: options}
+}
+
+// client returns the connect client of a method
+func (c *pingClient) client(
+	method string,
+) (*connect.Client[dynamicpb.Message, dynamicpb.Message], protoreflect.MethodDescriptor, error) {
+	methodDesc, err := c.registry.MethodDescriptor(method)
+	if err != nil {
+		return nil, nil, err
+	}
+	options := append([]connect.ClientOption{
+		connect.WithSchema(methodDesc),
+		connect.WithResponseInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(methodDesc.Output())
+			return nil
+		}),
+	}, c.options...)
+	return connect.NewClient[dynamicpb.Message, dynamicpb.Message](c.httpClient, c.url+method, options...), methodDesc, nil
+}
+
+// invoke calls a unary method with a request in JSON
+func (c *pingClient) invoke(method, reqJSON string, header http.Header) error {
+	client, methodDesc, err := c.client(method)
+	if err != nil {
+		return err
+	}
+	req := dynamicpb.NewMessage(methodDesc.Input())
+	if err := protojson.Unmarshal([]byte(reqJSON), req); err != nil {
+		return err
+	}
+
+	connectReq := connect.NewRequest(req)
+	for key, values := range header {
+		connectReq.Header()[key] = values
+	}
+	_, err = client.CallUnary(context.Background(), connectReq)
+	return err
+}
+
+// waitCalls waits for a recorder to record n calls, which it does once the proxy closed
+// the response, possibly after the client received it
+func waitCalls(t *testing.T, recorder *connectrpc.Recorder, n int) []connectrpc.RecordedCall {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return len(recorder.Calls()) == n
+	}, 5*time.Second, 5*time.Millisecond)
+	return recorder.Calls()
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	recorder, err := connectrpc.NewRecorder(srv.URL, connectrpc.WithRecorderRegistry(newPingRegistry(t)))
+	require.NoError(t, err)
+	proxy := newRecorderProxy(t, recorder)
+
+	session := http.Header{"X-Session": []string{"qa"}}
+	header := http.Header{"X-Session": []string{"qa"}, "X-Tenant": []string{"acme"}, "Authorization": []string{"Bearer secret"}}
+
+	grpcClient := newH2CClient(t, proxy.URL, connect.WithGRPC())
+	err = grpcClient.invoke("/k6.connectrpc.ping.v1.PingService/Ping", `{"number": 42, "text": "hi"}`, header)
+	require.NoError(t, err)
+	waitCalls(t, recorder, 1)
+
+	connectClient := newH2CClient(t, proxy.URL, connect.WithProtoJSON())
+	err = connectClient.invoke("/k6.connectrpc.ping.v1.PingService/Fail", `{"code": 5}`, session)
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	waitCalls(t, recorder, 2)
+
+	webClient, methodDesc, err := newH2CClient(t, proxy.URL, connect.WithGRPCWeb()).client("/k6.connectrpc.ping.v1.PingService/Sum")
+	require.NoError(t, err)
+	stream := webClient.CallBidiStream(context.Background())
+	stream.RequestHeader().Set("X-Session", "qa")
+	for i := int64(1); i <= 3; i++ {
+		req := dynamicpb.NewMessage(methodDesc.Input())
+		req.Set(methodDesc.Input().Fields().ByName("number"), protoreflect.ValueOfInt64(i))
+		require.NoError(t, stream.Send(req))
+	}
+	require.NoError(t, stream.CloseRequest())
+	_, err = stream.Receive()
+	require.NoError(t, err)
+	_, err = stream.Receive()
+	require.ErrorIs(t, err, io.EOF)
+	require.NoError(t, stream.CloseResponse())
+
+	calls := waitCalls(t, recorder, 3)
+
+	assert.Equal(t, "/k6.connectrpc.ping.v1.PingService/Ping", calls[0].Method)
+	assert.Equal(t, "grpc", calls[0].Protocol)
+	assert.Equal(t, "proto", calls[0].Codec)
+	assert.False(t, calls[0].Streaming)
+	require.Len(t, calls[0].Requests, 1)
+	assert.JSONEq(t, `{"number": "42", "text": "hi"}`, string(calls[0].Requests[0]))
+	assert.Equal(t, connect.Code(0), calls[0].Code)
+	assert.Equal(t, "acme", calls[0].Header.Get("X-Tenant"))
+	assert.Empty(t, calls[0].Header.Get("Authorization"))
+	assert.Empty(t, calls[0].Header.Get("Content-Type"))
+
+	assert.Equal(t, "connect", calls[1].Protocol)
+	assert.Equal(t, "json", calls[1].Codec)
+	require.Len(t, calls[1].Requests, 1)
+	assert.JSONEq(t, `{"code": 5}`, string(calls[1].Requests[0]))
+	assert.Equal(t, connect.CodeNotFound, calls[1].Code)
+
+	assert.Equal(t, "grpc-web", calls[2].Protocol)
+	assert.True(t, calls[2].Streaming)
+	require.Len(t, calls[2].Requests, 3)
+	assert.JSONEq(t, `{"number": "3"}`, string(calls[2].Requests[2]))
+	assert.Equal(t, connect.Code(0), calls[2].Code)
+
+	dir := t.TempDir()
+	require.NoError(t, recorder.WriteScript(dir))
+
+	script, err := os.ReadFile(filepath.Join(dir, "script.js")) //nolint:forbidigo
+	require.NoError(t, err)
+	for _, expected := range []string{
+		`connectrpc.loadProtoset('./protos.binpb');`,
+		`const target = __ENV.TARGET || "` + srv.URL + `";`,
+		`JSON.parse(open('./payloads/001-Ping.json')),`,
+		`protocol: "grpc",`,
+		`headers: {"X-Session":"qa"},`,
+		`const res1 = client.invoke("/k6.connectrpc.ping.v1.PingService/Ping", payloads[0], { headers: {"X-Tenant":"acme"} });`,
+		`check(res2, { "2. Fail is not_found": (r) => r.status === 404 });`,
+		`const code3 = await replayStream("/k6.connectrpc.ping.v1.PingService/Sum", payloads[2]);`,
+		`check(code3, { "3. Sum is ok": (code) => code === "ok" });`,
+	} {
+		assert.Contains(t, string(script), expected)
+	}
+	assert.NotContains(t, string(script), "secret")
+
+	payload, err := os.ReadFile(filepath.Join(dir, "payloads", "003-Sum.json")) //nolint:forbidigo
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"number": "1"}, {"number": "2"}, {"number": "3"}]`, string(payload))
+
+	protoset, err := os.ReadFile(filepath.Join(dir, "protos.binpb")) //nolint:forbidigo
+	require.NoError(t, err)
+	_, err = dynamic.NewRegistry().LoadProtoset(protoset)
+	require.NoError(t, err)
+}
+
+func TestRecorderReflection(t *testing.T) {
+	t.Parallel()
+
+	// A gRPC server with the reflection of ping.proto, but no PingService
+	compiler := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"testdata"}}),
+	}
+	fds, err := compiler.Compile(context.Background(), "ping/v1/ping.proto")
+	require.NoError(t, err)
+	files := new(protoregistry.Files)
+	var register func(fd protoreflect.FileDescriptor)
+	register = func(fd protoreflect.FileDescriptor) {
+		for i := 0; i < fd.Imports().Len(); i++ {
+			register(fd.Imports().Get(i).FileDescriptor)
+		}
+		if _, err := files.FindFileByPath(fd.Path()); err != nil {
+			require.NoError(t, files.RegisterFile(fd))
+		}
+	}
+	register(fds[0])
+
+	server := grpc.NewServer()
+	reflectionpb.RegisterServerReflectionServer(server,
+		reflection.NewServerV1(reflection.ServerOptions{Services: server, DescriptorResolver: files}))
+	srv := httptest.NewServer(h2c.NewHandler(server, &http2.Server{}))
+	t.Cleanup(srv.Close)
+
+	recorder, err := connectrpc.NewRecorder(srv.URL, connectrpc.WithReflection())
+	require.NoError(t, err)
+	proxy := newRecorderProxy(t, recorder)
+
+	client := newH2CClient(t, proxy.URL, connect.WithGRPC())
+	err = client.invoke("/k6.connectrpc.ping.v1.PingService/Ping", `{"number": 7}`, nil)
+	require.Equal(t, connect.CodeUnimplemented, connect.CodeOf(err))
+	err = client.invoke("/k6.connectrpc.other.v1.OtherService/Get", `{}`, nil)
+	require.Error(t, err)
+
+	calls := waitCalls(t, recorder, 1)
+	require.NoError(t, calls[0].DecodeErr)
+	assert.JSONEq(t, `{"number": "7"}`, string(calls[0].Requests[0]))
+	assert.Equal(t, connect.CodeUnimplemented, calls[0].Code)
+
+	dir := t.TempDir()
+	require.NoError(t, recorder.WriteScript(dir))
+	script, err := os.ReadFile(filepath.Join(dir, "script.js")) //nolint:forbidigo
+	require.NoError(t, err)
+	assert.Contains(t, string(script), `check(res1, { "1. Ping is unimplemented": (r) => r.status === 501 });`)
+}
+
+func TestRecorderUnknownMethod(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	// Without descriptors, the JSON messages are kept as they are
+	recorder, err := connectrpc.NewRecorder(srv.URL)
+	require.NoError(t, err)
+	proxy := newRecorderProxy(t, recorder)
+
+	err = newH2CClient(t, proxy.URL, connect.WithProtoJSON()).
+		invoke("/k6.connectrpc.ping.v1.PingService/Ping", `{"text": "hi"}`, nil)
+	require.NoError(t, err)
+	waitCalls(t, recorder, 1)
+	err = newH2CClient(t, proxy.URL).
+		invoke("/k6.connectrpc.ping.v1.PingService/Ping", `{"text": "hi"}`, nil)
+	require.NoError(t, err)
+
+	calls := waitCalls(t, recorder, 2)
+	require.NoError(t, calls[0].DecodeErr)
+	assert.JSONEq(t, `{"text": "hi"}`, string(calls[0].Requests[0]))
+	require.ErrorIs(t, calls[1].DecodeErr, dynamic.ErrNoProtos)
+	assert.Nil(t, calls[1].Requests)
+
+	dir := t.TempDir()
+	require.NoError(t, recorder.WriteScript(dir))
+	script, err := os.ReadFile(filepath.Join(dir, "script.js")) //nolint:forbidigo
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "// The methods are unknown: load their protos")
+	assert.Contains(t, string(script), "// Not replayed, its messages couldn't be decoded: ")
+	assert.NoFileExists(t, filepath.Join(dir, "protos.binpb"))
+
+	_, err = connectrpc.NewRecorder("localhost:8080")
+	require.ErrorContains(t, err, `invalid target "localhost:8080": must be an http or https URL`)
+	empty, err := connectrpc.NewRecorder(srv.URL)
+	require.NoError(t, err)
+	require.ErrorContains(t, empty.WriteScript(dir), "no calls were recorded")
+}
+
+func TestRecorderJS(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var recorder = connectrpc.recorder('` + srv.URL + `');
+		var client = new connectrpc.Client();
+	`)
+	require.NoError(t, err)
+
+	_, err = ts.Run(`connectrpc.recorder('` + srv.URL + `', { port: 'any' });`)
+	require.ErrorContains(t, err, "invalid recorder options: invalid port: any")
+	_, err = ts.Run(`connectrpc.recorder('` + srv.URL + `', { verbose: true });`)
+	require.ErrorContains(t, err, `unknown option "verbose"`)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		client.connect(recorder.url, { plaintext: true });
+		client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 });
+	`)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		val, err := ts.Run(`recorder.calls().length`)
+		return err == nil && val.ToInteger() == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	dir := t.TempDir()
+	val, err := ts.Run(`
+		var call = recorder.calls()[0];
+		recorder.save('` + filepath.ToSlash(dir) + `');
+		recorder.close();
+		call.method + ' ' + call.code + ' ' + call.requests[0].number;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "/k6.connectrpc.ping.v1.PingService/Ping ok 1", val.String())
+	assert.FileExists(t, filepath.Join(dir, "script.js"))
+}
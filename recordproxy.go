@@ -0,0 +1,154 @@
+package connectrpc
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// recordingProxies holds the proxies started by connectrpc.recorder(), by port. Like the
+// mock servers, they are shared by all the VUs, so that teardown() can save the calls.
+var recordingProxies = struct {
+	sync.Mutex
+	proxies map[int]*recordingProxy
+}{proxies: make(map[int]*recordingProxy)}
+
+// recordingProxy is a Recorder served on a local port
+type recordingProxy struct {
+	port     int
+	recorder *Recorder
+	server   *http.Server
+}
+
+// recorder starts a proxy to target recording the calls, on port or a random port with
+// 0, with the `recorder()` options: port, reflection and insecure. It returns the proxy
+// already started on the port if any.
+func (mi *ModuleInstance) recorder(target string, options sobek.Value) (*sobek.Object, error) {
+	rt := mi.vu.Runtime()
+
+	var opts map[string]interface{}
+	if !common.IsNullish(options) {
+		var ok bool
+		if opts, ok = options.Export().(map[string]interface{}); !ok {
+			return nil, errors.New("invalid recorder options: must be an object")
+		}
+	}
+
+	port := 0
+	recorderOpts := []RecorderOption{WithRecorderRegistry(globalProtoRegistry.Registry)}
+	for k, v := range opts {
+		switch k {
+		case "port":
+			n, ok := v.(int64)
+			if !ok || n < 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid recorder options: invalid port: %v", v)
+			}
+			port = int(n)
+		case "reflection":
+			if reflection, ok := v.(bool); !ok {
+				return nil, errors.New("invalid recorder options: invalid reflection: must be a boolean")
+			} else if reflection {
+				recorderOpts = append(recorderOpts, WithReflection())
+			}
+		case "insecure":
+			if insecure, ok := v.(bool); !ok {
+				return nil, errors.New("invalid recorder options: invalid insecure: must be a boolean")
+			} else if insecure {
+				recorderOpts = append(recorderOpts, WithRecorderTLSConfig(&tls.Config{InsecureSkipVerify: true})) //nolint:gosec
+			}
+		default:
+			return nil, fmt.Errorf("invalid recorder options: unknown option %q", k)
+		}
+	}
+
+	recordingProxies.Lock()
+	defer recordingProxies.Unlock()
+
+	p, ok := recordingProxies.proxies[port]
+	if !ok || port == 0 {
+		recorder, err := NewRecorder(target, recorderOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if p, err = startRecordingProxy(port, recorder); err != nil {
+			return nil, fmt.Errorf("failed to start the recorder: %w", err)
+		}
+		recordingProxies.proxies[p.port] = p
+	}
+
+	obj := rt.NewObject()
+	must(rt, obj.Set("port", p.port))
+	must(rt, obj.Set("url", fmt.Sprintf("http://127.0.0.1:%d", p.port)))
+	must(rt, obj.Set("calls", func() []interface{} {
+		return recordedCallsJS(p.recorder.Calls())
+	}))
+	must(rt, obj.Set("save", p.recorder.WriteScript))
+	must(rt, obj.Set("close", func() error {
+		recordingProxies.Lock()
+		defer recordingProxies.Unlock()
+		if recordingProxies.proxies[p.port] == p {
+			delete(recordingProxies.proxies, p.port)
+		}
+		return p.server.Close()
+	}))
+	return obj, nil
+}
+
+// startRecordingProxy serves a recorder on port, over HTTP/1.1 and h2c
+func startRecordingProxy(port int, recorder *Recorder) (*recordingProxy, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &recordingProxy{
+		port:     listener.Addr().(*net.TCPAddr).Port,
+		recorder: recorder,
+		server: &http.Server{
+			Handler:           h2c.NewHandler(recorder, &http2.Server{}),
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+	go p.server.Serve(listener) //nolint:errcheck
+
+	return p, nil
+}
+
+// recordedCallsJS returns the recorded calls as objects like
+// `{ method, protocol, streaming, code, requests, error }`
+func recordedCallsJS(calls []RecordedCall) []interface{} {
+	objs := make([]interface{}, 0, len(calls))
+	for _, call := range calls {
+		requests := make([]interface{}, 0, len(call.Requests))
+		for _, data := range call.Requests {
+			var request interface{}
+			if json.Unmarshal(data, &request) == nil {
+				requests = append(requests, request)
+			}
+		}
+		var decodeErr interface{}
+		if call.DecodeErr != nil {
+			decodeErr = call.DecodeErr.Error()
+		}
+		objs = append(objs, map[string]interface{}{
+			"method":    call.Method,
+			"protocol":  call.Protocol,
+			"streaming": call.Streaming,
+			"code":      codeName(call.Code),
+			"requests":  requests,
+			"error":     decodeErr,
+		})
+	}
+	return objs
+}
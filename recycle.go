@@ -0,0 +1,109 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// errNotConnected is returned by the calls of a client without an HTTP client, before
+// connect() or after close()
+var errNotConnected = errors.New("client not connected: call connect() first")
+
+// connectionAgeJitter is the fraction of maxConnectionAge the age of each connection varies
+// by, so that the connections of the VUs opened together aren't recycled together
+const connectionAgeJitter = 0.1
+
+// parseMaxConnectionAge parses the `maxConnectionAge` connect parameter
+func parseMaxConnectionAge(v string) (time.Duration, error) {
+	age, err := time.ParseDuration(v)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid maxConnectionAge: %q. Must be a positive duration, like '5m'", v)
+	}
+	return age, nil
+}
+
+// validateMaxConnectionAge checks that the connection strategy keeps connections to recycle
+func validateMaxConnectionAge(p *connectParams) error {
+	if p.ConnectionStrategy != "per-vu" && p.ConnectionStrategy != "per-iteration" {
+		return errors.New("maxConnectionAge requires the 'per-vu' or 'per-iteration' connectionStrategy")
+	}
+	return nil
+}
+
+// jitteredAge returns the age at which a connection is recycled, within the jitter of age
+func jitteredAge(age time.Duration) time.Duration {
+	jitter := (rand.Float64()*2 - 1) * connectionAgeJitter //nolint:gosec
+	return age + time.Duration(float64(age)*jitter)
+}
+
+// setHTTPClient sets the HTTP client of the per-vu and per-iteration strategies, to be
+// recycled once older than maxConnectionAge, and to be replaced with per-iteration once
+// the iteration it was set in ends
+func (c *Client) setHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+	if age := c.connectParams.MaxConnectionAge; age > 0 {
+		c.httpClientExpiry = time.Now().Add(jitteredAge(age))
+	}
+	if state := c.vu.State(); state != nil {
+		c.lastIterationID = state.Iteration
+	}
+}
+
+// vuHTTPClient returns the HTTP client the calls, streams and sessions of the VU share with
+// the per-vu and per-iteration strategies. With per-iteration, the first of them in each
+// iteration replaces the client of the previous iteration, whose streams still open keep
+// their connections until they end. It is called from the VU goroutine only.
+func (c *Client) vuHTTPClient() (*http.Client, error) {
+	state := c.vu.State()
+	if c.connectionStrategy != "per-iteration" || state == nil {
+		return c.currentHTTPClient()
+	}
+	if c.httpClient != nil && c.lastIterationID == state.Iteration {
+		return c.currentHTTPClient()
+	}
+
+	httpClient, err := c.createHTTPClient(c.connectParams, c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client for per-iteration strategy: %w", err)
+	}
+	if c.httpClient != nil {
+		c.releaseHTTPClient(c.httpClient)
+	}
+	c.setHTTPClient(httpClient)
+	return httpClient, nil
+}
+
+// currentHTTPClient returns the HTTP client of the per-vu and per-iteration strategies,
+// replacing it with a new one once older than maxConnectionAge. The streams still open
+// keep the connections of the previous client until they end. When the new client can't
+// be created, the previous one is kept, to retry on the next call.
+func (c *Client) currentHTTPClient() (*http.Client, error) {
+	if c.connectParams == nil || c.connectParams.MaxConnectionAge == 0 {
+		if c.httpClient == nil {
+			return nil, errNotConnected
+		}
+		return c.httpClient, nil
+	}
+
+	// Async calls get their client from other goroutines
+	c.recycleMu.Lock()
+	defer c.recycleMu.Unlock()
+
+	if c.httpClient == nil {
+		return nil, errNotConnected
+	}
+	if time.Now().Before(c.httpClientExpiry) {
+		return c.httpClient, nil
+	}
+
+	httpClient, err := c.createHTTPClient(c.connectParams, c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recycle the HTTP client after maxConnectionAge: %w", err)
+	}
+	c.releaseHTTPClient(c.httpClient)
+	c.setHTTPClient(httpClient)
+	return httpClient, nil
+}
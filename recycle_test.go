@@ -0,0 +1,53 @@
+package connectrpc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJitteredAge(t *testing.T) {
+	t.Parallel()
+
+	ages := make(map[time.Duration]bool)
+	for range 100 {
+		age := jitteredAge(5 * time.Minute)
+		assert.GreaterOrEqual(t, age, 270*time.Second)
+		assert.LessOrEqual(t, age, 330*time.Second)
+		ages[age] = true
+	}
+	assert.Greater(t, len(ages), 1)
+}
+
+func TestCurrentHTTPClientRedialFails(t *testing.T) {
+	t.Parallel()
+
+	previous := &http.Client{}
+	c := &Client{
+		httpClient: previous,
+		defaults:   &moduleDefaults{},
+		// The CA certificate is invalid, so creating the new HTTP client fails
+		connectParams: &connectParams{
+			HTTPVersion:        "2",
+			ConnectionStrategy: "per-vu",
+			MaxConnectionAge:   time.Minute,
+			TLS:                map[string]interface{}{"cacerts": "not a certificate"},
+		},
+		httpClientExpiry: time.Now().Add(-time.Second),
+	}
+
+	for range 2 {
+		httpClient, err := c.currentHTTPClient()
+		require.ErrorContains(t, err, "failed to recycle the HTTP client after maxConnectionAge")
+		assert.Nil(t, httpClient)
+		// The previous client is kept, so the next call retries instead of getting no client
+		assert.Same(t, previous, c.httpClient)
+	}
+
+	c.httpClient = nil
+	_, err := c.currentHTTPClient()
+	require.ErrorIs(t, err, errNotConnected)
+}
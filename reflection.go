@@ -0,0 +1,81 @@
+package connectrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"connectrpc.com/connect"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// reflectionProcedure is the method of the gRPC server reflection, v1
+const reflectionProcedure = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+
+// fetchReflectedFiles requests the proto file defining a symbol, like a service, and its
+// imports from the server reflection of a server
+func fetchReflectedFiles(
+	ctx context.Context, httpClient connect.HTTPClient, baseURL, symbol string,
+) (*descriptorpb.FileDescriptorSet, error) {
+	client := connect.NewClient[reflectionpb.ServerReflectionRequest, reflectionpb.ServerReflectionResponse](
+		httpClient, strings.TrimSuffix(baseURL, "/")+reflectionProcedure, connect.WithGRPC())
+	stream := client.CallBidiStream(ctx)
+	defer stream.CloseResponse() //nolint:errcheck
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	var order []string
+	requested := map[string]bool{}
+	requests := []*reflectionpb.ServerReflectionRequest{{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}}
+	for len(requests) > 0 {
+		// Send fails with io.EOF once the server ended the stream, whose error Receive returns
+		if err := stream.Send(requests[0]); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		requests = requests[1:]
+
+		res, err := stream.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if errRes := res.GetErrorResponse(); errRes != nil {
+			return nil, fmt.Errorf("%s: %s", connect.Code(errRes.GetErrorCode()), errRes.GetErrorMessage()) //nolint:gosec
+		}
+
+		for _, data := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, fd); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor: %w", err)
+			}
+			if _, ok := files[fd.GetName()]; !ok {
+				files[fd.GetName()] = fd
+				order = append(order, fd.GetName())
+			}
+		}
+
+		// The servers send the imports not sent before on the stream, the missing ones are
+		// requested by name
+		for _, name := range order {
+			for _, dep := range files[name].GetDependency() {
+				if _, ok := files[dep]; !ok && !requested[dep] {
+					requested[dep] = true
+					requests = append(requests, &reflectionpb.ServerReflectionRequest{
+						MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+					})
+				}
+			}
+		}
+	}
+	_ = stream.CloseRequest()
+
+	fdset := &descriptorpb.FileDescriptorSet{}
+	for _, name := range order {
+		fdset.File = append(fdset.File, files[name])
+	}
+	return fdset, nil
+}
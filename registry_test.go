@@ -0,0 +1,101 @@
+package connectrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	pingv1 "github.com/bumberboy/xk6-connectrpc/testdata/ping/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// pingFileDescriptorSet returns the FileDescriptorSet of ping.proto and its dependencies
+func pingFileDescriptorSet() *descriptorpb.FileDescriptorSet {
+	fdset := &descriptorpb.FileDescriptorSet{}
+	imports := pingv1.File_ping_v1_ping_proto.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(imports.Get(i).FileDescriptor))
+	}
+	fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(pingv1.File_ping_v1_ping_proto))
+	return fdset
+}
+
+func TestProtoRegistryStatic(t *testing.T) {
+	t.Parallel()
+
+	registry := newProtoRegistry()
+	_, err := registry.RegisterGenerated(pingv1.File_ping_v1_ping_proto)
+	require.NoError(t, err)
+
+	md, err := registry.getMethodDescriptor("/k6.connectrpc.ping.v1.PingService/Ping")
+	require.NoError(t, err)
+	assert.True(t, isStatic(md))
+
+	// The messages of the loaded sources have no generated Go types
+	loaded := newProtoRegistry()
+	_, err = loaded.Register(pingFileDescriptorSet())
+	require.NoError(t, err)
+	md, err = loaded.getMethodDescriptor("/k6.connectrpc.ping.v1.PingService/Ping")
+	require.NoError(t, err)
+	assert.False(t, isStatic(md))
+}
+
+func TestProtoRegistryPresence(t *testing.T) {
+	t.Parallel()
+
+	compiler := &protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"testdata"}},
+	}
+	fds, err := compiler.Compile(context.Background(), "editions/v1/editions.proto", "optional/v1/optional.proto")
+	require.NoError(t, err)
+
+	fdset := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range fds {
+		fdset.File = append(fdset.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	registry := newProtoRegistry()
+	_, err = registry.Register(fdset)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		method   string
+		request  string
+		expected string
+	}{
+		{
+			name:     "Editions",
+			method:   "/k6.connectrpc.editions.v1.ItemService/GetItem",
+			request:  `{"name": "", "count": 0, "kind": "KIND_BOOK"}`,
+			expected: `{"count": "0", "kind": "KIND_BOOK"}`,
+		},
+		{
+			name:     "Proto3Optional",
+			method:   "/k6.connectrpc.optional.v1.SettingsService/Update",
+			request:  `{"label": "", "limit": 0, "enabled": false, "number": 0}`,
+			expected: `{"label": "", "limit": 0, "number": 0}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			md, err := registry.getMethodDescriptor(tc.method)
+			require.NoError(t, err)
+
+			// Only the fields with explicit presence keep their zero values
+			msg := dynamicpb.NewMessage(md.Output())
+			require.NoError(t, unmarshalRequest([]byte(tc.request), msg))
+			data, err := protojson.Marshal(msg)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(data))
+		})
+	}
+}
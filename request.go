@@ -0,0 +1,287 @@
+package connectrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// requestUnmarshaler unmarshals JSON requests, like protojson with friendlier enums and errors
+type requestUnmarshaler struct {
+	// discardUnknown ignores the fields missing from the message descriptor, so scripts
+	// written for a newer proto still work with an older server
+	discardUnknown bool
+
+	// convertTimes accepts the Timestamp and Duration fields as milliseconds, timestamps with
+	// any offset and Go durations, with the timeFields connect parameter
+	convertTimes bool
+}
+
+// unmarshalRequest unmarshals a JSON request into msg. Valid protojson takes the fast
+// path. Otherwise enums given as numeric strings or with another case are normalized,
+// and if the request is still invalid the error points at the offending field, like
+// `field users[2].address.zip: expected string, got number`.
+func unmarshalRequest(data []byte, msg proto.Message) error {
+	return requestUnmarshaler{}.unmarshal(data, msg)
+}
+
+// unmarshal unmarshals a JSON request into msg, see unmarshalRequest
+func (u requestUnmarshaler) unmarshal(data []byte, msg proto.Message) error {
+	// The fast path is strict even when discarding unknown fields, as protojson would
+	// also discard the enum names that only differ by their case
+	err := protojson.Unmarshal(data, msg)
+	if err == nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var request interface{}
+	if decoder.Decode(&request) != nil {
+		return err
+	}
+
+	obj, ok := request.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected a JSON object, got %s", jsonType(request))
+	}
+
+	changed, checkErr := u.normalizeMessage(obj, msg.ProtoReflect().Descriptor(), "")
+	if checkErr != nil {
+		return checkErr
+	}
+	if !changed && !u.discardUnknown {
+		return err
+	}
+
+	if changed {
+		if data, err = json.Marshal(obj); err != nil {
+			return err
+		}
+	}
+	proto.Reset(msg)
+	return protojson.UnmarshalOptions{DiscardUnknown: u.discardUnknown}.Unmarshal(data, msg)
+}
+
+// normalizeMessage checks the JSON object of a message against its descriptor, normalizing
+// its enum values in place. It returns whether a value was normalized. The fields are
+// checked in sorted order, so the same invalid request always reports the same error.
+func (u requestUnmarshaler) normalizeMessage(obj map[string]interface{}, desc protoreflect.MessageDescriptor, path string) (bool, error) {
+	changed := false
+	for _, key := range sortedKeys(obj) {
+		value := obj[key]
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+
+		fd := desc.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = desc.Fields().ByTextName(key)
+		}
+		if fd == nil {
+			if u.discardUnknown {
+				continue
+			}
+			return false, fmt.Errorf("field %s: unknown field of %s", fieldPath, desc.FullName())
+		}
+		if value == nil {
+			continue
+		}
+
+		var normalized interface{}
+		var err error
+		switch {
+		case fd.IsMap():
+			normalized, err = u.normalizeMap(value, fd, fieldPath)
+		case fd.IsList():
+			normalized, err = u.normalizeList(value, fd, fieldPath)
+		default:
+			normalized, err = u.normalizeValue(value, fd, fieldPath)
+		}
+		if err != nil {
+			return false, err
+		}
+		if normalized != nil {
+			obj[key] = normalized
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// sortedKeys returns the keys of a JSON object in sorted order
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (u requestUnmarshaler) normalizeMap(value interface{}, fd protoreflect.FieldDescriptor, path string) (interface{}, error) {
+	entries, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %s: expected object, got %s", path, jsonType(value))
+	}
+
+	changed := false
+	for _, key := range sortedKeys(entries) {
+		entry := entries[key]
+		normalized, err := u.normalizeValue(entry, fd.MapValue(), fmt.Sprintf("%s[%q]", path, key))
+		if err != nil {
+			return nil, err
+		}
+		if normalized != nil {
+			entries[key] = normalized
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return entries, nil
+}
+
+func (u requestUnmarshaler) normalizeList(value interface{}, fd protoreflect.FieldDescriptor, path string) (interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %s: expected array, got %s", path, jsonType(value))
+	}
+
+	changed := false
+	for i, item := range items {
+		normalized, err := u.normalizeValue(item, fd, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		if normalized != nil {
+			items[i] = normalized
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return items, nil
+}
+
+// normalizeValue checks a singular value, returning its normalized value or nil if unchanged
+func (u requestUnmarshaler) normalizeValue(value interface{}, fd protoreflect.FieldDescriptor, path string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// The well-known types have their own JSON mapping, protojson validates them
+		if strings.HasPrefix(string(fd.Message().FullName()), "google.protobuf.") {
+			if u.convertTimes {
+				return normalizeTime(value, fd.Message().FullName(), path)
+			}
+			return nil, nil
+		}
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %s: expected object, got %s", path, jsonType(value))
+		}
+		changed, err := u.normalizeMessage(obj, fd.Message(), path)
+		if err != nil || !changed {
+			return nil, err
+		}
+		return obj, nil
+
+	case protoreflect.EnumKind:
+		return u.normalizeEnum(value, fd.Enum(), path)
+
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		if _, ok := value.(string); !ok {
+			return nil, fmt.Errorf("field %s: expected string, got %s", path, jsonType(value))
+		}
+
+	case protoreflect.BoolKind:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("field %s: expected boolean, got %s", path, jsonType(value))
+		}
+
+	default:
+		// Numbers may also be given as strings, like protojson renders 64-bit integers
+		switch v := value.(type) {
+		case json.Number:
+		case string:
+			if _, err := strconv.ParseFloat(v, 64); err != nil && v != "NaN" && v != "Infinity" && v != "-Infinity" {
+				return nil, fmt.Errorf("field %s: expected number, got string %q", path, v)
+			}
+		default:
+			return nil, fmt.Errorf("field %s: expected number, got %s", path, jsonType(value))
+		}
+	}
+	return nil, nil
+}
+
+// normalizeEnum accepts enum values as numbers, numeric strings, or names in any case
+func (u requestUnmarshaler) normalizeEnum(value interface{}, enum protoreflect.EnumDescriptor, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return nil, nil
+	case string:
+		if enum.Values().ByName(protoreflect.Name(v)) != nil {
+			return nil, nil
+		}
+		if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		}
+		values := enum.Values()
+		for i := 0; i < values.Len(); i++ {
+			if strings.EqualFold(string(values.Get(i).Name()), v) {
+				return string(values.Get(i).Name()), nil
+			}
+		}
+		if u.discardUnknown {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("field %s: invalid value %q for enum %s", path, v, enum.FullName())
+	default:
+		return nil, fmt.Errorf("field %s: expected enum name or number, got %s", path, jsonType(value))
+	}
+}
+
+// jsonType returns the JSON type name of a decoded value for error messages
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// requestUnmarshaler returns the request unmarshaler of a call: the `ignoreUnknownFields`
+// call parameter wins over the connect parameter
+func (c *Client) requestUnmarshaler(p *callParams) requestUnmarshaler {
+	u := requestUnmarshaler{}
+	if c.connectParams != nil {
+		u.discardUnknown = c.connectParams.IgnoreUnknown
+		u.convertTimes = c.connectParams.TimeFields != ""
+	}
+	if p != nil && p.IgnoreUnknown != nil {
+		u.discardUnknown = *p.IgnoreUnknown
+	}
+	return u
+}
@@ -0,0 +1,129 @@
+package connectrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func createUsersRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	return requestTestDescriptor(t, "CreateUsersRequest")
+}
+
+func requestTestDescriptor(t *testing.T, name protoreflect.Name) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	compiler := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{"testdata/request/v1"},
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), "request.proto")
+	require.NoError(t, err)
+
+	return files[0].Messages().ByName(name)
+}
+
+func TestUnmarshalRequest(t *testing.T) {
+	t.Parallel()
+
+	desc := createUsersRequestDescriptor(t)
+
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{
+			name:     "Enum names and numbers",
+			request:  `{"users": [{"role": "ROLE_ADMIN"}, {"role": 2}], "roles": {"a": 1, "b": "ROLE_USER"}}`,
+			expected: `{"users": [{"role": "ROLE_ADMIN"}, {"role": "ROLE_USER"}], "roles": {"a": "ROLE_ADMIN", "b": "ROLE_USER"}}`,
+		},
+		{
+			name:     "Enum numeric strings and other cases",
+			request:  `{"users": [{"role": "1"}, {"role": "role_user"}], "roles": {"a": "Role_Admin"}}`,
+			expected: `{"users": [{"role": "ROLE_ADMIN"}, {"role": "ROLE_USER"}], "roles": {"a": "ROLE_ADMIN"}}`,
+		},
+		{
+			name:     "Oneof and well-known types",
+			request:  `{"group": 3, "count": "12", "createdAt": "2024-01-01T00:00:00Z", "users": [{"role": "role_admin"}]}`,
+			expected: `{"group": 3, "count": "12", "createdAt": "2024-01-01T00:00:00Z", "users": [{"role": "ROLE_ADMIN"}]}`,
+		},
+		{
+			name:     "Proto field names",
+			request:  `{"created_at": "2024-01-01T00:00:00Z", "team": "core", "users": [{"role": "role_admin"}]}`,
+			expected: `{"createdAt": "2024-01-01T00:00:00Z", "team": "core", "users": [{"role": "ROLE_ADMIN"}]}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := dynamicpb.NewMessage(desc)
+			require.NoError(t, unmarshalRequest([]byte(tc.request), msg))
+
+			actual, err := protojson.Marshal(msg)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestUnmarshalRequestErrorPaths(t *testing.T) {
+	t.Parallel()
+
+	desc := createUsersRequestDescriptor(t)
+
+	tests := []struct {
+		request string
+		err     string
+	}{
+		{`{"users": [{}, {}, {"address": {"zip": 12345}}]}`, "field users[2].address.zip: expected string, got number"},
+		{`{"users": {"name": "a"}}`, "field users: expected array, got object"},
+		{`{"users": [{"address": "x"}]}`, "field users[0].address: expected object, got string"},
+		{`{"roles": {"a": true}}`, `field roles["a"]: expected enum name or number, got boolean`},
+		{`{"users": [{"role": "ROLE_OWNER"}]}`, `field users[0].role: invalid value "ROLE_OWNER" for enum k6.connectrpc.request.v1.Role`},
+		{`{"count": "many"}`, `field count: expected number, got string "many"`},
+		{`{"users": [{"nickname": "a"}]}`, "field users[0].nickname: unknown field of k6.connectrpc.request.v1.User"},
+		{`[1]`, "expected a JSON object, got array"},
+		// With several invalid fields, the first one in key order is reported
+		{`{"users": 1, "count": "many", "roles": {"b": true, "a": 1.5}}`, `field count: expected number, got string "many"`},
+		{`{"users": 1, "roles": {"b": true, "a": [1]}}`, `field roles["a"]: expected enum name or number, got array`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.request, func(t *testing.T) {
+			t.Parallel()
+
+			err := unmarshalRequest([]byte(tc.request), dynamicpb.NewMessage(desc))
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestUnmarshalRequestDiscardUnknown(t *testing.T) {
+	t.Parallel()
+
+	desc := createUsersRequestDescriptor(t)
+	u := requestUnmarshaler{discardUnknown: true}
+
+	msg := dynamicpb.NewMessage(desc)
+	require.NoError(t, u.unmarshal([]byte(`{"users": [{"nickname": "a", "role": "role_admin"}, {"role": "ROLE_OWNER"}], "newField": 1}`), msg))
+
+	actual, err := protojson.Marshal(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": [{"role": "ROLE_ADMIN"}, {}]}`, string(actual))
+
+	// Mismatched types of known fields are still errors
+	err = u.unmarshal([]byte(`{"newField": 1, "count": true}`), dynamicpb.NewMessage(desc))
+	require.EqualError(t, err, "field count: expected number, got boolean")
+}
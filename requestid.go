@@ -0,0 +1,82 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/metrics"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// defaultRequestIDHeader is the header of the request IDs with `requestId: true`
+	defaultRequestIDHeader = "X-Request-Id"
+	// requestIDPrefixLength is the length of the request_id_prefix tag of the failed calls,
+	// 256 values at most for the hex IDs
+	requestIDPrefixLength = 2
+)
+
+// parseRequestID parses the `requestId` connect parameter: true generates the IDs in the
+// X-Request-Id header, and a string names another header
+func parseRequestID(v sobek.Value) (string, error) {
+	if common.IsNullish(v) {
+		return "", nil
+	}
+	switch value := v.Export().(type) {
+	case bool:
+		if value {
+			return defaultRequestIDHeader, nil
+		}
+		return "", nil
+	case string:
+		if value == "" {
+			return "", errors.New("header must not be empty")
+		}
+		if !httpguts.ValidHeaderFieldName(value) {
+			return "", fmt.Errorf("invalid header name %q", value)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("must be a boolean or a header name, got %s", v.ExportType())
+	}
+}
+
+// setRequestID generates the request ID of a call, if the connection asks for them, and
+// sets it in the header
+func (c *Client) setRequestID(header http.Header, p *callParams) {
+	if c.connectParams == nil || c.connectParams.RequestIDHeader == "" {
+		return
+	}
+	if p.RequestID == "" {
+		p.RequestID = uuid.NewString()
+	}
+	header.Set(c.connectParams.RequestIDHeader, p.RequestID)
+}
+
+// setRequestID returns the request ID of a call in its response, to find it in the server logs
+func (p *callParams) setRequestID(rt *sobek.Runtime, response *sobek.Object) {
+	if p.RequestID != "" {
+		must(rt, response.Set("requestId", p.RequestID))
+	}
+}
+
+// setRequestID adds the request ID of a call to the metadata of its samples, which is
+// exported without creating a time series per call
+func (t MetricTags) setRequestID(ctm *metrics.TagsAndMeta) {
+	if t.RequestID != "" {
+		ctm.SetMetadata("request_id", t.RequestID)
+	}
+}
+
+// requestIDPrefix returns the tags of an error sample, with the prefix of the request ID of
+// the call: a low cardinality bucket narrowing down the server logs of the failed requests
+func (t MetricTags) requestIDPrefix(tags *metrics.TagSet) *metrics.TagSet {
+	if len(t.RequestID) < requestIDPrefixLength {
+		return tags
+	}
+	return tags.With("request_id_prefix", t.RequestID[:requestIDPrefixLength])
+}
@@ -0,0 +1,159 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/sobek"
+)
+
+// responseCallback decides which responses are expected, mirroring k6/http's
+// `responseCallback`. Unexpected responses are counted in connectrpc_req_errors.
+type responseCallback struct {
+	codes    map[connect.Code]struct{}
+	statuses []statusRange
+}
+
+// statusRange is an inclusive range of HTTP-like response statuses
+type statusRange struct {
+	min int
+	max int
+}
+
+// codeOK is the zero Code used by connect-go for successful calls
+const codeOK connect.Code = 0
+
+// defaultResponseCallback only expects successful responses
+var defaultResponseCallback = &responseCallback{
+	codes: map[connect.Code]struct{}{codeOK: {}},
+}
+
+// newResponseCallback creates a response callback from a list of Connect code
+// names (e.g. "ok", "not_found"), HTTP-like statuses or {min, max} status ranges
+func newResponseCallback(args ...interface{}) (*responseCallback, error) {
+	if len(args) == 0 {
+		return nil, errors.New("at least one expected status is required")
+	}
+
+	cb := &responseCallback{codes: make(map[connect.Code]struct{})}
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			code := codeOK
+			if v != "ok" {
+				if err := code.UnmarshalText([]byte(v)); err != nil {
+					return nil, fmt.Errorf("argument %d: invalid code %q", i, v)
+				}
+			}
+			cb.codes[code] = struct{}{}
+		case int64:
+			cb.statuses = append(cb.statuses, statusRange{min: int(v), max: int(v)})
+		case float64:
+			cb.statuses = append(cb.statuses, statusRange{min: int(v), max: int(v)})
+		case map[string]interface{}:
+			r, err := parseStatusRange(v)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i, err)
+			}
+			cb.statuses = append(cb.statuses, r)
+		default:
+			return nil, fmt.Errorf("argument %d: must be a code name, a status or a {min, max} object, got %T", i, arg)
+		}
+	}
+
+	return cb, nil
+}
+
+func parseStatusRange(v map[string]interface{}) (statusRange, error) {
+	bound := func(key string) (int, error) {
+		switch n := v[key].(type) {
+		case int64:
+			return int(n), nil
+		case float64:
+			return int(n), nil
+		default:
+			return 0, fmt.Errorf("status range %s must be a number", key)
+		}
+	}
+
+	lo, err := bound("min")
+	if err != nil {
+		return statusRange{}, err
+	}
+	hi, err := bound("max")
+	if err != nil {
+		return statusRange{}, err
+	}
+	if lo > hi {
+		return statusRange{}, fmt.Errorf("status range min %d is greater than max %d", lo, hi)
+	}
+
+	return statusRange{min: lo, max: hi}, nil
+}
+
+// expects reports whether a response with the given HTTP-like status and error is expected
+func (r *responseCallback) expects(status int, err error) bool {
+	code := codeOK
+	if err != nil {
+		code = connect.CodeOf(err)
+	}
+	if _, ok := r.codes[code]; ok {
+		return true
+	}
+
+	for _, s := range r.statuses {
+		if status >= s.min && status <= s.max {
+			return true
+		}
+	}
+	return false
+}
+
+// parseResponseCallback extracts a response callback created by `expectedStatuses()`.
+// null and undefined return nil, so the next default applies.
+func parseResponseCallback(v sobek.Value) (*responseCallback, error) {
+	if v == nil || sobek.IsUndefined(v) || sobek.IsNull(v) {
+		return nil, nil
+	}
+
+	cb, ok := v.Export().(*responseCallback)
+	if !ok {
+		return nil, errors.New("must be created with connectrpc.expectedStatuses()")
+	}
+	return cb, nil
+}
+
+// expectedStatuses is the JS function returning a response callback for the given statuses
+func (mi *ModuleInstance) expectedStatuses(args ...sobek.Value) (*responseCallback, error) {
+	exported := make([]interface{}, len(args))
+	for i, arg := range args {
+		exported[i] = arg.Export()
+	}
+	return newResponseCallback(exported...)
+}
+
+// setResponseCallback sets the default response callback for all clients of the VU
+func (mi *ModuleInstance) setResponseCallback(v sobek.Value) error {
+	cb, err := parseResponseCallback(v)
+	if err != nil {
+		return fmt.Errorf("invalid response callback: %w", err)
+	}
+	mi.defaults.responseCallback = cb
+	return nil
+}
+
+// responseCallback returns the response callback for a call: the call parameter
+// wins over the connect parameter, which wins over the module default
+func (c *Client) responseCallback(p *callParams) *responseCallback {
+	if p != nil && p.ResponseCallback != nil {
+		return p.ResponseCallback
+	}
+	if c.connectParams != nil && c.connectParams.ResponseCallback != nil {
+		return c.connectParams.ResponseCallback
+	}
+	if c.defaults != nil && c.defaults.responseCallback != nil {
+		return c.defaults.responseCallback
+	}
+	return defaultResponseCallback
+}
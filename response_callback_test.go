@@ -0,0 +1,58 @@
+package connectrpc
+
+import (
+	"errors"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCallbackExpects(t *testing.T) {
+	t.Parallel()
+
+	notFound := connect.NewError(connect.CodeNotFound, errors.New("missing"))
+	unavailable := connect.NewError(connect.CodeUnavailable, errors.New("down"))
+
+	assert.True(t, defaultResponseCallback.expects(200, nil))
+	assert.False(t, defaultResponseCallback.expects(404, notFound))
+
+	cb, err := newResponseCallback("ok", "not_found")
+	require.NoError(t, err)
+	assert.True(t, cb.expects(200, nil))
+	assert.True(t, cb.expects(404, notFound))
+	assert.False(t, cb.expects(503, unavailable))
+
+	cb, err = newResponseCallback(int64(503), map[string]interface{}{"min": int64(200), "max": int64(299)})
+	require.NoError(t, err)
+	assert.True(t, cb.expects(200, nil))
+	assert.True(t, cb.expects(503, unavailable))
+	assert.False(t, cb.expects(404, notFound))
+}
+
+func TestNewResponseCallbackInvalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name        string
+		Args        []interface{}
+		ErrContains string
+	}{
+		{"Empty", nil, "at least one expected status is required"},
+		{"UnknownCode", []interface{}{"exploded"}, `argument 0: invalid code "exploded"`},
+		{"InvalidRange", []interface{}{map[string]interface{}{"min": int64(500), "max": int64(400)}}, "min 500 is greater than max 400"},
+		{"MissingBound", []interface{}{map[string]interface{}{"min": int64(200)}}, "status range max must be a number"},
+		{"InvalidType", []interface{}{true}, "must be a code name, a status or a {min, max} object"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newResponseCallback(tc.Args...)
+			require.ErrorContains(t, err, tc.ErrContains)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package connectrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+)
+
+// routing is the `routing` connect parameter: the header routing each unary call to a
+// partition of the backend, computed from its request. The routing key is a field of the
+// request, or returned by a function of it, and with `shards` it is consistently hashed to
+// a shard number, like the partition-aware clients and proxies do.
+type routing struct {
+	header string
+	field  []string       // Path of the routing key in the request, nil with fn
+	fn     sobek.Callable // Function of the request returning the routing key
+	shards int            // Number of shards the key is hashed to, 0 to send the key itself
+}
+
+// newRouting parses the `routing` connect parameter, like
+// { header: 'x-shard-key', value: 'user.id', shards: 16 }
+func newRouting(v sobek.Value) (*routing, error) {
+	obj, ok := v.(*sobek.Object)
+	if !ok {
+		return nil, errors.New("must be an object")
+	}
+
+	r := &routing{}
+	header := obj.Get("header")
+	if common.IsNullish(header) || header.String() == "" {
+		return nil, errors.New("header is required")
+	}
+	r.header = header.String()
+
+	value := obj.Get("value")
+	if fn, ok := sobek.AssertFunction(value); ok {
+		r.fn = fn
+	} else if path, ok := value.(sobek.String); ok && path.String() != "" {
+		r.field = strings.Split(path.String(), ".")
+	} else {
+		return nil, errors.New("value must be a field path, like 'user.id', or a function of the request")
+	}
+
+	if shards := obj.Get("shards"); !common.IsNullish(shards) {
+		r.shards = int(shards.ToInteger())
+		if r.shards < 1 {
+			return nil, fmt.Errorf("shards must be at least 1, got %s", shards.String())
+		}
+	}
+
+	return r, nil
+}
+
+// applyRouting sets the routing header of a unary call, if the connection has a `routing`
+func (c *Client) applyRouting(reqJSON []byte, p *callParams) error {
+	if c.connectParams == nil || c.connectParams.Routing == nil {
+		return nil
+	}
+	return c.connectParams.Routing.apply(c.vu.Runtime(), reqJSON, p.Metadata)
+}
+
+// apply sets the routing header of a call in its call-level headers, unless they already
+// set it. Requests without the routing key are sent without the header.
+func (r *routing) apply(rt *sobek.Runtime, reqJSON []byte, metadata map[string]string) error {
+	for name := range metadata {
+		if strings.EqualFold(name, r.header) {
+			return nil
+		}
+	}
+
+	key, ok, err := r.key(rt, reqJSON)
+	if err != nil || !ok {
+		return err
+	}
+	if r.shards > 0 {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(key))
+		key = strconv.Itoa(jumpHash(hash.Sum64(), r.shards))
+	}
+	metadata[r.header] = key
+	return nil
+}
+
+// key returns the routing key of a request, and whether it has one
+func (r *routing) key(rt *sobek.Runtime, reqJSON []byte) (string, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(reqJSON))
+	decoder.UseNumber()
+	var request interface{}
+	if err := decoder.Decode(&request); err != nil {
+		return "", false, fmt.Errorf("routing: invalid request: %w", err)
+	}
+
+	if r.fn != nil {
+		v, err := r.fn(sobek.Undefined(), rt.ToValue(request))
+		if err != nil {
+			return "", false, fmt.Errorf("routing: %w", err)
+		}
+		if common.IsNullish(v) {
+			return "", false, nil
+		}
+		return v.String(), true, nil
+	}
+
+	value := request
+	for _, name := range r.field {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			value = container[name]
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(container) {
+				return "", false, nil
+			}
+			value = container[i]
+		default:
+			return "", false, nil
+		}
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return value, true, nil
+	case json.Number:
+		return value.String(), true, nil
+	case bool:
+		return strconv.FormatBool(value), true, nil
+	default:
+		return "", false, fmt.Errorf("routing: %s is not a string, number or boolean", strings.Join(r.field, "."))
+	}
+}
+
+// jumpHash maps a key to one of the buckets with the jump consistent hash of Lamping and
+// Veach, so that changing the number of buckets only moves the keys it has to
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
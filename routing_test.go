@@ -0,0 +1,107 @@
+package connectrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/js/modulestest"
+)
+
+func TestRouting(t *testing.T) {
+	t.Parallel()
+
+	request := []byte(`{"user":{"id":12345678901234567890,"region":"eu"},"items":[{"sku":"A1"}],"premium":true}`)
+
+	testCases := []struct {
+		Name     string
+		Routing  string
+		Headers  map[string]string
+		Expected map[string]string
+	}{
+		{"Field", `{ header: 'x-shard-key', value: 'user.region' }`, nil, map[string]string{"x-shard-key": "eu"}},
+		{"LargeNumber", `{ header: 'x-shard-key', value: 'user.id' }`, nil, map[string]string{"x-shard-key": "12345678901234567890"}},
+		{"ArrayIndex", `{ header: 'x-shard-key', value: 'items.0.sku' }`, nil, map[string]string{"x-shard-key": "A1"}},
+		{"Boolean", `{ header: 'x-tier', value: 'premium' }`, nil, map[string]string{"x-tier": "true"}},
+		{"Function", `{ header: 'x-shard-key', value: (r) => r.user.region + '-' + r.items.length }`, nil, map[string]string{"x-shard-key": "eu-1"}},
+		{"MissingField", `{ header: 'x-shard-key', value: 'user.tenant' }`, nil, map[string]string{}},
+		{"FunctionReturningNull", `{ header: 'x-shard-key', value: () => null }`, nil, map[string]string{}},
+		{"Shards", `{ header: 'x-shard', value: 'user.region', shards: 16 }`, nil, map[string]string{"x-shard": "13"}},
+		{"CallHeader", `{ header: 'x-shard-key', value: 'user.region' }`, map[string]string{"X-Shard-Key": "us"}, map[string]string{"X-Shard-Key": "us"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			rt := modulestest.NewRuntime(t).VU.Runtime()
+			val, err := rt.RunString("(" + tc.Routing + ")")
+			require.NoError(t, err)
+
+			r, err := newRouting(val)
+			require.NoError(t, err)
+
+			metadata := map[string]string{}
+			for k, v := range tc.Headers {
+				metadata[k] = v
+			}
+			require.NoError(t, r.apply(rt, request, metadata))
+			assert.Equal(t, tc.Expected, metadata)
+		})
+	}
+}
+
+func TestRoutingInvalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name        string
+		Routing     string
+		ErrContains string
+	}{
+		{"NotAnObject", `'x-shard-key'`, "must be an object"},
+		{"NoHeader", `{ value: 'user.id' }`, "header is required"},
+		{"NoValue", `{ header: 'x-shard-key' }`, "value must be a field path"},
+		{"InvalidShards", `{ header: 'x-shard-key', value: 'user.id', shards: 0 }`, "shards must be at least 1, got 0"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			rt := modulestest.NewRuntime(t).VU.Runtime()
+			val, err := rt.RunString("(" + tc.Routing + ")")
+			require.NoError(t, err)
+
+			_, err = newRouting(val)
+			require.ErrorContains(t, err, tc.ErrContains)
+		})
+	}
+
+	rt := modulestest.NewRuntime(t).VU.Runtime()
+	val, err := rt.RunString(`({ header: 'x-shard-key', value: 'user' })`)
+	require.NoError(t, err)
+	r, err := newRouting(val)
+	require.NoError(t, err)
+	err = r.apply(rt, []byte(`{"user":{"id":1}}`), map[string]string{})
+	require.ErrorContains(t, err, "routing: user is not a string, number or boolean")
+}
+
+func TestJumpHash(t *testing.T) {
+	t.Parallel()
+
+	// Growing from 10 to 11 buckets only moves keys to the new bucket, about 1 in 11
+	moved := 0
+	for key := uint64(0); key < 10000; key++ {
+		before, after := jumpHash(key, 10), jumpHash(key, 11)
+		require.True(t, before >= 0 && before < 10)
+		if before != after {
+			require.Equal(t, 10, after)
+			moved++
+		}
+	}
+	assert.InDelta(t, 10000/11, moved, 150)
+	assert.Equal(t, 0, jumpHash(42, 1))
+}
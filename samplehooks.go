@@ -0,0 +1,299 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/metrics"
+)
+
+// sampleHook derives samples from the responses of the unary calls, see onSample(). It
+// either calls a JS function, or extracts a numeric field of the response message in Go.
+type sampleHook struct {
+	fn       sobek.Callable    // Callback returning the samples of a response, nil for a field hook
+	method   string            // Procedure of the field hook, empty for every procedure
+	metric   *metrics.Metric   // Metric of the field hook
+	field    string            // Path of the field of the field hook, like `items[0].price`
+	segments []string          // Field names and indexes of the path, see parseMessagePath
+	tags     map[string]string // Tags of the samples of the field hook
+}
+
+// sampleHooks are the onSample() hooks of a VU, registered in its init context
+type sampleHooks struct {
+	registry *metrics.Registry
+	hooks    []*sampleHook
+}
+
+// derivedSample is a sample derived from a response by a hook
+type derivedSample struct {
+	metric *metrics.Metric
+	value  float64
+	tags   map[string]string
+}
+
+// onSample registers a hook deriving samples of custom metrics from the responses of the
+// unary calls: a function returning the samples of a response, or a field hook like
+// `{ metric: 'order_total', field: 'total', method: '/shop.v1.OrderService/Checkout' }`
+// adding a numeric field of the responses to a metric, without running JS for each call
+func (mi *ModuleInstance) onSample(v sobek.Value) error {
+	if mi.vu.State() != nil {
+		return errors.New("onSample must be called in the init context")
+	}
+
+	if mi.defaults.sampleHooks == nil {
+		mi.defaults.sampleHooks = &sampleHooks{registry: mi.vu.InitEnv().Registry}
+	}
+	hooks := mi.defaults.sampleHooks
+
+	hook, err := hooks.parseHook(v)
+	if err != nil {
+		return fmt.Errorf("invalid onSample hook: %w", err)
+	}
+	hooks.hooks = append(hooks.hooks, hook)
+	return nil
+}
+
+// parseHook parses the function or the field hook given to onSample()
+func (h *sampleHooks) parseHook(v sobek.Value) (*sampleHook, error) {
+	if fn, ok := sobek.AssertFunction(v); ok {
+		return &sampleHook{fn: fn}, nil
+	}
+	if common.IsNullish(v) {
+		return nil, errors.New("must be a function or an object like { metric, field }")
+	}
+	obj, ok := v.Export().(map[string]interface{})
+	if !ok {
+		return nil, errors.New("must be a function or an object like { metric, field }")
+	}
+
+	hook := &sampleHook{}
+	for k, value := range obj {
+		switch k {
+		case "metric":
+			name, _ := value.(string)
+			metric, err := h.metric(name)
+			if err != nil {
+				return nil, err
+			}
+			hook.metric = metric
+		case "field":
+			field, _ := value.(string)
+			if field == "" {
+				return nil, errors.New("field must be a field path like 'total' or 'items[0].price'")
+			}
+			segments, err := parseMessagePath(field)
+			if err != nil {
+				return nil, err
+			}
+			hook.field = field
+			hook.segments = segments
+		case "method":
+			method, ok := value.(string)
+			if !ok || method == "" {
+				return nil, errors.New("method must be a procedure like '/package.Service/Method'")
+			}
+			hook.method = dynamic.MethodPath(method)
+		case "tags":
+			tags, err := parseSampleTags(value)
+			if err != nil {
+				return nil, err
+			}
+			hook.tags = tags
+		default:
+			return nil, fmt.Errorf("unknown key %q, must be metric, field, method or tags", k)
+		}
+	}
+	if hook.metric == nil || hook.field == "" {
+		return nil, errors.New("a field hook requires a metric and a field")
+	}
+	return hook, nil
+}
+
+// metric returns the custom metric of a name, created with k6/metrics
+func (h *sampleHooks) metric(name string) (*metrics.Metric, error) {
+	if name == "" {
+		return nil, errors.New("metric must be the name of a metric")
+	}
+	metric := h.registry.Get(name)
+	if metric == nil {
+		return nil, fmt.Errorf("unknown metric %q, create it with k6/metrics first", name)
+	}
+	return metric, nil
+}
+
+// parseSampleTags parses the tags of a sample, which are strings
+func parseSampleTags(v interface{}) (map[string]string, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("tags must be an object of strings")
+	}
+	tags := make(map[string]string, len(obj))
+	for k, value := range obj {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("tag %s must be a string", k)
+		}
+		tags[k] = str
+	}
+	return tags, nil
+}
+
+// derive runs the hooks on the response of a call. responseJSON is the response message,
+// nil for an error, which the field hooks skip.
+func (h *sampleHooks) derive(rt *sobek.Runtime, method string, response *sobek.Object,
+	responseJSON []byte) ([]derivedSample, error) {
+
+	var samples []derivedSample
+	var message map[string]interface{}
+	for _, hook := range h.hooks {
+		if hook.fn != nil {
+			v, err := hook.fn(sobek.Undefined(), response, rt.ToValue(method))
+			if err != nil {
+				return nil, fmt.Errorf("onSample callback failed: %w", err)
+			}
+			derived, err := h.parseSamples(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid onSample samples: %w", err)
+			}
+			samples = append(samples, derived...)
+			continue
+		}
+
+		if responseJSON == nil || (hook.method != "" && hook.method != method) {
+			continue
+		}
+		if message == nil {
+			if err := json.Unmarshal(responseJSON, &message); err != nil {
+				return nil, fmt.Errorf("failed to decode the response of onSample: %w", err)
+			}
+		}
+		value, err := fieldValue(message, hook.segments)
+		if err != nil {
+			return nil, fmt.Errorf("invalid onSample field %s: %w", hook.field, err)
+		}
+		samples = append(samples, derivedSample{metric: hook.metric, value: value, tags: hook.tags})
+	}
+	return samples, nil
+}
+
+// parseSamples parses what a hook function returned: nothing, a sample like
+// { metric, value, tags }, or an array of them
+func (h *sampleHooks) parseSamples(v sobek.Value) ([]derivedSample, error) {
+	if common.IsNullish(v) {
+		return nil, nil
+	}
+
+	var list []interface{}
+	switch exported := v.Export().(type) {
+	case []interface{}:
+		list = exported
+	case map[string]interface{}:
+		list = []interface{}{exported}
+	default:
+		return nil, errors.New("must be a sample like { metric, value } or an array of them")
+	}
+
+	samples := make([]derivedSample, 0, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("sample %d must be an object like { metric, value }", i)
+		}
+		name, _ := obj["metric"].(string)
+		metric, err := h.metric(name)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+		var value float64
+		switch n := obj["value"].(type) {
+		case int64:
+			value = float64(n)
+		case float64:
+			value = n
+		default:
+			return nil, fmt.Errorf("sample %d: value must be a number", i)
+		}
+		sample := derivedSample{metric: metric, value: value}
+		if tags, ok := obj["tags"]; ok {
+			if sample.tags, err = parseSampleTags(tags); err != nil {
+				return nil, fmt.Errorf("sample %d: %w", i, err)
+			}
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// fieldValue returns the number at the path of a message decoded from JSON, where the 64-bit
+// integers are strings. An unset field is 0, as protojson omits the fields with the default
+// value, and a boolean is 1 or 0.
+func fieldValue(message map[string]interface{}, segments []string) (float64, error) {
+	value, ok := lookupPath(message, segments)
+	if !ok {
+		return 0, nil
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, errors.New("is not a number")
+	}
+}
+
+// deriveSamples runs the onSample() hooks on the response of a unary call, and pushes the
+// samples they derive with the tags of the call
+func (c *Client) deriveSamples(method string, p *callParams, response *sobek.Object, responseJSON []byte) error {
+	if c.defaults == nil || c.defaults.sampleHooks == nil {
+		return nil
+	}
+	state := c.vu.State()
+	if state == nil {
+		return nil
+	}
+
+	method = dynamic.MethodPath(method)
+	samples, err := c.defaults.sampleHooks.derive(c.vu.Runtime(), method, response, responseJSON)
+	if err != nil || len(samples) == 0 {
+		return err
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags := c.createCallMetricTags(method, p)
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+
+	now := time.Now()
+	pushed := make(metrics.Samples, 0, len(samples))
+	for _, s := range samples {
+		sampleTags := ctm.Tags
+		for k, v := range s.tags {
+			sampleTags = sampleTags.With(k, v)
+		}
+		pushed = append(pushed, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: s.metric, Tags: sampleTags},
+			Time:       now,
+			Metadata:   ctm.Metadata,
+			Value:      s.value,
+		})
+	}
+	metrics.PushIfNotDone(c.vu.Context(), state.Samples, pushed)
+	return nil
+}
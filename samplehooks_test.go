@@ -0,0 +1,131 @@
+package connectrpc_test
+
+import (
+	"testing"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestOnSample(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	// The metrics of the script, like k6/metrics creates them
+	registry := ts.VU.InitEnvField.Registry
+	_, err := registry.NewMetric("ping_number", metrics.Trend)
+	require.NoError(t, err)
+	_, err = registry.NewMetric("pings", metrics.Counter)
+	require.NoError(t, err)
+
+	_, err = ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		connectrpc.onSample({
+			metric: 'ping_number',
+			field: 'number',
+			method: 'k6.connectrpc.ping.v1.PingService/Ping',
+			tags: { kpi: 'number' },
+		});
+		connectrpc.onSample(function(response, method) {
+			if (method.indexOf('/Ping') < 0 && response.status === 200) {
+				return;
+			}
+			return [{ metric: 'pings', value: 1, tags: { outcome: response.status === 200 ? 'ok' : 'failed' } }];
+		});
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 21 }, { tags: { call: 'sync' } });
+			await client.asyncInvoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 4 });
+			client.invoke('/k6.connectrpc.ping.v1.PingService/Fail', { code: 5 });
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	samples := drainSamples(ts.samples)
+
+	numbers := findSamples(samples, "ping_number")
+	require.Len(t, numbers, 2)
+	assert.Equal(t, 21.0, numbers[0].Value)
+	assert.Equal(t, 4.0, numbers[1].Value)
+	for _, s := range numbers {
+		assert.Equal(t, "number", s.Tags.Map()["kpi"])
+		assert.Equal(t, "/k6.connectrpc.ping.v1.PingService/Ping", s.Tags.Map()["method"])
+	}
+	assert.Equal(t, "sync", numbers[0].Tags.Map()["call"])
+
+	var outcomes []string
+	for _, s := range findSamples(samples, "pings") {
+		assert.Equal(t, 1.0, s.Value)
+		outcomes = append(outcomes, s.Tags.Map()["outcome"])
+	}
+	assert.Equal(t, []string{"ok", "ok", "failed"}, outcomes)
+}
+
+func TestOnSampleInvalid(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		Name        string
+		Hook        string
+		ErrContains string
+	}{
+		{"NotAHook", `'number'`, "invalid onSample hook: must be a function or an object like { metric, field }"},
+		{"UnknownMetric", `{ metric: 'missing', field: 'number' }`, `invalid onSample hook: unknown metric "missing", create it with k6/metrics first`},
+		{"MissingField", `{ metric: 'pings' }`, "invalid onSample hook: a field hook requires a metric and a field"},
+		{"UnknownKey", `{ metric: 'pings', field: 'number', every: 2 }`, `invalid onSample hook: unknown key "every", must be metric, field, method or tags`},
+		{"TextField", `{ metric: 'pings', field: 'text' }`, `invalid onSample field text: "hello" is not a number`},
+		{"Sample", `function() { return { metric: 'pings', value: 'one' }; }`, "invalid onSample samples: sample 0: value must be a number"},
+		{"SampleMetric", `function() { return [{ metric: 'missing', value: 1 }]; }`, `invalid onSample samples: sample 0: unknown metric "missing"`},
+		{"Callback", `function() { throw new Error('no KPI'); }`, "onSample callback failed: Error: no KPI"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+			_, err := ts.VU.InitEnvField.Registry.NewMetric("pings", metrics.Counter)
+			require.NoError(t, err)
+
+			_, err = ts.Run(`
+				connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+				connectrpc.onSample(` + tt.Hook + `);
+			`)
+			if err == nil {
+				ts.ToVUContext()
+				_, err = ts.Run(`
+					var client = new connectrpc.Client();
+					client.connect('` + srv.URL + `', { plaintext: true });
+					client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1, text: 'hello' });
+				`)
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.ErrContains)
+		})
+	}
+
+	// The hooks are registered in the init context only
+	ts := newTestState(t)
+	ts.ToVUContext()
+	_, err := ts.Run(`connectrpc.onSample(function() {});`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "onSample must be called in the init context")
+}
@@ -0,0 +1,71 @@
+package connectrpc
+
+import (
+	"context"
+	"time"
+
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/metrics"
+)
+
+// Sources of the client-side delays recorded in connectrpc_client_saturation
+const (
+	// saturationEventLoop is a result waiting for the JS event loop to run its callback
+	saturationEventLoop = "event_loop"
+	// saturationWriteQueue is stream.write() waiting for the previous message to be sent
+	saturationWriteQueue = "write_queue"
+)
+
+// saturationSources describe the sources in the warnings
+var saturationSources = map[string]string{
+	saturationEventLoop:  "the JS event loop was busy",
+	saturationWriteQueue: "the stream write queue was full",
+}
+
+const (
+	// saturationMinDelay is the shortest delay recorded, which keeps the hot paths cheap
+	saturationMinDelay = time.Millisecond
+	// saturationWarnDelay is the delay from which the VU warns that it limits the throughput
+	saturationWarnDelay = 100 * time.Millisecond
+)
+
+// recordSaturation records a delay caused by the client itself rather than the server under
+// test, warning once per VU and source when it's long enough to limit the throughput
+func (m *instanceMetrics) recordSaturation(ctx context.Context, vu modules.VU,
+	tags MetricTags, source string, delay time.Duration) {
+
+	if delay < saturationMinDelay {
+		return
+	}
+
+	state := vu.State()
+	if state == nil {
+		return
+	}
+
+	ctm := state.Tags.GetCurrentValues()
+	tags.setCustomTags(&ctm)
+	tags.setCallTags(&ctm)
+	ctm.SetTag("source", source)
+
+	metrics.PushIfNotDone(ctx, state.Samples, m.durationSamples(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: m.ConnectRPCClientSaturation,
+			Tags:   ctm.Tags,
+		},
+		Time:     time.Now(),
+		Metadata: ctm.Metadata,
+		Value:    metrics.D(delay),
+	}))
+
+	if delay < saturationWarnDelay {
+		return
+	}
+	if _, warned := m.saturationWarned.LoadOrStore(source, true); warned {
+		return
+	}
+	state.Logger.WithField("method", tags.Method).Warnf(
+		"%s, delaying %s by %s: the client, not the server under test, limits the throughput. "+
+			"See the connectrpc_client_saturation metric, tagged by source",
+		saturationSources[source], tags.Method, delay.Round(time.Millisecond))
+}
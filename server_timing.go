@@ -0,0 +1,203 @@
+package connectrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/sobek"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	serverTimingHeader  = "Server-Timing"
+	statusDetailsHeader = "Grpc-Status-Details-Bin"
+)
+
+// serverTiming is a metric of the Server-Timing header, like `db;dur=53.2;desc="Query"`
+type serverTiming struct {
+	Name        string
+	Duration    float64 // milliseconds, 0 when missing
+	HasDuration bool
+	Description string
+}
+
+// serverMetadata holds the server-reported information parsed from the response headers and trailers
+type serverMetadata struct {
+	timings       []serverTiming
+	statusDetails *statuspb.Status
+}
+
+// parseServerMetadata parses the Server-Timing and grpc-status-details-bin values of the
+// response headers and trailers. It returns nil if the server didn't send any of them.
+func parseServerMetadata(headers, trailers http.Header) *serverMetadata {
+	var m serverMetadata
+	for _, h := range []http.Header{headers, trailers} {
+		for _, value := range h.Values(serverTimingHeader) {
+			m.timings = append(m.timings, parseServerTiming(value)...)
+		}
+		if m.statusDetails == nil {
+			m.statusDetails = parseStatusDetails(h.Get(statusDetailsHeader))
+		}
+	}
+
+	if len(m.timings) == 0 && m.statusDetails == nil {
+		return nil
+	}
+	return &m
+}
+
+// parseServerTiming parses a Server-Timing header value as specified by
+// https://www.w3.org/TR/server-timing/. Invalid parameters are ignored.
+func parseServerTiming(value string) []serverTiming {
+	var timings []serverTiming
+	for _, metric := range splitQuoted(value, ',') {
+		params := splitQuoted(metric, ';')
+		name := strings.TrimSpace(params[0])
+		if name == "" {
+			continue
+		}
+
+		timing := serverTiming{Name: name}
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(param, "=")
+			val = unquote(strings.TrimSpace(val))
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "dur":
+				if timing.HasDuration {
+					continue
+				}
+				if d, err := strconv.ParseFloat(val, 64); err == nil {
+					timing.Duration = d
+					timing.HasDuration = true
+				}
+			case "desc":
+				if timing.Description == "" {
+					timing.Description = val
+				}
+			}
+		}
+		timings = append(timings, timing)
+	}
+	return timings
+}
+
+// splitQuoted splits s around sep, ignoring the separators inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote removes the quotes and escapes of a quoted string, or returns s as is
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+
+	var b strings.Builder
+	escaped := false
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseStatusDetails decodes a grpc-status-details-bin value, which is a base64 encoded
+// google.rpc.Status. It returns nil if the value is missing or invalid.
+func parseStatusDetails(value string) *statuspb.Status {
+	if value == "" {
+		return nil
+	}
+
+	// gRPC implementations don't agree on the padding
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil
+	}
+
+	status := &statuspb.Status{}
+	if err := proto.Unmarshal(data, status); err != nil {
+		return nil
+	}
+	return status
+}
+
+// set sets the serverTiming and statusDetails fields of a response object
+func (m *serverMetadata) set(rt *sobek.Runtime, responseObject *sobek.Object) {
+	if m == nil {
+		return
+	}
+
+	if len(m.timings) > 0 {
+		timings := make([]map[string]interface{}, len(m.timings))
+		for i, timing := range m.timings {
+			t := map[string]interface{}{"name": timing.Name}
+			if timing.HasDuration {
+				t["duration"] = timing.Duration
+			}
+			if timing.Description != "" {
+				t["description"] = timing.Description
+			}
+			timings[i] = t
+		}
+		must(rt, responseObject.Set("serverTiming", rt.ToValue(timings)))
+	}
+
+	if m.statusDetails != nil {
+		details := make([]map[string]interface{}, len(m.statusDetails.GetDetails()))
+		for i, detail := range m.statusDetails.GetDetails() {
+			d := map[string]interface{}{
+				"type":  strings.TrimPrefix(detail.GetTypeUrl(), "type.googleapis.com/"),
+				"bytes": detail.GetValue(),
+			}
+			// The value is only available for the message types known to the process
+			if msg, err := detail.UnmarshalNew(); err == nil {
+				if data, err := protojson.Marshal(msg); err == nil {
+					var value interface{}
+					if json.Unmarshal(data, &value) == nil {
+						d["value"] = value
+					}
+				}
+			}
+			details[i] = d
+		}
+
+		must(rt, responseObject.Set("statusDetails", rt.ToValue(map[string]interface{}{
+			"code":    m.statusDetails.GetCode(),
+			"message": m.statusDetails.GetMessage(),
+			"details": details,
+		})))
+	}
+}
+
+// recordServerTiming records the Server-Timing durations if enabled by the `serverTimingMetrics` parameter
+func (c *Client) recordServerTiming(tags MetricTags, server *serverMetadata) {
+	if c.metrics == nil || server == nil || c.connectParams == nil || !c.connectParams.ServerTiming {
+		return
+	}
+	c.metrics.recordServerTiming(c.vu.Context(), c.vu, tags, server.timings)
+}
@@ -0,0 +1,94 @@
+package connectrpc
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []serverTiming
+	}{
+		{
+			name:     "Empty",
+			value:    "",
+			expected: nil,
+		},
+		{
+			name:  "Duration and description",
+			value: `db;dur=53.2;desc="Query", app;dur=47`,
+			expected: []serverTiming{
+				{Name: "db", Duration: 53.2, HasDuration: true, Description: "Query"},
+				{Name: "app", Duration: 47, HasDuration: true},
+			},
+		},
+		{
+			name:  "Name only",
+			value: "miss",
+			expected: []serverTiming{
+				{Name: "miss"},
+			},
+		},
+		{
+			name:  "Quoted separators",
+			value: `cache;desc="hit, \"warm\"; L1";dur=0.3`,
+			expected: []serverTiming{
+				{Name: "cache", Duration: 0.3, HasDuration: true, Description: `hit, "warm"; L1`},
+			},
+		},
+		{
+			name:  "Invalid and repeated parameters",
+			value: "db;dur=abc, app;dur=1;dur=2, ;dur=3",
+			expected: []serverTiming{
+				{Name: "db"},
+				{Name: "app", Duration: 1, HasDuration: true},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, parseServerTiming(tc.value))
+		})
+	}
+}
+
+func TestParseServerMetadata(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, parseServerMetadata(http.Header{"Handler-Header": {"value"}}, nil))
+
+	status, err := proto.Marshal(&statuspb.Status{Code: 5, Message: "not found"})
+	require.NoError(t, err)
+
+	headers := http.Header{}
+	headers.Set("Server-Timing", "db;dur=1")
+	trailers := http.Header{}
+	trailers.Set("Server-Timing", "app;dur=2")
+	trailers.Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(status))
+
+	m := parseServerMetadata(headers, trailers)
+	require.NotNil(t, m)
+	assert.Equal(t, []serverTiming{
+		{Name: "db", Duration: 1, HasDuration: true},
+		{Name: "app", Duration: 2, HasDuration: true},
+	}, m.timings)
+	require.NotNil(t, m.statusDetails)
+	assert.Equal(t, int32(5), m.statusDetails.GetCode())
+	assert.Equal(t, "not found", m.statusDetails.GetMessage())
+
+	// Padded and invalid values
+	assert.NotNil(t, parseStatusDetails(base64.StdEncoding.EncodeToString(status)))
+	assert.Nil(t, parseStatusDetails("not base64!"))
+}
@@ -0,0 +1,511 @@
+package connectrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/metrics"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Actions of the session steps, each step being an object with one of them as its key
+const (
+	actionSend   = "send"
+	actionExpect = "expect"
+	actionWait   = "wait"
+	actionEnd    = "end"
+)
+
+// sessionStep is a step of connectrpc.session(), parsed before the session starts
+type sessionStep struct {
+	action string
+	send   *dynamicpb.Message // Message of a send step
+	expect *sessionExpect     // Expectation of an expect step
+	wait   time.Duration      // Duration of a wait step
+}
+
+// sessionExpect is the expectation of an expect step, `{ field: 'a.b', equals: value }`.
+// Without equals any message is expected, and without field equals is the whole message.
+type sessionExpect struct {
+	field  string
+	path   []protoreflect.FieldDescriptor // Fields from the message to the expected field
+	equals protoreflect.Message           // Message holding the expected value, nil for any message
+}
+
+// sessionStepResult is the outcome of a step which ran
+type sessionStepResult struct {
+	action   string
+	duration time.Duration
+	received []byte // JSON of the message received by an expect step
+}
+
+// sessionResult is the outcome of a session
+type sessionResult struct {
+	duration   time.Duration
+	steps      []sessionStepResult
+	failedStep int // Index of the step which failed, -1 if none did
+	err        error
+}
+
+// errSessionEnded fails an expect step of a session whose server ended the stream
+var errSessionEnded = errors.New("the stream ended before the expected message")
+
+// session runs a declarative conversation on a streaming method entirely in Go: the steps
+// send messages, expect messages with a field equal to a value, wait, and end the request
+// side. The returned promise resolves once the steps ran or one failed, with the duration of
+// each step. A failed expectation or RPC error resolves it with ok: false rather than
+// rejecting it.
+func (mi *ModuleInstance) session(
+	clientVal sobek.Value, method string, stepsVal sobek.Value, paramsVal sobek.Value,
+) (*sobek.Promise, error) {
+	if mi.vu.State() == nil {
+		return nil, common.NewInitContextError("session can't be called in the init context")
+	}
+	rt := mi.vu.Runtime()
+
+	client, err := extractClient(clientVal, rt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session client: %w", err)
+	}
+	method = dynamic.MethodPath(method)
+	methodDesc, err := client.getMethodDescriptor(method)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session method: %w", err)
+	}
+	if err := client.checkMethodType(method, methodDesc, true); err != nil {
+		return nil, fmt.Errorf("invalid session method: %w", err)
+	}
+
+	p, err := newCallParams(mi.vu, paramsVal, mi.defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session parameters: %w", err)
+	}
+	steps, err := parseSessionSteps(rt, stepsVal, methodDesc, client.requestUnmarshaler(p))
+	if err != nil {
+		return nil, fmt.Errorf("invalid session steps: %w", err)
+	}
+
+	if err := client.checkRampDown(); err != nil {
+		return nil, err
+	}
+	if err := client.refreshAuth(); err != nil {
+		return nil, err
+	}
+	if err := client.selectTarget(); err != nil {
+		return nil, err
+	}
+	p.SetSystemTags(mi.vu.State(), client.addr, method)
+
+	var httpClient *http.Client
+	if client.streamConnections() {
+		if client.connectParams == nil {
+			return nil, errNotConnected
+		}
+		httpClient, err = client.createHTTPClient(client.connectParams, client.addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP client for %s session: %w", client.connectionStrategy, err)
+		}
+	} else {
+		if client.httpClient == nil {
+			return nil, errNotConnected
+		}
+		if httpClient, err = client.vuHTTPClient(); err != nil {
+			return nil, err
+		}
+	}
+
+	tags := client.createCallMetricTags(method, p)
+	tags.Type = "stream"
+
+	promise, resolve, _ := rt.NewPromise()
+	endMock := client.beginMock()
+	callback := mi.vu.RegisterCallback()
+	go func() {
+		result := mi.runSession(client, httpClient, method, methodDesc, steps, p, tags)
+		if client.streamConnections() {
+			client.releaseHTTPClient(httpClient)
+		}
+		callback(func() error {
+			endMock()
+			return resolve(result.toObject(mi.vu.Runtime()))
+		})
+	}()
+	return promise, nil
+}
+
+// parseSessionSteps parses the steps of a session against the messages of the method
+func parseSessionSteps(
+	rt *sobek.Runtime, v sobek.Value, methodDesc protoreflect.MethodDescriptor, u requestUnmarshaler,
+) ([]sessionStep, error) {
+	if common.IsNullish(v) {
+		return nil, errors.New("must be an array of steps")
+	}
+	obj := v.ToObject(rt)
+	if obj.ClassName() != "Array" {
+		return nil, errors.New("must be an array of steps")
+	}
+
+	length := int(obj.Get("length").ToInteger())
+	steps := make([]sessionStep, 0, length)
+	ended := false
+	for i := 0; i < length; i++ {
+		step, err := parseSessionStep(rt, obj.Get(strconv.Itoa(i)), methodDesc, u)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i, err)
+		}
+		if ended && (step.action == actionSend || step.action == actionEnd) {
+			return nil, fmt.Errorf("step %d: %s after end", i, step.action)
+		}
+		ended = ended || step.action == actionEnd
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// parseSessionStep parses a step, an object with a single action as its key
+func parseSessionStep(
+	rt *sobek.Runtime, v sobek.Value, methodDesc protoreflect.MethodDescriptor, u requestUnmarshaler,
+) (sessionStep, error) {
+	obj, ok := v.(*sobek.Object)
+	if !ok {
+		return sessionStep{}, errors.New("must be an object like { send: {...} }")
+	}
+	keys := obj.Keys()
+	if len(keys) != 1 {
+		return sessionStep{}, fmt.Errorf("must have one of send, expect, wait or end, got %d keys", len(keys))
+	}
+
+	step := sessionStep{action: keys[0]}
+	value := obj.Get(step.action)
+	switch step.action {
+	case actionSend:
+		data, err := marshalRequest(rt, value)
+		if err != nil {
+			return step, fmt.Errorf("invalid send: %w", err)
+		}
+		step.send = dynamicpb.NewMessage(methodDesc.Input())
+		if err := u.unmarshal(data, step.send); err != nil {
+			return step, fmt.Errorf("invalid send: %w", err)
+		}
+	case actionExpect:
+		expect, err := parseSessionExpect(value, methodDesc.Output(), u)
+		if err != nil {
+			return step, fmt.Errorf("invalid expect: %w", err)
+		}
+		step.expect = expect
+	case actionWait:
+		s, ok := value.Export().(string)
+		d, err := time.ParseDuration(s)
+		if !ok || err != nil || d < 0 {
+			return step, fmt.Errorf("invalid wait: must be a duration string like '1s', got %s", value)
+		}
+		step.wait = d
+	case actionEnd:
+	default:
+		return step, fmt.Errorf("unknown action %q, must be send, expect, wait or end", step.action)
+	}
+	return step, nil
+}
+
+// parseSessionExpect parses `{ field: 'a.b', equals: value }`. The expected value is
+// unmarshaled like a request, so that enums may be given by name and 64-bit integers as
+// strings.
+func parseSessionExpect(v sobek.Value, desc protoreflect.MessageDescriptor, u requestUnmarshaler) (*sessionExpect, error) {
+	expect := &sessionExpect{}
+	if common.IsNullish(v) {
+		return expect, nil
+	}
+	obj, ok := v.(*sobek.Object)
+	if !ok {
+		return nil, errors.New("must be an object like { field: 'sum', equals: 5 }")
+	}
+
+	var equals interface{}
+	hasEquals := false
+	for _, k := range obj.Keys() {
+		switch k {
+		case "field":
+			field, ok := obj.Get(k).Export().(string)
+			if !ok || field == "" {
+				return nil, errors.New("field must be a field path like 'sum' or 'user.id'")
+			}
+			expect.field = field
+		case "equals":
+			equals = obj.Get(k).Export()
+			hasEquals = true
+		default:
+			return nil, fmt.Errorf("unknown key %q, must be field or equals", k)
+		}
+	}
+	if expect.field != "" && !hasEquals {
+		return nil, fmt.Errorf("field %s requires equals", expect.field)
+	}
+	if !hasEquals {
+		return expect, nil
+	}
+
+	received := desc
+	names := strings.Split(expect.field, ".")
+	if expect.field == "" {
+		names = nil
+	}
+	for i, name := range names {
+		fd := desc.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = desc.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %s of %s", name, desc.FullName())
+		}
+		expect.path = append(expect.path, fd)
+
+		if i < len(names)-1 {
+			if fd.IsList() || fd.IsMap() || fd.Message() == nil {
+				return nil, fmt.Errorf("%s is not a message", strings.Join(names[:i+1], "."))
+			}
+			desc = fd.Message()
+		}
+	}
+	// The expected value is nested in its fields, from the innermost one
+	for i := len(expect.path) - 1; i >= 0; i-- {
+		equals = map[string]interface{}{expect.path[i].JSONName(): equals}
+	}
+
+	data, err := json.Marshal(equals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid equals: %w", err)
+	}
+	expected := dynamicpb.NewMessage(received)
+	if err := u.unmarshal(data, expected); err != nil {
+		return nil, fmt.Errorf("invalid equals: %w", err)
+	}
+	expect.equals = expected
+	return expect, nil
+}
+
+// check checks a received message, returning the details of the mismatch if any
+func (e *sessionExpect) check(msg protoreflect.Message) string {
+	if e.equals == nil {
+		return ""
+	}
+	if len(e.path) == 0 {
+		if proto.Equal(msg.Interface(), e.equals.Interface()) {
+			return ""
+		}
+		return fmt.Sprintf("expected %s, got %s", formatMessage(e.equals), formatMessage(msg))
+	}
+
+	got, want := msg, e.equals
+	for _, fd := range e.path[:len(e.path)-1] {
+		got, want = got.Get(fd).Message(), want.Get(fd).Message()
+	}
+	fd := e.path[len(e.path)-1]
+	if got.Get(fd).Equal(want.Get(fd)) {
+		return ""
+	}
+	return fmt.Sprintf("expected %s to equal %v, got %v", e.field, want.Get(fd), got.Get(fd))
+}
+
+// formatMessage formats a message in the errors of the expectations
+func formatMessage(msg protoreflect.Message) string {
+	data, err := protojson.Marshal(msg.Interface())
+	if err != nil {
+		return fmt.Sprint(msg.Interface())
+	}
+	return string(data)
+}
+
+// runSession runs the steps of a session, recording the stream and the duration of each
+// step. It runs outside of the event loop.
+func (mi *ModuleInstance) runSession(
+	client *Client,
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+	steps []sessionStep,
+	p *callParams,
+	tags MetricTags,
+) *sessionResult {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if p.Timeout != nil && *p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(mi.vu.Context(), *p.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(mi.vu.Context())
+	}
+	defer cancel()
+	ctx, _ = withPeerInfo(ctx)
+	ctx = withRPCTags(ctx, tags)
+
+	connectStream := client.dynamicClient(httpClient, method, methodDesc).CallBidiStream(ctx)
+	if client.connectParams != nil {
+		client.connectParams.setHeaders(connectStream.RequestHeader())
+	}
+	client.defaultHeaders.Load().apply(connectStream.RequestHeader())
+	for key, value := range p.Metadata {
+		connectStream.RequestHeader().Set(key, value)
+	}
+
+	if mi.metrics != nil {
+		mi.metrics.recordStreamStart(mi.vu.Context(), mi.vu, tags)
+		mi.metrics.recordActiveStreams(mi.vu.Context(), mi.vu, client.baseURL, httpClient, 1)
+	}
+
+	r := &sessionRunner{mi: mi, stream: connectStream, tags: tags}
+	result := &sessionResult{failedStep: -1}
+	start := time.Now()
+	for i, step := range steps {
+		stepStart := time.Now()
+		received, err := r.run(ctx, step)
+		duration := time.Since(stepStart)
+		result.steps = append(result.steps, sessionStepResult{action: step.action, duration: duration, received: received})
+
+		if mi.metrics != nil {
+			mi.metrics.recordSessionStep(mi.vu.Context(), mi.vu, tags, i, step.action, duration)
+		}
+		if err != nil {
+			result.failedStep = i
+			result.err = err
+			break
+		}
+	}
+
+	if result.err == nil && !r.ended {
+		_ = connectStream.CloseRequest()
+	}
+	cancel() // Discards what the server still sends, the session being over
+	_ = connectStream.CloseResponse()
+	result.duration = time.Since(start)
+
+	if mi.metrics != nil {
+		mi.metrics.recordStreamEnd(mi.vu.Context(), mi.vu, result.duration, tags, result.err)
+		mi.metrics.recordActiveStreams(mi.vu.Context(), mi.vu, client.baseURL, httpClient, -1)
+	}
+	return result
+}
+
+// sessionRunner runs the steps of a session on its stream
+type sessionRunner struct {
+	mi     *ModuleInstance
+	stream *connect.BidiStreamForClient[dynamicpb.Message, dynamicpb.Message]
+	tags   MetricTags
+	opened bool // Whether the request headers were sent
+	ended  bool // Whether the request side was closed
+}
+
+// run runs a step, returning the JSON of the message received by an expect step
+func (r *sessionRunner) run(ctx context.Context, step sessionStep) ([]byte, error) {
+	switch step.action {
+	case actionSend:
+		return nil, r.send(step.send)
+	case actionExpect:
+		return r.expect(step.expect)
+	case actionWait:
+		timer := time.NewTimer(step.wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	default:
+		r.ended = true
+		return nil, r.stream.CloseRequest()
+	}
+}
+
+// send sends a message. The server having ended the stream, its error is received.
+func (r *sessionRunner) send(msg *dynamicpb.Message) error {
+	r.opened = true
+	if err := r.stream.Send(msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			if _, err := r.stream.Receive(); err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			return errSessionEnded
+		}
+		return err
+	}
+
+	if r.mi.metrics != nil {
+		r.mi.metrics.recordStreamMessage(r.mi.vu.Context(), r.mi.vu, r.tags, "sent", int64(proto.Size(msg)))
+	}
+	return nil
+}
+
+// expect receives a message and checks it against the expectation
+func (r *sessionRunner) expect(expect *sessionExpect) ([]byte, error) {
+	if !r.opened {
+		// Send the request headers, for the servers speaking first
+		r.opened = true
+		if err := r.stream.Send(nil); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+
+	msg, err := r.stream.Receive()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errSessionEnded
+		}
+		return nil, err
+	}
+	received, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mi.metrics != nil {
+		r.mi.metrics.recordStreamMessage(r.mi.vu.Context(), r.mi.vu, r.tags, "received", int64(len(received)))
+	}
+	if detail := expect.check(msg.ProtoReflect()); detail != "" {
+		return received, errors.New(detail)
+	}
+	return received, nil
+}
+
+// toObject returns the result given to the script:
+// { ok, duration, steps: [{ action, duration, message }], failedStep, error, code }
+func (r *sessionResult) toObject(rt *sobek.Runtime) *sobek.Object {
+	steps := make([]interface{}, 0, len(r.steps))
+	for _, step := range r.steps {
+		s := rt.NewObject()
+		must(rt, s.Set("action", step.action))
+		must(rt, s.Set("duration", metrics.D(step.duration)))
+		if step.received != nil {
+			var message interface{}
+			if err := json.Unmarshal(step.received, &message); err == nil {
+				must(rt, s.Set("message", message))
+			}
+		}
+		steps = append(steps, s)
+	}
+
+	obj := rt.NewObject()
+	must(rt, obj.Set("ok", r.err == nil))
+	must(rt, obj.Set("duration", metrics.D(r.duration)))
+	must(rt, obj.Set("steps", steps))
+	if r.err != nil {
+		must(rt, obj.Set("failedStep", r.failedStep))
+		must(rt, obj.Set("error", r.err.Error()))
+		if connectErr := new(connect.Error); errors.As(r.err, &connectErr) {
+			must(rt, obj.Set("code", connectErr.Code().String()))
+		}
+	}
+	return obj
+}
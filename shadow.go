@@ -0,0 +1,61 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/sobek"
+)
+
+// defaultShadowHeaders are the headers of the shadow traffic when `shadow` doesn't name them
+var defaultShadowHeaders = map[string]string{"x-shadow-request": "true"}
+
+// shadowTag is the tag of the metrics of the shadow traffic
+const shadowTag = "shadow"
+
+// parseShadow parses the `shadow` connect param: true for the default headers, or an object
+// like { headers: { 'x-dark-traffic': '1' } } naming them. It returns nil when shadowing is off.
+func parseShadow(val sobek.Value) (map[string]string, error) {
+	switch shadow := val.Export().(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !shadow {
+			return nil, nil
+		}
+		return defaultShadowHeaders, nil
+	case map[string]interface{}:
+		headersVal, ok := shadow["headers"]
+		if !ok || headersVal == nil {
+			return defaultShadowHeaders, nil
+		}
+		rawHeaders, ok := headersVal.(map[string]interface{})
+		if !ok || len(rawHeaders) == 0 {
+			return nil, errors.New("headers must be a non-empty object")
+		}
+		headers := make(map[string]string, len(rawHeaders))
+		for name, value := range rawHeaders {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("header %q must be a string, got %T", name, value)
+			}
+			headers[name] = s
+		}
+		return headers, nil
+	default:
+		return nil, fmt.Errorf("must be a boolean or an object, got %T", shadow)
+	}
+}
+
+// tagShadow adds the shadow=true tag to the metrics of the client, unless the `tags` set it
+func (p *connectParams) tagShadow() {
+	if p.Shadow == nil {
+		return
+	}
+	tags := make(map[string]string, len(p.Tags)+1)
+	tags[shadowTag] = "true"
+	for k, v := range p.Tags {
+		tags[k] = v
+	}
+	p.Tags = tags
+}
@@ -0,0 +1,369 @@
+package connectrpc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestSigner signs an outgoing HTTP request before it is sent.
+//
+// body holds the full request payload for unary calls. For streaming calls
+// the payload is not known up-front and body is nil with unsigned set to true,
+// so signers must sign headers only.
+type requestSigner interface {
+	Sign(req *http.Request, body []byte, unsigned bool, now time.Time) error
+}
+
+// newRequestSigner creates a request signer from the `auth` connect parameter, looking up
+// the credentials of `credentialsFromEnv` with lookupEnv
+func newRequestSigner(auth map[string]interface{}, lookupEnv func(string) (string, bool)) (requestSigner, error) {
+	authType, _ := auth["type"].(string)
+
+	switch authType {
+	case "sigv4":
+		return newSigV4Signer(auth, lookupEnv)
+	case "hmac":
+		return newHMACSigner(auth)
+	case "basic":
+		return newBasicAuthSigner(auth)
+	case "bearer":
+		return newBearerSigner(auth)
+	case "":
+		return nil, errors.New("auth type is required")
+	default:
+		return nil, fmt.Errorf("invalid auth type: %s. Must be 'sigv4', 'hmac', 'basic' or 'bearer'", authType)
+	}
+}
+
+// sigV4Signer signs requests with AWS Signature Version 4
+type sigV4Signer struct {
+	region          string
+	service         string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+func newSigV4Signer(auth map[string]interface{}, lookupEnv func(string) (string, bool)) (*sigV4Signer, error) {
+	s := &sigV4Signer{}
+	s.region, _ = auth["region"].(string)
+	s.service, _ = auth["service"].(string)
+	s.accessKeyID, _ = auth["accessKeyId"].(string)
+	s.secretAccessKey, _ = auth["secretAccessKey"].(string)
+	s.sessionToken, _ = auth["sessionToken"].(string)
+
+	if fromEnv, ok := auth["credentialsFromEnv"].(bool); ok && fromEnv && lookupEnv != nil {
+		s.accessKeyID, _ = lookupEnv("AWS_ACCESS_KEY_ID")
+		s.secretAccessKey, _ = lookupEnv("AWS_SECRET_ACCESS_KEY")
+		s.sessionToken, _ = lookupEnv("AWS_SESSION_TOKEN")
+	}
+
+	if s.region == "" {
+		return nil, errors.New("sigv4 auth requires a region")
+	}
+	if s.service == "" {
+		return nil, errors.New("sigv4 auth requires a service")
+	}
+	if s.accessKeyID == "" || s.secretAccessKey == "" {
+		return nil, errors.New("sigv4 auth requires accessKeyId and secretAccessKey (or credentialsFromEnv: true)")
+	}
+
+	return s, nil
+}
+
+const (
+	sigV4Algorithm     = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat    = "20060102T150405Z"
+	sigV4DateFormat    = "20060102"
+	sigV4UnsignedBody  = "UNSIGNED-PAYLOAD"
+	sigV4ContentSHA256 = "X-Amz-Content-Sha256"
+)
+
+// Sign adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers to the request
+func (s *sigV4Signer) Sign(req *http.Request, body []byte, unsigned bool, now time.Time) error {
+	now = now.UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	date := now.Format(sigV4DateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	payloadHash := sigV4UnsignedBody
+	if unsigned {
+		req.Header.Set(sigV4ContentSHA256, sigV4UnsignedBody)
+	} else {
+		payloadHash = hexSHA256(body)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	signedHeaders, canonicalHeaders := sigV4CanonicalHeaders(req.Header, host)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4CanonicalURI(req.URL),
+		sigV4CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.region, s.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretAccessKey), []byte(date))
+	signingKey = hmacSHA256(signingKey, []byte(s.region))
+	signingKey = hmacSHA256(signingKey, []byte(s.service))
+	signingKey = hmacSHA256(signingKey, []byte("aws4_request"))
+	signature := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.accessKeyID, scope, signedHeaders, signature,
+	))
+
+	return nil
+}
+
+// sigV4CanonicalHeaders returns the signed header list and the canonical header block.
+// Only the headers relevant to the signature are signed, so that transport-level
+// headers added later (e.g. by HTTP/2) don't invalidate it.
+func sigV4CanonicalHeaders(header http.Header, host string) (string, string) {
+	values := map[string]string{"host": strings.TrimSpace(host)}
+	for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token", sigV4ContentSHA256} {
+		if v := header.Values(name); len(v) > 0 {
+			trimmed := make([]string, len(v))
+			for i, value := range v {
+				trimmed[i] = strings.Join(strings.Fields(value), " ")
+			}
+			values[strings.ToLower(name)] = strings.Join(trimmed, ",")
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name)
+		canonical.WriteByte(':')
+		canonical.WriteString(values[name])
+		canonical.WriteByte('\n')
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// sigV4CanonicalURI encodes each path segment twice, as required for non-S3 services
+func sigV4CanonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = sigV4Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4CanonicalQuery sorts and encodes query parameters
+func sigV4CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, sigV4Escape(k)+"="+sigV4Escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything except the RFC 3986 unreserved characters
+func sigV4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// hmacSigner signs the request method, path, timestamp and body with a shared secret
+type hmacSigner struct {
+	secret          []byte
+	newHash         func() hash.Hash
+	header          string
+	timestampHeader string
+}
+
+func newHMACSigner(auth map[string]interface{}) (*hmacSigner, error) {
+	s := &hmacSigner{
+		newHash:         sha256.New,
+		header:          "X-Signature",
+		timestampHeader: "X-Signature-Timestamp",
+	}
+
+	secret, _ := auth["secret"].(string)
+	if secret == "" {
+		return nil, errors.New("hmac auth requires a secret")
+	}
+	s.secret = []byte(secret)
+
+	if algorithm, ok := auth["algorithm"].(string); ok {
+		switch algorithm {
+		case "sha256":
+			s.newHash = sha256.New
+		case "sha512":
+			s.newHash = sha512.New
+		default:
+			return nil, fmt.Errorf("invalid hmac algorithm: %s. Must be 'sha256' or 'sha512'", algorithm)
+		}
+	}
+	if header, ok := auth["header"].(string); ok && header != "" {
+		s.header = header
+	}
+	if header, ok := auth["timestampHeader"].(string); ok && header != "" {
+		s.timestampHeader = header
+	}
+
+	return s, nil
+}
+
+// Sign computes hex(HMAC(secret, method + "\n" + path + "\n" + timestamp + "\n" + body))
+func (s *hmacSigner) Sign(req *http.Request, body []byte, _ bool, now time.Time) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	mac := hmac.New(s.newHash, s.secret)
+	mac.Write([]byte(req.Method + "\n" + req.URL.EscapedPath() + "\n" + timestamp + "\n"))
+	mac.Write(body)
+
+	req.Header.Set(s.timestampHeader, timestamp)
+	req.Header.Set(s.header, hex.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+// basicAuthSigner sets HTTP Basic credentials, like k6/http's `auth: 'basic'`
+type basicAuthSigner struct {
+	username string
+	password string
+}
+
+func newBasicAuthSigner(auth map[string]interface{}) (*basicAuthSigner, error) {
+	s := &basicAuthSigner{}
+	s.username, _ = auth["username"].(string)
+	s.password, _ = auth["password"].(string)
+
+	if s.username == "" {
+		return nil, errors.New("basic auth requires a username")
+	}
+
+	return s, nil
+}
+
+// Sign sets the Authorization header
+func (s *basicAuthSigner) Sign(req *http.Request, _ []byte, _ bool, _ time.Time) error {
+	req.SetBasicAuth(s.username, s.password)
+	return nil
+}
+
+// bearerSigner sets a static bearer token
+type bearerSigner struct {
+	token string
+}
+
+func newBearerSigner(auth map[string]interface{}) (*bearerSigner, error) {
+	token, _ := auth["token"].(string)
+	if token == "" {
+		return nil, errors.New("bearer auth requires a token")
+	}
+
+	return &bearerSigner{token: token}, nil
+}
+
+// Sign sets the Authorization header
+func (s *bearerSigner) Sign(req *http.Request, _ []byte, _ bool, _ time.Time) error {
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	return nil
+}
+
+// signingTransport wraps http.RoundTripper to sign every request before sending it
+type signingTransport struct {
+	base   http.RoundTripper
+	signer requestSigner
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+
+	var body []byte
+	unsigned := true
+	if req.GetBody != nil {
+		// Unary calls have a rewindable body: read it for signing, then rewind
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		body, err = io.ReadAll(rc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		unsigned = false
+	} else if req.Body == nil || req.Body == http.NoBody {
+		unsigned = false
+	}
+
+	if err := t.signer.Sign(req, body, unsigned, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *signingTransport) CloseIdleConnections() {
+	closeIdleConnections(t.base)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,191 @@
+package connectrpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigV4SignerVanilla(t *testing.T) {
+	t.Parallel()
+
+	// get-vanilla from the AWS Signature Version 4 test suite
+	signer, err := newSigV4Signer(map[string]interface{}{
+		"region":          "us-east-1",
+		"service":         "service",
+		"accessKeyId":     "AKIDEXAMPLE",
+		"secretAccessKey": "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, nil)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	require.NoError(t, signer.Sign(req, nil, false, now))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestSigV4SignerUnsignedPayload(t *testing.T) {
+	t.Parallel()
+
+	signer, err := newSigV4Signer(map[string]interface{}{
+		"region":          "eu-west-1",
+		"service":         "execute-api",
+		"accessKeyId":     "AKID",
+		"secretAccessKey": "secret",
+		"sessionToken":    "token",
+	}, nil)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/pkg.Service/Stream", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/connect+json")
+
+	require.NoError(t, signer.Sign(req, nil, true, time.Now()))
+
+	assert.Equal(t, "UNSIGNED-PAYLOAD", req.Header.Get("X-Amz-Content-Sha256"))
+	assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+	assert.Contains(t, req.Header.Get("Authorization"),
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token")
+}
+
+func TestSigV4SignerCredentialsFromEnv(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_SESSION_TOKEN": "token"}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	signer, err := newSigV4Signer(map[string]interface{}{
+		"region":             "eu-west-1",
+		"service":            "execute-api",
+		"credentialsFromEnv": true,
+	}, lookupEnv)
+	require.NoError(t, err)
+	assert.Equal(t, "AKID", signer.accessKeyID)
+	assert.Equal(t, "secret", signer.secretAccessKey)
+	assert.Equal(t, "token", signer.sessionToken)
+
+	_, err = newSigV4Signer(map[string]interface{}{
+		"region":             "eu-west-1",
+		"service":            "execute-api",
+		"credentialsFromEnv": true,
+	}, func(string) (string, bool) { return "", false })
+	require.ErrorContains(t, err, "requires accessKeyId and secretAccessKey")
+}
+
+func TestHMACSigner(t *testing.T) {
+	t.Parallel()
+
+	signer, err := newHMACSigner(map[string]interface{}{
+		"secret": "s3cr3t",
+		"header": "X-Custom-Signature",
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/pkg.Service/Method", nil)
+	require.NoError(t, err)
+
+	body := []byte(`{"number":1}`)
+	now := time.Unix(1700000000, 0)
+	require.NoError(t, signer.Sign(req, body, false, now))
+
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte("POST\n/pkg.Service/Method\n1700000000\n"))
+	mac.Write(body)
+
+	assert.Equal(t, "1700000000", req.Header.Get("X-Signature-Timestamp"))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Custom-Signature"))
+}
+
+func TestBasicAndBearerSigners(t *testing.T) {
+	t.Parallel()
+
+	basic, err := newRequestSigner(map[string]interface{}{"type": "basic", "username": "user", "password": "pass"}, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/pkg.Service/Method", nil)
+	require.NoError(t, basic.Sign(req, nil, false, time.Now()))
+	username, password, ok := req.BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "pass", password)
+
+	bearer, err := newRequestSigner(map[string]interface{}{"type": "bearer", "token": "abc"}, nil)
+	require.NoError(t, err)
+
+	req = httptest.NewRequest(http.MethodPost, "https://example.com/pkg.Service/Method", nil)
+	require.NoError(t, bearer.Sign(req, nil, true, time.Now()))
+	assert.Equal(t, "Bearer abc", req.Header.Get("Authorization"))
+}
+
+func TestNewRequestSignerInvalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name        string
+		Auth        map[string]interface{}
+		ErrContains string
+	}{
+		{"MissingType", map[string]interface{}{}, "auth type is required"},
+		{"UnknownType", map[string]interface{}{"type": "kerberos"}, "invalid auth type: kerberos"},
+		{"SigV4MissingRegion", map[string]interface{}{"type": "sigv4", "service": "s"}, "requires a region"},
+		{"SigV4MissingCredentials", map[string]interface{}{"type": "sigv4", "region": "r", "service": "s"}, "requires accessKeyId"},
+		{"HMACMissingSecret", map[string]interface{}{"type": "hmac"}, "requires a secret"},
+		{"BasicMissingUsername", map[string]interface{}{"type": "basic", "password": "x"}, "requires a username"},
+		{"BearerMissingToken", map[string]interface{}{"type": "bearer"}, "requires a token"},
+		{"HMACInvalidAlgorithm", map[string]interface{}{"type": "hmac", "secret": "x", "algorithm": "md5"}, "invalid hmac algorithm"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newRequestSigner(tc.Auth, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.ErrContains)
+		})
+	}
+}
+
+func TestSigningTransportPreservesBody(t *testing.T) {
+	t.Parallel()
+
+	var gotBody, gotSignature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		gotSignature = r.Header.Get("X-Signature")
+	}))
+	defer srv.Close()
+
+	signer, err := newHMACSigner(map[string]interface{}{"secret": "key"})
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: &signingTransport{base: http.DefaultTransport, signer: signer}}
+	resp, err := client.Post(srv.URL+"/pkg.Service/Method", "application/json", strings.NewReader(`{"a":1}`))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, `{"a":1}`, gotBody)
+	assert.NotEmpty(t, gotSignature)
+}
@@ -0,0 +1,82 @@
+package connectrpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// streamSink drains the messages received by a stream in Go, without delivering them
+// to JS. Only its summary is given to the 'end' listeners, which enables high throughput
+// download tests. It is only used by the read loop.
+type streamSink struct {
+	mode     string // 'discard', 'count' or 'sha256'
+	messages int64
+	bytes    int64
+	hash     hash.Hash
+}
+
+// newStreamSink creates the sink of the `sink` call parameter, or returns nil without sink
+func newStreamSink(mode string) *streamSink {
+	if mode == "" {
+		return nil
+	}
+
+	sink := &streamSink{mode: mode}
+	if mode == "sha256" {
+		sink.hash = sha256.New()
+	}
+	return sink
+}
+
+// summary returns the stats of the received messages: their count, plus their total size
+// in protobuf wire format with 'count' and 'sha256', and their SHA-256 with 'sha256'
+func (k *streamSink) summary() map[string]interface{} {
+	summary := map[string]interface{}{
+		"sink":     k.mode,
+		"messages": k.messages,
+	}
+	if k.mode != "discard" {
+		summary["bytes"] = k.bytes
+	}
+	if k.hash != nil {
+		summary["sha256"] = hex.EncodeToString(k.hash.Sum(nil))
+	}
+	return summary
+}
+
+// drain accounts for the message received in s.recvMsg
+func (s *stream) drain() error {
+	k := s.sink
+	k.messages++
+
+	// Discarded messages aren't measured, so they don't count as empty in the size metrics
+	size := int64(unknownMessageSize)
+	switch k.mode {
+	case "count":
+		size = int64(proto.Size(s.recvMsg))
+	case "sha256":
+		bufPtr, _ := marshalBufPool.Get().(*[]byte)
+		defer marshalBufPool.Put(bufPtr)
+
+		// Deterministic, so the hash of identical messages doesn't depend on map ordering
+		b, err := proto.MarshalOptions{Deterministic: true}.MarshalAppend((*bufPtr)[:0], s.recvMsg)
+		if err != nil {
+			return err
+		}
+		*bufPtr = b
+
+		_, _ = k.hash.Write(b)
+		size = int64(len(b))
+	}
+	if size != unknownMessageSize {
+		k.bytes += size
+	}
+
+	if s.instanceMetrics != nil {
+		s.instanceMetrics.recordStreamMessage(s.vu.Context(), s.vu, s.metricTags, "received", size)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/metrics"
+)
+
+// sloBreachTag tags the samples of the unary calls with a latency budget with whether
+// they exceeded it
+const sloBreachTag = "slo_breach"
+
+// parseSLO parses the `slo` call parameter, the latency budget of a unary call like '150ms'
+func parseSLO(v sobek.Value) (time.Duration, error) {
+	if common.IsNullish(v) {
+		return 0, nil
+	}
+	s, ok := v.Export().(string)
+	if !ok {
+		return 0, fmt.Errorf("must be a duration string like '150ms', got %s", v.ExportType())
+	}
+	slo, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if slo <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return slo, nil
+}
+
+// setSLOBreach tags the samples of a unary call with whether its duration exceeded its
+// latency budget, and returns true if it did. Calls without a budget are not tagged.
+func (t MetricTags) setSLOBreach(ctm *metrics.TagsAndMeta, duration time.Duration) bool {
+	if t.SLO <= 0 {
+		return false
+	}
+	breach := duration > t.SLO
+	ctm.SetTag(sloBreachTag, strconv.FormatBool(breach))
+	return breach
+}
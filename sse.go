@@ -0,0 +1,258 @@
+package connectrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	sseContentType = "text/event-stream"
+
+	// Flags of the Connect streaming envelopes
+	envelopeCompressed = 0x01
+	envelopeEndStream  = 0x02
+)
+
+// sseEndOfStream is the end of a stream whose events ended without an `end` event
+var sseEndOfStream = []byte("{}")
+
+// checkSSE checks that a stream can read its responses as server-sent events, with the
+// `sse: true` stream parameter: only the server streams of the Connect protocol with JSON
+// have an SSE form, the message being the data of each event
+func (c *Client) checkSSE(methodDesc protoreflect.MethodDescriptor) error {
+	if !methodDesc.IsStreamingServer() || methodDesc.IsStreamingClient() {
+		return fmt.Errorf("sse is for server streaming methods, %s isn't one", methodDesc.FullName())
+	}
+	if c.connectParams != nil && c.connectParams.Protocol != "connect" {
+		return fmt.Errorf("sse requires the connect protocol, not %s", c.connectParams.Protocol)
+	}
+	if c.connectParams != nil && c.connectParams.ContentType != "application/json" {
+		return fmt.Errorf("sse requires the application/json content type, not %s", c.connectParams.ContentType)
+	}
+	return nil
+}
+
+// sseDynamicClient returns the connect client of a stream reading its responses as SSE.
+// It isn't cached like dynamicClient, as it has its own copy of the HTTP client.
+func (c *Client) sseDynamicClient(
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+) *connect.Client[dynamicpb.Message, dynamicpb.Message] {
+	client := *httpClient
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &sseTransport{base: base}
+	return connect.NewClient[dynamicpb.Message, dynamicpb.Message](&client, c.baseURL+method, c.clientOptions(methodDesc)...)
+}
+
+// sseTransport speaks the Server-Sent Events form of the Connect server streams, which
+// gateways serve to the clients streaming over fetch(): the request message is sent as a
+// plain JSON body, and each response message comes as the data of an event. The request
+// envelope is unwrapped and the events wrapped back in envelopes, so that connect-go sees
+// a Connect stream, with an `end` event as its end-stream message and an `error` event as
+// its error.
+type sseTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the message of a Connect server stream as an SSE request
+func (t *sseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	contentType := req.Header.Get("Content-Type")
+
+	message, err := readRequestEnvelope(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", sseContentType)
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Del("Connect-Content-Encoding")
+	req.Header.Del("Connect-Accept-Encoding")
+	req.Body = io.NopCloser(bytes.NewReader(message))
+	req.ContentLength = int64(len(message))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(message)), nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// connect-go turns the other statuses into errors by their HTTP status
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != sseContentType {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("sse: unexpected response content type %q, want %s",
+			resp.Header.Get("Content-Type"), sseContentType)
+	}
+
+	resp.Header.Set("Content-Type", contentType)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	// The SSE request was sent whole, so connect-go's check that its bidi streams are full
+	// duplex, which requires HTTP/2, doesn't apply: SSE is mostly served over HTTP/1.1
+	resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/2.0", 2, 0
+	resp.Body = newSSEDecoder(resp.Body)
+	return resp, nil
+}
+
+// readRequestEnvelope reads the message of the first envelope of a request body, the only
+// message of a server stream, and closes the body
+func readRequestEnvelope(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, errors.New("sse: the stream ended before its request message")
+	}
+	defer func() { _ = body.Close() }()
+
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("sse: the stream ended before its request message")
+		}
+		return nil, fmt.Errorf("sse: failed to read the request message: %w", err)
+	}
+	if prefix[0]&envelopeCompressed != 0 {
+		return nil, errors.New("sse: compressed request messages aren't supported")
+	}
+
+	message := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, fmt.Errorf("sse: failed to read the request message: %w", err)
+	}
+	return message, nil
+}
+
+// sseDecoder wraps the events of an SSE response body in Connect envelopes: the data of
+// the message events as messages, an `end` event as the end-stream message, and an
+// `error` event, the JSON of a Connect error, as the error of the end-stream message. The
+// comments, which servers send to keep the connection alive, and other events are skipped.
+type sseDecoder struct {
+	body    io.ReadCloser
+	events  *bufio.Reader
+	pending []byte
+	ended   bool
+}
+
+func newSSEDecoder(body io.ReadCloser) *sseDecoder {
+	return &sseDecoder{body: body, events: bufio.NewReader(body)}
+}
+
+func (d *sseDecoder) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.ended {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// next wraps the next event in an envelope
+func (d *sseDecoder) next() error {
+	event, data, err := d.readEvent()
+	if errors.Is(err, io.EOF) {
+		d.envelope(envelopeEndStream, sseEndOfStream)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch event {
+	case "", "message":
+		d.envelope(0, data)
+	case "end":
+		if len(bytes.TrimSpace(data)) == 0 {
+			data = sseEndOfStream
+		}
+		d.envelope(envelopeEndStream, data)
+	case "error":
+		if !json.Valid(data) {
+			return fmt.Errorf("sse: invalid error event %q", data)
+		}
+		d.envelope(envelopeEndStream, append(append([]byte(`{"error":`), data...), '}'))
+	}
+	return nil
+}
+
+// envelope queues an envelope, the end-stream one ending the stream
+func (d *sseDecoder) envelope(flags byte, data []byte) {
+	d.pending = append(d.pending, flags)
+	d.pending = binary.BigEndian.AppendUint32(d.pending, uint32(len(data)))
+	d.pending = append(d.pending, data...)
+	d.ended = flags&envelopeEndStream != 0
+}
+
+// readEvent reads the next event with data, returning io.EOF at the end of the body
+func (d *sseDecoder) readEvent() (string, []byte, error) {
+	var event string
+	var data []byte
+	hasData := false
+	for {
+		line, err := d.events.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if hasData {
+				return event, data, nil
+			}
+			event = ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // Comment
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if hasData {
+				data = append(data, '\n')
+			}
+			data = append(data, value...)
+			hasData = true
+		case "id", "retry":
+			// Reconnections aren't supported, a load test reconnects with a new stream
+		}
+
+		// The last event of a body without a final blank line
+		if errors.Is(err, io.EOF) && hasData {
+			return event, data, nil
+		}
+	}
+}
+
+func (d *sseDecoder) Close() error {
+	return d.body.Close()
+}
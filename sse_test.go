@@ -0,0 +1,65 @@
+package connectrpc
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEDecoder(t *testing.T) {
+	t.Parallel()
+
+	envelope := func(flags byte, data string) string {
+		prefix := []byte{flags}
+		prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(data)))
+		return string(prefix) + data
+	}
+
+	testCases := []struct {
+		Name string
+		Body string
+		Want string
+	}{
+		{
+			"Messages",
+			"data: {\"number\": \"1\"}\n\nevent: message\ndata: {\"number\": \"2\"}\n\nevent: end\ndata: {}\n\n",
+			envelope(0, `{"number": "1"}`) + envelope(0, `{"number": "2"}`) + envelope(envelopeEndStream, `{}`),
+		},
+		{
+			"CommentsAndCRLF",
+			": keep-alive\r\n\r\nid: 1\r\ndata: {\"number\":\r\ndata: \"1\"}\r\n\r\nevent: ping\r\ndata: skipped\r\n\r\n",
+			envelope(0, "{\"number\":\n\"1\"}") + envelope(envelopeEndStream, `{}`),
+		},
+		{
+			"Error",
+			"event: error\ndata: {\"code\": \"unavailable\"}\n\ndata: {}\n\n",
+			envelope(envelopeEndStream, `{"error":{"code": "unavailable"}}`),
+		},
+		{
+			"UnterminatedEvent",
+			"data: {}\n\nevent: end\ndata: {\"metadata\": {}}",
+			envelope(0, `{}`) + envelope(envelopeEndStream, `{"metadata": {}}`),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			body := io.NopCloser(iotest.HalfReader(strings.NewReader(tc.Body)))
+			decoded, err := io.ReadAll(newSSEDecoder(body))
+			require.NoError(t, err)
+			assert.Equal(t, tc.Want, string(decoded))
+		})
+	}
+
+	body := io.NopCloser(strings.NewReader("event: error\ndata: unavailable\n\n"))
+	_, err := io.ReadAll(newSSEDecoder(body))
+	assert.ErrorContains(t, err, `sse: invalid error event "unavailable"`)
+}
@@ -0,0 +1,151 @@
+package connectrpc
+
+import (
+	"fmt"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/sobek"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// RegisterFiles registers the proto files of generated Go packages, like
+// pingv1.File_ping_v1_ping_proto, with their imports. Their methods can be invoked without
+// loadProtos(), and the unary calls marshal their messages with the generated Go types
+// instead of dynamicpb. It is meant to be called from the init function of a package
+// compiled into a custom k6 binary with xk6, and panics if the files conflict with the
+// registered ones.
+func RegisterFiles(files ...protoreflect.FileDescriptor) {
+	if len(files) == 0 {
+		panic("connectrpc: RegisterFiles requires proto files")
+	}
+
+	if _, err := globalProtoRegistry.RegisterGenerated(files...); err != nil {
+		panic("connectrpc: " + err.Error())
+	}
+}
+
+// staticMessage carries a message of a generated Go type through the connect clients,
+// which are generic over the message structs. Its ProtoReflect is the one of the generated
+// message, so the codecs take its fast paths.
+type staticMessage struct {
+	proto.Message
+}
+
+// staticMessageType returns the generated Go type of a message registered with RegisterFiles
+func staticMessageType(desc protoreflect.MessageDescriptor) (protoreflect.MessageType, bool) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil || mt.Descriptor() != desc {
+		return nil, false
+	}
+	return mt, true
+}
+
+// isStatic returns whether the unary calls of a method use the generated Go types of its
+// request and response
+func isStatic(methodDesc protoreflect.MethodDescriptor) bool {
+	_, input := staticMessageType(methodDesc.Input())
+	_, output := staticMessageType(methodDesc.Output())
+	return input && output
+}
+
+// staticClient returns the connect client of a method with generated Go types. It is cached
+// like dynamicClient.
+func (c *Client) staticClient(
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+) *connect.Client[staticMessage, staticMessage] {
+	if c.connectionStrategy == "per-call" {
+		return connect.NewClient[staticMessage, staticMessage](
+			httpClient, c.baseURL+method, c.clientOptions(methodDesc)...)
+	}
+
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	c.resetClientsLocked(httpClient)
+
+	staticClient, ok := c.staticClients[method]
+	if !ok {
+		staticClient = connect.NewClient[staticMessage, staticMessage](
+			httpClient, c.baseURL+method, c.clientOptions(methodDesc)...)
+		c.staticClients[method] = staticClient
+	}
+	return staticClient
+}
+
+// invokeStatic calls a unary RPC with generated Go types for invoke()
+func (c *Client) invokeStatic(
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+	reqJSON []byte,
+	p *callParams,
+) (*sobek.Object, error) {
+	requestMessage, err := c.staticRequest(methodDesc, reqJSON, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON into dynamic protobuf message: %w", err)
+	}
+
+	result := &rpcResult{
+		reqSize: int64(len(reqJSON)),
+	}
+	c.awaitMock(func() {
+		staticClient := c.staticClient(httpClient, method, methodDesc)
+		result = completeUnaryRPC(c, result, staticClient.CallUnary, connect.NewRequest(requestMessage), method, p)
+	})
+
+	if c.metrics != nil {
+		tags := c.createUnaryMetricTags(method, p, result.httpStatus, result.err)
+		c.metrics.recordUnaryRequest(c.vu.Context(), c.vu, result.duration, result.reqSize, result.respSize, tags, result.err)
+		c.recordServerTiming(tags, result.server)
+		if result.err == nil {
+			c.recordResponseCompression(tags, result.peer, result.decompressed)
+		}
+	}
+
+	rt := c.vu.Runtime()
+	response := c.convertRPCResultToObject(result)
+	p.setIdempotencyKey(rt, response)
+	p.setRequestID(rt, response)
+	if err := c.deriveSamples(method, p, response, result.responseJSON); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// doStaticRPC performs the RPC call with generated Go types without touching the sobek runtime
+func (c *Client) doStaticRPC(
+	result *rpcResult,
+	httpClient *http.Client,
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+	reqJSON []byte,
+	p *callParams,
+) *rpcResult {
+	requestMessage, err := c.staticRequest(methodDesc, reqJSON, p)
+	if err != nil {
+		result.err = fmt.Errorf("failed to unmarshal JSON into dynamic protobuf message: %w", err)
+		result.httpStatus = 500
+		return result
+	}
+
+	staticClient := c.staticClient(httpClient, method, methodDesc)
+
+	return completeUnaryRPC(c, result, staticClient.CallUnary, connect.NewRequest(requestMessage), method, p)
+}
+
+// staticRequest unmarshals a JSON request into its generated Go type
+func (c *Client) staticRequest(
+	methodDesc protoreflect.MethodDescriptor, reqJSON []byte, p *callParams,
+) (*staticMessage, error) {
+	input, _ := staticMessageType(methodDesc.Input())
+	requestMessage := &staticMessage{Message: input.New().Interface()}
+	if err := c.requestUnmarshaler(p).unmarshal(reqJSON, requestMessage); err != nil {
+		return nil, err
+	}
+	return requestMessage, nil
+}
@@ -0,0 +1,120 @@
+package connectrpc_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	staticv1 "github.com/bumberboy/xk6-connectrpc/testdata/static/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// typesCodec is the protobuf codec of the 'x-types-proto' content type, recording the Go
+// types of the messages the client marshals and unmarshals
+type typesCodec struct {
+	mu    sync.Mutex
+	types []string
+}
+
+var staticCodec = &typesCodec{}
+
+func (c *typesCodec) Name() string {
+	return "x-types-proto"
+}
+
+func (c *typesCodec) Marshal(msg any) ([]byte, error) {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", msg)
+	}
+	c.record(protoMsg)
+	return proto.Marshal(protoMsg)
+}
+
+func (c *typesCodec) Unmarshal(data []byte, msg any) error {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", msg)
+	}
+	if err := proto.Unmarshal(data, protoMsg); err != nil {
+		return err
+	}
+	c.record(protoMsg)
+	return nil
+}
+
+// record records the type of a generated message, which the client wraps. The mock handlers
+// use dynamic messages.
+func (c *typesCodec) record(msg proto.Message) {
+	switch generated := msg.ProtoReflect().Interface().(type) {
+	case *staticv1.EchoRequest, *staticv1.EchoResponse:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.types = append(c.types, fmt.Sprintf("%T", generated))
+	}
+}
+
+func (c *typesCodec) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.types
+}
+
+func init() {
+	connectrpc.RegisterFiles(staticv1.File_static_v1_static_proto)
+	connectrpc.RegisterCodec(staticCodec)
+}
+
+func TestRegisterFiles(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+	ts.ToVUContext()
+
+	// The registered methods are invoked without loadProtos()
+	_, err := ts.RunOnEventLoop(`
+		(async function() {
+			var echo = function(request) {
+				return { number: request.number * 2, text: request.text };
+			};
+			var results = [];
+			for (var contentType of ['application/proto', 'application/json', 'application/x-types-proto']) {
+				var client = new connectrpc.Client();
+				client.connect('mock://', {
+					contentType: contentType,
+					handlers: { '/k6.connectrpc.static.v1.EchoService/Echo': echo },
+				});
+				var sync = client.invoke('/k6.connectrpc.static.v1.EchoService/Echo', { number: 21, text: contentType });
+				var async = await client.asyncInvoke('/k6.connectrpc.static.v1.EchoService/Echo', { number: 2 });
+				results.push([sync.message.number, sync.message.text, async.message.number]);
+				client.close();
+			}
+			call(JSON.stringify(results));
+		})();
+	`)
+	require.NoError(t, err)
+
+	require.Len(t, ts.callRecorder.Recorded(), 1)
+	assert.JSONEq(t, `[
+		["42", "application/proto", "4"],
+		["42", "application/json", "4"],
+		["42", "application/x-types-proto", "4"]
+	]`, ts.callRecorder.Recorded()[0])
+
+	// The client marshals the generated Go types instead of dynamic messages
+	assert.Equal(t, []string{
+		"*staticv1.EchoRequest", "*staticv1.EchoResponse",
+		"*staticv1.EchoRequest", "*staticv1.EchoResponse",
+	}, staticCodec.recorded())
+}
+
+func TestRegisterFilesInvalid(t *testing.T) {
+	t.Parallel()
+
+	assert.PanicsWithValue(t, "connectrpc: RegisterFiles requires proto files", func() {
+		connectrpc.RegisterFiles()
+	})
+}
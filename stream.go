@@ -1,12 +1,14 @@
 package connectrpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,12 +17,14 @@ import (
 	"connectrpc.com/connect"
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/metrics"
 
 	"github.com/grafana/sobek"
 	"github.com/mstoykov/k6-taskqueue-lib/taskqueue"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
@@ -28,7 +32,10 @@ import (
 // message represents a message in the stream queue
 type message struct {
 	isClosing bool
+	isOpening bool // Sends the request headers only, see ready()
+	heartbeat bool // Sends the heartbeat of appKeepalive
 	msg       []byte
+	written   func(err error) // Settles the promise of the write with awaitWrites: true, nil otherwise
 }
 
 const (
@@ -62,13 +69,67 @@ type stream struct {
 
 	eventListeners *eventListeners
 
-	timeoutCancel context.CancelFunc
+	// cancel cancels the stream context, ending the stream
+	cancel context.CancelFunc
+
+	// httpClient is the HTTP client created for the stream by the per-call strategy
+	httpClient *http.Client
+	// activeClient and activeURL are where the stream is counted in connectrpc_active_streams
+	activeClient *http.Client
+	activeURL    string
+
+	// peer is the connection of the stream, filled once the server responds
+	peer *peerInfo
+
+	// Open confirmation of ready(), only used on the event loop
+	headersQueued bool        // Whether ready() queued the request headers
+	opened        sobek.Value // The 'open' event, once the server accepted the stream
+	openErr       sobek.Value // The error of the stream, when it failed before it opened
+	readyPromises []readyPromise
+
+	// logLevel is the most verbose level the stream logs at, see the `logLevel` connect parameter
+	logLevel logrus.Level
+
+	// flatHeaders is the `headerFormat: 'flat'` connect parameter of the client
+	flatHeaders bool
+
+	// reaper closes the stream if it's still open at the end of the iteration
+	reaper *streamReaper
+
+	// ctx is the stream context, canceled by close() and the timeout
+	ctx context.Context
+
+	// Pause state of the read loop, see pause()
+	pauseMu     sync.Mutex
+	resumeCh    chan struct{} // Closed on resume, nil while not paused
+	pausedAt    time.Time
+	pausedTotal time.Duration
+
+	// shutdownOnce ends the stream once, since end(), close(), the reaper and the
+	// write errors can all shut it down, from different goroutines
+	shutdownOnce sync.Once
 
 	// Timing for metrics
 	streamStartTime time.Time
 
 	// Track if stream was explicitly closed
-	explicitlyClosed bool
+	explicitlyClosed atomic.Bool
+
+	// Whether the stream emitted an error, for streamArrivalRate to count the failed streams
+	failed atomic.Bool
+
+	// Early cancel of cancelAfter() and take(): the messages received, the count after which
+	// the stream is canceled, 0 for none, and when it was canceled in Unix nanoseconds
+	received    atomic.Int64
+	cancelCount atomic.Int64
+	canceledAt  atomic.Int64
+
+	// The first messages received, for take()
+	taken takeBuffer
+
+	// The first error the stream emitted, recorded with the end of the stream once released
+	errMu    sync.Mutex
+	firstErr error
 
 	// Ensure readLoop starts only once, after the first successful send
 	startReadLoopOnce sync.Once
@@ -77,10 +138,36 @@ type stream struct {
 	readLoopStarted atomic.Bool
 	readLoopDone    chan struct{}
 	closeQueueOnce  sync.Once
+	endMock         func() // Lets the event loop stop running the handlers of a mock:// address
 
 	// Synchronous read support - channel for received messages
 	recvCh       chan *recvResult
 	recvChClosed atomic.Bool
+
+	// Hot path state. The messages are reused for every send/receive, which is safe
+	// because only writeLoop sends and only readLoop receives.
+	binary      bool // exchange protobuf wire bytes instead of JSON objects
+	awaitWrites bool // write() returns a promise resolved once writeLoop sent the message
+	sink        *streamSink
+	assert      *streamAssert
+	unmarshaler requestUnmarshaler
+	metricTags  MetricTags
+	sendMsg     *dynamicpb.Message
+	recvMsg     *dynamicpb.Message
+	conversion  *responseConversion // Conversion of the received messages, nil for none
+	keepalive   *streamKeepalive    // Heartbeat written while the stream is idle, nil for none
+	reconnect   *streamReconnect    // Re-establishment and header refresh of the stream, nil for none
+
+	// connMu guards connectStream, which reconnectStream replaces, against the writes and close()
+	connMu sync.Mutex
+}
+
+// marshalBufPool holds scratch buffers for marshaling received messages
+var marshalBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
 }
 
 // recvResult holds either a received message or an error
@@ -94,6 +181,12 @@ func defineStream(rt *sobek.Runtime, s *stream) {
 	must(rt, s.obj.DefineDataProperty(
 		"on", rt.ToValue(s.on), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
 
+	must(rt, s.obj.DefineDataProperty(
+		"once", rt.ToValue(s.once), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"off", rt.ToValue(s.off), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
 	must(rt, s.obj.DefineDataProperty(
 		"write", rt.ToValue(s.write), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
 
@@ -103,99 +196,139 @@ func defineStream(rt *sobek.Runtime, s *stream) {
 	must(rt, s.obj.DefineDataProperty(
 		"close", rt.ToValue(s.close), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
 
+	must(rt, s.obj.DefineDataProperty(
+		"info", rt.ToValue(s.info), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"ready", rt.ToValue(s.ready), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
 	must(rt, s.obj.DefineDataProperty(
 		"read", rt.ToValue(s.read), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"writeFrom", rt.ToValue(s.writeFrom), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"writeInterval", rt.ToValue(s.writeInterval), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"writeOneof", rt.ToValue(s.writeOneof), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"pause", rt.ToValue(s.pause), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"resume", rt.ToValue(s.resume), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"cancelAfter", rt.ToValue(s.cancelAfter), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
+
+	must(rt, s.obj.DefineDataProperty(
+		"take", rt.ToValue(s.take), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_TRUE))
 }
 
 func (s *stream) beginStream(p *callParams) error {
 	// Record stream start time for metrics
 	s.streamStartTime = time.Now()
 
+	assert, err := newStreamAssert(p.Assert, s.methodDescriptor.Output())
+	if err != nil {
+		return err
+	}
+	s.assert = assert
+
+	s.endMock = s.client.beginMock()
+	s.logLevel = s.client.logLevel()
+	s.flatHeaders = s.client.connectParams != nil && s.client.connectParams.FlatHeaders
+	s.binary = p.Binary
+	s.awaitWrites = p.AwaitWrites
+	s.sink = newStreamSink(p.Sink)
+	s.unmarshaler = s.client.requestUnmarshaler(p)
+	s.sendMsg = dynamicpb.NewMessage(s.methodDescriptor.Input())
+	s.recvMsg = dynamicpb.NewMessage(s.methodDescriptor.Output())
+	s.conversion = s.client.responseConversion(s.methodDescriptor.Output())
+
+	protocol := "connect"
+	contentType := "application/json"
+	if s.client.connectParams != nil {
+		protocol = s.client.connectParams.Protocol
+		contentType = s.client.connectParams.ContentType
+	}
+	s.metricTags = s.client.createMetricTags(s.method, protocol, contentType)
+	s.metricTags.Type = "stream"
+	if p.SSE {
+		if err := s.client.checkSSE(s.methodDescriptor); err != nil {
+			return err
+		}
+		s.metricTags = s.metricTags.withCustomTag("transport", "sse")
+	}
+	if s.keepalive, err = s.newKeepalive(p.AppKeepalive); err != nil {
+		return err
+	}
+	if s.reconnect, err = s.newReconnect(p); err != nil {
+		return err
+	}
+
 	// Get or create HTTP client based on connection strategy
 	var httpClient *http.Client
-	var err error
 
-	if s.client.connectionStrategy == "per-call" {
-		// For per-call strategy, create a fresh HTTP client for this stream
+	if s.client.streamConnections() {
+		// For per-call and per-stream strategies, create a fresh HTTP client for this stream
 		if s.client.connectParams == nil {
 			return errors.New("invalid ConnectRPC Stream's client: no connection parameters available for per-call strategy")
 		}
 		httpClient, err = s.client.createHTTPClient(s.client.connectParams, s.client.addr)
 		if err != nil {
-			return fmt.Errorf("failed to create HTTP client for per-call stream: %w", err)
+			return fmt.Errorf("failed to create HTTP client for %s stream: %w", s.client.connectionStrategy, err)
 		}
+		s.httpClient = httpClient
 	} else {
-		// For per-vu and per-iteration strategies, use existing client
+		// For per-vu and per-iteration strategies, use the client of the VU or of the iteration
 		if s.client.httpClient == nil {
 			return errors.New("invalid ConnectRPC Stream's client: no ConnectRPC connection, you must call connect first")
 		}
-		httpClient = s.client.httpClient
-	}
-
-	// Create the dynamic client just-in-time
-	procedureString := s.method
-
-	// Prepare client options based on connection parameters
-	clientOptions := []connect.ClientOption{
-		connect.WithSchema(s.methodDescriptor),
-		connect.WithResponseInitializer(func(spec connect.Spec, msg any) error {
-			dynamic, ok := msg.(*dynamicpb.Message)
-			if !ok {
-				return nil
-			}
-			desc, ok := spec.Schema.(protoreflect.MethodDescriptor)
-			if !ok {
-				return fmt.Errorf("invalid schema type %T for %T message", spec.Schema, dynamic)
-			}
-			if spec.IsClient {
-				*dynamic = *dynamicpb.NewMessage(desc.Output())
-			} else {
-				*dynamic = *dynamicpb.NewMessage(desc.Input())
-			}
-			return nil
-		}),
-	}
-
-	// Add protocol-specific options based on connection parameters
-	if s.client.connectParams != nil {
-		switch s.client.connectParams.Protocol {
-		case "grpc":
-			clientOptions = append(clientOptions, connect.WithGRPC())
-		case "grpc-web":
-			clientOptions = append(clientOptions, connect.WithGRPCWeb())
-		case "connect":
-			// "connect" protocol is the default, no additional option needed
-		}
-
-		// Add JSON codec if JSON content type is specified
-		if s.client.connectParams.ContentType == "application/json" {
-			clientOptions = append(clientOptions, connect.WithProtoJSON())
+		httpClient, err = s.client.vuHTTPClient()
+		if err != nil {
+			return err
 		}
 	}
 
-	dynamicClient := connect.NewClient[dynamicpb.Message, dynamicpb.Message](
-		httpClient,
-		s.client.baseURL+procedureString,
-		clientOptions...,
-	)
+	dynamicClient := s.client.dynamicClient(httpClient, s.method, s.methodDescriptor)
+	if p.SSE {
+		dynamicClient = s.client.sseDynamicClient(httpClient, s.method, s.methodDescriptor)
+	}
 
 	// This call is non-blocking. It just prepares the stream object.
 	// Configure timeout for streaming (support infinite timeout)
+	// The context is always cancelable, so that close() ends the stream
 	var ctx context.Context
-	var cancel context.CancelFunc
 	if p.Timeout != nil && *p.Timeout > 0 {
-		ctx, cancel = context.WithTimeout(s.vu.Context(), *p.Timeout)
-		s.timeoutCancel = cancel // Store cancel to be called on shutdown
+		ctx, s.cancel = context.WithTimeout(s.vu.Context(), *p.Timeout)
 	} else {
 		// No timeout - use base context for infinite streams
-		ctx = s.vu.Context()
-		s.timeoutCancel = nil
+		ctx, s.cancel = context.WithCancel(s.vu.Context())
 	}
+	ctx, s.peer = withPeerInfo(ctx)
+	ctx = withRPCTags(ctx, s.metricTags)
+	s.ctx = ctx
 	s.connectStream = dynamicClient.CallBidiStream(ctx)
+	s.client.trackStream(s)
+	if s.reaper != nil {
+		s.reaper.add(s)
+	}
 
-	// Apply headers before the first write
-	for key, value := range p.Metadata {
-		s.connectStream.RequestHeader().Set(key, value)
+	// Apply headers before the first write, the call-level ones overriding the connection-level ones
+	if s.client.connectParams != nil {
+		s.client.connectParams.setHeaders(s.connectStream.RequestHeader())
+	}
+	s.client.defaultHeaders.Load().apply(s.connectStream.RequestHeader())
+	if s.reconnect != nil {
+		s.reconnect.client = dynamicClient
+		s.reconnect.setHeaders(s)
+	} else {
+		for key, value := range p.Metadata {
+			s.connectStream.RequestHeader().Set(key, value)
+		}
 	}
 
 	// Start writeLoop goroutine - the connection will be initiated on the first s.connectStream.Send()
@@ -205,64 +338,446 @@ func (s *stream) beginStream(p *callParams) error {
 
 	// Record stream start metrics
 	if s.instanceMetrics != nil {
-		protocol := "connect"
-		contentType := "application/json"
-		if s.client.connectParams != nil {
-			protocol = s.client.connectParams.Protocol
-			contentType = s.client.connectParams.ContentType
-		}
-		tags := s.client.createMetricTags(s.method, protocol, contentType)
-		tags.Type = "stream"
-		s.instanceMetrics.recordStreamStart(s.vu.Context(), s.vu, tags)
+		s.instanceMetrics.recordStreamStart(s.vu.Context(), s.vu, s.metricTags)
+		s.activeClient, s.activeURL = httpClient, s.client.baseURL
+		s.instanceMetrics.recordActiveStreams(s.vu.Context(), s.vu, s.activeURL, s.activeClient, 1)
 	}
+	s.log(logrus.DebugLevel, logrus.Fields{"event": "opened", "protocol": protocol}, "Stream opened")
 
 	return nil
 }
 
-// on attaches an event listener to the stream
+// on attaches an event listener to the stream. A listener already attached to the event
+// is not attached twice.
 func (s *stream) on(event string, listener sobek.Value) {
+	s.addListener(event, listener, false)
+}
+
+// once attaches an event listener that is detached after its first call
+func (s *stream) once(event string, listener sobek.Value) {
+	s.addListener(event, listener, true)
+}
+
+// off detaches a listener from the event, or all its listeners without listener
+func (s *stream) off(event string, listener sobek.Value) {
+	if s.eventListeners == nil {
+		return
+	}
+
+	s.eventListeners.remove(event, listener)
+}
+
+// addListener attaches the listener, warning once per event when the event has more than
+// maxListeners listeners, which usually means the script leaks them. Non-function listeners
+// are ignored.
+func (s *stream) addListener(event string, listener sobek.Value, once bool) {
+	if _, ok := sobek.AssertFunction(listener); !ok {
+		return
+	}
 	if s.eventListeners == nil {
 		s.eventListeners = newEventListeners()
 	}
 
-	s.eventListeners.add(event, listener)
+	if count, exceeded := s.eventListeners.add(event, listener, once); exceeded {
+		s.logger.Warnf("possible listener leak: %d '%s' listeners attached to the stream; "+
+			"detach them with stream.off() or attach them with stream.once()", count, event)
+	}
 }
 
-// write sends a message to the stream
-func (s *stream) write(data sobek.Value) {
+// write sends a message to the stream. With awaitWrites: true, it returns a promise
+// resolved with the milliseconds the message waited before writeLoop sent it.
+func (s *stream) write(data sobek.Value) sobek.Value {
 	if s.writingState == closed {
 		if rt := s.vu.Runtime(); rt != nil {
 			common.Throw(rt, errors.New("cannot write to a closed stream"))
 		}
-		return
+		return sobek.Undefined()
+	}
+
+	rt := s.vu.Runtime()
+	if rt == nil {
+		return sobek.Undefined()
 	}
 
 	// Convert the data to bytes
 	var msgBytes []byte
 	if data != nil && !sobek.IsUndefined(data) && !sobek.IsNull(data) {
-		rt := s.vu.Runtime()
-		if rt == nil {
-			return
-		}
-		obj := data.ToObject(rt)
-		jsonBytes, err := obj.MarshalJSON()
-		if err != nil {
-			common.Throw(rt, fmt.Errorf("failed to marshal message: %w", err))
-			return
+		var err error
+		if msgBytes, err = s.messageBytes(rt, data); err != nil {
+			common.Throw(rt, err)
+			return sobek.Undefined()
 		}
-		msgBytes = jsonBytes
 	}
 
-	// Send message through the write queue
+	msg := message{msg: msgBytes}
+	result := sobek.Undefined()
+	if s.awaitWrites {
+		var promise *sobek.Promise
+		promise, msg.written = s.newWritePromise(rt)
+		result = rt.ToValue(promise)
+	}
+
+	// Send message through the write queue, timing the wait when writeLoop is still busy
+	select {
+	case s.writeQueueCh <- msg:
+		return result
+	default:
+	}
+
+	waitStart := time.Now()
 	select {
-	case s.writeQueueCh <- message{msg: msgBytes}:
+	case s.writeQueueCh <- msg:
+		s.recordSaturation(saturationWriteQueue, time.Since(waitStart))
 	case <-s.done:
-		// Check if runtime is available before throwing
-		if rt := s.vu.Runtime(); rt != nil {
-			common.Throw(rt, errors.New("stream is closed"))
+		if msg.written != nil {
+			msg.written(errStreamClosed)
 		}
-		return
+		common.Throw(rt, errStreamClosed)
+	}
+	return result
+}
+
+var (
+	// errStreamClosed is thrown by the writes to a stream ended in the meantime
+	errStreamClosed = errors.New("stream is closed")
+	// errServerEnded rejects the writes with awaitWrites: true the server ended the stream before
+	errServerEnded = errors.New("the server ended the stream before the message was sent")
+)
+
+// newWritePromise returns the promise of a write with awaitWrites: true, and the function
+// settling it once writeLoop sent the message, or failed to
+func (s *stream) newWritePromise(rt *sobek.Runtime) (*sobek.Promise, func(error)) {
+	promise, resolve, reject := rt.NewPromise()
+	callback := s.vu.RegisterCallback()
+	queued := time.Now()
+
+	return promise, func(err error) {
+		waited := float64(time.Since(queued)) / float64(time.Millisecond)
+		callback(func() error {
+			if err != nil {
+				return reject(err)
+			}
+			return resolve(waited)
+		})
+	}
+}
+
+// writeOneof writes a message with only the given oneof field set, so that
+// writeOneof('login', payload) sends { login: payload } for a message wrapping its
+// events in a oneof envelope
+func (s *stream) writeOneof(field string, payload sobek.Value) sobek.Value {
+	rt := s.vu.Runtime()
+	if rt == nil {
+		return sobek.Undefined()
+	}
+	if s.binary {
+		common.Throw(rt, errors.New("writeOneof is not supported by binary streams, write the encoded message instead"))
+		return sobek.Undefined()
+	}
+
+	fd, err := oneofField(s.methodDescriptor.Input(), field)
+	if err != nil {
+		common.Throw(rt, err)
+		return sobek.Undefined()
+	}
+
+	envelope := rt.NewObject()
+	must(rt, envelope.Set(fd.JSONName(), payload))
+	return s.write(envelope)
+}
+
+// oneofField returns the field of a oneof of a message, by its proto or JSON name
+func oneofField(md protoreflect.MessageDescriptor, name string) (protoreflect.FieldDescriptor, error) {
+	var names []string
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue // proto3 optional fields
+		}
+
+		fields := oneof.Fields()
+		for j := 0; j < fields.Len(); j++ {
+			fd := fields.Get(j)
+			if string(fd.Name()) == name || fd.JSONName() == name {
+				return fd, nil
+			}
+			names = append(names, string(fd.Name()))
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s has no oneof field", md.FullName())
+	}
+	return nil, fmt.Errorf("%s has no oneof field %q, expected one of: %s", md.FullName(), name, strings.Join(names, ", "))
+}
+
+// messageBytes converts a message given by the script to the bytes queued for writeLoop
+func (s *stream) messageBytes(rt *sobek.Runtime, data sobek.Value) ([]byte, error) {
+	if s.binary {
+		wire, err := common.ToBytes(data.Export())
+		if err != nil {
+			return nil, fmt.Errorf("binary streams only accept an ArrayBuffer or typed array: %w", err)
+		}
+		// Copy, as the script may modify the buffer before writeLoop sends it
+		return bytes.Clone(wire), nil
+	}
+
+	jsonBytes, err := data.ToObject(rt).MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return jsonBytes, nil
+}
+
+// writeFrom writes the records of a feeder to the stream in the background, at most
+// `rate` messages per second and `count` messages if set. The returned promise resolves
+// with the number of written messages once the feeder is exhausted or the stream is done.
+func (s *stream) writeFrom(feederVal sobek.Value, options sobek.Value) *sobek.Promise {
+	rt := s.vu.Runtime()
+
+	if s.writingState == closed {
+		common.Throw(rt, errors.New("cannot write to a closed stream"))
+	}
+	if s.binary {
+		common.Throw(rt, errors.New("writeFrom is not supported by binary streams"))
+	}
+
+	var f *feeder
+	if !common.IsNullish(feederVal) {
+		f, _ = feederVal.Export().(*feeder)
+	}
+	if f == nil {
+		common.Throw(rt, errors.New("invalid feeder: must be created with connectrpc.feeder()"))
+	}
+
+	var rate float64
+	var count int64
+	if !common.IsNullish(options) {
+		opts := options.ToObject(rt)
+		if v := opts.Get("rate"); !common.IsNullish(v) {
+			if rate = v.ToFloat(); rate < 0 {
+				common.Throw(rt, fmt.Errorf("invalid rate: %v. Must not be negative", rate))
+			}
+		}
+		if v := opts.Get("count"); !common.IsNullish(v) {
+			if count = v.ToInteger(); count < 0 {
+				common.Throw(rt, fmt.Errorf("invalid count: %d. Must not be negative", count))
+			}
+		}
+	}
+
+	promise, resolve, reject := rt.NewPromise()
+	callback := s.vu.RegisterCallback()
+	go func() {
+		written, err := s.feed(f, rate, count)
+		callback(func() error {
+			if err != nil {
+				return reject(err)
+			}
+			return resolve(written)
+		})
+	}()
+
+	return promise
+}
+
+// feed sends the feeder records through the write queue without touching the sobek runtime
+func (s *stream) feed(f *feeder, rate float64, count int64) (int64, error) {
+	var ticker *time.Ticker
+	if rate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+	}
+
+	var written int64
+	for count == 0 || written < count {
+		record, err := f.nextRecord()
+		if err != nil {
+			return written, err
+		}
+		if record == nil {
+			return written, nil
+		}
+
+		if ticker != nil && written > 0 {
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return written, nil
+			}
+		}
+
+		select {
+		case s.writeQueueCh <- message{msg: record}:
+			written++
+		case <-s.done:
+			return written, nil
+		}
+	}
+
+	return written, nil
+}
+
+// writeInterval writes messages at a fixed rate driven by a Go ticker, so the rate doesn't
+// depend on the event loop. The message is either an object, sent as is every time, or a
+// function called with the message index to create each message. Without a duration it
+// writes until the stream is done. The returned promise resolves with the number of
+// scheduled messages.
+func (s *stream) writeInterval(msg sobek.Value, options sobek.Value) *sobek.Promise {
+	rt := s.vu.Runtime()
+
+	if s.writingState == closed {
+		common.Throw(rt, errors.New("cannot write to a closed stream"))
+	}
+	if common.IsNullish(msg) {
+		common.Throw(rt, errors.New("writeInterval requires a message or a message factory"))
+	}
+	if common.IsNullish(options) {
+		common.Throw(rt, errors.New("writeInterval requires a rate"))
+	}
+
+	opts := options.ToObject(rt)
+	rate, err := parseRate(opts.Get("rate"))
+	if err != nil {
+		common.Throw(rt, fmt.Errorf("invalid rate: %w", err))
+	}
+
+	total := int64(-1) // unlimited
+	if v := opts.Get("duration"); !common.IsNullish(v) {
+		duration, err := types.GetDurationValue(v.Export())
+		if err != nil || duration <= 0 {
+			common.Throw(rt, fmt.Errorf("invalid duration: %s", v))
+		}
+		total = int64(rate * duration.Seconds())
+	}
+
+	// Static messages are marshaled once, factories are called on the event loop for every message.
+	// The event loop only creates the message: the pacing goroutine waits for it and for room in
+	// the write queue, so a busy writeLoop holds back the pace rather than the event loop.
+	var send func(i int64)
+	if factory, ok := sobek.AssertFunction(msg); ok {
+		send = func(i int64) {
+			produced := make(chan []byte, 1)
+			s.tq.Queue(func() error {
+				defer close(produced)
+				v, err := factory(sobek.Undefined(), rt.ToValue(i))
+				if err != nil {
+					return err
+				}
+				msgBytes, err := s.messageBytes(rt, v)
+				if err != nil {
+					return err
+				}
+				produced <- msgBytes
+				return nil
+			})
+
+			select {
+			case msgBytes, ok := <-produced:
+				if !ok {
+					return // The factory failed, the error is reported on the event loop
+				}
+				select {
+				case s.writeQueueCh <- message{msg: msgBytes}:
+				case <-s.done:
+				}
+			case <-s.done:
+			}
+		}
+	} else {
+		msgBytes, err := s.messageBytes(rt, msg)
+		if err != nil {
+			common.Throw(rt, err)
+		}
+		send = func(int64) {
+			select {
+			case s.writeQueueCh <- message{msg: msgBytes}:
+			case <-s.done:
+			}
+		}
+	}
+
+	promise, resolve, _ := rt.NewPromise()
+	callback := s.vu.RegisterCallback()
+	go func() {
+		scheduled := s.pace(rate, total, send)
+		callback(func() error {
+			return resolve(scheduled)
+		})
+	}()
+
+	return promise
+}
+
+// pace calls send at the given rate per second until total calls, unless negative,
+// or until the stream is done. It returns the number of calls.
+func (s *stream) pace(rate float64, total int64, send func(i int64)) int64 {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	var i int64
+	for total < 0 || i < total {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return i
+			}
+		}
+
+		select {
+		case <-s.done:
+			return i
+		default:
+		}
+
+		send(i)
+		i++
 	}
+
+	return i
+}
+
+// parseRate parses a message rate such as "10/s", "600/m" or "3600/h", or a number of messages per second
+func parseRate(v sobek.Value) (float64, error) {
+	if common.IsNullish(v) {
+		return 0, errors.New("a rate is required")
+	}
+
+	var rate float64
+	switch exported := v.Export().(type) {
+	case int64:
+		rate = float64(exported)
+	case float64:
+		rate = exported
+	case string:
+		count, unit, found := strings.Cut(exported, "/")
+		if !found {
+			return 0, fmt.Errorf("%q must be like '10/s'", exported)
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q must be like '10/s'", exported)
+		}
+		switch strings.TrimSpace(unit) {
+		case "s":
+			rate = n
+		case "m":
+			rate = n / 60
+		case "h":
+			rate = n / 3600
+		default:
+			return 0, fmt.Errorf("%q has an unknown time unit, must be 's', 'm' or 'h'", exported)
+		}
+	default:
+		return 0, fmt.Errorf("must be a number or a string like '10/s', got %T", exported)
+	}
+
+	if rate <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return rate, nil
 }
 
 // end closes the client side of the stream
@@ -283,17 +798,91 @@ func (s *stream) end() {
 // close terminates the entire stream immediately (both read and write sides)
 func (s *stream) close() {
 	// Mark that this was an explicit close
-	s.explicitlyClosed = true
+	s.explicitlyClosed.Store(true)
 
-	// Cancel the timeout context if it exists
-	if s.timeoutCancel != nil {
-		s.timeoutCancel()
+	// Queued before the task queue is closed by the shutdown
+	s.tq.Queue(func() error {
+		if rt := s.vu.Runtime(); rt != nil {
+			s.rejectReady(rt.ToValue(map[string]interface{}{"message": errClosedBeforeOpen.Error()}))
+		}
+		return nil
+	})
+
+	// Cancel the stream context if it exists
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	// The transport only watches the context until the request is sent, so an established
+	// stream is ended by closing its response, which unblocks the read loop
+	if s.readLoopStarted.Load() {
+		s.closeResponse()
 	}
 
 	// Force close the stream by calling shutdown directly
 	s.shutdown()
 }
 
+// pause stops receiving messages until resume(), to model a slow consumer: once the
+// buffers of the transport are full, HTTP/2 flow control pushes back on the server
+func (s *stream) pause() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.resumeCh != nil {
+		return
+	}
+	s.resumeCh = make(chan struct{})
+	s.pausedAt = time.Now()
+	s.log(logrus.DebugLevel, logrus.Fields{"event": "paused"}, "Stream paused")
+}
+
+// resume receives messages again after pause()
+func (s *stream) resume() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.resumeCh == nil {
+		return
+	}
+	close(s.resumeCh)
+	s.resumeCh = nil
+	s.pausedTotal += time.Since(s.pausedAt)
+	s.log(logrus.DebugLevel, logrus.Fields{"event": "resumed"}, "Stream resumed")
+}
+
+// waitResumed blocks the read loop while the stream is paused, until it's resumed or closed
+func (s *stream) waitResumed() {
+	s.pauseMu.Lock()
+	resumeCh := s.resumeCh
+	s.pauseMu.Unlock()
+
+	if resumeCh == nil {
+		return
+	}
+	select {
+	case <-resumeCh:
+	case <-s.ctx.Done():
+	}
+}
+
+// pausedDuration returns how long the stream was paused, including a pause still going on
+func (s *stream) pausedDuration() time.Duration {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.resumeCh != nil {
+		return s.pausedTotal + time.Since(s.pausedAt)
+	}
+	return s.pausedTotal
+}
+
+// info returns the connection of the stream: its HTTP version, remote address and the
+// protocol negotiated by TLS. They are empty until the server responds.
+func (s *stream) info() map[string]interface{} {
+	return s.peer.export()
+}
+
 // read synchronously reads the next message from the stream.
 // Returns the message data as a JS object, or null if the stream has ended.
 // Throws an error if there was a stream error.
@@ -319,7 +908,11 @@ func (s *stream) read() sobek.Value {
 	// Note: We only wait on recvCh, not s.done, because:
 	// - recvCh will be closed when readLoop exits (via closeRecvCh)
 	// - s.done may be closed before all messages are consumed
-	result, ok := <-s.recvCh
+	var result *recvResult
+	var ok bool
+	s.client.awaitMock(func() {
+		result, ok = <-s.recvCh
+	})
 	if !ok {
 		// Channel closed, stream ended
 		return sobek.Null()
@@ -333,17 +926,31 @@ func (s *stream) read() sobek.Value {
 		// End of stream signal
 		return sobek.Null()
 	}
+	if s.binary {
+		return rt.ToValue(rt.NewArrayBuffer(result.data))
+	}
 	// Parse JSON and return as JS object
 	var parsed interface{}
 	if err := json.Unmarshal(result.data, &parsed); err != nil {
 		// If JSON parsing fails, return as string
 		return rt.ToValue(string(result.data))
 	}
-	return rt.ToValue(parsed)
+	return rt.ToValue(s.conversion.apply(rt, parsed))
 }
 
-// writeLoop handles writing messages to the stream
+// writeLoop handles writing messages to the stream.
+//
+// Each stream has its own writeLoop and readLoop rather than handing its messages to a
+// shared pool of goroutines: Send and Receive block on the network and the messages of a
+// stream must stay in order, so a pooled worker would be tied to one stream all the same,
+// with two more channel hops per message. The messages are encoded and decoded in place,
+// in the reused sendMsg and recvMsg, instead.
 func (s *stream) writeLoop() {
+	timer, idle := s.keepaliveTimer()
+	if timer != nil {
+		defer timer.Stop()
+	}
+
 	for {
 		select {
 		case msg := <-s.writeQueueCh:
@@ -358,15 +965,19 @@ func (s *stream) writeLoop() {
 						s.processMessage(pendingMsg)
 					default:
 						// No more pending messages
-						if s.connectStream != nil {
-							_ = s.connectStream.CloseRequest() // Use the official API
-						}
+						s.closeRequest()
+						s.log(logrus.DebugLevel, logrus.Fields{"event": "half-closed"}, "Stream half-closed")
 						s.shutdown()
 						return
 					}
 				}
 			}
 			s.processMessage(msg)
+			s.idleFor(timer)
+
+		case <-idle:
+			s.writeHeartbeat()
+			s.idleFor(timer)
 
 		case <-s.done:
 			return
@@ -376,16 +987,48 @@ func (s *stream) writeLoop() {
 
 // processMessage handles the actual sending of a message
 func (s *stream) processMessage(msg message) {
-	requestMessage := dynamicpb.NewMessage(s.methodDescriptor.Input())
-	if err := protojson.Unmarshal(msg.msg, requestMessage); err != nil {
-		s.logger.WithError(err).Error("Failed to unmarshal message for sending")
+	if msg.isOpening {
+		s.processOpening()
+		return
+	}
+
+	// The promise of the write is settled once Send returned, with awaitWrites: true
+	var sendErr error
+	if msg.written != nil {
+		defer func() { msg.written(sendErr) }()
+	}
+
+	// Reuse the request message: Send marshals it before returning
+	proto.Reset(s.sendMsg)
+
+	var err error
+	switch {
+	case msg.heartbeat:
+		s.setHeartbeat()
+	case s.binary:
+		err = proto.Unmarshal(msg.msg, s.sendMsg)
+	default:
+		err = s.unmarshaler.unmarshal(msg.msg, s.sendMsg)
+	}
+	if err != nil {
+		s.log(logrus.ErrorLevel, logrus.Fields{logrus.ErrorKey: err}, "Failed to unmarshal message for sending")
+		sendErr = err
 		s.emitError(err)
 		s.shutdown() // Assuming a shutdown function exists
 		return
 	}
 
-	if err := s.connectStream.Send(requestMessage); err != nil {
-		s.logger.WithError(err).Error("Failed to write to stream")
+	if err := s.send(s.sendMsg); err != nil {
+		// The server ended the stream, which isn't an error: the read loop gets its status
+		if errors.Is(err, io.EOF) {
+			sendErr = errServerEnded
+			s.startReadLoop()
+			s.shutdown()
+			return
+		}
+
+		s.log(logrus.ErrorLevel, logrus.Fields{logrus.ErrorKey: err}, "Failed to write to stream")
+		sendErr = err
 		s.emitError(err)
 		s.shutdown()
 		return
@@ -393,26 +1036,54 @@ func (s *stream) processMessage(msg message) {
 
 	// Start readLoop after the first successful send - this ensures the connection
 	// is established before we try to receive (avoiding race conditions)
-	s.startReadLoopOnce.Do(func() {
-		s.readLoopStarted.Store(true)
-		go s.readLoop()
-	})
+	if !s.readLoopStarted.Load() {
+		s.log(logrus.DebugLevel, logrus.Fields{"event": "first-send"}, "Stream first message sent")
+	}
+	s.startReadLoop()
 
 	// Record sent message metrics
-	if s.instanceMetrics != nil {
-		protocol := "connect"
-		contentType := "application/json"
-		if s.client.connectParams != nil {
-			protocol = s.client.connectParams.Protocol
-			contentType = s.client.connectParams.ContentType
-		}
-		tags := s.client.createMetricTags(s.method, protocol, contentType)
-		tags.Type = "stream"
+	if s.instanceMetrics != nil && msg.heartbeat {
+		s.recordHeartbeat()
+	} else if s.instanceMetrics != nil {
 		messageSize := int64(len(msg.msg))
-		s.instanceMetrics.recordStreamMessage(s.vu.Context(), s.vu, tags, "sent", messageSize)
+		s.instanceMetrics.recordStreamMessage(s.vu.Context(), s.vu, s.metricTags, "sent", messageSize)
 	}
 }
 
+// processOpening sends the request headers of ready(), unless a message already sent them
+func (s *stream) processOpening() {
+	if s.readLoopStarted.Load() {
+		return
+	}
+
+	if err := s.send(nil); err != nil && !errors.Is(err, io.EOF) {
+		s.log(logrus.ErrorLevel, logrus.Fields{logrus.ErrorKey: err}, "Failed to open stream")
+		s.emitError(err)
+		s.shutdown()
+		return
+	}
+	s.startReadLoop()
+}
+
+// recordSaturation records a delay caused by the client itself, see connectrpc_client_saturation
+func (s *stream) recordSaturation(source string, delay time.Duration) {
+	if s.instanceMetrics != nil {
+		s.instanceMetrics.recordSaturation(s.vu.Context(), s.vu, s.metricTags, source, delay)
+	}
+}
+
+// startReadLoop starts the read loop, once
+func (s *stream) startReadLoop() {
+	s.startReadLoopOnce.Do(func() {
+		s.readLoopStarted.Store(true)
+		go s.readLoop()
+		go s.watchOpen(s.connectStream)
+		if s.reconnect != nil && s.reconnect.refreshFn != nil && s.reconnect.maxAttempts > 0 {
+			go s.refreshHeaders()
+		}
+	})
+}
+
 // readLoop handles reading messages from the stream
 func (s *stream) readLoop() {
 	defer close(s.readLoopDone)
@@ -422,12 +1093,20 @@ func (s *stream) readLoop() {
 	// when the write side is intentionally closed (via end()), or from
 	// close() when the entire stream is terminated.
 
-	for {
-		res, err := s.connectStream.Receive()
+	for received := false; ; received = true {
+		s.waitResumed()
+
+		err := s.receive()
+		if err == nil && !received {
+			s.emitOpen(s.connectStream.ResponseHeader())
+		}
 		if err != nil {
 			// Check for normal EOF (direct or Connect-wrapped)
 			if errors.Is(err, io.EOF) {
+				s.checkComplete()
+				s.emitOpen(s.connectStream.ResponseHeader())
 				s.sendToRecvCh(nil, nil) // Signal end of stream
+				s.emitEndMeta(nil)
 				s.emitEnd()
 				return
 			}
@@ -435,7 +1114,10 @@ func (s *stream) readLoop() {
 			// Check for Connect-wrapped EOF errors
 			if connectErr := new(connect.Error); errors.As(err, &connectErr) {
 				if strings.Contains(connectErr.Message(), "EOF") {
+					s.checkComplete()
+					s.emitOpen(s.connectStream.ResponseHeader())
 					s.sendToRecvCh(nil, nil) // Signal end of stream
+					s.emitEndMeta(nil)
 					s.emitEnd()
 					return
 				}
@@ -443,7 +1125,7 @@ func (s *stream) readLoop() {
 
 			// Check for context cancellation (from explicit close())
 			if errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "context canceled") {
-				if s.explicitlyClosed {
+				if s.explicitlyClosed.Load() {
 					// This was an explicit close(), emit end instead of error
 					s.sendToRecvCh(nil, nil) // Signal end of stream
 					s.emitEnd()
@@ -454,7 +1136,7 @@ func (s *stream) readLoop() {
 			// Check for Connect-wrapped context cancellation
 			if connectErr := new(connect.Error); errors.As(err, &connectErr) {
 				if connectErr.Code().String() == "canceled" || strings.Contains(connectErr.Message(), "context canceled") {
-					if s.explicitlyClosed {
+					if s.explicitlyClosed.Load() {
 						// This was an explicit close(), emit end instead of error
 						s.sendToRecvCh(nil, nil) // Signal end of stream
 						s.emitEnd()
@@ -463,14 +1145,41 @@ func (s *stream) readLoop() {
 				}
 			}
 
-			s.logger.WithError(err).Error("Failed to read from stream")
+			if s.reconnectStream(err) {
+				continue
+			}
+
+			s.log(logrus.ErrorLevel, logrus.Fields{logrus.ErrorKey: err}, "Failed to read from stream")
 			s.sendToRecvCh(nil, err) // Send error
-			s.emitError(err)         // This will now be a connect.Error
+			s.emitEndMeta(err)
+			s.emitError(err) // This will now be a connect.Error
 			return
 		}
 
-		// res is already a dynamicpb.Message, marshal it directly.
-		jsonBytes, err := protojson.Marshal(res)
+		if s.reconnect != nil {
+			s.reconnect.attempts = 0
+		}
+
+		index, admitted := s.admitReceived()
+		if !admitted {
+			continue // Past the count of cancelAfter(), the stream is being canceled
+		}
+
+		if s.assert != nil {
+			s.checkReceived()
+		}
+
+		if s.sink != nil {
+			if err := s.drain(); err != nil {
+				s.sendToRecvCh(nil, err)
+				s.emitError(err)
+				return
+			}
+			s.countReceived(index)
+			continue
+		}
+
+		data, err := s.marshalReceived()
 		if err != nil {
 			s.sendToRecvCh(nil, err) // Send error
 			s.emitError(err)
@@ -478,35 +1187,73 @@ func (s *stream) readLoop() {
 		}
 
 		// Send to recvCh for synchronous read() calls
-		s.sendToRecvCh(jsonBytes, nil)
+		s.sendToRecvCh(data, nil)
 
 		// Record received message metrics
 		if s.instanceMetrics != nil {
-			protocol := "connect"
-			contentType := "application/json"
-			if s.client.connectParams != nil {
-				protocol = s.client.connectParams.Protocol
-				contentType = s.client.connectParams.ContentType
-			}
-			tags := s.client.createMetricTags(s.method, protocol, contentType)
-			tags.Type = "stream"
-			messageSize := int64(len(jsonBytes))
-			s.instanceMetrics.recordStreamMessage(s.vu.Context(), s.vu, tags, "received", messageSize)
+			messageSize := int64(len(data))
+			s.instanceMetrics.recordStreamMessage(s.vu.Context(), s.vu, s.metricTags, "received", messageSize)
 		}
 
-		// emitData now receives JSON bytes instead of raw bytes
-		s.emitData(jsonBytes)
+		// data holds JSON, or protobuf wire bytes in binary mode
+		s.keepReceived(index, data)
+		s.emitData(data, index)
+		s.countReceived(index)
 	}
 }
 
+// receive reads the next message into the reused s.recvMsg. It receives from the
+// underlying connection directly, as BidiStreamForClient.Receive allocates a new
+// message for every call.
+func (s *stream) receive() error {
+	conn, err := s.connectStream.Conn()
+	if err != nil {
+		return err
+	}
+
+	proto.Reset(s.recvMsg)
+	return conn.Receive(s.recvMsg)
+}
+
+// marshalReceived marshals s.recvMsg using a pooled scratch buffer. The returned
+// slice is a copy, as it is handed over to the event loop.
+func (s *stream) marshalReceived() ([]byte, error) {
+	bufPtr, _ := marshalBufPool.Get().(*[]byte)
+	defer marshalBufPool.Put(bufPtr)
+
+	var b []byte
+	var err error
+	if s.binary {
+		b, err = proto.MarshalOptions{}.MarshalAppend((*bufPtr)[:0], s.recvMsg)
+	} else {
+		b, err = protojson.MarshalOptions{}.MarshalAppend((*bufPtr)[:0], s.recvMsg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	*bufPtr = b // Keep the grown buffer for the next message
+
+	// Never return nil, as nil signals the end of the stream to read()
+	return append(make([]byte, 0, len(b)), b...), nil
+}
+
 // sendToRecvCh sends a result to the receive channel for synchronous reads.
 // Blocks if channel is full (backpressure) - ensures no messages are dropped.
 func (s *stream) sendToRecvCh(data []byte, err error) {
 	if s.recvChClosed.Load() {
 		return
 	}
+	result := &recvResult{data: data, err: err}
+
+	// end() shuts the stream down while the server may still be sending, so the result is
+	// buffered first: a select ready on both channels picks one at random
+	select {
+	case s.recvCh <- result:
+		return
+	default:
+	}
 	select {
-	case s.recvCh <- &recvResult{data: data, err: err}:
+	case s.recvCh <- result:
 		// Message sent successfully
 	case <-s.done:
 		// Stream is shutting down, don't block forever
@@ -521,50 +1268,73 @@ func (s *stream) closeRecvCh() {
 	}
 }
 
-// emitData emits a 'data' event with the received data
-func (s *stream) emitData(data []byte) {
+// emitData emits a 'data' event with the index-th received data
+func (s *stream) emitData(data []byte, index int64) {
+	queued := time.Now()
 	s.tq.Queue(func() error {
-		rt := s.vu.Runtime()
-		if rt == nil {
+		s.recordSaturation(saturationEventLoop, time.Since(queued))
+
+		// cancelAfter() may have been called after the message was received
+		if count := s.cancelCount.Load(); count > 0 && index > count {
 			return nil
 		}
-		// Try to parse as JSON and convert to JS object
-		var result interface{}
-		if len(data) > 0 {
-			if err := json.Unmarshal(data, &result); err != nil {
-				// If JSON parsing fails, emit as string
-				s.eventListeners.emit("data", rt.ToValue(string(data)))
-			} else {
-				// Emit as parsed object
-				s.eventListeners.emit("data", rt.ToValue(result))
-			}
+
+		rt := s.vu.Runtime()
+		if rt == nil || (!s.binary && len(data) == 0) {
+			return nil
 		}
+		s.eventListeners.emit("data", s.messageValue(rt, data))
 		return nil
 	})
 }
 
-// emitEnd emits an 'end' event
+// messageValue converts received data to the value of the 'data' events: an ArrayBuffer
+// in binary mode, an object otherwise, or a string if the data isn't valid JSON
+func (s *stream) messageValue(rt *sobek.Runtime, data []byte) sobek.Value {
+	if s.binary {
+		return rt.ToValue(rt.NewArrayBuffer(data))
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return rt.ToValue(string(data))
+	}
+	return rt.ToValue(s.conversion.apply(rt, result))
+}
+
+// emitEnd emits an 'end' event, with the sink summary if the stream has a sink
 func (s *stream) emitEnd() {
+	var summary map[string]interface{}
+	if s.sink != nil {
+		summary = s.sink.summary()
+	}
+
 	s.tq.Queue(func() error {
-		s.eventListeners.emit("end", sobek.Undefined())
+		if summary == nil {
+			s.eventListeners.emit("end", sobek.Undefined())
+			return nil
+		}
+
+		rt := s.vu.Runtime()
+		if rt == nil {
+			return nil
+		}
+		s.eventListeners.emit("end", rt.ToValue(summary))
 		return nil
 	})
 }
 
-// emitError emits an 'error' event
-func (s *stream) emitError(err error) {
-	// Record stream error metrics
-	if s.instanceMetrics != nil && !s.streamStartTime.IsZero() {
-		duration := time.Since(s.streamStartTime)
-		protocol := "connect"
-		contentType := "application/json"
-		if s.client.connectParams != nil {
-			protocol = s.client.connectParams.Protocol
-			contentType = s.client.connectParams.ContentType
-		}
-		tags := s.client.createMetricTags(s.method, protocol, contentType)
-		tags.Type = "stream"
-		s.instanceMetrics.recordStreamEnd(s.vu.Context(), s.vu, duration, tags, err)
+// emitEndMeta emits an 'endMeta' event with the response headers, trailers and final
+// error of the stream. For the Connect protocol, the trailers and error come from the
+// EndStreamResponse envelope; for gRPC and gRPC-Web, from the trailers.
+func (s *stream) emitEndMeta(err error) {
+	// Copy the metadata in the read loop goroutine, the runtime is only touched in the queued task
+	headers := map[string][]string(s.connectStream.ResponseHeader().Clone())
+	trailers := map[string][]string(s.connectStream.ResponseTrailer().Clone())
+
+	var connectErr *connect.Error
+	if err != nil && !errors.As(err, &connectErr) {
+		connectErr = connect.NewError(connect.CodeUnknown, err)
 	}
 
 	s.tq.Queue(func() error {
@@ -572,91 +1342,195 @@ func (s *stream) emitError(err error) {
 		if rt == nil {
 			return nil
 		}
-		var errValue sobek.Value
 
-		// Check if it's a connect.Error
-		if connectErr := new(connect.Error); errors.As(err, &connectErr) {
-			// Create error object for connect.Error
+		metaObj := rt.NewObject()
+		must(rt, metaObj.Set("headers", newHeadersObject(rt, headers, s.flatHeaders)))
+		must(rt, metaObj.Set("trailers", newHeadersObject(rt, trailers, s.flatHeaders)))
+
+		if connectErr != nil {
 			errorObj := rt.NewObject()
 			must(rt, errorObj.Set("code", rt.ToValue(connectErr.Code().String())))
-			must(rt, errorObj.Set("message", rt.ToValue(connectErr.Error())))
-			must(rt, errorObj.Set("details", rt.ToValue(connectErr.Details())))
-			errValue = errorObj
+			must(rt, errorObj.Set("message", rt.ToValue(connectErr.Message())))
+			must(rt, errorObj.Set("metadata", rt.ToValue(map[string][]string(connectErr.Meta()))))
+			must(rt, errorObj.Set("raw", rt.ToValue(s.peer.rawError(connectErr))))
+			must(rt, metaObj.Set("error", errorObj))
 		} else {
-			// Fallback for generic errors
-			errorObj := rt.NewObject()
-			must(rt, errorObj.Set("message", err.Error()))
-			errValue = errorObj
+			must(rt, metaObj.Set("error", sobek.Null()))
 		}
 
+		s.eventListeners.emit("endMeta", metaObj)
+		return nil
+	})
+}
+
+// emitError emits an 'error' event
+func (s *stream) emitError(err error) {
+	s.failed.Store(true)
+	s.errMu.Lock()
+	if s.firstErr == nil {
+		s.firstErr = err
+	}
+	s.errMu.Unlock()
+
+	s.tq.Queue(func() error {
+		rt := s.vu.Runtime()
+		if rt == nil {
+			return nil
+		}
+		errValue := s.errorValue(rt, err)
+		s.rejectReady(errValue)
 		s.eventListeners.emit("error", errValue)
 		return nil
 	})
 }
 
+// errorValue converts an error of the stream to the value of the 'error' events
+func (s *stream) errorValue(rt *sobek.Runtime, err error) sobek.Value {
+	errorObj := rt.NewObject()
+
+	// Check if it's a connect.Error
+	if connectErr := new(connect.Error); errors.As(err, &connectErr) {
+		must(rt, errorObj.Set("code", rt.ToValue(connectErr.Code().String())))
+		must(rt, errorObj.Set("message", rt.ToValue(connectErr.Error())))
+		must(rt, errorObj.Set("details", rt.ToValue(connectErr.Details())))
+		must(rt, errorObj.Set("raw", rt.ToValue(s.peer.rawError(connectErr))))
+		return errorObj
+	}
+
+	// Fallback for generic errors
+	must(rt, errorObj.Set("message", err.Error()))
+	return errorObj
+}
+
 // shutdown closes the stream and cleans up resources
 func (s *stream) shutdown() {
-	// Record stream end metrics
-	if s.instanceMetrics != nil && !s.streamStartTime.IsZero() {
-		duration := time.Since(s.streamStartTime)
-		protocol := "connect"
-		contentType := "application/json"
-		if s.client.connectParams != nil {
-			protocol = s.client.connectParams.Protocol
-			contentType = s.client.connectParams.ContentType
-		}
-		tags := s.client.createMetricTags(s.method, protocol, contentType)
-		tags.Type = "stream"
-		s.instanceMetrics.recordStreamEnd(s.vu.Context(), s.vu, duration, tags, nil)
-	}
+	s.shutdownOnce.Do(s.doShutdown)
+}
 
+func (s *stream) doShutdown() {
 	// Close the done channel and task queue when shutdown is called
-	select {
-	case <-s.done:
-		// Already closed
-	default:
-		close(s.done)
-	}
+	close(s.done)
 
 	if s.readLoopStarted.Load() {
 		go func() {
 			<-s.readLoopDone
+			s.release()
 			s.closeTaskQueue()
 		}()
 		return
 	}
 
+	s.release()
 	s.closeTaskQueue()
 }
 
+// release frees the resources of an ended stream: its context, its per-call HTTP client,
+// and its place among the streams closed by Client.close(). It runs once both sides of
+// the stream are done, so it records the end of the stream once, with its first error.
+func (s *stream) release() {
+	s.log(logrus.DebugLevel, logrus.Fields{"event": "ended", "duration": time.Since(s.streamStartTime)}, "Stream ended")
+
+	if s.instanceMetrics != nil && !s.streamStartTime.IsZero() {
+		s.errMu.Lock()
+		err := s.firstErr
+		s.errMu.Unlock()
+		s.instanceMetrics.recordStreamEnd(s.vu.Context(), s.vu, time.Since(s.streamStartTime), s.metricTags, err)
+	}
+	if s.activeClient != nil {
+		s.instanceMetrics.recordActiveStreams(s.vu.Context(), s.vu, s.activeURL, s.activeClient, -1)
+	}
+
+	s.recordCancel()
+
+	if paused := s.pausedDuration(); paused > 0 && s.instanceMetrics != nil {
+		s.instanceMetrics.recordStreamPaused(s.vu.Context(), s.vu, s.metricTags, paused)
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.client.untrackStream(s)
+	if s.reaper != nil {
+		s.reaper.remove(s)
+	}
+	if s.httpClient != nil {
+		s.client.releaseHTTPClient(s.httpClient)
+	}
+}
+
 func (s *stream) closeTaskQueue() {
 	s.closeQueueOnce.Do(func() {
 		if s.tq != nil {
 			s.tq.Close()
 		}
+		if s.endMock != nil {
+			s.endMock()
+		}
 	})
 }
 
+// maxListeners is the count of listeners of an event above which a leak is suspected
+const maxListeners = 10
+
 // eventListeners manages event listeners for the stream
 type eventListeners struct {
 	mu        sync.RWMutex
-	listeners map[string][]sobek.Value
+	listeners map[string][]eventListener
+	warned    map[string]bool // Events warned about exceeding maxListeners
+}
+
+// eventListener is a listener attached with on() or once()
+type eventListener struct {
+	fn   sobek.Value
+	once bool
 }
 
 func newEventListeners() *eventListeners {
 	return &eventListeners{
-		listeners: make(map[string][]sobek.Value),
+		listeners: make(map[string][]eventListener),
+		warned:    make(map[string]bool),
+	}
+}
+
+// add attaches the listener unless it is already attached to the event. It returns the
+// count of listeners of the event, and whether it exceeds maxListeners for the first time.
+func (el *eventListeners) add(event string, listener sobek.Value, once bool) (int, bool) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	for _, l := range el.listeners[event] {
+		if l.fn.SameAs(listener) {
+			return len(el.listeners[event]), false
+		}
 	}
+	el.listeners[event] = append(el.listeners[event], eventListener{fn: listener, once: once})
+
+	count := len(el.listeners[event])
+	if count <= maxListeners || el.warned[event] {
+		return count, false
+	}
+	el.warned[event] = true
+	return count, true
 }
 
-func (el *eventListeners) add(event string, listener sobek.Value) {
+// remove detaches the listener from the event, or all its listeners with a nullish listener.
+// The listeners are copied, as emit may be iterating over them.
+func (el *eventListeners) remove(event string, listener sobek.Value) {
 	el.mu.Lock()
 	defer el.mu.Unlock()
 
-	if el.listeners[event] == nil {
-		el.listeners[event] = make([]sobek.Value, 0)
+	if common.IsNullish(listener) {
+		delete(el.listeners, event)
+		return
+	}
+
+	kept := make([]eventListener, 0, len(el.listeners[event]))
+	for _, l := range el.listeners[event] {
+		if !l.fn.SameAs(listener) {
+			kept = append(kept, l)
+		}
 	}
-	el.listeners[event] = append(el.listeners[event], listener)
+	el.listeners[event] = kept
 }
 
 func (el *eventListeners) emit(event string, data sobek.Value) {
@@ -665,7 +1539,10 @@ func (el *eventListeners) emit(event string, data sobek.Value) {
 	el.mu.RUnlock()
 
 	for _, listener := range listeners {
-		if fn, ok := sobek.AssertFunction(listener); ok {
+		if listener.once {
+			el.remove(event, listener.fn)
+		}
+		if fn, ok := sobek.AssertFunction(listener.fn); ok {
 			if data != nil {
 				_, _ = fn(sobek.Undefined(), data)
 			} else {
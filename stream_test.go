@@ -1,12 +1,31 @@
 package connectrpc_test
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"connectrpc.com/connect"
+	"github.com/bufbuild/protocompile"
 	connectrpc "github.com/bumberboy/xk6-connectrpc"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 func TestStream_WithoutClient(t *testing.T) {
@@ -84,6 +103,580 @@ func TestStream_InvalidMethod(t *testing.T) {
 		"Expected proto loading or method not found error, got: %s", errorMsg)
 }
 
+func TestAPIMisuse(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { protocol: 'grpc', plaintext: true });
+	`)
+	require.NoError(t, err)
+
+	_, err = ts.Run(`new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/Ping');`)
+	assert.ErrorContains(t, err, "invalid ConnectRPC Stream's method: "+
+		"/k6.connectrpc.ping.v1.PingService/Ping is a unary method, call it with client.invoke() or client.asyncInvoke()")
+
+	_, err = ts.Run(`client.invoke('/k6.connectrpc.ping.v1.PingService/CountUp', { number: 3 });`)
+	assert.ErrorContains(t, err,
+		"/k6.connectrpc.ping.v1.PingService/CountUp is a streaming method, call it with new connectrpc.Stream()")
+
+	_, err = ts.Run(`client.close();`)
+	require.NoError(t, err)
+
+	containers := drainSamples(ts.samples)
+	samples := findSamples(containers, "connectrpc_api_misuse")
+	require.Len(t, samples, 2)
+
+	want := []struct{ misuse, callType, procedure string }{
+		{"stream_on_unary", "stream", "Ping"},
+		{"invoke_on_stream", "unary", "CountUp"},
+	}
+	for i, w := range want {
+		tags := samples[i].Tags.Map()
+		assert.Equal(t, w.misuse, tags["misuse"])
+		assert.Equal(t, w.callType, tags["type"])
+		assert.Equal(t, w.procedure, tags["procedure"])
+		assert.Equal(t, "grpc", tags["protocol"])
+	}
+
+	// Neither call was made
+	assert.Empty(t, findSamples(containers, "connectrpc_streams"))
+	assert.Empty(t, findSamples(containers, "connectrpc_reqs"))
+}
+
+func TestStreamArrivalRate(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { protocol: 'grpc', plaintext: true });
+			var method = '/k6.connectrpc.ping.v1.PingService/CumSum';
+
+			var indexes = [];
+			var sums = 0;
+			var exchanged = await connectrpc.streamArrivalRate(client, method, {
+				rate: 50, timeUnit: '1s', duration: '200ms',
+			}, function(stream, index) {
+				indexes.push(index);
+				stream.on('data', function() { sums++; });
+				stream.write({ number: index });
+				stream.end();
+			});
+
+			// A stream never ended takes the only place, until it's closed after gracefulStop
+			var stuck = await connectrpc.streamArrivalRate(client, method, {
+				rate: 100, duration: 100, maxActive: 1, gracefulStop: 50,
+			}, function(stream) {
+				stream.write({ number: 1 });
+			});
+
+			var thrown = await connectrpc.streamArrivalRate(client, method, {
+				rate: 20, duration: '60ms',
+			}, function() {
+				throw new Error('boom');
+			});
+
+			client.close();
+			call(JSON.stringify({
+				exchanged: exchanged,
+				ordered: indexes.every(function(v, i) { return v === i; }),
+				sums: sums === exchanged.completed,
+				stuck: stuck,
+				thrown: thrown,
+			}));
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 1)
+	var result struct {
+		Exchanged, Stuck, Thrown map[string]int
+		Ordered, Sums            bool
+	}
+	require.NoError(t, json.Unmarshal([]byte(recorded[0]), &result))
+
+	assert.InDelta(t, 10, result.Exchanged["opened"], 2)
+	assert.Equal(t, result.Exchanged["opened"], result.Exchanged["completed"])
+	assert.Zero(t, result.Exchanged["failed"]+result.Exchanged["interrupted"]+result.Exchanged["dropped"])
+	assert.True(t, result.Ordered)
+	assert.True(t, result.Sums)
+
+	assert.Equal(t, 1, result.Stuck["opened"])
+	assert.Equal(t, 1, result.Stuck["interrupted"])
+	assert.Positive(t, result.Stuck["dropped"])
+
+	assert.Positive(t, result.Thrown["opened"])
+	assert.Equal(t, result.Thrown["opened"], result.Thrown["failed"])
+
+	dropped := findSamples(drainSamples(ts.samples), "connectrpc_stream_arrivals_dropped")
+	assert.Len(t, dropped, result.Stuck["dropped"])
+	if len(dropped) > 0 {
+		assert.Equal(t, "CumSum", dropped[0].Tags.Map()["procedure"])
+	}
+}
+
+func TestStreamArrivalRateInvalid(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+		var method = '/k6.connectrpc.ping.v1.PingService/CumSum';
+		var exchange = function(stream) { stream.end(); };
+	`)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name        string
+		Call        string
+		ErrContains string
+	}{
+		{"NoRate", `client, method, { duration: '1s' }, exchange`, "invalid streamArrivalRate options: rate is required"},
+		{"NoDuration", `client, method, { rate: 1 }, exchange`, "invalid streamArrivalRate options: duration is required"},
+		{"InvalidMaxActive", `client, method, { rate: 1, duration: '1s', maxActive: 0 }, exchange`, "invalid maxActive: must be at least 1, got 0"},
+		{"InvalidTimeUnit", `client, method, { rate: 1, duration: '1s', timeUnit: 'second' }, exchange`, `invalid timeUnit: "second" is not a duration`},
+		{"NegativeDuration", `client, method, { rate: 1, duration: -1000 }, exchange`, `invalid duration: "-1000" is not a duration`},
+		{"UnknownOption", `client, method, { rate: 1, duration: '1s', vus: 2 }, exchange`, `unknown option "vus"`},
+		{"NoExchange", `client, method, { rate: 1, duration: '1s' }`, "invalid streamArrivalRate exchange: must be a function"},
+		{"UnaryMethod", `client, '/k6.connectrpc.ping.v1.PingService/Ping', { rate: 1, duration: '1s' }, exchange`, "is a unary method"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ts.Run(`connectrpc.streamArrivalRate(` + tc.Call + `);`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
+func TestStreamCancelAfter(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { protocol: 'grpc', plaintext: true });
+			var method = '/k6.connectrpc.ping.v1.PingService/CountUp';
+			var countUp = function(number) {
+				var stream = new connectrpc.Stream(client, method);
+				stream.write({ number: number });
+				stream.end();
+				return stream;
+			};
+
+			// The server would send 50 messages
+			var stream = countUp(50);
+			var numbers = [];
+			stream.on('data', function(msg) { numbers.push(msg.number); });
+			stream.cancelAfter(3);
+			await new Promise(function(resolve) { stream.on('end', resolve); });
+
+			var taken = await countUp(50).take(2);
+			var short = await countUp(2).take(5);
+
+			// The messages received before take() are taken too, from a stream already ended
+			var ended = countUp(3);
+			var seen = [];
+			ended.on('data', function(msg) { seen.push(msg.number); });
+			await new Promise(function(resolve) { ended.on('end', resolve); });
+			var late = await ended.take(2);
+
+			client.close();
+			call(JSON.stringify({ numbers: numbers, taken: taken, short: short, seen: seen, late: late }));
+		})();
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"numbers": ["1", "2", "3"],
+		"taken": [{ "number": "1" }, { "number": "2" }],
+		"short": [{ "number": "1" }, { "number": "2" }],
+		"seen": ["1", "2", "3"],
+		"late": [{ "number": "1" }, { "number": "2" }]
+	}`, ts.callRecorder.Recorded()[0])
+
+	// The stream ended by the server wasn't canceled
+	containers := drainSamples(ts.samples)
+	assert.Len(t, findSamples(containers, "connectrpc_stream_cancel_duration"), 2)
+	assert.Empty(t, findSamples(containers, "connectrpc_stream_errors"))
+}
+
+func TestStreamCancelAfterInvalid(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+		var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+	`)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name        string
+		Call        string
+		ErrContains string
+	}{
+		{"Zero", `stream.cancelAfter(0)`, "invalid cancelAfter count: must be a positive integer, got 0"},
+		{"Fraction", `stream.cancelAfter(1.5)`, "invalid cancelAfter count: must be a positive integer, got 1.5"},
+		{"NoCount", `stream.take()`, "invalid take count: must be a positive integer"},
+		{"Sink", `new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp', { sink: 'count' }).take(1)`, "cannot take from a stream with a sink"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ts.Run(tc.Call)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
+func TestStreamAppKeepalive(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+			var sumUp = async function(recordMetrics) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum', {
+					appKeepalive: { message: { number: 10 }, interval: '20ms', recordMetrics: recordMetrics },
+				});
+				var sums = [];
+				stream.on('data', function(msg) {
+					// A heartbeat may go before the end
+					if (sums.length < 3) {
+						sums.push(msg.sum);
+						if (sums.length === 3) {
+							stream.end();
+						}
+					}
+				});
+				stream.write({ number: 1 });
+				await new Promise(function(resolve) { stream.on('end', resolve); });
+				return sums;
+			};
+
+			var sums = await sumUp(false);
+			var recorded = await sumUp(true);
+			client.close();
+			call(JSON.stringify({ sums: sums, recorded: recorded }));
+		})();
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"sums": ["1", "11", "21"],
+		"recorded": ["1", "11", "21"]
+	}`, ts.callRecorder.Recorded()[0])
+
+	// The heartbeats are left out of the message metrics, unless recordMetrics: true
+	var written, heartbeats int
+	for _, s := range findSamples(drainSamples(ts.samples), "connectrpc_stream_msgs_sent") {
+		if s.Tags.Map()["heartbeat"] == "true" {
+			heartbeats++
+		} else {
+			written++
+		}
+	}
+	assert.Equal(t, 2, written)
+	assert.GreaterOrEqual(t, heartbeats, 2)
+}
+
+func TestStreamAppKeepaliveInvalid(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+		var method = '/k6.connectrpc.ping.v1.PingService/CumSum';
+	`)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name        string
+		Keepalive   string
+		ErrContains string
+	}{
+		{"NotAnObject", `'30s'`, "invalid appKeepalive: must be an object like { message, interval }"},
+		{"NoInterval", `{ message: { number: 1 } }`, "invalid appKeepalive: a message and an interval are required"},
+		{"Interval", `{ message: { number: 1 }, interval: '-1s' }`, "invalid appKeepalive: interval must be a positive duration like '30s', got -1s"},
+		{"Message", `{ message: 'ping', interval: '1s' }`, "invalid appKeepalive: message must be a message object"},
+		{"UnknownKey", `{ message: { number: 1 }, interval: '1s', jitter: '1s' }`, `invalid appKeepalive: unknown key "jitter", must be message, interval or recordMetrics`},
+		{"UnknownField", `{ message: { total: 1 }, interval: '1s' }`, "invalid appKeepalive message"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ts.Run(`new connectrpc.Stream(client, method, { appKeepalive: ` + tc.Keepalive + ` });`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
+func TestActiveStreams(t *testing.T) {
+	t.Parallel()
+
+	// The parallel subtests run after the test returns
+	srv := connectrpc.NewTestServer(false)
+	t.Cleanup(srv.Close)
+
+	for _, tc := range []struct {
+		strategy   string
+		connection []float64
+	}{
+		{"per-vu", []float64{1, 2, 1, 0}},
+		{"per-stream", []float64{1, 1, 0, 0}},
+	} {
+		t.Run(tc.strategy, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newTestState(t)
+
+			_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+			require.NoError(t, err)
+
+			ts.ToVUContext()
+
+			// The first stream ends before the second one
+			_, err = ts.RunOnEventLoop(`
+				(async function() {
+					var client = new connectrpc.Client();
+					client.connect('` + srv.URL + `', { connectionStrategy: '` + tc.strategy + `', plaintext: true });
+
+					var streams = [];
+					for (var i = 1; i <= 2; i++) {
+						var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+						var ended = new Promise(function(resolve, reject) { stream.on('end', resolve); stream.on('error', function(e) { reject(new Error(e.message)); }); });
+						var received = new Promise(function(resolve) { stream.once('data', resolve); });
+						stream.write({ number: i });
+						await received;
+						streams.push({ stream: stream, ended: ended });
+					}
+					for (var s of streams) {
+						s.stream.end();
+						await s.ended;
+					}
+					client.close();
+					call('ended');
+				})();
+			`)
+			require.NoError(t, err)
+			require.Equal(t, []string{"ended"}, ts.callRecorder.Recorded())
+
+			values := map[string][]float64{}
+			for _, sample := range findSamples(drainSamples(ts.samples), "connectrpc_active_streams") {
+				scope := sample.Tags.Map()["scope"]
+				values[scope] = append(values[scope], sample.Value)
+				assert.Equal(t, srv.URL, sample.Tags.Map()["url"])
+			}
+			assert.Equal(t, []float64{1, 2, 1, 0}, values["vu"])
+			assert.Equal(t, tc.connection, values["connection"])
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { protocol: 'grpc', plaintext: true });
+			var method = '/k6.connectrpc.ping.v1.PingService/CumSum';
+
+			var passed = await connectrpc.session(client, method, [
+				{ send: { number: 2 } },
+				{ expect: { field: 'sum', equals: 2 } },
+				{ wait: '20ms' },
+				{ send: { number: 3 } },
+				{ expect: { equals: { sum: '5' } } },
+				{ end: true },
+			], { tags: { scenario_step: 'cumsum' } });
+
+			var failed = await connectrpc.session(client, method, [
+				{ send: { number: 1 } },
+				{ expect: { field: 'sum', equals: 2 } },
+				{ send: { number: 1 } },
+			]);
+
+			var ended = await connectrpc.session(client, method, [
+				{ end: true },
+				{ expect: {} },
+			]);
+
+			client.close();
+			call(JSON.stringify({ passed: passed, failed: failed, ended: ended }));
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 1)
+	type stepResult struct {
+		Action   string
+		Duration float64
+		Message  map[string]string
+	}
+	var result map[string]struct {
+		OK         bool
+		Steps      []stepResult
+		FailedStep *int
+		Error      string
+	}
+	require.NoError(t, json.Unmarshal([]byte(recorded[0]), &result))
+
+	passed := result["passed"]
+	assert.True(t, passed.OK, passed.Error)
+	assert.Nil(t, passed.FailedStep)
+	require.Len(t, passed.Steps, 6)
+	actions := make([]string, 0, len(passed.Steps))
+	for _, step := range passed.Steps {
+		actions = append(actions, step.Action)
+	}
+	assert.Equal(t, []string{"send", "expect", "wait", "send", "expect", "end"}, actions)
+	assert.Equal(t, map[string]string{"sum": "2"}, passed.Steps[1].Message)
+	assert.Equal(t, map[string]string{"sum": "5"}, passed.Steps[4].Message)
+	assert.GreaterOrEqual(t, passed.Steps[2].Duration, 20.0)
+
+	failed := result["failed"]
+	assert.False(t, failed.OK)
+	require.NotNil(t, failed.FailedStep)
+	assert.Equal(t, 1, *failed.FailedStep)
+	assert.Equal(t, "expected sum to equal 2, got 1", failed.Error)
+	assert.Len(t, failed.Steps, 2)
+
+	ended := result["ended"]
+	assert.False(t, ended.OK)
+	assert.Equal(t, "the stream ended before the expected message", ended.Error)
+
+	samples := drainSamples(ts.samples)
+	steps := findSamples(samples, "connectrpc_session_step_duration")
+	require.Len(t, steps, 10)
+	tags := steps[2].Tags.Map()
+	assert.Equal(t, "2", tags["step"])
+	assert.Equal(t, "wait", tags["action"])
+	assert.Equal(t, "CumSum", tags["procedure"])
+	assert.Equal(t, "cumsum", tags["scenario_step"])
+	assert.Len(t, findSamples(samples, "connectrpc_stream_errors"), 2)
+}
+
+func TestSessionInvalid(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+		var method = '/k6.connectrpc.ping.v1.PingService/CumSum';
+	`)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name        string
+		Call        string
+		ErrContains string
+	}{
+		{"NoSteps", `client, method`, "invalid session steps: must be an array of steps"},
+		{"NotArray", `client, method, { send: {} }`, "invalid session steps: must be an array of steps"},
+		{"TwoActions", `client, method, [{ send: {}, end: true }]`, "step 0: must have one of send, expect, wait or end, got 2 keys"},
+		{"UnknownAction", `client, method, [{ read: {} }]`, `step 0: unknown action "read"`},
+		{"InvalidSend", `client, method, [{ send: { count: 1 } }]`, "step 0: invalid send"},
+		{"UnknownField", `client, method, [{ expect: { field: 'total', equals: 1 } }]`, "step 0: invalid expect: unknown field total of k6.connectrpc.ping.v1.CumSumResponse"},
+		{"NoEquals", `client, method, [{ expect: { field: 'sum' } }]`, "step 0: invalid expect: field sum requires equals"},
+		{"InvalidWait", `client, method, [{ wait: 100 }]`, "step 0: invalid wait: must be a duration string like '1s', got 100"},
+		{"SendAfterEnd", `client, method, [{ end: true }, { send: {} }]`, "step 1: send after end"},
+		{"UnaryMethod", `client, '/k6.connectrpc.ping.v1.PingService/Ping', []`, "invalid session method"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ts.Run(`connectrpc.session(` + tc.Call + `);`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
 func TestStreamEnvelopeFraming(t *testing.T) {
 	t.Parallel()
 
@@ -1482,3 +2075,1160 @@ func TestStreamMetrics(t *testing.T) {
 	// but the metric registration should work
 	_ = sampleContainers
 }
+
+func TestStreamEndMeta(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	for _, protocol := range []string{"connect", "grpc", "grpc-web"} {
+		t.Run(protocol, func(t *testing.T) {
+			_, err := ts.RunOnEventLoop(`
+				(async function() {
+					var client = new connectrpc.Client();
+					client.connect('` + srv.URL + `', { protocol: '` + protocol + `', plaintext: true });
+
+					var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+
+					var meta = null;
+					var completed = new Promise(function(resolve, reject) {
+						stream.on('endMeta', function(m) {
+							meta = m;
+						});
+						stream.on('end', function() {
+							resolve();
+						});
+						stream.on('error', function(e) {
+							reject(new Error(e.message));
+						});
+					});
+
+					stream.write({ number: 1 });
+					stream.end();
+
+					await completed;
+					client.close();
+
+					if (meta === null) {
+						throw new Error('endMeta was not emitted before end');
+					}
+					if (meta.error !== null) {
+						throw new Error('unexpected endMeta error: ' + JSON.stringify(meta.error));
+					}
+					if (meta.trailers['Handler-Trailer'][0] !== 'some-trailer-value') {
+						throw new Error('unexpected endMeta trailers: ' + JSON.stringify(meta.trailers));
+					}
+					return null;
+				})();
+			`)
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := ts.RunOnEventLoop(`
+			(async function() {
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', { protocol: 'connect', plaintext: true });
+
+				// CountUp fails for non-positive numbers
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+
+				var meta = null;
+				var completed = new Promise(function(resolve) {
+					stream.on('endMeta', function(m) {
+						meta = m;
+					});
+					stream.on('error', function() {
+						resolve();
+					});
+				});
+
+				stream.write({ number: 0 });
+				stream.end();
+
+				await completed;
+				client.close();
+
+				if (meta === null || meta.error === null) {
+					throw new Error('endMeta with error was not emitted');
+				}
+				if (meta.error.code !== 'invalid_argument') {
+					throw new Error('unexpected endMeta error code: ' + meta.error.code);
+				}
+				return null;
+			})();
+		`)
+		require.NoError(t, err)
+	})
+}
+
+func TestStreamSSE(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true, httpVersion: '1.1' });
+			var countUp = function(number) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp', { sse: true });
+				var result = { numbers: [] };
+				stream.on('open', function(open) { result.header = open.headers['Handler-Header']; });
+				stream.on('data', function(msg) { result.numbers.push(msg.number); });
+				stream.on('endMeta', function(meta) {
+					result.trailer = meta.trailers['Handler-Trailer'];
+					result.error = meta.error && meta.error.code + ': ' + meta.error.message;
+				});
+				stream.write({ number: number });
+				stream.end();
+				return new Promise(function(resolve) {
+					stream.on('end', function() { resolve(result); });
+					stream.on('error', function() { resolve(result); });
+				});
+			};
+
+			var counted = await countUp(3);
+			var failed = await countUp(0);
+			client.close();
+			call(JSON.stringify({ counted: counted, failed: failed }));
+		})();
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"counted": { "numbers": ["1", "2", "3"], "header": ["some-value"], "trailer": ["some-trailer-value"], "error": null },
+		"failed": { "numbers": [], "error": "invalid_argument: number must be positive: got 0" }
+	}`, ts.callRecorder.Recorded()[0])
+
+	// The streams read as SSE are tagged with their transport
+	received := findSamples(drainSamples(ts.samples), "connectrpc_stream_msgs_received")
+	require.Len(t, received, 3)
+	for _, s := range received {
+		assert.Equal(t, "sse", s.Tags.Map()["transport"])
+	}
+}
+
+func TestStreamSSEInvalid(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	testCases := []struct {
+		Name        string
+		Connect     string
+		Method      string
+		ErrContains string
+	}{
+		{"Bidi", `{ plaintext: true }`, "CumSum", "sse is for server streaming methods, k6.connectrpc.ping.v1.PingService.CumSum isn't one"},
+		{"GRPC", `{ plaintext: true, protocol: 'grpc' }`, "CountUp", "sse requires the connect protocol, not grpc"},
+		{"Proto", `{ plaintext: true, contentType: 'application/proto' }`, "CountUp", "sse requires the application/json content type, not application/proto"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ts.Run(`
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', ` + tc.Connect + `);
+			new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/` + tc.Method + `', { sse: true });
+		`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
+func TestStreamReconnect(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	// The token rotates on the first call, which fails, and the stream is established
+	// again with the token of refreshHeaderFn
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var token = 'token-1';
+			var down = false;
+			var client = new connectrpc.Client();
+			client.connect('mock://', {
+				handlers: {
+					'/k6.connectrpc.ping.v1.PingService/CountUp': function(request, call) {
+						if (down) {
+							throw { code: 'unavailable', message: 'down' };
+						}
+						if (call.headers['authorization'] !== 'Bearer ' + token) {
+							throw { code: 'unauthenticated', message: 'expired token' };
+						}
+						if (token === 'token-1') {
+							token = 'token-2';
+							throw { code: 'unauthenticated', message: 'expired token' };
+						}
+						return [{ number: 1 }, { number: 2 }];
+					},
+				},
+			});
+
+			function countUp(params) {
+				return new Promise(function(resolve) {
+					var result = { reconnects: [], numbers: [] };
+					var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp', params);
+					stream.on('reconnect', function(e) { result.reconnects.push(e); });
+					stream.on('data', function(msg) { result.numbers.push(msg.number); });
+					stream.on('error', function(e) { result.error = e.code; resolve(result); });
+					stream.on('end', function() { resolve(result); });
+					stream.write({ number: 2 });
+					stream.end();
+				});
+			}
+
+			var refreshed = await countUp({
+				refreshHeaderFn: function() { return { Authorization: 'Bearer ' + token }; },
+				refreshInterval: '10ms',
+				reconnect: { delay: '200ms' },
+			});
+			down = true;
+			var failed = await countUp({ reconnect: { maxAttempts: 2, delay: 0 } });
+			client.close();
+			call(JSON.stringify({ refreshed: refreshed, failed: failed }));
+		})();
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"refreshed": {
+			"reconnects": [{ "attempt": 1, "code": "unauthenticated", "message": "unauthenticated: expired token" }],
+			"numbers": ["1", "2"]
+		},
+		"failed": {
+			"reconnects": [
+				{ "attempt": 1, "code": "unavailable", "message": "unavailable: down" },
+				{ "attempt": 2, "code": "unavailable", "message": "unavailable: down" }
+			],
+			"numbers": [],
+			"error": "unavailable"
+		}
+	}`, ts.callRecorder.Recorded()[0])
+}
+
+func TestStreamReconnectInvalid(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('mock://');
+	`)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name        string
+		Method      string
+		Params      string
+		ErrContains string
+	}{
+		{"NotServerStreaming", "CumSum", `{ reconnect: true }`, "reconnect is for server streaming methods, k6.connectrpc.ping.v1.PingService.CumSum isn't one"},
+		{"Reconnect", "CountUp", `{ reconnect: 'yes' }`, "invalid reconnect: must be true or an object like { maxAttempts, delay }"},
+		{"MaxAttempts", "CountUp", `{ reconnect: { maxAttempts: 0 } }`, "invalid reconnect: maxAttempts must be a positive integer, got 0"},
+		{"UnknownKey", "CountUp", `{ reconnect: { backoff: '1s' } }`, `invalid reconnect: unknown key "backoff", must be maxAttempts or delay`},
+		{"RefreshHeaderFn", "CountUp", `{ refreshHeaderFn: 'Bearer token' }`, "invalid refreshHeaderFn: must be a function returning headers"},
+		{"RefreshInterval", "CountUp", `{ refreshInterval: '1m' }`, "refreshInterval requires a refreshHeaderFn"},
+		{"Headers", "CountUp", `{ refreshHeaderFn: function() { return { 'bad header': 'token' }; } }`, `invalid refreshHeaderFn headers: "bad header" is not a valid header name`},
+		{"Throws", "CountUp", `{ refreshHeaderFn: function() { throw new Error('no token'); } }`, "refreshHeaderFn failed: Error: no token"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ts.Run(`new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/` + tc.Method + `', ` + tc.Params + `);`)
+		assert.ErrorContains(t, err, tc.ErrContains, tc.Name)
+	}
+}
+
+func TestStreamBinaryMode(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { protocol: 'connect', contentType: 'application/proto', plaintext: true });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum', { binary: true });
+
+			var sums = [];
+			var completed = new Promise(function(resolve, reject) {
+				stream.on('data', function(data) {
+					if (!(data instanceof ArrayBuffer)) {
+						reject(new Error('expected an ArrayBuffer, got ' + typeof data));
+						return;
+					}
+					// CumSumResponse{sum} is encoded as field 1 varint: 0x08, sum
+					sums.push(new Uint8Array(data)[1]);
+				});
+				stream.on('end', resolve);
+				stream.on('error', function(e) {
+					reject(new Error(e.message));
+				});
+			});
+
+			// CumSumRequest{number} is encoded as field 1 varint: 0x08, number
+			stream.write(new Uint8Array([0x08, 5]).buffer);
+			stream.write(new Uint8Array([0x08, 10]));
+			stream.end();
+
+			await completed;
+			client.close();
+
+			if (sums.join(',') !== '5,15') {
+				throw new Error('unexpected sums: ' + sums.join(','));
+			}
+			return null;
+		})();
+	`)
+	require.NoError(t, err)
+}
+
+func TestStreamWriteFrom(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');
+		var numbers = connectrpc.feeder('testdata/feeder/numbers.ndjson');
+		var looping = connectrpc.feeder('testdata/feeder/numbers.csv', { loop: true });
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			async function cumSum(feeder, options) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+
+				var sums = [];
+				var completed = new Promise(function(resolve, reject) {
+					stream.on('data', function(data) {
+						sums.push(data.sum);
+					});
+					stream.on('end', resolve);
+					stream.on('error', function(e) {
+						reject(new Error(e.message));
+					});
+				});
+
+				var written = await stream.writeFrom(feeder, options);
+				stream.end();
+				await completed;
+				return written + ':' + sums.join(',');
+			}
+
+			var result = await cumSum(numbers, { rate: 100 });
+			if (result !== '3:1,3,6') {
+				throw new Error('unexpected ndjson result: ' + result);
+			}
+
+			result = await cumSum(looping, { count: 5 });
+			if (result !== '5:1,3,6,7,9') {
+				throw new Error('unexpected looping csv result: ' + result);
+			}
+
+			client.close();
+			return null;
+		})();
+	`)
+	require.NoError(t, err)
+}
+
+func TestFeederNext(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`var numbers = connectrpc.feeder('testdata/feeder/numbers.csv');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	val, err := ts.Run(`
+		var records = [];
+		for (var record = numbers.next(); record !== null; record = numbers.next()) {
+			records.push(record.number);
+		}
+		records.join(',');
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "1,2,3", val.String())
+
+	_, err = ts.Run(`connectrpc.feeder('testdata/feeder/numbers.csv');`)
+	require.ErrorContains(t, err, "feeder must be called in the init context")
+}
+
+func TestStreamWriteInterval(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			async function cumSum(msg, options) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+
+				var sums = [];
+				var completed = new Promise(function(resolve, reject) {
+					stream.on('data', function(data) {
+						sums.push(data.sum);
+					});
+					stream.on('end', resolve);
+					stream.on('error', function(e) {
+						reject(new Error(e.message));
+					});
+				});
+
+				var scheduled = await stream.writeInterval(msg, options);
+				stream.end();
+				await completed;
+				return scheduled + ':' + sums.join(',');
+			}
+
+			var start = Date.now();
+			var result = await cumSum({ number: 2 }, { rate: '20/s', duration: '200ms' });
+			if (result !== '4:2,4,6,8') {
+				throw new Error('unexpected static message result: ' + result);
+			}
+			if (Date.now() - start < 150) {
+				throw new Error('messages were not paced');
+			}
+
+			result = await cumSum(function(i) { return { number: i + 1 }; }, { rate: 50, duration: '100ms' });
+			if (result !== '5:1,3,6,10,15') {
+				throw new Error('unexpected factory result: ' + result);
+			}
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			try {
+				stream.writeInterval({ number: 1 }, { rate: '10/day' });
+				throw new Error('expected an invalid rate error');
+			} catch (e) {
+				if (e.message.indexOf('unknown time unit') < 0) {
+					throw e;
+				}
+			}
+			stream.close();
+
+			client.close();
+			return null;
+		})();
+	`)
+	require.NoError(t, err)
+}
+
+func TestStreamSink(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	// CountUpResponse{number} is encoded as field 1 varint: 0x08, number
+	sum := sha256.Sum256([]byte{0x08, 1, 0x08, 2, 0x08, 3, 0x08, 4, 0x08, 5})
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			function countUp(sink) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp', { sink: sink });
+				var completed = new Promise(function(resolve, reject) {
+					stream.on('data', function() {
+						reject(new Error('unexpected data event with sink ' + sink));
+					});
+					stream.on('end', resolve);
+					stream.on('error', function(e) {
+						reject(new Error(e.message));
+					});
+				});
+				stream.write({ number: 5 });
+				stream.end();
+				return completed;
+			}
+
+			var summaries = [await countUp('discard'), await countUp('count'), await countUp('sha256')];
+			var expected = [
+				{ sink: 'discard', messages: 5 },
+				{ sink: 'count', messages: 5, bytes: 10 },
+				{ sink: 'sha256', messages: 5, bytes: 10, sha256: '` + hex.EncodeToString(sum[:]) + `' },
+			];
+			for (var i = 0; i < expected.length; i++) {
+				var keys = Object.keys(expected[i]);
+				var same = Object.keys(summaries[i]).length === keys.length && keys.every(function(k) {
+					return summaries[i][k] === expected[i][k];
+				});
+				if (!same) {
+					throw new Error('unexpected summary: ' + JSON.stringify(summaries[i]));
+				}
+			}
+
+			try {
+				new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp', { sink: 'md5' });
+				throw new Error('expected an invalid sink error');
+			} catch (e) {
+				if (e.message.indexOf("invalid sink: md5") < 0) {
+					throw e;
+				}
+			}
+
+			client.close();
+			return null;
+		})();
+	`)
+	require.NoError(t, err)
+
+	// The discarded messages are counted without a size
+	containers := drainSamples(ts.samples)
+	assert.Len(t, findSamples(containers, "connectrpc_stream_msgs_received"), 15)
+	sizes := findSamples(containers, "connectrpc_resp_size")
+	require.Len(t, sizes, 10)
+	for _, sample := range sizes {
+		assert.Equal(t, float64(2), sample.Value)
+	}
+}
+
+func TestStreamReady(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			var events = [];
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+			stream.on('open', function(open) { events.push('open ' + typeof open.headers); });
+			stream.on('data', function(data) { events.push('data ' + data.number); });
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			stream.write({ number: 2 });
+			stream.end();
+			var open = await stream.ready();
+			await ended;
+			var again = await stream.ready();
+
+			var refusing = new connectrpc.Client();
+			refusing.connect('mock://', {
+				handlers: {
+					'/k6.connectrpc.ping.v1.PingService/CountUp': function() {
+						throw { code: 'unauthenticated', message: 'missing token' };
+					},
+				},
+			});
+			var refused = new connectrpc.Stream(refusing, '/k6.connectrpc.ping.v1.PingService/CountUp');
+			refused.on('open', function() { events.push('refused open'); });
+			refused.write({ number: 1 });
+			refused.end();
+			var rejection = null;
+			try {
+				await refused.ready();
+			} catch (e) {
+				rejection = e.code;
+			}
+
+			call(JSON.stringify({ events: events, same: open === again, rejection: rejection }));
+			client.close();
+			refusing.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	require.Len(t, ts.callRecorder.Recorded(), 1)
+	assert.JSONEq(t, `{
+		"events": ["open object", "data 1", "data 2"],
+		"same": true,
+		"rejection": "unauthenticated"
+	}`, ts.callRecorder.Recorded()[0])
+}
+
+func TestStreamAwaitWrites(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			var sums = [];
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum', { awaitWrites: true });
+			stream.on('data', function(data) { sums.push(data.sum); });
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+
+			var waits = [];
+			for (var i = 1; i <= 3; i++) {
+				var waited = await stream.write({ number: i });
+				waits.push(typeof waited === 'number' && waited >= 0);
+			}
+			stream.end();
+			await ended;
+
+			var plain = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var unawaited = plain.write({ number: 1 });
+			plain.close();
+
+			call(JSON.stringify({ waits: waits, sums: sums, unawaited: typeof unawaited }));
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	require.Len(t, ts.callRecorder.Recorded(), 1)
+	assert.JSONEq(t, `{
+		"waits": [true, true, true],
+		"sums": ["1", "3", "6"],
+		"unawaited": "undefined"
+	}`, ts.callRecorder.Recorded()[0])
+}
+
+func TestStreamListeners(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+	logger, ok := ts.logger.(*logrus.Logger)
+	require.True(t, ok)
+	hook := logtest.NewLocal(logger)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			var calls = { on: 0, once: 0, off: 0 };
+			var onData = function() { calls.on++; };
+			var onceData = function() { calls.once++; };
+			var offData = function() { calls.off++; };
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp');
+			stream.on('data', onData);
+			stream.on('data', onData);
+			stream.once('data', onceData);
+			stream.on('data', offData);
+			stream.off('data', offData);
+			for (var i = 0; i < 10; i++) {
+				stream.on('end', function() {});
+			}
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+			stream.write({ number: 3 });
+			stream.end();
+			await ended;
+
+			call(JSON.stringify(calls));
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	require.Len(t, ts.callRecorder.Recorded(), 1)
+	assert.JSONEq(t, `{"on": 3, "once": 1, "off": 0}`, ts.callRecorder.Recorded()[0])
+
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	assert.Equal(t, []string{"possible listener leak: 11 'end' listeners attached to the stream; " +
+		"detach them with stream.off() or attach them with stream.once()"}, warnings)
+}
+
+func TestStreamAssert(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');
+		var client = new connectrpc.Client();
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			// The request number selects the answered numbers
+			var answers = { 1: [1, 2, 2, 3], 2: [1, 3, 2, 4], 3: [5, 6] };
+			client.connect('mock://', {
+				handlers: {
+					'/k6.connectrpc.ping.v1.PingService/CountUp': function(request) {
+						return answers[request.number].map(function(n) { return { number: n }; });
+					},
+				},
+			});
+
+			function countUp(number, assert) {
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CountUp', { assert: assert });
+				stream.write({ number: number });
+				stream.end();
+				var numbers = [];
+				for (var msg = stream.read(); msg !== null; msg = stream.read()) {
+					numbers.push(msg.number);
+				}
+				return numbers;
+			}
+
+			var assert = { ordered: 'field:number', complete: { count: 3 } };
+			var received = [countUp(1, assert), countUp(2, assert), countUp(3, assert)];
+
+			var errors = [];
+			[
+				{ ordered: 'field:missing' },
+				{ ordered: 'number.value' },
+				{ complete: { count: 0 } },
+				{ sorted: 'number' },
+			].forEach(function(invalid) {
+				try {
+					countUp(1, invalid);
+				} catch (e) {
+					errors.push(e.message);
+				}
+			});
+
+			call(JSON.stringify({ received: received, errors: errors }));
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	require.Len(t, ts.callRecorder.Recorded(), 1)
+	var result struct {
+		Received [][]string
+		Errors   []string
+	}
+	require.NoError(t, json.Unmarshal([]byte(ts.callRecorder.Recorded()[0]), &result))
+	assert.Equal(t, [][]string{{"1", "2", "2", "3"}, {"1", "3", "2", "4"}, {"5", "6"}}, result.Received)
+	require.Len(t, result.Errors, 4)
+	assert.Contains(t, result.Errors[0], "invalid assert: unknown field missing of k6.connectrpc.ping.v1.CountUpResponse")
+	assert.Contains(t, result.Errors[1], "invalid assert: number is not a message")
+	assert.Contains(t, result.Errors[2], "invalid assert: complete count must be a positive integer")
+	assert.Contains(t, result.Errors[3], `invalid assert: unknown assertion "sorted", must be ordered or complete`)
+
+	// 2 after 3, then 2 of the 3 messages expected
+	samples := findSamples(drainSamples(ts.samples), "connectrpc_stream_assertion_violations")
+	require.Len(t, samples, 2)
+	assert.Equal(t, "ordered", samples[0].Tags.Map()["assertion"])
+	assert.Equal(t, "complete", samples[1].Tags.Map()["assertion"])
+	assert.Equal(t, "CountUp", samples[1].Tags.Map()["procedure"])
+}
+
+func TestStreamClosedAtIterationEnd(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+	logger, ok := ts.logger.(*logrus.Logger)
+	require.True(t, ok)
+	hook := logtest.NewLocal(logger)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ts.VU.CtxField = ctx
+
+	// The script forgets to end the stream, which the server keeps open
+	_, err = ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+		stream.write({ number: 1 });
+	`)
+	require.NoError(t, err)
+
+	// Wait for the message to be sent, then k6 cancels the iteration context once it's interrupted
+	var sent []metrics.SampleContainer
+	require.Eventually(t, func() bool {
+		sent = append(sent, drainSamples(ts.samples)...)
+		return len(findSamples(sent, "connectrpc_stream_msgs_sent")) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	require.Eventually(t, func() bool {
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.WarnLevel {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	assert.Equal(t, []string{"closed 1 stream(s) left open at the end of the iteration: " +
+		"/k6.connectrpc.ping.v1.PingService/CumSum (1); call stream.end() or stream.close() once done with a stream"}, warnings)
+}
+
+func TestStreamLogLevel(t *testing.T) {
+	t.Parallel()
+
+	// The server checks the metadata, rejecting the streams without the client header
+	srv := connectrpc.NewTestServer(true)
+	// The subtests are parallel, so they run after this function returns
+	t.Cleanup(srv.Close)
+
+	run := func(t *testing.T, logLevel string) []*logrus.Entry {
+		t.Helper()
+
+		ts := newTestState(t)
+		logger, ok := ts.logger.(*logrus.Logger)
+		require.True(t, ok)
+		logger.SetLevel(logrus.DebugLevel)
+		hook := logtest.NewLocal(logger)
+
+		_, err := ts.Run(`connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');`)
+		require.NoError(t, err)
+
+		ts.ToVUContext()
+
+		_, err = ts.RunOnEventLoop(`
+			(async function() {
+				var client = new connectrpc.Client();
+				client.connect('` + srv.URL + `', { plaintext: true, logLevel: '` + logLevel + `' });
+
+				var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum', {
+					headers: { 'client-header': 'some-value' }
+				});
+				var ended = new Promise(function(resolve) {
+					stream.on('end', resolve);
+					stream.on('error', resolve);
+				});
+
+				stream.write({ number: 1 });
+				stream.end();
+				await ended;
+
+				// The server rejects the stream: the error event is still emitted, only the logs change
+				var failing = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+				var failed = new Promise(function(resolve) {
+					failing.on('end', resolve);
+					failing.on('error', resolve);
+				});
+
+				failing.write({ number: 1 });
+				await failed;
+				client.close();
+			})();
+		`)
+		require.NoError(t, err)
+
+		return hook.AllEntries()
+	}
+
+	t.Run("Debug", func(t *testing.T) {
+		t.Parallel()
+
+		var events []interface{}
+		for _, entry := range run(t, "debug") {
+			if entry.Level == logrus.DebugLevel {
+				events = append(events, entry.Data["event"])
+			}
+		}
+		assert.Subset(t, events, []interface{}{"opened", "first-send", "half-closed", "ended"})
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		// The rejected stream logs its read error, the writes ended by the server log nothing
+		var messages []string
+		for _, entry := range run(t, "error") {
+			messages = append(messages, entry.Message)
+		}
+		assert.Equal(t, []string{"Failed to read from stream"}, messages)
+	})
+
+	t.Run("Off", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Empty(t, run(t, "off"))
+	})
+}
+
+func TestStreamPauseResume(t *testing.T) {
+	t.Parallel()
+
+	srv := connectrpc.NewTestServer(false)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var sums = [];
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('data', function(data) { sums.push(data.sum); });
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+
+			stream.pause();
+			stream.pause();
+			await stream.writeInterval(function(i) { return { number: i + 1 }; }, { rate: 20, duration: '200ms' });
+			call('paused: ' + sums.join(','));
+
+			stream.resume();
+			stream.resume();
+			stream.end();
+			await ended;
+			call('resumed: ' + sums.join(','));
+
+			// Closing a paused stream ends it
+			var paused = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			var closed = new Promise(function(resolve) { paused.on('end', resolve); });
+			paused.pause();
+			await paused.writeInterval({ number: 1 }, { rate: 20, duration: '100ms' });
+			paused.close();
+			await closed;
+			call('closed');
+
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"paused: ", "resumed: 1,3,6,10", "closed"}, ts.callRecorder.Recorded())
+
+	samples := findSamples(drainSamples(ts.samples), "connectrpc_stream_paused_duration")
+	require.Len(t, samples, 2)
+	assert.GreaterOrEqual(t, samples[0].Value, 150.0)
+	assert.Equal(t, "CumSum", samples[0].Tags.Map()["procedure"])
+}
+
+// newChatServer starts a server for testdata/envelope/v1/envelope.proto, which answers each
+// client event with the name of its oneof field and the event in JSON
+func newChatServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	compiler := &protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"testdata/envelope/v1"}},
+	}
+	files, err := compiler.Compile(context.Background(), "envelope.proto")
+	require.NoError(t, err)
+
+	methodDesc := files[0].Services().Get(0).Methods().Get(0)
+	procedure := "/" + string(methodDesc.Parent().FullName()) + "/" + string(methodDesc.Name())
+	event := methodDesc.Input().Oneofs().ByName("event")
+
+	handler := connect.NewBidiStreamHandler(procedure,
+		func(_ context.Context, stream *connect.BidiStream[dynamicpb.Message, dynamicpb.Message]) error {
+			for {
+				msg, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+
+				var kind string
+				if fd := msg.WhichOneof(event); fd != nil {
+					kind = string(fd.Name())
+				}
+				data, err := protojson.Marshal(msg)
+				if err != nil {
+					return err
+				}
+
+				resp := dynamicpb.NewMessage(methodDesc.Output())
+				fields := methodDesc.Output().Fields()
+				resp.Set(fields.ByName("kind"), protoreflect.ValueOfString(kind))
+				resp.Set(fields.ByName("event"), protoreflect.ValueOfString(string(data)))
+				if err := stream.Send(resp); err != nil {
+					return err
+				}
+			}
+		},
+		connect.WithSchema(methodDesc),
+		connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(methodDesc.Input())
+			return nil
+		}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(procedure, handler)
+	return httptest.NewServer(h2c.NewHandler(mux, &http2.Server{}))
+}
+
+func TestStreamWriteOneof(t *testing.T) {
+	t.Parallel()
+
+	srv := newChatServer(t)
+	defer srv.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`connectrpc.loadProtos([], 'testdata/envelope/v1/envelope.proto', 'testdata/ping/v1/ping.proto');`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.RunOnEventLoop(`
+		(async function() {
+			var client = new connectrpc.Client();
+			client.connect('` + srv.URL + `', { plaintext: true });
+
+			var stream = new connectrpc.Stream(client, '/k6.connectrpc.envelope.v1.ChatService/Chat');
+			var ended = new Promise(function(resolve, reject) {
+				stream.on('data', function(data) { call(data.kind + ' ' + data.event); });
+				stream.on('end', resolve);
+				stream.on('error', function(e) { reject(new Error(e.message)); });
+			});
+
+			stream.writeOneof('login', { user: 'alice' });
+			stream.writeOneof('chatMessage', { text: 'hi' });
+			stream.writeOneof('logout', {});
+
+			try {
+				stream.writeOneof('session_id', 'abc');
+			} catch (e) {
+				call(e.message);
+			}
+
+			stream.end();
+			await ended;
+
+			var ping = new connectrpc.Stream(client, '/k6.connectrpc.ping.v1.PingService/CumSum');
+			try {
+				ping.writeOneof('number', 1);
+			} catch (e) {
+				call(e.message);
+			}
+			ping.close();
+
+			client.close();
+		})();
+	`)
+	require.NoError(t, err)
+
+	recorded := ts.callRecorder.Recorded()
+	require.Len(t, recorded, 5)
+	assert.Equal(t, `k6.connectrpc.envelope.v1.ClientEvent has no oneof field "session_id", expected one of: login, chat_message, logout`, recorded[0])
+	assert.JSONEq(t, `{"login":{"user":"alice"}}`, strings.TrimPrefix(recorded[1], "login "))
+	assert.JSONEq(t, `{"chatMessage":{"text":"hi"}}`, strings.TrimPrefix(recorded[2], "chat_message "))
+	assert.JSONEq(t, `{"logout":{}}`, strings.TrimPrefix(recorded[3], "logout "))
+	assert.Equal(t, "k6.connectrpc.ping.v1.CumSumRequest has no oneof field", recorded[4])
+}
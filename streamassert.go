@@ -0,0 +1,194 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/js/common"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Assertions of connectrpc_stream_assertion_violations
+const (
+	assertionOrdered  = "ordered"
+	assertionComplete = "complete"
+)
+
+// streamAssertions are the contract checks of the `assert` call parameter
+type streamAssertions struct {
+	Ordered  string // Path of the field ordering the received messages, empty for none
+	Complete int64  // Count of messages expected before the end of the stream, 0 for none
+}
+
+// parseStreamAssertions parses `{ ordered: 'field:number', complete: { count: 5 } }`.
+// The field of ordered may be given without the 'field:' prefix.
+func parseStreamAssertions(v sobek.Value) (*streamAssertions, error) {
+	if common.IsNullish(v) {
+		return nil, nil
+	}
+	obj, ok := v.(*sobek.Object)
+	if !ok {
+		return nil, errors.New("must be an object like { ordered, complete }")
+	}
+
+	assertions := &streamAssertions{}
+	for _, k := range obj.Keys() {
+		switch k {
+		case assertionOrdered:
+			field, ok := obj.Get(k).Export().(string)
+			field = strings.TrimPrefix(field, "field:")
+			if !ok || field == "" {
+				return nil, errors.New("ordered must be a field like 'field:number'")
+			}
+			assertions.Ordered = field
+		case assertionComplete:
+			complete, ok := obj.Get(k).(*sobek.Object)
+			if !ok {
+				return nil, errors.New("complete must be an object like { count: 5 }")
+			}
+			count, ok := complete.Get("count").Export().(int64)
+			if !ok || count <= 0 {
+				return nil, errors.New("complete count must be a positive integer")
+			}
+			assertions.Complete = count
+		default:
+			return nil, fmt.Errorf("unknown assertion %q, must be ordered or complete", k)
+		}
+	}
+	return assertions, nil
+}
+
+// streamAssert checks the messages received by a stream against its assertions. It is
+// only used by the read loop.
+type streamAssert struct {
+	ordered  []protoreflect.FieldDescriptor // Fields from the message to the ordering field
+	path     string
+	previous protoreflect.Value
+	complete int64
+	received int64
+}
+
+// newStreamAssert resolves the assertions against the received messages, or returns nil
+// without assertions
+func newStreamAssert(a *streamAssertions, desc protoreflect.MessageDescriptor) (*streamAssert, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	sa := &streamAssert{path: a.Ordered, complete: a.Complete}
+	if a.Ordered == "" {
+		return sa, nil
+	}
+
+	names := strings.Split(a.Ordered, ".")
+	for i, name := range names {
+		fd := desc.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = desc.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("invalid assert: unknown field %s of %s", name, desc.FullName())
+		}
+		if fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("invalid assert: ordered field %s is repeated", a.Ordered)
+		}
+		sa.ordered = append(sa.ordered, fd)
+
+		if i < len(names)-1 {
+			if desc = fd.Message(); desc == nil {
+				return nil, fmt.Errorf("invalid assert: %s is not a message", strings.Join(names[:i+1], "."))
+			}
+		}
+	}
+
+	switch sa.ordered[len(sa.ordered)-1].Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind, protoreflect.BytesKind, protoreflect.BoolKind:
+		return nil, fmt.Errorf("invalid assert: ordered field %s must be a number or a string", a.Ordered)
+	}
+	return sa, nil
+}
+
+// check checks the received message, returning the details of its violation if any
+func (sa *streamAssert) check(msg protoreflect.Message) string {
+	sa.received++
+	if sa.ordered == nil {
+		return ""
+	}
+
+	for _, fd := range sa.ordered[:len(sa.ordered)-1] {
+		msg = msg.Get(fd).Message()
+	}
+	fd := sa.ordered[len(sa.ordered)-1]
+	value := msg.Get(fd)
+
+	previous := sa.previous
+	sa.previous = value
+	if sa.received == 1 || compareOrdered(fd.Kind(), previous, value) <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("message %d has %s %v after %v", sa.received, sa.path, value, previous)
+}
+
+// checkComplete checks the count of messages received at the end of the stream, returning
+// the details of its violation if any
+func (sa *streamAssert) checkComplete() string {
+	if sa.received >= sa.complete {
+		return ""
+	}
+	return fmt.Sprintf("received %d messages of the %d expected", sa.received, sa.complete)
+}
+
+// compareOrdered compares two values of an ordering field
+func compareOrdered(kind protoreflect.Kind, a, b protoreflect.Value) int {
+	var less, greater bool
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		less, greater = a.Int() < b.Int(), a.Int() > b.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		less, greater = a.Uint() < b.Uint(), a.Uint() > b.Uint()
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		less, greater = a.Float() < b.Float(), a.Float() > b.Float()
+	case protoreflect.EnumKind:
+		less, greater = a.Enum() < b.Enum(), a.Enum() > b.Enum()
+	case protoreflect.StringKind:
+		less, greater = a.String() < b.String(), a.String() > b.String()
+	}
+
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// checkReceived checks the message received in s.recvMsg against the stream assertions
+func (s *stream) checkReceived() {
+	if detail := s.assert.check(s.recvMsg); detail != "" {
+		s.reportViolation(assertionOrdered, detail)
+	}
+}
+
+// checkComplete checks the count of received messages once the server ended the stream
+func (s *stream) checkComplete() {
+	if s.assert == nil {
+		return
+	}
+	if detail := s.assert.checkComplete(); detail != "" {
+		s.reportViolation(assertionComplete, detail)
+	}
+}
+
+// reportViolation logs a stream assertion violation and records it as a metric
+func (s *stream) reportViolation(assertion, detail string) {
+	s.log(logrus.WarnLevel, logrus.Fields{"assertion": assertion}, "Stream assertion violated: "+detail)
+
+	if s.instanceMetrics != nil {
+		s.instanceMetrics.recordAssertionViolation(s.vu.Context(), s.vu, s.metricTags, assertion)
+	}
+}
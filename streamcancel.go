@@ -0,0 +1,198 @@
+package connectrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/js/common"
+)
+
+// maxTakeBuffered is how many of the first messages of a stream are kept for take(), so
+// that it returns the messages received before it was called too
+const maxTakeBuffered = 100
+
+// errTakeSink throws take() on a stream draining its messages in a sink
+var errTakeSink = errors.New("cannot take from a stream with a sink, its messages aren't kept")
+
+// takeBuffer keeps the first messages received by a stream for take()
+type takeBuffer struct {
+	mu       sync.Mutex
+	messages [][]byte
+	limit    int64 // Messages kept, at least maxTakeBuffered, raised by take()
+	missed   bool  // Whether messages past the limit were received
+}
+
+// cancelAfter cancels the stream once it received count messages, like close() with an
+// HTTP/2 RST_STREAM, as the clients of paginated streams abandon them. The messages after
+// the count are not emitted, and the stream ends with an 'end' event.
+func (s *stream) cancelAfter(countVal sobek.Value) {
+	count, err := parseCancelCount(countVal)
+	if err != nil {
+		common.Throw(s.vu.Runtime(), fmt.Errorf("invalid cancelAfter count: %w", err))
+	}
+
+	s.cancelCount.Store(count)
+	if s.received.Load() >= count {
+		s.cancelEarly()
+	}
+}
+
+// take returns a promise resolved with the first count messages of the stream, the ones
+// received before the call included, once the stream was canceled after them like with
+// cancelAfter(), or with fewer messages if the server ended the stream before. It is
+// rejected with the error of the stream.
+func (s *stream) take(countVal sobek.Value) *sobek.Promise {
+	rt := s.vu.Runtime()
+	count, err := parseCancelCount(countVal)
+	if err != nil {
+		common.Throw(rt, fmt.Errorf("invalid take count: %w", err))
+	}
+	if s.sink != nil {
+		common.Throw(rt, errTakeSink)
+	}
+	if err := s.taken.reserve(count); err != nil {
+		common.Throw(rt, err)
+	}
+
+	promise, resolve, reject := rt.NewPromise()
+	if s.readEnded() {
+		s.errMu.Lock()
+		firstErr := s.firstErr
+		s.errMu.Unlock()
+		if firstErr != nil {
+			_ = reject(s.errorValue(rt, firstErr))
+		} else {
+			_ = resolve(s.takenMessages(rt, count))
+		}
+		return promise
+	}
+
+	var onEnd, onError sobek.Value
+	detach := func() {
+		s.eventListeners.remove("end", onEnd)
+		s.eventListeners.remove("error", onError)
+	}
+	onEnd = rt.ToValue(func() {
+		detach()
+		_ = resolve(s.takenMessages(rt, count))
+	})
+	onError = rt.ToValue(func(errValue sobek.Value) {
+		detach()
+		_ = reject(errValue)
+	})
+	s.addListener("end", onEnd, false)
+	s.addListener("error", onError, false)
+
+	s.cancelAfter(countVal)
+	return promise
+}
+
+// reserve keeps the first count messages, failing if some of them weren't kept
+func (b *takeBuffer) reserve(count int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.missed && int64(len(b.messages)) < count {
+		return fmt.Errorf("cannot take %d messages from a stream that received more than %d, call take() earlier",
+			count, len(b.messages))
+	}
+	b.limit = max(b.limit, count)
+	return nil
+}
+
+// keepReceived keeps the index-th message received by the read loop for take(), if it's
+// one of the first messages
+func (s *stream) keepReceived(index int64, data []byte) {
+	b := &s.taken
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if index > max(b.limit, maxTakeBuffered) {
+		b.missed = true
+		return
+	}
+	if s.binary {
+		// The data becomes an ArrayBuffer the script may modify
+		data = bytes.Clone(data)
+	}
+	b.messages = append(b.messages, data)
+}
+
+// takenMessages returns the values of the first count messages received
+func (s *stream) takenMessages(rt *sobek.Runtime, count int64) []interface{} {
+	s.taken.mu.Lock()
+	kept := s.taken.messages[:min(count, int64(len(s.taken.messages)))]
+	s.taken.mu.Unlock()
+
+	messages := make([]interface{}, 0, len(kept))
+	for _, data := range kept {
+		messages = append(messages, s.messageValue(rt, data))
+	}
+	return messages
+}
+
+// readEnded returns whether the stream received its last message, its end or error
+// being emitted already
+func (s *stream) readEnded() bool {
+	done := s.readLoopDone
+	if !s.readLoopStarted.Load() {
+		done = s.done
+	}
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseCancelCount parses the count of messages of cancelAfter() and take()
+func parseCancelCount(v sobek.Value) (int64, error) {
+	if common.IsNullish(v) {
+		return 0, errors.New("must be a positive integer")
+	}
+	count, ok := v.Export().(int64)
+	if !ok || count < 1 {
+		return 0, fmt.Errorf("must be a positive integer, got %s", v)
+	}
+	return count, nil
+}
+
+// admitReceived counts a message received by the read loop, returning its index from 1.
+// The messages after the count of cancelAfter() are not admitted, as the stream is being
+// canceled: they are dropped, without being emitted or recorded.
+func (s *stream) admitReceived() (int64, bool) {
+	index := s.received.Add(1)
+	count := s.cancelCount.Load()
+	return index, count == 0 || index <= count
+}
+
+// countReceived cancels the stream once it received the messages of cancelAfter()
+func (s *stream) countReceived(index int64) {
+	if count := s.cancelCount.Load(); count > 0 && index >= count {
+		s.cancelEarly()
+	}
+}
+
+// cancelEarly cancels the stream after the messages of cancelAfter(), once
+func (s *stream) cancelEarly() {
+	if !s.canceledAt.CompareAndSwap(0, time.Now().UnixNano()) {
+		return
+	}
+	s.log(logrus.DebugLevel, logrus.Fields{"event": "canceled", "received": s.received.Load()}, "Stream canceled after its messages")
+	s.close()
+}
+
+// recordCancel records how long an early canceled stream took to end, once released
+func (s *stream) recordCancel() {
+	at := s.canceledAt.Load()
+	if at == 0 || s.instanceMetrics == nil {
+		return
+	}
+	s.instanceMetrics.recordStreamCancel(s.vu.Context(), s.vu, s.metricTags, time.Since(time.Unix(0, at)))
+}
@@ -0,0 +1,130 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib/types"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// appKeepalive is the `appKeepalive` stream parameter, like
+// `{ message: { ping: true }, interval: '30s' }`: a heartbeat message written whenever the
+// stream wrote nothing for the interval, for the servers and proxies dropping silent streams
+type appKeepalive struct {
+	message       []byte // Heartbeat message, in JSON
+	interval      time.Duration
+	recordMetrics bool // Whether the heartbeats count in the message metrics, tagged heartbeat=true
+}
+
+// parseAppKeepalive parses the `appKeepalive` stream parameter
+func parseAppKeepalive(rt *sobek.Runtime, v sobek.Value) (*appKeepalive, error) {
+	if common.IsNullish(v) {
+		return nil, nil
+	}
+	obj, ok := v.(*sobek.Object)
+	if !ok {
+		return nil, errors.New("must be an object like { message, interval }")
+	}
+
+	keepalive := &appKeepalive{}
+	for _, k := range obj.Keys() {
+		value := obj.Get(k)
+		switch k {
+		case "message":
+			if _, ok := value.(*sobek.Object); !ok {
+				return nil, errors.New("message must be a message object")
+			}
+			message, err := value.ToObject(rt).MarshalJSON()
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal message: %w", err)
+			}
+			keepalive.message = message
+		case "interval":
+			interval, err := types.GetDurationValue(value.Export())
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("interval must be a positive duration like '30s', got %s", value)
+			}
+			keepalive.interval = interval
+		case "recordMetrics":
+			keepalive.recordMetrics = value.ToBoolean()
+		default:
+			return nil, fmt.Errorf("unknown key %q, must be message, interval or recordMetrics", k)
+		}
+	}
+	if keepalive.message == nil || keepalive.interval == 0 {
+		return nil, errors.New("a message and an interval are required")
+	}
+	return keepalive, nil
+}
+
+// streamKeepalive is the heartbeat of a stream, see appKeepalive
+type streamKeepalive struct {
+	interval time.Duration
+	message  *dynamicpb.Message
+	size     int64       // Size of the heartbeat in the message metrics, the one of its JSON
+	tags     *MetricTags // Tags of the heartbeats in the message metrics, nil to leave them out
+}
+
+// newKeepalive creates the heartbeat of the stream, checking its message against the
+// request type. It requires the metric tags of the stream.
+func (s *stream) newKeepalive(k *appKeepalive) (*streamKeepalive, error) {
+	if k == nil {
+		return nil, nil
+	}
+
+	message := dynamicpb.NewMessage(s.methodDescriptor.Input())
+	if err := s.unmarshaler.unmarshal(k.message, message); err != nil {
+		return nil, fmt.Errorf("invalid appKeepalive message: %w", err)
+	}
+	keepalive := &streamKeepalive{interval: k.interval, message: message, size: int64(len(k.message))}
+
+	if k.recordMetrics {
+		tags := s.metricTags.withCustomTag("heartbeat", "true")
+		keepalive.tags = &tags
+	}
+	return keepalive, nil
+}
+
+// keepaliveTimer returns the timer of the heartbeats, and its channel, nil without appKeepalive
+func (s *stream) keepaliveTimer() (*time.Timer, <-chan time.Time) {
+	if s.keepalive == nil {
+		return nil, nil
+	}
+	timer := time.NewTimer(s.keepalive.interval)
+	return timer, timer.C
+}
+
+// idleFor restarts the heartbeat timer once the stream wrote a message
+func (s *stream) idleFor(timer *time.Timer) {
+	if timer != nil {
+		timer.Reset(s.keepalive.interval)
+	}
+}
+
+// writeHeartbeat writes the heartbeat of an idle stream. The heartbeats keep an open stream
+// alive, so that a stream is only opened by the writes of the script or ready().
+func (s *stream) writeHeartbeat() {
+	if !s.readLoopStarted.Load() {
+		return
+	}
+	s.log(logrus.DebugLevel, logrus.Fields{"event": "heartbeat"}, "Stream heartbeat written")
+	s.processMessage(message{heartbeat: true})
+}
+
+// setHeartbeat sets the heartbeat as the message to send
+func (s *stream) setHeartbeat() {
+	proto.Merge(s.sendMsg, s.keepalive.message)
+}
+
+// recordHeartbeat records a heartbeat written, with recordMetrics: true
+func (s *stream) recordHeartbeat() {
+	if s.keepalive.tags != nil {
+		s.instanceMetrics.recordStreamMessage(s.vu.Context(), s.vu, *s.keepalive.tags, "sent", s.keepalive.size)
+	}
+}
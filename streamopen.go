@@ -0,0 +1,119 @@
+package connectrpc
+
+import (
+	"errors"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/sobek"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// errClosedBeforeOpen rejects the ready() promises of a stream closed before the server responded
+var errClosedBeforeOpen = errors.New("stream closed before the server accepted it")
+
+// readyPromise is a pending promise of ready()
+type readyPromise struct {
+	resolve func(interface{}) error
+	reject  func(interface{}) error
+}
+
+// ready returns a promise resolved with the 'open' event once the server accepted the
+// stream, or rejected with the error of the stream. The request headers are sent right
+// away, without waiting for the first write.
+func (s *stream) ready() *sobek.Promise {
+	rt := s.vu.Runtime()
+	promise, resolve, reject := rt.NewPromise()
+
+	switch {
+	case s.opened != nil:
+		_ = resolve(s.opened)
+	case s.openErr != nil:
+		_ = reject(s.openErr)
+	default:
+		s.readyPromises = append(s.readyPromises, readyPromise{resolve: resolve, reject: reject})
+		s.sendHeaders()
+	}
+	return promise
+}
+
+// sendHeaders has writeLoop send the request headers, if no message was written yet
+func (s *stream) sendHeaders() {
+	if s.headersQueued || s.writingState == closed {
+		return
+	}
+	s.headersQueued = true
+
+	select {
+	case s.writeQueueCh <- message{isOpening: true}:
+	case <-s.done:
+	}
+}
+
+// watchOpen emits the 'open' event once the server responds with the headers of an
+// accepted gRPC or gRPC-Web stream, which connect-go returns as soon as they arrive. A
+// refused stream has its status in these headers, while the Connect protocol ends even
+// a refused stream with its error, so its streams open with their first message instead.
+func (s *stream) watchOpen(connectStream *connect.BidiStreamForClient[dynamicpb.Message, dynamicpb.Message]) {
+	if s.metricTags.Protocol == "connect" {
+		return
+	}
+
+	headers := connectStream.ResponseHeader()
+	if !s.peer.accepted() {
+		return // The read loop emits the error of the response
+	}
+	s.emitOpen(headers)
+}
+
+// emitOpen emits an 'open' event with the response headers, and resolves the ready()
+// promises. watchOpen, the first message and the end of the stream all emit it, but it is
+// only emitted once.
+func (s *stream) emitOpen(headers http.Header) {
+	plain := map[string][]string(headers.Clone())
+
+	s.tq.Queue(func() error {
+		rt := s.vu.Runtime()
+		if rt == nil || s.opened != nil || s.openErr != nil {
+			return nil
+		}
+
+		openObj := rt.NewObject()
+		must(rt, openObj.Set("headers", newHeadersObject(rt, plain, s.flatHeaders)))
+		s.opened = openObj
+
+		s.eventListeners.emit("open", openObj)
+		for _, p := range s.readyPromises {
+			_ = p.resolve(openObj)
+		}
+		s.readyPromises = nil
+		return nil
+	})
+}
+
+// rejectReady rejects the ready() promises with the error of a stream that failed before
+// it opened. It runs on the event loop.
+func (s *stream) rejectReady(errValue sobek.Value) {
+	if s.opened != nil || s.openErr != nil {
+		return
+	}
+
+	s.openErr = errValue
+	for _, p := range s.readyPromises {
+		_ = p.reject(errValue)
+	}
+	s.readyPromises = nil
+}
+
+// accepted returns whether the server accepted the RPC: the response has neither an error
+// HTTP status nor the status of a gRPC trailers-only response
+func (p *peerInfo) accepted() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resp == nil || p.resp.StatusCode != http.StatusOK {
+		return false
+	}
+	status := p.resp.Header.Get("Grpc-Status")
+	return status == "" || status == "0"
+}
@@ -0,0 +1,280 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/sobek"
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib/types"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	defaultRefreshInterval      = time.Minute
+	defaultReconnectMaxAttempts = 3
+	defaultReconnectDelay       = time.Second
+)
+
+// reconnectOptions is the `reconnect` stream parameter, true or like
+// `{ maxAttempts: 5, delay: '2s' }`: a server stream failing with an error is established
+// again, with the same request, instead of emitting the error
+type reconnectOptions struct {
+	maxAttempts int           // Consecutive failed attempts before the error is emitted
+	delay       time.Duration // Wait before each attempt
+}
+
+// parseReconnect parses the `reconnect` stream parameter, nil for false
+func parseReconnect(v sobek.Value) (*reconnectOptions, error) {
+	if common.IsNullish(v) {
+		return nil, nil
+	}
+	options := &reconnectOptions{maxAttempts: defaultReconnectMaxAttempts, delay: defaultReconnectDelay}
+	switch value := v.Export().(type) {
+	case bool:
+		if !value {
+			return nil, nil
+		}
+		return options, nil
+	case map[string]interface{}:
+		for k, value := range value {
+			switch k {
+			case "maxAttempts":
+				n, ok := value.(int64)
+				if !ok || n <= 0 {
+					return nil, fmt.Errorf("maxAttempts must be a positive integer, got %v", value)
+				}
+				options.maxAttempts = int(n)
+			case "delay":
+				d, err := types.GetDurationValue(value)
+				if err != nil || d < 0 {
+					return nil, fmt.Errorf("delay must be a duration like '1s', got %v", value)
+				}
+				options.delay = d
+			default:
+				return nil, fmt.Errorf("unknown key %q, must be maxAttempts or delay", k)
+			}
+		}
+		return options, nil
+	default:
+		return nil, errors.New("must be true or an object like { maxAttempts, delay }")
+	}
+}
+
+// parseRefreshInterval parses the `refreshInterval` stream parameter
+func parseRefreshInterval(v sobek.Value) (time.Duration, error) {
+	interval, err := types.GetDurationValue(v.Export())
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("must be a positive duration like '1m', got %s", v)
+	}
+	return interval, nil
+}
+
+// streamReconnect re-establishes a failed server stream, with the `reconnect` stream
+// parameter, and keeps the headers of `refreshHeaderFn` for its next establishment, so
+// that a long stream outlives the tokens it was opened with
+type streamReconnect struct {
+	maxAttempts int // 0 without reconnect, only refreshing the headers
+	delay       time.Duration
+	attempts    int // Consecutive failed attempts, reset by a received message. Only readLoop uses it.
+
+	client        *connect.Client[dynamicpb.Message, dynamicpb.Message]
+	connectParams *connectParams    // Connection of the stream, which connect() may replace on the client
+	metadata      map[string]string // Headers of the stream parameters
+
+	refreshFn       sobek.Callable
+	refreshInterval time.Duration
+	headers         atomic.Pointer[map[string]string] // Last headers of refreshFn, nil for none
+
+	// The request to send again, guarded by the connMu of the stream
+	request       *dynamicpb.Message
+	requestClosed bool
+}
+
+// newReconnect creates the reconnection of the stream, calling refreshHeaderFn for its
+// first headers, nil with neither reconnect nor refreshHeaderFn
+func (s *stream) newReconnect(p *callParams) (*streamReconnect, error) {
+	if p.Reconnect == nil && p.RefreshHeaderFn == nil {
+		if p.RefreshInterval != 0 {
+			return nil, errors.New("refreshInterval requires a refreshHeaderFn")
+		}
+		return nil, nil
+	}
+	if p.Reconnect != nil && (!s.methodDescriptor.IsStreamingServer() || s.methodDescriptor.IsStreamingClient()) {
+		return nil, fmt.Errorf("reconnect is for server streaming methods, %s isn't one", s.methodDescriptor.FullName())
+	}
+
+	r := &streamReconnect{
+		connectParams:   s.client.connectParams,
+		metadata:        p.Metadata,
+		refreshFn:       p.RefreshHeaderFn,
+		refreshInterval: p.RefreshInterval,
+	}
+	if r.refreshInterval == 0 {
+		r.refreshInterval = defaultRefreshInterval
+	}
+	if p.Reconnect != nil {
+		r.maxAttempts, r.delay = p.Reconnect.maxAttempts, p.Reconnect.delay
+	}
+
+	if r.refreshFn != nil {
+		headers, err := r.refresh(s.vu.Runtime())
+		if err != nil {
+			return nil, err
+		}
+		r.headers.Store(&headers)
+	}
+	return r, nil
+}
+
+// refresh calls refreshHeaderFn, which returns an object of headers like
+// `{ Authorization: 'Bearer ' + token }`
+func (r *streamReconnect) refresh(rt *sobek.Runtime) (map[string]string, error) {
+	v, err := r.refreshFn(sobek.Undefined())
+	if err != nil {
+		return nil, fmt.Errorf("refreshHeaderFn failed: %w", err)
+	}
+	headers := make(map[string]string)
+	if common.IsNullish(v) {
+		return headers, nil
+	}
+	if err := processMetadata(v, headers, rt); err != nil {
+		return nil, fmt.Errorf("invalid refreshHeaderFn headers: %w", err)
+	}
+	return headers, nil
+}
+
+// setHeaders sets the headers of the stream parameters and the last refreshed ones
+func (r *streamReconnect) setHeaders(s *stream) {
+	header := s.connectStream.RequestHeader()
+	for key, value := range r.metadata {
+		header.Set(key, value)
+	}
+	if headers := r.headers.Load(); headers != nil {
+		for key, value := range *headers {
+			header.Set(key, value)
+		}
+	}
+}
+
+// refreshHeaders calls refreshHeaderFn on the event loop every refreshInterval while the
+// stream is read. A failing call is logged, keeping the previous headers.
+func (s *stream) refreshHeaders() {
+	ticker := time.NewTicker(s.reconnect.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tq.Queue(func() error {
+				rt := s.vu.Runtime()
+				if rt == nil {
+					return nil
+				}
+				headers, err := s.reconnect.refresh(rt)
+				if err != nil {
+					s.log(logrus.WarnLevel, logrus.Fields{logrus.ErrorKey: err}, "Failed to refresh the stream headers")
+					return nil
+				}
+				s.reconnect.headers.Store(&headers)
+				return nil
+			})
+		case <-s.readLoopDone:
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// send sends a message, nil for the headers alone, keeping the first one to send it again
+// once reconnected
+func (s *stream) send(msg *dynamicpb.Message) error {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	err := s.connectStream.Send(msg)
+	if err == nil && msg != nil && s.reconnect != nil && s.reconnect.request == nil {
+		s.reconnect.request = proto.Clone(msg).(*dynamicpb.Message)
+	}
+	return err
+}
+
+// closeRequest closes the client side of the current connect stream
+func (s *stream) closeRequest() {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	_ = s.connectStream.CloseRequest()
+	if s.reconnect != nil {
+		s.reconnect.requestClosed = true
+	}
+}
+
+// closeResponse closes the response of the current connect stream
+func (s *stream) closeResponse() {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	_ = s.connectStream.CloseResponse()
+}
+
+// reconnectStream establishes a failed stream again, unless it is out of attempts or
+// ended. It waits the reconnect delay, sends the request again with the current headers,
+// and emits a 'reconnect' event with the attempt and the code and message of the failure.
+// Only readLoop calls it, which thus reads the connect stream without connMu.
+func (s *stream) reconnectStream(err error) bool {
+	r := s.reconnect
+	if r == nil || r.attempts >= r.maxAttempts || s.explicitlyClosed.Load() || s.ctx.Err() != nil {
+		return false
+	}
+	r.attempts++
+	attempt := r.attempts
+
+	if r.delay > 0 {
+		timer := time.NewTimer(r.delay)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+
+	s.log(logrus.InfoLevel, logrus.Fields{"event": "reconnect", "attempt": attempt, logrus.ErrorKey: err},
+		"Stream failed, reconnecting")
+
+	s.connMu.Lock()
+	_ = s.connectStream.CloseResponse()
+	s.connectStream = r.client.CallBidiStream(s.ctx)
+	if r.connectParams != nil {
+		r.connectParams.setHeaders(s.connectStream.RequestHeader())
+	}
+	s.client.defaultHeaders.Load().apply(s.connectStream.RequestHeader())
+	r.setHeaders(s)
+	var sendErr error
+	if r.request != nil {
+		sendErr = s.connectStream.Send(r.request)
+	}
+	if sendErr == nil && r.requestClosed {
+		sendErr = s.connectStream.CloseRequest()
+	}
+	s.connMu.Unlock()
+	if sendErr != nil {
+		s.log(logrus.DebugLevel, logrus.Fields{logrus.ErrorKey: sendErr}, "Failed to send the request again")
+	}
+
+	event := map[string]interface{}{"attempt": attempt, "code": connect.CodeOf(err).String(), "message": err.Error()}
+	s.tq.Queue(func() error {
+		if rt := s.vu.Runtime(); rt != nil {
+			s.eventListeners.emit("reconnect", rt.ToValue(event))
+		}
+		return nil
+	})
+	return true
+}
@@ -0,0 +1,215 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// summaryCalls are the metrics of the rows of the per-method summary, for each call type.
+// Streams count one request per stream and use the stream duration.
+var summaryCalls = []struct {
+	callType, reqs, errors, duration string
+}{
+	{"unary", "connectrpc_reqs", "connectrpc_req_errors", "connectrpc_req_duration"},
+	{"stream", "connectrpc_streams", "connectrpc_stream_errors", "connectrpc_stream_duration"},
+}
+
+// summarySizeMetrics are the payload size metrics of the per-method summary
+var summarySizeMetrics = []string{"connectrpc_req_size", "connectrpc_resp_size"}
+
+// methodSummary is the exported summary of a single method
+type methodSummary struct {
+	Method       string  `json:"method"`
+	Type         string  `json:"type"`
+	Reqs         int64   `json:"reqs"`
+	Rate         float64 `json:"rate,omitempty"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"errorRate"`
+	P95          float64 `json:"p95"` // milliseconds
+	AvgReqBytes  float64 `json:"avgReqBytes"`
+	AvgRespBytes float64 `json:"avgRespBytes"`
+}
+
+// methodSubmetric parses the name of a submetric on the method tag alone, like
+// connectrpc_reqs{method:/pkg.Service/Method}
+func methodSubmetric(name string) (metric, method string, ok bool) {
+	metric, tags, found := strings.Cut(name, "{")
+	if !found || !strings.HasSuffix(tags, "}") {
+		return "", "", false
+	}
+	key, value, found := strings.Cut(strings.TrimSuffix(tags, "}"), ":")
+	if !found || strings.Contains(value, ",") || strings.Trim(strings.TrimSpace(key), `"'`) != "method" {
+		return "", "", false
+	}
+	return metric, strings.Trim(strings.TrimSpace(value), `"'`), true
+}
+
+// summarySubmetrics returns the values of the method submetrics of the handleSummary data,
+// by metric and method. The data holds the submetrics the thresholds are defined on.
+func summarySubmetrics(data sobek.Value) map[string]map[string]map[string]interface{} {
+	submetrics := make(map[string]map[string]map[string]interface{})
+	if data == nil || sobek.IsUndefined(data) || sobek.IsNull(data) {
+		return submetrics
+	}
+
+	exported, ok := data.Export().(map[string]interface{})
+	if !ok {
+		return submetrics
+	}
+	metrics, ok := exported["metrics"].(map[string]interface{})
+	if !ok {
+		return submetrics
+	}
+
+	for name, m := range metrics {
+		metric, method, ok := methodSubmetric(name)
+		if !ok {
+			continue
+		}
+		m, _ := m.(map[string]interface{})
+		values, ok := m["values"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if submetrics[metric] == nil {
+			submetrics[metric] = make(map[string]map[string]interface{})
+		}
+		submetrics[metric][method] = values
+	}
+	return submetrics
+}
+
+// summaryValue returns a value of a submetric, 0 when missing
+func summaryValue(values map[string]interface{}, stat string) float64 {
+	switch v := values[stat].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
+
+// summarize returns the summaries of the methods of the handleSummary data sorted by method
+func summarize(data sobek.Value, prefix string) []methodSummary {
+	submetrics := summarySubmetrics(data)
+
+	var summaries []methodSummary
+	for _, call := range summaryCalls {
+		for method, reqs := range submetrics[prefix+call.reqs] {
+			count := int64(summaryValue(reqs, "count"))
+			if count == 0 {
+				continue
+			}
+
+			failed := int64(summaryValue(submetrics[prefix+call.errors][method], "count"))
+			summaries = append(summaries, methodSummary{
+				Method:       method,
+				Type:         call.callType,
+				Reqs:         count,
+				Rate:         summaryValue(reqs, "rate"),
+				Errors:       failed,
+				ErrorRate:    float64(failed) / float64(count),
+				P95:          summaryValue(submetrics[prefix+call.duration][method], "p(95)"),
+				AvgReqBytes:  summaryValue(submetrics[prefix+summarySizeMetrics[0]][method], "avg"),
+				AvgRespBytes: summaryValue(submetrics[prefix+summarySizeMetrics[1]][method], "avg"),
+			})
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Method < summaries[j].Method
+	})
+	return summaries
+}
+
+// summaryThresholds returns empty thresholds on the method submetrics of the summary, so
+// that k6 computes them and the handleSummary data holds them, for the given methods or
+// all the loaded ones
+func (mi *ModuleInstance) summaryThresholds(methods ...string) (map[string]interface{}, error) {
+	descs := globalProtoRegistry.allMethodDescriptors()
+	if len(methods) > 0 {
+		descs = make(map[string]protoreflect.MethodDescriptor, len(methods))
+		for _, method := range methods {
+			method = dynamic.MethodPath(method)
+			desc, err := globalProtoRegistry.getMethodDescriptor(method)
+			if err != nil {
+				return nil, err
+			}
+			descs[method] = desc
+		}
+	}
+
+	thresholds := make(map[string]interface{})
+	for method, desc := range descs {
+		call := summaryCalls[0]
+		if desc.IsStreamingClient() || desc.IsStreamingServer() {
+			call = summaryCalls[1]
+		}
+		for _, name := range append([]string{call.reqs, call.errors, call.duration}, summarySizeMetrics...) {
+			thresholds[fmt.Sprintf("%s%s{method:%s}", mi.defaults.metricPrefix, name, method)] = []interface{}{}
+		}
+	}
+	return thresholds, nil
+}
+
+// textSummary renders a per-method table for use in handleSummary
+func (mi *ModuleInstance) textSummary(data sobek.Value) string {
+	return renderTextSummary(summarize(data, mi.defaults.metricPrefix))
+}
+
+// jsonSummary renders the per-method statistics as JSON for use in handleSummary
+func (mi *ModuleInstance) jsonSummary(data sobek.Value) (string, error) {
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"methods": summarize(data, mi.defaults.metricPrefix),
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ConnectRPC summary: %w", err)
+	}
+	return string(b), nil
+}
+
+func renderTextSummary(summaries []methodSummary) string {
+	var sb strings.Builder
+	sb.WriteString("\n     ConnectRPC per-method summary\n\n")
+
+	if len(summaries) == 0 {
+		sb.WriteString("     no ConnectRPC calls recorded, see summaryThresholds()\n")
+		return sb.String()
+	}
+
+	w := tabwriter.NewWriter(&sb, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "     METHOD\tTYPE\tREQS\tRATE\tERRORS\tP95\tAVG REQ\tAVG RESP")
+	for _, s := range summaries {
+		rate := "-"
+		if s.Rate > 0 {
+			rate = fmt.Sprintf("%.2f/s", s.Rate)
+		}
+		fmt.Fprintf(w, "     %s\t%s\t%d\t%s\t%.2f%%\t%.2fms\t%s\t%s\n",
+			s.Method, s.Type, s.Reqs, rate, s.ErrorRate*100, s.P95,
+			formatBytes(s.AvgReqBytes), formatBytes(s.AvgRespBytes))
+	}
+	_ = w.Flush()
+
+	return sb.String()
+}
+
+// formatBytes formats a byte size like the k6 summary does
+func formatBytes(b float64) string {
+	switch {
+	case b >= 1000*1000:
+		return fmt.Sprintf("%.1f MB", b/(1000*1000))
+	case b >= 1000:
+		return fmt.Sprintf("%.1f kB", b/1000)
+	default:
+		return fmt.Sprintf("%.0f B", b)
+	}
+}
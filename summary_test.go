@@ -0,0 +1,85 @@
+package connectrpc
+
+import (
+	"testing"
+
+	"github.com/grafana/sobek"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodSubmetric(t *testing.T) {
+	t.Parallel()
+
+	metric, method, ok := methodSubmetric("connectrpc_reqs{method:/pkg.Service/Unary}")
+	require.True(t, ok)
+	assert.Equal(t, "connectrpc_reqs", metric)
+	assert.Equal(t, "/pkg.Service/Unary", method)
+
+	_, method, ok = methodSubmetric(`connectrpc_reqs{ method: "/pkg.Service/Unary" }`)
+	require.True(t, ok)
+	assert.Equal(t, "/pkg.Service/Unary", method)
+
+	for _, name := range []string{
+		"connectrpc_reqs",
+		"connectrpc_reqs{status:error}",
+		"connectrpc_reqs{method:/pkg.Service/Unary,status:error}",
+	} {
+		_, _, ok := methodSubmetric(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	t.Parallel()
+
+	data := sobek.New().ToValue(map[string]interface{}{
+		"metrics": map[string]interface{}{
+			"connectrpc_reqs": map[string]interface{}{"values": map[string]interface{}{"count": int64(5)}},
+			"connectrpc_reqs{method:/pkg.Service/Unary}":         map[string]interface{}{"values": map[string]interface{}{"count": int64(4), "rate": 2.0}},
+			"connectrpc_req_errors{method:/pkg.Service/Unary}":   map[string]interface{}{"values": map[string]interface{}{"count": int64(1)}},
+			"connectrpc_req_duration{method:/pkg.Service/Unary}": map[string]interface{}{"values": map[string]interface{}{"p(95)": 10.0}},
+			"connectrpc_req_size{method:/pkg.Service/Unary}":     map[string]interface{}{"values": map[string]interface{}{"avg": 100.0}},
+			"connectrpc_resp_size{method:/pkg.Service/Unary}":    map[string]interface{}{"values": map[string]interface{}{"avg": int64(2000)}},
+			"connectrpc_streams{method:/pkg.Service/Stream}":     map[string]interface{}{"values": map[string]interface{}{"count": int64(1)}},
+			"connectrpc_streams{method:/pkg.Service/Idle}":       map[string]interface{}{"values": map[string]interface{}{"count": int64(0)}},
+			"team_connectrpc_reqs{method:/pkg.Service/Other}":    map[string]interface{}{"values": map[string]interface{}{"count": int64(1)}},
+		},
+	})
+
+	summaries := summarize(data, "")
+	require.Len(t, summaries, 2, "methods without calls and other prefixes are skipped")
+
+	stream, unary := summaries[0], summaries[1]
+	assert.Equal(t, "/pkg.Service/Stream", stream.Method)
+	assert.Equal(t, "stream", stream.Type)
+	assert.Equal(t, int64(1), stream.Reqs)
+
+	assert.Equal(t, "/pkg.Service/Unary", unary.Method)
+	assert.Equal(t, "unary", unary.Type)
+	assert.Equal(t, int64(4), unary.Reqs)
+	assert.Equal(t, int64(1), unary.Errors)
+	assert.InDelta(t, 0.25, unary.ErrorRate, 0.001)
+	assert.InDelta(t, 2.0, unary.Rate, 0.001)
+	assert.InDelta(t, 10.0, unary.P95, 0.001)
+	assert.InDelta(t, 100.0, unary.AvgReqBytes, 0.001)
+	assert.InDelta(t, 2000.0, unary.AvgRespBytes, 0.001)
+
+	text := renderTextSummary(summaries)
+	assert.Contains(t, text, "/pkg.Service/Unary")
+	assert.Contains(t, text, "25.00%")
+	assert.Contains(t, text, "2.0 kB")
+	assert.Contains(t, text, "2.00/s")
+
+	prefixed := summarize(data, "team_")
+	require.Len(t, prefixed, 1)
+	assert.Equal(t, "/pkg.Service/Other", prefixed[0].Method)
+
+	assert.Empty(t, summarize(sobek.Undefined(), ""))
+}
+
+func TestRenderTextSummaryEmpty(t *testing.T) {
+	t.Parallel()
+
+	assert.Contains(t, renderTextSummary(nil), "no ConnectRPC calls recorded")
+}
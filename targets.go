@@ -0,0 +1,185 @@
+package connectrpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+)
+
+// targetSet is the addresses of a client connected to several, like the regions of a
+// multi-region sweep. Every call goes to the target selected for its iteration or VU, and
+// its samples are tagged with the region of the target.
+type targetSet struct {
+	targets []target
+	perVU   bool // Whether the target is selected per VU rather than per iteration
+	current int  // Index of the target the client uses
+
+	// HTTP clients of the targets not in use, kept by the per-vu and global strategies
+	clients map[int]targetClient
+}
+
+// target is one of the addresses given to connect()
+type target struct {
+	addr   string
+	region string // Value of the region tag of the calls to the target
+}
+
+// targetClient is the HTTP client of a target not in use, with its maxConnectionAge expiry
+type targetClient struct {
+	httpClient *http.Client
+	expiry     time.Time
+}
+
+// parseTargets parses the addresses of connect(): URLs or host:port strings, or objects
+// like { url: 'https://eu.example.com', region: 'eu' }. The region defaults to the host.
+func parseTargets(addrs *sobek.Object) ([]target, error) {
+	length := int(addrs.Get("length").ToInteger())
+	if length == 0 {
+		return nil, errors.New("must have at least one address")
+	}
+
+	targets := make([]target, 0, length)
+	for i := 0; i < length; i++ {
+		value := addrs.Get(strconv.Itoa(i))
+		var t target
+		if obj, ok := value.(*sobek.Object); ok {
+			if addr := obj.Get("url"); !common.IsNullish(addr) {
+				t.addr = addr.String()
+			}
+			if region := obj.Get("region"); !common.IsNullish(region) {
+				t.region = region.String()
+			}
+		} else if !common.IsNullish(value) {
+			t.addr = value.String()
+		}
+		if t.addr == "" {
+			return nil, fmt.Errorf("address %d must be a URL or an object like { url, region }", i)
+		}
+		if t.region == "" {
+			t.region = targetHost(t.addr)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// targetHost returns the host of an address, without its scheme and port
+func targetHost(addr string) string {
+	host := addr
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// index returns the target of an iteration of a VU. The VUs start at different targets,
+// so that every target gets its share of the load at any time.
+func (ts *targetSet) index(vuID uint64, iteration int64) int {
+	n := uint64(len(ts.targets))
+	offset := vuID
+	if offset > 0 {
+		offset-- // The VU IDs start at 1
+	}
+	if ts.perVU || iteration < 0 {
+		return int(offset % n)
+	}
+	return int((offset + uint64(iteration)) % n)
+}
+
+// setAddress sets the base URL and host of the calls from an address given to connect(),
+// and returns the host for the TLS server name
+func (c *Client) setAddress(addr string, plaintext bool) (string, error) {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		parsedURL, err := url.Parse(addr)
+		if err != nil {
+			return "", fmt.Errorf("invalid URL: %w", err)
+		}
+		c.baseURL = strings.TrimRight(addr, "/")
+		c.addr = parsedURL.Host
+		return c.addr, nil
+	}
+
+	// This case is for when only a hostname is provided
+	scheme := "https"
+	if plaintext {
+		scheme = "http"
+	}
+	c.baseURL = fmt.Sprintf("%s://%s", scheme, addr)
+	c.addr = addr
+	return c.addr, nil
+}
+
+// selectTarget switches the client to the target of the current iteration, or VU with
+// select: 'perVU', when connect() was given several addresses. It must be called on the
+// event loop before each call or stream.
+func (c *Client) selectTarget() error {
+	if c.targets == nil {
+		return nil
+	}
+	state := c.vu.State()
+	if state == nil {
+		return nil
+	}
+	i := c.targets.index(state.VUID, state.Iteration)
+	if i == c.targets.current {
+		return nil
+	}
+	return c.useTarget(i)
+}
+
+// useTarget points the client to a target. The per-vu and global strategies keep the HTTP
+// client of each target, while per-iteration closes the one of the previous target.
+func (c *Client) useTarget(i int) error {
+	ts := c.targets
+	hostname, err := c.setAddress(ts.targets[i].addr, c.connectParams.IsPlaintext)
+	if err != nil {
+		return err
+	}
+	c.region = ts.targets[i].region
+
+	if c.connectionStrategy == "per-call" {
+		ts.current = i
+		return nil
+	}
+
+	if c.httpClient != nil && ts.current >= 0 {
+		if c.connectionStrategy == "per-iteration" {
+			c.releaseHTTPClient(c.httpClient)
+			c.httpClient = nil
+		} else {
+			if ts.clients == nil {
+				ts.clients = make(map[int]targetClient)
+			}
+			ts.clients[ts.current] = targetClient{httpClient: c.httpClient, expiry: c.httpClientExpiry}
+		}
+	}
+
+	if kept, ok := ts.clients[i]; ok {
+		delete(ts.clients, i)
+		c.httpClient = kept.httpClient
+		c.httpClientExpiry = kept.expiry
+	} else {
+		httpClient, err := c.createHTTPClient(c.connectParams, hostname)
+		if err != nil {
+			return err
+		}
+		c.setHTTPClient(httpClient)
+	}
+	if state := c.vu.State(); state != nil {
+		c.lastIterationID = state.Iteration // The kept client of the target counts as the one of the iteration
+	}
+
+	ts.current = i
+	return nil
+}
@@ -0,0 +1,181 @@
+package connectrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+)
+
+// maxTemplates bounds the parsed templates cached per client, in case scripts build
+// templates dynamically
+const maxTemplates = 256
+
+// payloadTemplate is a JSON request payload with `${name}` placeholders in its strings
+type payloadTemplate struct {
+	parts []templatePart
+}
+
+// templatePart is either a literal JSON fragment or a placeholder
+type templatePart struct {
+	literal []byte
+	name    string
+	// whole is true when the placeholder is a whole JSON string, like `"${id}"`. It is
+	// replaced by the JSON value of the variable, so numbers and objects keep their type.
+	whole bool
+}
+
+// parseTemplate splits a JSON payload around the `${name}` placeholders of its strings
+func parseTemplate(data []byte) (*payloadTemplate, error) {
+	if !json.Valid(data) {
+		return nil, errors.New("the template must be valid JSON")
+	}
+
+	t := &payloadTemplate{}
+	start, stringStart := 0, 0
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case escaped:
+			escaped = false
+			continue
+		case inString && c == '\\':
+			escaped = true
+			continue
+		case c == '"':
+			inString = !inString
+			stringStart = i
+			continue
+		case !inString || c != '$' || i+1 >= len(data) || data[i+1] != '{':
+			continue
+		}
+
+		// The placeholder must be closed in the same string
+		end := bytes.IndexByte(data[i+2:], '}')
+		if quote := bytes.IndexByte(data[i+2:], '"'); end < 0 || quote < end {
+			return nil, fmt.Errorf("unterminated placeholder at offset %d", i)
+		}
+		end += i + 2
+		name := string(data[i+2 : end])
+		if name == "" {
+			return nil, fmt.Errorf("empty placeholder at offset %d", i)
+		}
+
+		literalEnd, next := i, end+1
+		whole := stringStart == i-1 && next < len(data) && data[next] == '"'
+		if whole {
+			// Drop the quotes around the placeholder
+			literalEnd, next = i-1, next+1
+			inString = false
+		}
+
+		t.parts = append(t.parts,
+			templatePart{literal: data[start:literalEnd]},
+			templatePart{name: name, whole: whole})
+		start = next
+		i = next - 1
+	}
+	t.parts = append(t.parts, templatePart{literal: data[start:]})
+
+	return t, nil
+}
+
+// render substitutes the placeholders with the values of vars
+func (t *payloadTemplate) render(vars map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, part := range t.parts {
+		if part.name == "" {
+			buf.Write(part.literal)
+			continue
+		}
+
+		value, ok := vars[part.name]
+		if !ok {
+			return nil, fmt.Errorf("missing template variable %q", part.name)
+		}
+
+		if part.whole {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template variable %q: %w", part.name, err)
+			}
+			buf.Write(data)
+			continue
+		}
+
+		// Inside a string, the value is inserted as escaped text
+		text, ok := value.(string)
+		if !ok {
+			text = fmt.Sprint(value)
+		}
+		data, err := json.Marshal(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template variable %q: %w", part.name, err)
+		}
+		buf.Write(data[1 : len(data)-1])
+	}
+	return buf.Bytes(), nil
+}
+
+// template returns the parsed template of a JSON string or object, parsing it on first use
+func (c *Client) template(template sobek.Value) (*payloadTemplate, error) {
+	if common.IsNullish(template) {
+		return nil, errors.New("a template is required")
+	}
+
+	var data []byte
+	if s, ok := template.Export().(string); ok {
+		data = []byte(s)
+	} else {
+		var err error
+		if data, err = template.ToObject(c.vu.Runtime()).MarshalJSON(); err != nil {
+			return nil, err
+		}
+	}
+
+	if t, ok := c.templates[string(data)]; ok {
+		return t, nil
+	}
+
+	t, err := parseTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.templates == nil || len(c.templates) >= maxTemplates {
+		c.templates = make(map[string]*payloadTemplate)
+	}
+	c.templates[string(data)] = t
+	return t, nil
+}
+
+// InvokeTemplate calls a unary RPC with a payload template, a JSON string or object whose
+// `${name}` placeholders are replaced by the values of vars. The template is parsed once
+// and the substitution is done in Go, which avoids building the request object in JS.
+func (c *Client) InvokeTemplate(
+	method string,
+	template sobek.Value,
+	vars sobek.Value,
+	params sobek.Value,
+) (*sobek.Object, error) {
+	t, err := c.template(template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var values map[string]interface{}
+	if !common.IsNullish(vars) {
+		var ok bool
+		if values, ok = vars.Export().(map[string]interface{}); !ok {
+			return nil, errors.New("invalid template variables: must be an object")
+		}
+	}
+
+	return c.invoke(method, params, func() ([]byte, error) {
+		return t.render(values)
+	})
+}
@@ -0,0 +1,84 @@
+package connectrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadTemplate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "No placeholders",
+			template: `{"number": 1}`,
+			expected: `{"number": 1}`,
+		},
+		{
+			name:     "Whole values keep their type",
+			template: `{"number": "${n}", "text": "${text}", "nested": "${obj}"}`,
+			vars: map[string]interface{}{
+				"n":    int64(42),
+				"text": "hello",
+				"obj":  map[string]interface{}{"a": []interface{}{true}},
+			},
+			expected: `{"number": 42, "text": "hello", "nested": {"a":[true]}}`,
+		},
+		{
+			name:     "Embedded values are escaped",
+			template: `{"text": "user-${id}: ${quote}"}`,
+			vars:     map[string]interface{}{"id": int64(7), "quote": `say "hi"`},
+			expected: `{"text": "user-7: say \"hi\""}`,
+		},
+		{
+			name:     "Placeholders outside strings and escaped quotes are ignored",
+			template: `{"text": "\"${a}", "b": "$b"}`,
+			vars:     map[string]interface{}{"a": "x"},
+			expected: `{"text": "\"x", "b": "$b"}`,
+		},
+		{
+			name:     "Adjacent placeholders",
+			template: `["${a}${b}", "${a}"]`,
+			vars:     map[string]interface{}{"a": "x", "b": int64(1)},
+			expected: `["x1", "x"]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl, err := parseTemplate([]byte(tc.template))
+			require.NoError(t, err)
+
+			rendered, err := tmpl.render(tc.vars)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(rendered))
+		})
+	}
+}
+
+func TestPayloadTemplateErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := parseTemplate([]byte(`{"number": `))
+	require.ErrorContains(t, err, "must be valid JSON")
+
+	_, err = parseTemplate([]byte(`{"text": "${id"}`))
+	require.ErrorContains(t, err, "unterminated placeholder")
+
+	_, err = parseTemplate([]byte(`{"text": "${}"}`))
+	require.ErrorContains(t, err, "empty placeholder")
+
+	tmpl, err := parseTemplate([]byte(`{"text": "${id}"}`))
+	require.NoError(t, err)
+	_, err = tmpl.render(nil)
+	require.ErrorContains(t, err, `missing template variable "id"`)
+}
@@ -0,0 +1,193 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: static/v1/static.proto
+
+// The k6.connectrpc.static.v1 package is compiled into the tests with RegisterFiles
+
+package staticv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EchoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        int64                  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EchoRequest) Reset() {
+	*x = EchoRequest{}
+	mi := &file_static_v1_static_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EchoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EchoRequest) ProtoMessage() {}
+
+func (x *EchoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_static_v1_static_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EchoRequest.ProtoReflect.Descriptor instead.
+func (*EchoRequest) Descriptor() ([]byte, []int) {
+	return file_static_v1_static_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *EchoRequest) GetNumber() int64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *EchoRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type EchoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        int64                  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EchoResponse) Reset() {
+	*x = EchoResponse{}
+	mi := &file_static_v1_static_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EchoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EchoResponse) ProtoMessage() {}
+
+func (x *EchoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_static_v1_static_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EchoResponse.ProtoReflect.Descriptor instead.
+func (*EchoResponse) Descriptor() ([]byte, []int) {
+	return file_static_v1_static_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EchoResponse) GetNumber() int64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *EchoResponse) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+var File_static_v1_static_proto protoreflect.FileDescriptor
+
+const file_static_v1_static_proto_rawDesc = "" +
+	"\n" +
+	"\x16static/v1/static.proto\x12\x17k6.connectrpc.static.v1\"9\n" +
+	"\vEchoRequest\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\x03R\x06number\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\":\n" +
+	"\fEchoResponse\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\x03R\x06number\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text2d\n" +
+	"\vEchoService\x12U\n" +
+	"\x04Echo\x12$.k6.connectrpc.static.v1.EchoRequest\x1a%.k6.connectrpc.static.v1.EchoResponse\"\x00BAZ?github.com/bumberboy/xk6-connectrpc/testdata/static/v1;staticv1b\x06proto3"
+
+var (
+	file_static_v1_static_proto_rawDescOnce sync.Once
+	file_static_v1_static_proto_rawDescData []byte
+)
+
+func file_static_v1_static_proto_rawDescGZIP() []byte {
+	file_static_v1_static_proto_rawDescOnce.Do(func() {
+		file_static_v1_static_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_static_v1_static_proto_rawDesc), len(file_static_v1_static_proto_rawDesc)))
+	})
+	return file_static_v1_static_proto_rawDescData
+}
+
+var file_static_v1_static_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_static_v1_static_proto_goTypes = []any{
+	(*EchoRequest)(nil),  // 0: k6.connectrpc.static.v1.EchoRequest
+	(*EchoResponse)(nil), // 1: k6.connectrpc.static.v1.EchoResponse
+}
+var file_static_v1_static_proto_depIdxs = []int32{
+	0, // 0: k6.connectrpc.static.v1.EchoService.Echo:input_type -> k6.connectrpc.static.v1.EchoRequest
+	1, // 1: k6.connectrpc.static.v1.EchoService.Echo:output_type -> k6.connectrpc.static.v1.EchoResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_static_v1_static_proto_init() }
+func file_static_v1_static_proto_init() {
+	if File_static_v1_static_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_static_v1_static_proto_rawDesc), len(file_static_v1_static_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_static_v1_static_proto_goTypes,
+		DependencyIndexes: file_static_v1_static_proto_depIdxs,
+		MessageInfos:      file_static_v1_static_proto_msgTypes,
+	}.Build()
+	File_static_v1_static_proto = out.File
+	file_static_v1_static_proto_goTypes = nil
+	file_static_v1_static_proto_depIdxs = nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/bumberboy/xk6-connectrpc/testdata/ping/v1/pingv1connect"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 const (
@@ -31,6 +32,7 @@ type pingServer struct {
 
 	checkMetadata       bool
 	includeErrorDetails bool
+	config              testServerConfig
 }
 
 func (p pingServer) Ping(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
@@ -47,10 +49,11 @@ func (p pingServer) Ping(ctx context.Context, request *connect.Request[pingv1.Pi
 	response := connect.NewResponse(
 		&pingv1.PingResponse{
 			Number: request.Msg.GetNumber(),
-			Text:   request.Msg.GetText(),
+			Text:   p.config.padText(request.Msg.GetText()),
 		},
 	)
 	response.Header().Set(handlerHeader, headerValue)
+	response.Header().Set("Server-Timing", `db;dur=1.5;desc="Query", cache;desc=miss, app;dur=3`)
 	response.Trailer().Set(handlerTrailer, trailerValue)
 	return response, nil
 }
@@ -197,40 +200,95 @@ func expectMetadata(headers http.Header, typ, key, expectedValue string) error {
 }
 
 // Test server factory functions
-func newTestServer(checkMetadata bool) *httptest.Server {
-	server := pingServer{
-		checkMetadata:       checkMetadata,
-		includeErrorDetails: false,
-	}
-
+func newTestHandler(server pingServer, config testServerConfig) http.Handler {
 	mux := http.NewServeMux()
-	path, handler := pingv1connect.NewPingServiceHandler(server)
-	mux.Handle(path, handler)
+	path, handler := pingv1connect.NewPingServiceHandler(server,
+		connect.WithInterceptors(config.interceptor()),
+		connect.WithCompression(compressionZstd, newZstdDecompressor, newZstdCompressor),
+	)
+	mux.Handle(path, sseCountUp(handler))
+	return config.connLimits(mux)
+}
 
-	h2s := &http2.Server{}
-	return httptest.NewServer(h2c.NewHandler(mux, h2s))
+// sseCountUp serves CountUp as server-sent events to the requests accepting them, like the
+// gateways streaming to fetch() clients, and passes the other requests to the handler
+func sseCountUp(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" || r.URL.Path != pingv1connect.PingServiceCountUpProcedure {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		request := &pingv1.CountUpRequest{}
+		if err == nil {
+			err = protojson.Unmarshal(body, request)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set(handlerHeader, headerValue)
+		flusher, _ := w.(http.Flusher)
+		_, _ = fmt.Fprint(w, ": counting up\n\n")
+		if request.GetNumber() <= 0 {
+			_, _ = fmt.Fprintf(w, "event: error\ndata: {\"code\": \"invalid_argument\",\ndata: \"message\": \"number must be positive: got %d\"}\n\n",
+				request.GetNumber())
+			return
+		}
+		for i := int64(1); i <= request.GetNumber(); i++ {
+			_, _ = fmt.Fprintf(w, "data: {\"number\": \"%d\"}\n\n", i)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		_, _ = fmt.Fprintf(w, "event: end\ndata: {\"metadata\": {%q: [%q]}}\n\n", handlerTrailer, trailerValue)
+	})
+}
+
+func newTestServer(checkMetadata bool, opts ...TestServerOption) *httptest.Server {
+	srv := httptest.NewUnstartedServer(NewTestHandler(checkMetadata, opts...))
+	srv.Config.ConnContext = TestConnContext
+	srv.Start()
+	return srv
 }
 
-func newTLSTestServer(checkMetadata bool) *httptest.Server {
+func newTLSTestServer(checkMetadata bool, opts ...TestServerOption) *httptest.Server {
+	config := newTestServerConfig(opts)
 	server := pingServer{
 		checkMetadata:       checkMetadata,
 		includeErrorDetails: false,
+		config:              config,
 	}
 
-	mux := http.NewServeMux()
-	path, handler := pingv1connect.NewPingServiceHandler(server)
-	mux.Handle(path, handler)
-
-	return httptest.NewTLSServer(mux)
+	srv := httptest.NewUnstartedServer(newTestHandler(server, config))
+	srv.Config.ConnContext = TestConnContext
+	srv.StartTLS()
+	return srv
 }
 
 // Exported functions for testing
-func NewTestServer(checkMetadata bool) *httptest.Server {
-	return newTestServer(checkMetadata)
+func NewTestServer(checkMetadata bool, opts ...TestServerOption) *httptest.Server {
+	return newTestServer(checkMetadata, opts...)
 }
 
-func NewTLSTestServer(checkMetadata bool) *httptest.Server {
-	return newTLSTestServer(checkMetadata)
+func NewTLSTestServer(checkMetadata bool, opts ...TestServerOption) *httptest.Server {
+	return newTLSTestServer(checkMetadata, opts...)
+}
+
+// NewTestHandler returns the handler of NewTestServer, serving HTTP/1.1 and h2c, to run it on a chosen address
+func NewTestHandler(checkMetadata bool, opts ...TestServerOption) http.Handler {
+	config := newTestServerConfig(opts)
+	server := pingServer{
+		checkMetadata:       checkMetadata,
+		includeErrorDetails: false,
+		config:              config,
+	}
+
+	h2s := &http2.Server{}
+	return h2c.NewHandler(newTestHandler(server, config), h2s)
 }
 
 // NewTestServerWithErrorDetails creates a test server with error details enabled for testing
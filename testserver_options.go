@@ -0,0 +1,209 @@
+package connectrpc
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// injectedErrorMessage is the message of the errors injected by WithErrorRate
+const injectedErrorMessage = "injected error"
+
+// TestServerOption configures the test servers, to stand in for a real server when
+// developing scenarios offline
+type TestServerOption func(*testServerConfig)
+
+type testServerConfig struct {
+	latency      func() time.Duration // Delay before handling each call, nil for none
+	errorRate    float64              // Percentage of the calls failing, from 0 to 100
+	errorCode    connect.Code         // Code of the injected errors
+	responseSize int                  // Minimum size of the Ping response text, in bytes
+	goAwayAfter  int                  // Requests of each connection before draining it, 0 for no limit
+	closeAfter   int                  // Requests of each connection before closing it, 0 for no limit
+}
+
+// WithLatency delays every call by a duration drawn from dist, before the handler runs
+func WithLatency(dist func() time.Duration) TestServerOption {
+	return func(c *testServerConfig) {
+		c.latency = dist
+	}
+}
+
+// FixedLatency is a latency distribution always returning d
+func FixedLatency(d time.Duration) func() time.Duration {
+	return func() time.Duration { return d }
+}
+
+// UniformLatency is a latency distribution uniform between lo and hi
+func UniformLatency(lo, hi time.Duration) func() time.Duration {
+	return func() time.Duration {
+		if hi <= lo {
+			return lo
+		}
+		return lo + rand.N(hi-lo) //nolint:gosec
+	}
+}
+
+// WithErrorRate fails pct percent of the calls with code, without running the handler
+func WithErrorRate(pct float64, code connect.Code) TestServerOption {
+	return func(c *testServerConfig) {
+		c.errorRate = pct
+		c.errorCode = code
+	}
+}
+
+// WithResponseSize pads the text of the Ping responses to at least size bytes
+func WithResponseSize(size int) TestServerOption {
+	return func(c *testServerConfig) {
+		c.responseSize = size
+	}
+}
+
+// WithGoAwayAfter drains each connection once it served n requests: the response of the
+// nth one closes the connection, with a GOAWAY on HTTP/2 or after the response on HTTP/1.1.
+// The calls in flight on it complete, and the next ones go to a new connection.
+func WithGoAwayAfter(n int) TestServerOption {
+	return func(c *testServerConfig) {
+		c.goAwayAfter = n
+	}
+}
+
+// WithCloseAfter closes each connection abruptly once it served n requests: the next
+// request gets no response, and the calls and streams in flight on the connection fail,
+// like with a crashed server. HTTP/2 connections need the connection of TestConnContext in
+// the request context, which NewTestServer and NewTLSTestServer set; without it only the
+// stream of the request is reset.
+func WithCloseAfter(n int) TestServerOption {
+	return func(c *testServerConfig) {
+		c.closeAfter = n
+	}
+}
+
+type testConnKey struct{}
+
+// TestConnContext keeps the connection in the context of its requests, for WithCloseAfter.
+// Set it as the ConnContext of the http.Server serving NewTestHandler.
+func TestConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, testConnKey{}, c)
+}
+
+func newTestServerConfig(opts []TestServerOption) testServerConfig {
+	var config testServerConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// padText pads a response text to the configured response size
+func (c testServerConfig) padText(text string) string {
+	if len(text) >= c.responseSize {
+		return text
+	}
+	return text + strings.Repeat("x", c.responseSize-len(text))
+}
+
+// inject waits for the configured latency, then returns an error for the configured share of calls
+func (c testServerConfig) inject(ctx context.Context) error {
+	if c.latency != nil {
+		timer := time.NewTimer(c.latency())
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return connect.NewError(connect.CodeCanceled, ctx.Err())
+		}
+	}
+
+	if c.errorRate > 0 && rand.Float64()*100 < c.errorRate { //nolint:gosec
+		return connect.NewError(c.errorCode, errors.New(injectedErrorMessage))
+	}
+	return nil
+}
+
+// connLimits drains or closes the connections of the handler after the configured
+// number of requests, returning the handler as is without limits
+func (c testServerConfig) connLimits(next http.Handler) http.Handler {
+	if c.goAwayAfter <= 0 && c.closeAfter <= 0 {
+		return next
+	}
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]int) // Requests served by each connection, by remote address
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.RemoteAddr]++
+		n := requests[r.RemoteAddr]
+		closing := c.closeAfter > 0 && n > c.closeAfter
+		draining := !closing && c.goAwayAfter > 0 && n >= c.goAwayAfter
+		if closing || draining {
+			// The connection takes no more requests: a later one with the same address is a new connection
+			delete(requests, r.RemoteAddr)
+		}
+		mu.Unlock()
+
+		switch {
+		case closing:
+			closeConn(w, r)
+		case draining:
+			w.Header().Set("Connection", "close")
+			next.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// closeConn closes the connection of a request without responding
+func closeConn(w http.ResponseWriter, r *http.Request) {
+	if conn, ok := r.Context().Value(testConnKey{}).(net.Conn); ok {
+		_ = conn.Close()
+	} else if hijacker, ok := w.(http.Hijacker); ok && r.ProtoMajor == 1 {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	// Resets the HTTP/2 stream, or closes the HTTP/1.1 connection, when the handler returns
+	panic(http.ErrAbortHandler)
+}
+
+// interceptor applies the latency and errors of the configuration to the unary and streaming calls
+func (c testServerConfig) interceptor() connect.Interceptor {
+	return testServerInterceptor{config: c}
+}
+
+type testServerInterceptor struct {
+	config testServerConfig
+}
+
+func (i testServerInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if err := i.config.inject(ctx); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i testServerInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i testServerInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := i.config.inject(ctx); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
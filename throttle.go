@@ -0,0 +1,214 @@
+package connectrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleParams limits the bandwidth used by all connections of a client.
+// The buckets are shared by every connection the client dials, so the limit
+// applies per VU regardless of the connection strategy. The connections of the
+// 'global' strategy are shared by the VUs, so their bodies are paced instead,
+// see throttledTransport.
+type throttleParams struct {
+	upload   *tokenBucket
+	download *tokenBucket
+}
+
+// newThrottleParams creates bandwidth limits from the `throttle` connect parameter
+func newThrottleParams(config map[string]interface{}) (*throttleParams, error) {
+	upload, err := parseKbps(config["uploadKbps"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid uploadKbps: %w", err)
+	}
+	download, err := parseKbps(config["downloadKbps"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid downloadKbps: %w", err)
+	}
+	if upload == 0 && download == 0 {
+		return nil, errors.New("at least one of uploadKbps or downloadKbps is required")
+	}
+
+	t := &throttleParams{}
+	if upload > 0 {
+		t.upload = newTokenBucket(kbpsToBytes(upload))
+	}
+	if download > 0 {
+		t.download = newTokenBucket(kbpsToBytes(download))
+	}
+	return t, nil
+}
+
+func parseKbps(v interface{}) (float64, error) {
+	var kbps float64
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		kbps = float64(n)
+	case float64:
+		kbps = n
+	default:
+		return 0, fmt.Errorf("must be a number, got %T", v)
+	}
+	if kbps < 0 {
+		return 0, fmt.Errorf("must not be negative, got %v", kbps)
+	}
+	return kbps, nil
+}
+
+// kbpsToBytes converts kilobits per second to bytes per second
+func kbpsToBytes(kbps float64) float64 {
+	return kbps * 1000 / 8
+}
+
+// wrapDialer returns a dial function whose connections are throttled
+func (t *throttleParams) wrapDialer(
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &throttledConn{Conn: conn, upload: t.upload, download: t.download}, nil
+	}
+}
+
+// throttledConn is a net.Conn whose reads and writes are paced by token buckets
+type throttledConn struct {
+	net.Conn
+	upload   *tokenBucket
+	download *tokenBucket
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if c.download == nil {
+		return c.Conn.Read(p)
+	}
+
+	// Read at most one burst at a time so the pacing stays smooth
+	if burst := c.download.burstSize(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		time.Sleep(c.download.take(n))
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	if c.upload == nil {
+		return c.Conn.Write(p)
+	}
+
+	written := 0
+	burst := c.upload.burstSize()
+	for written < len(p) {
+		chunk := p[written:min(written+burst, len(p))]
+		time.Sleep(c.upload.take(len(chunk)))
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// throttledTransport paces the request and response bodies of a client with its buckets,
+// for the transports shared by all the VUs with the 'global' strategy, whose connections
+// can't be throttled per VU, and for the registered transports, whose connections aren't ours
+type throttledTransport struct {
+	base     http.RoundTripper
+	throttle *throttleParams
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.throttle.upload != nil && req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &throttledBody{ReadCloser: req.Body, bucket: t.throttle.upload}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.throttle.download != nil && resp.Body != nil {
+		resp.Body = &throttledBody{ReadCloser: resp.Body, bucket: t.throttle.download}
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *throttledTransport) CloseIdleConnections() {
+	closeIdleConnections(t.base)
+}
+
+// throttledBody is a request or response body whose reads are paced by a token bucket
+type throttledBody struct {
+	io.ReadCloser
+	bucket *tokenBucket
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	// Read at most one burst at a time so the pacing stays smooth
+	if burst := b.bucket.burstSize(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		time.Sleep(b.bucket.take(n))
+	}
+	return n, err
+}
+
+// tokenBucket is a token bucket measured in bytes. Callers take tokens
+// up-front and sleep for the returned duration if the bucket went into debt.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // maximum bytes accumulated while idle
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(bytesPerSecond float64) *tokenBucket {
+	// Allow roughly 100ms worth of traffic in a burst, but at least 1KB
+	burst := max(bytesPerSecond/10, 1024)
+	return &tokenBucket{
+		rate:   bytesPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) burstSize() int {
+	return int(b.burst)
+}
+
+// take consumes n tokens and returns how long the caller must wait for them
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,71 @@
+package connectrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Parallel()
+
+	// 10KB/s with the minimum burst of 1KB
+	bucket := newTokenBucket(10 * 1024)
+	assert.Equal(t, 1024, bucket.burstSize())
+
+	// The initial burst is available immediately
+	assert.Equal(t, time.Duration(0), bucket.take(1024))
+
+	// Another 1KB has to wait for roughly 100ms worth of tokens
+	wait := bucket.take(1024)
+	assert.Greater(t, wait, 90*time.Millisecond)
+	assert.LessOrEqual(t, wait, 100*time.Millisecond)
+}
+
+func TestThrottledConnLimitsBandwidth(t *testing.T) {
+	t.Parallel()
+
+	// 80 kbps = 10000 bytes per second
+	throttle, err := newThrottleParams(map[string]interface{}{"uploadKbps": int64(80), "downloadKbps": int64(80)})
+	require.NoError(t, err)
+
+	server, client := net.Pipe()
+	defer func() { _ = server.Close() }()
+
+	dial := throttle.wrapDialer(func(context.Context, string, string) (net.Conn, error) {
+		return client, nil
+	})
+	conn, err := dial(context.Background(), "tcp", "pipe")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	payload := make([]byte, 4000)
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+
+	// 1000 bytes of initial burst, then 3000 bytes at 10000 bytes/s
+	start := time.Now()
+	n, err := conn.Write(payload)
+	require.NoError(t, err)
+	assert.Equal(t, len(payload), n)
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestNewThrottleParamsInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := newThrottleParams(map[string]interface{}{})
+	require.ErrorContains(t, err, "at least one of uploadKbps or downloadKbps is required")
+
+	_, err = newThrottleParams(map[string]interface{}{"uploadKbps": int64(-1)})
+	require.ErrorContains(t, err, "invalid uploadKbps: must not be negative")
+
+	_, err = newThrottleParams(map[string]interface{}{"downloadKbps": "fast"})
+	require.ErrorContains(t, err, "invalid downloadKbps: must be a number")
+}
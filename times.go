@@ -0,0 +1,178 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The `timeFields` connect parameter converts the google.protobuf.Timestamp and Duration
+// fields between JS values and their protojson strings
+const (
+	// timeFieldsISO accepts JS Dates, milliseconds since the epoch, RFC 3339 timestamps with
+	// any offset and durations like '1m30s' or milliseconds in requests. The responses keep
+	// the protojson strings, like '2024-01-02T15:04:05Z' and '1.5s'.
+	timeFieldsISO = "iso"
+
+	// timeFieldsDate also converts the responses, to JS Dates and durations in milliseconds
+	timeFieldsDate = "date"
+)
+
+const (
+	timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+	durationName  protoreflect.FullName = "google.protobuf.Duration"
+)
+
+// normalizeTime converts the value of a Timestamp or Duration field of a request to its
+// protojson string. It returns nil for the other messages, or if the value is unchanged.
+func normalizeTime(value interface{}, name protoreflect.FullName, path string) (interface{}, error) {
+	switch name {
+	case timestampName:
+		return normalizeTimestamp(value, path)
+	case durationName:
+		return normalizeDuration(value, path)
+	}
+	return nil, nil
+}
+
+// normalizeTimestamp accepts milliseconds since the epoch, like Date.now(), and RFC 3339
+// timestamps with any offset, which protojson only accepts in UTC
+func normalizeTimestamp(value interface{}, path string) (interface{}, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case json.Number:
+		ms, err := jsonMilliseconds(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: invalid timestamp %s", path, v)
+		}
+		t = time.Unix(0, 0).Add(ms)
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("field %s: expected a Date, an RFC 3339 timestamp or milliseconds since the epoch, got %q", path, v)
+		}
+	default:
+		return nil, fmt.Errorf("field %s: expected a Date, an RFC 3339 timestamp or milliseconds since the epoch, got %s", path, jsonType(value))
+	}
+
+	normalized := t.UTC().Format(time.RFC3339Nano)
+	if normalized == value {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+// normalizeDuration accepts durations like '1m30s' or '250ms', and numbers of milliseconds
+// like the k6 options, while protojson only accepts seconds like '90s'
+func normalizeDuration(value interface{}, path string) (interface{}, error) {
+	var d time.Duration
+	switch v := value.(type) {
+	case json.Number:
+		var err error
+		if d, err = jsonMilliseconds(v); err != nil {
+			return nil, fmt.Errorf("field %s: invalid duration %s", path, v)
+		}
+	case string:
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("field %s: expected a duration like '1.5s' or '250ms', or milliseconds, got %q", path, v)
+		}
+	default:
+		return nil, fmt.Errorf("field %s: expected a duration like '1.5s' or '250ms', or milliseconds, got %s", path, jsonType(value))
+	}
+
+	normalized := formatProtoDuration(d)
+	if normalized == value {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+// jsonMilliseconds converts a number of milliseconds to a duration, to the microsecond for
+// fractions as the float64 of a timestamp in nanoseconds would lose precision
+func jsonMilliseconds(n json.Number) (time.Duration, error) {
+	if ms, err := n.Int64(); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	ms, err := n.Float64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(math.Round(ms*1000)) * time.Microsecond, nil
+}
+
+// formatProtoDuration formats a duration like protojson, in seconds with up to 9 decimals
+func formatProtoDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	seconds := strconv.FormatInt(int64(d/time.Second), 10)
+	if nanos := d % time.Second; nanos != 0 {
+		seconds += strings.TrimRight(fmt.Sprintf(".%09d", nanos), "0")
+	}
+	return sign + seconds + "s"
+}
+
+// responseTimes converts the Timestamp and Duration fields of a response decoded from its
+// protojson, with timeFields: 'date', to JS Dates and milliseconds. The other values are
+// returned as is.
+func responseTimes(rt *sobek.Runtime, value interface{}, desc protoreflect.MessageDescriptor) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, field := range obj {
+		fd := desc.Fields().ByJSONName(key)
+		if fd == nil || fd.Message() == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if entries, ok := field.(map[string]interface{}); ok && fd.MapValue().Message() != nil {
+				for k, entry := range entries {
+					entries[k] = responseTime(rt, entry, fd.MapValue().Message())
+				}
+			}
+		case fd.IsList():
+			if items, ok := field.([]interface{}); ok {
+				for i, item := range items {
+					items[i] = responseTime(rt, item, fd.Message())
+				}
+			}
+		default:
+			obj[key] = responseTime(rt, field, fd.Message())
+		}
+	}
+	return obj
+}
+
+// responseTime converts a message value of a response, see responseTimes
+func responseTime(rt *sobek.Runtime, value interface{}, desc protoreflect.MessageDescriptor) interface{} {
+	s, isString := value.(string)
+	switch desc.FullName() {
+	case timestampName:
+		if t, err := time.Parse(time.RFC3339Nano, s); isString && err == nil {
+			if date, err := rt.New(rt.Get("Date"), rt.ToValue(t.UnixMilli())); err == nil {
+				return date
+			}
+		}
+		return value
+	case durationName:
+		if d, err := time.ParseDuration(s); isString && err == nil {
+			return float64(d) / float64(time.Millisecond)
+		}
+		return value
+	}
+	if strings.HasPrefix(string(desc.FullName()), "google.protobuf.") {
+		return value
+	}
+	return responseTimes(rt, value, desc)
+}
@@ -0,0 +1,108 @@
+package connectrpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/sobek"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestUnmarshalRequestTimeFields(t *testing.T) {
+	t.Parallel()
+
+	desc := requestTestDescriptor(t, "ScheduleRequest")
+	u := requestUnmarshaler{convertTimes: true}
+
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{
+			name:     "Protojson strings",
+			request:  `{"at": "2024-01-02T15:04:05.250Z", "ttl": "1.5s"}`,
+			expected: `{"at": "2024-01-02T15:04:05.250Z", "ttl": "1.500s"}`,
+		},
+		{
+			name:     "Milliseconds",
+			request:  `{"at": 1704207845250, "ttl": 1500, "timeouts": {"read": 250}}`,
+			expected: `{"at": "2024-01-02T15:04:05.250Z", "ttl": "1.500s", "timeouts": {"read": "0.250s"}}`,
+		},
+		{
+			name:     "Offsets and Go durations",
+			request:  `{"reminders": ["2024-01-02T16:04:05+01:00"], "window": {"start": "2024-01-02T10:04:05-05:00", "length": "1h30m"}}`,
+			expected: `{"reminders": ["2024-01-02T15:04:05Z"], "window": {"start": "2024-01-02T15:04:05Z", "length": "5400s"}}`,
+		},
+		{
+			name:     "Negative durations",
+			request:  `{"ttl": "-250ms"}`,
+			expected: `{"ttl": "-0.250s"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := dynamicpb.NewMessage(desc)
+			require.NoError(t, u.unmarshal([]byte(tc.request), msg))
+
+			actual, err := protojson.Marshal(msg)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(actual))
+		})
+	}
+
+	err := u.unmarshal([]byte(`{"ttl": "soon"}`), dynamicpb.NewMessage(desc))
+	require.EqualError(t, err, `field ttl: expected a duration like '1.5s' or '250ms', or milliseconds, got "soon"`)
+
+	err = u.unmarshal([]byte(`{"window": {"start": true}}`), dynamicpb.NewMessage(desc))
+	require.EqualError(t, err, "field window.start: expected a Date, an RFC 3339 timestamp or milliseconds since the epoch, got boolean")
+
+	// Without timeFields, the values protojson rejects stay errors
+	err = unmarshalRequest([]byte(`{"ttl": 1500}`), dynamicpb.NewMessage(desc))
+	require.Error(t, err)
+}
+
+func TestFormatProtoDuration(t *testing.T) {
+	t.Parallel()
+
+	for d, expected := range map[time.Duration]string{
+		0:                                "0s",
+		1500 * time.Millisecond:          "1.5s",
+		time.Nanosecond:                  "0.000000001s",
+		-90 * time.Second:                "-90s",
+		time.Hour + 250*time.Microsecond: "3600.00025s",
+	} {
+		assert.Equal(t, expected, formatProtoDuration(d), d.String())
+	}
+}
+
+func TestResponseTimes(t *testing.T) {
+	t.Parallel()
+
+	desc := requestTestDescriptor(t, "ScheduleRequest")
+	rt := sobek.New()
+
+	var response interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"at": "2024-01-02T15:04:05.250Z",
+		"ttl": "1.500s",
+		"reminders": ["2024-01-02T15:04:05Z"],
+		"timeouts": {"read": "0.250s"},
+		"window": {"length": "5400s"}
+	}`), &response))
+	require.NoError(t, rt.Set("response", responseTimes(rt, response, desc)))
+
+	v, err := rt.RunString(`JSON.stringify([
+		response.at instanceof Date, response.at.getTime(), response.ttl,
+		response.reminders[0].toISOString(), response.timeouts.read, response.window.length,
+	])`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[true, 1704207845250, 1500, "2024-01-02T15:04:05.000Z", 250, 5400000]`, v.String())
+}
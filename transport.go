@@ -0,0 +1,115 @@
+package connectrpc
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TransportFactory creates the HTTP transport of a client connected with the `transport`
+// connect parameter set to the name it was registered with. It is called for every HTTP
+// client the connection strategy creates, so a factory may return a shared RoundTripper.
+type TransportFactory func(TransportConfig) (http.RoundTripper, error)
+
+// TransportConfig is the connection a registered transport is created for
+type TransportConfig struct {
+	Name        string      // Name the transport was registered with
+	Address     string      // host:port of the calls
+	BaseURL     string      // Scheme and address of the calls, like https://api.example.com
+	Plaintext   bool        // Whether the calls are made over HTTP, or h2c with HTTP/2
+	HTTPVersion string      // '1.1', '2' or 'auto'
+	TLS         *tls.Config // TLS configuration of the `tls` connect parameter, nil in plaintext
+}
+
+// transportFactories holds the transports registered by other extensions and custom builds
+var transportFactories = struct {
+	sync.RWMutex
+	factories map[string]TransportFactory
+}{factories: make(map[string]TransportFactory)}
+
+// RegisterTransport registers the factory of a custom HTTP transport, like a recording
+// proxy or an in-memory transport, that scripts select with the `transport` connect
+// parameter. It is meant to be called from the init function of an extension, and panics
+// if the name is empty or already registered, like modules.Register.
+//
+// The calls still go through the request signing, wire capture, strict validation and
+// throttling of the client, while the connection budget and the HTTP/2 frame inspection
+// only apply to the built-in transports.
+func RegisterTransport(name string, factory TransportFactory) {
+	if name == "" || factory == nil {
+		panic("connectrpc: RegisterTransport requires a name and a factory")
+	}
+
+	transportFactories.Lock()
+	defer transportFactories.Unlock()
+
+	if _, ok := transportFactories.factories[name]; ok {
+		panic(fmt.Sprintf("connectrpc: transport %q is already registered", name))
+	}
+	transportFactories.factories[name] = factory
+}
+
+// registeredTransport returns the factory of a registered transport
+func registeredTransport(name string) (TransportFactory, error) {
+	transportFactories.RLock()
+	defer transportFactories.RUnlock()
+
+	if factory, ok := transportFactories.factories[name]; ok {
+		return factory, nil
+	}
+	names := make([]string, 0, len(transportFactories.factories))
+	for registered := range transportFactories.factories {
+		names = append(names, registered)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("unknown transport %q, no transport is registered", name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown transport %q, must be one of %s", name, strings.Join(names, ", "))
+}
+
+// newRegisteredTransport creates the base transport of the client from the registered
+// transport of the `transport` connect parameter
+func (c *Client) newRegisteredTransport(p *connectParams, hostname string) (http.RoundTripper, error) {
+	factory, err := registeredTransport(p.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	config := TransportConfig{
+		Name:        p.Transport,
+		Address:     hostname,
+		BaseURL:     c.baseURL,
+		Plaintext:   p.IsPlaintext,
+		HTTPVersion: p.HTTPVersion,
+	}
+	if !p.IsPlaintext {
+		if config.TLS, err = newTLSConfig(p, hostname); err != nil {
+			return nil, err
+		}
+	}
+
+	transport, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("transport %q: %w", p.Transport, err)
+	}
+	if transport == nil {
+		return nil, fmt.Errorf("transport %q: the factory returned no transport", p.Transport)
+	}
+	return transport, nil
+}
+
+// validateTransport checks the connect parameters only supported by the built-in transports
+func validateTransport(p *connectParams) error {
+	if _, err := registeredTransport(p.Transport); err != nil {
+		return err
+	}
+	if p.HTTP2Frames {
+		return errors.New("http2Frames requires the built-in transport, not a registered one")
+	}
+	return nil
+}
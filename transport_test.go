@@ -0,0 +1,89 @@
+package connectrpc_test
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bumberboy/xk6-connectrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordedRoundTrips counts the requests of the 'recording' test transport
+var recordedRoundTrips atomic.Int64
+
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordedRoundTrips.Add(1)
+	req.Header.Set("X-Recorded", "true")
+	return t.base.RoundTrip(req)
+}
+
+func init() {
+	connectrpc.RegisterTransport("recording", func(config connectrpc.TransportConfig) (http.RoundTripper, error) {
+		if !config.Plaintext || config.TLS != nil {
+			return nil, errors.New("the recording transport only supports plaintext")
+		}
+		return &recordingTransport{base: &http.Transport{}}, nil
+	})
+}
+
+func TestRegisteredTransport(t *testing.T) {
+	t.Parallel()
+
+	server := connectrpc.NewTestServer(false)
+	defer server.Close()
+
+	ts := newTestState(t)
+
+	_, err := ts.Run(`
+		connectrpc.loadProtos([], './testdata/ping/v1/ping.proto');
+		var client = new connectrpc.Client();
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	before := recordedRoundTrips.Load()
+	val, err := ts.Run(`
+		client.connect('` + server.URL + `', { plaintext: true, httpVersion: '1.1', transport: 'recording' });
+		client.invoke('/k6.connectrpc.ping.v1.PingService/Ping', { number: 1 }).status;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), val.ToInteger())
+	assert.Equal(t, int64(1), recordedRoundTrips.Load()-before)
+
+	// The factory errors are reported by connect()
+	_, err = ts.Run(`new connectrpc.Client().connect('localhost:8080', { transport: 'recording' })`)
+	require.ErrorContains(t, err, `transport "recording": the recording transport only supports plaintext`)
+}
+
+func TestRegisteredTransportInvalid(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestState(t)
+	ts.ToVUContext()
+
+	for _, tc := range []struct {
+		params string
+		err    string
+	}{
+		{`{ transport: 'missing' }`, `unknown transport "missing", must be one of recording`},
+		{`{ plaintext: true, transport: 'recording', http2Frames: true }`, "http2Frames requires the built-in transport"},
+	} {
+		_, err := ts.Run(`new connectrpc.Client().connect('localhost:8080', ` + tc.params + `)`)
+		require.Error(t, err, tc.params)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+
+	assert.Panics(t, func() {
+		connectrpc.RegisterTransport("recording", func(connectrpc.TransportConfig) (http.RoundTripper, error) {
+			return http.DefaultTransport, nil
+		})
+	})
+}
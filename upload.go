@@ -0,0 +1,336 @@
+package connectrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bumberboy/xk6-connectrpc/dynamic"
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// defaultUploadChunkSize is the default size of the chunks sent by uploadStream()
+const defaultUploadChunkSize = 64 * 1024
+
+// uploadRegistry holds the files loaded by loadFile() in the init context. The file
+// contents are shared by all VUs and never copied to the JS heap.
+type uploadRegistry struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// load reads a file once for all VUs
+func (r *uploadRegistry) load(filename string, read func() ([]byte, error)) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if data, ok := r.files[filename]; ok {
+		return len(data), nil
+	}
+
+	data, err := read()
+	if err != nil {
+		return 0, err
+	}
+	r.files[filename] = data
+	return len(data), nil
+}
+
+// get returns the contents of a file loaded by loadFile()
+func (r *uploadRegistry) get(filename string) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, ok := r.files[filename]
+	return data, ok
+}
+
+// loadFile loads a file for uploadStream() in the init context and returns its size
+func (mi *ModuleInstance) loadFile(filename string) (int, error) {
+	if mi.vu.State() != nil {
+		return 0, errors.New("loadFile must be called in the init context")
+	}
+
+	initEnv := mi.vu.InitEnv()
+	if initEnv == nil {
+		return 0, errors.New("missing init environment")
+	}
+
+	absFilePath := initEnv.GetAbsFilePath(filename)
+	fs := initEnv.FileSystems["file"]
+
+	return mi.uploads.load(filename, func() ([]byte, error) {
+		file, err := fs.Open(absFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read file: %w", err)
+		}
+		return data, nil
+	})
+}
+
+// uploadOptions are the `uploadStream()` options, on top of the call parameters
+type uploadOptions struct {
+	chunkSize int
+	field     protoreflect.FieldDescriptor
+	// message is the JSON of the other fields set in every chunk message, if any
+	message []byte
+}
+
+// newUploadOptions parses the uploadStream() options for a request message
+func newUploadOptions(rt *sobek.Runtime, input protoreflect.MessageDescriptor, options sobek.Value) (*uploadOptions, error) {
+	opts := &uploadOptions{chunkSize: defaultUploadChunkSize}
+	fieldName := "data"
+
+	if !common.IsNullish(options) {
+		optionsObj := options.ToObject(rt)
+		for _, k := range optionsObj.Keys() {
+			v := optionsObj.Get(k)
+			switch k {
+			case "chunkSize":
+				chunkSize := v.ToInteger()
+				if chunkSize < 1 {
+					return nil, fmt.Errorf("invalid chunkSize: %d. Must be at least 1", chunkSize)
+				}
+				opts.chunkSize = int(chunkSize)
+			case "fieldName":
+				fieldName = v.String()
+			case "message":
+				if common.IsNullish(v) {
+					continue
+				}
+				message, err := v.ToObject(rt).MarshalJSON()
+				if err != nil {
+					return nil, fmt.Errorf("invalid message: %w", err)
+				}
+				opts.message = message
+			}
+		}
+	}
+
+	field := input.Fields().ByName(protoreflect.Name(fieldName))
+	if field == nil {
+		field = input.Fields().ByJSONName(fieldName)
+	}
+	if field == nil || field.Kind() != protoreflect.BytesKind || field.IsList() {
+		return nil, fmt.Errorf("invalid fieldName: %s is not a bytes field of %s", fieldName, input.FullName())
+	}
+	opts.field = field
+
+	return opts, nil
+}
+
+// UploadStream sends a file loaded by connectrpc.loadFile() to a client streaming method,
+// as chunks in the bytes field of the request messages. The chunks reference the file
+// contents held in Go, so large files don't have to be loaded in the JS heap.
+func (c *Client) UploadStream(method, filename string, options sobek.Value) (*sobek.Object, error) {
+	if c.vu.State() == nil {
+		return nil, common.NewInitContextError("uploading in the init context is not supported")
+	}
+
+	if c.connectParams == nil {
+		return nil, errNotConnected
+	}
+	if err := c.checkRampDown(); err != nil {
+		return nil, err
+	}
+	if err := c.refreshAuth(); err != nil {
+		return nil, err
+	}
+	if err := c.selectTarget(); err != nil {
+		return nil, err
+	}
+
+	method = dynamic.MethodPath(method)
+	methodDesc, err := c.getMethodDescriptor(method)
+	if err != nil {
+		return nil, err
+	}
+	if !methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		return nil, fmt.Errorf("%s is not a client streaming method", method)
+	}
+
+	data, ok := c.uploads.get(filename)
+	if !ok {
+		return nil, fmt.Errorf("file %q was not loaded: call connectrpc.loadFile() in the init context", filename)
+	}
+
+	opts, err := newUploadOptions(c.vu.Runtime(), methodDesc.Input(), options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connectrpc.uploadStream() options: %w", err)
+	}
+
+	// The call parameters such as headers and timeout share the options object
+	p, err := newCallParams(c.vu, options, c.defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connectrpc.uploadStream() options: %w", err)
+	}
+
+	var result *rpcResult
+	c.awaitMock(func() {
+		result = c.doUpload(method, methodDesc, data, opts, p)
+	})
+	return c.convertRPCResultToObject(result), nil
+}
+
+// doUpload streams the chunks of data and fills the result without touching the sobek runtime
+func (c *Client) doUpload(
+	method string,
+	methodDesc protoreflect.MethodDescriptor,
+	data []byte,
+	opts *uploadOptions,
+	p *callParams,
+) *rpcResult {
+	result := &rpcResult{}
+
+	httpClient := c.rpcHTTPClient(result)
+	if httpClient == nil {
+		return result
+	}
+	if c.connectionStrategy == "per-call" {
+		defer c.releaseHTTPClient(httpClient)
+	}
+
+	// The other fields are unmarshaled once and copied to every chunk
+	base := dynamicpb.NewMessage(methodDesc.Input())
+	if opts.message != nil {
+		if err := c.requestUnmarshaler(p).unmarshal(opts.message, base); err != nil {
+			result.err = fmt.Errorf("failed to unmarshal JSON into dynamic protobuf message: %w", err)
+			result.httpStatus = 500
+			return result
+		}
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if p.Timeout != nil && *p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.vu.Context(), *p.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.vu.Context())
+	}
+	defer cancel()
+
+	tags := c.createMetricTags(method, c.connectParams.Protocol, c.connectParams.ContentType)
+	tags.Type = "stream"
+	if len(p.Tags) > 0 {
+		custom := make(map[string]string, len(tags.Custom)+len(p.Tags))
+		for k, v := range tags.Custom {
+			custom[k] = v
+		}
+		for k, v := range p.Tags {
+			custom[k] = v
+		}
+		tags.Custom = custom
+	}
+	if c.metrics != nil {
+		c.metrics.recordStreamStart(c.vu.Context(), c.vu, tags)
+		c.metrics.recordActiveStreams(c.vu.Context(), c.vu, c.baseURL, httpClient, 1)
+	}
+
+	uploadStream := c.dynamicClient(httpClient, method, methodDesc).CallClientStream(ctx)
+	c.connectParams.setHeaders(uploadStream.RequestHeader())
+	c.defaultHeaders.Load().apply(uploadStream.RequestHeader())
+	for key, value := range p.Metadata {
+		uploadStream.RequestHeader().Set(key, value)
+	}
+
+	start := time.Now()
+	resp, err := c.sendChunks(uploadStream, base, data, opts, tags)
+	result.duration = time.Since(start)
+	result.reqSize = int64(len(data))
+
+	if c.metrics != nil {
+		c.metrics.recordStreamEnd(c.vu.Context(), c.vu, result.duration, tags, err)
+		c.metrics.recordActiveStreams(c.vu.Context(), c.vu, c.baseURL, httpClient, -1)
+	}
+
+	if err != nil {
+		result.err = err
+		var connectErr *connect.Error
+		if errors.As(err, &connectErr) {
+			result.connectErr = connectErr
+			result.httpStatus = dynamic.HTTPStatus(connectErr.Code())
+			result.headers = p.filterHeaders(connectErr.Meta())
+			result.trailers = p.filterHeaders(connectErr.Meta())
+		} else {
+			result.httpStatus = 500
+			result.headers = make(map[string][]string)
+			result.trailers = make(map[string][]string)
+		}
+		return result
+	}
+
+	responseJSON, err := protojson.Marshal(resp.Msg)
+	if err != nil {
+		result.err = fmt.Errorf("failed to marshal dynamic response to JSON: %w", err)
+		result.httpStatus = 500
+		return result
+	}
+
+	if c.metrics != nil {
+		c.metrics.recordStreamMessage(c.vu.Context(), c.vu, tags, "received", int64(len(responseJSON)))
+	}
+
+	result.responseJSON = responseJSON
+	result.conversion = c.responseConversion(resp.Msg.ProtoReflect().Descriptor())
+	result.respSize = int64(len(responseJSON))
+	result.httpStatus = 200
+	result.headers = p.filterHeaders(resp.Header())
+	result.trailers = p.filterHeaders(resp.Trailer())
+	result.discardMessage = p.DiscardResponseMessage
+
+	return result
+}
+
+// sendChunks sends data in chunks of the request messages, then waits for the response
+func (c *Client) sendChunks(
+	uploadStream *connect.ClientStreamForClient[dynamicpb.Message, dynamicpb.Message],
+	base *dynamicpb.Message,
+	data []byte,
+	opts *uploadOptions,
+	tags MetricTags,
+) (*connect.Response[dynamicpb.Message], error) {
+	// An empty file is still sent as a single empty chunk
+	for offset := 0; offset < len(data) || offset == 0; offset += opts.chunkSize {
+		end := min(offset+opts.chunkSize, len(data))
+		chunk := data[offset:end]
+
+		msg := dynamicpb.NewMessage(base.Descriptor())
+		base.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			msg.Set(fd, v)
+			return true
+		})
+		msg.Set(opts.field, protoreflect.ValueOfBytes(chunk))
+
+		if err := uploadStream.Send(msg); err != nil {
+			// The server error is returned by CloseAndReceive
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if c.metrics != nil {
+			c.metrics.recordStreamMessage(c.vu.Context(), c.vu, tags, "sent", int64(len(chunk)))
+		}
+
+		if len(data) == 0 {
+			break
+		}
+	}
+
+	return uploadStream.CloseAndReceive()
+}
@@ -0,0 +1,132 @@
+package connectrpc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newUploadServer starts a server for testdata/upload/v1/upload.proto, which echoes the
+// size and number of chunks received, and the SHA-256 of the file as its name
+func newUploadServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	compiler := &protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"testdata/upload/v1"}},
+	}
+	files, err := compiler.Compile(context.Background(), "upload.proto")
+	require.NoError(t, err)
+
+	methodDesc := files[0].Services().Get(0).Methods().Get(0)
+	procedure := "/" + string(methodDesc.Parent().FullName()) + "/" + string(methodDesc.Name())
+
+	handler := connect.NewClientStreamHandler(procedure,
+		func(_ context.Context, stream *connect.ClientStream[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+			var data bytes.Buffer
+			var chunks int64
+			for stream.Receive() {
+				msg := stream.Msg()
+				data.Write(msg.Get(msg.Descriptor().Fields().ByName("data")).Bytes())
+				chunks++
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+
+			sum := sha256.Sum256(data.Bytes())
+			resp := dynamicpb.NewMessage(methodDesc.Output())
+			fields := methodDesc.Output().Fields()
+			resp.Set(fields.ByName("name"), protoreflect.ValueOfString(hex.EncodeToString(sum[:])))
+			resp.Set(fields.ByName("size"), protoreflect.ValueOfInt64(int64(data.Len())))
+			resp.Set(fields.ByName("chunks"), protoreflect.ValueOfInt64(chunks))
+			return connect.NewResponse(resp), nil
+		},
+		connect.WithSchema(methodDesc),
+		connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(methodDesc.Input())
+			return nil
+		}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(procedure, handler)
+	return httptest.NewServer(h2c.NewHandler(mux, &http2.Server{}))
+}
+
+func TestUploadStream(t *testing.T) {
+	t.Parallel()
+
+	srv := newUploadServer(t)
+	defer srv.Close()
+
+	payload, err := os.ReadFile("testdata/upload/v1/payload.bin")
+	require.NoError(t, err)
+	sum := sha256.Sum256(payload)
+
+	ts := newTestState(t)
+
+	_, err = ts.Run(`
+		connectrpc.loadProtos([], 'testdata/upload/v1/upload.proto');
+		var size = connectrpc.loadFile('testdata/upload/v1/payload.bin');
+	`)
+	require.NoError(t, err)
+
+	ts.ToVUContext()
+
+	_, err = ts.Run(`new connectrpc.Client().uploadStream('/k6.connectrpc.upload.v1.UploadService/Upload', 'testdata/upload/v1/payload.bin')`)
+	require.ErrorContains(t, err, "client not connected")
+
+	val, err := ts.Run(`
+		var client = new connectrpc.Client();
+		client.connect('` + srv.URL + `', { plaintext: true });
+
+		var method = '/k6.connectrpc.upload.v1.UploadService/Upload';
+		var response = client.uploadStream(method, 'testdata/upload/v1/payload.bin', { chunkSize: 64 * 1024 });
+		if (response.status !== 200) {
+			throw new Error('unexpected status: ' + JSON.stringify(response.message));
+		}
+		var result = [size, response.message.size, response.message.chunks, response.message.name];
+
+		response = client.uploadStream(method, 'testdata/upload/v1/payload.bin', { chunkSize: 100000, fieldName: 'data' });
+		result.push(response.message.chunks);
+
+		var errors = [];
+		try {
+			client.uploadStream(method, 'missing.bin');
+		} catch (e) {
+			errors.push(e.message);
+		}
+		try {
+			client.uploadStream(method, 'testdata/upload/v1/payload.bin', { fieldName: 'name' });
+		} catch (e) {
+			errors.push(e.message);
+		}
+
+		JSON.stringify({ result: result, errors: errors });
+	`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"result": [150000, "150000", "3", "`+hex.EncodeToString(sum[:])+`", "2"],
+		"errors": [
+			"file \"missing.bin\" was not loaded: call connectrpc.loadFile() in the init context",
+			"invalid connectrpc.uploadStream() options: invalid fieldName: name is not a bytes field of k6.connectrpc.upload.v1.UploadRequest"
+		]
+	}`, val.String())
+
+	sent := findSamples(drainSamples(ts.samples), "connectrpc_stream_msgs_sent")
+	assert.Len(t, sent, 5)
+}
@@ -0,0 +1,52 @@
+package connectrpc
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+const (
+	// extensionModule is the module of the extension, whose version is in the default User-Agent
+	extensionModule = "github.com/bumberboy/xk6-connectrpc"
+	// k6Module is the module of k6, whose version is in the default User-Agent
+	k6Module = "go.k6.io/k6"
+)
+
+// defaultUserAgent returns the User-Agent of the calls, like k6-connectrpc/0.5.0 k6/1.4.2, so
+// that the servers can tell the load test traffic apart. The versions are the ones of the
+// modules the k6 binary was built with, devel when unknown.
+var defaultUserAgent = sync.OnceValue(func() string {
+	extension, k6 := "devel", "devel"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		modules := append([]*debug.Module{&info.Main}, info.Deps...)
+		for _, m := range modules {
+			version := strings.TrimPrefix(m.Version, "v")
+			if version == "" || version == "(devel)" {
+				continue
+			}
+			switch m.Path {
+			case extensionModule:
+				extension = version
+			case k6Module:
+				k6 = version
+			}
+		}
+	}
+	return "k6-connectrpc/" + extension + " k6/" + k6
+})
+
+// setHeaders sets the connection-level headers of a call: the User-Agent and the shadow
+// headers, then the `headers`, which may override them. The call-level headers are set afterwards.
+func (p *connectParams) setHeaders(header http.Header) {
+	if p.UserAgent != "" {
+		header.Set("User-Agent", p.UserAgent)
+	}
+	for key, value := range p.Shadow {
+		header.Set(key, value)
+	}
+	for key, value := range p.Headers {
+		header.Set(key, value)
+	}
+}
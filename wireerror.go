@@ -0,0 +1,243 @@
+package connectrpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+// Envelope flags of the frames ending the response streams
+const (
+	connectFlagEndStream = 0x02 // Connect streaming end-stream message
+	grpcWebFlagTrailer   = 0x80 // gRPC-Web trailers frame
+	envelopeFlagCompress = 0x01
+)
+
+// maxWireErrorSize bounds the error payload kept, far more than the errors sent in practice
+const maxWireErrorSize = 64 * 1024
+
+// captureWireError wraps the body of a response to keep the payload carrying its error:
+// the trailers frame of gRPC-Web, the end-stream message of Connect streams, or the JSON
+// body of a Connect unary error. gRPC sends its status in the HTTP trailers instead.
+func (p *peerInfo) captureWireError(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		resp.Body = &envelopeTail{ReadCloser: resp.Body, peer: p, endFlag: grpcWebFlagTrailer}
+	case strings.HasPrefix(contentType, "application/connect+"):
+		resp.Body = &envelopeTail{ReadCloser: resp.Body, peer: p, endFlag: connectFlagEndStream}
+	case strings.HasPrefix(contentType, "application/grpc"):
+	case resp.StatusCode != http.StatusOK:
+		resp.Body = &bodyHead{ReadCloser: resp.Body, peer: p}
+	}
+}
+
+// appendWireError appends to the wire error payload, up to maxWireErrorSize
+func (p *peerInfo) appendWireError(b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if room := maxWireErrorSize - len(p.wireError); room > 0 {
+		p.wireError = append(p.wireError, b[:min(room, len(b))]...)
+	}
+}
+
+// setWireErrorCompressed records that the wire error payload is compressed
+func (p *peerInfo) setWireErrorCompressed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.wireErrorCompressed = true
+}
+
+// bodyHead is a response body keeping its start, the error of a Connect unary call
+type bodyHead struct {
+	io.ReadCloser
+	peer *peerInfo
+}
+
+func (b *bodyHead) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.peer.appendWireError(p[:n])
+	}
+	return n, err
+}
+
+// envelopeScanner splits the bytes read from an enveloped body into the payloads of its
+// envelopes
+type envelopeScanner struct {
+	header [5]byte
+	n      int // Bytes of the current envelope header read
+	left   int // Payload bytes of the current envelope left
+}
+
+// scan calls payload with the flags of the current envelope and the part of its payload
+// in b, once its header is read, for each envelope b has a part of
+func (s *envelopeScanner) scan(b []byte, payload func(flags byte, b []byte)) {
+	for len(b) > 0 {
+		if s.n < len(s.header) {
+			read := copy(s.header[s.n:], b)
+			s.n += read
+			b = b[read:]
+			if s.n < len(s.header) {
+				return
+			}
+			s.left = int(binary.BigEndian.Uint32(s.header[1:]))
+		}
+
+		read := min(s.left, len(b))
+		payload(s.header[0], b[:read])
+		s.left -= read
+		b = b[read:]
+		if s.left == 0 {
+			s.n = 0
+		}
+	}
+}
+
+// envelopeTail is an enveloped response body keeping the payload of the frame ending it
+type envelopeTail struct {
+	io.ReadCloser
+	peer    *peerInfo
+	endFlag byte
+	envelopeScanner
+}
+
+func (e *envelopeTail) Read(p []byte) (int, error) {
+	n, err := e.ReadCloser.Read(p)
+	e.scan(p[:n], func(flags byte, payload []byte) {
+		if flags&e.endFlag == 0 {
+			return
+		}
+		if flags&envelopeFlagCompress != 0 {
+			e.peer.setWireErrorCompressed()
+		}
+		e.peer.appendWireError(payload)
+	})
+	return n, err
+}
+
+// rawError returns the error of an RPC as sent on the wire, before connect-go maps it to a
+// code: the HTTP status of the response and the code and message sent by the server, the
+// grpc-status number with gRPC and gRPC-Web. The code and message are empty when the
+// server sent none, like a proxy answering with a bare HTTP error.
+func (p *peerInfo) rawError(err *connect.Error) map[string]interface{} {
+	raw := map[string]interface{}{
+		"wire":       connect.IsWireError(err),
+		"httpStatus": 0,
+		"code":       "",
+		"message":    "",
+	}
+	if p == nil {
+		return raw
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resp == nil {
+		return raw
+	}
+	raw["httpStatus"] = p.resp.StatusCode
+
+	payload := p.wireError
+	if p.wireErrorCompressed {
+		payload = decompressWireError(payload, p.resp.Header)
+	}
+
+	contentType := p.resp.Header.Get("Content-Type")
+	var code, message string
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		code, message = grpcStatus(parseGRPCWebTrailers(payload), p.resp.Header)
+	case strings.HasPrefix(contentType, "application/grpc"):
+		code, message = grpcStatus(p.resp.Trailer, p.resp.Header)
+	case strings.HasPrefix(contentType, "application/connect+"):
+		var end struct {
+			Error *connectWireError `json:"error"`
+		}
+		if json.Unmarshal(payload, &end) == nil && end.Error != nil {
+			code, message = end.Error.Code, end.Error.Message
+		}
+	default:
+		var unary connectWireError
+		if json.Unmarshal(payload, &unary) == nil {
+			code, message = unary.Code, unary.Message
+		}
+	}
+	raw["code"] = code
+	raw["message"] = message
+	return raw
+}
+
+// decompressWireError decompresses the payload ending a stream, with the gzip or zstd
+// compression of the response. It returns nil for the other compressions.
+func decompressWireError(payload []byte, header http.Header) []byte {
+	decompressed, err := decompress(payload, responseEncoding(header), maxWireErrorSize)
+	if err != nil {
+		return nil
+	}
+	return decompressed
+}
+
+// decompress decompresses a payload with the gzip or zstd compression, up to limit bytes
+func decompress(payload []byte, encoding string, limit int64) ([]byte, error) {
+	newDecompressor := decompressors[encoding]
+	if newDecompressor == nil {
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+
+	r := newDecompressor()
+	if err := r.Reset(bytes.NewReader(payload)); err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, limit))
+}
+
+// connectWireError is the JSON of a Connect error
+type connectWireError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// grpcStatus returns the grpc-status and the decoded grpc-message of the trailers, or of
+// the headers of a trailers-only response
+func grpcStatus(trailers, headers http.Header) (string, string) {
+	for _, h := range []http.Header{trailers, headers} {
+		if code := h.Get("Grpc-Status"); code != "" {
+			message := h.Get("Grpc-Message")
+			if decoded, err := url.PathUnescape(message); err == nil {
+				message = decoded
+			}
+			return code, message
+		}
+	}
+	return "", ""
+}
+
+// parseGRPCWebTrailers parses the HTTP/1-style header block of a gRPC-Web trailers frame
+func parseGRPCWebTrailers(block []byte) http.Header {
+	trailers := make(http.Header)
+	for _, line := range strings.Split(string(block), "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		trailers.Add(textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key)), strings.TrimSpace(value))
+	}
+	return trailers
+}